@@ -0,0 +1,110 @@
+// Package client is a typed client of readeckobo's HTTP API, for tools built
+// alongside it. Its types and methods are generated from the OpenAPI
+// document readeckobo serves at /openapi.json.
+package client
+
+//go:generate go run ../cmd/openapi-client -o client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls a readeckobo server.
+type Client struct {
+	// BaseURL is where readeckobo is served, including any path prefix.
+	// The admin endpoints need the URL of the admin port when it is set.
+	BaseURL string
+	// Token is the device token sent as a bearer token, for the endpoints
+	// that take one outside their body.
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client of the readeckobo server at baseURL authenticating
+// with the device token.
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token, HTTPClient: http.DefaultClient}
+}
+
+// Error is a response of readeckobo with an error status.
+type Error struct {
+	StatusCode int
+	// Message is the error readeckobo reported, or the response body.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("readeckobo returned %d: %s", e.StatusCode, e.Message)
+}
+
+// do sends a request with body encoded as JSON, unless nil, and decodes the
+// JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	data, err := c.doRaw(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// doRaw sends a request with body encoded as JSON, unless nil, and returns
+// the response body.
+func (c *Client) doRaw(ctx context.Context, method, path string, query url.Values, body any) ([]byte, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request of %s: %w", path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %s: %w", path, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		var koboErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &koboErr) == nil && koboErr.Error != "" {
+			e.Message = koboErr.Error
+		}
+		return nil, e
+	}
+	return data, nil
+}
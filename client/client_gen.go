@@ -0,0 +1,599 @@
+// Code generated by cmd/openapi-client; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// AdminDevicesResponse is the AdminDevicesResponse schema of the API.
+type AdminDevicesResponse struct {
+	Devices []DeviceEntry `json:"devices"`
+}
+
+// AdminExtractionsResponse is the AdminExtractionsResponse schema of the API.
+type AdminExtractionsResponse struct {
+	Extractions []TrackedExtraction `json:"extractions"`
+}
+
+// AdminStatsResponse is the AdminStatsResponse schema of the API.
+type AdminStatsResponse struct {
+	Devices []DeviceStatsEntry `json:"devices"`
+	Total   DeviceStats        `json:"total"`
+}
+
+// AdminUsersResponse is the AdminUsersResponse schema of the API.
+type AdminUsersResponse struct {
+	Users []UserHealth `json:"users"`
+}
+
+// DeviceEntry is the DeviceEntry schema of the API.
+type DeviceEntry struct {
+	Device    string    `json:"device"`
+	Model     string    `json:"model,omitempty"`
+	ProductID string    `json:"product_id,omitempty"`
+	Firmware  string    `json:"firmware,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// DeviceStats is the DeviceStats schema of the API.
+type DeviceStats struct {
+	ItemsSynced        uint64 `json:"items_synced"`
+	ArticlesDownloaded uint64 `json:"articles_downloaded"`
+	ActionsSent        uint64 `json:"actions_sent"`
+	ImageBytesServed   uint64 `json:"image_bytes_served"`
+}
+
+// DeviceStatsEntry is the DeviceStatsEntry schema of the API.
+type DeviceStatsEntry struct {
+	Device             string `json:"device"`
+	ItemsSynced        uint64 `json:"items_synced"`
+	ArticlesDownloaded uint64 `json:"articles_downloaded"`
+	ActionsSent        uint64 `json:"actions_sent"`
+	ImageBytesServed   uint64 `json:"image_bytes_served"`
+}
+
+// HealthResponse is the HealthResponse schema of the API.
+type HealthResponse struct {
+	Status        string `json:"status"`
+	ExpiredTokens int    `json:"expired_tokens"`
+}
+
+// KoboAnnotation is the KoboAnnotation schema of the API.
+type KoboAnnotation struct {
+	AnnotationID string `json:"annotation_id"`
+	ItemID       string `json:"item_id"`
+	Quote        string `json:"quote"`
+	Patch        string `json:"patch"`
+	Version      string `json:"version"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// KoboArticleItem is the KoboArticleItem schema of the API.
+type KoboArticleItem struct {
+	Authors        map[string]KoboAuthor `json:"authors,omitempty"`
+	Excerpt        string                `json:"excerpt,omitempty"`
+	Favorite       string                `json:"favorite,omitempty"`
+	GivenTitle     string                `json:"given_title,omitempty"`
+	GivenURL       string                `json:"given_url,omitempty"`
+	HasImage       string                `json:"has_image,omitempty"`
+	HasVideo       string                `json:"has_video,omitempty"`
+	Image          *KoboImage            `json:"image,omitempty"`
+	Images         map[string]KoboImage  `json:"images,omitempty"`
+	IsArticle      string                `json:"is_article,omitempty"`
+	ItemID         string                `json:"item_id"`
+	ResolvedID     string                `json:"resolved_id,omitempty"`
+	ResolvedTitle  string                `json:"resolved_title,omitempty"`
+	ResolvedURL    string                `json:"resolved_url,omitempty"`
+	Status         string                `json:"status"`
+	Tags           map[string]KoboTag    `json:"tags,omitempty"`
+	TimeAdded      int64                 `json:"time_added,omitempty"`
+	TimeRead       int64                 `json:"time_read,omitempty"`
+	TimeUpdated    int64                 `json:"time_updated,omitempty"`
+	TimePublished  int64                 `json:"time_published,omitempty"`
+	Lang           string                `json:"lang,omitempty"`
+	TextDirection  string                `json:"text_direction,omitempty"`
+	DomainMetadata *KoboDomainMetadata   `json:"domain_metadata,omitempty"`
+	Videos         map[string]KoboVideo  `json:"videos,omitempty"`
+	WordCount      int                   `json:"word_count,omitempty"`
+	TimeToRead     int                   `json:"time_to_read,omitempty"`
+	Optional       map[string]any        `json:"_optional,omitempty"`
+	Annotations    []KoboAnnotation      `json:"annotations,omitempty"`
+}
+
+// KoboAuthor is the KoboAuthor schema of the API.
+type KoboAuthor struct {
+	AuthorID string `json:"author_id"`
+	ItemID   string `json:"item_id,omitempty"`
+	Name     string `json:"name"`
+}
+
+// KoboDomainMetadata is the KoboDomainMetadata schema of the API.
+type KoboDomainMetadata struct {
+	Name string `json:"name"`
+	Logo string `json:"logo,omitempty"`
+}
+
+// KoboDownloadRequest is the KoboDownloadRequest schema of the API.
+type KoboDownloadRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	Images      int    `json:"images"`
+	Refresh     int    `json:"refresh"`
+	Output      string `json:"output"`
+	URL         string `json:"url"`
+}
+
+// KoboDownloadResponse is the KoboDownloadResponse schema of the API.
+type KoboDownloadResponse struct {
+	Images  map[string]KoboImage `json:"images"`
+	Videos  map[string]KoboVideo `json:"videos"`
+	Article string               `json:"article"`
+}
+
+// KoboGetRequest is the KoboGetRequest schema of the API.
+type KoboGetRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	ContentType string `json:"contentType"`
+	Count       string `json:"count"`
+	DetailType  string `json:"detailType"`
+	Offset      string `json:"offset"`
+	State       string `json:"state"`
+	Total       string `json:"total"`
+	Since       any    `json:"since"`
+	Search      string `json:"search,omitempty"`
+}
+
+// KoboGetResponse is the KoboGetResponse schema of the API.
+type KoboGetResponse struct {
+	Status int                        `json:"status"`
+	List   map[string]KoboArticleItem `json:"list"`
+	Total  int                        `json:"total"`
+}
+
+// KoboImage is the KoboImage schema of the API.
+type KoboImage struct {
+	ImageID string `json:"image_id,omitempty"`
+	ItemID  string `json:"item_id,omitempty"`
+	Src     string `json:"src"`
+}
+
+// KoboSendRequest is the KoboSendRequest schema of the API.
+type KoboSendRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	Actions     []any  `json:"actions"`
+}
+
+// KoboSendResponse is the KoboSendResponse schema of the API.
+type KoboSendResponse struct {
+	Status        bool   `json:"status"`
+	ActionResults []bool `json:"action_results"`
+	DryRun        bool   `json:"dry_run,omitempty"`
+}
+
+// KoboTag is the KoboTag schema of the API.
+type KoboTag struct {
+	ItemID string `json:"item_id"`
+	Tag    string `json:"tag"`
+}
+
+// KoboVideo is the KoboVideo schema of the API.
+type KoboVideo struct {
+	VideoID string `json:"video_id"`
+	ItemID  string `json:"item_id"`
+	Src     string `json:"src"`
+	Width   string `json:"width"`
+	Height  string `json:"height"`
+	Type    string `json:"type"`
+	Vid     string `json:"vid"`
+}
+
+// PocketAddRequest is the PocketAddRequest schema of the API.
+type PocketAddRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Tags        string `json:"tags"`
+}
+
+// PocketAddResponse is the PocketAddResponse schema of the API.
+type PocketAddResponse struct {
+	Item   PocketItem `json:"item"`
+	Status int        `json:"status"`
+}
+
+// PocketDiscoverRequest is the PocketDiscoverRequest schema of the API.
+type PocketDiscoverRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	Count       string `json:"count,omitempty"`
+}
+
+// PocketExportItem is the PocketExportItem schema of the API.
+type PocketExportItem struct {
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	TimeAdded int64  `json:"time_added"`
+	Tags      string `json:"tags"`
+	Status    string `json:"status"`
+}
+
+// PocketImportFailure is the PocketImportFailure schema of the API.
+type PocketImportFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// PocketImportResponse is the PocketImportResponse schema of the API.
+type PocketImportResponse struct {
+	Imported int                   `json:"imported"`
+	Skipped  int                   `json:"skipped"`
+	Failed   []PocketImportFailure `json:"failed"`
+}
+
+// PocketItem is the PocketItem schema of the API.
+type PocketItem struct {
+	ItemID    string `json:"item_id,omitempty"`
+	NormalURL string `json:"normal_url"`
+	Title     string `json:"title,omitempty"`
+}
+
+// PocketOAuthAuthorizeRequest is the PocketOAuthAuthorizeRequest schema of the API.
+type PocketOAuthAuthorizeRequest struct {
+	ConsumerKey string `json:"consumer_key"`
+	Code        string `json:"code"`
+}
+
+// PocketOAuthAuthorizeResponse is the PocketOAuthAuthorizeResponse schema of the API.
+type PocketOAuthAuthorizeResponse struct {
+	AccessToken string `json:"access_token"`
+	Username    string `json:"username"`
+}
+
+// PocketOAuthRequest is the PocketOAuthRequest schema of the API.
+type PocketOAuthRequest struct {
+	ConsumerKey string `json:"consumer_key"`
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
+}
+
+// PocketOAuthRequestResponse is the PocketOAuthRequestResponse schema of the API.
+type PocketOAuthRequestResponse struct {
+	Code  string `json:"code"`
+	State string `json:"state,omitempty"`
+}
+
+// ReadinessCheck is the ReadinessCheck schema of the API.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReadinessResponse is the ReadinessResponse schema of the API.
+type ReadinessResponse struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// RetryExtractionResponse is the RetryExtractionResponse schema of the API.
+type RetryExtractionResponse struct {
+	BookmarkID string `json:"bookmark_id"`
+	URL        string `json:"url"`
+}
+
+// SaveRequest is the SaveRequest schema of the API.
+type SaveRequest struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// SaveResponse is the SaveResponse schema of the API.
+type SaveResponse struct {
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url"`
+}
+
+// TrackedExtraction is the TrackedExtraction schema of the API.
+type TrackedExtraction struct {
+	BookmarkID string    `json:"bookmark_id"`
+	URL        string    `json:"url"`
+	Device     string    `json:"device"`
+	Added      time.Time `json:"added"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Retries    int       `json:"retries"`
+}
+
+// UserHealth is the UserHealth schema of the API.
+type UserHealth struct {
+	User         string    `json:"user"`
+	ReadeckToken string    `json:"readeck_token"`
+	LastError    string    `json:"last_error,omitempty"`
+	ChangedAt    time.Time `json:"changed_at,omitzero"`
+}
+
+// KoboGet calls POST /api/kobo/get.
+// Lists the bookmarks to sync to the device.
+func (c *Client) KoboGet(ctx context.Context, body *KoboGetRequest) (*KoboGetResponse, error) {
+	var out KoboGetResponse
+	if err := c.do(ctx, "POST", "/api/kobo/get", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// KoboDownload calls POST /api/kobo/download.
+// Returns an article prepared for the device.
+func (c *Client) KoboDownload(ctx context.Context, body *KoboDownloadRequest) (*KoboDownloadResponse, error) {
+	var out KoboDownloadResponse
+	if err := c.do(ctx, "POST", "/api/kobo/download", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// KoboSend calls POST /api/kobo/send.
+// Applies the actions of the device to its bookmarks.
+func (c *Client) KoboSend(ctx context.Context, body *KoboSendRequest) (*KoboSendResponse, error) {
+	var out KoboSendResponse
+	if err := c.do(ctx, "POST", "/api/kobo/send", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// KoboDiscover calls POST /api/kobo/discover.
+// Lists the bookmarks of the device's discovery tab.
+func (c *Client) KoboDiscover(ctx context.Context, body *PocketDiscoverRequest) (*KoboGetResponse, error) {
+	var out KoboGetResponse
+	if err := c.do(ctx, "POST", "/api/kobo/discover", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PocketDiscover calls POST /v3/discover.
+// Lists the bookmarks of the device's discovery tab.
+func (c *Client) PocketDiscover(ctx context.Context, body *PocketDiscoverRequest) (*KoboGetResponse, error) {
+	var out KoboGetResponse
+	if err := c.do(ctx, "POST", "/v3/discover", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PocketRecommendations calls POST /v3/recommendations.
+// Lists the bookmarks of the device's discovery tab.
+func (c *Client) PocketRecommendations(ctx context.Context, body *PocketDiscoverRequest) (*KoboGetResponse, error) {
+	var out KoboGetResponse
+	if err := c.do(ctx, "POST", "/v3/recommendations", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PocketAdd calls POST /v3/add.
+// Saves a URL to Readeck.
+func (c *Client) PocketAdd(ctx context.Context, body *PocketAddRequest) (*PocketAddResponse, error) {
+	var out PocketAddResponse
+	if err := c.do(ctx, "POST", "/v3/add", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PocketOAuthRequest calls POST /v3/oauth/request.
+// Starts the Pocket sign-in of the device.
+func (c *Client) PocketOAuthRequest(ctx context.Context, body *PocketOAuthRequest) (*PocketOAuthRequestResponse, error) {
+	var out PocketOAuthRequestResponse
+	if err := c.do(ctx, "POST", "/v3/oauth/request", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PocketOAuthAuthorize calls POST /v3/oauth/authorize.
+// Completes the Pocket sign-in of the device.
+func (c *Client) PocketOAuthAuthorize(ctx context.Context, body *PocketOAuthAuthorizeRequest) (*PocketOAuthAuthorizeResponse, error) {
+	var out PocketOAuthAuthorizeResponse
+	if err := c.do(ctx, "POST", "/v3/oauth/authorize", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConvertImage calls GET /api/convert-image.
+// Converts an article image for the device's screen.
+func (c *Client) ConvertImage(ctx context.Context, urlParam string, referer string, profile string, quality string) ([]byte, error) {
+	query := url.Values{}
+	if urlParam != "" {
+		query.Set("url", urlParam)
+	}
+	if referer != "" {
+		query.Set("referer", referer)
+	}
+	if profile != "" {
+		query.Set("profile", profile)
+	}
+	if quality != "" {
+		query.Set("quality", quality)
+	}
+	return c.doRaw(ctx, "GET", "/api/convert-image", query, nil)
+}
+
+// Math calls GET /api/math.
+// Draws a TeX formula.
+func (c *Client) Math(ctx context.Context, tex string, display string) ([]byte, error) {
+	query := url.Values{}
+	if tex != "" {
+		query.Set("tex", tex)
+	}
+	if display != "" {
+		query.Set("display", display)
+	}
+	return c.doRaw(ctx, "GET", "/api/math", query, nil)
+}
+
+// QrCode calls GET /api/qr.
+// Draws a link as a QR code.
+func (c *Client) QrCode(ctx context.Context, data string) ([]byte, error) {
+	query := url.Values{}
+	if data != "" {
+		query.Set("data", data)
+	}
+	return c.doRaw(ctx, "GET", "/api/qr", query, nil)
+}
+
+// Code calls GET /api/code.
+// Draws a code block.
+func (c *Client) Code(ctx context.Context, cParam string) ([]byte, error) {
+	query := url.Values{}
+	if cParam != "" {
+		query.Set("c", cParam)
+	}
+	return c.doRaw(ctx, "GET", "/api/code", query, nil)
+}
+
+// Resource calls GET /api/resource.
+// Serves a resource of a bookmark.
+func (c *Client) Resource(ctx context.Context, src string, device string, sig string) ([]byte, error) {
+	query := url.Values{}
+	if src != "" {
+		query.Set("src", src)
+	}
+	if device != "" {
+		query.Set("device", device)
+	}
+	if sig != "" {
+		query.Set("sig", sig)
+	}
+	return c.doRaw(ctx, "GET", "/api/resource", query, nil)
+}
+
+// Save calls POST /api/save.
+// Saves a URL to Readeck for the device.
+func (c *Client) Save(ctx context.Context, body *SaveRequest) (*SaveResponse, error) {
+	var out SaveResponse
+	if err := c.do(ctx, "POST", "/api/save", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PocketExport calls GET /api/pocket/export.
+// Exports the device's bookmarks like a Pocket export.
+func (c *Client) PocketExport(ctx context.Context, format string) ([]byte, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	return c.doRaw(ctx, "GET", "/api/pocket/export", query, nil)
+}
+
+// PocketImport calls POST /api/pocket/import.
+// Imports a Pocket export to Readeck.
+func (c *Client) PocketImport(ctx context.Context, body []PocketExportItem) (*PocketImportResponse, error) {
+	var out PocketImportResponse
+	if err := c.do(ctx, "POST", "/api/pocket/import", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Digest calls GET /api/digest.
+// Downloads the EPUB digest of unread articles.
+func (c *Client) Digest(ctx context.Context, date string) ([]byte, error) {
+	query := url.Values{}
+	if date != "" {
+		query.Set("date", date)
+	}
+	return c.doRaw(ctx, "GET", "/api/digest", query, nil)
+}
+
+// DigestOPDS calls GET /api/digest/opds.
+// Lists the digests as an OPDS catalog.
+func (c *Client) DigestOPDS(ctx context.Context) ([]byte, error) {
+	return c.doRaw(ctx, "GET", "/api/digest/opds", nil, nil)
+}
+
+// Health calls GET /healthz.
+// Reports whether the bridge is up and how many Readeck tokens were rejected.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var out HealthResponse
+	if err := c.do(ctx, "GET", "/healthz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminUsers calls GET /admin/api/users.
+// Lists the configured devices and their Readeck token state.
+func (c *Client) AdminUsers(ctx context.Context) (*AdminUsersResponse, error) {
+	var out AdminUsersResponse
+	if err := c.do(ctx, "GET", "/admin/api/users", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminExtractions calls GET /admin/api/extractions.
+// Lists the URLs recently added from devices.
+func (c *Client) AdminExtractions(ctx context.Context, status string) (*AdminExtractionsResponse, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	var out AdminExtractionsResponse
+	if err := c.do(ctx, "GET", "/admin/api/extractions", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminRetryExtraction calls POST /admin/api/extractions/{id}/retry.
+// Adds the URL of a failed extraction again.
+func (c *Client) AdminRetryExtraction(ctx context.Context, id string) (*RetryExtractionResponse, error) {
+	var out RetryExtractionResponse
+	if err := c.do(ctx, "POST", "/admin/api/extractions/"+url.PathEscape(id)+"/retry", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminStats calls GET /admin/api/stats.
+// Reports the statistics of each device.
+func (c *Client) AdminStats(ctx context.Context) (*AdminStatsResponse, error) {
+	var out AdminStatsResponse
+	if err := c.do(ctx, "GET", "/admin/api/stats", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminDevices calls GET /admin/api/devices.
+// Lists the Kobo identified for each device.
+func (c *Client) AdminDevices(ctx context.Context) (*AdminDevicesResponse, error) {
+	var out AdminDevicesResponse
+	if err := c.do(ctx, "GET", "/admin/api/devices", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminReadiness calls GET /admin/api/readiness.
+// Checks that Readeck answers and accepts each device's token.
+func (c *Client) AdminReadiness(ctx context.Context) (*ReadinessResponse, error) {
+	var out ReadinessResponse
+	if err := c.do(ctx, "GET", "/admin/api/readiness", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"readeckobo/internal/app"
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+	"readeckobo/internal/openapi"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestGeneratedClientIsCurrent(t *testing.T) {
+	want, err := openapi.GenerateClient(app.OpenAPI(), "client", "cmd/openapi-client")
+	if err != nil {
+		t.Fatalf("GenerateClient failed: %v", err)
+	}
+	got, err := os.ReadFile("client_gen.go")
+	if err != nil {
+		t.Fatalf("Failed to read client_gen.go: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("client_gen.go is out of date; run go generate ./client")
+	}
+}
+
+func TestClient(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "One"}, "")
+
+	application := app.NewApp(
+		app.WithConfig(&config.Config{
+			Users:   []config.User{{Token: "device-token", ReadeckAccessToken: "readeck-token"}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		app.WithLogger(logger.New(logger.ERROR)),
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/kobo/get", application.HandleKoboGet)
+	mux.HandleFunc("GET /admin/api/users", application.HandleAdminUsers)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := New(server.URL+"/", "device-token")
+	resp, err := c.KoboGet(t.Context(), &KoboGetRequest{AccessToken: "device-token", State: "unread"})
+	if err != nil {
+		t.Fatalf("KoboGet failed: %v", err)
+	}
+	if len(resp.List) != 1 || resp.List["1"].ResolvedTitle != "One" {
+		t.Errorf("expected the bookmark in the list, got %+v", resp.List)
+	}
+
+	users, err := c.AdminUsers(t.Context())
+	if err != nil {
+		t.Fatalf("AdminUsers failed: %v", err)
+	}
+	if len(users.Users) != 1 || users.Users[0].ReadeckToken != "valid" {
+		t.Errorf("expected one valid user, got %+v", users.Users)
+	}
+
+	_, err = c.KoboGet(t.Context(), &KoboGetRequest{AccessToken: "bogus"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Invalid access token" {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+}
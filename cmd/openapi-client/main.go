@@ -0,0 +1,26 @@
+// Command openapi-client generates the client package from the OpenAPI
+// document of readeckobo.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"readeckobo/internal/app"
+	"readeckobo/internal/openapi"
+)
+
+func main() {
+	output := flag.String("o", "client_gen.go", "file to write the client to")
+	pkg := flag.String("package", "client", "package of the client")
+	flag.Parse()
+
+	src, err := openapi.GenerateClient(app.OpenAPI(), *pkg, "cmd/openapi-client")
+	if err != nil {
+		log.Fatalf("Error generating client: %v", err)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatalf("Error writing client: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+	"readeckobo/internal/proxy"
+	"readeckobo/internal/readeck"
+)
+
+// runLogin exchanges Readeck credentials for an API token and stores it in
+// the configuration for the given device token.
+func runLogin(configPath string, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	username := fs.String("username", "", "Readeck username")
+	deviceToken := fs.String("token", "", "device token of the user to store the Readeck token for")
+	application := fs.String("application", "readeckobo", "application name shown in Readeck's token list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" || *deviceToken == "" {
+		fs.Usage()
+		return errors.New("both -username and -token are required")
+	}
+
+	password := os.Getenv("READECK_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Readeck password: ")
+		var err error
+		password, err = readPassword()
+		if err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+	}
+
+	cfg, err := config.LoadReadeck(configPath)
+	if err != nil {
+		return err
+	}
+
+	readeckProxy, err := proxy.Config(cfg.Proxy).Func()
+	if err != nil {
+		return err
+	}
+	httpClient, err := readeck.NewHTTPClient(readeck.TLSConfig(cfg.TLS), readeck.TransportConfig(cfg.Transport), readeckProxy)
+	if err != nil {
+		return err
+	}
+	client, err := readeck.NewClient(cfg.Host, "", logger.New(logger.WARN), httpClient)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := client.Login(ctx, *username, password, *application)
+	if err != nil {
+		return err
+	}
+
+	if err := config.SaveReadeckAccessToken(configPath, *deviceToken, token.Token); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+
+	fmt.Printf("Stored a new Readeck token for device token %s in %s\n", *deviceToken, configPath)
+	return nil
+}
+
+// readPassword reads a line from stdin, without echoing it when stdin is a
+// terminal.
+func readPassword() (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -1,16 +1,58 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"readeckobo/internal/app"
+	"readeckobo/internal/capture"
+	"readeckobo/internal/certs"
 	"readeckobo/internal/config"
+	"readeckobo/internal/dnsserver"
 	"readeckobo/internal/logger"
+	"readeckobo/internal/mdns"
+	"readeckobo/internal/proxy"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/tracing"
 	"readeckobo/internal/webserver"
 )
 
+// tracingShutdownTimeout bounds the export of the spans left at exit.
+const tracingShutdownTimeout = 5 * time.Second
+
+// findConfig returns the first configuration file of config.Paths that
+// exists, or the first of them.
+func findConfig() string {
+	for _, path := range config.Paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return config.Paths[0]
+}
+
 func main() {
-	cfg, err := config.Load("./config.yaml")
+	configPath := findConfig()
+	if len(os.Args) > 1 && os.Args[1] == "login" {
+		if err := runLogin(configPath, os.Args[2:]); err != nil {
+			log.Fatalf("Error logging in to Readeck: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		if err := runValidate(configPath, os.Args[2:]); err != nil {
+			log.Fatalf("Error validating configuration: %v", err)
+		}
+		return
+	}
+
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
@@ -20,16 +62,137 @@ func main() {
 		log.Fatalf("Error parsing log level: %v", err)
 	}
 	appLogger := logger.New(logLevel)
+	if cfg.UnsafeDump {
+		appLogger.SetUnsafeDump(true)
+		appLogger.Warnf("unsafe_dump is enabled: debug logs will contain device and Readeck tokens")
+	}
+	if cfg.DryRun {
+		appLogger.Warnf("dry_run is enabled: actions sent by the Kobo are logged but not applied to Readeck")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+
+	readeckProxy, err := proxy.Config(cfg.Readeck.Proxy).Func()
+	if err != nil {
+		log.Fatalf("Error setting up Readeck proxy: %v", err)
+	}
+	readeckHTTPClient, err := readeck.NewHTTPClient(readeck.TLSConfig(cfg.Readeck.TLS), readeck.TransportConfig(cfg.Readeck.Transport), readeckProxy)
+	if err != nil {
+		log.Fatalf("Error setting up Readeck TLS: %v", err)
+	}
+	imageTransport, err := proxy.Config(cfg.Images.Proxy).Transport()
+	if err != nil {
+		log.Fatalf("Error setting up image proxy: %v", err)
+	}
+	if cfg.Readeck.TLS.InsecureSkipVerify {
+		appLogger.Warnf("readeck.tls.insecure_skip_verify is enabled: the Readeck certificate is not verified")
+	}
 
 	// Initialize application
-	application := app.NewApp(
+	options := []app.Option{
 		app.WithConfig(cfg),
+		app.WithConfigPath(configPath),
 		app.WithLogger(appLogger),
-	)
+		app.WithReadeckHTTPClient(readeckHTTPClient),
+		app.WithImageHTTPClient(&http.Client{Timeout: 5 * time.Second, Transport: imageTransport}),
+		app.WithFeedHTTPClient(&http.Client{Timeout: 30 * time.Second, Transport: imageTransport}),
+	}
+	if cfg.Capture.Dir != "" || cfg.Capture.Recent > 0 {
+		recorder, err := capture.NewRecorder(cfg.Capture.Dir, appLogger)
+		if err != nil {
+			log.Fatalf("Error setting up capture: %v", err)
+		}
+		if cfg.Capture.Dir != "" {
+			appLogger.Warnf("capture is enabled: Kobo requests and responses, including article contents, are written to %s", cfg.Capture.Dir)
+		}
+		recorder.KeepRecent(cfg.Capture.Recent)
+		options = append(options, app.WithCapture(recorder))
+	}
+	if cfg.Certs.Dir != "" {
+		ca, err := certs.Load(cfg.Certs.Dir, cfg.Certs.Hosts)
+		if err != nil {
+			log.Fatalf("Error setting up certificates: %v", err)
+		}
+		appLogger.Infof("Certificates for %v issued by the authority in %s", ca.Hosts(), cfg.Certs.Dir)
+		options = append(options, app.WithCertificates(ca))
+	}
+	application := app.NewApp(options...)
 
-	// Initialize and start the web server
-	webserver.ListenAndServe(cfg.Server.Port, application, appLogger)
+	if err := application.LoadActionQueue(); err != nil {
+		log.Fatalf("Error loading action queue: %v", err)
+	}
+	if err := application.LoadURLIndex(); err != nil {
+		log.Fatalf("Error loading URL index: %v", err)
+	}
+	if err := application.LoadStats(); err != nil {
+		log.Fatalf("Error loading statistics: %v", err)
+	}
+	if err := application.LoadDevices(); err != nil {
+		log.Fatalf("Error loading devices: %v", err)
+	}
+	if err := application.LoadPortal(); err != nil {
+		log.Fatalf("Error loading portal state: %v", err)
+	}
+	if err := application.LoadFeedState(); err != nil {
+		log.Fatalf("Error loading feed state: %v", err)
+	}
+	go application.RunActionQueue(context.Background())
+	go application.RunExtractionChecks(context.Background())
+	go application.RunFeedPolls(context.Background())
+	go application.RunDigests(context.Background())
+
+	if cfg.DNS.Listen != "" {
+		dnsServer, err := dnsserver.New(cfg.DNS, appLogger)
+		if err != nil {
+			log.Fatalf("Error setting up DNS server: %v", err)
+		}
+		conn, err := net.ListenPacket("udp", cfg.DNS.Listen)
+		if err != nil {
+			log.Fatalf("Error starting DNS server: %v", err)
+		}
+		appLogger.Infof("DNS server answering for %v on %s", cfg.DNS.Hosts, conn.LocalAddr())
+		go func() {
+			if err := dnsServer.Serve(conn); err != nil {
+				appLogger.Errorf("DNS server failed: %v", err)
+			}
+		}()
+	}
 
-	// Keep the main goroutine alive
-	select {}
+	if cfg.MDNS.Enabled {
+		responder, err := mdns.New(cfg, appLogger)
+		if err != nil {
+			log.Fatalf("Error setting up mDNS: %v", err)
+		}
+		conn, err := mdns.Listen()
+		if err != nil {
+			log.Fatalf("Error starting mDNS: %v", err)
+		}
+		go func() {
+			if err := responder.Serve(conn); err != nil {
+				appLogger.Errorf("mDNS responder failed: %v", err)
+			}
+		}()
+	}
+
+	// Initialize and start the web server; the other servers keep running
+	// if it fails, until a signal stops the process.
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	served := make(chan struct{})
+	go func() {
+		webserver.ListenAndServe(stop, cfg, application, appLogger)
+		close(served)
+	}()
+	<-stop.Done()
+
+	appLogger.Infof("Shutting down.")
+	<-served
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancelShutdown()
+	if err := shutdownTracing(ctx); err != nil {
+		appLogger.Errorf("Error flushing traces: %v", err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"readeckobo/internal/app"
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+	"readeckobo/internal/proxy"
+	"readeckobo/internal/readeck"
+)
+
+// runValidate checks the configuration and, with -live, that Readeck is
+// reachable, that it accepts each user's token and that the ports are free.
+func runValidate(configPath string, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	live := fs.Bool("live", false, "also check Readeck, the users' tokens and the ports")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Configuration %s is valid: %d users\n", configPath, len(cfg.Users))
+	if !*live {
+		return nil
+	}
+
+	readeckProxy, err := proxy.Config(cfg.Readeck.Proxy).Func()
+	if err != nil {
+		return err
+	}
+	httpClient, err := readeck.NewHTTPClient(readeck.TLSConfig(cfg.Readeck.TLS), readeck.TransportConfig(cfg.Readeck.Transport), readeckProxy)
+	if err != nil {
+		return err
+	}
+	application := app.NewApp(
+		app.WithConfig(cfg),
+		app.WithLogger(logger.New(logger.ERROR)),
+		app.WithReadeckHTTPClient(httpClient),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	failed := 0
+	for _, check := range application.Readiness(ctx, true) {
+		status := "ok  "
+		if !check.OK {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s %s: %s\n", status, check.Name, check.Detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	fmt.Println("readeckobo is ready")
+	return nil
+}
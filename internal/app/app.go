@@ -4,28 +4,33 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"image"
 	"image/draw"
 	_ "image/gif"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
 	"golang.org/x/net/html"
+	"golang.org/x/sync/errgroup"
+	"readeckobo/internal/capture"
+	"readeckobo/internal/certs"
 	"readeckobo/internal/config"
 	"readeckobo/internal/logger"
 	"readeckobo/internal/models"
 	"readeckobo/internal/readeck"
+	"readeckobo/internal/tracing"
+	"readeckobo/internal/urlnorm"
 )
 
 type App struct {
@@ -33,6 +38,57 @@ type App struct {
 	Logger            *logger.Logger
 	ImageHTTPClient   *http.Client
 	ReadeckHTTPClient *http.Client
+	// FeedHTTPClient fetches the feeds of feeds.sources and Miniflux.
+	FeedHTTPClient *http.Client
+	// OriginHTTPClient fetches bookmarked pages for the readability
+	// fallback; it defaults to one that only reaches public addresses.
+	OriginHTTPClient *http.Client
+	// Capture, when set, records Kobo requests and the Readeck calls made
+	// to answer them.
+	Capture *capture.Recorder
+	// Certificates, when set, is the local certificate authority whose
+	// certificate devices download.
+	Certificates *certs.Authority
+
+	tokens *tokenStore
+	caches []Cache
+	// contexts holds the Readeck client, sync cache and running syncs of
+	// each device.
+	contexts *userContexts
+	// articles caches article HTML; nil when readeck.article_cache_size is 0.
+	articles *articleCache
+	// stats counts what each device synced, downloaded and sent.
+	stats *statsStore
+	// readeckLimiter paces the requests of all devices; nil when
+	// readeck.rate_limit.requests_per_second is 0.
+	readeckLimiter *readeck.RateLimiter
+	// syncOutcomes counts how syncs were served.
+	syncOutcomes *outcomeCounter
+	// skippedItems counts the bookmarks left out of syncs.
+	skippedItems *outcomeCounter
+	// consumerKeys counts the Pocket API requests by consumer key.
+	consumerKeys *outcomeCounter
+	// queue holds send actions waiting for Readeck to come back.
+	queue *actionQueue
+	// urls finds the bookmarks of /api/kobo/download requests.
+	urls *urlIndex
+	// extractions follows the bookmarks added from devices.
+	extractions *extractionTracker
+	// feeds remembers the feed entries already saved.
+	feeds *feedState
+	// digests keeps the digest EPUBs built for each device.
+	digests *digestStore
+	// devices keeps the model, firmware and serial of each device.
+	devices *deviceStore
+	// portal keeps the owners and sync choices of devices from the user
+	// portal, whose logins are in sessions.
+	portal   *portalState
+	sessions *portalSessions
+
+	// usersMu guards Config.Users, which grows when devices are set up.
+	usersMu sync.RWMutex
+	// configPath is where users added at runtime are persisted.
+	configPath string
 }
 
 func WithImageHTTPClient(client *http.Client) Option {
@@ -41,13 +97,71 @@ func WithImageHTTPClient(client *http.Client) Option {
 	}
 }
 
+// WithFeedHTTPClient sets the client that fetches feeds.
+func WithFeedHTTPClient(client *http.Client) Option {
+	return func(a *App) {
+		a.FeedHTTPClient = client
+	}
+}
+
+// WithOriginHTTPClient sets the client that fetches bookmarked pages.
+func WithOriginHTTPClient(client *http.Client) Option {
+	return func(a *App) {
+		a.OriginHTTPClient = client
+	}
+}
+
 type Option func(*App)
 
 func NewApp(opts ...Option) *App {
-	app := &App{}
+	app := &App{tokens: newTokenStore(), contexts: newUserContexts(0, 0), extractions: newExtractionTracker(), syncOutcomes: newOutcomeCounter(), skippedItems: newOutcomeCounter(), consumerKeys: newOutcomeCounter(), digests: newDigestStore()}
 	for _, opt := range opts {
 		opt(app)
 	}
+	if app.OriginHTTPClient == nil {
+		app.OriginHTTPClient = newOriginHTTPClient()
+	}
+	app.queue = newActionQueue("")
+	app.urls = newURLIndex("")
+	app.stats = newStatsStore("")
+	app.feeds = newFeedState("")
+	app.devices = newDeviceStore("")
+	app.portal = newPortalState("")
+	app.sessions = newPortalSessions(app.revokePortalToken)
+	if app.Config != nil {
+		app.queue = newActionQueue(app.Config.ActionQueue.File)
+		app.urls = newURLIndex(app.Config.URLIndex.File)
+		app.stats = newStatsStore(app.Config.Stats.File)
+		app.feeds = newFeedState(app.Config.Feeds.File)
+		app.devices = newDeviceStore(app.Config.Devices.File)
+		app.portal = newPortalState(app.Config.Portal.File)
+	}
+	if app.Capture != nil {
+		app.Capture.Secrets = app.secrets
+		client := &http.Client{}
+		if app.ReadeckHTTPClient != nil {
+			copied := *app.ReadeckHTTPClient
+			client = &copied
+		}
+		client.Transport = app.Capture.Transport(client.Transport)
+		app.ReadeckHTTPClient = client
+	}
+	if app.Config != nil && app.Config.Readeck.ArticleCacheSize > 0 {
+		app.articles = newArticleCache(app.Config.Readeck.ArticleCacheSize)
+		app.RegisterCache(app.articles)
+	}
+	if app.Config != nil && app.Config.Readeck.RateLimit.RequestsPerSecond > 0 {
+		app.readeckLimiter = readeck.NewRateLimiter(app.Config.Readeck.RateLimit.RequestsPerSecond, app.Config.Readeck.RateLimit.Burst)
+	}
+	if app.Config != nil {
+		app.contexts = newUserContexts(app.Config.Readeck.SyncCacheTTL, app.Config.Readeck.BookmarkCacheSize)
+		if app.Config.Readeck.SyncCacheTTL > 0 {
+			app.RegisterCache(syncCaches{contexts: app.contexts})
+		}
+		if app.Config.Readeck.BookmarkCacheSize > 0 {
+			app.RegisterCache(bookmarkCaches{contexts: app.contexts})
+		}
+	}
 	return app
 }
 
@@ -57,6 +171,13 @@ func WithConfig(cfg *config.Config) Option {
 	}
 }
 
+// WithConfigPath sets the configuration file that new users are saved to.
+func WithConfigPath(path string) Option {
+	return func(a *App) {
+		a.configPath = path
+	}
+}
+
 func WithLogger(logger *logger.Logger) Option {
 	return func(a *App) {
 		a.Logger = logger
@@ -69,74 +190,112 @@ func WithReadeckHTTPClient(client *http.Client) Option {
 	}
 }
 
-func (a *App) handleFullSync(ctx context.Context, readeckClient *readeck.Client, req *models.KoboGetRequest) (map[string]models.KoboArticleItem, int, error) {
-	count, _ := strconv.Atoi(req.Count)
-	offset, _ := strconv.Atoi(req.Offset)
-
-	bsyncs, err := readeckClient.GetBookmarksSync(ctx, nil)
-	if err != nil {
-		a.Logger.Errorf("Full Sync: Error getting bookmark syncs: %v", err)
-		return nil, 0, fmt.Errorf("failed to get bookmark syncs: %w", err)
+// WithCertificates sets the local certificate authority offered to devices.
+func WithCertificates(ca *certs.Authority) Option {
+	return func(a *App) {
+		a.Certificates = ca
 	}
-	a.Logger.Debugf("Full Sync: GetBookmarksSync returned %d sync events.", len(bsyncs))
+}
 
-	var candidateBookmarkIDs []string
-	for _, bsync := range bsyncs {
-		if bsync.Type != "delete" {
-			candidateBookmarkIDs = append(candidateBookmarkIDs, bsync.ID)
-		}
+// WithCapture records Kobo traffic and the Readeck calls it causes with rec.
+func WithCapture(rec *capture.Recorder) Option {
+	return func(a *App) {
+		a.Capture = rec
 	}
+}
 
-	bookmarksDetailsMap, err := readeckClient.SyncBookmarksContent(ctx, candidateBookmarkIDs)
-	if err != nil {
-		a.Logger.Errorf("Full Sync: Error getting bookmark details: %v", err)
-		return nil, 0, fmt.Errorf("failed to get bookmark details: %w", err)
+// fullSyncPageSize is the page size used when the Kobo asks for every item.
+const fullSyncPageSize = 100
+
+// fullSyncSort orders bookmarks newest first, so that offset/count windows
+// do not overlap or skip items between requests. Readeck only sorts by
+// created, domain, duration, published, site and title, none of them unique;
+// the title separates the bookmarks imported at the same instant.
+var fullSyncSort = []string{"-created", "title"}
+
+func (a *App) handleFullSync(ctx context.Context, readeckClient *readeck.Client, req *models.KoboGetRequest, search string, bookmarkCache *bookmarkCache) (map[string]models.KoboArticleItem, int, error) {
+	count, _ := strconv.Atoi(req.Count)
+	offset, _ := strconv.Atoi(req.Offset)
+
+	opts := readeck.ListBookmarksOptions{
+		IsArchived: archiveFilter(req.State),
+		Search:     search,
+		Limit:      count,
+		Offset:     offset,
+		Sort:       fullSyncSort,
+		Types:      a.listTypes(),
+	}
+	if count == 0 {
+		opts.Limit = fullSyncPageSize
 	}
 
-	actualBookmarks := []models.KoboArticleItem{}
-	for _, bsync := range bsyncs {
-		if bsync.Type == "delete" {
-			continue
+	resultList := make(map[string]models.KoboArticleItem)
+	totalBookmarks := 0
+	// skipped counts the listed bookmarks left out on every page, which
+	// Readeck's total still includes.
+	skipped := 0
+	synced := time.Now()
+
+	for {
+		bookmarks, total, err := readeckClient.ListBookmarks(ctx, opts)
+		if err != nil {
+			a.Logger.Errorf("Full Sync: Error listing bookmarks: %v", err)
+			return nil, 0, fmt.Errorf("failed to list bookmarks: %w", err)
 		}
-		bookmark, found := bookmarksDetailsMap[bsync.ID]
-		if !found || bookmark == nil || bookmark.IsArchived {
-			continue
+		a.Logger.Debugf("Full Sync: ListBookmarks returned %d of %d bookmarks at offset %d.", len(bookmarks), total, opts.Offset)
+		totalBookmarks = total
+
+		for i := range bookmarks {
+			bookmarkCache.put(&bookmarks[i])
+			if opts.IsArchived != nil && bookmarks[i].IsArchived != *opts.IsArchived || a.excludedKind(&bookmarks[i]) {
+				skipped++
+				continue
+			}
+			entry, ok := a.syncItem(&bookmarks[i], synced)
+			if !ok {
+				skipped++
+				continue
+			}
+			entry.Status = itemStatus(&bookmarks[i])
+			resultList[entry.ItemID] = entry
 		}
 
-		favoriteStatus := "0"
-		if bookmark.IsMarked {
-			favoriteStatus = "1"
+		opts.Offset += len(bookmarks)
+		if count > 0 || len(bookmarks) == 0 || opts.Offset >= total {
+			break
 		}
-
-		entry := buildKoboArticleItem(bookmark, &bsync)
-		entry.Status = "0"
-		entry.Favorite = favoriteStatus
-		actualBookmarks = append(actualBookmarks, entry)
 	}
 
-	totalNonArchivedBookmarks := len(actualBookmarks)
-	resultList := make(map[string]models.KoboArticleItem)
+	a.fillWordCounts(ctx, readeckClient, resultList)
+	a.attachAnnotations(ctx, readeckClient, resultList)
 
-	startIndex := offset
-	endIndex := offset + count
-	if count == 0 {
-		endIndex = len(actualBookmarks)
-	}
-	if startIndex > len(actualBookmarks) {
-		startIndex = len(actualBookmarks)
-	}
-	if endIndex > len(actualBookmarks) {
-		endIndex = len(actualBookmarks)
-	}
+	return resultList, totalBookmarks - skipped, nil
+}
 
-	for _, bm := range actualBookmarks[startIndex:endIndex] {
-		resultList[bm.ItemID] = bm
-	}
+// archiveFilter maps the state a Kobo asks for to Readeck's archive filter:
+// "archive" lists the archived bookmarks for the device's Archive tab, "all"
+// every bookmark, and anything else the unread ones.
+func archiveFilter(state string) *bool {
+	var isArchived bool
+	switch state {
+	case "archive":
+		isArchived = true
+	case "all":
+		return nil
+	}
+	return &isArchived
+}
 
-	return resultList, totalNonArchivedBookmarks, nil
+// itemStatus is the Pocket status of a bookmark: "1" once archived, "0"
+// while unread.
+func itemStatus(bookmark *readeck.Bookmark) string {
+	if bookmark.IsArchived {
+		return "1"
+	}
+	return "0"
 }
 
-func (a *App) handleIncrementalSync(ctx context.Context, readeckClient *readeck.Client, since *time.Time) (map[string]models.KoboArticleItem, int, error) {
+func (a *App) handleIncrementalSync(ctx context.Context, readeckClient *readeck.Client, since *time.Time, bookmarkCache *bookmarkCache) (map[string]models.KoboArticleItem, int, error) {
 	resultList := make(map[string]models.KoboArticleItem)
 
 	bsyncs, err := readeckClient.GetBookmarksSync(ctx, since)
@@ -146,23 +305,39 @@ func (a *App) handleIncrementalSync(ctx context.Context, readeckClient *readeck.
 	}
 	a.Logger.Debugf("Incremental Sync: GetBookmarksSync returned %d sync events.", len(bsyncs))
 
+	// Bookmarks cached since their last event are not fetched again.
+	bookmarksDetailsMap := make(map[string]*readeck.Bookmark)
 	var candidateBookmarkIDs []string
 	for _, bsync := range bsyncs {
 		if bsync.Type == "delete" {
+			bookmarkCache.remove(bsync.ID)
 			resultList[bsync.ID] = models.KoboArticleItem{ItemID: bsync.ID, Status: "2"}
+			continue
+		}
+		bookmarkCache.removeOlder(bsync.ID, bsync.Time)
+		if bookmark, ok := bookmarkCache.get(bsync.ID); ok {
+			bookmarksDetailsMap[bsync.ID] = bookmark
 		} else {
 			candidateBookmarkIDs = append(candidateBookmarkIDs, bsync.ID)
 		}
 	}
 
-	if len(candidateBookmarkIDs) == 0 {
+	if len(candidateBookmarkIDs) == 0 && len(bookmarksDetailsMap) == 0 {
 		return resultList, 0, nil
 	}
 
-	bookmarksDetailsMap, err := readeckClient.SyncBookmarksContent(ctx, candidateBookmarkIDs)
-	if err != nil {
-		a.Logger.Errorf("Incremental Sync: Error getting bookmark details: %v", err)
-		return nil, 0, fmt.Errorf("failed to get bookmark details: %w", err)
+	if len(candidateBookmarkIDs) > 0 {
+		fetched, err := readeckClient.SyncBookmarksContent(ctx, candidateBookmarkIDs)
+		if err != nil {
+			a.Logger.Errorf("Incremental Sync: Error getting bookmark details: %v", err)
+			return nil, 0, fmt.Errorf("failed to get bookmark details: %w", err)
+		}
+		for id, bookmark := range fetched {
+			if bookmark != nil {
+				bookmarkCache.put(bookmark)
+			}
+			bookmarksDetailsMap[id] = bookmark
+		}
 	}
 
 	totalNonArchivedBookmarks := 0
@@ -175,14 +350,16 @@ func (a *App) handleIncrementalSync(ctx context.Context, readeckClient *readeck.
 		if !found || bookmark == nil {
 			continue
 		}
-
-		favoriteStatus := "0"
-		if bookmark.IsMarked {
-			favoriteStatus = "1"
+		if a.excludedKind(bookmark) {
+			// The bookmark may be on the device from before it was excluded.
+			resultList[bookmark.ID] = models.KoboArticleItem{ItemID: bookmark.ID, Status: "2"}
+			continue
 		}
 
-		entry := buildKoboArticleItem(bookmark, &bsync)
-		entry.Favorite = favoriteStatus
+		entry, ok := a.syncItem(bookmark, bsync.Time)
+		if !ok {
+			continue
+		}
 
 		if bookmark.IsArchived {
 			entry.Status = "1"
@@ -193,45 +370,195 @@ func (a *App) handleIncrementalSync(ctx context.Context, readeckClient *readeck.
 		resultList[bookmark.ID] = entry
 	}
 
+	a.fillWordCounts(ctx, readeckClient, resultList)
+	a.attachAnnotations(ctx, readeckClient, resultList)
+
 	return resultList, totalNonArchivedBookmarks, nil
 }
 
+// attachAnnotations adds Readeck highlights to the unread and archived items
+// in resultList, fetching each bookmark's highlights with at most
+// readeck.detail_concurrency requests in flight. Highlights are optional for
+// the Kobo, so failures are logged and ignored.
+func (a *App) attachAnnotations(ctx context.Context, readeckClient *readeck.Client, resultList map[string]models.KoboArticleItem) {
+	var items []models.KoboArticleItem
+	for _, entry := range resultList {
+		if entry.Status != "2" {
+			items = append(items, entry)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	concurrency := a.Config.Readeck.DetailConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDetailConcurrency
+	}
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for i := range items {
+		entry := &items[i]
+		g.Go(func() error {
+			annotations, err := readeckClient.GetBookmarkAnnotations(ctx, entry.ItemID)
+			if err != nil {
+				a.Logger.Warnf("Error fetching annotations of bookmark %s: %v", entry.ItemID, err)
+				return nil
+			}
+			for _, annotation := range annotations {
+				entry.Annotations = append(entry.Annotations, buildKoboAnnotation(&annotation))
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for _, entry := range items {
+		if len(entry.Annotations) > 0 {
+			resultList[entry.ItemID] = entry
+		}
+	}
+}
+
+// defaultDetailConcurrency is used when readeck.detail_concurrency is unset.
+const defaultDetailConcurrency = 4
+
+// fillWordCounts computes the word count of unread items that Readeck gave
+// neither a word count nor a reading time for, so the Kobo does not show a
+// zero reading time. The articles are fetched with at most
+// readeck.detail_concurrency requests in flight.
+func (a *App) fillWordCounts(ctx context.Context, readeckClient *readeck.Client, resultList map[string]models.KoboArticleItem) {
+	var missing []models.KoboArticleItem
+	for _, entry := range resultList {
+		if entry.Status == "0" && entry.WordCount == 0 {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	concurrency := a.Config.Readeck.DetailConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDetailConcurrency
+	}
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for i := range missing {
+		entry := &missing[i]
+		g.Go(func() error {
+			articleHTML, err := a.fetchArticle(ctx, readeckClient, entry.ItemID, time.Unix(entry.TimeUpdated, 0))
+			if err != nil {
+				a.Logger.Warnf("Error fetching article for word count of bookmark %s: %v", entry.ItemID, err)
+				return nil
+			}
+			doc, err := html.Parse(strings.NewReader(articleHTML))
+			if err != nil {
+				a.Logger.Warnf("Error parsing article for word count of bookmark %s: %v", entry.ItemID, err)
+				return nil
+			}
+			entry.WordCount = countWords(doc)
+			entry.TimeToRead = readingTime(entry.WordCount)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for _, entry := range missing {
+		if entry.WordCount > 0 {
+			resultList[entry.ItemID] = entry
+		}
+	}
+}
+
+func buildKoboAnnotation(annotation *readeck.Annotation) models.KoboAnnotation {
+	return models.KoboAnnotation{
+		AnnotationID: annotation.ID,
+		ItemID:       annotation.BookmarkID,
+		Quote:        annotation.Text,
+		Version:      "2",
+		CreatedAt:    annotation.Created.UTC().Format(time.DateTime),
+	}
+}
+
 func (a *App) HandleKoboGet(w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to read request body")
 		a.Logger.Errorf("Error reading /api/kobo/get request body: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-	a.Logger.Debugf("Incoming Kobo Request for /api/kobo/get:\nMethod: %s\nURL: %s\nHeaders: %v\nBody: %s", r.Method, r.URL, r.Header, string(bodyBytes))
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	a.Logger.Debugf("Incoming Kobo Request for /api/kobo/get:\nMethod: %s\nURL: %s\nHeaders: %v\nBody: %s", r.Method, r.URL, a.Logger.RedactHeader(r.Header), a.Logger.Redact(bodyBytes))
 
 	var req models.KoboGetRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		a.Logger.Errorf("Error decoding /api/kobo/get request: %v, body: %s, URL: %s, Params: %v", err, string(bodyBytes), r.URL.Path, r.URL.Query())
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
+		a.Logger.Errorf("Error decoding /api/kobo/get request: %v, body: %s, URL: %s, Params: %v", err, a.Logger.Redact(bodyBytes), r.URL.Path, r.URL.Query())
+		return
+	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
 		return
 	}
 
-	readeckToken, err := a.getReadeckToken(req.AccessToken)
+	uc, err := a.authenticate(r.Context(), req.AccessToken)
 	if err != nil {
-		http.Error(w, "Invalid access token", http.StatusUnauthorized)
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
 		a.Logger.Errorf("Error authenticating token for /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
 
-	readeckClient, err := a.newReadeckClient(readeckToken)
+	cacheKey := syncCacheKey(uc.User.Token, bodyBytes)
+	if uc.syncResponses != nil {
+		if body, ok := uc.syncResponses.get(cacheKey); ok {
+			a.Logger.Debugf("Serving cached response for /api/kobo/get, URL: %s, Params: %v", r.URL.Path, r.URL.Query())
+			a.syncOutcomes.count(syncCached)
+			uc.recordSync("cached", 0)
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := writeETagged(w, r, body); err != nil {
+				a.Logger.Errorf("Error writing response for /api/kobo/get: %v", err)
+			}
+			return
+		}
+	}
+
+	// A device retrying while its sync is still running shares that sync
+	// rather than starting another one against Readeck.
+	ran := false
+	body, err, _ := uc.syncFlights.Do(cacheKey, func() (any, error) {
+		ran = true
+		return a.syncResponse(context.WithoutCancel(r.Context()), r, uc, &req, cacheKey)
+	})
+	a.syncOutcomes.count(syncOutcome(ran))
 	if err != nil {
-		http.Error(w, "Failed to initialize Readeck client", http.StatusInternalServerError)
-		a.Logger.Errorf("Error initializing Readeck client for /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		var syncErr *syncError
+		if errors.As(err, &syncErr) {
+			writeReadeckError(w, syncErr.message, syncErr.err)
+		} else {
+			writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to sync with Readeck")
+		}
 		return
 	}
+	if !ran {
+		a.Logger.Debugf("Shared a running sync for /api/kobo/get, URL: %s, Params: %v", r.URL.Path, r.URL.Query())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := writeETagged(w, r, body.([]byte)); err != nil {
+		a.Logger.Errorf("Error writing response for /api/kobo/get: %v", err)
+	}
+}
+
+// syncResponse syncs the device of uc with Readeck and returns the encoded
+// /api/kobo/get response, caching it under cacheKey.
+func (a *App) syncResponse(ctx context.Context, r *http.Request, uc *UserContext, req *models.KoboGetRequest, cacheKey string) ([]byte, error) {
+	user := &uc.User
+	readeckClient, err := a.newReadeckClient(user)
+	if err != nil {
+		a.Logger.Errorf("Error initializing Readeck client for /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return nil, &syncError{message: "Failed to initialize Readeck client", err: err}
+	}
 
 	var since *time.Time
 	if req.Since != nil {
@@ -244,49 +571,119 @@ func (a *App) HandleKoboGet(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var members map[string]*collectionMember
+	tagCollections := a.Config.Readeck.CollectionTags
+	if tagCollections || len(user.Collections) > 0 {
+		members, err = a.loadCollections(ctx, readeckClient, user.Collections, tagCollections)
+		if err != nil {
+			a.Logger.Errorf("Error loading collections in /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+			return nil, &syncError{message: "Failed to load Readeck collections", err: err}
+		}
+	}
+
 	var resultList map[string]models.KoboArticleItem
 	var total int
 
-	if since == nil {
+	// A search lists every matching bookmark, whatever the device synced
+	// before.
+	search := strings.TrimSpace(req.Search)
+	if search != "" {
+		since = nil
+	}
+
+	if search != "" {
+		a.Logger.Debugf("Handling search for %q.", search)
+		resultList, total, err = a.handleFullSync(ctx, readeckClient, req, search, uc.bookmarks)
+	} else if since == nil && len(user.Collections) > 0 {
+		a.Logger.Debugf("Handling full sync of collections %v.", user.Collections)
+		resultList, total, err = a.handleCollectionFullSync(ctx, readeckClient, req, members, user.Collections)
+	} else if since == nil {
 		a.Logger.Debugf("Handling full sync.")
-		resultList, total, err = a.handleFullSync(r.Context(), readeckClient, &req)
+		resultList, total, err = a.handleFullSync(ctx, readeckClient, req, "", uc.bookmarks)
 	} else {
 		a.Logger.Debugf("Handling incremental sync.")
-		resultList, total, err = a.handleIncrementalSync(r.Context(), readeckClient, since)
+		resultList, total, err = a.handleIncrementalSync(ctx, readeckClient, since, uc.bookmarks)
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		a.Logger.Errorf("Error syncing bookmarks in /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return nil, &syncError{message: "Failed to sync with Readeck", err: err}
 	}
 
+	if members != nil {
+		total -= applyCollections(resultList, members, user.Collections, tagCollections)
+	}
+	if hasSyncLimits(user) {
+		removed, err := a.applySyncLimits(ctx, readeckClient, user, resultList, since == nil)
+		if err != nil {
+			a.Logger.Errorf("Error applying sync limits in /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+			return nil, &syncError{message: "Failed to apply sync limits", err: err}
+		}
+		total -= removed
+		if since == nil && user.MaxItems > 0 {
+			total = min(total, user.MaxItems)
+		}
+	}
+
+	kind := "full"
+	switch {
+	case search != "":
+		kind = "search"
+	case since != nil:
+		kind = "incremental"
+	}
+	uc.recordSync(kind, len(resultList))
+	uc.recordItems(resultList)
+	uc.markVideos(resultList)
+	a.countStats(user.Token, deviceStats{ItemsSynced: uint64(len(resultList))})
+	if err := a.urls.update(user.Token, resultList); err != nil {
+		a.Logger.Warnf("Error updating URL index in /api/kobo/get: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+	a.proxyResources(r, user.Token, resultList)
+
 	resp := models.KoboGetResponse{
 		Status: 1,
 		List:   resultList,
 		Total:  total,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(resp); err != nil {
 		a.Logger.Errorf("Error encoding response for /api/kobo/get: %v", err)
+		return nil, &syncError{message: "Failed to encode response", err: err}
+	}
+	if uc.syncResponses != nil {
+		uc.syncResponses.put(cacheKey, body.Bytes())
 	}
+	return body.Bytes(), nil
 }
 
-func buildKoboArticleItem(bookmark *readeck.Bookmark, bsync *readeck.BookmarkSync) models.KoboArticleItem {
+func buildKoboArticleItem(bookmark *readeck.Bookmark) models.KoboArticleItem {
 	authors := make(map[string]models.KoboAuthor)
 	for _, author := range bookmark.Authors {
-		authors[author] = models.KoboAuthor{AuthorID: author, Name: author}
+		author = strings.TrimSpace(author)
+		if author == "" {
+			continue
+		}
+		authorID := authorID(author)
+		authors[authorID] = models.KoboAuthor{AuthorID: authorID, ItemID: bookmark.ID, Name: author}
 	}
 
 	tags := make(map[string]models.KoboTag)
 	for _, label := range bookmark.Labels {
-		tags[label] = models.KoboTag{ItemID: bsync.ID, Tag: label}
+		tags[label] = models.KoboTag{ItemID: bookmark.ID, Tag: label}
+	}
+
+	// Readeck's "marked" flag is Pocket's favorite.
+	favoriteStatus := "0"
+	if bookmark.IsMarked {
+		favoriteStatus = "1"
 	}
 
 	entry := models.KoboArticleItem{
 		Authors:       authors,
 		Excerpt:       bookmark.Description,
+		Favorite:      favoriteStatus,
 		GivenTitle:    bookmark.Title,
 		GivenURL:      bookmark.URL,
 		HasImage:      "0",
@@ -302,11 +699,39 @@ func buildKoboArticleItem(bookmark *readeck.Bookmark, bsync *readeck.BookmarkSyn
 		TimeAdded:     bookmark.Created.Unix(),
 		TimeRead:      0,
 		TimeUpdated:   bookmark.Updated.Unix(),
-		Videos:        []any{},
+		Lang:          bookmark.Lang,
+		Videos:        make(map[string]models.KoboVideo),
 		WordCount:     bookmark.WordCount,
 		Optional:      make(map[string]any),
 	}
 
+	// Only right-to-left is marked, left to right being the Kobo's default.
+	lang, dir := articleLanguage(bookmark.Lang, bookmark.TextDirection, bookmark.Title+" "+bookmark.Description)
+	entry.Lang = lang
+	if dir == textRTL {
+		entry.TextDirection = dir
+	}
+
+	if !bookmark.Published.IsZero() {
+		entry.TimePublished = bookmark.Published.Unix()
+	}
+
+	siteName := bookmark.SiteName
+	if siteName == "" {
+		siteName = bookmark.Site
+	}
+	if siteName != "" {
+		entry.Domain = &models.KoboDomainMetadata{Name: siteName}
+		if bookmark.Resources.Icon != nil {
+			entry.Domain.Logo = bookmark.Resources.Icon.Src
+		}
+	}
+
+	if entry.WordCount == 0 && bookmark.ReadingTime > 0 {
+		entry.WordCount = bookmark.ReadingTime * wordsPerMinute
+	}
+	entry.TimeToRead = readingTime(entry.WordCount)
+
 	if bookmark.Resources.Image != nil && bookmark.Resources.Image.Src != "" {
 		entry.HasImage = "1"
 		entry.Image = &models.KoboImage{Src: bookmark.Resources.Image.Src}
@@ -318,29 +743,53 @@ func buildKoboArticleItem(bookmark *readeck.Bookmark, bsync *readeck.BookmarkSyn
 		entry.Optional["top_image_url"] = bookmark.Resources.Image.Src
 	}
 
+	// Pocket uses has_image and has_video "2" for items that are themselves
+	// an image or a video.
+	switch bookmarkKind(bookmark) {
+	case kindPhoto:
+		entry.HasImage = "2"
+		entry.IsArticle = "0"
+	case kindPDF:
+		entry.IsArticle = "0"
+	case kindVideo:
+		entry.HasVideo = "2"
+		entry.IsArticle = "0"
+		entry.Videos["1"] = models.KoboVideo{
+			VideoID: "1",
+			ItemID:  bookmark.ID,
+			Src:     bookmark.URL,
+			Width:   "0",
+			Height:  "0",
+			Type:    videoTypeFor(bookmark.URL),
+		}
+	}
+
 	return entry
 }
 
+// authorID derives a numeric author ID from the author's name, so the same
+// author keeps the same ID across syncs and bookmarks.
+func authorID(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(name)))
+	return strconv.FormatUint(uint64(h.Sum32()), 10)
+}
+
 func (a *App) HandleKoboDownload(w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to read request body")
 		a.Logger.Errorf("Error reading /api/kobo/download request body: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-	a.Logger.Debugf("Incoming Kobo Request for /api/kobo/download:\nMethod: %s\nURL: %s\nHeaders: %v\nBody: %s", r.Method, r.URL, r.Header, string(bodyBytes))
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	a.Logger.Debugf("Incoming Kobo Request for /api/kobo/download:\nMethod: %s\nURL: %s\nHeaders: %v\nBody: %s", r.Method, r.URL, a.Logger.RedactHeader(r.Header), a.Logger.Redact(bodyBytes))
 
 	var req models.KoboDownloadRequest
 	if err := json.NewDecoder(bytes.NewReader(bodyBytes)).Decode(&req); err != nil {
 		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Invalid request body or form data", http.StatusBadRequest)
+			writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body or form data")
 			a.Logger.Errorf("Error decoding /api/kobo/download request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 			return
 		}
@@ -351,38 +800,54 @@ func (a *App) HandleKoboDownload(w http.ResponseWriter, r *http.Request) {
 		req.Output = r.FormValue("output")
 		req.URL = r.FormValue("url")
 	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
+		return
+	}
 
-	readeckToken, err := a.getReadeckToken(req.AccessToken)
+	uc, err := a.authenticate(r.Context(), req.AccessToken)
 	if err != nil {
-		http.Error(w, "Invalid access token", http.StatusUnauthorized)
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
 		a.Logger.Errorf("Error authenticating token for /api/kobo/download: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
+	user := &uc.User
 
-	readeckClient, err := a.newReadeckClient(readeckToken)
+	readeckClient, err := a.newReadeckClient(user)
 	if err != nil {
-		http.Error(w, "Failed to initialize Readeck client", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
 		a.Logger.Errorf("Error initializing Readeck client for /api/kobo/download: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
 
 	reqURLStr := req.URL
 	if reqURLStr == "" {
-		http.Error(w, "Missing 'url' parameter", http.StatusBadRequest)
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'url' parameter")
 		a.Logger.Errorf("Error: Missing 'url' parameter in /api/kobo/download request, URL: %s, Params: %v", r.URL.Path, r.URL.Query())
 		return
 	}
 
 	parsedURL, err := url.Parse(reqURLStr)
 	if err != nil {
-		http.Error(w, "Invalid 'url' parameter", http.StatusBadRequest)
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid 'url' parameter")
 		a.Logger.Errorf("Error: Invalid 'url' parameter in /api/kobo/download request: %v, url: %s, URL: %s, Params: %v", err, reqURLStr, r.URL.Path, r.URL.Query())
 		return
 	}
 
-	var bookmarkFound *readeck.Bookmark
-	sitesToTry := getSitesToTry(parsedURL.Host)
 	ctx := r.Context()
+	bookmarkFound := a.indexedBookmark(ctx, readeckClient, uc, reqURLStr)
+	indexed := bookmarkFound != nil
+	var sitesToTry []string
+	if !indexed {
+		sitesToTry = getSitesToTry(parsedURL.Host)
+		// A redirect wrapper or AMP cache hides the article's own site.
+		if canonical, err := urlnorm.Canonical(reqURLStr); err == nil && canonical.Host != strings.TrimPrefix(parsedURL.Host, "www.") {
+			for _, site := range getSitesToTry(canonical.Host) {
+				if !slices.Contains(sitesToTry, site) {
+					sitesToTry = append(sitesToTry, site)
+				}
+			}
+		}
+	}
 
 	for _, site := range sitesToTry {
 		currentPage := 1
@@ -399,7 +864,7 @@ func (a *App) HandleKoboDownload(w http.ResponseWriter, r *http.Request) {
 
 			for i := range bookmarks {
 				if bookmarks[i].URL != "" {
-					match, err := compareURLs(bookmarks[i].URL, reqURLStr)
+					match, err := urlnorm.Equal(bookmarks[i].URL, reqURLStr)
 					if err != nil {
 						a.Logger.Warnf("Error comparing URLs for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarks[i].ID, err, r.URL.Path, r.URL.Query())
 						continue
@@ -420,26 +885,94 @@ func (a *App) HandleKoboDownload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if bookmarkFound == nil && a.Config.Download.SaveMissing {
+		if a.Config.DryRun {
+			a.Logger.Infof("Dry run: would save missing URL %s in /api/kobo/download", reqURLStr)
+		} else {
+			a.Logger.Infof("Saving missing URL %s to Readeck in /api/kobo/download", reqURLStr)
+			bookmarkFound, err = a.saveAndExtract(ctx, readeckClient, reqURLStr)
+			if err != nil {
+				a.Logger.Warnf("Error saving missing URL %s in /api/kobo/download: %v, URL: %s, Params: %v", reqURLStr, err, r.URL.Path, r.URL.Query())
+			}
+		}
+	}
 	if bookmarkFound == nil {
-		http.Error(w, "Article not found", http.StatusNotFound)
+		writeKoboError(w, http.StatusNotFound, pocketErrInvalidRequest, "Article not found")
 		return
 	}
+	if !indexed {
+		if err := a.urls.add(user.Token, reqURLStr, bookmarkFound.ID); err != nil {
+			a.Logger.Warnf("Error updating URL index in /api/kobo/download: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		}
+	}
+
+	if req.Refresh != 0 && a.articles != nil {
+		// The reader asked to download the article again.
+		a.articles.remove(bookmarkFound.ID)
+	}
 
-	articleHTML, err := readeckClient.GetBookmarkArticle(ctx, bookmarkFound.ID)
+	var articleHTML string
+	if a.convertsPDF(bookmarkFound) {
+		articleHTML, err = a.convertPDF(ctx, bookmarkFound.URL)
+		if err != nil {
+			a.Logger.Warnf("Error converting PDF %s for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarkFound.URL, bookmarkFound.ID, err, r.URL.Path, r.URL.Query())
+		}
+	}
+	if articleHTML == "" {
+		articleHTML, err = a.fetchArticle(ctx, readeckClient, bookmarkFound.ID, bookmarkFound.Updated)
+	}
+	if a.Config.Download.ReadabilityFallback && (err != nil || isEmptyArticle(articleHTML)) {
+		// Readeck has no article when its extraction failed.
+		extracted, extractErr := a.extractOrigin(ctx, bookmarkFound.URL)
+		if extractErr == nil {
+			a.Logger.Infof("Using the page extracted from %s for bookmark %s in /api/kobo/download", bookmarkFound.URL, bookmarkFound.ID)
+			articleHTML, err = extracted, nil
+		} else {
+			a.Logger.Warnf("Error extracting page %s for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarkFound.URL, bookmarkFound.ID, extractErr, r.URL.Path, r.URL.Query())
+		}
+	}
 	if err != nil {
-		http.Error(w, "Failed to fetch article content", http.StatusInternalServerError)
+		writeReadeckError(w, "Failed to fetch article content", err)
 		a.Logger.Errorf("Error fetching article content for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarkFound.ID, err, r.URL.Path, r.URL.Query())
 		return
 	}
 
+	_, processSpan := tracing.Start(ctx, "article.process")
+	defer processSpan.End()
+
 	doc, err := html.Parse(strings.NewReader(articleHTML))
 	if err != nil {
-		http.Error(w, "Failed to parse article HTML", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to parse article HTML")
 		a.Logger.Errorf("Error parsing article HTML for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarkFound.ID, err, r.URL.Path, r.URL.Query())
 		return
 	}
 
-	images := make(map[string]any)
+	baseURL, err := url.Parse(bookmarkFound.URL)
+	if err != nil {
+		a.Logger.Warnf("Error parsing bookmark URL %s for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarkFound.URL, bookmarkFound.ID, err, r.URL.Path, r.URL.Query())
+		baseURL = nil
+	}
+	replaceMath(doc, func(tex string, display bool) string { return a.mathImageURL(r, tex, display) })
+	videos := processArticle(doc, baseURL, a.videoImages(r))
+	uc.recordVideos(bookmarkFound.ID, videos)
+	applyTypography(doc, user.Typography)
+	rewriteCodeBlocks(doc, user.Typography, func(code string) string { return a.codeImageURL(r, code) })
+	lang, dir := articleLanguage(bookmarkFound.Lang, bookmarkFound.TextDirection, textContent(doc))
+	setArticleLanguage(doc, lang, dir)
+	if dropped := dropImages(doc, a.imageLimit(user, req.Images)); dropped > 0 {
+		a.Logger.Debugf("Dropped %d images of bookmark %s over the image limit in /api/kobo/download", dropped, bookmarkFound.ID)
+	}
+
+	profile := a.deviceProfile(user.Token, r.UserAgent())
+	if profile != nil && user.ImageQuality > 0 {
+		p := *profile
+		p.JPEGQuality = user.ImageQuality
+		profile = &p
+	}
+	// The Kobo asks for json; output=html answers with the article alone,
+	// its images left in place.
+	articleOnly := req.Output == "html"
+	images := make(map[string]models.KoboImage)
 	var imageIndex int
 	var processNode func(*html.Node)
 	processNode = func(n *html.Node) {
@@ -447,10 +980,17 @@ func (a *App) HandleKoboDownload(w http.ResponseWriter, r *http.Request) {
 			for _, attr := range n.Attr {
 				if attr.Key == "src" {
 					src := attr.Val
-					images[fmt.Sprintf("%d", imageIndex)] = map[string]any{
-						"image_id": fmt.Sprintf("%d", imageIndex),
-						"item_id":  fmt.Sprintf("%d", imageIndex),
-						"src":      src,
+					if profile != nil && !isMathImage(n) && !isCodeImage(n) && !isQRCodeImage(n) {
+						src = a.profileImageURL(r, src, bookmarkFound.URL, profile)
+					}
+					if articleOnly {
+						setAttr(n, "src", src)
+						break
+					}
+					images[fmt.Sprintf("%d", imageIndex)] = models.KoboImage{
+						ImageID: fmt.Sprintf("%d", imageIndex),
+						ItemID:  fmt.Sprintf("%d", imageIndex),
+						Src:     src,
 					}
 					comment := &html.Node{
 						Type: html.CommentNode,
@@ -465,24 +1005,33 @@ func (a *App) HandleKoboDownload(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
+		// Images are replaced as they are found, so the next sibling is
+		// taken first.
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
 			processNode(c)
+			c = next
 		}
 	}
 	processNode(doc)
 
 	var buf bytes.Buffer
 	if err := html.Render(&buf, doc); err != nil {
-		http.Error(w, "Failed to render modified HTML", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to render modified HTML")
 		a.Logger.Errorf("Error rendering modified HTML for bookmark %s in /api/kobo/download: %v, URL: %s, Params: %v", bookmarkFound.ID, err, r.URL.Path, r.URL.Query())
 		return
 	}
 
-	response := map[string]any{
-		"images":  images,
-		"article": buf.String(),
+	a.countStats(user.Token, deviceStats{ArticlesDownloaded: 1})
+	if articleOnly {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if _, err := buf.WriteTo(w); err != nil {
+			a.Logger.Errorf("Error writing response for /api/kobo/download: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		}
+		return
 	}
 
+	response := models.KoboDownloadResponse{Images: images, Videos: videos, Article: buf.String()}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		a.Logger.Errorf("Error encoding response for /api/kobo/download: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
@@ -517,92 +1066,124 @@ func getSitesToTry(host string) []string {
 func (a *App) HandleKoboSend(w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to read request body")
 		a.Logger.Errorf("Error reading /api/kobo/send request body: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-	a.Logger.Debugf("Incoming Kobo Request for /api/kobo/send:\nMethod: %s\nURL: %s\nHeaders: %v\nBody: %s", r.Method, r.URL, r.Header, string(bodyBytes))
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	a.Logger.Debugf("Incoming Kobo Request for /api/kobo/send:\nMethod: %s\nURL: %s\nHeaders: %v\nBody: %s", r.Method, r.URL, a.Logger.RedactHeader(r.Header), a.Logger.Redact(bodyBytes))
 
 	var req models.KoboSendRequest
 	if err := json.NewDecoder(bytes.NewReader(bodyBytes)).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
 		a.Logger.Errorf("Error decoding /api/kobo/send request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
+		return
+	}
 
-	readeckToken, err := a.getReadeckToken(req.AccessToken)
+	uc, err := a.authenticate(r.Context(), req.AccessToken)
 	if err != nil {
-		http.Error(w, "Invalid access token", http.StatusUnauthorized)
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
 		a.Logger.Errorf("Error authenticating token for /api/kobo/send: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
+	user := &uc.User
 
-	readeckClient, err := a.newReadeckClient(readeckToken)
+	readeckClient, err := a.newReadeckClient(user)
 	if err != nil {
-		http.Error(w, "Failed to initialize Readeck client", http.StatusInternalServerError)
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
 		a.Logger.Errorf("Error initializing Readeck client for /api/kobo/send: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
 		return
 	}
 
 	ctx := r.Context()
-	actionResults := make([]bool, len(req.Actions))
-	allSucceeded := true
+	dryRun := a.Config.DryRun
+	ops, opOf, actionErrs := planSendActions(req.Actions)
+	if a.Config.ReadingProgress.Estimate {
+		ops = a.planReadingProgress(ctx, readeckClient, uc, req.Actions, ops, opOf)
+	}
+	if a.Config.Conflicts.Policy != "" {
+		ops = a.resolveConflicts(ctx, readeckClient, uc, req.Actions, ops, opOf)
+	}
+	for _, op := range ops {
+		switch {
+		case op.update == nil:
+			op.create = addOptions(user, op.create)
+		case op.update["is_deleted"] == true:
+			op.update = deleteUpdate(user)
+		}
+	}
+	archiveFinished(user, ops)
+	a.Logger.Debugf("Collapsed %d actions into %d Readeck changes in /api/kobo/send", len(req.Actions), len(ops))
+	// Actions queued earlier for this device must reach Readeck first, so
+	// new ones wait behind them.
+	queueAll := !dryRun && a.queue.pending(user.Token)
+	if !queueAll {
+		a.runSendOps(ctx, readeckClient, ops, dryRun)
+	}
 
-	for i, actionInterface := range req.Actions {
-		actionMap, ok := actionInterface.(map[string]any)
-		if !ok {
-			actionResults[i] = false
-			allSucceeded = false
-			continue
+	var toQueue []*sendOp
+	for _, op := range ops {
+		if queueAll || readeck.IsUnavailable(op.err) {
+			toQueue = append(toQueue, op)
 		}
+	}
+	if len(toQueue) > 0 {
+		err := a.queueSendOps(user.Token, toQueue)
+		if err != nil {
+			a.Logger.Errorf("Error queuing actions in /api/kobo/send: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		} else {
+			a.Logger.Warnf("Queued %d actions until Readeck is available in /api/kobo/send, URL: %s, Params: %v", len(toQueue), r.URL.Path, r.URL.Query())
+		}
+		for _, op := range toQueue {
+			switch {
+			case err == nil:
+				op.err = nil
+			case op.err == nil:
+				op.err = err
+			}
+		}
+	}
 
-		action, _ := actionMap["action"].(string)
-		var err error
-
-		switch action {
-		case "archive":
-			itemID, _ := actionMap["item_id"].(string)
-			err = readeckClient.UpdateBookmark(ctx, itemID, map[string]any{"is_archived": true})
-		case "readd":
-			itemID, _ := actionMap["item_id"].(string)
-			err = readeckClient.UpdateBookmark(ctx, itemID, map[string]any{"is_archived": false})
-		case "favorite":
-			itemID, _ := actionMap["item_id"].(string)
-			err = readeckClient.UpdateBookmark(ctx, itemID, map[string]any{"is_marked": true})
-		case "unfavorite":
-			itemID, _ := actionMap["item_id"].(string)
-			err = readeckClient.UpdateBookmark(ctx, itemID, map[string]any{"is_marked": false})
-		case "delete":
-			itemID, _ := actionMap["item_id"].(string)
-			err = readeckClient.UpdateBookmark(ctx, itemID, map[string]any{"is_deleted": true})
-		case "add":
-			url, _ := actionMap["url"].(string)
-			err = readeckClient.CreateBookmark(ctx, url)
-		case "opened_item", "left_item":
-			err = nil
-		default:
-			err = fmt.Errorf("unknown action: %s", action)
+	if !dryRun {
+		a.invalidateSyncResponses(user.Token)
+		uc.recordSent(ops)
+	}
+	for _, op := range ops {
+		if op.update != nil {
+			uc.bookmarks.remove(op.itemID)
+		}
+	}
+	for _, op := range ops {
+		if op.bookmarkID != "" && op.err == nil {
+			a.extractions.track(user.Token, op.url, op.bookmarkID, op.create, 0)
 		}
+	}
 
+	actionResults := make([]bool, len(req.Actions))
+	allSucceeded := true
+	var sent uint64
+	for i, action := range req.Actions {
+		err := actionErrs[i]
+		if err == nil && opOf[i] >= 0 {
+			err = ops[opOf[i]].err
+		}
 		if err != nil {
-			a.Logger.Warnf("Error processing action '%s' in /api/kobo/send: %v, URL: %s, Params: %v", action, err, r.URL.Path, r.URL.Query())
-			actionResults[i] = false
+			a.Logger.Warnf("Error processing action %v in /api/kobo/send: %v, URL: %s, Params: %v", action, err, r.URL.Path, r.URL.Query())
 			allSucceeded = false
-		} else {
-			actionResults[i] = true
+			continue
 		}
+		actionResults[i] = true
+		sent++
 	}
+	a.countStats(user.Token, deviceStats{ActionsSent: sent})
 
-	response := map[string]any{
-		"status":         allSucceeded,
-		"action_results": actionResults,
+	response := models.KoboSendResponse{Status: allSucceeded, ActionResults: actionResults, DryRun: dryRun}
+	if dryRun {
+		w.Header().Set("X-Readeckobo-Dry-Run", "true")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -612,14 +1193,9 @@ func (a *App) HandleKoboSend(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *App) HandleConvertImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	imageURL := r.URL.Query().Get("url")
 	if imageURL == "" {
-		http.Error(w, "Missing 'url' parameter", http.StatusBadRequest)
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'url' parameter")
 		return
 	}
 
@@ -627,10 +1203,19 @@ func (a *App) HandleConvertImage(w http.ResponseWriter, r *http.Request) {
 	if client == nil {
 		client = &http.Client{Timeout: 5 * time.Second}
 	}
-	resp, err := client.Get(imageURL)
+	ctx, fetchSpan := tracing.Start(r.Context(), "image.fetch")
+	imgReq, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		tracing.End(fetchSpan, err)
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid 'url' parameter")
+		return
+	}
+	a.setImageFetchHeaders(imgReq, articleReferer(r))
+	resp, err := client.Do(imgReq)
+	tracing.End(fetchSpan, err)
 	if err != nil {
 		a.Logger.Errorf("Failed to fetch image %s in /api/convert-image: %v, URL: %s, Params: %v", imageURL, err, r.URL.Path, r.URL.Query())
-		a.returnPlaceholderImage(w, r, "Image fetch failed")
+		a.returnPlaceholderImage(w, r, imageURL, "The image could not be downloaded.")
 		return
 	}
 	defer func() {
@@ -641,42 +1226,81 @@ func (a *App) HandleConvertImage(w http.ResponseWriter, r *http.Request) {
 
 	if resp.StatusCode != http.StatusOK {
 		a.Logger.Warnf("Failed to fetch image %s in /api/convert-image: status %d, URL: %s, Params: %v", imageURL, resp.StatusCode, r.URL.Path, r.URL.Query())
-		a.returnPlaceholderImage(w, r, "Image not found")
+		a.returnPlaceholderImage(w, r, imageURL, "The image was not found on its website.")
+		return
+	}
+
+	opts := a.imageOptions()
+	profile := a.imageProfile(r)
+	data, err := readLimitedImage(resp.Body, resp.ContentLength, opts.maxBytes)
+	if err == nil && canPassThrough(data, opts, profile) {
+		a.Logger.Debugf("Passing image %s through unchanged in /api/convert-image", imageURL)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		n, err := writeETagged(w, r, data)
+		if err != nil {
+			a.Logger.Warnf("Error writing image %s in /api/convert-image: %v, URL: %s, Params: %v", imageURL, err, r.URL.Path, r.URL.Query())
+		}
+		a.countStats("", deviceStats{ImageBytesServed: uint64(n)})
 		return
 	}
 
-	img, _, err := image.Decode(resp.Body)
+	_, decodeSpan := tracing.Start(r.Context(), "image.decode")
+	var img image.Image
+	if err == nil {
+		img, err = decodeImage(data, opts)
+	}
+	tracing.End(decodeSpan, err)
+	if errors.Is(err, errImageTooLarge) {
+		a.Logger.Warnf("Rejected image %s in /api/convert-image: %v, URL: %s, Params: %v", imageURL, err, r.URL.Path, r.URL.Query())
+		a.returnPlaceholderImage(w, r, imageURL, "The image is too large to show on this device.")
+		return
+	}
 	if err != nil {
 		a.Logger.Warnf("Failed to decode image %s in /api/convert-image: %v, URL: %s, Params: %v", imageURL, err, r.URL.Path, r.URL.Query())
-		a.returnPlaceholderImage(w, r, "Image decoding failed")
+		a.returnPlaceholderImage(w, r, imageURL, "The image is in a format that cannot be shown.")
 		return
 	}
 
-	b := img.Bounds()
-	rgbImg := image.NewRGBA(b)
-	draw.Draw(rgbImg, b, img, image.Point{}, draw.Src)
+	rgbImg := fitImage(img, profile)
+	format := imageFormat(rgbImg, profile)
 
-	w.Header().Set("Content-Type", "image/jpeg")
+	_, encodeSpan := tracing.Start(r.Context(), "image.encode")
+	var encoded bytes.Buffer
+	if format == "png" {
+		err = png.Encode(&encoded, rgbImg)
+	} else {
+		err = jpeg.Encode(&encoded, rgbImg, &jpeg.Options{Quality: jpegQuality(profile)})
+	}
+	tracing.End(encodeSpan, err)
+	if err != nil {
+		a.Logger.Errorf("Failed to encode %s for image %s in /api/convert-image: %v, URL: %s, Params: %v", format, imageURL, err, r.URL.Path, r.URL.Query())
+		a.returnPlaceholderImage(w, r, imageURL, "The image could not be converted.")
+		return
+	}
+
+	// The ETag of the converted image lets the device skip downloading it
+	// again, though it is still fetched and converted to compare.
+	w.Header().Set("Content-Type", "image/"+format)
 	w.Header().Set("Cache-Control", "public, max-age=3600")
-	if err := jpeg.Encode(w, rgbImg, &jpeg.Options{Quality: 85}); err != nil {
-		a.Logger.Errorf("Failed to encode JPEG for image %s in /api/convert-image: %v, URL: %s, Params: %v", imageURL, err, r.URL.Path, r.URL.Query())
+	n, err := writeETagged(w, r, encoded.Bytes())
+	if err != nil {
+		a.Logger.Warnf("Error writing image %s in /api/convert-image: %v, URL: %s, Params: %v", imageURL, err, r.URL.Path, r.URL.Query())
 	}
+	a.countStats("", deviceStats{ImageBytesServed: uint64(n)})
 }
 
-func (a *App) returnPlaceholderImage(w http.ResponseWriter, r *http.Request, message string) {
-	width, height := 800, 600
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
-
-	col := image.Black
-	point := fixed.Point26_6{X: fixed.Int26_6(20 * 64), Y: fixed.Int26_6(300 * 64)}
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  col,
-		Face: basicfont.Face7x13,
-		Dot:  point,
+func (a *App) returnPlaceholderImage(w http.ResponseWriter, r *http.Request, imageURL, message string) {
+	width, height := a.Config.Images.PlaceholderWidth, a.Config.Images.PlaceholderHeight
+	if width <= 0 || height <= 0 {
+		width, height = defaultPlaceholderWidth, defaultPlaceholderHeight
+	}
+	img, err := renderPlaceholder(width, height, message, imageURL)
+	if err != nil {
+		a.Logger.Errorf("Error rendering placeholder image: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		img = image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
 	}
-	d.DrawString(message)
 
 	w.Header().Set("Content-Type", "image/jpeg")
 	w.Header().Set("Cache-control", "public, max-age=300")
@@ -685,57 +1309,61 @@ func (a *App) returnPlaceholderImage(w http.ResponseWriter, r *http.Request, mes
 	}
 }
 
-func compareURLs(url1, url2 string) (bool, error) {
-	u1, err := url.Parse(strings.TrimSpace(url1))
-	if err != nil {
-		return false, err
-	}
-	u2, err := url.Parse(strings.TrimSpace(url2))
-	if err != nil {
-		return false, err
+func (a *App) getUser(ctx context.Context, deviceToken string) (*config.User, error) {
+	users := a.users()
+	for i := range users {
+		if users[i].Token == deviceToken {
+			if info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo); ok {
+				info.Device = maskToken(deviceToken)
+			}
+			a.recordDevice(ctx, deviceToken)
+			return &users[i], nil
+		}
 	}
+	return nil, fmt.Errorf("unauthorized device token")
+}
 
-	u1.Host = strings.TrimPrefix(u1.Host, "www.")
-	u2.Host = strings.TrimPrefix(u2.Host, "www.")
-
-	return u1.Scheme == u2.Scheme && u1.Host == u2.Host && u1.Path == u2.Path, nil
+// users returns a snapshot of the configured users, with the sync choices
+// made in the user portal.
+func (a *App) users() []config.User {
+	a.usersMu.RLock()
+	users := slices.Clone(a.Config.Users)
+	a.usersMu.RUnlock()
+	a.portal.apply(users)
+	return users
 }
 
-func (a *App) getReadeckToken(deviceToken string) (string, error) {
-	for _, user := range a.Config.Users {
-		if user.Token == deviceToken {
-			return user.ReadeckAccessToken, nil
-		}
+// secrets lists the device tokens and Readeck credentials to scrub from
+// captures.
+func (a *App) secrets() []string {
+	var secrets []string
+	for _, user := range a.users() {
+		secrets = append(secrets, user.Token, user.ReadeckAccessToken, user.ReadeckPassword, a.tokens.readeckToken(&user))
 	}
-	return "", fmt.Errorf("unauthorized device token")
+	if a.Config != nil && a.Config.Feeds.Miniflux.APIKey != "" {
+		secrets = append(secrets, a.Config.Feeds.Miniflux.APIKey)
+	}
+	return secrets
 }
 
-func (a *App) newReadeckClient(readeckToken string) (*readeck.Client, error) {
-	return readeck.NewClient(a.Config.Readeck.Host, readeckToken, a.Logger, a.ReadeckHTTPClient)
+func (a *App) addUser(user config.User) {
+	a.usersMu.Lock()
+	defer a.usersMu.Unlock()
+	a.Config.Users = append(a.Config.Users, user)
 }
 
-func (a *App) HandleDumpAndForward(w http.ResponseWriter, r *http.Request) {
-	a.Logger.Debugf("Dumping request from %s", r.RemoteAddr)
-	a.Logger.Debugf("Method: %s", r.Method)
-	a.Logger.Debugf("URL: %s", r.URL.String())
-	a.Logger.Debugf("Headers: %v", r.Header)
+type requestInfoKey struct{}
 
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		a.Logger.Debugf("Error reading request body: %v", err)
-		return
-	}
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	a.Logger.Debugf("Body: %s", string(bodyBytes))
+// RequestInfo collects what the handlers learn about a request, such as the
+// device that sent it, for the access log.
+type RequestInfo struct {
+	Device string
+}
 
-	target, err := url.Parse("https://storeapi.kobo.com")
-	if err != nil {
-		a.Logger.Errorf("Error parsing target URL: %v", err)
-		return
-	}
-	proxy := httputil.NewSingleHostReverseProxy(target)
-	proxy.ServeHTTP(w, r)
+// WithRequestInfo returns a copy of r whose handlers fill in the returned RequestInfo.
+func WithRequestInfo(r *http.Request) (*http.Request, *RequestInfo) {
+	info := &RequestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
 }
 
+
@@ -1,24 +1,33 @@
 package app
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url" // Added this import
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"mime/multipart"
-	"net/textproto"
 
+	"readeckobo/internal/capture"
 	"readeckobo/internal/config"
 	"readeckobo/internal/logger"
 	"readeckobo/internal/models"
 	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
 )
 
 // MockRoundTripper is a mock implementation of http.RoundTripper for testing.
@@ -39,127 +48,6 @@ var testLogger = logger.New(logger.DEBUG)
 var mockDeviceToken = "mock-device-token"
 var mockPlaintextReadeckToken = "mock_readeck_token_for_tests"
 
-func TestCompareURLs(t *testing.T) {
-	testCases := []struct {
-		name     string
-		url1     string
-		url2     string
-		expected bool
-		hasError bool
-	}{
-		{
-			name:     "exact match",
-			url1:     "https://example.com/path/to/resource",
-			url2:     "https://example.com/path/to/resource",
-			expected: true,
-			hasError: false,
-		},
-		{
-			name:     "match with www. prefix on url1",
-			url1:     "https://www.example.com/path",
-			url2:     "https://example.com/path",
-			expected: true,
-			hasError: false,
-		},
-		{
-			name:     "match with www. prefix on url2",
-			url1:     "https://example.com/path",
-			url2:     "https://www.example.com/path",
-			expected: true,
-			hasError: false,
-		},
-		{
-			name:     "match with different query parameters",
-			url1:     "https://example.com/path?param1=value1",
-			url2:     "https://example.com/path?param2=value2",
-			expected: true,
-			hasError: false,
-		},
-		{
-			name:     "match with different fragments",
-			url1:     "https://example.com/path#section1",
-			url2:     "https://example.com/path#section2",
-			expected: true,
-			hasError: false,
-		},
-		{
-			name:     "match with different query params and fragments",
-			url1:     "https://www.example.com/path?p1=v1#s1",
-			url2:     "https://example.com/path?p2=v2#s2",
-			expected: true,
-			hasError: false,
-		},
-		{
-			name:     "mismatch in path",
-			url1:     "https://example.com/path1",
-			url2:     "https://example.com/path2",
-			expected: false,
-			hasError: false,
-		},
-		{
-			name:     "mismatch in host",
-			url1:     "https://example.com/path",
-			url2:     "https://anotherexample.com/path",
-			expected: false,
-			hasError: false,
-		},
-		{
-			name:     "mismatch in scheme",
-			url1:     "http://example.com/path",
-			url2:     "https://example.com/path",
-			expected: false,
-			hasError: false,
-		},
-		{
-			name:     "invalid url1 (relative path)",
-			url1:     "invalid-url",
-			url2:     "https://example.com/path",
-			expected: false,
-			hasError: false,
-		},
-		{
-			name:     "invalid url2 (relative path)",
-			url1:     "https://example.com/path",
-			url2:     "invalid-url",
-			expected: false,
-			hasError: false,
-		},
-		{
-			name:     "empty urls",
-			url1:     "",
-			url2:     "",
-			expected: true, // Empty URLs are considered equal after parsing to base components
-			hasError: false,
-		},
-		{
-			name:     "url with trailing slash",
-			url1:     "https://example.com/path/",
-			url2:     "https://example.com/path",
-			expected: false, // Paths must match exactly
-			hasError: false,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			match, err := compareURLs(tc.url1, tc.url2)
-
-			if tc.hasError {
-				if err == nil {
-					t.Errorf("Expected an error but got none")
-				}
-			} else {
-				if err != nil {
-					t.Errorf("Did not expect an error but got: %v", err)
-				}
-				if match != tc.expected {
-					t.Errorf("Expected match to be %v, but got %v", tc.expected, match)
-				}
-			}
-		})
-	}
-}
-
 func TestHandleKoboGet(t *testing.T) {
 	// sinceValue is a valid timestamp for incremental sync tests.
 	sinceValue := float64(1672531200) // 2023-01-01 00:00:00 UTC
@@ -171,6 +59,7 @@ func TestHandleKoboGet(t *testing.T) {
 		mockBookmarkDetails    map[string]*readeck.Bookmark
 		mockBookmarksSyncErr   error
 		mockBookmarkDetailsErr error
+		mockAnnotations        []readeck.Annotation
 		expectedStatus         int
 		expectedListSize       int
 		expectedTotal          int
@@ -192,6 +81,55 @@ func TestHandleKoboGet(t *testing.T) {
 			expectedListSize: 1, // Only the unread item
 			expectedTotal:    1,
 		},
+		{
+			name:    "full sync of archive",
+			reqBody: &models.KoboGetRequest{Count: "10", State: "archive", AccessToken: mockDeviceToken}, // No 'Since'
+			mockBookmarksSync: []readeck.BookmarkSync{
+				{ID: "1", Type: "update"},
+				{ID: "2", Type: "update"},
+			},
+			mockBookmarkDetails: map[string]*readeck.Bookmark{
+				"1": {ID: "1", Title: "Unread", IsArchived: false},
+				"2": {ID: "2", Title: "Archived", IsArchived: true},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedListSize: 1, // Only the archived item
+			expectedTotal:    1,
+		},
+		{
+			name:    "full sync of all states",
+			reqBody: &models.KoboGetRequest{Count: "10", State: "all", AccessToken: mockDeviceToken}, // No 'Since'
+			mockBookmarksSync: []readeck.BookmarkSync{
+				{ID: "1", Type: "update"},
+				{ID: "2", Type: "update"},
+			},
+			mockBookmarkDetails: map[string]*readeck.Bookmark{
+				"1": {ID: "1", Title: "Unread", IsArchived: false},
+				"2": {ID: "2", Title: "Archived", IsArchived: true},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedListSize: 2,
+			expectedTotal:    2,
+		},
+		{
+			name:    "full sync with offset and count",
+			reqBody: &models.KoboGetRequest{Count: "2", Offset: "1", AccessToken: mockDeviceToken}, // No 'Since'
+			mockBookmarksSync: []readeck.BookmarkSync{
+				{ID: "1", Type: "update"},
+				{ID: "2", Type: "update"},
+				{ID: "3", Type: "update"},
+				{ID: "4", Type: "update"},
+			},
+			mockBookmarkDetails: map[string]*readeck.Bookmark{
+				"1": {ID: "1", Title: "First", Created: time.Unix(1700000004, 0)},
+				"2": {ID: "2", Title: "Second", Created: time.Unix(1700000003, 0)},
+				"3": {ID: "3", Title: "Third", Created: time.Unix(1700000002, 0)},
+				"4": {ID: "4", Title: "Fourth", Created: time.Unix(1700000001, 0)},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedListSize: 2,
+			expectedTotal:    4,
+		},
 		{
 			name:    "full sync with favorited item",
 			reqBody: &models.KoboGetRequest{Count: "10", AccessToken: mockDeviceToken}, // No 'Since'
@@ -227,6 +165,54 @@ func TestHandleKoboGet(t *testing.T) {
 			expectedListSize: 1,
 			expectedTotal:    1,
 		},
+		{
+			name:    "full sync with annotations",
+			reqBody: &models.KoboGetRequest{Count: "10", AccessToken: mockDeviceToken}, // No 'Since'
+			mockBookmarksSync: []readeck.BookmarkSync{
+				{ID: "1", Type: "update"},
+			},
+			mockBookmarkDetails: map[string]*readeck.Bookmark{
+				"1": {ID: "1", Title: "Highlighted", IsArchived: false},
+			},
+			mockAnnotations: []readeck.Annotation{
+				{ID: "a1", BookmarkID: "1", Text: "a highlighted passage"},
+				{ID: "a2", BookmarkID: "unknown", Text: "not synced"},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedListSize: 1,
+			expectedTotal:    1,
+		},
+		{
+			name:    "full sync of archive with annotations",
+			reqBody: &models.KoboGetRequest{Count: "10", State: "archive", AccessToken: mockDeviceToken}, // No 'Since'
+			mockBookmarksSync: []readeck.BookmarkSync{
+				{ID: "2", Type: "update"},
+			},
+			mockBookmarkDetails: map[string]*readeck.Bookmark{
+				"2": {ID: "2", Title: "Archived", IsArchived: true},
+			},
+			mockAnnotations: []readeck.Annotation{
+				{ID: "a1", BookmarkID: "2", Text: "an archived passage"},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedListSize: 1,
+			expectedTotal:    1,
+		},
+		{
+			name:    "incremental sync with favorited and unfavorited items",
+			reqBody: &models.KoboGetRequest{Since: sinceValue, AccessToken: mockDeviceToken},
+			mockBookmarksSync: []readeck.BookmarkSync{
+				{ID: "1", Type: "update"},
+				{ID: "2", Type: "update"},
+			},
+			mockBookmarkDetails: map[string]*readeck.Bookmark{
+				"1": {ID: "1", Title: "Starred", IsMarked: true},
+				"2": {ID: "2", Title: "Unstarred", IsMarked: false},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedListSize: 2,
+			expectedTotal:    2,
+		},
 		{
 			name:    "incremental sync with deleted",
 			reqBody: &models.KoboGetRequest{Since: sinceValue, AccessToken: mockDeviceToken},
@@ -270,61 +256,26 @@ func TestHandleKoboGet(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Common mock HTTP client func
-			mockHTTPClientFunc := func(w http.ResponseWriter, r *http.Request) {
-				if tc.mockBookmarksSyncErr != nil && r.URL.Path == "/api/bookmarks/sync" && r.Method == http.MethodGet {
-					http.Error(w, tc.mockBookmarksSyncErr.Error(), http.StatusInternalServerError)
-					return
-				}
-				if tc.mockBookmarkDetailsErr != nil && r.URL.Path == "/api/bookmarks/sync" && r.Method == http.MethodPost {
-					http.Error(w, tc.mockBookmarkDetailsErr.Error(), http.StatusInternalServerError)
-					return
-				}
-
-				switch r.URL.Path {
-				case "/api/bookmarks/sync":
-					switch r.Method {
-					case http.MethodGet:
-						jsonBytes, _ := json.Marshal(tc.mockBookmarksSync)
-						w.Header().Set("Content-Type", "application/json")
-						w.WriteHeader(http.StatusOK)
-						_, _ = w.Write(jsonBytes)
-					case http.MethodPost:
-						boundary := "MULTIPART_BOUNDARY"
-						var b bytes.Buffer
-						writer := multipart.NewWriter(&b)
-						if err := writer.SetBoundary(boundary); err != nil {
-							t.Fatalf("Failed to set boundary: %v", err)
-						}
-						reqBodyBytes, _ := io.ReadAll(r.Body)
-						var syncRequest struct {
-							IDs []string `json:"id"`
-						}
-						if err := json.Unmarshal(reqBodyBytes, &syncRequest); err != nil {
-							t.Fatalf("Failed to unmarshal sync request: %v", err)
-						}
-						for _, id := range syncRequest.IDs {
-							if bm, ok := tc.mockBookmarkDetails[id]; ok && bm != nil {
-								partHeader := make(textproto.MIMEHeader)
-								partHeader.Set("Content-Type", "application/json")
-								partHeader.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bookmark_%s.json"`, id))
-								part, _ := writer.CreatePart(partHeader)
-								_ = json.NewEncoder(part).Encode(bm)
-							}
-						}
-						_ = writer.Close()
-						w.Header().Set("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%s", boundary))
-						w.WriteHeader(http.StatusOK)
-						_, _ = w.Write(b.Bytes())
-					}
-				default:
-					w.WriteHeader(http.StatusOK)
-					_, _ = w.Write([]byte(`{}`))
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			for _, bsync := range tc.mockBookmarksSync {
+				if bsync.Type == "delete" {
+					mockServer.DeleteBookmark(bsync.ID)
+				} else if bm, ok := tc.mockBookmarkDetails[bsync.ID]; ok && bm != nil {
+					mockServer.AddBookmark(*bm, "")
+				} else {
+					mockServer.AddBookmark(readeck.Bookmark{ID: bsync.ID}, "")
 				}
 			}
-
-			mockServer := httptest.NewServer(http.HandlerFunc(mockHTTPClientFunc))
-			defer mockServer.Close()
+			for _, annotation := range tc.mockAnnotations {
+				mockServer.AddAnnotation(annotation)
+			}
+			if tc.mockBookmarksSyncErr != nil {
+				mockServer.Fail(http.MethodGet, "/api/bookmarks/sync", http.StatusInternalServerError)
+			}
+			if tc.mockBookmarkDetailsErr != nil {
+				mockServer.Fail(http.MethodPost, "/api/bookmarks/sync", http.StatusInternalServerError)
+			}
 
 			app := NewApp(
 				WithConfig(&config.Config{
@@ -348,13 +299,13 @@ func TestHandleKoboGet(t *testing.T) {
 			var syncErr error
 
 			if tc.reqBody.Since == nil {
-				resultList, total, syncErr = app.handleFullSync(req.Context(), readeckClient, tc.reqBody)
+				resultList, total, syncErr = app.handleFullSync(req.Context(), readeckClient, tc.reqBody, "", nil)
 			} else {
 				var since time.Time
 				if s, ok := tc.reqBody.Since.(float64); ok {
 					since = time.Unix(int64(s), 0)
 				}
-				resultList, total, syncErr = app.handleIncrementalSync(req.Context(), readeckClient, &since)
+				resultList, total, syncErr = app.handleIncrementalSync(req.Context(), readeckClient, &since, nil)
 			}
 
 			if syncErr != nil {
@@ -396,11 +347,48 @@ func TestHandleKoboGet(t *testing.T) {
 
 				// Specific checks for each test case
 				switch tc.name {
+				case "full sync with offset and count":
+					if _, ok := resp.List["2"]; !ok {
+						t.Errorf("expected item '2' in the requested window")
+					}
+					if _, ok := resp.List["3"]; !ok {
+						t.Errorf("expected item '3' in the requested window")
+					}
+				case "full sync of archive":
+					if item := resp.List["2"]; item.Status != "1" {
+						t.Errorf("expected archived item status to be '1', got '%s'", item.Status)
+					}
+				case "full sync of all states":
+					if item := resp.List["1"]; item.Status != "0" {
+						t.Errorf("expected unread item status to be '0', got '%s'", item.Status)
+					}
+					if item := resp.List["2"]; item.Status != "1" {
+						t.Errorf("expected archived item status to be '1', got '%s'", item.Status)
+					}
 				case "full sync with favorited item":
 					item := resp.List["1"]
 					if item.Favorite != "1" {
 						t.Errorf("expected favorited item 'favorite' status to be '1', got '%s'", item.Favorite)
 					}
+				case "full sync with annotations":
+					item := resp.List["1"]
+					if len(item.Annotations) != 1 {
+						t.Fatalf("expected 1 annotation, got %d", len(item.Annotations))
+					}
+					if item.Annotations[0].Quote != "a highlighted passage" {
+						t.Errorf("expected annotation quote to be 'a highlighted passage', got '%s'", item.Annotations[0].Quote)
+					}
+				case "full sync of archive with annotations":
+					if item := resp.List["2"]; len(item.Annotations) != 1 || item.Annotations[0].Quote != "an archived passage" {
+						t.Errorf("expected the archived item's annotation, got %+v", item.Annotations)
+					}
+				case "incremental sync with favorited and unfavorited items":
+					if item := resp.List["1"]; item.Favorite != "1" {
+						t.Errorf("expected marked item 'favorite' status to be '1', got '%s'", item.Favorite)
+					}
+					if item := resp.List["2"]; item.Favorite != "0" {
+						t.Errorf("expected unmarked item 'favorite' status to be '0', got '%s'", item.Favorite)
+					}
 				case "incremental sync with deleted":
 					item := resp.List["1"]
 					if item.Status != "2" {
@@ -424,14 +412,301 @@ func TestHandleKoboGet(t *testing.T) {
 		})
 	}
 }
+
+func TestFullSyncSortQuery(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", WordCount: 100}, "")
+
+	var sorts [][]string
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(&http.Client{Transport: recordingTransport(func(r *http.Request) {
+			if r.URL.Path == "/api/bookmarks" {
+				sorts = append(sorts, r.URL.Query()["sort"])
+			}
+		})}),
+	)
+	body, _ := json.Marshal(models.KoboGetRequest{Count: "10", Offset: "0", AccessToken: mockDeviceToken})
+	rr := httptest.NewRecorder()
+	app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Readeck documents no id sort; the mock refuses fields it does not
+	// document.
+	want := []string{"-created", "title"}
+	if len(sorts) != 1 || !slices.Equal(sorts[0], want) {
+		t.Errorf("expected one list request sorted by %v, got %v", want, sorts)
+	}
+}
+
+func TestFullSyncTotalAcrossPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		exclude   []string
+		wantTypes []string
+	}{
+		// PDFs are articles to Readeck, so they are left out locally.
+		{name: "excluded locally", exclude: []string{kindPDF}},
+		// Readeck leaves videos out of its pages and total.
+		{name: "excluded by Readeck", exclude: []string{kindVideo}, wantTypes: []string{kindArticle, kindPhoto}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			start := time.Now().Add(-time.Hour)
+			const bookmarkCount = fullSyncPageSize + 50
+			for i := range bookmarkCount {
+				id := strconv.Itoa(i + 1)
+				mockServer.AddBookmark(readeck.Bookmark{ID: id, URL: "https://example.com/" + id, Type: kindArticle, Created: start.Add(-time.Duration(i) * time.Minute), WordCount: 100}, "")
+			}
+			// The newest bookmarks, on the first page, are left out.
+			mockServer.AddBookmark(readeck.Bookmark{ID: "pdf", URL: "https://example.com/pdf", Type: kindArticle, DocumentType: kindPDF, Created: start.Add(time.Minute), WordCount: 100}, "")
+			mockServer.AddBookmark(readeck.Bookmark{ID: "video", URL: "https://example.com/video", Type: kindVideo, Created: start.Add(2 * time.Minute), WordCount: 100}, "")
+
+			var types [][]string
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck: config.ConfigReadeck{Host: mockServer.URL, ExcludeTypes: tt.exclude},
+				}),
+				WithLogger(testLogger),
+				WithReadeckHTTPClient(&http.Client{Transport: recordingTransport(func(r *http.Request) {
+					if r.URL.Path == "/api/bookmarks" {
+						types = append(types, r.URL.Query()["type"])
+					}
+				})}),
+			)
+			body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+			rr := httptest.NewRecorder()
+			app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+			var resp models.KoboGetResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if len(types) < 2 {
+				t.Fatalf("expected several list pages, got %d", len(types))
+			}
+			if !slices.Equal(types[0], tt.wantTypes) {
+				t.Errorf("expected types %v, got %v", tt.wantTypes, types[0])
+			}
+			// Everything but the excluded kind is synced, and counted once.
+			want := bookmarkCount + 1
+			if resp.Total != want || len(resp.List) != want {
+				t.Errorf("expected a total and %d items, got total %d and %d items", want, resp.Total, len(resp.List))
+			}
+		})
+	}
+}
+
+func TestFullSyncTotalCountsSkippedItems(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	start := time.Now().Add(-time.Hour)
+	const bookmarkCount = fullSyncPageSize + 50
+	for i := range bookmarkCount {
+		id := strconv.Itoa(i + 1)
+		mockServer.AddBookmark(readeck.Bookmark{ID: id, URL: "https://example.com/" + id, Created: start.Add(-time.Duration(i) * time.Minute), WordCount: 100}, "")
+	}
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(&http.Client{Transport: archivingTransport{id: "1"}}),
+	)
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+	rr := httptest.NewRecorder()
+	app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+	var resp models.KoboGetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	// The bookmark left out on the first page is not counted either.
+	if want := bookmarkCount - 1; resp.Total != want || len(resp.List) != want {
+		t.Errorf("expected a total and %d items, got total %d and %d items", want, resp.Total, len(resp.List))
+	}
+}
+
+// archivingTransport answers bookmark lists with bookmark id archived, as
+// if it was archived in Readeck after the list was filtered.
+type archivingTransport struct{ id string }
+
+func (a archivingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil || r.URL.Path != "/api/bookmarks" {
+		return resp, err
+	}
+	var bookmarks []map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&bookmarks)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, bookmark := range bookmarks {
+		if bookmark["id"] == a.id {
+			bookmark["is_archived"] = true
+		}
+	}
+	body, _ := json.Marshal(bookmarks)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// recordingTransport calls record with each request before sending it.
+type recordingTransport func(*http.Request)
+
+func (record recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	record(r)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestFillWordCounts(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "counted", URL: "https://example.com/counted", WordCount: 300}, "<p>Not fetched</p>")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "timed", URL: "https://example.com/timed", ReadingTime: 2}, "<p>Not fetched</p>")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "missing", URL: "https://example.com/missing"}, "<p>Three short words</p>")
+
+	transport := &countingTransport{count: make(map[string]int)}
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, DetailConcurrency: 2},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(&http.Client{Transport: transport}),
+	)
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+	rr := httptest.NewRecorder()
+	app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+	var resp models.KoboGetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	for id, want := range map[string]int{"counted": 300, "timed": 2 * wordsPerMinute, "missing": 3} {
+		if got := resp.List[id].WordCount; got != want {
+			t.Errorf("expected word count %d for %s, got %d", want, id, got)
+		}
+	}
+	if n := transport.requests("GET /api/bookmarks/counted/article") + transport.requests("GET /api/bookmarks/timed/article"); n != 0 {
+		t.Errorf("expected no article fetched for items Readeck counted, got %d", n)
+	}
+	if n := transport.requests("GET /api/bookmarks/missing/article"); n != 1 {
+		t.Errorf("expected the uncounted article fetched once, got %d", n)
+	}
+}
+
+func TestHandleKoboGetSearch(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/go", Title: "Learning Go"}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/rust", Title: "Learning Rust"}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "3", URL: "https://example.com/go-archived", Title: "Go archived", IsArchived: true}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, SyncCacheTTL: time.Minute},
+		}),
+		WithLogger(testLogger),
+	)
+
+	get := func(req models.KoboGetRequest) models.KoboGetResponse {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		var resp models.KoboGetResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := get(models.KoboGetRequest{AccessToken: mockDeviceToken}); len(resp.List) != 2 {
+		t.Fatalf("expected both unread bookmarks without a search, got %d", len(resp.List))
+	}
+	// A search ignores since, which would otherwise list nothing new.
+	resp := get(models.KoboGetRequest{AccessToken: mockDeviceToken, Search: "go", Since: float64(time.Now().Unix())})
+	if _, ok := resp.List["1"]; len(resp.List) != 1 || !ok || resp.Total != 1 {
+		t.Errorf("expected only the unread bookmark matching the search, got %d of %d", len(resp.List), resp.Total)
+	}
+	resp = get(models.KoboGetRequest{AccessToken: mockDeviceToken, Search: "go", State: "archive"})
+	if _, ok := resp.List["3"]; len(resp.List) != 1 || !ok {
+		t.Errorf("expected the archived bookmark matching the search, got %v", resp.List)
+	}
+
+	uc, _ := app.contexts.lookup(mockDeviceToken)
+	if history := uc.History(); len(history) == 0 || history[0].Kind != "search" {
+		t.Errorf("expected the search to be recorded, got %+v", history)
+	}
+}
+
+func TestBuildKoboArticleItemMetadata(t *testing.T) {
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	bookmark := &readeck.Bookmark{
+		ID:        "1",
+		Authors:   []string{"Jane Doe", " ", "John Roe"},
+		Lang:      "fr",
+		SiteName:  "Example News",
+		Published: published,
+		Resources: readeck.Resources{Icon: &readeck.ResourceImage{Src: "http://example.com/icon.png"}},
+	}
+
+	item := buildKoboArticleItem(bookmark)
+
+	if len(item.Authors) != 2 {
+		t.Fatalf("expected 2 authors, got %d", len(item.Authors))
+	}
+	janeID := authorID("Jane Doe")
+	if item.Authors[janeID].Name != "Jane Doe" || item.Authors[janeID].ItemID != "1" {
+		t.Errorf("expected author 'Jane Doe' under stable ID %s, got %+v", janeID, item.Authors)
+	}
+	if authorID("jane doe") != janeID {
+		t.Errorf("expected author IDs to ignore case")
+	}
+	if item.TimePublished != published.Unix() {
+		t.Errorf("expected time_published %d, got %d", published.Unix(), item.TimePublished)
+	}
+	if item.Lang != "fr" {
+		t.Errorf("expected lang 'fr', got '%s'", item.Lang)
+	}
+	if item.Domain == nil || item.Domain.Name != "Example News" || item.Domain.Logo != "http://example.com/icon.png" {
+		t.Errorf("expected domain metadata for 'Example News', got %+v", item.Domain)
+	}
+
+	item = buildKoboArticleItem(&readeck.Bookmark{ID: "2"})
+	if item.TimePublished != 0 || item.Domain != nil {
+		t.Errorf("expected no published time or domain metadata, got %d and %+v", item.TimePublished, item.Domain)
+	}
+}
+
 // koboDownloadTestCase defines the structure for test cases in TestHandleKoboDownload.
 type koboDownloadTestCase struct {
-	name           string
-	reqBody        any // Can be JSON or form data
-	contentType    string
-	expectedStatus int
-	mockBookmarks  []readeck.Bookmark
-	mockArticle    string
+	name              string
+	reqBody           any // Can be JSON or form data
+	contentType       string
+	expectedStatus    int
+	expectedErrorCode int
+	mockBookmarks     []readeck.Bookmark
+	mockArticle       string
 }
 
 func TestHandleKoboDownload(t *testing.T) {
@@ -462,14 +737,41 @@ func TestHandleKoboDownload(t *testing.T) {
 			},
 			mockArticle: `<html><body><h1>Test Article</h1><img src="http://example.com/image.png"></body></html>`,
 		},
+		{
+			name: "successful download through a redirect wrapper",
+			reqBody: models.KoboDownloadRequest{
+				AccessToken: mockDeviceToken,
+				URL:         "https://www.google.com/url?q=https%3A%2F%2Fexample.com%2Farticle1%3Futm_source%3Dnews",
+			},
+			contentType:    "application/json",
+			expectedStatus: http.StatusOK,
+			mockBookmarks: []readeck.Bookmark{
+				{ID: "1", Title: "Test Article", URL: "http://example.com/article1"},
+			},
+			mockArticle: `<html><body><h1>Test Article</h1><img src="http://example.com/image.png"></body></html>`,
+		},
+		{
+			name: "successful download of an AMP variant",
+			reqBody: models.KoboDownloadRequest{
+				AccessToken: mockDeviceToken,
+				URL:         "https://amp.example.com/article1/amp/",
+			},
+			contentType:    "application/json",
+			expectedStatus: http.StatusOK,
+			mockBookmarks: []readeck.Bookmark{
+				{ID: "1", Title: "Test Article", URL: "http://example.com/article1"},
+			},
+			mockArticle: `<html><body><h1>Test Article</h1><img src="http://example.com/image.png"></body></html>`,
+		},
 		{
 			name: "missing url",
 			reqBody: models.KoboDownloadRequest{
 				AccessToken: mockDeviceToken,
 				URL:         "",
 			},
-			contentType:    "application/json",
-			expectedStatus: http.StatusBadRequest,
+			contentType:       "application/json",
+			expectedStatus:    http.StatusBadRequest,
+			expectedErrorCode: pocketErrInvalidRequest,
 		},
 		{
 			name: "invalid access token",
@@ -477,8 +779,9 @@ func TestHandleKoboDownload(t *testing.T) {
 				AccessToken: "invalid-device-token",
 				URL:         "http://example.com/article1",
 			},
-			contentType:    "application/json",
-			expectedStatus: http.StatusUnauthorized,
+			contentType:       "application/json",
+			expectedStatus:    http.StatusUnauthorized,
+			expectedErrorCode: pocketErrAccessToken,
 		},
 	}
 
@@ -539,6 +842,19 @@ func TestHandleKoboDownload(t *testing.T) {
 				t.Errorf("expected status %d, got %d", tc.expectedStatus, rr.Code)
 			}
 
+			if tc.expectedErrorCode != 0 {
+				if got := rr.Header().Get("X-Error-Code"); got != strconv.Itoa(tc.expectedErrorCode) {
+					t.Errorf("expected X-Error-Code %d, got %q", tc.expectedErrorCode, got)
+				}
+				var errResp models.KoboErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if errResp.ErrorCode != tc.expectedErrorCode || errResp.Error != rr.Header().Get("X-Error") {
+					t.Errorf("unexpected error response %+v", errResp)
+				}
+			}
+
 			if tc.expectedStatus == http.StatusOK {
 				var resp map[string]any
 				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
@@ -560,6 +876,140 @@ func TestHandleKoboDownload(t *testing.T) {
 	}
 }
 
+func TestHandleKoboDownloadArticleCache(t *testing.T) {
+	bookmark := readeck.Bookmark{ID: "1", Title: "Test Article", URL: "http://example.com/article1", Updated: time.Unix(1700000000, 0)}
+	var fetches, revalidations int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/bookmarks" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode([]readeck.Bookmark{bookmark})
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/article") {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidations++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fetches++
+			_, _ = w.Write([]byte(`<html><body><h1>Cached Article</h1></body></html>`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users: []config.User{
+				{
+					Token:              mockDeviceToken,
+					ReadeckAccessToken: mockPlaintextReadeckToken,
+				},
+			},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, ArticleCacheSize: 10},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	download := func(refresh int) string {
+		body, _ := json.Marshal(models.KoboDownloadRequest{AccessToken: mockDeviceToken, URL: bookmark.URL, Refresh: refresh})
+		req := httptest.NewRequest(http.MethodPost, "/api/kobo/download", bytes.NewReader(body))
+		req.Header.Add("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.HandleKoboDownload(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var resp map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		article, _ := resp["article"].(string)
+		return article
+	}
+
+	for range 2 {
+		if article := download(0); !strings.Contains(article, "Cached Article") {
+			t.Errorf("expected cached article content, got %q", article)
+		}
+	}
+	if fetches != 1 || revalidations != 0 {
+		t.Errorf("expected 1 fetch and no revalidation, got %d fetches and %d revalidations", fetches, revalidations)
+	}
+
+	bookmark.Updated = bookmark.Updated.Add(time.Hour)
+	if article := download(0); !strings.Contains(article, "Cached Article") {
+		t.Errorf("expected revalidated article content, got %q", article)
+	}
+	if fetches != 1 || revalidations != 1 {
+		t.Errorf("expected 1 fetch and 1 revalidation, got %d fetches and %d revalidations", fetches, revalidations)
+	}
+	if app.articles.Len() != 1 {
+		t.Errorf("expected 1 cached article, got %d", app.articles.Len())
+	}
+
+	// Redownloading the article on the device fetches it again.
+	if article := download(1); !strings.Contains(article, "Cached Article") {
+		t.Errorf("expected refreshed article content, got %q", article)
+	}
+	if fetches != 2 || revalidations != 1 {
+		t.Errorf("expected 2 fetches and 1 revalidation, got %d fetches and %d revalidations", fetches, revalidations)
+	}
+}
+
+func TestHandleKoboDownloadOutput(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/bookmarks" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id":"1","title":"Test Article","url":"http://example.com/article1"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><h1>Test Article</h1><img src="http://example.com/image.png"></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	testCases := []struct {
+		name                string
+		output              string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{name: "json", output: "json", expectedContentType: "application/json", expectedBody: `"article":`},
+		{name: "default", expectedContentType: "application/json", expectedBody: `"images":{"0":`},
+		{name: "article only", output: "html", expectedContentType: "text/html; charset=utf-8", expectedBody: `<img src="http://example.com/image.png"/>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(models.KoboDownloadRequest{AccessToken: mockDeviceToken, URL: "http://example.com/article1", Output: tc.output})
+			rr := httptest.NewRecorder()
+			app.HandleKoboDownload(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/download", bytes.NewReader(body)))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tc.expectedContentType {
+				t.Errorf("expected content type %q, got %q", tc.expectedContentType, got)
+			}
+			if !strings.Contains(rr.Body.String(), tc.expectedBody) {
+				t.Errorf("expected %q in the response, got %q", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
 // koboSendTestCase defines the structure for test cases in TestHandleKoboSend.
 type koboSendTestCase struct {
 	name                string
@@ -574,10 +1024,6 @@ type koboSendTestCase struct {
 }
 
 func TestHandleKoboSend(t *testing.T) {
-	var updatedBookmarkID string
-	var updatedBookmarkData map[string]any
-	var createdBookmarkURL string
-
 	testCases := []koboSendTestCase{
 		{
 			name: "archive action",
@@ -684,33 +1130,11 @@ func TestHandleKoboSend(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Reset mock data
-			updatedBookmarkID = ""
-			updatedBookmarkData = nil
-			createdBookmarkURL = ""
-
-			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if r.Method == http.MethodPatch {
-					updatedBookmarkID = strings.TrimPrefix(r.URL.Path, "/api/bookmarks/")
-					bodyBytes, _ := io.ReadAll(r.Body)
-					if err := json.Unmarshal(bodyBytes, &updatedBookmarkData); err != nil {
-						t.Fatalf("Failed to unmarshal: %v", err)
-					}
-				}
-				if r.Method == http.MethodPost {
-					var data struct {
-						URL string `json:"url"`
-					}
-					bodyBytes, _ := io.ReadAll(r.Body)
-					if err := json.Unmarshal(bodyBytes, &data); err != nil {
-						t.Fatalf("Failed to unmarshal: %v", err)
-					}
-					createdBookmarkURL = data.URL
-				}
-				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte(`{"status": "ok"}`))
-			}))
+			mockServer := readecktest.NewServer()
 			defer mockServer.Close()
+			for id := range 6 {
+				mockServer.AddBookmark(readeck.Bookmark{ID: strconv.Itoa(id + 1)}, "")
+			}
 
 			app := NewApp(
 				WithConfig(&config.Config{
@@ -763,26 +1187,80 @@ func TestHandleKoboSend(t *testing.T) {
 					}
 				}
 
-				if tc.expectedUpdatedID != "" && updatedBookmarkID != tc.expectedUpdatedID {
-					t.Errorf("expected updated bookmark ID to be '%s', got '%s'", tc.expectedUpdatedID, updatedBookmarkID)
+				var updated readecktest.Update
+				if updates := mockServer.Updates(); len(updates) > 0 {
+					updated = updates[len(updates)-1]
+				}
+				if tc.expectedUpdatedID != "" && updated.ID != tc.expectedUpdatedID {
+					t.Errorf("expected updated bookmark ID to be '%s', got '%s'", tc.expectedUpdatedID, updated.ID)
 				}
 
 				if tc.expectedUpdatedData != nil {
 					for k, v := range tc.expectedUpdatedData {
-						if updatedBookmarkData[k] != v {
-							t.Errorf("expected updated data for key '%s' to be %v, got %v", k, v, updatedBookmarkData[k])
+						if updated.Data[k] != v {
+							t.Errorf("expected updated data for key '%s' to be %v, got %v", k, v, updated.Data[k])
 						}
 					}
 				}
 
-				if tc.expectedCreatedURL != "" && createdBookmarkURL != tc.expectedCreatedURL {
-					t.Errorf("expected created bookmark URL to be '%s', got '%s'", tc.expectedCreatedURL, createdBookmarkURL)
+				if created := mockServer.Created(); tc.expectedCreatedURL != "" && (len(created) != 1 || created[0] != tc.expectedCreatedURL) {
+					t.Errorf("expected created bookmark URL to be '%s', got %v", tc.expectedCreatedURL, created)
 				}
 			}
 		})
 	}
 }
 
+func TestHandleKoboSendDryRun(t *testing.T) {
+	var mutations int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			mutations++
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users: []config.User{
+				{
+					Token:              mockDeviceToken,
+					ReadeckAccessToken: mockPlaintextReadeckToken,
+				},
+			},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+			DryRun:  true,
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	body, _ := json.Marshal(models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: []any{
+		map[string]any{"action": "archive", "item_id": "1"},
+		map[string]any{"action": "delete", "item_id": "2"},
+		map[string]any{"action": "add", "url": "http://example.com/new"},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	app.HandleKoboSend(rr, req)
+
+	if mutations != 0 {
+		t.Errorf("expected no requests to Readeck, got %d", mutations)
+	}
+	if rr.Header().Get("X-Readeckobo-Dry-Run") != "true" {
+		t.Error("expected X-Readeckobo-Dry-Run header")
+	}
+	var resp map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["dry_run"] != true || resp["status"] != true {
+		t.Errorf("expected successful dry run response, got %v", resp)
+	}
+}
+
 func TestHandleConvertImage(t *testing.T) {
 	testLogger := logger.New(logger.DEBUG)
 
@@ -879,3 +1357,436 @@ func TestHandleConvertImage(t *testing.T) {
 }
 
 
+
+func TestExpiredReadeckToken(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth" {
+			_, _ = w.Write([]byte(`{"id": "t1", "token": "fresh-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Total-Count", "0")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users: []config.User{
+				{Token: "expired-device", ReadeckAccessToken: "stale-token"},
+				{Token: "refreshing-device", ReadeckAccessToken: "stale-token", ReadeckUsername: "alice", ReadeckPassword: "secret"},
+			},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	get := func(deviceToken string) int {
+		body, _ := json.Marshal(models.KoboGetRequest{AccessToken: deviceToken})
+		req := httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, req)
+		return rr.Code
+	}
+
+	if code := get("expired-device"); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for an expired token, got %d", http.StatusUnauthorized, code)
+	}
+	if code := get("refreshing-device"); code != http.StatusOK {
+		t.Errorf("expected status %d after refreshing the token, got %d", http.StatusOK, code)
+	}
+
+	rr := httptest.NewRecorder()
+	app.HandleHealthz(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var health map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if health["status"] != "degraded" || health["expired_tokens"] != 1.0 {
+		t.Errorf("expected status 'degraded' with one expired token, got %v", health)
+	}
+	if _, ok := health["users"]; ok {
+		t.Errorf("expected no per-user details in /healthz, got %v", health)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandleAdminUsers(rr, httptest.NewRequest(http.MethodGet, "/admin/api/users", nil))
+
+	var users adminUsersResponse
+	if err := json.NewDecoder(rr.Body).Decode(&users); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(users.Users) != 2 || users.Users[0].ReadeckToken != "expired" || users.Users[1].ReadeckToken != "valid" {
+		t.Errorf("expected first user expired and second valid, got %+v", users.Users)
+	}
+}
+
+func TestRefreshReadeckTokenOnce(t *testing.T) {
+	var logins atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth" {
+			logins.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"id": "t1", "token": "fresh-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("users:\n  - token: device\n    readeck_access_token: stale-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	user := config.User{Token: "device", ReadeckAccessToken: "stale-token", ReadeckUsername: "alice", ReadeckPassword: "secret"}
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{user, {Token: "unchecked", ReadeckAccessToken: "other"}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+		WithConfigPath(configPath),
+	)
+	client, err := app.buildReadeckClient(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.UpdateBookmark(t.Context(), "1", map[string]any{"is_archived": true}); err != nil {
+				t.Errorf("expected the update to succeed after the refresh, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := logins.Load(); n != 1 {
+		t.Errorf("expected one login for concurrently rejected requests, got %d", n)
+	}
+	saved, err := os.ReadFile(configPath)
+	if err != nil || !strings.Contains(string(saved), "fresh-token") {
+		t.Errorf("expected the new token saved to the configuration, got %q (%v)", saved, err)
+	}
+	health := app.usersHealth()
+	if health[0].ReadeckToken != "valid" || health[1].ReadeckToken != "unknown" {
+		t.Errorf("expected the refreshed token valid and the unchecked one unknown, got %+v", health)
+	}
+}
+
+// fakeCache counts invalidations for TestDashboard.
+type fakeCache struct{ invalidated int }
+
+func (c *fakeCache) Name() string { return "fake" }
+func (c *fakeCache) Len() int     { return 2 }
+func (c *fakeCache) Invalidate()  { c.invalidated++ }
+
+func TestDashboard(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Total-Count", "3")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+	cache := &fakeCache{}
+	app.RegisterCache(cache)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		form     url.Values
+		handler  http.HandlerFunc
+		expected []string
+	}{
+		{
+			name:     "overview",
+			method:   http.MethodGet,
+			path:     "/admin/",
+			handler:  app.HandleDashboard,
+			expected: []string{maskToken(mockDeviceToken), "never", "<td>fake</td><td>2</td>"},
+		},
+		{
+			name:     "test readeck",
+			method:   http.MethodPost,
+			path:     "/admin/test-readeck",
+			form:     url.Values{"user": {"0"}},
+			handler:  app.HandleDashboardTestReadeck,
+			expected: []string{"with 3 bookmarks"},
+		},
+		{
+			name:     "invalidate caches",
+			method:   http.MethodPost,
+			path:     "/admin/invalidate-caches",
+			handler:  app.HandleDashboardInvalidateCaches,
+			expected: []string{"Caches invalidated."},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			tc.handler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			for _, want := range tc.expected {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("expected page to contain %q", want)
+				}
+			}
+		})
+	}
+
+	if cache.invalidated != 1 {
+		t.Errorf("expected the cache to be invalidated once, got %d", cache.invalidated)
+	}
+}
+
+func TestDashboardRequests(t *testing.T) {
+	testCases := []struct {
+		name     string
+		recent   int
+		expected []string
+	}{
+		{name: "inspector", recent: 5, expected: []string{"kobo.get", "POST http://kobo.example.com/api/kobo/get", capture.Token}},
+		{name: "disabled", expected: []string{"Set <code>capture.recent</code>"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{Users: []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}}}
+			cfg.Capture.Recent = tc.recent
+			recorder, err := capture.NewRecorder("", testLogger)
+			if err != nil {
+				t.Fatalf("NewRecorder failed: %v", err)
+			}
+			recorder.KeepRecent(tc.recent)
+			app := NewApp(WithConfig(cfg), WithLogger(testLogger), WithCapture(recorder))
+
+			echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(r.FormValue("access_token")))
+			})
+			form := url.Values{"access_token": {mockDeviceToken}}
+			req := httptest.NewRequest(http.MethodPost, "http://kobo.example.com/api/kobo/get", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			recorder.Middleware("kobo.get", echo).ServeHTTP(httptest.NewRecorder(), req)
+
+			rr := httptest.NewRecorder()
+			app.HandleDashboardRequests(rr, httptest.NewRequest(http.MethodGet, "/admin/requests", nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			for _, want := range tc.expected {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("expected page to contain %q", want)
+				}
+			}
+			if strings.Contains(rr.Body.String(), mockDeviceToken) {
+				t.Error("expected the device token to be scrubbed")
+			}
+		})
+	}
+}
+
+func TestEncryptDeviceToken(t *testing.T) {
+	// Generated with bin/generate-encrypted-token.sh.
+	got, err := encryptDeviceToken("0f8fad5b-d9cb-469f-a165-70867728950e", "N123456789")
+	if err != nil {
+		t.Fatalf("encryptDeviceToken() error = %v", err)
+	}
+	expected := "d08E5YeY3dqbsgboRdlJ/1g+weV9kVvf+RuTdGzA5+Wu/oRYKH5iLODdl1zNYY43"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestHandleSetupSubmit(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("users: []\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	app := NewApp(
+		WithConfig(&config.Config{Readeck: config.ConfigReadeck{Host: "https://readeck.example.com"}}),
+		WithConfigPath(configPath),
+		WithLogger(testLogger),
+	)
+
+	form := url.Values{
+		"serial":        {"N123456789"},
+		"bridge_url":    {"https://kobo.example.com/"},
+		"readeck_token": {"readeck-token"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/setup", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	app.HandleSetupSubmit(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{"api_endpoint=https://kobo.example.com/instapaper-proxy/storeapi", "AccessToken=@ByteArray(", "data:image/png;base64,"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected page to contain %q", want)
+		}
+	}
+
+	users := app.users()
+	if len(users) != 1 || users[0].ReadeckAccessToken != "readeck-token" {
+		t.Fatalf("expected one new user, got %+v", users)
+	}
+	saved, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !strings.Contains(string(saved), users[0].Token) {
+		t.Errorf("expected device token to be saved, got %s", saved)
+	}
+}
+
+func TestHandleSetupDownload(t *testing.T) {
+	app := NewApp(
+		WithConfig(&config.Config{Users: []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}}}),
+		WithLogger(testLogger),
+	)
+
+	testCases := []struct {
+		name         string
+		deviceToken  string
+		format       string
+		expectedCode int
+		expectedType string
+	}{
+		{name: "KoboRoot.tgz", deviceToken: mockDeviceToken, format: "koboroot", expectedCode: http.StatusOK, expectedType: "application/gzip"},
+		{name: "NickelMenu zip", deviceToken: mockDeviceToken, format: "zip", expectedCode: http.StatusOK, expectedType: "application/zip"},
+		{name: "unknown device", deviceToken: "unknown", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{
+				"device_token": {tc.deviceToken},
+				"serial":       {"N123456789"},
+				"bridge_url":   {"https://kobo.example.com"},
+				"format":       {tc.format},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/setup/download", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			app.HandleSetupDownload(rr, req)
+
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("expected status %d, got %d", tc.expectedCode, rr.Code)
+			}
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != tc.expectedType {
+				t.Errorf("expected Content-Type %q, got %q", tc.expectedType, got)
+			}
+
+			files := make(map[string]string)
+			if tc.format == "zip" {
+				zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+				if err != nil {
+					t.Fatalf("Failed to read zip: %v", err)
+				}
+				for _, f := range zr.File {
+					rc, _ := f.Open()
+					content, _ := io.ReadAll(rc)
+					_ = rc.Close()
+					files[f.Name] = string(content)
+				}
+			} else {
+				gz, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("Failed to read gzip: %v", err)
+				}
+				tr := tar.NewReader(gz)
+				for {
+					header, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("Failed to read tar: %v", err)
+					}
+					content, _ := io.ReadAll(tr)
+					files[strings.TrimPrefix(header.Name, "mnt/onboard/")] = string(content)
+				}
+			}
+
+			if !strings.Contains(files[nickelMenuConfigPath], "chain_success:power:reboot") {
+				t.Errorf("expected NickelMenu config, got %q", files[nickelMenuConfigPath])
+			}
+			if !strings.Contains(files[configureScriptPath], "api_endpoint 'https://kobo.example.com/instapaper-proxy/storeapi'") {
+				t.Errorf("expected configure script, got %q", files[configureScriptPath])
+			}
+		})
+	}
+}
+
+func TestHandleSetupDownloadRejectsHostileBridgeURL(t *testing.T) {
+	app := NewApp(
+		WithConfig(&config.Config{Users: []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}}}),
+		WithLogger(testLogger),
+	)
+
+	for _, bridgeURL := range []string{
+		`https://kobo.example.com"; reboot; "`,
+		"https://kobo.example.com/?x=$(reboot)",
+		"https://kobo.example.com/#`reboot`",
+		"javascript:alert(1)",
+		"/instapaper-proxy",
+	} {
+		form := url.Values{"device_token": {mockDeviceToken}, "serial": {"N123456789"}, "bridge_url": {bridgeURL}}
+		req := httptest.NewRequest(http.MethodPost, "/setup/download", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		app.HandleSetupDownload(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %q, got %d", bridgeURL, rr.Code)
+		}
+	}
+
+	// What url.Parse accepts in a path stays a single quoted word.
+	script := koboSetupFiles("https://kobo.example.com/$(reboot)/it's", "token")[1].content
+	if !strings.Contains(script, `api_endpoint 'https://kobo.example.com/$(reboot)/it'\''s/instapaper-proxy/storeapi'`) {
+		t.Errorf("expected the bridge URL single quoted, got %s", script)
+	}
+}
+
+func TestBridgeURLPathPrefix(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.PathPrefix = "/readeckobo"
+	app := NewApp(WithConfig(cfg), WithLogger(testLogger))
+
+	req := httptest.NewRequest(http.MethodGet, "https://bridge.example.com/api/kobo/download", nil)
+	got := app.mathImageURL(req, "x", false)
+	if !strings.HasPrefix(got, "https://bridge.example.com/readeckobo/instapaper-proxy/instapaper/api/math?") {
+		t.Errorf("expected the image URL under the path prefix, got %q", got)
+	}
+}
@@ -0,0 +1,506 @@
+package app
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/models"
+)
+
+// removedElements are dropped from articles along with their content.
+var removedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Noscript: true,
+	atom.Link:     true,
+	atom.Meta:     true,
+}
+
+// urlAttributes lists the attributes that hold URLs to resolve against the bookmark URL.
+var urlAttributes = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"poster": true,
+}
+
+// maxTableColumns is the widest table kept as a table; wider tables are
+// flattened into one block per row since the Kobo reader cannot scroll them.
+const maxTableColumns = 4
+
+// wordsPerMinute is the reading speed used to estimate reading times.
+const wordsPerMinute = 200
+
+// processArticle runs every article transformation needed before the images
+// are extracted and the article is handed to the Kobo. It returns the videos
+// that were replaced by placeholders.
+func processArticle(doc *html.Node, baseURL *url.URL, images videoImages) map[string]models.KoboVideo {
+	videos := replaceEmbeds(doc, baseURL, images)
+	sanitizeArticle(doc, baseURL)
+	inlineFootnotes(doc)
+	simplifyTables(doc)
+	return videos
+}
+
+// sanitizeArticle rewrites the parsed article so that Kobo's Pocket renderer
+// can display it. Entities are normalized by the parse/render round trip.
+func sanitizeArticle(doc *html.Node, baseURL *url.URL) {
+	var processNode func(*html.Node)
+	processNode = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode {
+				switch {
+				case removedElements[c.DataAtom]:
+					n.RemoveChild(c)
+					c = next
+					continue
+				case c.DataAtom == atom.Picture:
+					unwrapPicture(c)
+				case c.DataAtom == atom.Figure:
+					renameElement(c, atom.Div)
+				case c.DataAtom == atom.Figcaption:
+					renameElement(c, atom.P)
+				}
+				resolveURLs(c, baseURL)
+			}
+			processNode(c)
+			c = next
+		}
+	}
+	processNode(doc)
+}
+
+// unwrapPicture replaces a picture element with its fallback img, choosing
+// the first source's srcset when the picture has no img.
+func unwrapPicture(n *html.Node) {
+	var img *html.Node
+	var fallbackSrc string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if c.DataAtom == atom.Img && img == nil {
+			img = c
+		}
+		if c.DataAtom == atom.Source && fallbackSrc == "" {
+			fallbackSrc = firstSrcsetURL(getAttr(c, "srcset"))
+		}
+	}
+
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		n.RemoveChild(c)
+		c = next
+	}
+
+	if img == nil {
+		if fallbackSrc == "" {
+			renameElement(n, atom.Span)
+			return
+		}
+		img = &html.Node{Type: html.ElementNode, Data: "img", DataAtom: atom.Img}
+	}
+	if getAttr(img, "src") == "" && fallbackSrc != "" {
+		setAttr(img, "src", fallbackSrc)
+	}
+
+	renameElement(n, atom.Span)
+	n.AppendChild(img)
+}
+
+// firstSrcsetURL returns the first candidate URL of a srcset attribute.
+func firstSrcsetURL(srcset string) string {
+	candidate, _, _ := strings.Cut(strings.TrimSpace(srcset), ",")
+	fields := strings.Fields(candidate)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func resolveURLs(n *html.Node, baseURL *url.URL) {
+	if baseURL == nil {
+		return
+	}
+	for i, attr := range n.Attr {
+		if !urlAttributes[attr.Key] || attr.Val == "" {
+			continue
+		}
+		ref, err := url.Parse(strings.TrimSpace(attr.Val))
+		if err != nil || ref.IsAbs() || strings.HasPrefix(attr.Val, "#") {
+			continue
+		}
+		n.Attr[i].Val = baseURL.ResolveReference(ref).String()
+	}
+}
+
+// footnoteRef is a link from the article text to a footnote.
+type footnoteRef struct {
+	link   *html.Node
+	target *html.Node
+}
+
+// inlineFootnotes replaces footnote links, which the Kobo cannot follow, with
+// plain [n] markers and moves the footnotes into an end-notes section.
+func inlineFootnotes(doc *html.Node) {
+	ids := make(map[string]*html.Node)
+	order := make(map[*html.Node]int)
+	var candidates []footnoteRef
+	walkElements(doc, func(n *html.Node) {
+		order[n] = len(order)
+		if id := getAttr(n, "id"); id != "" {
+			ids[id] = n
+		}
+		if n.DataAtom == atom.A {
+			if href := getAttr(n, "href"); strings.HasPrefix(href, "#") && len(href) > 1 {
+				candidates = append(candidates, footnoteRef{link: n})
+			}
+		}
+	})
+
+	targets := make(map[*html.Node]bool)
+	var refs []footnoteRef
+	for _, ref := range candidates {
+		target := ids[strings.TrimPrefix(getAttr(ref.link, "href"), "#")]
+		if target == nil || isHeading(target) || !isFootnoteMarker(textContent(ref.link)) || !isFootnote(target, ref.link, ids, order) {
+			continue
+		}
+		ref.target = target
+		refs = append(refs, ref)
+		targets[target] = true
+	}
+
+	var notes []*html.Node
+	numbers := make(map[*html.Node]int)
+	for _, ref := range refs {
+		// Links inside a footnote are back-references to the text.
+		if hasAncestor(ref.link, targets) {
+			continue
+		}
+		number, seen := numbers[ref.target]
+		if !seen {
+			notes = append(notes, ref.target)
+			number = len(notes)
+			numbers[ref.target] = number
+		}
+		marker := &html.Node{Type: html.TextNode, Data: "[" + strconv.Itoa(number) + "]"}
+		ref.link.Parent.InsertBefore(marker, ref.link)
+		ref.link.Parent.RemoveChild(ref.link)
+	}
+
+	if len(notes) == 0 {
+		return
+	}
+
+	container := findElement(doc, atom.Body)
+	if container == nil {
+		container = doc
+	}
+	container.AppendChild(&html.Node{Type: html.ElementNode, Data: "hr", DataAtom: atom.Hr})
+
+	for i, target := range notes {
+		note := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+		note.AppendChild(&html.Node{Type: html.TextNode, Data: "[" + strconv.Itoa(i+1) + "] "})
+
+		parent := target.Parent
+		if parent != nil {
+			parent.RemoveChild(target)
+		}
+		for c := target.FirstChild; c != nil; {
+			next := c.NextSibling
+			target.RemoveChild(c)
+			note.AppendChild(c)
+			c = next
+		}
+		removeInternalLinks(note)
+		removeEmptyAncestors(parent)
+		container.AppendChild(note)
+	}
+}
+
+// isFootnote reports whether target, linked to from link, looks like a note
+// rather than a section, so that tables of contents and links within the
+// article keep their targets in place. order gives the document position of
+// each element.
+func isFootnote(target, link *html.Node, ids map[string]*html.Node, order map[*html.Node]int) bool {
+	for n := target; n != nil; n = n.Parent {
+		switch getAttr(n, "role") {
+		case "doc-footnote", "doc-endnote", "doc-endnotes":
+			return true
+		}
+	}
+
+	id := strings.ToLower(getAttr(target, "id"))
+	if strings.HasPrefix(id, "footnote") {
+		return true
+	}
+	if rest, ok := strings.CutPrefix(id, "fn"); ok && (rest == "" || !unicode.IsLetter([]rune(rest)[0])) {
+		return true
+	}
+
+	// A note usually links back to where it is referenced, which it follows.
+	if order[target] < order[link] {
+		return false
+	}
+	backRef := false
+	walkElements(target, func(n *html.Node) {
+		href := getAttr(n, "href")
+		if n.DataAtom != atom.A || !strings.HasPrefix(href, "#") {
+			return
+		}
+		if ref := ids[href[1:]]; ref != nil && (ref == link || hasAncestor(link, map[*html.Node]bool{ref: true})) {
+			backRef = true
+		}
+	})
+	return backRef
+}
+
+// isFootnoteMarker reports whether a link text looks like "1", "[2]" or "*".
+func isFootnoteMarker(text string) bool {
+	text = strings.Trim(strings.TrimSpace(text), "[]()")
+	return text != "" && len([]rune(text)) <= 4
+}
+
+func isHeading(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+// removeInternalLinks drops in-document links, such as footnote back-references.
+func removeInternalLinks(n *html.Node) {
+	var links []*html.Node
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom == atom.A && strings.HasPrefix(getAttr(c, "href"), "#") {
+			links = append(links, c)
+		}
+	})
+	for _, link := range links {
+		link.Parent.RemoveChild(link)
+	}
+}
+
+// removeEmptyAncestors removes n and its ancestors while they hold no content.
+func removeEmptyAncestors(n *html.Node) {
+	for n != nil && n.Type == html.ElementNode && n.DataAtom != atom.Body && strings.TrimSpace(textContent(n)) == "" {
+		parent := n.Parent
+		if parent == nil {
+			return
+		}
+		parent.RemoveChild(n)
+		n = parent
+	}
+}
+
+// simplifyTables flattens tables wider than maxTableColumns and strips layout
+// attributes from the rest.
+func simplifyTables(doc *html.Node) {
+	var tables []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Table {
+			tables = append(tables, n)
+		}
+	})
+
+	// Nested tables come later in document order, so walk backwards to
+	// flatten inner tables first.
+	for i := len(tables) - 1; i >= 0; i-- {
+		table := tables[i]
+		rows := tableRows(table)
+
+		columns := 0
+		for _, row := range rows {
+			columns = max(columns, len(rowCells(row)))
+		}
+
+		if columns <= maxTableColumns {
+			removeAttrs(table, "style", "width", "height")
+			walkElements(table, func(n *html.Node) {
+				removeAttrs(n, "style", "width", "height")
+			})
+			continue
+		}
+
+		flattenTable(table, rows)
+	}
+}
+
+// flattenTable replaces table with one block per row, labelling each cell
+// with its column header when the table has one.
+func flattenTable(table *html.Node, rows []*html.Node) {
+	var headers []string
+	if len(rows) > 0 && isHeaderRow(rows[0]) {
+		for _, cell := range rowCells(rows[0]) {
+			headers = append(headers, strings.Join(strings.Fields(textContent(cell)), " "))
+		}
+		rows = rows[1:]
+	}
+
+	replacement := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, row := range rows {
+		block := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+		for i, cell := range rowCells(row) {
+			p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+			if i < len(headers) && headers[i] != "" {
+				label := &html.Node{Type: html.ElementNode, Data: "strong", DataAtom: atom.Strong}
+				label.AppendChild(&html.Node{Type: html.TextNode, Data: headers[i] + ": "})
+				p.AppendChild(label)
+			}
+			for c := cell.FirstChild; c != nil; {
+				next := c.NextSibling
+				cell.RemoveChild(c)
+				p.AppendChild(c)
+				c = next
+			}
+			block.AppendChild(p)
+		}
+		replacement.AppendChild(block)
+		replacement.AppendChild(&html.Node{Type: html.ElementNode, Data: "hr", DataAtom: atom.Hr})
+	}
+
+	if table.Parent != nil {
+		table.Parent.InsertBefore(replacement, table)
+		table.Parent.RemoveChild(table)
+	}
+}
+
+// tableRows returns the rows of table, excluding rows of nested tables.
+func tableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		switch c.DataAtom {
+		case atom.Tr:
+			rows = append(rows, c)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.DataAtom == atom.Tr {
+					rows = append(rows, r)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func rowCells(row *html.Node) []*html.Node {
+	var cells []*html.Node
+	for c := row.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Td || c.DataAtom == atom.Th {
+			cells = append(cells, c)
+		}
+	}
+	return cells
+}
+
+func isHeaderRow(row *html.Node) bool {
+	if row.Parent != nil && row.Parent.DataAtom == atom.Thead {
+		return true
+	}
+	cells := rowCells(row)
+	for _, cell := range cells {
+		if cell.DataAtom != atom.Th {
+			return false
+		}
+	}
+	return len(cells) > 0
+}
+
+// walkElements calls fn for every element below n in document order.
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkElements(n, func(c *html.Node) {
+		if found == nil && c.DataAtom == a {
+			found = c
+		}
+	})
+	return found
+}
+
+func hasAncestor(n *html.Node, ancestors map[*html.Node]bool) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if ancestors[p] {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+// countWords returns the number of words in the text of n.
+func countWords(n *html.Node) int {
+	if n.Type == html.TextNode {
+		return len(strings.Fields(n.Data))
+	}
+	count := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += countWords(c)
+	}
+	return count
+}
+
+// readingTime estimates the reading time in minutes, rounding up.
+func readingTime(wordCount int) int {
+	return (wordCount + wordsPerMinute - 1) / wordsPerMinute
+}
+
+func removeAttrs(n *html.Node, keys ...string) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if !slices.Contains(keys, attr.Key) {
+			attrs = append(attrs, attr)
+		}
+	}
+	n.Attr = attrs
+}
+
+func renameElement(n *html.Node, a atom.Atom) {
+	n.DataAtom = a
+	n.Data = a.String()
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, attr := range n.Attr {
+		if attr.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// renderArticle parses input, applies process and renders the body contents.
+func renderArticle(t *testing.T, input string, process func(*html.Node)) string {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	process(doc)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		t.Fatalf("Failed to render HTML: %v", err)
+	}
+	out := buf.String()
+	out = strings.TrimPrefix(out, "<html><head></head><body>")
+	return strings.TrimSuffix(out, "</body></html>")
+}
+
+func TestSanitizeArticle(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/blog/post")
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "strips script, style and iframe",
+			input:    `<p>text</p><script>alert(1)</script><style>p{}</style><iframe src="x"></iframe>`,
+			expected: `<p>text</p>`,
+		},
+		{
+			name:     "unwraps picture to img",
+			input:    `<picture><source srcset="/a.webp 1x"><img src="/a.jpg"></picture>`,
+			expected: `<span><img src="https://example.com/a.jpg"/></span>`,
+		},
+		{
+			name:     "unwraps picture without img using srcset",
+			input:    `<picture><source srcset="a.webp 1x, b.webp 2x"></picture>`,
+			expected: `<span><img src="https://example.com/blog/a.webp"/></span>`,
+		},
+		{
+			name:     "converts figure and figcaption",
+			input:    `<figure><img src="https://cdn.example.com/a.png"><figcaption>caption</figcaption></figure>`,
+			expected: `<div><img src="https://cdn.example.com/a.png"/><p>caption</p></div>`,
+		},
+		{
+			name:     "resolves relative links and keeps fragments",
+			input:    `<a href="../other">other</a><a href="#note">note</a>`,
+			expected: `<a href="https://example.com/other">other</a><a href="#note">note</a>`,
+		},
+		{
+			name:     "normalizes entities",
+			input:    `<p>&eacute;t&eacute; &amp; &#8220;quotes&#8221;</p>`,
+			expected: "<p>été &amp; “quotes”</p>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := renderArticle(t, tc.input, func(doc *html.Node) { sanitizeArticle(doc, baseURL) })
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestInlineFootnotes(t *testing.T) {
+	input := `<p>Claim<sup><a href="#fn1">1</a></sup> and again<sup><a href="#fn1">1</a></sup>.</p>` +
+		`<h2 id="more">More</h2><p><a href="#more">2</a></p>` +
+		`<section class="footnotes"><ol><li id="fn1">Source <a href="https://example.com">here</a> <a href="#fnref1">↩</a></li></ol></section>`
+	expected := `<p>Claim<sup>[1]</sup> and again<sup>[1]</sup>.</p>` +
+		`<h2 id="more">More</h2><p><a href="#more">2</a></p>` +
+		`<hr/><div>[1] Source <a href="https://example.com">here</a> </div>`
+
+	got := renderArticle(t, input, inlineFootnotes)
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestInlineFootnotesKeepsSectionLinks(t *testing.T) {
+	input := `<ul><li><a href="#s1">1</a></li></ul><div id="s1"><p>Part one</p></div>` +
+		`<p>Claim<sup id="ref-a"><a href="#a">*</a></sup></p><aside id="a">Aside <a href="#ref-a">back</a></aside>` +
+		`<p>Other<a href="#n2">2</a></p><p id="n2" role="doc-endnote">Note</p>`
+	expected := `<ul><li><a href="#s1">1</a></li></ul><div id="s1"><p>Part one</p></div>` +
+		`<p>Claim<sup id="ref-a">[1]</sup></p>` +
+		`<p>Other[2]</p><hr/><div>[1] Aside </div><div>[2] Note</div>`
+
+	got := renderArticle(t, input, inlineFootnotes)
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSimplifyTables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "narrow table keeps structure",
+			input:    `<table width="600"><tr><td style="color:red">a</td><td>b</td></tr></table>`,
+			expected: `<table><tbody><tr><td>a</td><td>b</td></tr></tbody></table>`,
+		},
+		{
+			name: "wide table is flattened with headers",
+			input: `<table><thead><tr><th>A</th><th>B</th><th>C</th><th>D</th><th>E</th></tr></thead>` +
+				`<tbody><tr><td>1</td><td>2</td><td>3</td><td>4</td><td>5</td></tr></tbody></table>`,
+			expected: `<div><div><p><strong>A: </strong>1</p><p><strong>B: </strong>2</p><p><strong>C: </strong>3</p>` +
+				`<p><strong>D: </strong>4</p><p><strong>E: </strong>5</p></div><hr/></div>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := renderArticle(t, tc.input, simplifyTables)
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountWordsAndReadingTime(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>one two</p><p>three <em>four</em> five</p>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	if got := countWords(doc); got != 5 {
+		t.Errorf("expected 5 words, got %d", got)
+	}
+
+	testCases := map[int]int{0: 0, 1: 1, wordsPerMinute: 1, wordsPerMinute + 1: 2}
+	for words, expected := range testCases {
+		if got := readingTime(words); got != expected {
+			t.Errorf("readingTime(%d): expected %d, got %d", words, expected, got)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+// articleCache keeps the HTML of recently downloaded articles, keyed by
+// bookmark ID, evicting the least recently used once it holds size entries.
+type articleCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cachedArticle struct {
+	id         string
+	updated    time.Time
+	html       string
+	validators readeck.ArticleValidators
+}
+
+func newArticleCache(size int) *articleCache {
+	return &articleCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *articleCache) get(id string) (cachedArticle, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[id]
+	if !ok {
+		return cachedArticle{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *elem.Value.(*cachedArticle), true
+}
+
+func (c *articleCache) put(article cachedArticle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[article.id]; ok {
+		*elem.Value.(*cachedArticle) = article
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[article.id] = c.order.PushFront(&article)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedArticle).id)
+	}
+}
+
+// remove drops the article of bookmark id, so that it is fetched anew.
+func (c *articleCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[id]; ok {
+		c.order.Remove(elem)
+		delete(c.items, id)
+	}
+}
+
+func (c *articleCache) Name() string {
+	return "Readeck articles"
+}
+
+func (c *articleCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *articleCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// fetchArticle returns the HTML of bookmark id. A cached copy is served as is
+// while the bookmark's updated time is unchanged, and otherwise revalidated
+// with Readeck before it is used again.
+func (a *App) fetchArticle(ctx context.Context, readeckClient *readeck.Client, id string, updated time.Time) (string, error) {
+	if a.articles == nil {
+		return readeckClient.GetBookmarkArticle(ctx, id)
+	}
+
+	// The sync list only carries whole seconds.
+	updated = updated.Truncate(time.Second)
+	cached, ok := a.articles.get(id)
+	if ok && cached.updated.Equal(updated) {
+		return cached.html, nil
+	}
+
+	article, validators, modified, err := readeckClient.GetBookmarkArticleIfModified(ctx, id, cached.validators)
+	if err != nil {
+		return "", err
+	}
+	if !modified {
+		article = cached.html
+	}
+	a.articles.put(cachedArticle{id: id, updated: updated, html: article, validators: validators})
+	return article, nil
+}
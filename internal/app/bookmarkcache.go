@@ -0,0 +1,148 @@
+package app
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+// bookmarkCache keeps the metadata of a device's most recently used
+// bookmarks, so that downloads and incremental syncs need not fetch it from
+// Readeck again. A nil cache keeps nothing.
+type bookmarkCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newBookmarkCache(size int) *bookmarkCache {
+	return &bookmarkCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *bookmarkCache) get(id string) (*readeck.Bookmark, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	bookmark := *elem.Value.(*readeck.Bookmark)
+	return &bookmark, true
+}
+
+func (c *bookmarkCache) put(bookmark *readeck.Bookmark) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	copied := *bookmark
+	if elem, ok := c.items[bookmark.ID]; ok {
+		elem.Value = &copied
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[bookmark.ID] = c.order.PushFront(&copied)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*readeck.Bookmark).ID)
+	}
+}
+
+// remove drops bookmark id, so that it is fetched anew.
+func (c *bookmarkCache) remove(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[id]; ok {
+		c.order.Remove(elem)
+		delete(c.items, id)
+	}
+}
+
+// removeOlder drops bookmark id if its cached copy predates a sync event of
+// Readeck at changed.
+func (c *bookmarkCache) removeOlder(id string, changed time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sync events only carry whole seconds.
+	if elem, ok := c.items[id]; ok && elem.Value.(*readeck.Bookmark).Updated.Truncate(time.Second).Before(changed.Truncate(time.Second)) {
+		c.order.Remove(elem)
+		delete(c.items, id)
+	}
+}
+
+func (c *bookmarkCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *bookmarkCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// bookmarkCaches shows the bookmark metadata of every device as one cache on
+// the admin dashboard.
+type bookmarkCaches struct {
+	contexts *userContexts
+}
+
+func (c bookmarkCaches) Name() string {
+	return "Bookmark metadata"
+}
+
+func (c bookmarkCaches) Len() int {
+	n := 0
+	for _, uc := range c.contexts.all() {
+		n += uc.bookmarks.Len()
+	}
+	return n
+}
+
+func (c bookmarkCaches) Invalidate() {
+	for _, uc := range c.contexts.all() {
+		uc.bookmarks.Invalidate()
+	}
+}
+
+// bookmarkDetails returns the metadata of bookmark id, from the device's
+// cache when it has it.
+func (a *App) bookmarkDetails(ctx context.Context, readeckClient *readeck.Client, uc *UserContext, id string) (*readeck.Bookmark, error) {
+	if bookmark, ok := uc.bookmarks.get(id); ok {
+		return bookmark, nil
+	}
+	bookmark, err := readeckClient.GetBookmarkDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	uc.bookmarks.put(bookmark)
+	return bookmark, nil
+}
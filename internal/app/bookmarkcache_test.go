@@ -0,0 +1,103 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestBookmarkCache(t *testing.T) {
+	updated := time.Unix(1700000000, 0)
+	c := newBookmarkCache(2)
+	c.put(&readeck.Bookmark{ID: "1", Updated: updated})
+	c.put(&readeck.Bookmark{ID: "2", Updated: updated})
+	if _, ok := c.get("1"); !ok {
+		t.Fatal("expected bookmark 1 cached")
+	}
+	c.put(&readeck.Bookmark{ID: "3", Updated: updated})
+	if _, ok := c.get("2"); ok {
+		t.Error("expected the least recently used bookmark evicted")
+	}
+
+	c.removeOlder("1", updated)
+	if _, ok := c.get("1"); !ok {
+		t.Error("expected bookmark 1 kept for an event as old as its copy")
+	}
+	c.removeOlder("1", updated.Add(time.Second))
+	if _, ok := c.get("1"); ok {
+		t.Error("expected bookmark 1 dropped for a newer event")
+	}
+
+	var nilCache *bookmarkCache
+	nilCache.put(&readeck.Bookmark{ID: "1"})
+	if _, ok := nilCache.get("1"); ok || nilCache.Len() != 0 {
+		t.Error("expected a nil cache to keep nothing")
+	}
+}
+
+// countingTransport counts the requests made for each method and path.
+type countingTransport struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.count[r.Method+" "+r.URL.Path]++
+	c.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (c *countingTransport) requests(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count[key]
+}
+
+func TestBookmarkCacheSparesDownloads(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "One", Updated: time.Now()}, "<p>One</p>")
+
+	transport := &countingTransport{count: make(map[string]int)}
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, BookmarkCacheSize: 10},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(&http.Client{Transport: transport}),
+	)
+	post := func(handler http.HandlerFunc, path string, req any) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 from %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	post(app.HandleKoboGet, "/api/kobo/get", models.KoboGetRequest{AccessToken: mockDeviceToken})
+	post(app.HandleKoboDownload, "/api/kobo/download", models.KoboDownloadRequest{AccessToken: mockDeviceToken, URL: "https://example.com/1"})
+	if n := transport.requests("GET /api/bookmarks/1"); n != 0 {
+		t.Errorf("expected the download to use the synced metadata, got %d details requests", n)
+	}
+
+	// A change from the device drops the bookmark's metadata.
+	post(app.HandleKoboSend, "/api/kobo/send", models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: []any{map[string]any{"action": "favorite", "item_id": "1"}}})
+	post(app.HandleKoboDownload, "/api/kobo/download", models.KoboDownloadRequest{AccessToken: mockDeviceToken, URL: "https://example.com/1"})
+	post(app.HandleKoboDownload, "/api/kobo/download", models.KoboDownloadRequest{AccessToken: mockDeviceToken, URL: "https://example.com/1"})
+	if n := transport.requests("GET /api/bookmarks/1"); n != 1 {
+		t.Errorf("expected the metadata fetched once after the change, got %d details requests", n)
+	}
+}
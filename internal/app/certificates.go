@@ -0,0 +1,110 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Paths of the certificate authority files on the Kobo's user partition.
+const (
+	caCertPath          = ".adds/readeckobo/readeckobo-ca.pem"
+	caScriptPath        = ".adds/readeckobo/install-ca.sh"
+	caInstructionsPath  = ".adds/readeckobo/INSTALL-CA.txt"
+	caNickelMenuPath    = ".adds/nm/readeckobo-ca"
+	koboCertificatePath = "/etc/ssl/certs/ca-certificates.crt"
+)
+
+// koboCAFiles returns the authority's certificate, a script adding it to the
+// certificates the Kobo trusts, a NickelMenu entry running it and
+// instructions for hosts.
+func koboCAFiles(caPEM []byte, hosts []string) []koboFile {
+	script := fmt.Sprintf(`#!/bin/sh
+# Adds the readeckobo certificate authority to the certificates this Kobo
+# trusts. Generated by readeckobo.
+CA="%s/%s"
+BUNDLE="%s"
+
+grep -qF "$(sed -n 2p "$CA")" "$BUNDLE" || cat "$CA" >> "$BUNDLE"
+sync
+`, koboOnboard, caCertPath, koboCertificatePath)
+
+	menu := fmt.Sprintf(`# Generated by readeckobo.
+menu_item:main:Trust readeckobo certificates:cmd_spawn:quiet:/bin/sh %s/%s
+  chain_success:power:reboot
+`, koboOnboard, caScriptPath)
+
+	instructions := fmt.Sprintf(`readeckobo certificate authority
+================================
+
+readeckobo answers HTTPS requests for these hosts with certificates issued
+by its own certificate authority:
+
+  %s
+
+A Kobo whose DNS points them at readeckobo only accepts those certificates
+once it trusts the authority:
+
+1. Install NickelMenu (https://pgaskin.net/NickelMenu/).
+2. Copy KoboRoot.tgz into the .kobo folder of the Kobo, or extract the zip
+   at the root of its drive, and eject it.
+3. Pick "Trust readeckobo certificates" in the NickelMenu menu. It appends
+   %s to %s and reboots.
+
+Firmware updates replace %s, so repeat step 3 after each one.
+
+Keep the authority's key, ca-key.pem in certs.dir, private: anyone with it
+can impersonate any site to a device trusting the authority.
+`, strings.Join(hosts, "\n  "), caCertPath, koboCertificatePath, koboCertificatePath)
+
+	return []koboFile{
+		{path: caCertPath, mode: 0644, content: string(caPEM)},
+		{path: caScriptPath, mode: 0755, content: script},
+		{path: caNickelMenuPath, mode: 0644, content: menu},
+		{path: caInstructionsPath, mode: 0644, content: instructions},
+	}
+}
+
+// HandleAdminCA serves the certificate of the local certificate authority.
+func (a *App) HandleAdminCA(w http.ResponseWriter, r *http.Request) {
+	if a.Certificates == nil {
+		http.Error(w, "certs.dir is not set", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="readeckobo-ca.pem"`)
+	_, _ = w.Write(a.Certificates.CertPEM())
+}
+
+// HandleAdminCAInstall serves the local certificate authority with the files
+// installing it on a Kobo, as a KoboRoot.tgz or, with ?format=zip, as a zip
+// to extract onto the Kobo's drive.
+func (a *App) HandleAdminCAInstall(w http.ResponseWriter, r *http.Request) {
+	if a.Certificates == nil {
+		http.Error(w, "certs.dir is not set", http.StatusNotFound)
+		return
+	}
+	files := koboCAFiles(a.Certificates.CertPEM(), a.Certificates.Hosts())
+
+	var buf bytes.Buffer
+	var filename, contentType string
+	var err error
+	switch r.FormValue("format") {
+	case "zip":
+		filename, contentType = "readeckobo-ca.zip", "application/zip"
+		err = writeKoboZip(&buf, files)
+	default:
+		filename, contentType = "KoboRoot.tgz", "application/gzip"
+		err = writeKoboRoot(&buf, files)
+	}
+	if err != nil {
+		http.Error(w, "Failed to build the archive", http.StatusInternalServerError)
+		a.Logger.Errorf("Error building %s in /admin/api/ca-install: %v, URL: %s, Params: %v", filename, err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	_, _ = w.Write(buf.Bytes())
+}
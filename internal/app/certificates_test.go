@@ -0,0 +1,84 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/certs"
+	"readeckobo/internal/config"
+)
+
+func TestHandleAdminCA(t *testing.T) {
+	ca, err := certs.Load(t.TempDir(), []string{"storeapi.kobo.com"})
+	if err != nil {
+		t.Fatalf("certs.Load() error = %v", err)
+	}
+
+	testCases := []struct {
+		name         string
+		ca           *certs.Authority
+		expectedCode int
+	}{
+		{name: "authority", ca: ca, expectedCode: http.StatusOK},
+		{name: "no certs.dir", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger), WithCertificates(tc.ca))
+			rr := httptest.NewRecorder()
+			app.HandleAdminCA(rr, httptest.NewRequest(http.MethodGet, "/admin/api/ca.pem", nil))
+
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("expected status %d, got %d", tc.expectedCode, rr.Code)
+			}
+			if tc.ca != nil && !bytes.Equal(rr.Body.Bytes(), ca.CertPEM()) {
+				t.Errorf("expected the authority's certificate, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAdminCAInstall(t *testing.T) {
+	ca, err := certs.Load(t.TempDir(), []string{"storeapi.kobo.com", "getpocket.com"})
+	if err != nil {
+		t.Fatalf("certs.Load() error = %v", err)
+	}
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger), WithCertificates(ca))
+
+	rr := httptest.NewRecorder()
+	app.HandleAdminCAInstall(rr, httptest.NewRequest(http.MethodGet, "/admin/api/ca-install?format=zip", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		content, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	if files[caCertPath] != string(ca.CertPEM()) {
+		t.Errorf("expected the authority's certificate, got %q", files[caCertPath])
+	}
+	if !strings.Contains(files[caScriptPath], koboCertificatePath) {
+		t.Errorf("expected install script, got %q", files[caScriptPath])
+	}
+	if !strings.Contains(files[caNickelMenuPath], "chain_success:power:reboot") {
+		t.Errorf("expected NickelMenu config, got %q", files[caNickelMenuPath])
+	}
+	if !strings.Contains(files[caInstructionsPath], "getpocket.com") {
+		t.Errorf("expected instructions listing the hosts, got %q", files[caInstructionsPath])
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+)
+
+// newReadeckClient returns the shared Readeck client of user, sending the
+// latest token obtained for them.
+func (a *App) newReadeckClient(user *config.User) (*readeck.Client, error) {
+	client, err := a.contexts.get(user).readeckClient(a.buildReadeckClient)
+	if err != nil {
+		return nil, err
+	}
+	if token := a.tokens.readeckToken(user); client.Token() != token {
+		client.SetAccessToken(token)
+	}
+	return client, nil
+}
+
+func (a *App) buildReadeckClient(user *config.User) (*readeck.Client, error) {
+	client, err := readeck.NewClient(a.Config.Readeck.Host, a.tokens.readeckToken(user), a.Logger, a.ReadeckHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	client.DetailConcurrency = a.Config.Readeck.DetailConcurrency
+	client.Timeouts = readeck.Timeouts(a.Config.Readeck.Timeouts)
+	client.StrictDecoding = a.Config.Readeck.StrictDecoding
+	// The device's own limit goes first, so that a device it holds back
+	// does not take up the shared rate meanwhile.
+	if limit := a.Config.Readeck.RateLimit; limit.PerUserRequestsPerSecond > 0 {
+		client.Limiters = append(client.Limiters, readeck.NewRateLimiter(limit.PerUserRequestsPerSecond, limit.PerUserBurst))
+	}
+	if a.readeckLimiter != nil {
+		client.Limiters = append(client.Limiters, a.readeckLimiter)
+	}
+	refreshUser := *user
+	client.TokenRefresher = func(ctx context.Context, rejected string) (string, error) {
+		return a.refreshReadeckToken(ctx, &refreshUser, rejected)
+	}
+	client.TokenAccepted = func() {
+		a.tokens.markAccepted(&refreshUser)
+	}
+	return client, nil
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestNewReadeckClientShared(t *testing.T) {
+	user := config.User{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{user},
+			Readeck: config.ConfigReadeck{Host: "http://readeck.example.com"},
+		}),
+		WithLogger(testLogger),
+	)
+
+	first, err := app.newReadeckClient(&user)
+	if err != nil {
+		t.Fatalf("newReadeckClient failed: %v", err)
+	}
+	second, _ := app.newReadeckClient(&user)
+	if first != second {
+		t.Error("expected the same client for the same device")
+	}
+
+	app.tokens.setToken(&user, "refreshed-token")
+	if client, _ := app.newReadeckClient(&user); client != first || client.Token() != "refreshed-token" {
+		t.Errorf("expected the shared client to send the refreshed token, got %q", client.Token())
+	}
+
+	other := config.User{Token: "other-device", ReadeckAccessToken: "other-token"}
+	if client, _ := app.newReadeckClient(&other); client == first || client.Token() != "other-token" {
+		t.Error("expected a separate client for another device")
+	}
+
+	changed := user
+	changed.Collections = []string{"To Kobo"}
+	if client, _ := app.newReadeckClient(&changed); client == first {
+		t.Error("expected a new client after the user's configuration changed")
+	}
+}
@@ -0,0 +1,322 @@
+package app
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/storeapi"
+)
+
+// defaultCodeLineLength is the longest line of a code block left as text
+// when typography.code_line_length is unset.
+const defaultCodeLineLength = 60
+
+// Limits of the code drawn as images: the lines in one image, so that long
+// blocks are not shrunk to fit the screen, the length of the compressed code
+// in an image URL, beyond which a block is left as text, and the code
+// /api/code accepts.
+const (
+	maxCodeImageLines = 30
+	maxCodeParam      = 4096
+	maxCodeLength     = 64 << 10
+)
+
+// codeFontSize is the size of the text of code images, in pixels.
+const codeFontSize = 20
+
+// codeTabWidth is the number of spaces a tab stands for in code blocks.
+const codeTabWidth = 4
+
+// codeClass marks rewritten code blocks and the images of code.
+const codeClass = "code"
+
+// Long words of code, such as paths and chained calls, are given wrapping
+// hints after the characters of codeBreakAfter.
+const (
+	minCodeBreakWord = 20
+	codeBreakAfter   = "/.,;:=&|([{<>+-_"
+)
+
+// codeFont is parsed once, like placeholderFont.
+var codeFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(gomono.TTF)
+})
+
+// rewriteCodeBlocks rewrites the pre elements of an article, which the
+// device's renderer does not wrap, for typography.code_blocks. imageURL
+// returns the URL of an image of code, or "" when the code is too long for
+// one.
+func rewriteCodeBlocks(doc *html.Node, typography config.Typography, imageURL func(code string) string) {
+	if typography.CodeBlocks == "" {
+		return
+	}
+	maxLine := typography.CodeLineLength
+	if maxLine <= 0 {
+		maxLine = defaultCodeLineLength
+	}
+
+	var blocks []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Pre {
+			blocks = append(blocks, n)
+		}
+	})
+	for _, pre := range blocks {
+		if pre.Parent == nil {
+			continue
+		}
+		lines := codeLines(pre)
+		var block *html.Node
+		if typography.CodeBlocks == "image" && slices.ContainsFunc(lines, func(line string) bool { return utf8.RuneCountInString(line) > maxLine }) {
+			block = codeImages(lines, imageURL)
+		}
+		if block == nil {
+			block = wrappedCode(lines)
+		}
+		pre.Parent.InsertBefore(block, pre)
+		pre.Parent.RemoveChild(pre)
+	}
+}
+
+// codeLines returns the lines of a code block, with tabs expanded and the
+// line breaks after its opening tag and before its closing tag dropped.
+func codeLines(pre *html.Node) []string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				b.WriteString(c.Data)
+			case c.DataAtom == atom.Br:
+				b.WriteByte('\n')
+			default:
+				collect(c)
+			}
+		}
+	}
+	collect(pre)
+
+	code := strings.ReplaceAll(b.String(), "\r\n", "\n")
+	code = strings.TrimPrefix(code, "\n")
+	code = strings.TrimSuffix(code, "\n")
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	return lines
+}
+
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := codeTabWidth - column%codeTabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// wrappedCode sets lines as monospace text that wraps: indentation and runs
+// of spaces are kept with non-breaking spaces, lines end with br elements,
+// and long words may break after punctuation.
+func wrappedCode(lines []string) *html.Node {
+	div := &html.Node{Type: html.ElementNode, DataAtom: atom.Div, Data: atom.Div.String()}
+	setAttr(div, "class", codeClass)
+	setAttr(div, "style", "font-family: monospace")
+	code := &html.Node{Type: html.ElementNode, DataAtom: atom.Code, Data: atom.Code.String()}
+	div.AppendChild(code)
+
+	for i, line := range lines {
+		if i > 0 {
+			code.AppendChild(&html.Node{Type: html.ElementNode, DataAtom: atom.Br, Data: atom.Br.String()})
+		}
+		appendCodeLine(code, line)
+	}
+	return div
+}
+
+func appendCodeLine(code *html.Node, line string) {
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			code.AppendChild(&html.Node{Type: html.TextNode, Data: text.String()})
+			text.Reset()
+		}
+	}
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		if runes[i] == ' ' {
+			// A single space between words may break the line; other
+			// spaces are kept.
+			if i > 0 && i+1 < len(runes) && runes[i-1] != ' ' && runes[i+1] != ' ' {
+				text.WriteRune(' ')
+			} else {
+				text.WriteRune('\u00a0')
+			}
+			i++
+			continue
+		}
+		end := i
+		for end < len(runes) && runes[end] != ' ' {
+			end++
+		}
+		word := runes[i:end]
+		for j, r := range word {
+			text.WriteRune(r)
+			if len(word) >= minCodeBreakWord && j+1 < len(word) && strings.ContainsRune(codeBreakAfter, r) {
+				flush()
+				code.AppendChild(&html.Node{Type: html.ElementNode, DataAtom: atom.Wbr, Data: atom.Wbr.String()})
+			}
+		}
+		i = end
+	}
+	flush()
+}
+
+// codeImages replaces a code block with images of its lines, or returns nil
+// when imageURL has no URL for some of them.
+func codeImages(lines []string, imageURL func(code string) string) *html.Node {
+	div := &html.Node{Type: html.ElementNode, DataAtom: atom.Div, Data: atom.Div.String()}
+	setAttr(div, "class", codeClass)
+	for chunk := range slices.Chunk(lines, maxCodeImageLines) {
+		src := imageURL(strings.Join(chunk, "\n"))
+		if src == "" {
+			return nil
+		}
+		img := &html.Node{Type: html.ElementNode, DataAtom: atom.Img, Data: atom.Img.String()}
+		setAttr(img, "src", src)
+		setAttr(img, "class", codeClass)
+		div.AppendChild(img)
+	}
+	return div
+}
+
+// isCodeImage reports whether img is the image of a code block.
+func isCodeImage(img *html.Node) bool {
+	return slices.Contains(strings.Fields(getAttr(img, "class")), codeClass)
+}
+
+// renderCode draws lines of code in a monospace font, black on white within
+// a gray border.
+func renderCode(lines []string) (*image.RGBA, error) {
+	f, err := codeFont()
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: codeFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = face.Close() }()
+
+	var width int
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	lineHeight := face.Metrics().Height.Ceil()
+	pad := codeFontSize / 2
+	img := image.NewRGBA(image.Rect(0, 0, width+2*pad, len(lines)*lineHeight+2*pad))
+	draw.Draw(img, img.Bounds(), image.NewUniform(placeholderBorder), image.Point{}, draw.Src)
+	draw.Draw(img, img.Bounds().Inset(1), image.White, image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img, Src: image.Black, Face: face}
+	y := pad + face.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		drawer.Dot = fixed.P(pad, y)
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+	return img, nil
+}
+
+// codeImageURL points at /api/code for an image of code, which is passed
+// compressed. It returns "" when the code is too long for a URL.
+func (a *App) codeImageURL(r *http.Request, code string) string {
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return ""
+	}
+	if _, err := io.WriteString(zw, code); err != nil {
+		return ""
+	}
+	if err := zw.Close(); err != nil {
+		return ""
+	}
+	param := base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	if len(param) > maxCodeParam {
+		return ""
+	}
+	return a.bridgeURL(r) + storeapi.InstapaperPath + "/api/code?" + url.Values{"c": {param}}.Encode()
+}
+
+// decodeCodeParam reverses codeImageURL's encoding of code.
+func decodeCodeParam(param string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(param)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode code: %w", err)
+	}
+	zr := flate.NewReader(bytes.NewReader(data))
+	defer func() { _ = zr.Close() }()
+	code, err := io.ReadAll(io.LimitReader(zr, maxCodeLength+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress code: %w", err)
+	}
+	if len(code) > maxCodeLength {
+		return "", errors.New("code too long")
+	}
+	return string(code), nil
+}
+
+// HandleCode draws the code in the c parameter, for the code blocks replaced
+// with images in downloaded articles.
+func (a *App) HandleCode(w http.ResponseWriter, r *http.Request) {
+	param := r.URL.Query().Get("c")
+	if param == "" {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'c' parameter")
+		return
+	}
+	code, err := decodeCodeParam(param)
+	if err != nil {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid 'c' parameter")
+		return
+	}
+
+	img, err := renderCode(strings.Split(code, "\n"))
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to render code")
+		a.Logger.Errorf("Error rendering code in /api/code: %v, URL: %s", err, r.URL.Path)
+		return
+	}
+	a.writeDrawnImage(w, r, img, "/api/code")
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+func TestRewriteCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		typography config.Typography
+		noImages   bool
+		input      string
+		expected   string
+	}{
+		{
+			name:       "off",
+			typography: config.Typography{},
+			input:      "<pre>x  = 1</pre>",
+			expected:   "<pre>x  = 1</pre>",
+		},
+		{
+			name:       "wrap",
+			typography: config.Typography{CodeBlocks: "wrap"},
+			input:      "<pre><code>\nif x {\n\t<span>y</span>  = 1\n}\n</code></pre>",
+			expected:   `<div class="code" style="font-family: monospace"><code>if x {<br/>` + "\u00a0\u00a0\u00a0\u00a0y\u00a0\u00a0= 1<br/>}</code></div>",
+		},
+		{
+			name:       "wrapping hints in long words",
+			typography: config.Typography{CodeBlocks: "wrap"},
+			input:      "<pre>see github.com/eleith/readeckobo ok</pre>",
+			expected:   `<div class="code" style="font-family: monospace"><code>see github.<wbr/>com/<wbr/>eleith/<wbr/>readeckobo ok</code></div>`,
+		},
+		{
+			name:       "image for long lines",
+			typography: config.Typography{CodeBlocks: "image", CodeLineLength: 10},
+			input:      "<pre>short\na line longer than ten</pre>",
+			expected:   `<div class="code"><img src="code:short|a line longer than ten" class="code"/></div>`,
+		},
+		{
+			name:       "short lines stay text",
+			typography: config.Typography{CodeBlocks: "image"},
+			input:      "<pre>short</pre>",
+			expected:   `<div class="code" style="font-family: monospace"><code>short</code></div>`,
+		},
+		{
+			name:       "too long for an image",
+			typography: config.Typography{CodeBlocks: "image", CodeLineLength: 1},
+			noImages:   true,
+			input:      "<pre>ab</pre>",
+			expected:   `<div class="code" style="font-family: monospace"><code>ab</code></div>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("failed to parse HTML: %v", err)
+			}
+			rewriteCodeBlocks(doc, tt.typography, func(code string) string {
+				if tt.noImages {
+					return ""
+				}
+				return "code:" + strings.ReplaceAll(code, "\n", "|")
+			})
+
+			var buf bytes.Buffer
+			for c := findElement(doc, atom.Body).FirstChild; c != nil; c = c.NextSibling {
+				if err := html.Render(&buf, c); err != nil {
+					t.Fatalf("failed to render HTML: %v", err)
+				}
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestHandleCode(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(logger.New(logger.DEBUG)))
+	code := "func main() {\n\tfmt.Println(\"a line of code that is far too long for the screen\")\n}"
+	imageURL, err := url.Parse(app.codeImageURL(httptest.NewRequest(http.MethodGet, "/api/kobo/download", nil), code))
+	if err != nil {
+		t.Fatalf("failed to parse image URL: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "code", query: "?" + imageURL.RawQuery, status: http.StatusOK},
+		{name: "missing code", query: "", status: http.StatusBadRequest},
+		{name: "invalid code", query: "?c=not-flate", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.HandleCode(rr, httptest.NewRequest(http.MethodGet, "/api/code"+tt.query, nil))
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			img, err := png.Decode(rr.Body)
+			if err != nil {
+				t.Fatalf("failed to decode PNG: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() <= b.Dy() {
+				t.Errorf("expected a wide image for a long line, got %v", b)
+			}
+		})
+	}
+}
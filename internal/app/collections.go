@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// collectionTagPrefix marks the Pocket tags made from Readeck collections.
+const collectionTagPrefix = "collection:"
+
+// collectionMember is a bookmark along with the names of the collections
+// that include it.
+type collectionMember struct {
+	bookmark readeck.Bookmark
+	names    []string
+}
+
+// loadCollections lists the bookmarks of the user's collections, keyed by
+// bookmark ID. Only the wanted collections are listed unless all is set.
+func (a *App) loadCollections(ctx context.Context, readeckClient *readeck.Client, wanted []string, all bool) (map[string]*collectionMember, error) {
+	collections, err := readeckClient.GetCollections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collections: %w", err)
+	}
+
+	members := make(map[string]*collectionMember)
+	for _, collection := range collections {
+		if collection.IsDeleted || (!all && !inCollections([]string{collection.Name}, wanted)) {
+			continue
+		}
+
+		opts := readeck.ListBookmarksOptions{Collection: collection.ID, Limit: fullSyncPageSize, Sort: fullSyncSort}
+		for {
+			bookmarks, total, err := readeckClient.ListBookmarks(ctx, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list collection %q: %w", collection.Name, err)
+			}
+			for i := range bookmarks {
+				member, ok := members[bookmarks[i].ID]
+				if !ok {
+					member = &collectionMember{bookmark: bookmarks[i]}
+					members[bookmarks[i].ID] = member
+				}
+				member.names = append(member.names, collection.Name)
+			}
+
+			opts.Offset += len(bookmarks)
+			if len(bookmarks) == 0 || opts.Offset >= total {
+				break
+			}
+		}
+	}
+	a.Logger.Debugf("Loaded %d bookmarks from Readeck collections.", len(members))
+
+	return members, nil
+}
+
+// inCollections reports whether any of names is one of the wanted collection
+// names, ignoring case.
+func inCollections(names, wanted []string) bool {
+	for _, name := range names {
+		if slices.ContainsFunc(wanted, func(w string) bool { return strings.EqualFold(w, name) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCollectionFullSync is a full sync limited to the bookmarks of the
+// wanted collections in the requested state. The Kobo's count and offset
+// page through those bookmarks alone, newest first.
+func (a *App) handleCollectionFullSync(ctx context.Context, readeckClient *readeck.Client, req *models.KoboGetRequest, members map[string]*collectionMember, wanted []string) (map[string]models.KoboArticleItem, int, error) {
+	count, _ := strconv.Atoi(req.Count)
+	offset, _ := strconv.Atoi(req.Offset)
+
+	isArchived := archiveFilter(req.State)
+	var bookmarks []*readeck.Bookmark
+	for _, member := range members {
+		if (isArchived == nil || member.bookmark.IsArchived == *isArchived) && inCollections(member.names, wanted) && !a.excludedKind(&member.bookmark) {
+			bookmarks = append(bookmarks, &member.bookmark)
+		}
+	}
+	slices.SortFunc(bookmarks, func(x, y *readeck.Bookmark) int {
+		if c := y.Created.Compare(x.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(x.ID, y.ID)
+	})
+
+	total := len(bookmarks)
+	bookmarks = bookmarks[min(max(offset, 0), total):]
+	if count > 0 {
+		bookmarks = bookmarks[:min(count, len(bookmarks))]
+	}
+
+	resultList := make(map[string]models.KoboArticleItem)
+	synced := time.Now()
+	for _, bookmark := range bookmarks {
+		entry, ok := a.syncItem(bookmark, synced)
+		if !ok {
+			continue
+		}
+		entry.Status = itemStatus(bookmark)
+		resultList[entry.ItemID] = entry
+	}
+
+	a.fillWordCounts(ctx, readeckClient, resultList)
+	a.attachAnnotations(ctx, readeckClient, resultList)
+
+	return resultList, total, nil
+}
+
+// applyCollections tags the items in resultList with their collections when
+// tag is set, and turns items outside the wanted collections into deletions
+// so they leave the device. It returns how many unarchived items it removed.
+func applyCollections(resultList map[string]models.KoboArticleItem, members map[string]*collectionMember, wanted []string, tag bool) int {
+	removed := 0
+	for id, entry := range resultList {
+		if entry.Status == "2" {
+			continue
+		}
+		var names []string
+		if member, ok := members[id]; ok {
+			names = member.names
+		}
+
+		if len(wanted) > 0 && !inCollections(names, wanted) {
+			if entry.Status == "0" {
+				removed++
+			}
+			resultList[id] = models.KoboArticleItem{ItemID: id, Status: "2"}
+			continue
+		}
+
+		if tag && len(names) > 0 {
+			if entry.Tags == nil {
+				entry.Tags = make(map[string]models.KoboTag)
+			}
+			for _, name := range names {
+				entry.Tags[collectionTagPrefix+name] = models.KoboTag{ItemID: id, Tag: collectionTagPrefix + name}
+			}
+			resultList[id] = entry
+		}
+	}
+	return removed
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+func TestHandleKoboGetCollections(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	collections := map[string][]readeck.Bookmark{
+		"c1": {
+			{ID: "b1", Title: "Older", Created: day, WordCount: 100},
+			{ID: "b2", Title: "Newer", Created: day.Add(time.Hour), WordCount: 100},
+			{ID: "b3", Title: "Archived", Created: day, IsArchived: true, WordCount: 100},
+		},
+		"c2": {
+			{ID: "b2", Title: "Newer", Created: day.Add(time.Hour), WordCount: 100},
+			{ID: "b4", Title: "Elsewhere", Created: day, WordCount: 100},
+		},
+	}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/bookmarks/collections":
+			_ = json.NewEncoder(w).Encode([]readeck.Collection{
+				{ID: "c1", Name: "To Kobo"},
+				{ID: "c2", Name: "Later"},
+				{ID: "c3", Name: "Gone", IsDeleted: true},
+			})
+		case "/api/bookmarks":
+			bookmarks, ok := collections[r.URL.Query().Get("collection")]
+			if !ok {
+				t.Errorf("unexpected bookmark list %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode(bookmarks)
+		case "/api/bookmarks/b1/annotations", "/api/bookmarks/b2/annotations", "/api/bookmarks/b4/annotations":
+			_ = json.NewEncoder(w).Encode([]readeck.Annotation{})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken, Collections: []string{"to kobo"}}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, CollectionTags: true},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken, Count: "1", Offset: "1"})
+	req := httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	app.HandleKoboGet(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp models.KoboGetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Total != 2 {
+		t.Errorf("expected a total of 2 unarchived bookmarks in the collection, got %d", resp.Total)
+	}
+	item, ok := resp.List["b1"]
+	if len(resp.List) != 1 || !ok {
+		t.Fatalf("expected only the second newest bookmark b1, got %+v", resp.List)
+	}
+	if _, ok := item.Tags["collection:To Kobo"]; !ok {
+		t.Errorf("expected a collection tag, got %+v", item.Tags)
+	}
+}
+
+func TestApplyCollections(t *testing.T) {
+	members := map[string]*collectionMember{
+		"1": {names: []string{"To Kobo", "Later"}},
+		"2": {names: []string{"Later"}},
+	}
+	resultList := map[string]models.KoboArticleItem{
+		"1": {ItemID: "1", Status: "0"},
+		"2": {ItemID: "2", Status: "0"},
+		"3": {ItemID: "3", Status: "1"},
+		"4": {ItemID: "4", Status: "2"},
+	}
+
+	removed := applyCollections(resultList, members, []string{"To Kobo"}, true)
+
+	if removed != 1 {
+		t.Errorf("expected 1 unarchived item removed, got %d", removed)
+	}
+	if len(resultList["1"].Tags) != 2 {
+		t.Errorf("expected item 1 tagged with both collections, got %+v", resultList["1"].Tags)
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		if resultList[id].Status != "2" {
+			t.Errorf("expected item %s to be deleted from the device, got status %q", id, resultList[id].Status)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// conflictFields are the bookmark fields that device actions set and that
+// can also be changed in Readeck.
+var conflictFields = []string{"is_archived", "is_marked"}
+
+// syncedState is the archive and favorite state of an item as the device
+// last saw it.
+type syncedState struct {
+	archived bool
+	marked   bool
+}
+
+// value returns the state of field.
+func (s syncedState) value(field string) bool {
+	if field == "is_archived" {
+		return s.archived
+	}
+	return s.marked
+}
+
+// bookmarkState returns the state of a bookmark in Readeck.
+func bookmarkState(bookmark *readeck.Bookmark) syncedState {
+	return syncedState{archived: bookmark.IsArchived, marked: bookmark.IsMarked}
+}
+
+// recordItems notes the state of the items of a sync response, which the
+// device shows from then on.
+func (uc *UserContext) recordItems(list map[string]models.KoboArticleItem) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.synced == nil {
+		uc.synced = make(map[string]syncedState)
+	}
+	for id, item := range list {
+		if item.Status == "2" {
+			delete(uc.synced, id)
+			continue
+		}
+		uc.synced[id] = syncedState{archived: item.Status == "1", marked: item.Favorite == "1"}
+	}
+}
+
+// recordSent notes the changes of ops that reached Readeck or the action
+// queue, as they came from what the device shows.
+func (uc *UserContext) recordSent(ops []*sendOp) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	for _, op := range ops {
+		if op.update == nil || op.err != nil {
+			continue
+		}
+		state, ok := uc.synced[op.itemID]
+		if !ok {
+			continue
+		}
+		if op.update["is_deleted"] == true {
+			delete(uc.synced, op.itemID)
+			continue
+		}
+		if v, ok := op.update["is_archived"].(bool); ok {
+			state.archived = v
+		}
+		if v, ok := op.update["is_marked"].(bool); ok {
+			state.marked = v
+		}
+		uc.synced[op.itemID] = state
+	}
+}
+
+// syncedItem returns the state of itemID as the device last saw it, and
+// false if it is not known.
+func (uc *UserContext) syncedItem(itemID string) (syncedState, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	state, ok := uc.synced[itemID]
+	return state, ok
+}
+
+// resolveConflicts applies conflicts.policy to the updates of a
+// /api/kobo/send request. An update conflicts when its bookmark was updated
+// in Readeck after the device last synced, and sets a field to other than
+// what Readeck changed it to, or deletes the bookmark, since the device saw
+// it. Items the device has not synced since readeckobo started cannot be
+// told apart from plain changes, and are left alone. Every conflict is
+// logged with how it was resolved. Updates left empty are dropped, their
+// actions succeeding with the bookmark as Readeck has it.
+func (a *App) resolveConflicts(ctx context.Context, readeckClient *readeck.Client, uc *UserContext, actions []any, ops []*sendOp, opOf []int) []*sendOp {
+	policy := a.Config.Conflicts.Policy
+	now := time.Now()
+	changedAt := make([]time.Time, len(ops))
+	for i, actionInterface := range actions {
+		actionMap, ok := actionInterface.(map[string]any)
+		if !ok || opOf[i] < 0 {
+			continue
+		}
+		if at := actionTime(actionMap, now); at.After(changedAt[opOf[i]]) {
+			changedAt[opOf[i]] = at
+		}
+	}
+	lastSync := uc.LastSync()
+
+	// The bookmarks the device has synced are fetched together.
+	synced := make([]syncedState, len(ops))
+	known := make([]bool, len(ops))
+	var ids []string
+	for index, op := range ops {
+		if op.update == nil {
+			continue
+		}
+		if synced[index], known[index] = uc.syncedItem(op.itemID); known[index] {
+			ids = append(ids, op.itemID)
+		}
+	}
+	var bookmarks map[string]*readeck.Bookmark
+	if len(ids) > 0 {
+		var err error
+		if bookmarks, err = readeckClient.SyncBookmarksContent(ctx, ids); err != nil {
+			a.Logger.Warnf("Error fetching %d bookmarks to look for conflicts in /api/kobo/send: %v", len(ids), err)
+			clear(known)
+		}
+	}
+
+	for index, op := range ops {
+		if !known[index] {
+			continue
+		}
+		bookmark, ok := bookmarks[op.itemID]
+		if !ok {
+			a.Logger.Warnf("Bookmark %s missing from Readeck's answer, not looking for conflicts in /api/kobo/send", op.itemID)
+			continue
+		}
+		current := bookmarkState(bookmark)
+		if !bookmark.Updated.After(lastSync) || current == synced[index] {
+			continue
+		}
+
+		keepDevice := policy == "device-wins" || policy == "merge" && changedAt[index].After(bookmark.Updated)
+		winner := "Readeck"
+		if keepDevice {
+			winner = "the device"
+		}
+		if op.update["is_deleted"] == true {
+			a.Logger.Infof("Sync conflict on bookmark %s: deleted on the device at %s, changed in Readeck at %s; %s keeps %s",
+				op.itemID, changedAt[index].Format(time.RFC3339), bookmark.Updated.Format(time.RFC3339), policy, winner)
+			if !keepDevice {
+				op.update = map[string]any{}
+			}
+			continue
+		}
+		for _, field := range conflictFields {
+			value, ok := op.update[field].(bool)
+			if !ok || value == current.value(field) || synced[index].value(field) == current.value(field) {
+				continue
+			}
+			a.Logger.Infof("Sync conflict on bookmark %s: %s set to %v on the device at %s, to %v in Readeck at %s; %s keeps %s",
+				op.itemID, field, value, changedAt[index].Format(time.RFC3339), current.value(field), bookmark.Updated.Format(time.RFC3339), policy, winner)
+			if !keepDevice {
+				delete(op.update, field)
+			}
+		}
+	}
+
+	kept := ops[:0]
+	newIndex := make([]int, len(ops))
+	for i, op := range ops {
+		newIndex[i] = -1
+		if op.update != nil && len(op.update) == 0 {
+			continue
+		}
+		newIndex[i] = len(kept)
+		kept = append(kept, op)
+	}
+	for i, index := range opOf {
+		if index >= 0 {
+			opOf[i] = newIndex[index]
+		}
+	}
+	return kept
+}
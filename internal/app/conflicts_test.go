@@ -0,0 +1,130 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestHandleKoboSendResolvesConflicts(t *testing.T) {
+	tests := []struct {
+		policy string
+		// later sends the device's actions after the Readeck changes.
+		later      bool
+		wantDelete bool
+		wantUnread bool
+	}{
+		{policy: "device-wins", wantDelete: true, wantUnread: true},
+		{policy: "server-wins", later: true},
+		{policy: "merge"},
+		{policy: "merge", later: true, wantDelete: true, wantUnread: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+map[bool]string{true: " later"}[tt.later], func(t *testing.T) {
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			for _, id := range []string{"1", "2", "3"} {
+				mockServer.AddBookmark(readeck.Bookmark{ID: id, URL: "https://example.com/" + id}, "")
+			}
+
+			transport := &countingTransport{count: make(map[string]int)}
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:     []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck:   config.ConfigReadeck{Host: mockServer.URL},
+					Conflicts: config.ConfigConflicts{Policy: tt.policy},
+				}),
+				WithLogger(testLogger),
+				WithReadeckHTTPClient(&http.Client{Transport: transport}),
+			)
+			body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+			rr := httptest.NewRecorder()
+			app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+
+			// Readeck changes every bookmark after the sync.
+			changed := time.Now().Add(time.Hour)
+			mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", IsMarked: true, Updated: changed}, "")
+			mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2", IsArchived: true, Updated: changed}, "")
+			mockServer.AddBookmark(readeck.Bookmark{ID: "3", URL: "https://example.com/3", IsArchived: true, Updated: changed}, "")
+
+			at := strconv.FormatInt(changed.Add(-time.Minute).Unix(), 10)
+			if tt.later {
+				at = strconv.FormatInt(changed.Add(time.Minute).Unix(), 10)
+			}
+			body, _ = json.Marshal(models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: []any{
+				map[string]any{"action": "delete", "item_id": "1", "time": at},
+				map[string]any{"action": "favorite", "item_id": "2", "time": at},
+				map[string]any{"action": "archive", "item_id": "3", "time": at},
+				map[string]any{"action": "readd", "item_id": "3", "time": at},
+			}})
+			rr = httptest.NewRecorder()
+			app.HandleKoboSend(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+			var resp models.KoboSendResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !resp.Status {
+				t.Errorf("expected every action to succeed, got %+v", resp)
+			}
+			// The updated bookmarks are fetched together, not one by one.
+			if got := transport.requests("POST /api/bookmarks/sync"); got != 1 {
+				t.Errorf("expected one bookmark sync request, got %d", got)
+			}
+			for _, id := range []string{"1", "2", "3"} {
+				if got := transport.requests("GET /api/bookmarks/" + id); got != 0 {
+					t.Errorf("expected no details request for bookmark %s, got %d", id, got)
+				}
+			}
+
+			if _, ok := mockServer.Bookmark("1"); ok == tt.wantDelete {
+				t.Errorf("expected bookmark 1 deleted %v, got %v", tt.wantDelete, !ok)
+			}
+			// The favorite does not conflict with the archive in Readeck.
+			if bookmark, _ := mockServer.Bookmark("2"); !bookmark.IsMarked || !bookmark.IsArchived {
+				t.Errorf("expected bookmark 2 archived and favorite, got %+v", bookmark)
+			}
+			if bookmark, _ := mockServer.Bookmark("3"); bookmark.IsArchived == tt.wantUnread {
+				t.Errorf("expected bookmark 3 unread %v, got archived %v", tt.wantUnread, bookmark.IsArchived)
+			}
+		})
+	}
+}
+
+func TestHandleKoboSendWithoutConflicts(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:     []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck:   config.ConfigReadeck{Host: mockServer.URL},
+			Conflicts: config.ConfigConflicts{Policy: "server-wins"},
+		}),
+		WithLogger(testLogger),
+	)
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+	app.HandleKoboGet(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+
+	// Archiving then unarchiving from the device changes only what the
+	// device saw, which server-wins leaves to the device.
+	for _, action := range []string{"archive", "readd", "archive"} {
+		body, _ = json.Marshal(models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: []any{map[string]any{"action": action, "item_id": "1"}}})
+		app.HandleKoboSend(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+	}
+	if bookmark, _ := mockServer.Bookmark("1"); !bookmark.IsArchived {
+		t.Error("expected bookmark 1 archived")
+	}
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// consumerKeyUnknown counts the requests whose consumer key is not one of
+// consumer_keys.keys.
+const consumerKeyUnknown = "unknown"
+
+// checkConsumerKey checks the consumer key of a Pocket API request against
+// consumer_keys, counting it by the name of the firmware that sends it. It
+// reports whether the request may go on, and answers it otherwise.
+func (a *App) checkConsumerKey(w http.ResponseWriter, r *http.Request, key string) bool {
+	cfg := a.Config.ConsumerKeys
+	if cfg.Mode == "" || cfg.Mode == "off" {
+		return true
+	}
+	for name, known := range cfg.Keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(known)) == 1 {
+			a.Logger.Debugf("Consumer key of %s in %s", name, r.URL.Path)
+			a.consumerKeys.count(name)
+			return true
+		}
+	}
+
+	a.consumerKeys.count(consumerKeyUnknown)
+	if cfg.Mode != "enforce" {
+		a.Logger.Warnf("Unknown consumer key %q, URL: %s, Params: %v", key, r.URL.Path, r.URL.Query())
+		return true
+	}
+	writeKoboError(w, http.StatusForbidden, pocketErrConsumerKey, "Invalid consumer key.")
+	a.Logger.Warnf("Rejected unknown consumer key %q, URL: %s, Params: %v", key, r.URL.Path, r.URL.Query())
+	return false
+}
+
+// ConsumerKeys counts the checked Pocket API requests by the name of their
+// consumer key, for metrics.
+func (a *App) ConsumerKeys() map[string]uint64 {
+	return a.consumerKeys.snapshot()
+}
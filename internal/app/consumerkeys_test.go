@@ -0,0 +1,56 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestCheckConsumerKey(t *testing.T) {
+	keys := map[string]string{"kobo_4": "12345-abcdef"}
+
+	testCases := []struct {
+		name           string
+		mode           string
+		consumerKey    string
+		expectedStatus int
+		expectedCount  string
+	}{
+		{name: "off", consumerKey: "foreign", expectedStatus: http.StatusOK},
+		{name: "log known key", mode: "log", consumerKey: "12345-abcdef", expectedStatus: http.StatusOK, expectedCount: "kobo_4"},
+		{name: "log unknown key", mode: "log", consumerKey: "foreign", expectedStatus: http.StatusOK, expectedCount: consumerKeyUnknown},
+		{name: "enforce known key", mode: "enforce", consumerKey: "12345-abcdef", expectedStatus: http.StatusOK, expectedCount: "kobo_4"},
+		{name: "enforce unknown key", mode: "enforce", consumerKey: "foreign", expectedStatus: http.StatusForbidden, expectedCount: consumerKeyUnknown},
+		{name: "enforce missing key", mode: "enforce", expectedStatus: http.StatusForbidden, expectedCount: consumerKeyUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := NewApp(WithConfig(&config.Config{ConsumerKeys: config.ConfigConsumerKeys{Mode: tc.mode, Keys: keys}}), WithLogger(testLogger))
+
+			form := url.Values{"consumer_key": {tc.consumerKey}}
+			req := httptest.NewRequest(http.MethodPost, "/v3/oauth/request", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			app.HandlePocketOAuthRequest(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, rr.Code)
+			}
+			if tc.expectedStatus == http.StatusForbidden && rr.Header().Get("X-Error-Code") != "152" {
+				t.Errorf("expected Pocket error 152, got %q", rr.Header().Get("X-Error-Code"))
+			}
+			counts := app.ConsumerKeys()
+			if tc.expectedCount == "" && len(counts) != 0 {
+				t.Errorf("expected no counts, got %v", counts)
+			}
+			if tc.expectedCount != "" && counts[tc.expectedCount] != 1 {
+				t.Errorf("expected one %s request, got %v", tc.expectedCount, counts)
+			}
+		})
+	}
+}
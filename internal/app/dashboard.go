@@ -0,0 +1,162 @@
+package app
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"readeckobo/internal/capture"
+	"readeckobo/internal/logger"
+	"readeckobo/internal/readeck"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// Cache is a cache shown on the admin dashboard, where it can be emptied.
+type Cache interface {
+	Name() string
+	Len() int
+	Invalidate()
+}
+
+// RegisterCache adds cache to the admin dashboard.
+func (a *App) RegisterCache(cache Cache) {
+	a.caches = append(a.caches, cache)
+}
+
+type dashboardUser struct {
+	userHealth
+	Index       int
+	ReadeckUser string
+	// Kobo describes the device model, firmware and serial last seen.
+	Kobo      string
+	LastSync  time.Time
+	Stats     deviceStats
+	ImageData string
+}
+
+type dashboardCache struct {
+	Name    string
+	Entries int
+}
+
+type dashboardData struct {
+	Message string
+	Users   []dashboardUser
+	// Total sums the statistics of every device and the converted images.
+	Total          deviceStats
+	TotalImageData string
+	Caches         []dashboardCache
+	Errors         []logger.Entry
+}
+
+// HandleDashboard renders the admin dashboard.
+func (a *App) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	a.renderDashboard(w, r, "")
+}
+
+// HandleDashboardTestReadeck lists one bookmark with the Readeck token of the
+// selected user, to check that Readeck is reachable and accepts the token.
+func (a *App) HandleDashboardTestReadeck(w http.ResponseWriter, r *http.Request) {
+	users := a.users()
+	index, err := strconv.Atoi(r.FormValue("user"))
+	if err != nil || index < 0 || index >= len(users) {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+	user := &users[index]
+
+	client, err := a.newReadeckClient(user)
+	if err != nil {
+		a.renderDashboard(w, r, "Failed to initialize Readeck client: "+err.Error())
+		return
+	}
+	_, total, err := client.ListBookmarks(r.Context(), readeck.ListBookmarksOptions{Limit: 1})
+	if err != nil {
+		a.Logger.Errorf("Error testing Readeck for device %s in /admin/test-readeck: %v, URL: %s, Params: %v", maskToken(user.Token), err, r.URL.Path, r.URL.Query())
+		a.renderDashboard(w, r, "Readeck call failed for device "+maskToken(user.Token)+": "+err.Error())
+		return
+	}
+	a.renderDashboard(w, r, "Readeck responded for device "+maskToken(user.Token)+" with "+strconv.Itoa(total)+" bookmarks.")
+}
+
+// HandleDashboardInvalidateCaches empties every registered cache, or only
+// the sync responses of the selected user.
+func (a *App) HandleDashboardInvalidateCaches(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("user") != "" {
+		users := a.users()
+		index, err := strconv.Atoi(r.FormValue("user"))
+		if err != nil || index < 0 || index >= len(users) {
+			http.Error(w, "Invalid user", http.StatusBadRequest)
+			return
+		}
+		a.invalidateSyncResponses(users[index].Token)
+		a.Logger.Infof("Invalidated the sync responses of device %s from the admin dashboard.", maskToken(users[index].Token))
+		a.renderDashboard(w, r, "Sync responses of device "+maskToken(users[index].Token)+" invalidated.")
+		return
+	}
+	for _, cache := range a.caches {
+		cache.Invalidate()
+	}
+	a.Logger.Infof("Invalidated %d caches from the admin dashboard.", len(a.caches))
+	a.renderDashboard(w, r, "Caches invalidated.")
+}
+
+func (a *App) renderDashboard(w http.ResponseWriter, r *http.Request, message string) {
+	data := dashboardData{Message: message, Errors: a.Logger.RecentErrors()}
+	health := a.usersHealth()
+	// Users are only ever appended, so this snapshot covers every health entry.
+	users := a.users()
+	for i, health := range health {
+		user := users[i]
+		stats := a.stats.get(user.Token)
+		device, seen := a.devices.get(user.Token)
+		data.Users = append(data.Users, dashboardUser{
+			userHealth:  health,
+			Index:       i,
+			ReadeckUser: user.ReadeckUsername,
+			Kobo:        describeDevice(device, seen),
+			LastSync:    a.lastSync(user.Token),
+			Stats:       stats,
+			ImageData:   formatBytes(stats.ImageBytesServed),
+		})
+	}
+	data.Total = a.stats.total()
+	data.TotalImageData = formatBytes(data.Total.ImageBytesServed)
+	for _, cache := range a.caches {
+		data.Caches = append(data.Caches, dashboardCache{Name: cache.Name(), Entries: cache.Len()})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "dashboard.html", data); err != nil {
+		a.Logger.Errorf("Error rendering dashboard in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+	}
+}
+
+type requestsData struct {
+	// Enabled is false when capture.recent is 0.
+	Enabled  bool
+	Captures []*capture.Capture
+}
+
+// HandleDashboardRequests shows the last Kobo requests, their responses and
+// the Readeck calls made to answer them, with secrets scrubbed.
+func (a *App) HandleDashboardRequests(w http.ResponseWriter, r *http.Request) {
+	var data requestsData
+	if a.Capture != nil && a.Config.Capture.Recent > 0 {
+		data.Enabled = true
+		data.Captures = a.Capture.Recent()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "requests.html", data); err != nil {
+		a.Logger.Errorf("Error rendering requests in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+	}
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// koboUserAgent matches the "(Kobo Touch <product ID>/<firmware>)" suffix of
+// the User-Agent of Kobo firmware, whatever the model.
+var koboUserAgent = regexp.MustCompile(`\(Kobo Touch ([0-9A-Fa-f]{4})/([0-9.]+)\)`)
+
+// koboModels names the Kobo models by the product ID in their User-Agent.
+var koboModels = map[string]string{
+	"0310": "Touch",
+	"0320": "Touch",
+	"0330": "Glo",
+	"0340": "Mini",
+	"0350": "Aura HD",
+	"0360": "Aura",
+	"0370": "Aura H2O",
+	"0371": "Glo HD",
+	"0372": "Touch 2.0",
+	"0373": "Aura One",
+	"0374": "Aura H2O Edition 2",
+	"0375": "Aura Edition 2",
+	"0376": "Clara HD",
+	"0377": "Forma",
+	"0378": "Aura H2O Edition 2",
+	"0379": "Aura Edition 2",
+	"0380": "Forma",
+	"0381": "Aura One",
+	"0382": "Nia",
+	"0383": "Sage",
+	"0384": "Libra H2O",
+	"0386": "Clara 2E",
+	"0387": "Elipsa",
+	"0388": "Libra 2",
+	"0389": "Elipsa 2E",
+	"0390": "Libra Colour",
+	"0391": "Clara BW",
+	"0393": "Clara Colour",
+}
+
+// deviceInfo is what a device tells about itself in its requests.
+type deviceInfo struct {
+	Model     string    `json:"model,omitempty"`
+	ProductID string    `json:"product_id,omitempty"`
+	Firmware  string    `json:"firmware,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// identifyDevice reads the model and firmware of a Kobo from the User-Agent
+// of r, and its serial from the headers the store API requests carry.
+func identifyDevice(r *http.Request) deviceInfo {
+	info := deviceInfo{UserAgent: r.UserAgent()}
+	if m := koboUserAgent.FindStringSubmatch(info.UserAgent); m != nil {
+		info.ProductID = m[1]
+		info.Firmware = m[2]
+		info.Model = koboModels[m[1]]
+	}
+	if model := r.Header.Get("X-Kobo-DeviceModel"); model != "" && info.Model == "" {
+		info.Model = model
+	}
+	if version := r.Header.Get("X-Kobo-AppVersion"); version != "" && info.Firmware == "" {
+		info.Firmware = version
+	}
+	info.Serial = r.Header.Get("X-Kobo-SerialNumber")
+	if info.Serial == "" {
+		info.Serial = r.Header.Get("X-Kobo-DeviceId")
+	}
+	return info
+}
+
+type deviceInfoKey struct{}
+
+// DeviceMiddleware identifies the device sending each request, which is
+// recorded under its token once a handler authenticates it.
+func (a *App) DeviceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := identifyDevice(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deviceInfoKey{}, &info)))
+	})
+}
+
+// deviceStore keeps the last identification of each device token, mirrored
+// to a JSON file when one is configured.
+type deviceStore struct {
+	mu      sync.Mutex
+	path    string
+	devices map[string]*deviceInfo
+}
+
+func newDeviceStore(path string) *deviceStore {
+	return &deviceStore{path: path, devices: make(map[string]*deviceInfo)}
+}
+
+// load reads the devices file written by a previous run.
+func (s *deviceStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read devices: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.Unmarshal(data, &s.devices); err != nil {
+		return fmt.Errorf("failed to parse devices %s: %w", s.path, err)
+	}
+	if s.devices == nil {
+		s.devices = make(map[string]*deviceInfo)
+	}
+	return nil
+}
+
+// save writes the devices file; s.mu must be held.
+func (s *deviceStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.devices)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write devices: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write devices: %w", err)
+	}
+	return nil
+}
+
+// record stores info for deviceToken. Fields the request did not carry keep
+// their earlier value, and the file is only rewritten when the device
+// changed, not on every request.
+func (s *deviceStore) record(deviceToken string, info deviceInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known, ok := s.devices[deviceToken]
+	if !ok {
+		known = &deviceInfo{}
+		s.devices[deviceToken] = known
+	}
+	before := *known
+	if info.Model != "" || info.ProductID != "" {
+		known.Model, known.ProductID = info.Model, info.ProductID
+	}
+	if info.Firmware != "" {
+		known.Firmware = info.Firmware
+	}
+	if info.Serial != "" {
+		known.Serial = info.Serial
+	}
+	if info.UserAgent != "" {
+		known.UserAgent = info.UserAgent
+	}
+	known.LastSeen = time.Now()
+
+	before.LastSeen = known.LastSeen
+	if ok && before == *known {
+		return nil
+	}
+	return s.save()
+}
+
+// get returns the identification of deviceToken, if it was seen.
+func (s *deviceStore) get(deviceToken string) (deviceInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if info, ok := s.devices[deviceToken]; ok {
+		return *info, true
+	}
+	return deviceInfo{}, false
+}
+
+// LoadDevices restores the devices identified before readeckobo last stopped.
+func (a *App) LoadDevices() error {
+	return a.devices.load()
+}
+
+// recordDevice stores the device identified by DeviceMiddleware for the
+// request of ctx under deviceToken.
+func (a *App) recordDevice(ctx context.Context, deviceToken string) {
+	info, ok := ctx.Value(deviceInfoKey{}).(*deviceInfo)
+	if !ok {
+		return
+	}
+	if err := a.devices.record(deviceToken, *info); err != nil {
+		a.Logger.Warnf("Error saving devices: %v", err)
+	}
+}
+
+// deviceModel returns the Kobo model identified for deviceToken, or "".
+func (a *App) deviceModel(deviceToken string) string {
+	info, _ := a.devices.get(deviceToken)
+	return info.Model
+}
+
+// deviceEntry is one device in /admin/api/devices.
+type deviceEntry struct {
+	Device string `json:"device"`
+	deviceInfo
+}
+
+// adminDevicesResponse is the response of /admin/api/devices.
+type adminDevicesResponse struct {
+	Devices []deviceEntry `json:"devices"`
+}
+
+// HandleAdminDevices lists the model, firmware and masked serial of each
+// configured device that has been seen.
+func (a *App) HandleAdminDevices(w http.ResponseWriter, r *http.Request) {
+	devices := []deviceEntry{}
+	for _, user := range a.users() {
+		if info, ok := a.devices.get(user.Token); ok {
+			if info.Serial != "" {
+				// The serial encrypts the device token in its setup files.
+				info.Serial = maskToken(info.Serial)
+			}
+			devices = append(devices, deviceEntry{Device: maskToken(user.Token), deviceInfo: info})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(adminDevicesResponse{Devices: devices}); err != nil {
+		a.Logger.Errorf("Error encoding response for /admin/api/devices: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// describeDevice summarizes info for the dashboard, or returns "" for a
+// device never seen.
+func describeDevice(info deviceInfo, seen bool) string {
+	if !seen {
+		return ""
+	}
+	var parts []string
+	switch {
+	case info.Model != "":
+		parts = append(parts, "Kobo "+info.Model)
+	case info.ProductID != "":
+		parts = append(parts, "Kobo "+info.ProductID)
+	default:
+		parts = append(parts, "Unknown device")
+	}
+	if info.Firmware != "" {
+		parts = append(parts, "firmware "+info.Firmware)
+	}
+	if info.Serial != "" {
+		parts = append(parts, "serial "+maskToken(info.Serial))
+	}
+	return strings.Join(parts, ", ")
+}
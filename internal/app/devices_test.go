@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+const libra2UserAgent = "Mozilla/5.0 (Linux; U; Android 2.0; en-us;) AppleWebKit/538.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/538.1 (Kobo Touch 0388/4.38.21908)"
+
+func TestIdentifyDevice(t *testing.T) {
+	tests := []struct {
+		name    string
+		agent   string
+		headers map[string]string
+		want    deviceInfo
+	}{
+		{name: "known model", agent: libra2UserAgent, want: deviceInfo{Model: "Libra 2", ProductID: "0388", Firmware: "4.38.21908"}},
+		{name: "unknown product", agent: "Mozilla/5.0 (Kobo Touch 0999/5.1.0)", want: deviceInfo{ProductID: "0999", Firmware: "5.1.0"}},
+		{
+			name:    "store headers",
+			agent:   "curl/8.0",
+			headers: map[string]string{"X-Kobo-DeviceModel": "Kobo Clara HD", "X-Kobo-AppVersion": "4.20.14622", "X-Kobo-DeviceId": "N12345"},
+			want:    deviceInfo{Model: "Kobo Clara HD", Firmware: "4.20.14622", Serial: "N12345"},
+		},
+		{name: "not a kobo", agent: "curl/8.0", want: deviceInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("User-Agent", tt.agent)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			got := identifyDevice(r)
+			tt.want.UserAgent = tt.agent
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDeviceStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	devices := newDeviceStore(path)
+	if err := devices.record("device", deviceInfo{Model: "Libra 2", ProductID: "0388", Firmware: "4.38.21908", Serial: "N12345"}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	// A later request without a serial keeps the one already known.
+	if err := devices.record("device", deviceInfo{Model: "Libra 2", ProductID: "0388", Firmware: "4.39.22801"}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	reloaded := newDeviceStore(path)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	got, ok := reloaded.get("device")
+	if !ok || got.Firmware != "4.39.22801" || got.Serial != "N12345" || got.Model != "Libra 2" {
+		t.Errorf("expected the updated device to be restored, got %+v", got)
+	}
+}
+
+func TestDeviceMiddlewareSelectsProfile(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:          []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck:        config.ConfigReadeck{Host: mockServer.URL},
+			DeviceProfiles: []config.DeviceProfile{{Model: "libra2", Devices: []string{"libra 2"}}},
+		}),
+		WithLogger(testLogger),
+	)
+	if profile := app.deviceProfile(mockDeviceToken, ""); profile != nil {
+		t.Fatalf("expected no profile before the device is seen, got %q", profile.Model)
+	}
+
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+	r := httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body))
+	r.Header.Set("User-Agent", libra2UserAgent)
+	app.DeviceMiddleware(http.HandlerFunc(app.HandleKoboGet)).ServeHTTP(httptest.NewRecorder(), r)
+
+	profile := app.deviceProfile(mockDeviceToken, "curl/8.0")
+	if profile == nil || profile.Model != "libra2" {
+		t.Errorf("expected the identified model to select libra2, got %+v", profile)
+	}
+
+	rr := httptest.NewRecorder()
+	app.HandleAdminDevices(rr, httptest.NewRequest(http.MethodGet, "/admin/api/devices", nil))
+	var resp struct {
+		Devices []deviceEntry `json:"devices"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Devices) != 1 || resp.Devices[0].Model != "Libra 2" || resp.Devices[0].Device == mockDeviceToken {
+		t.Errorf("expected the masked device with its model, got %+v", resp.Devices)
+	}
+}
@@ -0,0 +1,414 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/epub"
+	"readeckobo/internal/readeck"
+)
+
+// Defaults used when the corresponding digest setting is unset.
+const (
+	defaultDigestDays        = 1
+	defaultDigestMaxArticles = 50
+	defaultDigestTime        = "06:00"
+)
+
+// maxDigests is how many digests of each device are kept for download.
+const maxDigests = 7
+
+// digestDateLayout names digests in URLs and titles.
+const digestDateLayout = "2006-01-02"
+
+// errEmptyDigest means a device has no unread articles for a digest.
+var errEmptyDigest = errors.New("no unread articles for a digest")
+
+// digestElements are dropped from digest chapters along with their content,
+// since EPUB readers do not fetch remote media.
+var digestElements = map[atom.Atom]bool{
+	atom.Img:      true,
+	atom.Picture:  true,
+	atom.Video:    true,
+	atom.Audio:    true,
+	atom.Source:   true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+}
+
+// digestAttributes are the attributes kept in digest chapters.
+var digestAttributes = map[string]bool{
+	"href":    true,
+	"alt":     true,
+	"title":   true,
+	"colspan": true,
+	"rowspan": true,
+	"lang":    true,
+	"dir":     true,
+}
+
+// digest is an EPUB of a device's recent unread articles.
+type digest struct {
+	Date     string
+	Title    string
+	Articles int
+	Built    time.Time
+	Data     []byte
+}
+
+// digestStore keeps the latest digests of each device, newest first.
+type digestStore struct {
+	mu      sync.Mutex
+	devices map[string][]*digest
+}
+
+func newDigestStore() *digestStore {
+	return &digestStore{devices: make(map[string][]*digest)}
+}
+
+// put keeps d for deviceToken, replacing a digest of the same date.
+func (s *digestStore) put(deviceToken string, d *digest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digests := []*digest{d}
+	for _, kept := range s.devices[deviceToken] {
+		if kept.Date != d.Date && len(digests) < maxDigests {
+			digests = append(digests, kept)
+		}
+	}
+	s.devices[deviceToken] = digests
+}
+
+// get returns the digest of deviceToken for date, or the latest one when
+// date is empty.
+func (s *digestStore) get(deviceToken, date string) *digest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.devices[deviceToken] {
+		if date == "" || d.Date == date {
+			return d
+		}
+	}
+	return nil
+}
+
+// list returns the digests of deviceToken, newest first.
+func (s *digestStore) list(deviceToken string) []*digest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*digest(nil), s.devices[deviceToken]...)
+}
+
+// RunDigests builds the digest of every device at digest.time each day
+// until ctx is done.
+func (a *App) RunDigests(ctx context.Context) {
+	if !a.Config.Digest.Enabled {
+		return
+	}
+	at := a.Config.Digest.Time
+	if at == "" {
+		at = defaultDigestTime
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(nextDigestTime(time.Now(), at)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for _, user := range a.users() {
+			if _, err := a.buildDigest(ctx, &user, time.Now()); err != nil {
+				if errors.Is(err, errEmptyDigest) {
+					a.Logger.Infof("No digest for device %s: %v", maskToken(user.Token), err)
+					continue
+				}
+				a.Logger.Warnf("Error building digest for device %s: %v", maskToken(user.Token), err)
+			}
+		}
+	}
+}
+
+// nextDigestTime returns the next time after now at the local time of day
+// at, given as HH:MM.
+func nextDigestTime(now time.Time, at string) time.Time {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		t, _ = time.Parse("15:04", defaultDigestTime)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// buildDigest bundles the unread articles user saved in the last
+// digest.days into an EPUB, newest first, and keeps it for download.
+func (a *App) buildDigest(ctx context.Context, user *config.User, now time.Time) (*digest, error) {
+	days, maxArticles := a.Config.Digest.Days, a.Config.Digest.MaxArticles
+	if days <= 0 {
+		days = defaultDigestDays
+	}
+	if maxArticles <= 0 {
+		maxArticles = defaultDigestMaxArticles
+	}
+
+	client, err := a.newReadeckClient(user)
+	if err != nil {
+		return nil, err
+	}
+	unread := false
+	bookmarks, _, err := client.ListBookmarks(ctx, readeck.ListBookmarksOptions{
+		IsArchived: &unread,
+		Limit:      maxArticles,
+		Sort:       []string{"-created"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.AddDate(0, 0, -days)
+	date := now.Format(digestDateLayout)
+	book := &epub.Book{
+		ID:       fmt.Sprintf("urn:readeckobo:digest:%s:%s", resourceDevice(user.Token), date),
+		Title:    "Readeck digest " + date,
+		Author:   "readeckobo",
+		Language: "en",
+		Modified: now,
+	}
+	for _, bookmark := range bookmarks {
+		if bookmark.Created.Before(since) || !bookmark.HasArticle {
+			continue
+		}
+		article, err := client.GetBookmarkArticle(ctx, bookmark.ID)
+		if err != nil {
+			a.Logger.Warnf("Error fetching article %s for the digest of device %s: %v", bookmark.ID, maskToken(user.Token), err)
+			continue
+		}
+		body, err := digestChapter(article, bookmark)
+		if err != nil {
+			a.Logger.Warnf("Error converting article %s for the digest of device %s: %v", bookmark.ID, maskToken(user.Token), err)
+			continue
+		}
+		if len(book.Chapters) == 0 && bookmark.Lang != "" {
+			book.Language = bookmark.Lang
+		}
+		title := bookmark.Title
+		if title == "" {
+			title = bookmark.URL
+		}
+		book.Chapters = append(book.Chapters, epub.Chapter{Title: title, Body: body})
+	}
+	if len(book.Chapters) == 0 {
+		return nil, fmt.Errorf("%w in the last %d days", errEmptyDigest, days)
+	}
+
+	var buf bytes.Buffer
+	if err := book.Write(&buf); err != nil {
+		return nil, err
+	}
+	d := &digest{Date: date, Title: book.Title, Articles: len(book.Chapters), Built: now, Data: buf.Bytes()}
+	a.digests.put(user.Token, d)
+	a.Logger.Infof("Built digest of %d articles for device %s", d.Articles, maskToken(user.Token))
+	return d, nil
+}
+
+// digestChapter turns the HTML of an article into the XHTML body of a
+// digest chapter, led by a link to the article's page.
+func digestChapter(article string, bookmark readeck.Bookmark) (string, error) {
+	doc, err := html.Parse(strings.NewReader(article))
+	if err != nil {
+		return "", err
+	}
+	baseURL, _ := url.Parse(bookmark.URL)
+	sanitizeArticle(doc, baseURL)
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return "", errors.New("article has no body")
+	}
+	cleanDigestNode(body)
+
+	var buf bytes.Buffer
+	site := bookmark.SiteName
+	if site == "" {
+		site = bookmark.Site
+	}
+	if site == "" {
+		site = bookmark.URL
+	}
+	buf.WriteString(`<p><a href="`)
+	_ = xml.EscapeText(&buf, []byte(bookmark.URL))
+	buf.WriteString(`">`)
+	_ = xml.EscapeText(&buf, []byte(site))
+	buf.WriteString("</a>")
+	if bookmark.ReadingTime > 0 {
+		buf.WriteString(" · " + strconv.Itoa(bookmark.ReadingTime) + " min")
+	}
+	buf.WriteString("</p>\n")
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// cleanDigestNode makes the children of n well-formed XHTML without remote
+// media: comments and media go, elements HTML does not know are replaced by
+// their content, and only digestAttributes are kept.
+func cleanDigestNode(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode, c.Type == html.ElementNode && digestElements[c.DataAtom]:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && (c.DataAtom == 0 || c.Namespace != ""):
+			cleanDigestNode(c)
+			for gc := c.FirstChild; gc != nil; {
+				gnext := gc.NextSibling
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c)
+				gc = gnext
+			}
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode:
+			attrs := c.Attr[:0]
+			for _, attr := range c.Attr {
+				if attr.Namespace == "" && digestAttributes[attr.Key] && !strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:") {
+					attrs = append(attrs, attr)
+				}
+			}
+			c.Attr = attrs
+			cleanDigestNode(c)
+		}
+		c = next
+	}
+}
+
+// HandleDigest sends the latest digest of a device as an EPUB, or the one
+// of ?date=YYYY-MM-DD, building today's when the device has none yet. The
+// device token is taken like in /api/save.
+func (a *App) HandleDigest(w http.ResponseWriter, r *http.Request) {
+	params := a.Logger.Redact([]byte(r.URL.RawQuery))
+
+	user, err := a.getUser(r.Context(), requestDeviceToken(r))
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for /api/digest: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	d := a.digests.get(user.Token, date)
+	if d == nil && date != "" {
+		writeKoboError(w, http.StatusNotFound, pocketErrInvalidRequest, "No digest for "+date)
+		return
+	}
+	if d == nil {
+		if d, err = a.buildDigest(r.Context(), user, time.Now()); err != nil {
+			if errors.Is(err, errEmptyDigest) {
+				writeKoboError(w, http.StatusNotFound, pocketErrInvalidRequest, "No unread articles for a digest")
+				return
+			}
+			writeReadeckError(w, "Failed to build digest", err)
+			a.Logger.Errorf("Error building digest in /api/digest: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="readeck-digest-%s.epub"`, d.Date))
+	w.Header().Set("Content-Length", strconv.Itoa(len(d.Data)))
+	if _, err := w.Write(d.Data); err != nil {
+		a.Logger.Errorf("Error writing response for /api/digest: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+	}
+}
+
+// opdsFeedType is the content type of the OPDS catalog of digests.
+const opdsFeedType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+
+// opdsFeed is an OPDS 1.2 acquisition feed of a device's digests.
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Content string     `xml:"content"`
+	Links   []opdsLink `xml:"link"`
+}
+
+type opdsLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// HandleDigestOPDS lists the kept digests of a device as an OPDS catalog,
+// for e-reader apps that browse OPDS. Links carry the device token and are
+// relative, so that they work behind a reverse proxy's path prefix.
+func (a *App) HandleDigestOPDS(w http.ResponseWriter, r *http.Request) {
+	params := a.Logger.Redact([]byte(r.URL.RawQuery))
+
+	token := requestDeviceToken(r)
+	user, err := a.getUser(r.Context(), token)
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for /api/digest/opds: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+
+	feed := opdsFeed{
+		ID:      "urn:readeckobo:digests:" + resourceDevice(user.Token),
+		Title:   "Readeck digests",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links:   []opdsLink{{Rel: "self", Href: "opds?" + url.Values{"token": {token}}.Encode(), Type: opdsFeedType}},
+	}
+	for _, d := range a.digests.list(user.Token) {
+		href := "../digest?" + url.Values{"token": {token}, "date": {d.Date}}.Encode()
+		feed.Entries = append(feed.Entries, opdsEntry{
+			ID:      fmt.Sprintf("urn:readeckobo:digest:%s:%s", resourceDevice(user.Token), d.Date),
+			Title:   d.Title,
+			Updated: d.Built.UTC().Format(time.RFC3339),
+			Content: fmt.Sprintf("%d articles", d.Articles),
+			Links:   []opdsLink{{Rel: "http://opds-spec.org/acquisition", Href: href, Type: "application/epub+zip"}},
+		})
+	}
+
+	w.Header().Set("Content-Type", opdsFeedType)
+	_, _ = w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		a.Logger.Errorf("Error encoding response for /api/digest/opds: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestNextDigestTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	tests := []struct {
+		at   string
+		want time.Time
+	}{
+		{"08:00", time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		{"06:00", time.Date(2024, 5, 2, 6, 0, 0, 0, time.UTC)},
+		{"07:30", time.Date(2024, 5, 2, 7, 30, 0, 0, time.UTC)},
+		{"invalid", time.Date(2024, 5, 2, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := nextDigestTime(now, tt.at); !got.Equal(tt.want) {
+			t.Errorf("nextDigestTime(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestDigestChapter(t *testing.T) {
+	article := `<html><body><!-- ad --><p onclick="x()">Caf&eacute;&nbsp;<b>bold</b><br><img src="a.jpg"></p>` +
+		`<my-widget><p>kept</p></my-widget><a href="/next" data-x="1">next</a><script>bad()</script></body></html>`
+	body, err := digestChapter(article, readeck.Bookmark{URL: "https://example.com/post", SiteName: "Example & Co", ReadingTime: 3})
+	if err != nil {
+		t.Fatalf("digestChapter failed: %v", err)
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader("<div>" + body + "</div>"))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("chapter is not well-formed XML: %v\n%s", err, body)
+			}
+			break
+		}
+	}
+	for _, want := range []string{`<a href="https://example.com/post">Example &amp; Co</a> · 3 min`, "Café <b>bold</b><br/>", "<p>kept</p>", `<a href="https://example.com/next">next</a>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+	for _, unwanted := range []string{"<img", "ad -->", "onclick", "my-widget", "bad()", "data-x"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("expected no %q in\n%s", unwanted, body)
+		}
+	}
+}
+
+func TestHandleDigest(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	now := time.Now().UTC()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "First", HasArticle: true, Created: now.Add(-time.Hour)}, "<p>one</p>")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2", Title: "Second", HasArticle: true, Created: now.Add(-2 * time.Hour)}, "<p>two</p>")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "3", URL: "https://example.com/3", Title: "Old", HasArticle: true, Created: now.AddDate(0, 0, -3)}, "<p>old</p>")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "4", URL: "https://example.com/4", Title: "Archived", HasArticle: true, IsArchived: true, Created: now}, "<p>archived</p>")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+	)
+
+	rr := httptest.NewRecorder()
+	app.HandleDigest(rr, httptest.NewRequest(http.MethodGet, "/api/digest?token="+mockDeviceToken, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/epub+zip" {
+		t.Fatalf("expected an EPUB, got %d %s: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("failed to open EPUB: %v", err)
+	}
+	var chapters []string
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "OEBPS/chapter-") {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			_ = rc.Close()
+			chapters = append(chapters, string(data))
+		}
+	}
+	if len(chapters) != 2 || !strings.Contains(chapters[0], "<p>one</p>") || !strings.Contains(chapters[1], "<p>two</p>") {
+		t.Errorf("expected the two recent unread articles, newest first, got %v", chapters)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandleDigestOPDS(rr, httptest.NewRequest(http.MethodGet, "/api/digest/opds?token="+mockDeviceToken, nil))
+	date := time.Now().Format(digestDateLayout)
+	if want := `href="../digest?date=` + date + `&amp;token=` + mockDeviceToken + `"`; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("expected the OPDS feed to link the digest with %s, got %s", want, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandleDigest(rr, httptest.NewRequest(http.MethodGet, "/api/digest?date=2000-01-01&token="+mockDeviceToken, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing date, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// HandleKoboDiscover serves the Pocket discover and recommendation endpoints
+// the Kobo queries for its discovery tab, with the unread bookmarks chosen by
+// discover.source rather than Pocket's editorial picks.
+func (a *App) HandleKoboDiscover(w http.ResponseWriter, r *http.Request) {
+	var req models.PocketDiscoverRequest
+	err := decodePocketRequest(r, &req, func(get func(string) string) {
+		req.AccessToken = get("access_token")
+		req.ConsumerKey = get("consumer_key")
+		req.Count = get("count")
+	})
+	if err != nil {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
+		a.Logger.Errorf("Error decoding %s request: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+		return
+	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
+		return
+	}
+
+	uc, err := a.authenticate(r.Context(), req.AccessToken)
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+		return
+	}
+	readeckClient, err := a.newReadeckClient(&uc.User)
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
+		a.Logger.Errorf("Error initializing Readeck client for %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	limit := a.Config.Discover.MaxItems
+	if count, err := strconv.Atoi(req.Count); err == nil && count > 0 {
+		limit = min(limit, count)
+	}
+	bookmarks, err := a.discoverBookmarks(r.Context(), readeckClient, a.Config.Discover, limit)
+	if err != nil {
+		writeReadeckError(w, "Failed to list discover items", err)
+		a.Logger.Errorf("Error listing discover items in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	resultList := make(map[string]models.KoboArticleItem, len(bookmarks))
+	synced := time.Now()
+	for i := range bookmarks {
+		if a.excludedKind(&bookmarks[i]) {
+			continue
+		}
+		entry, ok := a.syncItem(&bookmarks[i], synced)
+		if !ok {
+			continue
+		}
+		entry.Status = itemStatus(&bookmarks[i])
+		resultList[entry.ItemID] = entry
+	}
+	a.fillWordCounts(r.Context(), readeckClient, resultList)
+	a.proxyResources(r, uc.User.Token, resultList)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.KoboGetResponse{Status: 1, List: resultList, Total: len(resultList)}); err != nil {
+		a.Logger.Errorf("Error encoding response for %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// discoverBookmarks lists up to limit unread bookmarks from the source of
+// cfg, newest first.
+func (a *App) discoverBookmarks(ctx context.Context, readeckClient *readeck.Client, cfg config.ConfigDiscover, limit int) ([]readeck.Bookmark, error) {
+	unread := false
+	switch cfg.Source {
+	case "collections":
+		members, err := a.loadCollections(ctx, readeckClient, cfg.Collections, false)
+		if err != nil {
+			return nil, err
+		}
+		var bookmarks []readeck.Bookmark
+		for _, member := range members {
+			if !member.bookmark.IsArchived {
+				bookmarks = append(bookmarks, member.bookmark)
+			}
+		}
+		slices.SortFunc(bookmarks, func(x, y readeck.Bookmark) int {
+			if c := y.Created.Compare(x.Created); c != 0 {
+				return c
+			}
+			return strings.Compare(x.ID, y.ID)
+		})
+		return bookmarks[:min(limit, len(bookmarks))], nil
+	case "label":
+		bookmarks, _, err := readeckClient.ListBookmarks(ctx, readeck.ListBookmarksOptions{IsArchived: &unread, Label: cfg.Label, Limit: limit, Sort: fullSyncSort})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bookmarks labeled %q: %w", cfg.Label, err)
+		}
+		return bookmarks, nil
+	default:
+		bookmarks, _, err := readeckClient.ListBookmarks(ctx, readeck.ListBookmarksOptions{IsArchived: &unread, Limit: limit, Sort: fullSyncSort})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bookmarks: %w", err)
+		}
+		return bookmarks, nil
+	}
+}
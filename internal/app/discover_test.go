@@ -0,0 +1,114 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestHandleKoboDiscover(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Created: day}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2", Created: day.Add(time.Hour), Labels: []string{"discover"}}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "3", URL: "https://example.com/3", Created: day.Add(2 * time.Hour)}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "4", URL: "https://example.com/4", Created: day.Add(3 * time.Hour), IsArchived: true, Labels: []string{"discover"}}, "")
+
+	tests := []struct {
+		name     string
+		discover config.ConfigDiscover
+		count    string
+		want     []string
+	}{
+		{name: "newest", discover: config.ConfigDiscover{Source: "newest", MaxItems: 2}, want: []string{"2", "3"}},
+		{name: "count below max items", discover: config.ConfigDiscover{Source: "newest", MaxItems: 20}, count: "1", want: []string{"3"}},
+		{name: "label", discover: config.ConfigDiscover{Source: "label", Label: "discover", MaxItems: 20}, want: []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:    []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck:  config.ConfigReadeck{Host: mockServer.URL},
+					Discover: tt.discover,
+				}),
+				WithLogger(testLogger),
+			)
+			body, _ := json.Marshal(models.PocketDiscoverRequest{AccessToken: mockDeviceToken, Count: tt.count})
+			r := httptest.NewRequest(http.MethodPost, "/v3/discover", bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			app.HandleKoboDiscover(rr, r)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			var resp models.KoboGetResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var got []string
+			for id := range resp.List {
+				got = append(got, id)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) || resp.Total != len(tt.want) {
+				t.Errorf("expected items %v, got %v (total %d)", tt.want, got, resp.Total)
+			}
+		})
+	}
+}
+
+func TestHandleKoboDiscoverCollections(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/bookmarks/collections":
+			_ = json.NewEncoder(w).Encode([]readeck.Collection{{ID: "c1", Name: "Shared"}, {ID: "c2", Name: "Private"}})
+		case "/api/bookmarks":
+			if r.URL.Query().Get("collection") != "c1" {
+				t.Errorf("unexpected bookmark list %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode([]readeck.Bookmark{
+				{ID: "b1", Title: "Shared", Created: day, WordCount: 100},
+				{ID: "b2", Title: "Read", Created: day, IsArchived: true, WordCount: 100},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:    []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck:  config.ConfigReadeck{Host: mockServer.URL},
+			Discover: config.ConfigDiscover{Source: "collections", Collections: []string{"shared"}, MaxItems: 20},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+	r := httptest.NewRequest(http.MethodPost, "/v3/recommendations", bytes.NewReader([]byte("access_token="+mockDeviceToken)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	app.HandleKoboDiscover(rr, r)
+
+	var resp models.KoboGetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if _, ok := resp.List["b1"]; len(resp.List) != 1 || !ok {
+		t.Errorf("expected the unread bookmark of the shared collection, got %v", resp.List)
+	}
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// Pocket error codes. The Kobo shows X-Error to the user and uses
+// X-Error-Code to tell a rejected token apart from a failing server.
+const (
+	pocketErrAccessToken    = 107
+	pocketErrInvalidRequest = 130
+	pocketErrConsumerKey    = 152
+	pocketErrUserRejected   = 158
+	pocketErrServer         = 199
+)
+
+// writeKoboError responds the way the Pocket API does: the message and code
+// in the X-Error and X-Error-Code headers, repeated in a JSON body.
+func writeKoboError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("X-Error", message)
+	w.Header().Set("X-Error-Code", strconv.Itoa(code))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(models.KoboErrorResponse{
+		Status:    0,
+		Error:     message,
+		ErrorCode: code,
+	})
+}
+
+// MethodNotAllowed answers a Pocket endpoint requested with a method other
+// than allow the way the Pocket API reports errors, so the device shows a
+// message instead of failing to parse a plain-text body.
+func MethodNotAllowed(allow string) http.HandlerFunc {
+	if allow == http.MethodGet {
+		allow += ", " + http.MethodHead
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		writeKoboError(w, http.StatusMethodNotAllowed, pocketErrInvalidRequest, "Method not allowed")
+	}
+}
+
+// writeReadeckError reports a failed Readeck call in terms the device acts
+// on: signing in again when Readeck rejected the token, Readeck's own
+// explanation when it rejected the request, and when to try again when
+// Readeck is throttling or down.
+func writeReadeckError(w http.ResponseWriter, message string, err error) {
+	var apiErr *readeck.APIError
+	errors.As(err, &apiErr)
+	switch {
+	case readeck.IsUnauthorized(err):
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Readeck rejected the access token")
+	case readeck.IsForbidden(err):
+		writeKoboError(w, http.StatusForbidden, pocketErrAccessToken, "The Readeck access token lacks the permission")
+	case readeck.IsNotFound(err):
+		writeKoboError(w, http.StatusNotFound, pocketErrInvalidRequest, message+": not found in Readeck")
+	case readeck.IsValidation(err):
+		if problems := apiErr.Problems(); len(problems) > 0 {
+			message += ": " + strings.Join(problems, "; ")
+		}
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, message)
+	case readeck.IsRateLimited(err):
+		if retryAfter := readeck.RetryAfter(err); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+		}
+		writeKoboError(w, http.StatusServiceUnavailable, pocketErrServer, message+": Readeck is busy, try again later")
+	default:
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, message)
+	}
+}
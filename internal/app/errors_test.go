@@ -0,0 +1,94 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+func TestWriteReadeckError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantError      string
+		wantRetryAfter string
+	}{
+		{
+			name:       "rejected token",
+			err:        &readeck.APIError{StatusCode: http.StatusUnauthorized},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "Readeck rejected the access token",
+		},
+		{
+			name:       "missing permission",
+			err:        &readeck.APIError{StatusCode: http.StatusForbidden},
+			wantStatus: http.StatusForbidden,
+			wantError:  "The Readeck access token lacks the permission",
+		},
+		{
+			name:       "not found",
+			err:        fmt.Errorf("failed to fetch bookmark details: %w", &readeck.APIError{StatusCode: http.StatusNotFound}),
+			wantStatus: http.StatusNotFound,
+			wantError:  "Failed to save URL: not found in Readeck",
+		},
+		{
+			name:       "validation",
+			err:        &readeck.APIError{StatusCode: http.StatusUnprocessableEntity, Fields: map[string][]string{"url": {"invalid URL"}}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Failed to save URL: url: invalid URL",
+		},
+		{
+			name:           "rate limited",
+			err:            &readeck.APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Second},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantError:      "Failed to save URL: Readeck is busy, try again later",
+			wantRetryAfter: "30",
+		},
+		{
+			name:       "other",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantError:  "Failed to save URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			writeReadeckError(rr, "Failed to save URL", tt.err)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Get("X-Error"); got != tt.wantError {
+				t.Errorf("expected X-Error %q, got %q", tt.wantError, got)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.wantRetryAfter, got)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	rr := httptest.NewRecorder()
+	MethodNotAllowed(http.MethodGet).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/qr", nil))
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Allow"); got != "GET, HEAD" {
+		t.Errorf("expected Allow GET, HEAD, got %q", got)
+	}
+	if got := rr.Header().Get("X-Error-Code"); got != "130" {
+		t.Errorf("expected X-Error-Code 130, got %q", got)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected a JSON body, got %q", got)
+	}
+}
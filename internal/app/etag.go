@@ -0,0 +1,43 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagOf returns a strong ETag for body.
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header of r lists etag,
+// comparing weakly as RFC 9110 asks for that header.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, header := range r.Header.Values("If-None-Match") {
+		for candidate := range strings.SplitSeq(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeETagged writes body with its ETag, or only 304 Not Modified when the
+// device already has it, and returns the bytes of body written. The other
+// headers must be set beforehand.
+func writeETagged(w http.ResponseWriter, r *http.Request, body []byte) (int, error) {
+	etag := etagOf(body)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r, etag) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return 0, nil
+	}
+	w.WriteHeader(http.StatusOK)
+	return w.Write(body)
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestETagMatches(t *testing.T) {
+	etag := etagOf([]byte("body"))
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{etag, true},
+		{"W/" + etag, true},
+		{`"other", ` + etag, true},
+		{`"other"`, false},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("If-None-Match", tt.header)
+		}
+		if got := etagMatches(r, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestHandleKoboGetNotModified(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "One"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+	)
+	get := func(etag string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+		r := httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body))
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, r)
+		return rr
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected a 200 response with an ETag, got %d and %q", first.Code, etag)
+	}
+	if rr := get(etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty 304 for an unchanged sync, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2", Title: "Two"}, "")
+	if rr := get(etag); rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("expected a new response and ETag once the sync changed, got %d", rr.Code)
+	}
+}
+
+func TestHandleConvertImageNotModified(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := range 4 {
+		img.Set(x, x, color.RGBA{R: 255, A: 128})
+	}
+	var source bytes.Buffer
+	if err := png.Encode(&source, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	imgSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(source.Bytes())
+	}))
+	defer imgSrv.Close()
+
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger), WithImageHTTPClient(imgSrv.Client()))
+	convert := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/convert-image?url="+url.QueryEscape(imgSrv.URL+"/a.png"), nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		app.HandleConvertImage(rr, r)
+		return rr
+	}
+
+	first := convert("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+		t.Fatalf("expected a converted image with an ETag, got %d and %q", first.Code, etag)
+	}
+	if rr := convert(etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty 304 for the same image, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+// Defaults used when the corresponding extraction setting is unset.
+const (
+	defaultExtractionCheckInterval = 15 * time.Second
+	defaultExtractionWait          = 10 * time.Minute
+)
+
+// maxTrackedExtractions bounds the extractions kept for the admin API; the
+// oldest finished ones are forgotten first.
+const maxTrackedExtractions = 200
+
+// Extraction statuses of bookmarks added from a device.
+const (
+	extractionPending   = "pending"
+	extractionExtracted = "extracted"
+	extractionFailed    = "failed"
+	extractionRetried   = "retried"
+)
+
+// trackedExtraction is a bookmark added from a device while Readeck fetches
+// and extracts its page.
+type trackedExtraction struct {
+	BookmarkID string    `json:"bookmark_id"`
+	URL        string    `json:"url"`
+	Device     string    `json:"device"`
+	Added      time.Time `json:"added"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Retries    int       `json:"retries"`
+
+	deviceToken string
+	create      readeck.CreateBookmarkOptions
+}
+
+// extractionTracker keeps the recently added bookmarks and counts the
+// outcomes of their extraction.
+type extractionTracker struct {
+	mu       sync.Mutex
+	items    []*trackedExtraction
+	outcomes map[string]uint64
+}
+
+func newExtractionTracker() *extractionTracker {
+	return &extractionTracker{outcomes: make(map[string]uint64)}
+}
+
+func (t *extractionTracker) track(deviceToken, bookmarkURL, bookmarkID string, create readeck.CreateBookmarkOptions, retries int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.items = append(t.items, &trackedExtraction{
+		BookmarkID:  bookmarkID,
+		URL:         bookmarkURL,
+		Device:      maskToken(deviceToken),
+		Added:       time.Now(),
+		Status:      extractionPending,
+		Retries:     retries,
+		deviceToken: deviceToken,
+		create:      create,
+	})
+	for i := 0; len(t.items) > maxTrackedExtractions && i < len(t.items); {
+		if t.items[i].Status == extractionPending {
+			i++
+			continue
+		}
+		t.items = append(t.items[:i], t.items[i+1:]...)
+	}
+}
+
+// resolve records the outcome of the extraction of bookmarkID.
+func (t *extractionTracker) resolve(bookmarkID, status, problem string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, item := range t.items {
+		if item.BookmarkID == bookmarkID && item.Status != status {
+			item.Status, item.Error = status, problem
+			t.outcomes[status]++
+			return
+		}
+	}
+}
+
+// find returns a copy of the extraction of bookmarkID.
+func (t *extractionTracker) find(bookmarkID string) (trackedExtraction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, item := range t.items {
+		if item.BookmarkID == bookmarkID {
+			return *item, true
+		}
+	}
+	return trackedExtraction{}, false
+}
+
+// list returns copies of the tracked extractions with status, or of all of
+// them when status is empty, oldest first.
+func (t *extractionTracker) list(status string) []trackedExtraction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	items := make([]trackedExtraction, 0, len(t.items))
+	for _, item := range t.items {
+		if status == "" || item.Status == status {
+			items = append(items, *item)
+		}
+	}
+	return items
+}
+
+// ExtractionOutcomes counts the extractions of bookmarks added from devices
+// by outcome, for metrics.
+func (a *App) ExtractionOutcomes() map[string]uint64 {
+	a.extractions.mu.Lock()
+	defer a.extractions.mu.Unlock()
+
+	outcomes := make(map[string]uint64, len(a.extractions.outcomes))
+	for status, n := range a.extractions.outcomes {
+		outcomes[status] = n
+	}
+	return outcomes
+}
+
+// RunExtractionChecks checks on bookmarks added from devices every
+// extraction.check_interval until ctx is done.
+func (a *App) RunExtractionChecks(ctx context.Context) {
+	interval := a.Config.Extraction.CheckInterval
+	if interval <= 0 {
+		interval = defaultExtractionCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		a.checkExtractions(ctx)
+	}
+}
+
+// checkExtractions asks Readeck about each pending extraction, retrying
+// failed ones up to extraction.max_retries times.
+func (a *App) checkExtractions(ctx context.Context) {
+	wait := a.Config.Extraction.Timeout
+	if wait <= 0 {
+		wait = defaultExtractionWait
+	}
+
+	clients := make(map[string]*readeck.Client)
+	for _, item := range a.extractions.list(extractionPending) {
+		client, err := a.queueClient(ctx, clients, item.deviceToken)
+		if err != nil {
+			a.Logger.Warnf("Error checking extraction of %s for device %s: %v", item.URL, item.Device, err)
+			continue
+		}
+
+		var problem string
+		bookmark, err := client.GetBookmarkDetails(ctx, item.BookmarkID)
+		switch {
+		case readeck.IsNotFound(err):
+			problem = "the bookmark was deleted"
+		case err != nil:
+			a.Logger.Debugf("Error checking extraction of %s for device %s: %v", item.URL, item.Device, err)
+			continue
+		case bookmark.State == readeck.StateError:
+			problem = "Readeck could not extract the page"
+		case bookmark.State != readeck.StateLoading:
+			a.extractions.resolve(item.BookmarkID, extractionExtracted, "")
+			a.Logger.Debugf("Readeck extracted %s for device %s", item.URL, item.Device)
+			continue
+		case time.Since(item.Added) > wait:
+			problem = "Readeck is still extracting the page after " + wait.String()
+		default:
+			continue
+		}
+
+		a.extractions.resolve(item.BookmarkID, extractionFailed, problem)
+		a.Logger.Warnf("Failed to add %s for device %s: %s", item.URL, item.Device, problem)
+		if item.Retries < a.Config.Extraction.MaxRetries && !readeck.IsNotFound(err) {
+			if _, err := a.retryExtraction(ctx, client, item); err != nil {
+				a.Logger.Warnf("Error retrying the addition of %s for device %s: %v", item.URL, item.Device, err)
+			}
+		}
+	}
+}
+
+// retryExtraction replaces the bookmark of a failed extraction with a new one
+// for the same URL, and returns the ID of the new bookmark.
+func (a *App) retryExtraction(ctx context.Context, client *readeck.Client, item trackedExtraction) (string, error) {
+	id, err := client.CreateBookmark(ctx, item.URL, item.create)
+	if err != nil {
+		return "", err
+	}
+	if err := client.UpdateBookmark(ctx, item.BookmarkID, map[string]any{"is_deleted": true}); err != nil && !readeck.IsNotFound(err) {
+		a.Logger.Warnf("Error deleting bookmark %s replaced by a retry for device %s: %v", item.BookmarkID, item.Device, err)
+	}
+	a.extractions.resolve(item.BookmarkID, extractionRetried, item.Error)
+	if id != "" {
+		a.extractions.track(item.deviceToken, item.URL, id, item.create, item.Retries+1)
+	}
+	a.Logger.Infof("Retried adding %s for device %s as bookmark %s", item.URL, item.Device, id)
+	return id, nil
+}
+
+// adminExtractionsResponse is the response of /admin/api/extractions.
+type adminExtractionsResponse struct {
+	Extractions []trackedExtraction `json:"extractions"`
+}
+
+// retryExtractionResponse is the response of
+// /admin/api/extractions/{id}/retry.
+type retryExtractionResponse struct {
+	BookmarkID string `json:"bookmark_id"`
+	URL        string `json:"url"`
+}
+
+// HandleAdminExtractions lists the bookmarks recently added from devices and
+// how their extraction went; the status query parameter filters them.
+func (a *App) HandleAdminExtractions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(adminExtractionsResponse{Extractions: a.extractions.list(r.URL.Query().Get("status"))}); err != nil {
+		a.Logger.Errorf("Error encoding response for /admin/api/extractions: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// HandleAdminRetryExtraction adds the URL of a failed extraction again.
+func (a *App) HandleAdminRetryExtraction(w http.ResponseWriter, r *http.Request) {
+	item, ok := a.extractions.find(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Extraction not found", http.StatusNotFound)
+		return
+	}
+	if item.Status != extractionFailed {
+		http.Error(w, "Only failed extractions can be retried", http.StatusConflict)
+		return
+	}
+
+	client, err := a.queueClient(r.Context(), make(map[string]*readeck.Client), item.deviceToken)
+	if err != nil {
+		http.Error(w, "Failed to initialize Readeck client", http.StatusInternalServerError)
+		a.Logger.Errorf("Error initializing Readeck client for /admin/api/extractions: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	id, err := a.retryExtraction(r.Context(), client, item)
+	if err != nil {
+		http.Error(w, "Failed to add the URL again", http.StatusBadGateway)
+		a.Logger.Errorf("Error retrying extraction in /admin/api/extractions: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(retryExtractionResponse{BookmarkID: id, URL: item.URL}); err != nil {
+		a.Logger.Errorf("Error encoding response for /admin/api/extractions: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestExtractionChecks(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        int
+		maxRetries   int
+		added        time.Duration
+		wantStatus   string
+		wantRetried  bool
+		wantOutcomes map[string]uint64
+	}{
+		{name: "extracted", state: readeck.StateLoaded, wantStatus: extractionExtracted, wantOutcomes: map[string]uint64{extractionExtracted: 1}},
+		{name: "still loading", state: readeck.StateLoading, wantStatus: extractionPending, wantOutcomes: map[string]uint64{}},
+		{name: "timed out", state: readeck.StateLoading, added: -time.Hour, wantStatus: extractionFailed, wantOutcomes: map[string]uint64{extractionFailed: 1}},
+		{name: "failed", state: readeck.StateError, wantStatus: extractionFailed, wantOutcomes: map[string]uint64{extractionFailed: 1}},
+		{name: "failed and retried", state: readeck.StateError, maxRetries: 1, wantStatus: extractionRetried, wantRetried: true, wantOutcomes: map[string]uint64{extractionFailed: 1, extractionRetried: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			mockServer.Extract = func(bookmark *readeck.Bookmark) string {
+				bookmark.State = tt.state
+				return ""
+			}
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:      []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck:    config.ConfigReadeck{Host: mockServer.URL},
+					Extraction: config.ConfigExtraction{Timeout: time.Minute, MaxRetries: tt.maxRetries},
+				}),
+				WithLogger(testLogger),
+			)
+
+			body, _ := json.Marshal(models.KoboSendRequest{
+				AccessToken: mockDeviceToken,
+				Actions:     []any{map[string]any{"action": "add", "url": "https://example.com/new"}},
+			})
+			rr := httptest.NewRecorder()
+			app.HandleKoboSend(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("send failed with status %d: %s", rr.Code, rr.Body.String())
+			}
+			if tt.added != 0 {
+				app.extractions.items[0].Added = time.Now().Add(tt.added)
+			}
+
+			app.checkExtractions(context.Background())
+
+			item, ok := app.extractions.find("created-1")
+			if !ok {
+				t.Fatal("expected the added bookmark to be tracked")
+			}
+			if item.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q (%s)", tt.wantStatus, item.Status, item.Error)
+			}
+			retry, retried := app.extractions.find("created-2")
+			if retried != tt.wantRetried {
+				t.Errorf("expected retried = %v, got %v", tt.wantRetried, retried)
+			}
+			if retried {
+				if retry.Status != extractionPending || retry.Retries != 1 {
+					t.Errorf("expected a pending retry, got %+v", retry)
+				}
+				if _, ok := mockServer.Bookmark("created-1"); ok {
+					t.Error("expected the failed bookmark to be deleted")
+				}
+			}
+			outcomes := app.ExtractionOutcomes()
+			if len(outcomes) != len(tt.wantOutcomes) {
+				t.Errorf("expected outcomes %v, got %v", tt.wantOutcomes, outcomes)
+			}
+			for status, n := range tt.wantOutcomes {
+				if outcomes[status] != n {
+					t.Errorf("expected %d %s outcomes, got %d", n, status, outcomes[status])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleAdminExtractions(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+	)
+	app.extractions.track(mockDeviceToken, "https://example.com/ok", "b1", readeck.CreateBookmarkOptions{}, 0)
+	app.extractions.track(mockDeviceToken, "https://example.com/broken", "b2", readeck.CreateBookmarkOptions{Labels: []string{"from-kobo"}}, 0)
+	app.extractions.resolve("b2", extractionFailed, "Readeck could not extract the page")
+
+	rr := httptest.NewRecorder()
+	app.HandleAdminExtractions(rr, httptest.NewRequest(http.MethodGet, "/admin/api/extractions?status=failed", nil))
+	var listed struct {
+		Extractions []trackedExtraction `json:"extractions"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listed.Extractions) != 1 || listed.Extractions[0].BookmarkID != "b2" {
+		t.Fatalf("expected only the failed extraction, got %+v", listed.Extractions)
+	}
+	if listed.Extractions[0].Device == mockDeviceToken {
+		t.Error("expected the device token to be masked")
+	}
+
+	retry := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/api/extractions/"+id+"/retry", nil)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		app.HandleAdminRetryExtraction(rr, req)
+		return rr
+	}
+	if rr := retry("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown extraction, got %d", rr.Code)
+	}
+	if rr := retry("b1"); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a pending extraction, got %d", rr.Code)
+	}
+	if rr := retry("b2"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if created := mockServer.Created(); len(created) != 1 || created[0] != "https://example.com/broken" {
+		t.Errorf("expected the URL to be added again, got %v", created)
+	}
+	if item, _ := app.extractions.find("b2"); item.Status != extractionRetried {
+		t.Errorf("expected the failed extraction to be marked retried, got %q", item.Status)
+	}
+}
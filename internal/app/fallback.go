@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"readeckobo/internal/readability"
+)
+
+// maxOriginBytes bounds the pages fetched for the readability fallback.
+const maxOriginBytes = 5 << 20
+
+// maxOriginRedirects bounds the redirects followed when fetching a page.
+const maxOriginRedirects = 5
+
+// defaultOriginUserAgent is sent for pages when images.user_agent is unset,
+// as some websites refuse Go's.
+const defaultOriginUserAgent = "Mozilla/5.0 (compatible; readeckobo)"
+
+// nonPublicPrefixes are the special-purpose networks not covered by the
+// netip.Addr predicates.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// isPublicAddr reports whether addr is on the public internet, rather than
+// on the host, the local network or a reserved range.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicOnly refuses connections to addresses that are not public. It runs
+// once a host name is resolved, so names pointing at internal addresses are
+// refused as well.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addr) {
+		return fmt.Errorf("refusing to connect to non-public address %s", addr)
+	}
+	return nil
+}
+
+// newOriginHTTPClient returns the client that fetches bookmarked pages for
+// the readability fallback. The URLs come from bookmarks, so it only
+// connects to public addresses; it bypasses proxies, whose address would be
+// checked instead of the page's.
+func newOriginHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxOriginRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// extractOrigin fetches the page at pageURL and extracts its content, for
+// bookmarks Readeck has no article for.
+func (a *App) extractOrigin(ctx context.Context, pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("unsupported page URL %q", pageURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	userAgent := a.Config.Images.UserAgent
+	if userAgent == "" {
+		userAgent = defaultOriginUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9")
+
+	resp, err := a.OriginHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch page: %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return "", fmt.Errorf("page is not HTML: %s", contentType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxOriginBytes), contentType)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode page: %w", err)
+	}
+	article, err := readability.Extract(body)
+	if err != nil {
+		return "", err
+	}
+	return article.Content, nil
+}
+
+// isEmptyArticle reports whether article has neither text nor images.
+func isEmptyArticle(article string) bool {
+	doc, err := html.Parse(strings.NewReader(article))
+	if err != nil {
+		return false
+	}
+	if strings.TrimSpace(textContent(doc)) != "" {
+		return false
+	}
+	var hasImage bool
+	walkElements(doc, func(n *html.Node) {
+		hasImage = hasImage || n.Data == "img"
+	})
+	return !hasImage
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "10.1.2.3", want: false},
+		{addr: "192.168.1.10", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "0.0.0.0", want: false},
+		{addr: "::1", want: false},
+		{addr: "fd00::1", want: false},
+		{addr: "::ffff:127.0.0.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractOriginRefusesLocalAddresses(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the local server not to be reached")
+	}))
+	defer origin.Close()
+
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger))
+	if _, err := app.extractOrigin(context.Background(), origin.URL); err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("expected the local address to be refused, got %v", err)
+	}
+	if _, err := app.extractOrigin(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Error("expected a file URL to be refused")
+	}
+}
+
+func TestHandleKoboDownloadReadabilityFallback(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><body><nav>Menu</nav><article><p>` +
+			strings.Repeat("Text from the page itself, extracted by readeckobo. ", 5) +
+			`</p><p>More of the story, with commas, and clauses, to be sure it counts.</p></article></body></html>`))
+	}))
+	defer origin.Close()
+	pageURL := origin.URL + "/post"
+
+	tests := []struct {
+		name     string
+		fallback bool
+		status   int
+	}{
+		{name: "fallback", fallback: true, status: http.StatusOK},
+		{name: "disabled", fallback: false, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			mockServer.AddBookmark(readeck.Bookmark{ID: "b1", URL: pageURL, Title: "Post"}, "")
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:    []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck:  config.ConfigReadeck{Host: mockServer.URL},
+					Download: config.ConfigDownload{ReadabilityFallback: tt.fallback},
+				}),
+				WithLogger(testLogger),
+				WithOriginHTTPClient(origin.Client()),
+			)
+
+			body, _ := json.Marshal(models.KoboGetRequest{Count: "10", AccessToken: mockDeviceToken})
+			rr := httptest.NewRecorder()
+			app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("sync failed with status %d: %s", rr.Code, rr.Body.String())
+			}
+
+			form := url.Values{"access_token": {mockDeviceToken}, "url": {pageURL}}
+			req := httptest.NewRequest(http.MethodPost, "/api/kobo/download", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr = httptest.NewRecorder()
+			app.HandleKoboDownload(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var response struct {
+				Article string `json:"article"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !strings.Contains(response.Article, "Text from the page itself") || strings.Contains(response.Article, "Menu") {
+				t.Errorf("expected the extracted article, got %s", response.Article)
+			}
+		})
+	}
+}
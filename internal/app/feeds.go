@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"readeckobo/internal/feeds"
+	"readeckobo/internal/readeck"
+)
+
+// defaultFeedPollInterval is used when feeds.poll_interval is unset.
+const defaultFeedPollInterval = 30 * time.Minute
+
+// feedState remembers the entries of each feed source that were saved or
+// were already listed when the source was first polled, mirrored to a JSON
+// file when one is configured.
+type feedState struct {
+	mu   sync.Mutex
+	path string
+	// sources maps feed URLs, and "miniflux:" and the Miniflux URL, to the
+	// IDs of the entries seen.
+	sources map[string][]string
+}
+
+func newFeedState(path string) *feedState {
+	return &feedState{path: path, sources: make(map[string][]string)}
+}
+
+// load reads the state file written by a previous run.
+func (s *feedState) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read feed state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.Unmarshal(data, &s.sources); err != nil {
+		return fmt.Errorf("failed to parse feed state %s: %w", s.path, err)
+	}
+	if s.sources == nil {
+		s.sources = make(map[string][]string)
+	}
+	return nil
+}
+
+// save writes the state file; s.mu must be held.
+func (s *feedState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.sources)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write feed state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write feed state: %w", err)
+	}
+	return nil
+}
+
+// seen returns the IDs of the entries seen from source, and whether the
+// source was polled before.
+func (s *feedState) seen(source string) (map[string]bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, ok := s.sources[source]
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return seen, ok
+}
+
+// remember records the entries of source that are still listed and were
+// seen, so that entries dropped from the feed are forgotten.
+func (s *feedState) remember(source string, entries []feeds.Entry, seen map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			ids = append(ids, entry.ID)
+		}
+	}
+	s.sources[source] = ids
+	return s.save()
+}
+
+// LoadFeedState restores the feed entries seen before readeckobo last stopped.
+func (a *App) LoadFeedState() error {
+	return a.feeds.load()
+}
+
+// RunFeedPolls saves the new entries of the configured feeds and Miniflux
+// server every feeds.poll_interval until ctx is done.
+func (a *App) RunFeedPolls(ctx context.Context) {
+	cfg := a.Config.Feeds
+	if len(cfg.Sources) == 0 && cfg.Miniflux.URL == "" {
+		return
+	}
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = defaultFeedPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.pollFeeds(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollFeeds checks every feed source once.
+func (a *App) pollFeeds(ctx context.Context) {
+	client := a.FeedHTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for _, source := range a.Config.Feeds.Sources {
+		entries, err := feeds.Fetch(ctx, client, source.URL)
+		if err != nil {
+			a.Logger.Warnf("Error polling feed %s: %v", source.URL, err)
+			continue
+		}
+		seen, polled := a.feeds.seen(source.URL)
+		if !polled {
+			// Only entries published from now on are new.
+			for _, entry := range entries {
+				seen[entry.ID] = true
+			}
+		}
+		a.saveFeedEntries(ctx, source.URL, source.Token, source.Labels, entries, seen)
+		if err := a.feeds.remember(source.URL, entries, seen); err != nil {
+			a.Logger.Warnf("Error saving feed state: %v", err)
+		}
+	}
+
+	if cfg := a.Config.Feeds.Miniflux; cfg.URL != "" {
+		miniflux := &feeds.Miniflux{BaseURL: cfg.URL, APIToken: cfg.APIKey, HTTPClient: client}
+		entries, err := miniflux.UnreadEntries(ctx, cfg.CategoryID, a.Config.Feeds.MaxItems)
+		if err != nil {
+			a.Logger.Warnf("Error polling Miniflux at %s: %v", cfg.URL, err)
+			return
+		}
+		source := "miniflux:" + cfg.URL
+		seen, _ := a.feeds.seen(source)
+		saved := a.saveFeedEntries(ctx, source, cfg.Token, cfg.Labels, entries, seen)
+		if err := a.feeds.remember(source, entries, seen); err != nil {
+			a.Logger.Warnf("Error saving feed state: %v", err)
+		}
+		if cfg.MarkRead && !a.Config.DryRun {
+			if err := miniflux.MarkRead(ctx, saved); err != nil {
+				a.Logger.Warnf("Error polling Miniflux at %s: %v", cfg.URL, err)
+			}
+		}
+	}
+}
+
+// saveFeedEntries saves up to feeds.max_items entries not yet seen for the
+// device with deviceToken, marking them seen, and returns the IDs of the
+// saved ones. URLs the device already synced are only marked seen.
+func (a *App) saveFeedEntries(ctx context.Context, source, deviceToken string, labels []string, entries []feeds.Entry, seen map[string]bool) []string {
+	user, err := a.getUser(ctx, deviceToken)
+	if err != nil {
+		a.Logger.Warnf("Error polling feed %s: %v", source, err)
+		return nil
+	}
+	var client *readeck.Client
+	var saved []string
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			continue
+		}
+		if a.Config.Feeds.MaxItems > 0 && len(saved) >= a.Config.Feeds.MaxItems {
+			break
+		}
+		if a.urls.lookup(user.Token, entry.URL) != "" {
+			seen[entry.ID] = true
+			continue
+		}
+
+		create := addOptions(user, readeck.CreateBookmarkOptions{Title: entry.Title, Labels: labels})
+		if a.Config.DryRun {
+			a.Logger.Infof("Dry run: would create bookmark for %s with labels %v from feed %s", entry.URL, create.Labels, source)
+			saved = append(saved, entry.ID)
+			continue
+		}
+		if client == nil {
+			if client, err = a.newReadeckClient(user); err != nil {
+				a.Logger.Warnf("Error initializing Readeck client for feed %s: %v", source, err)
+				return saved
+			}
+		}
+		id, err := client.CreateBookmark(ctx, entry.URL, create)
+		if err != nil {
+			a.Logger.Warnf("Error creating bookmark for %s from feed %s: %v", entry.URL, source, err)
+			continue
+		}
+		seen[entry.ID] = true
+		saved = append(saved, entry.ID)
+		if id != "" {
+			a.extractions.track(user.Token, entry.URL, id, create, 0)
+		}
+		a.Logger.Infof("Saved %s from feed %s for device %s", entry.URL, source, maskToken(user.Token))
+	}
+	if len(saved) > 0 && !a.Config.DryRun {
+		a.invalidateSyncResponses(user.Token)
+	}
+	return saved
+}
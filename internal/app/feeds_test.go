@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readecktest"
+)
+
+func TestPollFeeds(t *testing.T) {
+	var mu sync.Mutex
+	items := []string{"https://example.com/old"}
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<rss><channel>`)
+		for _, item := range items {
+			fmt.Fprintf(w, `<item><title>%s</title><link>%s</link></item>`, item[strings.LastIndex(item, "/")+1:], item)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	}))
+	defer feed.Close()
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+
+	statePath := filepath.Join(t.TempDir(), "feeds.json")
+	newFeedApp := func() *App {
+		app := NewApp(
+			WithConfig(&config.Config{
+				Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+				Readeck: config.ConfigReadeck{Host: mockServer.URL},
+				Feeds: config.ConfigFeeds{
+					File:     statePath,
+					MaxItems: 1,
+					Sources:  []config.FeedSource{{URL: feed.URL, Token: mockDeviceToken, Labels: []string{"news"}}},
+				},
+			}),
+			WithLogger(testLogger),
+		)
+		if err := app.LoadFeedState(); err != nil {
+			t.Fatalf("LoadFeedState failed: %v", err)
+		}
+		return app
+	}
+
+	app := newFeedApp()
+	app.pollFeeds(context.Background())
+	if created := mockServer.Created(); len(created) != 0 {
+		t.Fatalf("expected the entries listed at the first poll to be skipped, got %v", created)
+	}
+
+	mu.Lock()
+	items = append(items, "https://example.com/a", "https://example.com/b")
+	mu.Unlock()
+	app.pollFeeds(context.Background())
+	if created, want := mockServer.Created(), []string{"https://example.com/a"}; !slices.Equal(created, want) {
+		t.Fatalf("expected max_items to save %v, got %v", want, created)
+	}
+	if bookmark, _ := mockServer.Bookmark("created-1"); !slices.Equal(bookmark.Labels, []string{"news"}) {
+		t.Errorf("expected the bookmark to be labeled news, got %v", bookmark.Labels)
+	}
+
+	// A restart keeps the entries seen and saves the one left over.
+	app = newFeedApp()
+	app.pollFeeds(context.Background())
+	app.pollFeeds(context.Background())
+	if created, want := mockServer.Created(), []string{"https://example.com/a", "https://example.com/b"}; !slices.Equal(created, want) {
+		t.Errorf("expected %v, got %v", want, created)
+	}
+}
+
+func TestPollMiniflux(t *testing.T) {
+	var marked []any
+	miniflux := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			marked = body["entry_ids"].([]any)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, `{"entries":[{"id":1,"url":"https://example.com/1","title":"One"}]}`)
+	}))
+	defer miniflux.Close()
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+			Feeds: config.ConfigFeeds{
+				Miniflux: config.ConfigMiniflux{URL: miniflux.URL, APIKey: "api-key", Token: mockDeviceToken, MarkRead: true},
+			},
+		}),
+		WithLogger(testLogger),
+	)
+	app.pollFeeds(context.Background())
+	app.pollFeeds(context.Background())
+
+	if created, want := mockServer.Created(), []string{"https://example.com/1"}; !slices.Equal(created, want) {
+		t.Errorf("expected unread entries to be saved once, got %v", created)
+	}
+	if !slices.Equal(marked, []any{float64(1)}) {
+		t.Errorf("expected entry 1 to be marked read, got %v", marked)
+	}
+}
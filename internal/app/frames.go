@@ -0,0 +1,170 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Frame choices for animated images.
+const (
+	frameFirst          = "first"
+	frameRepresentative = "representative"
+)
+
+// maxRepresentativeBytes bounds the animations that are fully decoded to pick
+// a representative frame; larger ones use their first frame.
+const maxRepresentativeBytes = 5 << 20
+
+// decodeFrame decodes a single still image from data. Animated GIF and WebP
+// images give their first frame, or with frameRepresentative the GIF frame
+// with the most contrast. APNG images decode to their default image, which
+// is the first frame.
+func decodeFrame(data []byte, format, mode string) (image.Image, error) {
+	switch format {
+	case "gif":
+		if mode == frameRepresentative && len(data) <= maxRepresentativeBytes {
+			anim, err := gif.DecodeAll(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			return representativeGIFFrame(anim), nil
+		}
+	case "webp":
+		if frame, ok := webpFirstFrame(data); ok {
+			data = frame
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// representativeGIFFrame composes the frames of anim and returns the one
+// whose luminance varies the most, which skips blank or fading frames.
+func representativeGIFFrame(anim *gif.GIF) image.Image {
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	var best *image.RGBA
+	bestScore := -1.0
+
+	for i, frame := range anim.Image {
+		previous := canvas
+		if i < len(anim.Disposal) && anim.Disposal[i] == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		if score := luminanceVariance(canvas); score > bestScore {
+			best, bestScore = cloneRGBA(canvas), score
+		}
+
+		if i < len(anim.Disposal) {
+			switch anim.Disposal[i] {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				canvas = previous
+			}
+		}
+	}
+	return best
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(img.Rect)
+	copy(clone.Pix, img.Pix)
+	return clone
+}
+
+// luminanceVariance estimates the variance of the luminance of img from a
+// sample of its pixels.
+func luminanceVariance(img *image.RGBA) float64 {
+	var sum, sumSq, n float64
+	for i := 0; i+3 < len(img.Pix); i += 4 * 7 {
+		y := 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+		sum += y
+		sumSq += y * y
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
+
+// webpFirstFrame rewrites an animated WebP image as a still one holding its
+// first frame, which the WebP decoder can read. ok is false when data is not
+// an animation.
+func webpFirstFrame(data []byte) (frame []byte, ok bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false
+	}
+	anmf, err := findRIFFChunk(data[12:], "ANMF")
+	if err != nil || len(anmf) < 16 {
+		return nil, false
+	}
+
+	// The frame header holds its offset, size minus one, duration and flags.
+	width := int(uint32(anmf[6])|uint32(anmf[7])<<8|uint32(anmf[8])<<16) + 1
+	height := int(uint32(anmf[9])|uint32(anmf[10])<<8|uint32(anmf[11])<<16) + 1
+	chunks := anmf[16:]
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	if _, err := findRIFFChunk(chunks, "ALPH"); err == nil {
+		// Alpha data is only read from extended files.
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x10
+		putUint24(vp8x[4:], width-1)
+		putUint24(vp8x[7:], height-1)
+		writeRIFFChunk(&body, "VP8X", vp8x)
+	}
+	body.Write(chunks)
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	_ = binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), true
+}
+
+var errRIFFChunkNotFound = errors.New("RIFF chunk not found")
+
+// findRIFFChunk returns the payload of the first chunk with the given FourCC.
+func findRIFFChunk(data []byte, fourCC string) ([]byte, error) {
+	for len(data) >= 8 {
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size < 0 || size > len(data)-8 {
+			return nil, errRIFFChunkNotFound
+		}
+		if string(data[:4]) == fourCC {
+			return data[8 : 8+size], nil
+		}
+		next := 8 + size + size%2
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return nil, errRIFFChunkNotFound
+}
+
+func writeRIFFChunk(buf *bytes.Buffer, fourCC string, payload []byte) {
+	buf.WriteString(fourCC)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(payload)))
+	buf.Write(payload)
+	if len(payload)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
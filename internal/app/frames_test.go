@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestDecodeFrameGIF(t *testing.T) {
+	palette := color.Palette{color.White, color.Black}
+	blank := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	striped := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	for x := 0; x < 4; x += 2 {
+		for y := 0; y < 4; y++ {
+			striped.SetColorIndex(x, y, 1)
+		}
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{blank, striped, blank}, Delay: []int{10, 10, 10}}); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+
+	tests := []struct {
+		mode      string
+		wantBlack bool
+	}{
+		{mode: frameFirst, wantBlack: false},
+		{mode: frameRepresentative, wantBlack: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			img, err := decodeFrame(buf.Bytes(), "gif", tt.mode)
+			if err != nil {
+				t.Fatalf("decodeFrame() error = %v", err)
+			}
+			r, _, _, _ := img.At(0, 0).RGBA()
+			if gotBlack := r == 0; gotBlack != tt.wantBlack {
+				t.Errorf("expected black pixel %v, got red %d", tt.wantBlack, r)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameAnimatedWebP(t *testing.T) {
+	// A 1x1 lossless still image, wrapped into a one-frame animation.
+	still := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+	vp8l := still[12:]
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	writeRIFFChunk(&body, "VP8X", []byte{0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	writeRIFFChunk(&body, "ANIM", make([]byte, 6))
+	writeRIFFChunk(&body, "ANMF", append(make([]byte, 16), vp8l...))
+	var animated bytes.Buffer
+	animated.WriteString("RIFF")
+	_ = binary.Write(&animated, binary.LittleEndian, uint32(body.Len()))
+	animated.Write(body.Bytes())
+
+	if _, _, err := image.Decode(bytes.NewReader(animated.Bytes())); err == nil {
+		t.Fatal("expected the animation not to decode directly")
+	}
+	img, err := decodeFrame(animated.Bytes(), "webp", frameFirst)
+	if err != nil {
+		t.Fatalf("decodeFrame() error = %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Errorf("expected a 1x1 frame, got %v", b)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"readeckobo/internal/config"
+)
+
+// defaultImageUserAgent is sent when images.user_agent is unset, as some
+// websites block Go's default User-Agent.
+const defaultImageUserAgent = "Mozilla/5.0 (compatible; readeckobo; +https://github.com/eleith/readeckobo)"
+
+// imageFetch is how images are fetched from one host.
+type imageFetch struct {
+	userAgent string
+	referer   bool
+	headers   map[string]string
+}
+
+// imageFetchFor resolves images.user_agent, images.referer and
+// images.headers for host, applying its domain override if any.
+func (a *App) imageFetchFor(host string) imageFetch {
+	cfg := a.Config.Images
+	fetch := imageFetch{userAgent: cfg.UserAgent, referer: cfg.Referer, headers: make(map[string]string, len(cfg.Headers))}
+	for name, value := range cfg.Headers {
+		fetch.headers[http.CanonicalHeaderKey(name)] = value
+	}
+
+	if domain := imageDomain(cfg.Domains, host); domain != nil {
+		if domain.UserAgent != "" {
+			fetch.userAgent = domain.UserAgent
+		}
+		if domain.Referer != nil {
+			fetch.referer = *domain.Referer
+		}
+		for name, value := range domain.Headers {
+			fetch.headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	if fetch.userAgent == "" {
+		fetch.userAgent = defaultImageUserAgent
+	}
+	return fetch
+}
+
+// setImageFetchHeaders sets the User-Agent, Referer and extra headers of a
+// request for an image of the article at articleURL, which may be empty.
+func (a *App) setImageFetchHeaders(req *http.Request, articleURL string) {
+	fetch := a.imageFetchFor(req.URL.Hostname())
+	req.Header.Set("User-Agent", fetch.userAgent)
+	if fetch.referer && articleURL != "" {
+		req.Header.Set("Referer", articleURL)
+	}
+	for name, value := range fetch.headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// imageDomain returns the most specific override matching host or one of its
+// parent domains, or nil.
+func imageDomain(domains []config.ConfigImageDomain, host string) *config.ConfigImageDomain {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	var best *config.ConfigImageDomain
+	for i := range domains {
+		domain := strings.ToLower(strings.TrimPrefix(domains[i].Domain, "."))
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		if best == nil || len(domain) > len(strings.TrimPrefix(best.Domain, ".")) {
+			best = &domains[i]
+		}
+	}
+	return best
+}
+
+// articleReferer returns the referer query parameter of a convert-image
+// request when it is an http(s) URL.
+func articleReferer(r *http.Request) string {
+	referer := r.URL.Query().Get("referer")
+	u, err := url.Parse(referer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return referer
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestImageDomain(t *testing.T) {
+	domains := []config.ConfigImageDomain{
+		{Domain: "example.com", UserAgent: "a"},
+		{Domain: "cdn.example.com", UserAgent: "b"},
+		{Domain: ".Other.org", UserAgent: "c"},
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "a"},
+		{"img.example.com", "a"},
+		{"a.cdn.example.com", "b"},
+		{"CDN.example.com.", "b"},
+		{"other.org", "c"},
+		{"notexample.com", ""},
+		{"example.com.evil.net", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got := ""
+			if domain := imageDomain(domains, tt.host); domain != nil {
+				got = domain.UserAgent
+			}
+			if got != tt.want {
+				t.Errorf("imageDomain(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleConvertImageFetchHeaders(t *testing.T) {
+	noReferer := false
+	tests := []struct {
+		name        string
+		images      config.ConfigImages
+		referer     string
+		wantAgent   string
+		wantReferer string
+		wantHeaders map[string]string
+	}{
+		{
+			name:      "default user agent",
+			wantAgent: defaultImageUserAgent,
+		},
+		{
+			name:        "user agent, referer and headers",
+			images:      config.ConfigImages{UserAgent: "Mozilla/5.0 test", Referer: true, Headers: map[string]string{"accept": "image/*"}},
+			referer:     "https://news.example.com/article",
+			wantAgent:   "Mozilla/5.0 test",
+			wantReferer: "https://news.example.com/article",
+			wantHeaders: map[string]string{"Accept": "image/*"},
+		},
+		{
+			name:      "referer must be a web URL",
+			images:    config.ConfigImages{Referer: true},
+			referer:   "javascript:alert(1)",
+			wantAgent: defaultImageUserAgent,
+		},
+		{
+			name: "domain override",
+			images: config.ConfigImages{
+				UserAgent: "Mozilla/5.0 test",
+				Referer:   true,
+				Headers:   map[string]string{"Accept": "image/*", "X-Global": "1"},
+				Domains: []config.ConfigImageDomain{
+					{Domain: "127.0.0.1", UserAgent: "Mozilla/5.0 override", Referer: &noReferer, Headers: map[string]string{"accept": "image/jpeg"}},
+				},
+			},
+			referer:     "https://news.example.com/article",
+			wantAgent:   "Mozilla/5.0 override",
+			wantHeaders: map[string]string{"Accept": "image/jpeg", "X-Global": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			imgSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				http.NotFound(w, r)
+			}))
+			defer imgSrv.Close()
+
+			app := NewApp(WithConfig(&config.Config{Images: tt.images}), WithLogger(testLogger))
+			query := url.Values{"url": {imgSrv.URL}}
+			if tt.referer != "" {
+				query.Set("referer", tt.referer)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/convert-image?"+query.Encode(), nil)
+			app.HandleConvertImage(httptest.NewRecorder(), req)
+
+			if got == nil {
+				t.Fatal("image was not fetched")
+			}
+			if agent := got.Get("User-Agent"); agent != tt.wantAgent {
+				t.Errorf("expected User-Agent %q, got %q", tt.wantAgent, agent)
+			}
+			if referer := got.Get("Referer"); referer != tt.wantReferer {
+				t.Errorf("expected Referer %q, got %q", tt.wantReferer, referer)
+			}
+			for name, want := range tt.wantHeaders {
+				if value := got.Get(name); value != want {
+					t.Errorf("expected header %s %q, got %q", name, want, value)
+				}
+			}
+		})
+	}
+}
+
+func TestProfileImageURLReferer(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{Images: config.ConfigImages{
+		Referer: true,
+		Domains: []config.ConfigImageDomain{{Domain: "cdn.example.com", Referer: new(bool)}},
+	}}))
+	req := httptest.NewRequest(http.MethodGet, "https://bridge.example.com/api/kobo/download", nil)
+	profile := &config.DeviceProfile{Model: "clara"}
+
+	got := app.profileImageURL(req, "http://example.com/image.png", "https://example.com/article", profile)
+	want := "https://bridge.example.com/instapaper-proxy/instapaper/api/convert-image?profile=clara&referer=https%3A%2F%2Fexample.com%2Farticle&url=http%3A%2F%2Fexample.com%2Fimage.png"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	got = app.profileImageURL(req, "http://cdn.example.com/image.png", "https://example.com/article", profile)
+	want = "https://bridge.example.com/instapaper-proxy/instapaper/api/convert-image?profile=clara&url=http%3A%2F%2Fcdn.example.com%2Fimage.png"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"golang.org/x/net/html"
+
+	"readeckobo/internal/config"
+)
+
+// imageLimit is the most images an article downloaded by user carries, 0
+// for no limit: the user's max_images, else download.max_images, tightened
+// by the images the device asks for. Kobos send 1, Pocket's flag for
+// articles with images, so only larger values are read as a count.
+func (a *App) imageLimit(user *config.User, requested int) int {
+	limit := user.MaxImages
+	if limit == 0 {
+		limit = a.Config.Download.MaxImages
+	}
+	if requested > 1 && (limit == 0 || requested < limit) {
+		limit = requested
+	}
+	return limit
+}
+
+// dropImages removes the article images of doc after the first limit, which
+// include its lead image, so that slow connections download fewer. Math and
+// code images stand for text and are kept, as are the QR codes of videos.
+func dropImages(doc *html.Node, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	var kept, dropped int
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" && !isMathImage(n) && !isCodeImage(n) && !isQRCodeImage(n) {
+			if kept < limit {
+				kept++
+			} else if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+				dropped++
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			walk(c)
+			c = next
+		}
+	}
+	walk(doc)
+	return dropped
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"readeckobo/internal/config"
+)
+
+func TestImageLimit(t *testing.T) {
+	testCases := []struct {
+		name      string
+		download  int
+		user      int
+		requested int
+		expected  int
+	}{
+		{name: "no limit", expected: 0},
+		{name: "pocket's images flag", requested: 1, expected: 0},
+		{name: "download limit", download: 10, requested: 1, expected: 10},
+		{name: "device override", download: 10, user: 3, expected: 3},
+		{name: "device asks for fewer", download: 10, user: 5, requested: 2, expected: 2},
+		{name: "device asks for more", download: 10, requested: 20, expected: 10},
+		{name: "device asks without a configured limit", requested: 4, expected: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := NewApp(WithConfig(&config.Config{Download: config.ConfigDownload{MaxImages: tc.download}}), WithLogger(testLogger))
+			if got := app.imageLimit(&config.User{MaxImages: tc.user}, tc.requested); got != tc.expected {
+				t.Errorf("expected limit %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDropImages(t *testing.T) {
+	const article = `<figure><img src="hero.jpg"></figure><p><img src="a.jpg"><img src="b.jpg"></p>` +
+		`<p><img class="` + mathClass + `" src="math.png"></p><p><img src="c.jpg"></p>`
+
+	testCases := []struct {
+		name            string
+		limit           int
+		expectedDropped int
+		expectedSrcs    []string
+	}{
+		{name: "no limit", limit: 0, expectedSrcs: []string{"hero.jpg", "a.jpg", "b.jpg", "math.png", "c.jpg"}},
+		{name: "hero image only", limit: 1, expectedDropped: 3, expectedSrcs: []string{"hero.jpg", "math.png"}},
+		{name: "first images", limit: 2, expectedDropped: 2, expectedSrcs: []string{"hero.jpg", "a.jpg", "math.png"}},
+		{name: "limit above the count", limit: 10, expectedSrcs: []string{"hero.jpg", "a.jpg", "b.jpg", "math.png", "c.jpg"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(article))
+			if err != nil {
+				t.Fatalf("Failed to parse article: %v", err)
+			}
+			if dropped := dropImages(doc, tc.limit); dropped != tc.expectedDropped {
+				t.Errorf("expected %d dropped images, got %d", tc.expectedDropped, dropped)
+			}
+
+			var srcs []string
+			for n := range doc.Descendants() {
+				if n.Type == html.ElementNode && n.Data == "img" {
+					srcs = append(srcs, getAttr(n, "src"))
+				}
+			}
+			if strings.Join(srcs, " ") != strings.Join(tc.expectedSrcs, " ") {
+				t.Errorf("expected images %v, got %v", tc.expectedSrcs, srcs)
+			}
+		})
+	}
+}
+
+func TestHandleKoboDownloadImageLimit(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/bookmarks" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id":"1","title":"Test Article","url":"http://example.com/article1"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><p><img src="http://example.com/1.png"><img src="http://example.com/2.png"><img src="http://example.com/3.png"></p></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:    []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck:  config.ConfigReadeck{Host: mockServer.URL},
+			Download: config.ConfigDownload{MaxImages: 5},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	form := url.Values{"access_token": {mockDeviceToken}, "url": {"http://example.com/article1"}, "images": {"2"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/kobo/download", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	app.HandleKoboDownload(rr, req)
+
+	var resp struct {
+		Article string `json:"article"`
+		Images  map[string]struct {
+			Src string `json:"src"`
+		} `json:"images"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Images) != 2 || resp.Images["0"].Src != "http://example.com/1.png" || resp.Images["1"].Src != "http://example.com/2.png" {
+		t.Errorf("expected the first two images, got %v", resp.Images)
+	}
+	if strings.Contains(resp.Article, "<img") || strings.Contains(resp.Article, "IMG_2") {
+		t.Errorf("expected two image placeholders, got %q", resp.Article)
+	}
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// Defaults used when the corresponding images setting is unset.
+const (
+	defaultMaxImageBytes  = 20 << 20
+	defaultMaxImagePixels = 50_000_000
+	defaultSVGWidth       = 1200
+	defaultSVGHeight      = 1600
+)
+
+var errImageTooLarge = errors.New("image too large")
+
+// imageOptions bounds the source images /api/convert-image accepts and sets
+// the box SVG images are rasterized into.
+type imageOptions struct {
+	maxBytes  int64
+	maxPixels int
+	svgWidth  int
+	svgHeight int
+	frame     string
+	// passthroughMaxBytes is the largest JPEG sent on unchanged; 0 disables
+	// the passthrough.
+	passthroughMaxBytes int64
+}
+
+func (a *App) imageOptions() imageOptions {
+	cfg := a.Config.Images
+	opts := imageOptions{maxBytes: cfg.MaxBytes, maxPixels: cfg.MaxPixels, svgWidth: cfg.SVGWidth, svgHeight: cfg.SVGHeight, frame: cfg.Frame, passthroughMaxBytes: cfg.PassthroughMaxBytes}
+	if opts.maxBytes <= 0 {
+		opts.maxBytes = defaultMaxImageBytes
+	}
+	if opts.maxPixels <= 0 {
+		opts.maxPixels = defaultMaxImagePixels
+	}
+	if opts.svgWidth <= 0 {
+		opts.svgWidth = defaultSVGWidth
+	}
+	if opts.svgHeight <= 0 {
+		opts.svgHeight = defaultSVGHeight
+	}
+	return opts
+}
+
+// decodeLimitedImage decodes an image of at most opts.maxBytes and
+// opts.maxPixels.
+func decodeLimitedImage(r io.Reader, contentLength int64, opts imageOptions) (image.Image, error) {
+	data, err := readLimitedImage(r, contentLength, opts.maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(data, opts)
+}
+
+// readLimitedImage reads an image of at most maxBytes, rejecting it early
+// when its declared length is already too large.
+func readLimitedImage(r io.Reader, contentLength, maxBytes int64) ([]byte, error) {
+	if contentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", errImageTooLarge, contentLength, maxBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", errImageTooLarge, maxBytes)
+	}
+	return data, nil
+}
+
+// decodeImage decodes data after checking its dimensions from the header,
+// so that a small file cannot expand into an image that exhausts memory.
+// SVG images are rasterized instead.
+func decodeImage(data []byte, opts imageOptions) (image.Image, error) {
+	if isSVG(data) {
+		return rasterizeSVG(data, opts.svgWidth, opts.svgHeight)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > opts.maxPixels/cfg.Height {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", errImageTooLarge, cfg.Width, cfg.Height, opts.maxPixels)
+	}
+
+	return decodeFrame(data, format, opts.frame)
+}
+
+// isSVG reports whether data looks like an SVG document. The content is
+// sniffed because servers often label SVG images as text or XML.
+func isSVG(data []byte) bool {
+	head := bytes.ToLower(data[:min(len(data), 1024)])
+	return bytes.Contains(head, []byte("<svg"))
+}
+
+// rasterizeSVG draws an SVG image on a white background, scaled to fit
+// within width by height while keeping its aspect ratio.
+func rasterizeSVG(data []byte, width, height int) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SVG: %w", err)
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return nil, errors.New("failed to parse SVG: missing size")
+	}
+
+	scale := math.Min(float64(width)/icon.ViewBox.W, float64(height)/icon.ViewBox.H)
+	w := max(1, int(icon.ViewBox.W*scale))
+	h := max(1, int(icon.ViewBox.H*scale))
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	icon.SetTarget(0, 0, float64(w), float64(h))
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+	return img, nil
+}
+
+// writeDrawnImage sends an image drawn by readeckobo, such as a formula or a
+// code block, scaled down to the device's screen. It is a PNG, which keeps
+// text sharp, unless the device's profile rules that out.
+func (a *App) writeDrawnImage(w http.ResponseWriter, r *http.Request, img *image.RGBA, endpoint string) {
+	profile := a.imageProfile(r)
+	img = fitImage(img, profile)
+	format := "png"
+	if profile != nil && len(profile.Formats) > 0 && !slices.Contains(profile.Formats, "png") {
+		format = "jpeg"
+	}
+
+	w.Header().Set("Content-Type", "image/"+format)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	counted := &countingWriter{w: w}
+	var err error
+	if format == "png" {
+		err = png.Encode(counted, img)
+	} else {
+		err = jpeg.Encode(counted, img, &jpeg.Options{Quality: jpegQuality(profile)})
+	}
+	a.countStats("", deviceStats{ImageBytesServed: counted.n})
+	if err != nil {
+		a.Logger.Errorf("Failed to encode %s in %s: %v, URL: %s, Params: %v", format, endpoint, err, r.URL.Path, r.URL.Query())
+	}
+}
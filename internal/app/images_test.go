@@ -0,0 +1,62 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestDecodeLimitedImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 100))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	data := buf.Bytes()
+
+	tests := []struct {
+		name          string
+		contentLength int64
+		maxBytes      int64
+		maxPixels     int
+		wantTooLarge  bool
+	}{
+		{name: "within limits", contentLength: int64(len(data)), maxBytes: 1 << 20, maxPixels: 10_000},
+		{name: "unknown length", contentLength: -1, maxBytes: 1 << 20, maxPixels: 10_000},
+		{name: "declared length too large", contentLength: 2 << 20, maxBytes: 1 << 20, maxPixels: 10_000, wantTooLarge: true},
+		{name: "streamed bytes too large", contentLength: -1, maxBytes: int64(len(data)) - 1, maxPixels: 10_000, wantTooLarge: true},
+		{name: "too many pixels", contentLength: int64(len(data)), maxBytes: 1 << 20, maxPixels: 9_999, wantTooLarge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := decodeLimitedImage(bytes.NewReader(data), tt.contentLength, imageOptions{maxBytes: tt.maxBytes, maxPixels: tt.maxPixels})
+			if got := errors.Is(err, errImageTooLarge); got != tt.wantTooLarge {
+				t.Fatalf("expected too large %v, got error %v", tt.wantTooLarge, err)
+			}
+			if !tt.wantTooLarge && (err != nil || img.Bounds().Dx() != 100) {
+				t.Errorf("expected a 100px image, got %v, %v", img, err)
+			}
+		})
+	}
+}
+
+func TestRasterizeSVG(t *testing.T) {
+	svg := `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100"><rect x="0" y="0" width="100" height="100" fill="#000"/></svg>`
+
+	img, err := decodeLimitedImage(bytes.NewReader([]byte(svg)), -1, imageOptions{maxBytes: 1 << 20, maxPixels: 1, svgWidth: 400, svgHeight: 400})
+	if err != nil {
+		t.Fatalf("decodeLimitedImage() error = %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 400 || b.Dy() != 200 {
+		t.Errorf("expected 400x200, got %dx%d", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := img.At(50, 100).RGBA(); r != 0 {
+		t.Errorf("expected the rectangle to be black, got red %d", r)
+	}
+	if r, _, _, _ := img.At(350, 100).RGBA(); r != 0xffff {
+		t.Errorf("expected a white background, got red %d", r)
+	}
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Paths on the Kobo's user partition, mounted at /mnt/onboard on the device.
+const (
+	koboOnboard          = "/mnt/onboard"
+	nickelMenuConfigPath = ".adds/nm/readeckobo"
+	configureScriptPath  = ".adds/readeckobo/configure.sh"
+)
+
+// koboFile is a file installed on the Kobo.
+type koboFile struct {
+	path    string
+	mode    int64
+	content string
+}
+
+// koboSetupFiles returns a NickelMenu entry and the script it runs to point
+// "Kobo eReader.conf" at readeckobo. The script edits only the three settings
+// involved, and the Kobo reboots afterwards so Nickel picks them up.
+func koboSetupFiles(bridgeURL, encryptedToken string) []koboFile {
+	script := fmt.Sprintf(`#!/bin/sh
+# Points this Kobo at readeckobo. Generated by readeckobo.
+CONF="%s/.kobo/Kobo/Kobo eReader.conf"
+
+set_key() {
+	awk -v section="[$1]" -v key="$2" -v value="$3" '
+		$0 == section { print; in_section = 1; next }
+		/^\[/ { if (in_section && !done) { print key "=" value; done = 1 } in_section = 0 }
+		in_section && index($0, key "=") == 1 { if (!done) { print key "=" value; done = 1 } next }
+		{ print }
+		END { if (!done) { if (!in_section) print section; print key "=" value } }
+	' "$CONF" > "$CONF.tmp" && mv "$CONF.tmp" "$CONF"
+}
+
+set_key OneStoreServices api_endpoint %s
+set_key OneStoreServices instapaper_env_url %s
+set_key Instapaper AccessToken %s
+sync
+`, koboOnboard, shellQuote(bridgeURL+"/instapaper-proxy/storeapi"), shellQuote(bridgeURL+"/instapaper-proxy/instapaper"), shellQuote("@ByteArray("+encryptedToken+")"))
+
+	menu := fmt.Sprintf(`# Generated by readeckobo.
+menu_item:main:Connect to readeckobo:cmd_spawn:quiet:/bin/sh %s/%s
+  chain_success:power:reboot
+`, koboOnboard, configureScriptPath)
+
+	return []koboFile{
+		{path: nickelMenuConfigPath, mode: 0644, content: menu},
+		{path: configureScriptPath, mode: 0755, content: script},
+	}
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseBridgeURL checks a bridge URL submitted in a form, which ends up in
+// the script run on the Kobo, and returns it without a trailing slash.
+func parseBridgeURL(raw string) (string, error) {
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "/")
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.User != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return "", fmt.Errorf("bridge URL %q must be an http or https URL without a query or fragment", raw)
+	}
+	return raw, nil
+}
+
+// HandleSetupDownload serves the setup files for a device created by the
+// setup wizard, either as a KoboRoot.tgz the Kobo installs on reboot or as a
+// zip to extract onto the Kobo's drive.
+func (a *App) HandleSetupDownload(w http.ResponseWriter, r *http.Request) {
+	deviceToken := r.FormValue("device_token")
+	serial := strings.TrimSpace(r.FormValue("serial"))
+	bridgeURL, bridgeErr := parseBridgeURL(r.FormValue("bridge_url"))
+	if _, err := a.getUser(r.Context(), deviceToken); err != nil || serial == "" || bridgeErr != nil {
+		http.Error(w, "Unknown device, serial number or bridge URL", http.StatusBadRequest)
+		return
+	}
+
+	encrypted, err := encryptDeviceToken(deviceToken, serial)
+	if err != nil {
+		http.Error(w, "Failed to encrypt the device token", http.StatusInternalServerError)
+		a.Logger.Errorf("Error encrypting device token in /setup/download: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	files := koboSetupFiles(bridgeURL, encrypted)
+
+	var buf bytes.Buffer
+	var filename, contentType string
+	switch r.FormValue("format") {
+	case "zip":
+		filename, contentType = "readeckobo-nickelmenu.zip", "application/zip"
+		err = writeKoboZip(&buf, files)
+	default:
+		filename, contentType = "KoboRoot.tgz", "application/gzip"
+		err = writeKoboRoot(&buf, files)
+	}
+	if err != nil {
+		http.Error(w, "Failed to build the archive", http.StatusInternalServerError)
+		a.Logger.Errorf("Error building %s in /setup/download: %v, URL: %s, Params: %v", filename, err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writeKoboRoot writes files as a KoboRoot.tgz, which the Kobo extracts
+// relative to / on the next boot.
+func writeKoboRoot(buf *bytes.Buffer, files []koboFile) error {
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(koboOnboard, "/") + "/" + f.path,
+			Mode:    f.mode,
+			Size:    int64(len(f.content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeKoboZip writes files as a zip to extract at the root of the Kobo's drive.
+func writeKoboZip(buf *bytes.Buffer, files []koboFile) error {
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		header := &zip.FileHeader{Name: f.path, Method: zip.Deflate, Modified: time.Now()}
+		header.SetMode(0644)
+		if f.mode&0111 != 0 {
+			header.SetMode(0755)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
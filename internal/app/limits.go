@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// hasSyncLimits reports whether the user bounds what their device receives.
+func hasSyncLimits(user *config.User) bool {
+	return user.MaxItems > 0 || user.MaxArticleAgeDays > 0 || user.MinWordCount > 0 ||
+		len(user.Labels) > 0 || !user.SyncsArchived()
+}
+
+// applySyncLimits drops the unread items in resultList that are older than
+// the user's max_article_age_days, shorter than min_word_count, without one
+// of their labels, or beyond the newest max_items unread bookmarks, and the
+// archived items when sync_archived is off. A full sync leaves them out; an
+// incremental sync turns them into deletions so they leave the device. It
+// returns how many items it removed.
+func (a *App) applySyncLimits(ctx context.Context, readeckClient *readeck.Client, user *config.User, resultList map[string]models.KoboArticleItem, fullSync bool) (int, error) {
+	var newest map[string]bool
+	if user.MaxItems > 0 {
+		isArchived := false
+		bookmarks, _, err := readeckClient.ListBookmarks(ctx, readeck.ListBookmarksOptions{IsArchived: &isArchived, Limit: user.MaxItems, Sort: fullSyncSort})
+		if err != nil {
+			return 0, fmt.Errorf("failed to list newest bookmarks: %w", err)
+		}
+		newest = make(map[string]bool, len(bookmarks))
+		for _, bookmark := range bookmarks {
+			newest[bookmark.ID] = true
+		}
+	}
+
+	var cutoff int64
+	if user.MaxArticleAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -user.MaxArticleAgeDays).Unix()
+	}
+
+	removed := 0
+	for id, entry := range resultList {
+		switch entry.Status {
+		case "0":
+			if (newest == nil || newest[id]) && entry.TimeAdded >= cutoff && entry.WordCount >= user.MinWordCount && hasLabel(entry, user.Labels) {
+				continue
+			}
+		case "1":
+			if user.SyncsArchived() {
+				continue
+			}
+		default:
+			continue
+		}
+
+		removed++
+		if fullSync {
+			delete(resultList, id)
+		} else {
+			resultList[id] = models.KoboArticleItem{ItemID: id, Status: "2"}
+		}
+	}
+	a.Logger.Debugf("Sync limits removed %d items.", removed)
+
+	return removed, nil
+}
+
+// hasLabel reports whether entry has one of labels, or labels is empty.
+func hasLabel(entry models.KoboArticleItem, labels []string) bool {
+	if len(labels) == 0 {
+		return true
+	}
+	for _, label := range labels {
+		if _, ok := entry.Tags[label]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+func TestApplySyncLimits(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/bookmarks" || r.URL.Query().Get("limit") != "3" || r.URL.Query().Get("is_archived") != "false" {
+			t.Errorf("unexpected request %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		_ = json.NewEncoder(w).Encode([]readeck.Bookmark{{ID: "recent"}, {ID: "short"}, {ID: "old"}})
+	}))
+	defer mockServer.Close()
+
+	readeckClient, err := readeck.NewClient(mockServer.URL, "test-token", testLogger, mockServer.Client())
+	if err != nil {
+		t.Fatalf("Failed to create readeck client: %v", err)
+	}
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger))
+	user := &config.User{MaxItems: 3, MaxArticleAgeDays: 30, MinWordCount: 200}
+
+	now := time.Now()
+	newResultList := func() map[string]models.KoboArticleItem {
+		return map[string]models.KoboArticleItem{
+			"recent":   {ItemID: "recent", Status: "0", TimeAdded: now.Unix(), WordCount: 500},
+			"short":    {ItemID: "short", Status: "0", TimeAdded: now.Unix(), WordCount: 50},
+			"old":      {ItemID: "old", Status: "0", TimeAdded: now.AddDate(0, 0, -60).Unix(), WordCount: 500},
+			"beyond":   {ItemID: "beyond", Status: "0", TimeAdded: now.Unix(), WordCount: 500},
+			"archived": {ItemID: "archived", Status: "1", TimeAdded: now.AddDate(-1, 0, 0).Unix()},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		fullSync bool
+	}{
+		{name: "full sync", fullSync: true},
+		{name: "incremental sync", fullSync: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultList := newResultList()
+
+			removed, err := app.applySyncLimits(context.Background(), readeckClient, user, resultList, tt.fullSync)
+			if err != nil {
+				t.Fatalf("applySyncLimits failed: %v", err)
+			}
+
+			if removed != 3 {
+				t.Errorf("expected 3 items removed, got %d", removed)
+			}
+			for _, id := range []string{"recent", "archived"} {
+				if item := resultList[id]; item.Status == "2" || item.ItemID == "" {
+					t.Errorf("expected %s to be kept, got %+v", id, item)
+				}
+			}
+			for _, id := range []string{"short", "old", "beyond"} {
+				item, ok := resultList[id]
+				if tt.fullSync && ok {
+					t.Errorf("expected %s to be left out, got %+v", id, item)
+				}
+				if !tt.fullSync && item.Status != "2" {
+					t.Errorf("expected %s to be deleted from the device, got %+v", id, item)
+				}
+			}
+		})
+	}
+}
+
+func TestApplySyncLimitsLabelsAndArchived(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger))
+	syncArchived := false
+	user := &config.User{Labels: []string{"kobo"}, SyncArchived: &syncArchived}
+
+	resultList := map[string]models.KoboArticleItem{
+		"labeled":   {ItemID: "labeled", Status: "0", Tags: map[string]models.KoboTag{"kobo": {ItemID: "labeled", Tag: "kobo"}}},
+		"unlabeled": {ItemID: "unlabeled", Status: "0"},
+		"archived":  {ItemID: "archived", Status: "1", Tags: map[string]models.KoboTag{"kobo": {ItemID: "archived", Tag: "kobo"}}},
+		"deleted":   {ItemID: "deleted", Status: "2"},
+	}
+	removed, err := app.applySyncLimits(context.Background(), nil, user, resultList, false)
+	if err != nil {
+		t.Fatalf("applySyncLimits failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 items removed, got %d", removed)
+	}
+	want := map[string]string{"labeled": "0", "unlabeled": "2", "archived": "2", "deleted": "2"}
+	for id, status := range want {
+		if got := resultList[id].Status; got != status {
+			t.Errorf("expected %s to have status %q, got %q", id, status, got)
+		}
+	}
+}
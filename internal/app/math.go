@@ -0,0 +1,316 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/storeapi"
+)
+
+// maxFormulaLength bounds the TeX rendered by /api/math, in bytes.
+const maxFormulaLength = 2000
+
+// mathClass marks the images that formulas were replaced with.
+const mathClass = "math"
+
+// texDelimiters open and close formulas written as TeX in the text of an
+// article; single dollars are left alone as they are usually prices.
+var texDelimiters = []struct {
+	open, close string
+	display     bool
+}{
+	{`\(`, `\)`, false},
+	{`\[`, `\]`, true},
+	{`$$`, `$$`, true},
+}
+
+// formula is math markup found in an article, with the TeX it is drawn from.
+type formula struct {
+	node    *html.Node
+	tex     string
+	display bool
+}
+
+// replaceMath replaces the formulas of an article with images of them, whose
+// URL imageURL returns. It finds MathML, including the MathML that KaTeX
+// and MathJax render along with their HTML, MathJax's TeX scripts, and TeX
+// between delimiters in text. It runs before sanitizeArticle, which drops
+// scripts.
+func replaceMath(doc *html.Node, imageURL func(tex string, display bool) string) {
+	var formulas []formula
+	var rendered, texts []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				if strings.Contains(c.Data, `\(`) || strings.Contains(c.Data, `\[`) || strings.Contains(c.Data, `$$`) {
+					texts = append(texts, c)
+				}
+			case c.Type != html.ElementNode || literalElements[c.DataAtom]:
+			case c.DataAtom == atom.Script:
+				if typ := strings.ToLower(getAttr(c, "type")); strings.HasPrefix(typ, "math/tex") {
+					formulas = append(formulas, formula{c, textContent(c), strings.Contains(typ, "mode=display")})
+				}
+			case c.Data == "math" || isMathContainer(c):
+				if f, ok := mathFormula(c); ok {
+					formulas = append(formulas, f)
+				} else if !isMathJaxRendering(c) {
+					walk(c)
+				}
+			case isMathJaxRendering(c):
+				// MathJax 2 draws a formula next to the script holding its
+				// TeX, which is replaced instead.
+				rendered = append(rendered, c)
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(doc)
+
+	for _, f := range formulas {
+		if tex := strings.TrimSpace(f.tex); tex != "" && f.node.Parent != nil {
+			f.node.Parent.InsertBefore(mathImage(imageURL(tex, f.display), tex, f.display), f.node)
+		}
+		if f.node.Parent != nil {
+			f.node.Parent.RemoveChild(f.node)
+		}
+	}
+	for _, n := range rendered {
+		if n.Parent != nil && hasMathImage(n.Parent) {
+			n.Parent.RemoveChild(n)
+		}
+	}
+	for _, n := range texts {
+		replaceTeXText(n, imageURL)
+	}
+}
+
+// mathFormula reads the formula of a math element, or of the KaTeX or
+// MathJax element holding one.
+func mathFormula(n *html.Node) (formula, bool) {
+	math := n
+	if n.Data != "math" {
+		math = nil
+		walkElements(n, func(c *html.Node) {
+			if math == nil && c.Data == "math" {
+				math = c
+			}
+		})
+		if math == nil {
+			return formula{}, false
+		}
+	}
+	display := getAttr(math, "display") == "block" || getAttr(n, "display") == "true" ||
+		slices.Contains(strings.Fields(getAttr(n, "class")), "katex-display")
+
+	var tex string
+	walkElements(math, func(c *html.Node) {
+		if tex == "" && c.Data == "annotation" && getAttr(c, "encoding") == "application/x-tex" {
+			tex = textContent(c)
+		}
+	})
+	if tex == "" {
+		tex = mathMLToTeX(math)
+	}
+	return formula{n, tex, display}, true
+}
+
+// isMathContainer reports whether n is a KaTeX or MathJax 3 element, which
+// holds MathML along with the HTML that draws it.
+func isMathContainer(n *html.Node) bool {
+	if n.Data == "mjx-container" {
+		return true
+	}
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		if class == "katex" || class == "katex-display" {
+			return true
+		}
+	}
+	return false
+}
+
+// isMathJaxRendering reports whether n is one of the elements MathJax 2
+// draws a formula with.
+func isMathJaxRendering(n *html.Node) bool {
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		if strings.HasPrefix(class, "MathJax") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMathImage reports whether a child of n is the image of a formula.
+func hasMathImage(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Img && isMathImage(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceTeXText replaces the delimited formulas of a text node with images.
+func replaceTeXText(n *html.Node, imageURL func(tex string, display bool) string) {
+	text := n.Data
+	var nodes []*html.Node
+	for {
+		start, end := -1, -1
+		var delim int
+		for i, d := range texDelimiters {
+			s := strings.Index(text, d.open)
+			if s < 0 || start >= 0 && s >= start {
+				continue
+			}
+			e := strings.Index(text[s+len(d.open):], d.close)
+			if e < 0 {
+				continue
+			}
+			start, end, delim = s, s+len(d.open)+e, i
+		}
+		if start < 0 {
+			break
+		}
+		d := texDelimiters[delim]
+		tex := strings.TrimSpace(text[start+len(d.open) : end])
+		if start > 0 {
+			nodes = append(nodes, &html.Node{Type: html.TextNode, Data: text[:start]})
+		}
+		if tex != "" {
+			nodes = append(nodes, mathImage(imageURL(tex, d.display), tex, d.display))
+		}
+		text = text[end+len(d.close):]
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	if text != "" {
+		nodes = append(nodes, &html.Node{Type: html.TextNode, Data: text})
+	}
+	for _, node := range nodes {
+		n.Parent.InsertBefore(node, n)
+	}
+	n.Parent.RemoveChild(n)
+}
+
+func mathImage(src, tex string, display bool) *html.Node {
+	img := &html.Node{Type: html.ElementNode, DataAtom: atom.Img, Data: atom.Img.String()}
+	setAttr(img, "src", src)
+	setAttr(img, "alt", tex)
+	class := mathClass
+	if display {
+		class += " display"
+	}
+	setAttr(img, "class", class)
+	return img
+}
+
+// isMathImage reports whether img is the image of a formula.
+func isMathImage(img *html.Node) bool {
+	return slices.Contains(strings.Fields(getAttr(img, "class")), mathClass)
+}
+
+// mathMLToTeX writes MathML as TeX for renderFormula, for math elements
+// without a TeX annotation.
+func mathMLToTeX(n *html.Node) string {
+	var children []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			if text := strings.TrimSpace(c.Data); text != "" {
+				children = append(children, escapeTeX(text))
+			}
+		case c.Type == html.ElementNode && c.Data != "annotation" && c.Data != "annotation-xml":
+			children = append(children, mathMLToTeX(c))
+		}
+	}
+	arg := func(i int) string {
+		if i < len(children) {
+			return "{" + children[i] + "}"
+		}
+		return "{}"
+	}
+
+	switch n.Data {
+	case "mi":
+		if text := strings.TrimSpace(textContent(n)); len([]rune(text)) > 1 || getAttr(n, "mathvariant") == "normal" {
+			return `\mathrm{` + escapeTeX(text) + "}"
+		}
+	case "mtext":
+		return `\text{` + escapeTeX(textContent(n)) + "}"
+	case "mspace":
+		return `\,`
+	case "mfrac":
+		return `\frac` + arg(0) + arg(1)
+	case "msqrt":
+		return `\sqrt{` + strings.Join(children, " ") + "}"
+	case "mroot":
+		var index string
+		if len(children) > 1 {
+			index = children[1]
+		}
+		return `\sqrt[` + index + "]" + arg(0)
+	case "msup", "mover":
+		return arg(0) + "^" + arg(1)
+	case "msub", "munder":
+		return arg(0) + "_" + arg(1)
+	case "msubsup", "munderover":
+		return arg(0) + "_" + arg(1) + "^" + arg(2)
+	case "mfenced":
+		open, close := getAttr(n, "open"), getAttr(n, "close")
+		if open == "" && close == "" {
+			open, close = "(", ")"
+		}
+		return escapeTeX(open) + strings.Join(children, ",") + escapeTeX(close)
+	case "mtr":
+		return strings.Join(children, " & ") + ` \\ `
+	case "mphantom":
+		return ""
+	}
+	return strings.Join(children, " ")
+}
+
+// escapeTeX escapes the characters TeX gives a meaning to.
+func escapeTeX(text string) string {
+	return strings.NewReplacer(`\`, `\backslash `, "{", `\{`, "}", `\}`, "^", `\^`, "_", `\_`,
+		"&", `\&`, "%", `\%`, "$", `\$`, "#", `\#`, "~", `\~`).Replace(text)
+}
+
+// mathImageURL points at /api/math for the image of a formula.
+func (a *App) mathImageURL(r *http.Request, tex string, display bool) string {
+	query := url.Values{"tex": {tex}}
+	if display {
+		query.Set("display", "1")
+	}
+	return a.bridgeURL(r) + storeapi.InstapaperPath + "/api/math?" + query.Encode()
+}
+
+// HandleMath draws the TeX formula in the tex parameter, for the formulas
+// replaced with images in downloaded articles. The image is scaled down to
+// the device's screen.
+func (a *App) HandleMath(w http.ResponseWriter, r *http.Request) {
+	tex := r.URL.Query().Get("tex")
+	if tex == "" {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'tex' parameter")
+		return
+	}
+	if len(tex) > maxFormulaLength {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Formula too long")
+		return
+	}
+
+	img, err := renderFormula(tex, r.URL.Query().Get("display") == "1")
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to render formula")
+		a.Logger.Errorf("Error rendering formula in /api/math: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	a.writeDrawnImage(w, r, img, "/api/math")
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+func TestReplaceMath(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "text delimiters",
+			input:    `<p>So \(e^{i\pi}+1=0\) and $$x^2$$ for $5</p>`,
+			expected: `<p>So <img src="inline:e^{i\pi}+1=0" alt="e^{i\pi}+1=0" class="math"/> and <img src="display:x^2" alt="x^2" class="math display"/> for $5</p>`,
+		},
+		{
+			name:     "mathml with tex annotation",
+			input:    `<p><math><semantics><mi>x</mi><annotation encoding="application/x-tex">x_1</annotation></semantics></math></p>`,
+			expected: `<p><img src="inline:x_1" alt="x_1" class="math"/></p>`,
+		},
+		{
+			name:     "mathml",
+			input:    `<math display="block"><mfrac><mi>a</mi><mn>2</mn></mfrac><msup><mi>x</mi><mn>3</mn></msup><mi>sin</mi></math>`,
+			expected: `<img src="display:\frac{a}{2} {x}^{3} \mathrm{sin}" alt="\frac{a}{2} {x}^{3} \mathrm{sin}" class="math display"/>`,
+		},
+		{
+			name:     "katex",
+			input:    `<p><span class="katex"><span class="katex-mathml"><math><semantics><mi>y</mi><annotation encoding="application/x-tex">y</annotation></semantics></math></span><span class="katex-html">y</span></span></p>`,
+			expected: `<p><img src="inline:y" alt="y" class="math"/></p>`,
+		},
+		{
+			name:     "mathjax 2",
+			input:    `<p><span class="MathJax_Preview">z</span><span class="MathJax">z</span><script type="math/tex; mode=display">z</script></p>`,
+			expected: `<p><img src="display:z" alt="z" class="math display"/></p>`,
+		},
+		{
+			name:     "code is left alone",
+			input:    `<pre>\(x\)</pre><p>a \(b</p>`,
+			expected: `<pre>\(x\)</pre><p>a \(b</p>`,
+		},
+	}
+
+	imageURL := func(tex string, display bool) string {
+		if display {
+			return "display:" + tex
+		}
+		return "inline:" + tex
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("failed to parse HTML: %v", err)
+			}
+			replaceMath(doc, imageURL)
+
+			var buf bytes.Buffer
+			for c := findElement(doc, atom.Body).FirstChild; c != nil; c = c.NextSibling {
+				if err := html.Render(&buf, c); err != nil {
+					t.Fatalf("failed to render HTML: %v", err)
+				}
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestRenderFormula(t *testing.T) {
+	plain, err := renderFormula("x", false)
+	if err != nil {
+		t.Fatalf("renderFormula() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		tex     string
+		display bool
+	}{
+		{name: "fraction", tex: `\frac{a+b}{2}`},
+		{name: "root and scripts", tex: `\sqrt[3]{x_i^2} \leq \sum_{n=1}^{\infty} \alpha`},
+		{name: "display", tex: "x", display: true},
+		{name: "unbalanced", tex: `\frac{a}{ \hat } } \unknown`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := renderFormula(tt.tex, tt.display)
+			if err != nil {
+				t.Fatalf("renderFormula() error = %v", err)
+			}
+			if img.Bounds().Dy() <= plain.Bounds().Dy() {
+				t.Errorf("expected %q to be taller than x, got %v and %v", tt.tex, img.Bounds(), plain.Bounds())
+			}
+		})
+	}
+}
+
+func TestHandleMath(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(logger.New(logger.DEBUG)))
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "formula", query: "?tex=" + "%5Cfrac%7B1%7D%7B2%7D", status: http.StatusOK},
+		{name: "missing tex", query: "", status: http.StatusBadRequest},
+		{name: "too long", query: "?tex=" + strings.Repeat("x", maxFormulaLength+1), status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.HandleMath(rr, httptest.NewRequest(http.MethodGet, "/api/math"+tt.query, nil))
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("expected content type image/png, got %s", ct)
+			}
+			if _, err := png.Decode(rr.Body); err != nil {
+				t.Errorf("failed to decode PNG: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/openapi"
+)
+
+// apiVersion is the version of the API described by /openapi.json; it
+// changes when an endpoint or a schema does.
+const apiVersion = "1.0.0"
+
+// apiRoutes are the endpoints described by /openapi.json, with the types
+// their handlers decode and encode. Kobo endpoints take the device token in
+// their body; the others take it as a bearer token or the token parameter.
+var apiRoutes = []openapi.Route{
+	{Method: "POST", Path: "/api/kobo/get", ID: "koboGet", Tag: "kobo", Summary: "Lists the bookmarks to sync to the device", Request: models.KoboGetRequest{}, Response: models.KoboGetResponse{}},
+	{Method: "POST", Path: "/api/kobo/download", ID: "koboDownload", Tag: "kobo", Summary: "Returns an article prepared for the device", Request: models.KoboDownloadRequest{}, Response: models.KoboDownloadResponse{}},
+	{Method: "POST", Path: "/api/kobo/send", ID: "koboSend", Tag: "kobo", Summary: "Applies the actions of the device to its bookmarks", Request: models.KoboSendRequest{}, Response: models.KoboSendResponse{}},
+	{Method: "POST", Path: "/api/kobo/discover", ID: "koboDiscover", Tag: "kobo", Summary: "Lists the bookmarks of the device's discovery tab", Request: models.PocketDiscoverRequest{}, Response: models.KoboGetResponse{}},
+	{Method: "POST", Path: "/v3/discover", ID: "pocketDiscover", Tag: "kobo", Summary: "Lists the bookmarks of the device's discovery tab", Request: models.PocketDiscoverRequest{}, Response: models.KoboGetResponse{}},
+	{Method: "POST", Path: "/v3/recommendations", ID: "pocketRecommendations", Tag: "kobo", Summary: "Lists the bookmarks of the device's discovery tab", Request: models.PocketDiscoverRequest{}, Response: models.KoboGetResponse{}},
+	{Method: "POST", Path: "/v3/add", ID: "pocketAdd", Tag: "kobo", Summary: "Saves a URL to Readeck", Request: models.PocketAddRequest{}, Response: models.PocketAddResponse{}},
+	{Method: "POST", Path: "/v3/oauth/request", ID: "pocketOAuthRequest", Tag: "kobo", Summary: "Starts the Pocket sign-in of the device", Request: models.PocketOAuthRequest{}, Response: models.PocketOAuthRequestResponse{}},
+	{Method: "POST", Path: "/v3/oauth/authorize", ID: "pocketOAuthAuthorize", Tag: "kobo", Summary: "Completes the Pocket sign-in of the device", Request: models.PocketOAuthAuthorizeRequest{}, Response: models.PocketOAuthAuthorizeResponse{}},
+	{
+		Method: "GET", Path: "/api/convert-image", ID: "convertImage", Tag: "images", Summary: "Converts an article image for the device's screen",
+		Query:       []openapi.Parameter{{Name: "url", Required: true}, {Name: "referer"}, {Name: "profile", Description: "device profile to convert for"}, {Name: "quality", Description: "JPEG quality from 1 to 100"}},
+		ContentType: "image/jpeg",
+	},
+	{Method: "GET", Path: "/api/math", ID: "math", Tag: "images", Summary: "Draws a TeX formula", Query: []openapi.Parameter{{Name: "tex", Required: true}, {Name: "display", Description: "1 for a display formula"}}, ContentType: "image/png"},
+	{Method: "GET", Path: "/api/qr", ID: "qrCode", Tag: "images", Summary: "Draws a link as a QR code", Query: []openapi.Parameter{{Name: "data", Required: true}}, ContentType: "image/png"},
+	{Method: "GET", Path: "/api/code", ID: "code", Tag: "images", Summary: "Draws a code block", Query: []openapi.Parameter{{Name: "c", Required: true, Description: "the code, compressed and encoded by the article download"}}, ContentType: "image/png"},
+	{Method: "GET", Path: "/api/resource", ID: "resource", Tag: "images", Summary: "Serves a resource of a bookmark", Query: []openapi.Parameter{{Name: "src", Required: true}, {Name: "device", Required: true}, {Name: "sig", Required: true}}, ContentType: "application/octet-stream"},
+	{Method: "POST", Path: "/api/save", ID: "save", Tag: "save", Summary: "Saves a URL to Readeck for the device", Security: "deviceToken", Request: models.SaveRequest{}, Response: models.SaveResponse{}},
+	{Method: "GET", Path: "/api/pocket/export", ID: "pocketExport", Tag: "save", Summary: "Exports the device's bookmarks like a Pocket export", Security: "deviceToken", Query: []openapi.Parameter{{Name: "format", Description: "json for an array of the items of the import, instead of CSV"}}, ContentType: "text/csv"},
+	{Method: "POST", Path: "/api/pocket/import", ID: "pocketImport", Tag: "save", Summary: "Imports a Pocket export to Readeck", Security: "deviceToken", Request: []models.PocketExportItem{}, Response: models.PocketImportResponse{}},
+	{Method: "GET", Path: "/api/digest", ID: "digest", Tag: "opds", Summary: "Downloads the EPUB digest of unread articles", Security: "deviceToken", Query: []openapi.Parameter{{Name: "date", Description: "day of the digest, as YYYY-MM-DD"}}, ContentType: "application/epub+zip"},
+	{Method: "GET", Path: "/api/digest/opds", ID: "digestOPDS", Tag: "opds", Summary: "Lists the digests as an OPDS catalog", Security: "deviceToken", ContentType: opdsFeedType},
+	{Method: "GET", Path: "/healthz", ID: "health", Tag: "admin", Summary: "Reports whether the bridge is up and how many Readeck tokens were rejected", Response: healthResponse{}},
+	{Method: "GET", Path: "/admin/api/users", ID: "adminUsers", Tag: "admin", Summary: "Lists the configured devices and their Readeck token state", Response: adminUsersResponse{}},
+	{Method: "GET", Path: "/admin/api/extractions", ID: "adminExtractions", Tag: "admin", Summary: "Lists the URLs recently added from devices", Query: []openapi.Parameter{{Name: "status", Description: "failed to list failed extractions only"}}, Response: adminExtractionsResponse{}},
+	{Method: "POST", Path: "/admin/api/extractions/{id}/retry", ID: "adminRetryExtraction", Tag: "admin", Summary: "Adds the URL of a failed extraction again", Response: retryExtractionResponse{}},
+	{Method: "GET", Path: "/admin/api/stats", ID: "adminStats", Tag: "admin", Summary: "Reports the statistics of each device", Response: adminStatsResponse{}},
+	{Method: "GET", Path: "/admin/api/devices", ID: "adminDevices", Tag: "admin", Summary: "Lists the Kobo identified for each device", Response: adminDevicesResponse{}},
+	{Method: "GET", Path: "/admin/api/readiness", ID: "adminReadiness", Tag: "admin", Summary: "Checks that Readeck answers and accepts each device's token", Response: readinessResponse{}},
+}
+
+// OpenAPI returns the OpenAPI document of readeckobo's endpoints.
+var OpenAPI = sync.OnceValue(func() *openapi.Document {
+	b := openapi.NewBuilder("readeckobo", apiVersion,
+		"Bridge between Kobo e-readers and Readeck. The admin endpoints are served on admin.port when it is set.")
+	b.AddSecurityScheme("deviceToken", openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "The device token, also accepted as the token query parameter.",
+	})
+	for _, route := range apiRoutes {
+		b.Add(route)
+	}
+	return b.Document()
+})
+
+// HandleOpenAPI serves the OpenAPI document.
+func (a *App) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(OpenAPI()); err != nil {
+		a.Logger.Errorf("Error encoding response for /openapi.json: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/jpeg"
+	"slices"
+
+	"readeckobo/internal/config"
+)
+
+// canPassThrough reports whether data is a JPEG the Kobo can show as is: a
+// baseline YCbCr or grayscale JPEG within opts.passthroughMaxBytes and the
+// profile's screen, so decoding and re-encoding it would only cost CPU and
+// quality.
+func canPassThrough(data []byte, opts imageOptions, profile *config.DeviceProfile) bool {
+	if opts.passthroughMaxBytes <= 0 || int64(len(data)) > opts.passthroughMaxBytes || !isBaselineJPEG(data) {
+		return false
+	}
+	if profile != nil && len(profile.Formats) > 0 && !slices.Contains(profile.Formats, "jpeg") {
+		return false
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (cfg.ColorModel != color.YCbCrModel && cfg.ColorModel != color.GrayModel) {
+		return false
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > opts.maxPixels/cfg.Height {
+		return false
+	}
+	if profile != nil {
+		if (profile.MaxWidth > 0 && cfg.Width > profile.MaxWidth) || (profile.MaxHeight > 0 && cfg.Height > profile.MaxHeight) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBaselineJPEG reports whether data is a JPEG whose first frame header is
+// baseline DCT, which every e-reader decodes, rather than progressive or
+// another coding.
+func isBaselineJPEG(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte before a marker.
+			i++
+			continue
+		case marker == 0xc0:
+			return true
+		case marker >= 0xc1 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			return false
+		case marker == 0xd9 || marker == 0xda:
+			// End of image or start of scan before any frame header.
+			return false
+		case marker >= 0xd0 && marker <= 0xd7 || marker == 0x01:
+			// Markers without a length.
+			i += 2
+			continue
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func encodeTestJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCanPassThrough(t *testing.T) {
+	baseline := encodeTestJPEG(t, image.NewGray(image.Rect(0, 0, 80, 40)))
+	progressive := bytes.Replace(baseline, []byte{0xff, 0xc0}, []byte{0xff, 0xc2}, 1)
+	opts := imageOptions{maxPixels: defaultMaxImagePixels, passthroughMaxBytes: 1 << 20}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    imageOptions
+		profile *config.DeviceProfile
+		want    bool
+	}{
+		{"baseline", baseline, opts, nil, true},
+		{"within profile", baseline, opts, &config.DeviceProfile{MaxWidth: 80, MaxHeight: 40, Formats: []string{"jpeg"}}, true},
+		{"progressive", progressive, opts, nil, false},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), opts, nil, false},
+		{"too wide", baseline, opts, &config.DeviceProfile{MaxWidth: 50}, false},
+		{"png only", baseline, opts, &config.DeviceProfile{Formats: []string{"png"}}, false},
+		{"too many bytes", baseline, imageOptions{maxPixels: defaultMaxImagePixels, passthroughMaxBytes: 10}, nil, false},
+		{"too many pixels", baseline, imageOptions{maxPixels: 100, passthroughMaxBytes: 1 << 20}, nil, false},
+		{"disabled", baseline, imageOptions{maxPixels: defaultMaxImagePixels}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canPassThrough(tt.data, tt.opts, tt.profile); got != tt.want {
+				t.Errorf("canPassThrough() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleConvertImagePassthrough(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := range 400 {
+		img.Set(x, x/2, color.Black)
+	}
+	source := encodeTestJPEG(t, img)
+	imgSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write(source)
+	}))
+	defer imgSrv.Close()
+
+	tests := []struct {
+		name    string
+		profile string
+		want    bool
+	}{
+		{"fits", "", true},
+		{"too large for profile", "libra2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp(WithConfig(&config.Config{DeviceProfiles: testProfiles, Images: config.ConfigImages{PassthroughMaxBytes: 1 << 20}}), WithLogger(testLogger))
+			query := url.Values{"url": {imgSrv.URL}}
+			if tt.profile != "" {
+				query.Set("profile", tt.profile)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/convert-image?"+query.Encode(), nil)
+			rr := httptest.NewRecorder()
+
+			app.HandleConvertImage(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+			if got := bytes.Equal(rr.Body.Bytes(), source); got != tt.want {
+				t.Errorf("passed through = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// maxPDFBytes bounds the PDFs fetched for conversion.
+const maxPDFBytes = 50 << 20
+
+// pdfTimeout bounds the run of pdftotext on a PDF.
+const pdfTimeout = time.Minute
+
+// convertsPDF reports whether bookmark is a PDF that is converted to an
+// article on download.
+func (a *App) convertsPDF(bookmark *readeck.Bookmark) bool {
+	return a.Config.Download.PDFToText != "" && bookmarkKind(bookmark) == kindPDF
+}
+
+// buildKoboItem builds the item of bookmark, shown as an article when it is
+// a PDF readeckobo converts.
+func (a *App) buildKoboItem(bookmark *readeck.Bookmark) models.KoboArticleItem {
+	entry := buildKoboArticleItem(bookmark)
+	if a.convertsPDF(bookmark) {
+		entry.IsArticle = "1"
+	}
+	return entry
+}
+
+// convertPDF fetches the PDF at pdfURL and converts its text to an article
+// with pdftotext.
+func (a *App) convertPDF(ctx context.Context, pdfURL string) (string, error) {
+	u, err := url.Parse(pdfURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("unsupported PDF URL %q", pdfURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	userAgent := a.Config.Images.UserAgent
+	if userAgent == "" {
+		userAgent = defaultOriginUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/pdf")
+
+	resp, err := a.OriginHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch PDF: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch PDF: %s", resp.Status)
+	}
+
+	file, err := os.CreateTemp("", "readeckobo-*.pdf")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	n, err := io.Copy(file, io.LimitReader(resp.Body, maxPDFBytes+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save PDF: %w", err)
+	}
+	if n > maxPDFBytes {
+		return "", fmt.Errorf("PDF is larger than %d bytes", maxPDFBytes)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pdfTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, a.Config.Download.PDFToText, "-enc", "UTF-8", "-eol", "unix", file.Name(), "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run pdftotext: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	article := pdfTextToHTML(stdout.String())
+	if article == "" {
+		return "", errors.New("PDF has no text")
+	}
+	return article, nil
+}
+
+// pdfTextToHTML turns the output of pdftotext into paragraphs, with a rule
+// between pages. Lines of a paragraph are joined, and words hyphenated at
+// the end of a line are put back together.
+func pdfTextToHTML(text string) string {
+	var sb strings.Builder
+	for _, page := range strings.Split(text, "\f") {
+		var paragraphs []string
+		for _, block := range strings.Split(page, "\n\n") {
+			if p := joinPDFLines(block); p != "" {
+				paragraphs = append(paragraphs, p)
+			}
+		}
+		if len(paragraphs) == 0 {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("<hr>")
+		}
+		for _, p := range paragraphs {
+			sb.WriteString("<p>" + html.EscapeString(p) + "</p>")
+		}
+	}
+	return sb.String()
+}
+
+func joinPDFLines(block string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		current := sb.String()
+		first, _ := utf8.DecodeRuneInString(line)
+		switch {
+		case current == "":
+		case strings.HasSuffix(current, "-") && unicode.IsLower(first):
+			sb.Reset()
+			sb.WriteString(strings.TrimSuffix(current, "-"))
+		default:
+			sb.WriteString(" ")
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestPDFTextToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "empty", text: "\f", expected: ""},
+		{name: "paragraphs", text: "A first\nparagraph.\n\nA second one.\n", expected: "<p>A first paragraph.</p><p>A second one.</p>"},
+		{name: "hyphenation", text: "a hyphen-\nated word, a well-\nKnown one", expected: "<p>a hyphenated word, a well- Known one</p>"},
+		{name: "pages", text: "Page one.\f\fPage <two> & more.\n\f", expected: "<p>Page one.</p><hr><p>Page &lt;two&gt; &amp; more.</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfTextToHTML(tt.text); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandleKoboDownloadPDF(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake pdftotext is a shell script")
+	}
+	// The fake pdftotext prints the file it is given, which the test serves
+	// as plain text.
+	pdftotext := filepath.Join(t.TempDir(), "pdftotext")
+	if err := os.WriteFile(pdftotext, []byte("#!/bin/sh\ncat \"$5\"\n"), 0o755); err != nil {
+		t.Fatalf("failed to write fake pdftotext: %v", err)
+	}
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("The text of the\npaper.\f"))
+	}))
+	defer origin.Close()
+	pdfURL := origin.URL + "/paper.pdf"
+
+	tests := []struct {
+		name      string
+		pdftotext string
+		status    int
+		isArticle string
+	}{
+		{name: "converted", pdftotext: pdftotext, status: http.StatusOK, isArticle: "1"},
+		{name: "not converted", pdftotext: "", status: http.StatusNotFound, isArticle: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			mockServer.AddBookmark(readeck.Bookmark{ID: "b1", URL: pdfURL, Title: "Paper", Type: "article", DocumentType: "pdf"}, "")
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:    []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck:  config.ConfigReadeck{Host: mockServer.URL},
+					Download: config.ConfigDownload{PDFToText: tt.pdftotext},
+				}),
+				WithLogger(testLogger),
+				WithOriginHTTPClient(origin.Client()),
+			)
+
+			body, _ := json.Marshal(models.KoboGetRequest{Count: "10", AccessToken: mockDeviceToken})
+			rr := httptest.NewRecorder()
+			app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("sync failed with status %d: %s", rr.Code, rr.Body.String())
+			}
+			var sync models.KoboGetResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &sync); err != nil {
+				t.Fatalf("failed to decode sync response: %v", err)
+			}
+			if got := sync.List["b1"].IsArticle; got != tt.isArticle {
+				t.Errorf("expected is_article %q, got %q", tt.isArticle, got)
+			}
+
+			form := url.Values{"access_token": {mockDeviceToken}, "url": {pdfURL}}
+			req := httptest.NewRequest(http.MethodPost, "/api/kobo/download", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr = httptest.NewRecorder()
+			app.HandleKoboDownload(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var response struct {
+				Article string `json:"article"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !strings.Contains(response.Article, "<p>The text of the paper.</p>") {
+				t.Errorf("expected the converted PDF, got %s", response.Article)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Placeholder size used when images.placeholder_width or
+// images.placeholder_height is unset.
+const (
+	defaultPlaceholderWidth  = 800
+	defaultPlaceholderHeight = 600
+)
+
+var placeholderBorder = color.Gray{Y: 0x80}
+
+// placeholderFont is parsed once; faces are created per image because they
+// are not safe for concurrent use.
+var placeholderFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// renderPlaceholder draws a bordered image explaining why the image from
+// imageURL is missing, with message wrapped to fit and the image's host
+// below it.
+func renderPlaceholder(width, height int, message, imageURL string) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	border := max(2, min(width, height)/150)
+	margin := max(border*2, min(width, height)/25)
+	borderColor := image.NewUniform(placeholderBorder)
+	for i := range border {
+		r := image.Rect(margin+i, margin+i, width-margin-i, height-margin-i)
+		for _, edge := range []image.Rectangle{
+			image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1),
+			image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y),
+			image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y),
+			image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y),
+		} {
+			draw.Draw(img, edge, borderColor, image.Point{}, draw.Src)
+		}
+	}
+
+	f, err := placeholderFont()
+	if err != nil {
+		return nil, err
+	}
+	size := float64(max(12, min(width, height)/15))
+	messageFace, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = messageFace.Close() }()
+	hostFace, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size * 0.6, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = hostFace.Close() }()
+
+	textWidth := width - 2*(margin+border) - 2*margin
+	lines := wrapText(messageFace, message, textWidth)
+	var host string
+	if u, err := url.Parse(imageURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	lineHeight := messageFace.Metrics().Height.Ceil()
+	hostHeight := hostFace.Metrics().Height.Ceil()
+	total := len(lines) * lineHeight
+	if host != "" {
+		total += hostHeight + lineHeight/2
+	}
+	y := (height-total)/2 + messageFace.Metrics().Ascent.Ceil()
+
+	drawer := &font.Drawer{Dst: img, Src: image.Black, Face: messageFace}
+	for _, line := range lines {
+		drawer.Dot = fixed.P((width-drawer.MeasureString(line).Ceil())/2, y)
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+	if host != "" {
+		drawer.Face = hostFace
+		drawer.Src = borderColor
+		host = truncateText(hostFace, host, textWidth)
+		drawer.Dot = fixed.P((width-drawer.MeasureString(host).Ceil())/2, y+lineHeight/2)
+		drawer.DrawString(host)
+	}
+
+	return img, nil
+}
+
+// wrapText splits text into lines no wider than width, truncating words
+// that do not fit on a line of their own.
+func wrapText(face font.Face, text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if font.MeasureString(face, candidate).Ceil() <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = truncateText(face, word, width)
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncateText shortens text with an ellipsis until it fits in width.
+func truncateText(face font.Face, text string, width int) string {
+	if font.MeasureString(face, text).Ceil() <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if candidate := string(runes) + "…"; font.MeasureString(face, candidate).Ceil() <= width {
+			return candidate
+		}
+	}
+	return ""
+}
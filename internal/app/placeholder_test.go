@@ -0,0 +1,45 @@
+package app
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+)
+
+func TestRenderPlaceholder(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+	}{
+		{name: "default size", width: 800, height: 600},
+		{name: "narrow", width: 200, height: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := renderPlaceholder(tt.width, tt.height, "The image is in a format that cannot be shown.", "https://images.example.com/a.webp")
+			if err != nil {
+				t.Fatalf("renderPlaceholder() error = %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Errorf("expected %dx%d, got %dx%d", tt.width, tt.height, b.Dx(), b.Dy())
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	face := basicfont.Face7x13
+	lines := wrapText(face, "a message that needs several lines and averyveryverylongword", 70)
+
+	if len(lines) < 3 {
+		t.Errorf("expected the text to wrap, got %q", lines)
+	}
+	for _, line := range lines {
+		if w := font.MeasureString(face, line).Ceil(); w > 70 {
+			t.Errorf("line %q is %dpx wide, want at most 70", line, w)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// decodePocketRequest reads a Pocket API request, which clients send either
+// as JSON or as a form. fromForm fills v from the form values.
+func decodePocketRequest(r *http.Request, v any, fromForm func(get func(string) string)) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	fromForm(r.FormValue)
+	return nil
+}
+
+// HandlePocketAdd saves a URL to Readeck for Pocket browser extensions and
+// "save to Pocket" apps, which authenticate with a device token.
+func (a *App) HandlePocketAdd(w http.ResponseWriter, r *http.Request) {
+	var req models.PocketAddRequest
+	err := decodePocketRequest(r, &req, func(get func(string) string) {
+		req.AccessToken = get("access_token")
+		req.ConsumerKey = get("consumer_key")
+		req.URL = get("url")
+		req.Title = get("title")
+		req.Tags = get("tags")
+	})
+	if err != nil {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
+		a.Logger.Errorf("Error decoding /v3/add request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
+		return
+	}
+
+	user, err := a.getUser(r.Context(), req.AccessToken)
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for /v3/add: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	if req.URL == "" {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'url' parameter")
+		return
+	}
+
+	create := addOptions(user, readeck.CreateBookmarkOptions{Title: req.Title, Labels: splitTags(req.Tags)})
+
+	var itemID string
+	if a.Config.DryRun {
+		a.Logger.Infof("Dry run: would create bookmark for %s with labels %v in /v3/add", req.URL, create.Labels)
+	} else {
+		readeckClient, err := a.newReadeckClient(user)
+		if err != nil {
+			writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
+			a.Logger.Errorf("Error initializing Readeck client for /v3/add: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+			return
+		}
+		itemID, err = readeckClient.CreateBookmark(r.Context(), req.URL, create)
+		if err != nil {
+			writeReadeckError(w, "Failed to save URL", err)
+			a.Logger.Errorf("Error creating bookmark for %s in /v3/add: %v, URL: %s, Params: %v", req.URL, err, r.URL.Path, r.URL.Query())
+			return
+		}
+		a.invalidateSyncResponses(user.Token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.PocketAddResponse{
+		Item:   models.PocketItem{ItemID: itemID, NormalURL: req.URL, Title: req.Title},
+		Status: 1,
+	}); err != nil {
+		a.Logger.Errorf("Error encoding response for /v3/add: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// HandlePocketOAuthRequest starts the Pocket sign-in flow. There is no
+// authorization page, so the code is only a placeholder: the user enters
+// their device token as the code to authorize instead.
+func (a *App) HandlePocketOAuthRequest(w http.ResponseWriter, r *http.Request) {
+	var req models.PocketOAuthRequest
+	err := decodePocketRequest(r, &req, func(get func(string) string) {
+		req.ConsumerKey = get("consumer_key")
+		req.RedirectURI = get("redirect_uri")
+		req.State = get("state")
+	})
+	if err != nil {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
+		a.Logger.Errorf("Error decoding /v3/oauth/request request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
+		return
+	}
+
+	code, err := newDeviceToken()
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to create request code")
+		a.Logger.Errorf("Error creating request code in /v3/oauth/request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.PocketOAuthRequestResponse{Code: code, State: req.State}); err != nil {
+		a.Logger.Errorf("Error encoding response for /v3/oauth/request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// HandlePocketOAuthAuthorize exchanges a code for an access token. The code
+// must be a configured device token, which becomes the access token.
+func (a *App) HandlePocketOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	var req models.PocketOAuthAuthorizeRequest
+	err := decodePocketRequest(r, &req, func(get func(string) string) {
+		req.ConsumerKey = get("consumer_key")
+		req.Code = get("code")
+	})
+	if err != nil {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
+		a.Logger.Errorf("Error decoding /v3/oauth/authorize request: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	if !a.checkConsumerKey(w, r, req.ConsumerKey) {
+		return
+	}
+
+	if _, err := a.getUser(r.Context(), req.Code); err != nil {
+		writeKoboError(w, http.StatusForbidden, pocketErrUserRejected, "User rejected code.")
+		a.Logger.Warnf("Rejected unknown code in /v3/oauth/authorize, URL: %s, Params: %v", r.URL.Path, r.URL.Query())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.PocketOAuthAuthorizeResponse{AccessToken: req.Code, Username: "readeckobo"}); err != nil {
+		a.Logger.Errorf("Error encoding response for /v3/oauth/authorize: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
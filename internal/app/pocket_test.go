@@ -0,0 +1,148 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+)
+
+func TestHandlePocketAdd(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedCode   int
+		expectedBody   map[string]any
+	}{
+		{
+			name:           "JSON with title and tags",
+			contentType:    "application/json; charset=UTF-8",
+			body:           `{"access_token":"` + mockDeviceToken + `","url":"http://example.com/a","title":"A","tags":"go, kobo"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"url": "http://example.com/a", "title": "A", "labels": []any{"go", "kobo"}},
+		},
+		{
+			name:           "form",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           url.Values{"access_token": {mockDeviceToken}, "url": {"http://example.com/b"}}.Encode(),
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"url": "http://example.com/b"},
+		},
+		{
+			name:           "invalid access token",
+			contentType:    "application/json",
+			body:           `{"access_token":"invalid","url":"http://example.com/a"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   pocketErrAccessToken,
+		},
+		{
+			name:           "missing url",
+			contentType:    "application/json",
+			body:           `{"access_token":"` + mockDeviceToken + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   pocketErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created map[string]any
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+					t.Errorf("Failed to decode request body: %v", err)
+				}
+				w.Header().Set("Bookmark-Id", "new-id")
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer mockServer.Close()
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck: config.ConfigReadeck{Host: mockServer.URL},
+				}),
+				WithLogger(testLogger),
+				WithReadeckHTTPClient(mockServer.Client()),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/v3/add", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			app.HandlePocketAdd(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedCode != 0 {
+				if got := rr.Header().Get("X-Error-Code"); got != strconv.Itoa(tt.expectedCode) {
+					t.Errorf("expected X-Error-Code %d, got %q", tt.expectedCode, got)
+				}
+				return
+			}
+
+			for k, v := range tt.expectedBody {
+				got, _ := json.Marshal(created[k])
+				want, _ := json.Marshal(v)
+				if string(got) != string(want) {
+					t.Errorf("expected %s to be %s, got %s", k, want, got)
+				}
+			}
+			var resp models.PocketAddResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Status != 1 || resp.Item.ItemID != "new-id" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestHandlePocketOAuthAuthorize(t *testing.T) {
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users: []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+		}),
+		WithLogger(testLogger),
+	)
+
+	tests := []struct {
+		name           string
+		code           string
+		expectedStatus int
+	}{
+		{name: "device token", code: mockDeviceToken, expectedStatus: http.StatusOK},
+		{name: "unknown code", code: "unknown", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v3/oauth/authorize", strings.NewReader(`{"consumer_key":"key","code":"`+tt.code+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			app.HandlePocketOAuthAuthorize(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp models.PocketOAuthAuthorizeResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.AccessToken != mockDeviceToken {
+				t.Errorf("expected access token %q, got %q", mockDeviceToken, resp.AccessToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// maxImportBody bounds the Pocket export read by /api/pocket/import.
+const maxImportBody = 32 << 20
+
+// exportPageSize is the number of bookmarks fetched per Readeck request
+// while listing the whole library.
+const exportPageSize = 100
+
+// pocketCSVHeader are the columns of a Pocket CSV export.
+var pocketCSVHeader = []string{"title", "url", "time_added", "tags", "status"}
+
+// Pocket export statuses.
+const (
+	pocketStatusUnread  = "unread"
+	pocketStatusArchive = "archive"
+)
+
+// HandlePocketExport writes every Readeck bookmark of a device's user as a
+// Pocket export, in CSV or, with ?format=json, JSON. The device token is
+// taken like in /api/save.
+func (a *App) HandlePocketExport(w http.ResponseWriter, r *http.Request) {
+	params := a.Logger.Redact([]byte(r.URL.RawQuery))
+
+	user, err := a.getUser(r.Context(), requestDeviceToken(r))
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for /api/pocket/export: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" && format != "json" {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Unknown 'format' parameter")
+		return
+	}
+
+	readeckClient, err := a.newReadeckClient(user)
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
+		a.Logger.Errorf("Error initializing Readeck client for /api/pocket/export: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+	bookmarks, err := listAllBookmarks(r.Context(), readeckClient)
+	if err != nil {
+		writeReadeckError(w, "Failed to list bookmarks", err)
+		a.Logger.Errorf("Error listing bookmarks in /api/pocket/export: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+	items := make([]models.PocketExportItem, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		items = append(items, pocketExportItem(bookmark))
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="readeck-pocket-export.json"`)
+		err = json.NewEncoder(w).Encode(items)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="readeck-pocket-export.csv"`)
+		err = writePocketCSV(w, items)
+	}
+	if err != nil {
+		a.Logger.Errorf("Error encoding response for /api/pocket/export: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+	}
+}
+
+// HandlePocketImport saves the bookmarks of a Pocket export to Readeck, as a
+// CSV or JSON body or as the "file" field of a form. URLs already in Readeck
+// are skipped, archived items are archived and tags become labels.
+func (a *App) HandlePocketImport(w http.ResponseWriter, r *http.Request) {
+	params := a.Logger.Redact([]byte(r.URL.RawQuery))
+
+	user, err := a.getUser(r.Context(), requestDeviceToken(r))
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for /api/pocket/import: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBody)
+	items, err := readPocketImport(r)
+	if err != nil {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid Pocket export")
+		a.Logger.Errorf("Error decoding /api/pocket/import request: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+
+	readeckClient, err := a.newReadeckClient(user)
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
+		a.Logger.Errorf("Error initializing Readeck client for /api/pocket/import: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+	existing, err := listAllBookmarks(r.Context(), readeckClient)
+	if err != nil {
+		writeReadeckError(w, "Failed to list bookmarks", err)
+		a.Logger.Errorf("Error listing bookmarks in /api/pocket/import: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, bookmark := range existing {
+		seen[bookmark.URL] = true
+	}
+
+	resp := models.PocketImportResponse{Failed: []models.PocketImportFailure{}}
+	for _, item := range items {
+		if item.URL == "" || seen[item.URL] {
+			resp.Skipped++
+			continue
+		}
+		seen[item.URL] = true
+
+		create := addOptions(user, readeck.CreateBookmarkOptions{
+			Title:    item.Title,
+			Labels:   splitTags(strings.ReplaceAll(item.Tags, "|", ",")),
+			Archived: item.Status == pocketStatusArchive,
+		})
+		if a.Config.DryRun {
+			a.Logger.Infof("Dry run: would create bookmark for %s with labels %v in /api/pocket/import", item.URL, create.Labels)
+			resp.Imported++
+			continue
+		}
+		if _, err := readeckClient.CreateBookmark(r.Context(), item.URL, create); err != nil {
+			if r.Context().Err() != nil {
+				a.Logger.Warnf("Pocket import stopped after %d bookmarks: %v", resp.Imported, r.Context().Err())
+				return
+			}
+			resp.Failed = append(resp.Failed, models.PocketImportFailure{URL: item.URL, Error: err.Error()})
+			a.Logger.Errorf("Error creating bookmark for %s in /api/pocket/import: %v, URL: %s, Params: %s", item.URL, err, r.URL.Path, params)
+			continue
+		}
+		resp.Imported++
+	}
+	if resp.Imported > 0 && !a.Config.DryRun {
+		a.invalidateSyncResponses(user.Token)
+	}
+	a.Logger.Infof("Imported %d bookmarks from a Pocket export, skipped %d and failed %d", resp.Imported, resp.Skipped, len(resp.Failed))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		a.Logger.Errorf("Error encoding response for /api/pocket/import: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+	}
+}
+
+// listAllBookmarks pages through every bookmark in Readeck, oldest first.
+func listAllBookmarks(ctx context.Context, client *readeck.Client) ([]readeck.Bookmark, error) {
+	var all []readeck.Bookmark
+	for {
+		bookmarks, total, err := client.ListBookmarks(ctx, readeck.ListBookmarksOptions{
+			Limit:  exportPageSize,
+			Offset: len(all),
+			Sort:   []string{"created"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, bookmarks...)
+		if len(bookmarks) == 0 || len(all) >= total {
+			return all, nil
+		}
+	}
+}
+
+// pocketExportItem lays out a Readeck bookmark like an item of a Pocket export.
+func pocketExportItem(bookmark readeck.Bookmark) models.PocketExportItem {
+	item := models.PocketExportItem{
+		Title:  bookmark.Title,
+		URL:    bookmark.URL,
+		Tags:   strings.Join(bookmark.Labels, "|"),
+		Status: pocketStatusUnread,
+	}
+	if !bookmark.Created.IsZero() {
+		item.TimeAdded = bookmark.Created.Unix()
+	}
+	if bookmark.IsArchived {
+		item.Status = pocketStatusArchive
+	}
+	return item
+}
+
+// writePocketCSV writes items in the columns of a Pocket CSV export.
+func writePocketCSV(w io.Writer, items []models.PocketExportItem) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(pocketCSVHeader); err != nil {
+		return err
+	}
+	for _, item := range items {
+		record := []string{item.Title, item.URL, strconv.FormatInt(item.TimeAdded, 10), item.Tags, item.Status}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readPocketImport reads the items of a Pocket export sent as the request
+// body or as the "file" field of a multipart form.
+func readPocketImport(r *http.Request) ([]models.PocketExportItem, error) {
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+		body = file
+	}
+
+	br := bufio.NewReader(body)
+	start, err := br.Peek(1)
+	for err == nil && len(bytes.TrimSpace(start)) == 0 {
+		if _, err = br.ReadByte(); err == nil {
+			start, err = br.Peek(1)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty export")
+		}
+		return nil, err
+	}
+	if start[0] == '[' {
+		var items []models.PocketExportItem
+		if err := json.NewDecoder(br).Decode(&items); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON export: %w", err)
+		}
+		return items, nil
+	}
+	return readPocketCSV(br)
+}
+
+// readPocketCSV parses a Pocket CSV export by its header, so that exports
+// with extra columns, such as Pocket's cursor, are read too.
+func readPocketCSV(r io.Reader) ([]models.PocketExportItem, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("CSV export has no url column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var items []models.PocketExportItem
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV export: %w", err)
+		}
+		item := models.PocketExportItem{
+			Title:  field(record, "title"),
+			URL:    field(record, "url"),
+			Tags:   field(record, "tags"),
+			Status: field(record, "status"),
+		}
+		item.TimeAdded, _ = strconv.ParseInt(field(record, "time_added"), 10, 64)
+		items = append(items, item)
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func newPocketExportApp(t *testing.T) (*App, *readecktest.Server) {
+	t.Helper()
+	mockServer := readecktest.NewServer()
+	t.Cleanup(mockServer.Close)
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+	)
+	return app, mockServer
+}
+
+func TestHandlePocketExport(t *testing.T) {
+	app, mockServer := newPocketExportApp(t)
+	added := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "One, with a comma", Created: added}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2", Title: "Two", Labels: []string{"go", "kobo"}, IsArchived: true, Created: added.Add(time.Hour)}, "")
+
+	rr := httptest.NewRecorder()
+	app.HandlePocketExport(rr, httptest.NewRequest(http.MethodGet, "/api/pocket/export?token="+mockDeviceToken, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body)
+	}
+	want := "title,url,time_added,tags,status\n" +
+		`"One, with a comma",https://example.com/1,1714564800,,unread` + "\n" +
+		"Two,https://example.com/2,1714568400,go|kobo,archive\n"
+	if rr.Body.String() != want {
+		t.Errorf("expected CSV\n%s\ngot\n%s", want, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandlePocketExport(rr, httptest.NewRequest(http.MethodGet, "/api/pocket/export?format=json&token="+mockDeviceToken, nil))
+	var items []models.PocketExportItem
+	if err := json.NewDecoder(rr.Body).Decode(&items); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(items) != 2 || items[1].Status != "archive" || items[1].Tags != "go|kobo" {
+		t.Errorf("unexpected JSON export: %+v", items)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandlePocketExport(rr, httptest.NewRequest(http.MethodGet, "/api/pocket/export?token=invalid", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for an unknown token, got %d", rr.Code)
+	}
+}
+
+func TestHandlePocketImport(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCreated []string
+	}{
+		{
+			name:        "CSV with an extra column",
+			contentType: "text/csv",
+			body: "title,url,time_added,cursor,tags,status\n" +
+				"Known,https://example.com/known,1714564800,c1,,unread\n" +
+				"New,https://example.com/new,1714564800,c2,go|kobo,archive\n" +
+				"New again,https://example.com/new,1714564800,c3,,unread\n",
+			wantStatus:  http.StatusOK,
+			wantCreated: []string{"https://example.com/new"},
+		},
+		{
+			name:        "JSON",
+			contentType: "application/json",
+			body:        `[{"url":"https://example.com/new","title":"New","tags":"go|kobo","status":"archive"}]`,
+			wantStatus:  http.StatusOK,
+			wantCreated: []string{"https://example.com/new"},
+		},
+		{
+			name:        "CSV without a url column",
+			contentType: "text/csv",
+			body:        "title,status\nNew,unread\n",
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mockServer := newPocketExportApp(t)
+			mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/known"}, "")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/pocket/import", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+mockDeviceToken)
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			app.HandlePocketImport(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body)
+			}
+			if created := mockServer.Created(); !slices.Equal(created, tt.wantCreated) {
+				t.Errorf("expected created %v, got %v", tt.wantCreated, created)
+			}
+			if tt.wantCreated == nil {
+				return
+			}
+			bookmark, ok := mockServer.Bookmark("created-1")
+			if !ok || !bookmark.IsArchived || !slices.Equal(bookmark.Labels, []string{"go", "kobo"}) {
+				t.Errorf("expected an archived bookmark labeled go and kobo, got %+v", bookmark)
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+)
+
+// portalCookie holds the session of a user logged in to the portal.
+const portalCookie = "readeckobo_portal"
+
+// portalPreferences are the sync choices made for a device in the portal;
+// they replace the ones of its configuration.
+type portalPreferences struct {
+	Labels            []string `json:"labels,omitempty"`
+	SyncArchived      bool     `json:"sync_archived"`
+	MaxItems          int      `json:"max_items,omitempty"`
+	MaxArticleAgeDays int      `json:"max_article_age_days,omitempty"`
+	MinWordCount      int      `json:"min_word_count,omitempty"`
+}
+
+// portalDevice is what the portal knows of a device: the Readeck user who
+// paired it and their sync choices.
+type portalDevice struct {
+	Owner       string             `json:"owner,omitempty"`
+	Preferences *portalPreferences `json:"preferences,omitempty"`
+}
+
+// portalState keeps the devices paired and the choices made in the portal,
+// by device token, mirrored to a JSON file when one is configured.
+type portalState struct {
+	mu      sync.Mutex
+	path    string
+	devices map[string]*portalDevice
+}
+
+func newPortalState(path string) *portalState {
+	return &portalState{path: path, devices: make(map[string]*portalDevice)}
+}
+
+// load reads the portal file written by a previous run.
+func (s *portalState) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read portal state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.Unmarshal(data, &s.devices); err != nil {
+		return fmt.Errorf("failed to parse portal state %s: %w", s.path, err)
+	}
+	if s.devices == nil {
+		s.devices = make(map[string]*portalDevice)
+	}
+	return nil
+}
+
+// save writes the portal file; s.mu must be held.
+func (s *portalState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.devices)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write portal state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write portal state: %w", err)
+	}
+	return nil
+}
+
+// device returns the entry of deviceToken, creating it; s.mu must be held.
+func (s *portalState) device(deviceToken string) *portalDevice {
+	device, ok := s.devices[deviceToken]
+	if !ok {
+		device = &portalDevice{}
+		s.devices[deviceToken] = device
+	}
+	return device
+}
+
+// setOwner records that the Readeck user owner paired deviceToken.
+func (s *portalState) setOwner(deviceToken, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device(deviceToken).Owner = owner
+	return s.save()
+}
+
+// setPreferences stores the sync choices made for deviceToken.
+func (s *portalState) setPreferences(deviceToken string, prefs portalPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device(deviceToken).Preferences = &prefs
+	return s.save()
+}
+
+// owner returns the Readeck user who paired deviceToken in the portal, or "".
+func (s *portalState) owner(deviceToken string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if device, ok := s.devices[deviceToken]; ok {
+		return device.Owner
+	}
+	return ""
+}
+
+// apply replaces the sync options of users with the choices made for them
+// in the portal.
+func (s *portalState) apply(users []config.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range users {
+		device, ok := s.devices[users[i].Token]
+		if !ok || device.Preferences == nil {
+			continue
+		}
+		prefs := device.Preferences
+		syncArchived := prefs.SyncArchived
+		users[i].Labels = prefs.Labels
+		users[i].SyncArchived = &syncArchived
+		users[i].MaxItems = prefs.MaxItems
+		users[i].MaxArticleAgeDays = prefs.MaxArticleAgeDays
+		users[i].MinWordCount = prefs.MinWordCount
+	}
+}
+
+// portalSession is a Readeck user logged in to the portal, with the token
+// Readeck issued at login, which devices they pair are given.
+type portalSession struct {
+	Username     string
+	ReadeckToken string
+	// readeckTokenID identifies ReadeckToken for revoking it.
+	readeckTokenID string
+	// paired is set once a device was given ReadeckToken, which then
+	// outlives the session.
+	paired  bool
+	expires time.Time
+	timer   *time.Timer
+}
+
+// portalSessions holds the sessions of the portal in memory; a restart logs
+// everyone out.
+type portalSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*portalSession
+	// revoke is called with each session that ends, at logout or expiry,
+	// without having paired a device.
+	revoke func(*portalSession)
+}
+
+func newPortalSessions(revoke func(*portalSession)) *portalSessions {
+	return &portalSessions{sessions: make(map[string]*portalSession), revoke: revoke}
+}
+
+// create starts a session lasting ttl and returns its ID.
+func (s *portalSessions) create(username string, readeckToken *readeck.AuthToken, ttl time.Duration) (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id] = &portalSession{
+		Username:       username,
+		ReadeckToken:   readeckToken.Token,
+		readeckTokenID: readeckToken.ID,
+		expires:        time.Now().Add(ttl),
+		timer:          time.AfterFunc(ttl, func() { s.end(id) }),
+	}
+	return id, nil
+}
+
+// get returns the session with id unless it expired.
+func (s *portalSessions) get(id string) (*portalSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.expires) {
+		return nil, false
+	}
+	return session, true
+}
+
+// markPaired records that a device was given the Readeck token of session.
+func (s *portalSessions) markPaired(session *portalSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.paired = true
+}
+
+// end removes the session with id and revokes its Readeck token unless a
+// device uses it.
+func (s *portalSessions) end(id string) {
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	if ok {
+		delete(s.sessions, id)
+		session.timer.Stop()
+	}
+	revoke := ok && !session.paired && s.revoke != nil
+	s.mu.Unlock()
+
+	if revoke {
+		s.revoke(session)
+	}
+}
+
+// revokePortalToken deletes the Readeck token issued for a portal session.
+// Failures are logged; the token then stays listed in Readeck.
+func (a *App) revokePortalToken(session *portalSession) {
+	if session.readeckTokenID == "" {
+		return
+	}
+	client, err := readeck.NewClient(a.Config.Readeck.Host, session.ReadeckToken, a.Logger, a.ReadeckHTTPClient)
+	if err == nil {
+		err = client.RevokeToken(context.Background(), session.readeckTokenID)
+	}
+	if err != nil {
+		a.Logger.Warnf("Error revoking the Readeck token of portal user %s: %v", session.Username, err)
+		return
+	}
+	a.Logger.Infof("Revoked the Readeck token of portal user %s.", session.Username)
+}
+
+// LoadPortal restores the devices paired and the choices made in the portal
+// before readeckobo last stopped.
+func (a *App) LoadPortal() error {
+	return a.portal.load()
+}
+
+type portalDeviceView struct {
+	Token    string
+	Device   string
+	Kobo     string
+	LastSync time.Time
+	History  []syncRecord
+	// Labels are the labels synced, comma-separated.
+	Labels            string
+	SyncArchived      bool
+	MaxItems          int
+	MaxArticleAgeDays int
+	MinWordCount      int
+}
+
+type portalData struct {
+	Error    string
+	Message  string
+	Username string
+	Devices  []portalDeviceView
+	// BridgeURL is suggested for pairing a device.
+	BridgeURL string
+	Serial    string
+	Paired    *pairedDevice
+}
+
+// portalSession returns the session of the request, if logged in.
+func (a *App) portalSession(r *http.Request) (*portalSession, bool) {
+	cookie, err := r.Cookie(portalCookie)
+	if err != nil {
+		return nil, false
+	}
+	return a.sessions.get(cookie.Value)
+}
+
+// portalDevices returns the devices of the Readeck user username: those
+// they paired in the portal and those configured with their user name.
+func (a *App) portalDevices(username string) []config.User {
+	var devices []config.User
+	for _, user := range a.users() {
+		owner := a.portal.owner(user.Token)
+		if owner == username || owner == "" && user.ReadeckUsername == username {
+			devices = append(devices, user)
+		}
+	}
+	return devices
+}
+
+// HandlePortal shows the devices of the logged in user, or the login form.
+func (a *App) HandlePortal(w http.ResponseWriter, r *http.Request) {
+	a.renderPortal(w, r, portalData{})
+}
+
+// HandlePortalLogin logs a user in with their Readeck credentials.
+func (a *App) HandlePortalLogin(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	if username == "" || password == "" {
+		a.renderPortal(w, r, portalData{Error: "Readeck user name and password are required."})
+		return
+	}
+
+	client, err := readeck.NewClient(a.Config.Readeck.Host, "", a.Logger, a.ReadeckHTTPClient)
+	if err != nil {
+		a.renderPortal(w, r, portalData{Error: "Failed to initialize Readeck client: " + err.Error()})
+		return
+	}
+	login, err := client.Login(r.Context(), username, password, tokenApplication)
+	if err != nil {
+		a.Logger.Warnf("Error logging in to Readeck in /portal/login: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		a.renderPortal(w, r, portalData{Error: "Readeck login failed."})
+		return
+	}
+	// Readeck's spelling of the user name identifies their devices.
+	client.SetAccessToken(login.Token)
+	if profile, err := client.GetProfile(r.Context()); err == nil && profile.User.Username != "" {
+		username = profile.User.Username
+	}
+
+	id, err := a.sessions.create(username, login, a.Config.Portal.SessionTTL)
+	if err != nil {
+		a.renderPortal(w, r, portalData{Error: "Failed to start a session: " + err.Error()})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     portalCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(a.Config.Portal.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.URL.Scheme == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	a.Logger.Infof("Readeck user %s logged in to the portal.", username)
+	r.AddCookie(&http.Cookie{Name: portalCookie, Value: id})
+	a.renderPortal(w, r, portalData{})
+}
+
+// HandlePortalLogout ends the session of the request, revoking its Readeck
+// token unless a device was paired with it.
+func (a *App) HandlePortalLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(portalCookie); err == nil {
+		a.sessions.end(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: portalCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	a.renderPortal(w, r, portalData{Message: "Logged out."})
+}
+
+// HandlePortalPair adds a Kobo for the logged in user, with the Readeck
+// token of their session, and shows its settings.
+func (a *App) HandlePortalPair(w http.ResponseWriter, r *http.Request) {
+	session, ok := a.portalSession(r)
+	if !ok {
+		a.renderPortal(w, r, portalData{Error: "Your session expired, log in again."})
+		return
+	}
+	data := portalData{
+		Serial:    strings.TrimSpace(r.FormValue("serial")),
+		BridgeURL: strings.TrimSuffix(strings.TrimSpace(r.FormValue("bridge_url")), "/"),
+	}
+	if data.Serial == "" || data.BridgeURL == "" {
+		data.Error = "Serial number and bridge URL are required."
+		a.renderPortal(w, r, data)
+		return
+	}
+
+	if _, err := parseBridgeURL(data.BridgeURL); err != nil {
+		data.Error = "The bridge URL must be an http or https URL without a query or fragment."
+		a.renderPortal(w, r, data)
+		return
+	}
+
+	paired, err := a.pairDevice(r, data.Serial, data.BridgeURL, session.ReadeckToken)
+	if err != nil {
+		data.Error = "Pairing failed: " + err.Error()
+		a.renderPortal(w, r, data)
+		return
+	}
+	a.sessions.markPaired(session)
+	if err := a.portal.setOwner(paired.DeviceToken, session.Username); err != nil {
+		a.Logger.Errorf("Error saving portal state in /portal/pair: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+	data.Paired = paired
+	a.renderPortal(w, r, data)
+}
+
+// HandlePortalPreferences saves the sync choices for one of the logged in
+// user's devices.
+func (a *App) HandlePortalPreferences(w http.ResponseWriter, r *http.Request) {
+	session, ok := a.portalSession(r)
+	if !ok {
+		a.renderPortal(w, r, portalData{Error: "Your session expired, log in again."})
+		return
+	}
+	deviceToken := r.FormValue("device")
+	owned := false
+	for _, user := range a.portalDevices(session.Username) {
+		owned = owned || user.Token == deviceToken
+	}
+	if !owned {
+		http.Error(w, "Unknown device", http.StatusBadRequest)
+		return
+	}
+
+	prefs := portalPreferences{SyncArchived: r.FormValue("sync_archived") != ""}
+	for _, label := range strings.Split(r.FormValue("labels"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			prefs.Labels = append(prefs.Labels, label)
+		}
+	}
+	for name, field := range map[string]*int{"max_items": &prefs.MaxItems, "max_article_age_days": &prefs.MaxArticleAgeDays, "min_word_count": &prefs.MinWordCount} {
+		value := strings.TrimSpace(r.FormValue(name))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			a.renderPortal(w, r, portalData{Error: "Limits must be positive numbers or empty."})
+			return
+		}
+		*field = n
+	}
+
+	if err := a.portal.setPreferences(deviceToken, prefs); err != nil {
+		a.Logger.Errorf("Error saving portal state in /portal/preferences: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		a.renderPortal(w, r, portalData{Error: "Failed to save the choices: " + err.Error()})
+		return
+	}
+	a.Logger.Infof("Readeck user %s changed the sync choices of device %s in the portal.", session.Username, maskToken(deviceToken))
+	a.renderPortal(w, r, portalData{Message: "Sync choices of device " + maskToken(deviceToken) + " saved; they apply from its next sync."})
+}
+
+func (a *App) renderPortal(w http.ResponseWriter, r *http.Request, data portalData) {
+	if session, ok := a.portalSession(r); ok {
+		data.Username = session.Username
+		if data.BridgeURL == "" {
+			data.BridgeURL = a.bridgeURL(r)
+		}
+		for _, user := range a.portalDevices(session.Username) {
+			view := portalDeviceView{
+				Token:             user.Token,
+				Device:            maskToken(user.Token),
+				Labels:            strings.Join(user.Labels, ", "),
+				SyncArchived:      user.SyncsArchived(),
+				MaxItems:          user.MaxItems,
+				MaxArticleAgeDays: user.MaxArticleAgeDays,
+				MinWordCount:      user.MinWordCount,
+			}
+			view.Kobo = describeDevice(a.devices.get(user.Token))
+			if uc, ok := a.contexts.lookup(user.Token); ok {
+				view.LastSync = uc.LastSync()
+				view.History = uc.History()
+			}
+			data.Devices = append(data.Devices, view)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "portal.html", data); err != nil {
+		a.Logger.Errorf("Error rendering portal in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+	}
+}
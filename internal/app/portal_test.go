@@ -0,0 +1,169 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+)
+
+func TestPortal(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth":
+			_, _ = w.Write([]byte(`{"id": "t1", "token": "alice-token"}`))
+		case "/api/profile":
+			_, _ = w.Write([]byte(`{"user": {"username": "Alice"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: "bob-device", ReadeckAccessToken: "bob-token", ReadeckUsername: "bob"}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+			Portal:  config.ConfigPortal{Enabled: true, File: filepath.Join(t.TempDir(), "portal.json"), SessionTTL: time.Hour},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	post := func(handler http.HandlerFunc, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/portal/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+
+	rr := post(app.HandlePortalLogin, nil, url.Values{"username": {"alice"}, "password": {"secret"}})
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != portalCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly session cookie, got %+v", cookies)
+	}
+	session := cookies[0]
+	if !strings.Contains(rr.Body.String(), "Logged in as Alice") {
+		t.Errorf("expected the Readeck user name in the portal, got %s", rr.Body.String())
+	}
+
+	rr = post(app.HandlePortalPair, session, url.Values{"serial": {"N123456789"}, "bridge_url": {"https://kobo.example.com"}})
+	if !strings.Contains(rr.Body.String(), "https://kobo.example.com/instapaper-proxy/instapaper") {
+		t.Fatalf("expected the Kobo settings after pairing, got %s", rr.Body.String())
+	}
+	devices := app.portalDevices("Alice")
+	if len(devices) != 1 || devices[0].ReadeckAccessToken != "alice-token" {
+		t.Fatalf("expected one device paired with Alice's Readeck token, got %+v", devices)
+	}
+	deviceToken := devices[0].Token
+
+	rr = post(app.HandlePortalPreferences, session, url.Values{
+		"device":        {deviceToken},
+		"labels":        {"kobo, long reads"},
+		"sync_archived": {"1"},
+		"max_items":     {"25"},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	user, err := app.getUser(t.Context(), deviceToken)
+	if err != nil {
+		t.Fatalf("getUser failed: %v", err)
+	}
+	if len(user.Labels) != 2 || user.Labels[1] != "long reads" || !user.SyncsArchived() || user.MaxItems != 25 {
+		t.Errorf("expected the portal choices to apply to the device, got %+v", user)
+	}
+
+	rr = post(app.HandlePortalPreferences, session, url.Values{"device": {"bob-device"}, "max_items": {"1"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for another user's device, got %d", rr.Code)
+	}
+
+	rr = post(app.HandlePortalPair, nil, url.Values{"serial": {"N123456789"}, "bridge_url": {"https://kobo.example.com"}})
+	if len(app.users()) != 2 || !strings.Contains(rr.Body.String(), "session expired") {
+		t.Errorf("expected pairing without a session to be refused, got %d users", len(app.users()))
+	}
+
+	reloaded := newPortalState(app.Config.Portal.File)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if owner := reloaded.owner(deviceToken); owner != "Alice" {
+		t.Errorf("expected the owner to be restored, got %q", owner)
+	}
+}
+
+func TestPortalRevokesUnpairedTokens(t *testing.T) {
+	revoked := make(chan string, 4)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/auth":
+			_, _ = w.Write([]byte(`{"id": "t1", "token": "alice-token"}`))
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/profile/tokens/"):
+			revoked <- strings.TrimPrefix(r.URL.Path, "/api/profile/tokens/")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	portal := config.ConfigPortal{Enabled: true, SessionTTL: time.Hour}
+	app := NewApp(
+		WithConfig(&config.Config{Readeck: config.ConfigReadeck{Host: mockServer.URL}, Portal: portal}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	post := func(handler http.HandlerFunc, cookie *http.Cookie, form url.Values) *http.Cookie {
+		r := httptest.NewRequest(http.MethodPost, "/portal/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		if cookies := rr.Result().Cookies(); len(cookies) == 1 {
+			return cookies[0]
+		}
+		return nil
+	}
+	login := url.Values{"username": {"alice"}, "password": {"secret"}}
+
+	session := post(app.HandlePortalLogin, nil, login)
+	post(app.HandlePortalLogout, session, nil)
+	select {
+	case id := <-revoked:
+		if id != "t1" {
+			t.Errorf("expected token t1 to be revoked, got %s", id)
+		}
+	default:
+		t.Error("expected the token to be revoked at logout")
+	}
+
+	session = post(app.HandlePortalLogin, nil, login)
+	post(app.HandlePortalPair, session, url.Values{"serial": {"N123456789"}, "bridge_url": {"https://kobo.example.com"}})
+	post(app.HandlePortalLogout, session, nil)
+	select {
+	case <-revoked:
+		t.Error("expected the token of a paired device to be kept")
+	default:
+	}
+
+	app.Config.Portal.SessionTTL = 10 * time.Millisecond
+	post(app.HandlePortalLogin, nil, login)
+	select {
+	case <-revoked:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the token to be revoked when the session expired")
+	}
+}
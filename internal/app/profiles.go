@@ -0,0 +1,163 @@
+package app
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"readeckobo/internal/config"
+	"readeckobo/internal/storeapi"
+)
+
+// defaultJPEGQuality is used without a profile or when it sets no quality.
+const defaultJPEGQuality = 85
+
+// lineArtColors is the most distinct colors an image may have to be encoded
+// as PNG line art rather than as a JPEG photo.
+const lineArtColors = 32
+
+// deviceProfile returns the profile for a device: the one its user names,
+// or one matched by its token first, by the model it was identified as
+// next and by its User-Agent otherwise, or nil when none matches.
+func (a *App) deviceProfile(deviceToken, userAgent string) *config.DeviceProfile {
+	if deviceToken != "" {
+		for _, user := range a.Config.Users {
+			if user.Token == deviceToken && user.DeviceProfile != "" {
+				return a.profileByModel(user.DeviceProfile)
+			}
+		}
+	}
+	profiles := a.Config.DeviceProfiles
+	for i := range profiles {
+		if deviceToken != "" && slices.Contains(profiles[i].Tokens, deviceToken) {
+			return &profiles[i]
+		}
+	}
+	if model := a.deviceModel(deviceToken); model != "" {
+		for i := range profiles {
+			if slices.ContainsFunc(profiles[i].Devices, func(d string) bool { return strings.EqualFold(d, model) }) {
+				return &profiles[i]
+			}
+		}
+	}
+	for i := range profiles {
+		if profiles[i].UserAgent != "" && strings.Contains(userAgent, profiles[i].UserAgent) {
+			return &profiles[i]
+		}
+	}
+	return nil
+}
+
+// profileByModel returns the profile of model, or nil.
+func (a *App) profileByModel(model string) *config.DeviceProfile {
+	for i := range a.Config.DeviceProfiles {
+		if a.Config.DeviceProfiles[i].Model == model {
+			return &a.Config.DeviceProfiles[i]
+		}
+	}
+	return nil
+}
+
+// imageProfile returns the profile a convert-image request targets: the one
+// named by its profile parameter, or the one matching its User-Agent. Its
+// quality parameter overrides the profile's JPEG quality.
+func (a *App) imageProfile(r *http.Request) *config.DeviceProfile {
+	var profile *config.DeviceProfile
+	if model := r.URL.Query().Get("profile"); model != "" {
+		profile = a.profileByModel(model)
+	}
+	if profile == nil {
+		profile = a.deviceProfile("", r.UserAgent())
+	}
+	if quality, err := strconv.Atoi(r.URL.Query().Get("quality")); err == nil && quality > 0 && quality <= 100 && profile != nil {
+		p := *profile
+		p.JPEGQuality = quality
+		profile = &p
+	}
+	return profile
+}
+
+// profileImageURL points an article image at convert-image for profile, so
+// the device receives it in a size and format it handles. The article URL
+// is passed along when the image is fetched with it as the Referer.
+func (a *App) profileImageURL(r *http.Request, src, articleURL string, profile *config.DeviceProfile) string {
+	query := url.Values{"url": {src}, "profile": {profile.Model}}
+	if named := a.profileByModel(profile.Model); named != nil && profile.JPEGQuality != named.JPEGQuality {
+		// The user overrides the profile's quality.
+		query.Set("quality", strconv.Itoa(jpegQuality(profile)))
+	}
+	if articleURL != "" {
+		if u, err := url.Parse(src); err == nil && a.imageFetchFor(u.Hostname()).referer {
+			query.Set("referer", articleURL)
+		}
+	}
+	return a.bridgeURL(r) + storeapi.InstapaperPath + "/api/convert-image?" + query.Encode()
+}
+
+// fitImage scales img down to fit the profile's screen, keeping its aspect
+// ratio. The result is always an *image.RGBA with a white background.
+func fitImage(img image.Image, profile *config.DeviceProfile) *image.RGBA {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if profile != nil {
+		if profile.MaxWidth > 0 && width > profile.MaxWidth {
+			width, height = profile.MaxWidth, max(1, height*profile.MaxWidth/width)
+		}
+		if profile.MaxHeight > 0 && height > profile.MaxHeight {
+			width, height = max(1, width*profile.MaxHeight/height), profile.MaxHeight
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	if width == b.Dx() && height == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	} else {
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	}
+	return dst
+}
+
+// imageFormat picks the format img is sent in: PNG for line art when the
+// profile supports it, JPEG otherwise, or whichever one it supports.
+func imageFormat(img *image.RGBA, profile *config.DeviceProfile) string {
+	if profile == nil || len(profile.Formats) == 0 {
+		return "jpeg"
+	}
+	png := slices.Contains(profile.Formats, "png")
+	if !slices.Contains(profile.Formats, "jpeg") {
+		return "png"
+	}
+	if png && isLineArt(img) {
+		return "png"
+	}
+	return "jpeg"
+}
+
+// jpegQuality returns the JPEG quality for profile.
+func jpegQuality(profile *config.DeviceProfile) int {
+	if profile == nil || profile.JPEGQuality == 0 {
+		return defaultJPEGQuality
+	}
+	return profile.JPEGQuality
+}
+
+// isLineArt reports whether img uses few enough colors, such as a diagram
+// or a chart, to be sharper and smaller as a PNG.
+func isLineArt(img *image.RGBA) bool {
+	colors := make(map[color.RGBA]struct{})
+	step := max(1, len(img.Pix)/4/10000) * 4
+	for i := 0; i+3 < len(img.Pix); i += step {
+		colors[color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}] = struct{}{}
+		if len(colors) > lineArtColors {
+			return false
+		}
+	}
+	return true
+}
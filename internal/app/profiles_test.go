@@ -0,0 +1,175 @@
+package app
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+var testProfiles = []config.DeviceProfile{
+	{Model: "libra2", UserAgent: "Kobo Libra 2", MaxWidth: 100, MaxHeight: 100, Formats: []string{"jpeg", "png"}},
+	{Model: "clara", Tokens: []string{mockDeviceToken}, MaxWidth: 50, Formats: []string{"jpeg"}, JPEGQuality: 60},
+}
+
+func TestDeviceProfile(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{
+		Users:          []config.User{{Token: "pinned", DeviceProfile: "libra2"}},
+		DeviceProfiles: testProfiles,
+	}), WithLogger(testLogger))
+
+	tests := []struct {
+		name        string
+		deviceToken string
+		userAgent   string
+		want        string
+	}{
+		{name: "token wins over user agent", deviceToken: mockDeviceToken, userAgent: "Mozilla/5.0 Kobo Libra 2", want: "clara"},
+		{name: "user agent", deviceToken: "other", userAgent: "Mozilla/5.0 Kobo Libra 2", want: "libra2"},
+		{name: "no match", deviceToken: "other", userAgent: "curl/8.0", want: ""},
+		{name: "user's profile", deviceToken: "pinned", userAgent: "curl/8.0", want: "libra2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if profile := app.deviceProfile(tt.deviceToken, tt.userAgent); profile != nil {
+				got = profile.Model
+			}
+			if got != tt.want {
+				t.Errorf("expected profile %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFitImageAndFormat(t *testing.T) {
+	lineArt := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	photo := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 200; y++ {
+			photo.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 0xff})
+		}
+	}
+
+	tests := []struct {
+		name       string
+		img        image.Image
+		profile    *config.DeviceProfile
+		wantWidth  int
+		wantHeight int
+		wantFormat string
+	}{
+		{name: "no profile", img: photo, wantWidth: 400, wantHeight: 200, wantFormat: "jpeg"},
+		{name: "line art as png", img: lineArt, profile: &testProfiles[0], wantWidth: 100, wantHeight: 50, wantFormat: "png"},
+		{name: "photo as jpeg", img: photo, profile: &testProfiles[0], wantWidth: 100, wantHeight: 50, wantFormat: "jpeg"},
+		{name: "jpeg only", img: lineArt, profile: &testProfiles[1], wantWidth: 50, wantHeight: 25, wantFormat: "jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fitted := fitImage(tt.img, tt.profile)
+			if b := fitted.Bounds(); b.Dx() != tt.wantWidth || b.Dy() != tt.wantHeight {
+				t.Errorf("expected %dx%d, got %dx%d", tt.wantWidth, tt.wantHeight, b.Dx(), b.Dy())
+			}
+			if format := imageFormat(fitted, tt.profile); format != tt.wantFormat {
+				t.Errorf("expected format %s, got %s", tt.wantFormat, format)
+			}
+		})
+	}
+}
+
+func TestHandleConvertImageProfile(t *testing.T) {
+	imgSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_ = png.Encode(w, image.NewRGBA(image.Rect(0, 0, 400, 200)))
+	}))
+	defer imgSrv.Close()
+
+	app := NewApp(WithConfig(&config.Config{DeviceProfiles: testProfiles}), WithLogger(testLogger))
+	req := httptest.NewRequest(http.MethodGet, "/api/convert-image?"+url.Values{"url": {imgSrv.URL}, "profile": {"libra2"}}.Encode(), nil)
+	rr := httptest.NewRecorder()
+
+	app.HandleConvertImage(rr, req)
+
+	if rr.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected content type image/png, got %s", rr.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("expected 100x50, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestHandleKoboDownloadProfileImages(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/bookmarks" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id":"1","title":"Test Article","url":"http://example.com/article1"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><img src="http://example.com/image.png"></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:          []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck:        config.ConfigReadeck{Host: mockServer.URL},
+			DeviceProfiles: testProfiles,
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	form := url.Values{"access_token": {mockDeviceToken}, "url": {"http://example.com/article1"}}
+	req := httptest.NewRequest(http.MethodPost, "https://bridge.example.com/api/kobo/download", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	app.HandleKoboDownload(rr, req)
+
+	var resp struct {
+		Images map[string]struct {
+			Src string `json:"src"`
+		} `json:"images"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := "https://bridge.example.com/instapaper-proxy/instapaper/api/convert-image?profile=clara&url=http%3A%2F%2Fexample.com%2Fimage.png"
+	if got := resp.Images["0"].Src; got != want {
+		t.Errorf("expected image src %q, got %q", want, got)
+	}
+}
+
+func TestImageProfileQuality(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{DeviceProfiles: testProfiles}), WithLogger(testLogger))
+	req := httptest.NewRequest(http.MethodGet, "https://bridge.example.com/api/kobo/download", nil)
+
+	profile := *app.profileByModel("clara")
+	profile.JPEGQuality = 40
+	imageURL, err := url.Parse(app.profileImageURL(req, "http://example.com/image.png", "", &profile))
+	if err != nil {
+		t.Fatalf("failed to parse image URL: %v", err)
+	}
+	if got := imageURL.Query().Get("quality"); got != "40" {
+		t.Errorf("expected the quality override in the URL, got %q", got)
+	}
+
+	got := app.imageProfile(httptest.NewRequest(http.MethodGet, "/api/convert-image?"+imageURL.RawQuery, nil))
+	if got == nil || got.Model != "clara" || got.JPEGQuality != 40 {
+		t.Errorf("expected clara with quality 40, got %+v", got)
+	}
+	if testProfiles[1].JPEGQuality != 60 {
+		t.Errorf("expected the configured profile to be unchanged, got %+v", testProfiles[1])
+	}
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+// defaultWordsPerMinute is used when reading_progress.words_per_minute is
+// unset.
+const defaultWordsPerMinute = 230
+
+// openedItemTTL is how long an opened item waits for the device to leave it
+// before it is forgotten.
+const openedItemTTL = 24 * time.Hour
+
+// openItem notes that the device opened itemID at at.
+func (uc *UserContext) openItem(itemID string, at time.Time) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.opened == nil {
+		uc.opened = make(map[string]time.Time)
+	}
+	for id, opened := range uc.opened {
+		if at.Sub(opened) > openedItemTTL {
+			delete(uc.opened, id)
+		}
+	}
+	uc.opened[itemID] = at
+}
+
+// leaveItem returns how long the device kept itemID open until at, and
+// false if it was not seen opening it.
+func (uc *UserContext) leaveItem(itemID string, at time.Time) (time.Duration, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	opened, ok := uc.opened[itemID]
+	if !ok {
+		return 0, false
+	}
+	delete(uc.opened, itemID)
+	return max(at.Sub(opened), 0), true
+}
+
+// actionTime returns the time of a Pocket action, sent as Unix seconds in a
+// string or a number, or fallback when it has none.
+func actionTime(actionMap map[string]any, fallback time.Time) time.Time {
+	switch v := actionMap["time"].(type) {
+	case string:
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(sec, 0)
+		}
+	case float64:
+		return time.Unix(int64(v), 0)
+	}
+	return fallback
+}
+
+// estimateProgress returns the read_progress of a bookmark of wordCount
+// words at progress after reading it for elapsed at wordsPerMinute.
+func estimateProgress(progress, wordCount, wordsPerMinute int, elapsed time.Duration) int {
+	if wordCount <= 0 {
+		return progress
+	}
+	read := int(elapsed.Minutes() * float64(wordsPerMinute) * 100 / float64(wordCount))
+	return min(progress+read, 100)
+}
+
+// planReadingProgress adds to ops the read_progress that the opened_item and
+// left_item actions of a /api/kobo/send request imply, estimated from the
+// time each item stayed open and the word count of its bookmark. An item
+// opened in an earlier request is matched through uc. The left_item actions
+// report the outcome of the change they led to. Progress only moves forward,
+// and deleted items are left alone.
+func (a *App) planReadingProgress(ctx context.Context, readeckClient *readeck.Client, uc *UserContext, actions []any, ops []*sendOp, opOf []int) []*sendOp {
+	cfg := a.Config.ReadingProgress
+	wordsPerMinute := cfg.WordsPerMinute
+	if wordsPerMinute <= 0 {
+		wordsPerMinute = defaultWordsPerMinute
+	}
+
+	now := time.Now()
+	elapsed := make(map[string]time.Duration)
+	leftBy := make(map[string][]int)
+	var items []string
+	for i, actionInterface := range actions {
+		actionMap, ok := actionInterface.(map[string]any)
+		if !ok {
+			continue
+		}
+		itemID, _ := actionMap["item_id"].(string)
+		switch actionMap["action"] {
+		case "opened_item":
+			uc.openItem(itemID, actionTime(actionMap, now))
+		case "left_item":
+			session, ok := uc.leaveItem(itemID, actionTime(actionMap, now))
+			if !ok {
+				continue
+			}
+			if cfg.MaxSession > 0 {
+				session = min(session, cfg.MaxSession)
+			}
+			if _, seen := elapsed[itemID]; !seen {
+				items = append(items, itemID)
+			}
+			elapsed[itemID] += session
+			leftBy[itemID] = append(leftBy[itemID], i)
+		}
+	}
+
+	for _, itemID := range items {
+		index := -1
+		for i, op := range ops {
+			if op.update != nil && op.itemID == itemID {
+				index = i
+			}
+		}
+		if index >= 0 && ops[index].update["is_deleted"] == true {
+			continue
+		}
+
+		bookmark, err := readeckClient.GetBookmarkDetails(ctx, itemID)
+		if err != nil {
+			a.Logger.Warnf("Error fetching bookmark %s to estimate its reading progress in /api/kobo/send: %v", itemID, err)
+			continue
+		}
+		progress := estimateProgress(bookmark.ReadProgress, bookmark.WordCount, wordsPerMinute, elapsed[itemID])
+		a.Logger.Debugf("Estimated reading progress of bookmark %s at %d%% after %s open in /api/kobo/send", itemID, progress, elapsed[itemID])
+		if progress <= bookmark.ReadProgress {
+			continue
+		}
+
+		if index < 0 {
+			ops = append(ops, &sendOp{itemID: itemID, update: map[string]any{}})
+			index = len(ops) - 1
+		}
+		ops[index].update["read_progress"] = progress
+		for _, i := range leftBy[itemID] {
+			opOf[i] = index
+		}
+	}
+	return ops
+}
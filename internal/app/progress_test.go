@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestEstimateProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		progress  int
+		wordCount int
+		elapsed   time.Duration
+		want      int
+	}{
+		{name: "half read", wordCount: 2000, elapsed: 5 * time.Minute, want: 50},
+		{name: "adds to progress", progress: 30, wordCount: 2000, elapsed: 2 * time.Minute, want: 50},
+		{name: "capped", progress: 90, wordCount: 2000, elapsed: time.Hour, want: 100},
+		{name: "unknown word count", progress: 20, elapsed: time.Hour, want: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateProgress(tt.progress, tt.wordCount, 200, tt.elapsed); got != tt.want {
+				t.Errorf("estimateProgress() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleKoboSendEstimatesProgress(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", WordCount: 2000, ReadProgress: 10}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2", WordCount: 2000}, "")
+	mockServer.AddBookmark(readeck.Bookmark{ID: "3", URL: "https://example.com/3", WordCount: 2000}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:           []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck:         config.ConfigReadeck{Host: mockServer.URL},
+			ReadingProgress: config.ConfigReadingProgress{Estimate: true, WordsPerMinute: 200, MaxSession: 10 * time.Minute},
+		}),
+		WithLogger(testLogger),
+	)
+	send := func(actions ...any) models.KoboSendResponse {
+		t.Helper()
+		body, _ := json.Marshal(models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: actions})
+		rr := httptest.NewRecorder()
+		app.HandleKoboSend(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+		var resp models.KoboSendResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := send(
+		map[string]any{"action": "opened_item", "item_id": "1", "time": "1700000000"},
+		map[string]any{"action": "left_item", "item_id": "1", "time": "1700000300"},
+		map[string]any{"action": "opened_item", "item_id": "2", "time": float64(1700000000)},
+		map[string]any{"action": "opened_item", "item_id": "3", "time": "1700000000"},
+		map[string]any{"action": "left_item", "item_id": "3", "time": "1700000600"},
+		map[string]any{"action": "delete", "item_id": "3"},
+	)
+	if !resp.Status {
+		t.Fatalf("expected every action to succeed, got %+v", resp)
+	}
+	if bookmark, _ := mockServer.Bookmark("1"); bookmark.ReadProgress != 60 {
+		t.Errorf("expected bookmark 1 at 60%%, got %d%%", bookmark.ReadProgress)
+	}
+	if bookmark, _ := mockServer.Bookmark("2"); bookmark.ReadProgress != 0 {
+		t.Errorf("expected bookmark 2 untouched until it is left, got %d%%", bookmark.ReadProgress)
+	}
+
+	// The device leaves item 2 in a later request, after a session longer
+	// than max_session.
+	send(map[string]any{"action": "left_item", "item_id": "2", "time": "1700007200"})
+	if bookmark, _ := mockServer.Bookmark("2"); bookmark.ReadProgress != 100 || bookmark.IsArchived {
+		t.Errorf("expected bookmark 2 at 100%% and unread, got %d%%, archived %v", bookmark.ReadProgress, bookmark.IsArchived)
+	}
+}
+
+func TestHandleKoboSendArchivesFinished(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", WordCount: 2000, ReadProgress: 80}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:           []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken, ArchiveOnFinish: 90}},
+			Readeck:         config.ConfigReadeck{Host: mockServer.URL},
+			ReadingProgress: config.ConfigReadingProgress{Estimate: true, WordsPerMinute: 200},
+		}),
+		WithLogger(testLogger),
+	)
+	body, _ := json.Marshal(models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: []any{
+		map[string]any{"action": "opened_item", "item_id": "1", "time": "1700000000"},
+		map[string]any{"action": "left_item", "item_id": "1", "time": "1700000120"},
+	}})
+	rr := httptest.NewRecorder()
+	app.HandleKoboSend(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+
+	if bookmark, _ := mockServer.Bookmark("1"); bookmark.ReadProgress != 100 || !bookmark.IsArchived {
+		t.Errorf("expected bookmark 1 finished and archived, got %d%%, archived %v", bookmark.ReadProgress, bookmark.IsArchived)
+	}
+}
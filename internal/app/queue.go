@@ -0,0 +1,237 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+// queuedAction is a bookmark change that could not reach Readeck and waits to
+// be replayed for the device that sent it.
+type queuedAction struct {
+	DeviceToken string         `json:"device_token"`
+	ItemID      string         `json:"item_id,omitempty"`
+	Update      map[string]any `json:"update,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Title       string         `json:"title,omitempty"`
+	Labels      []string       `json:"labels,omitempty"`
+	Archived    bool           `json:"archived,omitempty"`
+	Queued      time.Time      `json:"queued"`
+}
+
+// createOptions returns the options of the bookmark an add action creates.
+func (q queuedAction) createOptions() readeck.CreateBookmarkOptions {
+	return readeck.CreateBookmarkOptions{Title: q.Title, Labels: q.Labels, Archived: q.Archived}
+}
+
+// actionQueue keeps queued actions in the order the devices sent them,
+// mirrored to a JSON file when one is configured.
+type actionQueue struct {
+	mu      sync.Mutex
+	path    string
+	actions []queuedAction
+}
+
+func newActionQueue(path string) *actionQueue {
+	return &actionQueue{path: path}
+}
+
+// load reads the actions left in the queue file by a previous run.
+func (q *actionQueue) load() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read action queue: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := json.Unmarshal(data, &q.actions); err != nil {
+		return fmt.Errorf("failed to parse action queue %s: %w", q.path, err)
+	}
+	return nil
+}
+
+// save writes the queue file; q.mu must be held.
+func (q *actionQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(q.actions)
+	if err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write action queue: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("failed to write action queue: %w", err)
+	}
+	return nil
+}
+
+func (q *actionQueue) push(actions ...queuedAction) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.actions = append(q.actions, actions...)
+	return q.save()
+}
+
+// head returns the oldest queued action.
+func (q *actionQueue) head() (queuedAction, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.actions) == 0 {
+		return queuedAction{}, false
+	}
+	return q.actions[0], true
+}
+
+// pop removes the oldest queued action once it has been handled.
+func (q *actionQueue) pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.actions) > 0 {
+		q.actions = q.actions[1:]
+	}
+	return q.save()
+}
+
+// pending reports whether deviceToken has actions waiting, in which case new
+// ones must wait behind them to keep their order.
+func (q *actionQueue) pending(deviceToken string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, action := range q.actions {
+		if action.DeviceToken == deviceToken {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *actionQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.actions)
+}
+
+// LoadActionQueue restores the actions that were still waiting for Readeck
+// when readeckobo last stopped.
+func (a *App) LoadActionQueue() error {
+	return a.queue.load()
+}
+
+// queueSendOps queues ops for the device instead of reporting their failure.
+func (a *App) queueSendOps(deviceToken string, ops []*sendOp) error {
+	actions := make([]queuedAction, 0, len(ops))
+	for _, op := range ops {
+		actions = append(actions, queuedAction{
+			DeviceToken: deviceToken,
+			ItemID:      op.itemID,
+			Update:      op.update,
+			URL:         op.url,
+			Title:       op.create.Title,
+			Labels:      op.create.Labels,
+			Archived:    op.create.Archived,
+			Queued:      time.Now(),
+		})
+	}
+	return a.queue.push(actions...)
+}
+
+// RunActionQueue replays queued actions until ctx is done, backing off from
+// action_queue.retry_interval to action_queue.max_retry_interval while
+// Readeck stays unavailable.
+func (a *App) RunActionQueue(ctx context.Context) {
+	interval := a.Config.ActionQueue.RetryInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if a.replayActionQueue(ctx) {
+			interval = a.Config.ActionQueue.RetryInterval
+		} else {
+			interval = min(interval*2, a.Config.ActionQueue.MaxRetryInterval)
+			a.Logger.Infof("Readeck is still unavailable, retrying %d queued actions in %s", a.queue.Len(), interval)
+		}
+		timer.Reset(interval)
+	}
+}
+
+// replayActionQueue applies queued actions oldest first and reports whether
+// the queue was emptied. It stops at the first action Readeck is still
+// unavailable for; actions Readeck rejects are dropped.
+func (a *App) replayActionQueue(ctx context.Context) bool {
+	clients := make(map[string]*readeck.Client)
+	for {
+		action, ok := a.queue.head()
+		if !ok {
+			return true
+		}
+
+		var bookmarkID string
+		client, err := a.queueClient(ctx, clients, action.DeviceToken)
+		if err == nil {
+			if action.Update != nil {
+				err = client.UpdateBookmark(ctx, action.ItemID, action.Update)
+			} else {
+				bookmarkID, err = client.CreateBookmark(ctx, action.URL, action.createOptions())
+			}
+		}
+		if readeck.IsUnavailable(err) {
+			return false
+		}
+		target := action.ItemID
+		if action.Update == nil {
+			target = action.URL
+		}
+		if err != nil {
+			a.Logger.Errorf("Error replaying queued action on %s for device %s: %v", target, maskToken(action.DeviceToken), err)
+		} else {
+			a.Logger.Infof("Replayed queued action on %s for device %s, queued at %s", target, maskToken(action.DeviceToken), action.Queued.Format(time.RFC3339))
+			if bookmarkID != "" {
+				a.extractions.track(action.DeviceToken, action.URL, bookmarkID, action.createOptions(), 0)
+			}
+		}
+		if err := a.queue.pop(); err != nil {
+			a.Logger.Errorf("Error saving action queue: %v", err)
+		}
+	}
+}
+
+// queueClient returns a Readeck client for deviceToken, reusing the ones
+// created during the current replay.
+func (a *App) queueClient(ctx context.Context, clients map[string]*readeck.Client, deviceToken string) (*readeck.Client, error) {
+	if client, ok := clients[deviceToken]; ok {
+		return client, nil
+	}
+	user, err := a.getUser(ctx, deviceToken)
+	if err != nil {
+		return nil, err
+	}
+	client, err := a.newReadeckClient(user)
+	if err != nil {
+		return nil, err
+	}
+	clients[deviceToken] = client
+	return client, nil
+}
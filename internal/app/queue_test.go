@@ -0,0 +1,89 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+)
+
+func TestHandleKoboSendQueuesWhenReadeckDown(t *testing.T) {
+	var down atomic.Bool
+	var patches atomic.Int32
+	down.Store(true)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		patches.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	queueFile := filepath.Join(t.TempDir(), "queue.json")
+	newApp := func() *App {
+		return NewApp(
+			WithConfig(&config.Config{
+				Users: []config.User{
+					{
+						Token:              mockDeviceToken,
+						ReadeckAccessToken: mockPlaintextReadeckToken,
+					},
+				},
+				Readeck:     config.ConfigReadeck{Host: mockServer.URL},
+				ActionQueue: config.ConfigActionQueue{File: queueFile},
+			}),
+			WithLogger(testLogger),
+			WithReadeckHTTPClient(mockServer.Client()),
+		)
+	}
+	send := func(app *App, actions ...any) map[string]any {
+		body, _ := json.Marshal(models.KoboSendRequest{AccessToken: mockDeviceToken, Actions: actions})
+		rr := httptest.NewRecorder()
+		app.HandleKoboSend(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+		var resp map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	app := newApp()
+	if resp := send(app, map[string]any{"action": "archive", "item_id": "1"}); resp["status"] != true {
+		t.Errorf("expected queued action to be acknowledged, got %v", resp)
+	}
+	if app.queue.Len() != 1 {
+		t.Fatalf("expected 1 queued action, got %d", app.queue.Len())
+	}
+
+	// Readeck is back, but new actions still wait behind the queued ones.
+	down.Store(false)
+	send(app, map[string]any{"action": "favorite", "item_id": "2"})
+	if app.queue.Len() != 2 || patches.Load() != 0 {
+		t.Fatalf("expected 2 queued actions and no updates, got %d and %d", app.queue.Len(), patches.Load())
+	}
+
+	// The queue survives a restart.
+	app = newApp()
+	if err := app.LoadActionQueue(); err != nil {
+		t.Fatalf("LoadActionQueue() error = %v", err)
+	}
+	if app.queue.Len() != 2 {
+		t.Fatalf("expected 2 queued actions after reload, got %d", app.queue.Len())
+	}
+
+	if !app.replayActionQueue(context.Background()) {
+		t.Error("expected the queue to be emptied")
+	}
+	if app.queue.Len() != 0 || patches.Load() != 2 {
+		t.Errorf("expected an empty queue and 2 updates, got %d and %d", app.queue.Len(), patches.Load())
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"readeckobo/internal/config"
+)
+
+// ReadinessCheck is the outcome of one live check of the configuration.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness checks that the Readeck host answers and that Readeck accepts
+// the token of every user. With ports, it also checks that the server and
+// admin ports are free, which only holds before readeckobo listens on them.
+func (a *App) Readiness(ctx context.Context, ports bool) []ReadinessCheck {
+	checks := []ReadinessCheck{a.checkReadeckHost(ctx)}
+	for _, user := range a.users() {
+		check := ReadinessCheck{Name: "readeck token of device " + maskToken(user.Token)}
+		if username, err := a.readeckUsername(ctx, &user); err != nil {
+			check.Detail = err.Error()
+		} else {
+			check.OK, check.Detail = true, "user "+username
+		}
+		checks = append(checks, check)
+	}
+	if ports {
+		checks = append(checks, a.checkPorts()...)
+	}
+	return checks
+}
+
+// readeckUsername returns the Readeck user whose token user has.
+func (a *App) readeckUsername(ctx context.Context, user *config.User) (string, error) {
+	client, err := a.newReadeckClient(user)
+	if err != nil {
+		return "", err
+	}
+	profile, err := client.GetProfile(ctx)
+	if err != nil {
+		return "", err
+	}
+	return profile.User.Username, nil
+}
+
+// checkReadeckHost checks that readeck.host answers HTTP requests, whatever
+// their status.
+func (a *App) checkReadeckHost(ctx context.Context) ReadinessCheck {
+	check := ReadinessCheck{Name: "readeck host " + a.Config.Readeck.Host}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.Config.Readeck.Host, nil)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	client := a.ReadeckHTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	_ = resp.Body.Close()
+	check.OK, check.Detail = true, resp.Status
+	return check
+}
+
+// checkPorts checks that the TCP ports readeckobo listens on are free;
+// Unix sockets and systemd sockets are not checked.
+func (a *App) checkPorts() []ReadinessCheck {
+	var addrs []string
+	for _, listener := range a.Config.Server.Listeners {
+		addrs = append(addrs, listener.Address)
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, a.Config.Server.Listen)
+		if addrs[0] == "" {
+			addrs[0] = fmt.Sprintf(":%d", a.Config.Server.Port)
+		}
+	}
+	if a.Config.Admin.Port > 0 {
+		addrs = append(addrs, net.JoinHostPort(a.Config.Admin.Address, strconv.Itoa(a.Config.Admin.Port)))
+	}
+
+	var checks []ReadinessCheck
+	for _, addr := range addrs {
+		if addr == "systemd" || strings.HasPrefix(addr, "unix:") {
+			continue
+		}
+		check := ReadinessCheck{Name: "listen address " + addr}
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			check.Detail = err.Error()
+		} else {
+			_ = listener.Close()
+			check.OK, check.Detail = true, "available"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// readinessResponse is the response of /admin/api/readiness.
+type readinessResponse struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// HandleAdminReadiness runs the live checks of the configuration. It answers
+// 503 Service Unavailable when one fails.
+func (a *App) HandleAdminReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := a.Readiness(r.Context(), false)
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(readinessResponse{Ready: ready, Checks: checks}); err != nil {
+		a.Logger.Errorf("Error encoding response for /admin/api/readiness: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
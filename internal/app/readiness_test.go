@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestReadiness(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/api/profile" && r.Header.Get("Authorization") == "Bearer "+mockPlaintextReadeckToken:
+			_, _ = w.Write([]byte(`{"user":{"username":"alice"}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer mockServer.Close()
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer func() { _ = busy.Close() }()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+			Users: []config.User{
+				{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken},
+				{Token: "other-device", ReadeckAccessToken: "revoked"},
+			},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+	app.Config.Server.Listen = busy.Addr().String()
+
+	checks := app.Readiness(context.Background(), true)
+	want := []bool{true, true, false, false}
+	if len(checks) != len(want) {
+		t.Fatalf("expected %d checks, got %+v", len(want), checks)
+	}
+	for i, check := range checks {
+		if check.OK != want[i] {
+			t.Errorf("expected check %q to be ok=%v, got %+v", check.Name, want[i], check)
+		}
+	}
+	if checks[1].Detail != "user alice" {
+		t.Errorf("expected the token's user, got %q", checks[1].Detail)
+	}
+
+	rr := httptest.NewRecorder()
+	app.HandleAdminReadiness(rr, httptest.NewRequest(http.MethodGet, "/admin/api/readiness", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", rr.Code)
+	}
+	var response struct {
+		Ready  bool             `json:"ready"`
+		Checks []ReadinessCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Ready || len(response.Checks) != 3 {
+		t.Errorf("expected 3 checks without the ports and not ready, got %+v", response)
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"readeckobo/internal/capture"
+	"readeckobo/internal/config"
+)
+
+// TestReplayCaptures replays the Kobo traffic recorded in testdata/captures
+// with capture.dir set, and checks the handlers still answer as recorded.
+func TestReplayCaptures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/captures/*.json")
+	if err != nil {
+		t.Fatalf("Failed to list captures: %v", err)
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			c, err := capture.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:   []config.User{{Token: capture.Token, ReadeckAccessToken: capture.Token}},
+					Readeck: config.ConfigReadeck{Host: c.ReadeckHost},
+				}),
+				WithLogger(testLogger),
+				WithReadeckHTTPClient(&http.Client{Transport: c.Transport()}),
+			)
+			handlers := map[string]http.HandlerFunc{
+				"kobo.get":      app.HandleKoboGet,
+				"kobo.download": app.HandleKoboDownload,
+				"kobo.send":     app.HandleKoboSend,
+			}
+			handler, ok := handlers[c.Route]
+			if !ok {
+				t.Fatalf("no handler for route %q", c.Route)
+			}
+
+			if err := c.Replay(handler); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
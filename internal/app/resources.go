@@ -0,0 +1,127 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/storeapi"
+)
+
+// resourceHeaders are copied between the Kobo and Readeck when proxying a
+// resource, so caching keeps working through the bridge.
+var resourceHeaders = []string{"Content-Type", "Content-Length", "Cache-Control", "ETag", "Last-Modified"}
+
+// resourceDevice identifies a device in resource URLs without revealing its
+// token.
+func resourceDevice(deviceToken string) string {
+	sum := sha256.Sum256([]byte("readeckobo-resource:" + deviceToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// resourceSignature proves a resource URL was issued to the device, so the
+// proxy cannot be used to fetch arbitrary files with its Readeck token.
+func resourceSignature(deviceToken, src string) string {
+	mac := hmac.New(sha256.New, []byte(deviceToken))
+	mac.Write([]byte(src))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// resourceURL points a Readeck-hosted file at /api/resource for the device,
+// leaving other URLs untouched.
+func (a *App) resourceURL(r *http.Request, deviceToken, src string) string {
+	if src == "" || !strings.HasPrefix(src, strings.TrimSuffix(a.Config.Readeck.Host, "/")+"/") {
+		return src
+	}
+	query := url.Values{"src": {src}, "device": {resourceDevice(deviceToken)}, "sig": {resourceSignature(deviceToken, src)}}
+	return a.bridgeURL(r) + storeapi.InstapaperPath + "/api/resource?" + query.Encode()
+}
+
+// proxyResources rewrites the Readeck-hosted thumbnails and icons of items,
+// which need the Readeck token, to go through /api/resource.
+func (a *App) proxyResources(r *http.Request, deviceToken string, items map[string]models.KoboArticleItem) {
+	for id, entry := range items {
+		if entry.Image != nil && entry.Image.Src != "" {
+			entry.Image = &models.KoboImage{Src: a.resourceURL(r, deviceToken, entry.Image.Src)}
+		}
+		for key, img := range entry.Images {
+			img.Src = a.resourceURL(r, deviceToken, img.Src)
+			entry.Images[key] = img
+		}
+		if src, ok := entry.Optional["top_image_url"].(string); ok {
+			entry.Optional["top_image_url"] = a.resourceURL(r, deviceToken, src)
+		}
+		if entry.Domain != nil && entry.Domain.Logo != "" {
+			domain := *entry.Domain
+			domain.Logo = a.resourceURL(r, deviceToken, domain.Logo)
+			entry.Domain = &domain
+		}
+		items[id] = entry
+	}
+}
+
+// HandleResource streams a Readeck-hosted thumbnail or icon to the Kobo,
+// authenticating to Readeck as the device that the URL was issued to.
+func (a *App) HandleResource(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	src, device, sig := query.Get("src"), query.Get("device"), query.Get("sig")
+
+	var user *config.User
+	users := a.users()
+	for i := range users {
+		if resourceDevice(users[i].Token) == device {
+			user = &users[i]
+			break
+		}
+	}
+	if user == nil || !hmac.Equal([]byte(sig), []byte(resourceSignature(user.Token, src))) {
+		writeKoboError(w, http.StatusForbidden, pocketErrAccessToken, "Invalid resource signature")
+		a.Logger.Warnf("Rejected resource request with an invalid signature in /api/resource, URL: %s", r.URL.Path)
+		return
+	}
+
+	readeckClient, err := a.newReadeckClient(user)
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
+		a.Logger.Errorf("Error initializing Readeck client for /api/resource: %v, URL: %s, Params: %v", err, r.URL.Path, src)
+		return
+	}
+
+	header := http.Header{}
+	for _, key := range []string{"If-None-Match", "If-Modified-Since"} {
+		if value := r.Header.Get(key); value != "" {
+			header.Set(key, value)
+		}
+	}
+	resp, err := readeckClient.OpenResource(r.Context(), src, header)
+	if errors.Is(err, readeck.ErrForeignResource) {
+		writeKoboError(w, http.StatusForbidden, pocketErrInvalidRequest, "Resource is not hosted by Readeck")
+		return
+	}
+	if err != nil {
+		writeKoboError(w, http.StatusBadGateway, pocketErrServer, "Failed to fetch resource")
+		a.Logger.Errorf("Error fetching resource in /api/resource: %v, URL: %s, Params: %v", err, r.URL.Path, src)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	for _, key := range resourceHeaders {
+		if value := resp.Header.Get(key); value != "" {
+			w.Header().Set(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		a.Logger.Warnf("Error streaming resource in /api/resource: %v, URL: %s, Params: %v", err, r.URL.Path, src)
+	}
+	a.countStats(user.Token, deviceStats{ImageBytesServed: uint64(n)})
+}
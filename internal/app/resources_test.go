@@ -0,0 +1,99 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+)
+
+func TestHandleResource(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+mockPlaintextReadeckToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/webp")
+		w.Header().Set("X-Internal", "secret")
+		_, _ = w.Write([]byte("thumbnail"))
+	}))
+	defer mockServer.Close()
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	thumbnail := mockServer.URL + "/bm/ab/abc/img/thumbnail.webp"
+	items := map[string]models.KoboArticleItem{
+		"1": {
+			Image:    &models.KoboImage{Src: thumbnail},
+			Images:   map[string]models.KoboImage{"1": {Src: thumbnail}},
+			Optional: map[string]any{"top_image_url": thumbnail},
+			Domain:   &models.KoboDomainMetadata{Name: "example", Logo: "https://example.com/favicon.ico"},
+		},
+	}
+	syncReq := httptest.NewRequest(http.MethodPost, "https://bridge.example.com/api/kobo/get", nil)
+	app.proxyResources(syncReq, mockDeviceToken, items)
+
+	proxied := items["1"].Optional["top_image_url"].(string)
+	if items["1"].Image.Src != proxied || items["1"].Images["1"].Src != proxied {
+		t.Errorf("expected every thumbnail to be rewritten to %q, got %+v", proxied, items["1"])
+	}
+	if items["1"].Domain.Logo != "https://example.com/favicon.ico" {
+		t.Errorf("expected the foreign logo to be kept, got %q", items["1"].Domain.Logo)
+	}
+	proxiedURL, err := url.Parse(proxied)
+	if err != nil || proxiedURL.Host != "bridge.example.com" {
+		t.Fatalf("expected a bridge URL, got %q", proxied)
+	}
+
+	foreign := "https://example.com/private.jpg"
+	tests := []struct {
+		name           string
+		query          url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "signed thumbnail", query: proxiedURL.Query(), expectedStatus: http.StatusOK, expectedBody: "thumbnail"},
+		{
+			name:           "tampered source",
+			query:          url.Values{"src": {mockServer.URL + "/other"}, "device": {resourceDevice(mockDeviceToken)}, "sig": {proxiedURL.Query().Get("sig")}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "foreign host",
+			query:          url.Values{"src": {foreign}, "device": {resourceDevice(mockDeviceToken)}, "sig": {resourceSignature(mockDeviceToken, foreign)}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/resource?"+tt.query.Encode(), nil)
+			rr := httptest.NewRecorder()
+			app.HandleResource(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedBody == "" {
+				return
+			}
+			body, _ := io.ReadAll(rr.Body)
+			if string(body) != tt.expectedBody || rr.Header().Get("Content-Type") != "image/webp" {
+				t.Errorf("unexpected response %q with content type %q", body, rr.Header().Get("Content-Type"))
+			}
+			if rr.Header().Get("X-Internal") != "" {
+				t.Error("expected Readeck-only headers not to be forwarded")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// maxSaveBody bounds the body read by /api/save.
+const maxSaveBody = 1 << 20
+
+// Defaults used when the corresponding download setting is unset.
+const (
+	defaultExtractionTimeout = 20 * time.Second
+	defaultPollInterval      = time.Second
+)
+
+// sharedURLPattern finds the URL in text shared from a phone, which often
+// comes with the page title around it.
+var sharedURLPattern = regexp.MustCompile(`https?://\S+`)
+
+// HandleSave creates a Readeck bookmark from a URL shared to the bridge, for
+// "share to e-reader" shortcuts and webhooks. The device token is taken from
+// the token query parameter or a bearer Authorization header, and the URL
+// from the url parameter or a JSON, form or plain text body.
+func (a *App) HandleSave(w http.ResponseWriter, r *http.Request) {
+	params := a.Logger.Redact([]byte(r.URL.RawQuery))
+
+	user, err := a.getUser(r.Context(), requestDeviceToken(r))
+	if err != nil {
+		writeKoboError(w, http.StatusUnauthorized, pocketErrAccessToken, "Invalid access token")
+		a.Logger.Errorf("Error authenticating token for /api/save: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+		return
+	}
+
+	req := models.SaveRequest{URL: r.URL.Query().Get("url"), Title: r.URL.Query().Get("title")}
+	if req.URL == "" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSaveBody)
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "application/json":
+			err = json.NewDecoder(r.Body).Decode(&req)
+		case "application/x-www-form-urlencoded", "multipart/form-data":
+			if err = r.ParseMultipartForm(maxSaveBody); errors.Is(err, http.ErrNotMultipart) {
+				err = nil
+			}
+			req.URL = r.FormValue("url")
+			req.Title = r.FormValue("title")
+			if req.URL == "" {
+				req.URL = sharedURLPattern.FindString(r.FormValue("text"))
+			}
+		default:
+			var body []byte
+			body, err = io.ReadAll(r.Body)
+			req.URL = sharedURLPattern.FindString(string(body))
+		}
+		if err != nil {
+			writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Invalid request body")
+			a.Logger.Errorf("Error decoding /api/save request: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+			return
+		}
+	}
+	if req.URL == "" {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'url' parameter")
+		return
+	}
+
+	create := addOptions(user, readeck.CreateBookmarkOptions{Title: req.Title, Labels: a.saveLabels()})
+
+	var id string
+	if a.Config.DryRun {
+		a.Logger.Infof("Dry run: would create bookmark for %s with labels %v in /api/save", req.URL, create.Labels)
+	} else {
+		readeckClient, err := a.newReadeckClient(user)
+		if err != nil {
+			writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to initialize Readeck client")
+			a.Logger.Errorf("Error initializing Readeck client for /api/save: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+			return
+		}
+		id, err = readeckClient.CreateBookmark(r.Context(), req.URL, create)
+		if err != nil {
+			writeReadeckError(w, "Failed to save URL", err)
+			a.Logger.Errorf("Error creating bookmark for %s in /api/save: %v, URL: %s, Params: %s", req.URL, err, r.URL.Path, params)
+			return
+		}
+		a.invalidateSyncResponses(user.Token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(models.SaveResponse{ID: id, URL: req.URL}); err != nil {
+		a.Logger.Errorf("Error encoding response for /api/save: %v, URL: %s, Params: %s", err, r.URL.Path, params)
+	}
+}
+
+// requestDeviceToken reads the device token of a request from the token
+// query parameter or a bearer Authorization header.
+func requestDeviceToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// saveLabels are the labels added to bookmarks saved from a device.
+func (a *App) saveLabels() []string {
+	if a.Config.Save.Label == "" {
+		return nil
+	}
+	return []string{a.Config.Save.Label}
+}
+
+// saveAndExtract saves rawURL to Readeck and waits for Readeck to extract its
+// article, for downloads of URLs saved on the device moments earlier.
+func (a *App) saveAndExtract(ctx context.Context, client *readeck.Client, rawURL string) (*readeck.Bookmark, error) {
+	id, err := client.CreateBookmark(ctx, rawURL, readeck.CreateBookmarkOptions{Labels: a.saveLabels()})
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, errors.New("readeck did not report the ID of the new bookmark")
+	}
+
+	cfg := a.Config.Download
+	timeout, interval := cfg.ExtractionTimeout, cfg.PollInterval
+	if timeout <= 0 {
+		timeout = defaultExtractionTimeout
+	}
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		bookmark, err := client.GetBookmarkDetails(ctx, id)
+		switch {
+		case err != nil && ctx.Err() == nil && !readeck.IsNotFound(err):
+			return nil, err
+		case err != nil:
+			// Readeck may not list the bookmark until it starts extracting.
+		case bookmark.State == readeck.StateError:
+			return nil, fmt.Errorf("readeck failed to extract bookmark %s", id)
+		case bookmark.State != readeck.StateLoading:
+			return bookmark, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("bookmark %s is still being extracted after %s", id, timeout)
+		case <-ticker.C:
+		}
+	}
+}
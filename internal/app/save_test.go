@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestHandleSave(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		authorization  string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedURL    string
+	}{
+		{
+			name:           "token and url in query",
+			target:         "/api/save?token=" + mockDeviceToken + "&url=" + url.QueryEscape("http://example.com/a"),
+			expectedStatus: http.StatusCreated,
+			expectedURL:    "http://example.com/a",
+		},
+		{
+			name:           "bearer token and JSON body",
+			target:         "/api/save",
+			authorization:  "Bearer " + mockDeviceToken,
+			contentType:    "application/json",
+			body:           `{"url":"http://example.com/b","title":"B"}`,
+			expectedStatus: http.StatusCreated,
+			expectedURL:    "http://example.com/b",
+		},
+		{
+			name:           "shared text body",
+			target:         "/api/save?token=" + mockDeviceToken,
+			contentType:    "text/plain",
+			body:           "A great read https://example.com/c via my phone",
+			expectedStatus: http.StatusCreated,
+			expectedURL:    "https://example.com/c",
+		},
+		{
+			name:           "shared form text",
+			target:         "/api/save?token=" + mockDeviceToken,
+			contentType:    "application/x-www-form-urlencoded",
+			body:           url.Values{"text": {"Look https://example.com/d"}}.Encode(),
+			expectedStatus: http.StatusCreated,
+			expectedURL:    "https://example.com/d",
+		},
+		{
+			name:           "invalid token",
+			target:         "/api/save?token=invalid&url=http://example.com/a",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing url",
+			target:         "/api/save?token=" + mockDeviceToken,
+			contentType:    "text/plain",
+			body:           "no link here",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created map[string]any
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+					t.Errorf("Failed to decode request body: %v", err)
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer mockServer.Close()
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck: config.ConfigReadeck{Host: mockServer.URL},
+					Save:    config.ConfigSave{Label: "kobo"},
+				}),
+				WithLogger(testLogger),
+				WithReadeckHTTPClient(mockServer.Client()),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			app.HandleSave(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedURL == "" {
+				return
+			}
+			if created["url"] != tt.expectedURL {
+				t.Errorf("expected bookmark for %q, got %v", tt.expectedURL, created["url"])
+			}
+			if labels, _ := json.Marshal(created["labels"]); string(labels) != `["kobo"]` {
+				t.Errorf("expected labels [\"kobo\"], got %s", labels)
+			}
+		})
+	}
+}
+
+func TestHandleKoboDownloadSaveMissing(t *testing.T) {
+	tests := []struct {
+		name           string
+		saveMissing    bool
+		state          int
+		expectedStatus int
+		expectCreated  bool
+	}{
+		{name: "disabled", expectedStatus: http.StatusNotFound},
+		{name: "extracted", saveMissing: true, state: readeck.StateLoaded, expectedStatus: http.StatusOK, expectCreated: true},
+		{name: "extracted after polling", saveMissing: true, state: readeck.StateLoading, expectedStatus: http.StatusOK, expectCreated: true},
+		{name: "extraction failed", saveMissing: true, state: readeck.StateError, expectedStatus: http.StatusNotFound, expectCreated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := readecktest.NewServer()
+			defer mockServer.Close()
+			mockServer.Extract = func(bookmark *readeck.Bookmark) string {
+				bookmark.State = tt.state
+				if tt.state == readeck.StateLoading {
+					go func(b readeck.Bookmark) {
+						time.Sleep(20 * time.Millisecond)
+						b.State = readeck.StateLoaded
+						mockServer.AddBookmark(b, "<p>Saved moments ago</p>")
+					}(*bookmark)
+					return ""
+				}
+				return "<p>Saved moments ago</p>"
+			}
+
+			app := NewApp(
+				WithConfig(&config.Config{
+					Users:    []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+					Readeck:  config.ConfigReadeck{Host: mockServer.URL},
+					Save:     config.ConfigSave{Label: "kobo"},
+					Download: config.ConfigDownload{SaveMissing: tt.saveMissing, ExtractionTimeout: time.Second, PollInterval: 5 * time.Millisecond},
+				}),
+				WithLogger(testLogger),
+			)
+
+			form := url.Values{"access_token": {mockDeviceToken}, "url": {"https://example.com/new"}}
+			req := httptest.NewRequest(http.MethodPost, "/api/kobo/download", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+
+			app.HandleKoboDownload(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && !strings.Contains(rr.Body.String(), "Saved moments ago") {
+				t.Errorf("expected the saved article, got %s", rr.Body.String())
+			}
+			created := mockServer.Created()
+			if tt.expectCreated != (len(created) == 1) {
+				t.Fatalf("expected created = %v, got %v", tt.expectCreated, created)
+			}
+			if tt.expectCreated {
+				bookmark, _ := mockServer.Bookmark("created-1")
+				if len(bookmark.Labels) != 1 || bookmark.Labels[0] != "kobo" {
+					t.Errorf("expected the save label, got %v", bookmark.Labels)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveAndExtractTimeout(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.Extract = func(bookmark *readeck.Bookmark) string {
+		bookmark.State = readeck.StateLoading
+		return ""
+	}
+
+	app := NewApp(
+		WithConfig(&config.Config{Download: config.ConfigDownload{ExtractionTimeout: 30 * time.Millisecond, PollInterval: 5 * time.Millisecond}}),
+		WithLogger(testLogger),
+	)
+	client, _ := readeck.NewClient(mockServer.URL, "test-token", testLogger, mockServer.Client())
+
+	_, err := app.saveAndExtract(context.Background(), client, "https://example.com/slow")
+	if err == nil || !strings.Contains(err.Error(), "still being extracted") {
+		t.Errorf("expected an extraction timeout, got %v", err)
+	}
+}
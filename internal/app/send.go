@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+)
+
+// defaultSendConcurrency is used when readeck.send_concurrency is unset.
+const defaultSendConcurrency = 4
+
+// sendOp is a single Readeck change that one or more Kobo actions collapse
+// into: a bookmark update, or the creation of a bookmark for url.
+type sendOp struct {
+	itemID string
+	update map[string]any
+	url    string
+	create readeck.CreateBookmarkOptions
+	// bookmarkID is the bookmark created for url.
+	bookmarkID string
+	err        error
+}
+
+// planSendActions collapses the actions of a /api/kobo/send request into one
+// change per bookmark and one creation per URL. Later actions on an item win
+// over earlier ones, except that a delete discards every other change.
+// opOf maps each action to the index of its op, or -1 if it needs none, and
+// errs holds the error of each action that could not be understood.
+func planSendActions(actions []any) (ops []*sendOp, opOf []int, errs []error) {
+	opOf = make([]int, len(actions))
+	errs = make([]error, len(actions))
+	byKey := make(map[string]int)
+
+	opFor := func(key string, op *sendOp) int {
+		if i, ok := byKey[key]; ok {
+			return i
+		}
+		ops = append(ops, op)
+		byKey[key] = len(ops) - 1
+		return len(ops) - 1
+	}
+
+	for i, actionInterface := range actions {
+		opOf[i] = -1
+		actionMap, ok := actionInterface.(map[string]any)
+		if !ok {
+			errs[i] = fmt.Errorf("invalid action: %v", actionInterface)
+			continue
+		}
+
+		action, _ := actionMap["action"].(string)
+		itemID, _ := actionMap["item_id"].(string)
+		var field string
+		var value bool
+
+		switch action {
+		case "archive":
+			field, value = "is_archived", true
+		case "readd":
+			field, value = "is_archived", false
+		case "favorite":
+			field, value = "is_marked", true
+		case "unfavorite":
+			field, value = "is_marked", false
+		case "delete":
+			field, value = "is_deleted", true
+		case "add":
+			url, _ := actionMap["url"].(string)
+			title, _ := actionMap["title"].(string)
+			tags, _ := actionMap["tags"].(string)
+			opOf[i] = opFor("url:"+url, &sendOp{url: url, create: readeck.CreateBookmarkOptions{Title: title, Labels: splitTags(tags)}})
+			continue
+		case "opened_item", "left_item":
+			continue
+		default:
+			errs[i] = fmt.Errorf("unknown action: %s", action)
+			continue
+		}
+
+		opOf[i] = opFor("item:"+itemID, &sendOp{itemID: itemID, update: map[string]any{}})
+		op := ops[opOf[i]]
+		switch {
+		case op.update["is_deleted"] == true:
+		case field == "is_deleted":
+			op.update = map[string]any{field: value}
+		default:
+			op.update[field] = value
+		}
+	}
+
+	return ops, opOf, errs
+}
+
+// deleteUpdate returns the bookmark update that deletes an item for user,
+// following their delete_action.
+func deleteUpdate(user *config.User) map[string]any {
+	switch action := user.DeleteAction; {
+	case action == "archive":
+		return map[string]any{"is_archived": true}
+	case strings.HasPrefix(action, "label:"):
+		return map[string]any{"is_archived": true, "add_labels": []string{strings.TrimPrefix(action, "label:")}}
+	default:
+		return map[string]any{"is_deleted": true}
+	}
+}
+
+// archiveFinished archives the bookmarks of ops whose read_progress reaches
+// the user's archive_on_finish, unless the same request already sets their
+// archive state.
+func archiveFinished(user *config.User, ops []*sendOp) {
+	if user.ArchiveOnFinish <= 0 {
+		return
+	}
+	for _, op := range ops {
+		progress, ok := op.update["read_progress"].(int)
+		if !ok || progress < user.ArchiveOnFinish {
+			continue
+		}
+		if _, set := op.update["is_archived"]; set || op.update["is_deleted"] == true {
+			continue
+		}
+		op.update["is_archived"] = true
+	}
+}
+
+// splitTags splits the comma-separated tags of an added item.
+func splitTags(tags string) []string {
+	var labels []string
+	for tag := range strings.SplitSeq(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			labels = append(labels, tag)
+		}
+	}
+	return labels
+}
+
+// addOptions applies the user's add_labels and add_archived to a bookmark
+// created for a URL added from their device.
+func addOptions(user *config.User, opts readeck.CreateBookmarkOptions) readeck.CreateBookmarkOptions {
+	opts.Labels = slices.Clone(opts.Labels)
+	for _, label := range user.AddLabels {
+		if !slices.Contains(opts.Labels, label) {
+			opts.Labels = append(opts.Labels, label)
+		}
+	}
+	opts.Archived = opts.Archived || user.AddArchived
+	return opts
+}
+
+// runSendOps applies ops to Readeck with at most readeck.send_concurrency
+// requests in flight, recording the outcome in each op. In a dry run the
+// changes are only logged.
+func (a *App) runSendOps(ctx context.Context, readeckClient *readeck.Client, ops []*sendOp, dryRun bool) {
+	concurrency := a.Config.Readeck.SendConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultSendConcurrency
+	}
+
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for _, op := range ops {
+		switch {
+		case dryRun && op.update != nil:
+			a.Logger.Infof("Dry run: would update bookmark %s with %v in /api/kobo/send", op.itemID, op.update)
+		case dryRun:
+			a.Logger.Infof("Dry run: would create bookmark for %s with labels %v in /api/kobo/send", op.url, op.create.Labels)
+		case op.update != nil:
+			g.Go(func() error {
+				op.err = readeckClient.UpdateBookmark(ctx, op.itemID, op.update)
+				return nil
+			})
+		default:
+			g.Go(func() error {
+				op.bookmarkID, op.err = readeckClient.CreateBookmark(ctx, op.url, op.create)
+				return nil
+			})
+		}
+	}
+	_ = g.Wait()
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+)
+
+func TestPlanSendActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		actions  []any
+		wantOps  []sendOp
+		wantOpOf []int
+		wantErrs []bool
+	}{
+		{
+			name: "repeated archive and opened items collapse",
+			actions: []any{
+				map[string]any{"action": "opened_item", "item_id": "1"},
+				map[string]any{"action": "archive", "item_id": "1"},
+				map[string]any{"action": "opened_item", "item_id": "1"},
+				map[string]any{"action": "archive", "item_id": "1"},
+			},
+			wantOps:  []sendOp{{itemID: "1", update: map[string]any{"is_archived": true}}},
+			wantOpOf: []int{-1, 0, -1, 0},
+			wantErrs: []bool{false, false, false, false},
+		},
+		{
+			name: "last conflicting action wins and fields merge",
+			actions: []any{
+				map[string]any{"action": "archive", "item_id": "1"},
+				map[string]any{"action": "favorite", "item_id": "1"},
+				map[string]any{"action": "readd", "item_id": "1"},
+				map[string]any{"action": "favorite", "item_id": "2"},
+			},
+			wantOps: []sendOp{
+				{itemID: "1", update: map[string]any{"is_archived": false, "is_marked": true}},
+				{itemID: "2", update: map[string]any{"is_marked": true}},
+			},
+			wantOpOf: []int{0, 0, 0, 1},
+			wantErrs: []bool{false, false, false, false},
+		},
+		{
+			name: "delete discards other changes",
+			actions: []any{
+				map[string]any{"action": "favorite", "item_id": "1"},
+				map[string]any{"action": "delete", "item_id": "1"},
+				map[string]any{"action": "readd", "item_id": "1"},
+			},
+			wantOps:  []sendOp{{itemID: "1", update: map[string]any{"is_deleted": true}}},
+			wantOpOf: []int{0, 0, 0},
+			wantErrs: []bool{false, false, false},
+		},
+		{
+			name: "duplicate adds and invalid actions",
+			actions: []any{
+				map[string]any{"action": "add", "url": "http://example.com/a"},
+				"not an action",
+				map[string]any{"action": "add", "url": "http://example.com/a"},
+				map[string]any{"action": "bogus", "item_id": "1"},
+			},
+			wantOps:  []sendOp{{url: "http://example.com/a"}},
+			wantOpOf: []int{0, -1, 0, -1},
+			wantErrs: []bool{false, true, false, true},
+		},
+		{
+			name: "add keeps title and tags",
+			actions: []any{
+				map[string]any{"action": "add", "url": "http://example.com/a", "title": "A", "tags": "news, long read,"},
+			},
+			wantOps:  []sendOp{{url: "http://example.com/a", create: readeck.CreateBookmarkOptions{Title: "A", Labels: []string{"news", "long read"}}}},
+			wantOpOf: []int{0},
+			wantErrs: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, opOf, errs := planSendActions(tt.actions)
+
+			if len(ops) != len(tt.wantOps) {
+				t.Fatalf("expected %d ops, got %d", len(tt.wantOps), len(ops))
+			}
+			for i, op := range ops {
+				if !reflect.DeepEqual(*op, tt.wantOps[i]) {
+					t.Errorf("op %d: expected %+v, got %+v", i, tt.wantOps[i], *op)
+				}
+			}
+			if !reflect.DeepEqual(opOf, tt.wantOpOf) {
+				t.Errorf("expected opOf %v, got %v", tt.wantOpOf, opOf)
+			}
+			for i, err := range errs {
+				if (err != nil) != tt.wantErrs[i] {
+					t.Errorf("action %d: expected error %v, got %v", i, tt.wantErrs[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestAddOptions(t *testing.T) {
+	user := &config.User{AddLabels: []string{"from-kobo", "news"}, AddArchived: true}
+	got := addOptions(user, readeck.CreateBookmarkOptions{Title: "A", Labels: []string{"news"}})
+	want := readeck.CreateBookmarkOptions{Title: "A", Labels: []string{"news", "from-kobo"}, Archived: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	got = addOptions(&config.User{}, readeck.CreateBookmarkOptions{Title: "A"})
+	if !reflect.DeepEqual(got, readeck.CreateBookmarkOptions{Title: "A"}) {
+		t.Errorf("expected options unchanged, got %+v", got)
+	}
+}
+
+func TestDeleteUpdate(t *testing.T) {
+	tests := []struct {
+		action string
+		want   map[string]any
+	}{
+		{"", map[string]any{"is_deleted": true}},
+		{"delete", map[string]any{"is_deleted": true}},
+		{"archive", map[string]any{"is_archived": true}},
+		{"label:trash", map[string]any{"is_archived": true, "add_labels": []string{"trash"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			got := deleteUpdate(&config.User{DeleteAction: tt.action})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestArchiveFinished(t *testing.T) {
+	ops := []*sendOp{
+		{itemID: "1", update: map[string]any{"read_progress": 95}},
+		{itemID: "2", update: map[string]any{"read_progress": 50}},
+		{itemID: "3", update: map[string]any{"read_progress": 100, "is_archived": false}},
+		{itemID: "4", update: map[string]any{"is_marked": true}},
+		{url: "https://example.com/new"},
+	}
+	archiveFinished(&config.User{ArchiveOnFinish: 90}, ops)
+
+	want := []map[string]any{
+		{"read_progress": 95, "is_archived": true},
+		{"read_progress": 50},
+		{"read_progress": 100, "is_archived": false},
+		{"is_marked": true},
+		nil,
+	}
+	for i, op := range ops {
+		if !reflect.DeepEqual(op.update, want[i]) {
+			t.Errorf("expected update %v for op %d, got %v", want[i], i, op.update)
+		}
+	}
+
+	ops = []*sendOp{{itemID: "1", update: map[string]any{"read_progress": 100}}}
+	archiveFinished(&config.User{}, ops)
+	if _, ok := ops[0].update["is_archived"]; ok {
+		t.Errorf("expected no archive without archive_on_finish, got %v", ops[0].update)
+	}
+}
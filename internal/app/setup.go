@@ -0,0 +1,186 @@
+package app
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/storeapi"
+)
+
+// koboTokenSalt is prepended to the serial number to derive the key the Kobo
+// uses to encrypt its Instapaper access token.
+const koboTokenSalt = "88b3a2e13"
+
+type setupData struct {
+	Error       string
+	DeviceToken string
+	Serial      string
+	Username    string
+	BridgeURL   string
+	KoboConfig  string
+	QRCode      template.URL
+}
+
+// HandleSetup shows the form to set up a new Kobo.
+func (a *App) HandleSetup(w http.ResponseWriter, r *http.Request) {
+	a.renderSetup(w, r, setupData{BridgeURL: a.bridgeURL(r)})
+}
+
+// HandleSetupSubmit creates a device token for a Kobo, obtains a Readeck
+// token for it, saves the new user and shows the Kobo configuration.
+func (a *App) HandleSetupSubmit(w http.ResponseWriter, r *http.Request) {
+	data := setupData{
+		Serial:    strings.TrimSpace(r.FormValue("serial")),
+		Username:  strings.TrimSpace(r.FormValue("username")),
+		BridgeURL: strings.TrimSuffix(strings.TrimSpace(r.FormValue("bridge_url")), "/"),
+	}
+	password := r.FormValue("password")
+	readeckToken := strings.TrimSpace(r.FormValue("readeck_token"))
+
+	if data.Serial == "" || data.BridgeURL == "" || (readeckToken == "" && (data.Username == "" || password == "")) {
+		data.Error = "Serial number, bridge URL and either Readeck credentials or a Readeck token are required."
+		a.renderSetup(w, r, data)
+		return
+	}
+
+	if _, err := parseBridgeURL(data.BridgeURL); err != nil {
+		data.Error = "The bridge URL must be an http or https URL without a query or fragment."
+		a.renderSetup(w, r, data)
+		return
+	}
+
+	if readeckToken == "" {
+		client, err := readeck.NewClient(a.Config.Readeck.Host, "", a.Logger, a.ReadeckHTTPClient)
+		var login *readeck.AuthToken
+		if err == nil {
+			login, err = client.Login(r.Context(), data.Username, password, tokenApplication)
+		}
+		if err != nil {
+			a.Logger.Errorf("Error logging in to Readeck in /setup: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+			data.Error = "Readeck login failed: " + err.Error()
+			a.renderSetup(w, r, data)
+			return
+		}
+		readeckToken = login.Token
+	}
+
+	paired, err := a.pairDevice(r, data.Serial, data.BridgeURL, readeckToken)
+	if err != nil {
+		data.Error = "Setup failed: " + err.Error()
+		a.renderSetup(w, r, data)
+		return
+	}
+	data.DeviceToken = paired.DeviceToken
+	data.KoboConfig = paired.KoboConfig
+	data.QRCode = paired.QRCode
+	a.renderSetup(w, r, data)
+}
+
+// pairedDevice is a Kobo added as a new user, with the settings pointing it
+// at readeckobo.
+type pairedDevice struct {
+	DeviceToken string
+	KoboConfig  string
+	QRCode      template.URL
+}
+
+// pairDevice creates a device token for the Kobo with serial, saves it as a
+// new user of readeckToken and returns the Kobo's settings.
+func (a *App) pairDevice(r *http.Request, serial, bridgeURL, readeckToken string) (*pairedDevice, error) {
+	deviceToken, err := newDeviceToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate a device token: %w", err)
+	}
+	encrypted, err := encryptDeviceToken(deviceToken, serial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt the device token: %w", err)
+	}
+
+	if a.configPath != "" {
+		if err := config.SaveReadeckAccessToken(a.configPath, deviceToken, readeckToken); err != nil {
+			a.Logger.Errorf("Error saving new user in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+			return nil, fmt.Errorf("failed to save the new device: %w", err)
+		}
+	}
+	a.addUser(config.User{Token: deviceToken, ReadeckAccessToken: readeckToken})
+	a.Logger.Infof("Set up new device %s.", maskToken(deviceToken))
+
+	paired := &pairedDevice{DeviceToken: deviceToken, KoboConfig: koboConfig(bridgeURL, encrypted)}
+	png, err := qrcode.Encode(paired.KoboConfig, qrcode.Medium, 320)
+	if err != nil {
+		a.Logger.Warnf("Error generating QR code in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+	} else {
+		paired.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+	return paired, nil
+}
+
+func (a *App) renderSetup(w http.ResponseWriter, r *http.Request, data setupData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "setup.html", data); err != nil {
+		a.Logger.Errorf("Error rendering setup page in %s: %v, URL: %s, Params: %v", r.URL.Path, err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// bridgeURL suggests the public URL of readeckobo for the Kobo configuration.
+func (a *App) bridgeURL(r *http.Request) string {
+	return storeapi.BaseURL(a.Config.KoboStore.BridgeURL, a.Config.Server.PathPrefix, r)
+}
+
+// koboConfig returns the "Kobo eReader.conf" settings pointing a Kobo at
+// readeckobo with the encrypted device token.
+func koboConfig(bridgeURL, encryptedToken string) string {
+	return fmt.Sprintf(`[OneStoreServices]
+api_endpoint=%[1]s/instapaper-proxy/storeapi
+instapaper_env_url=%[1]s/instapaper-proxy/instapaper
+
+[Instapaper]
+AccessToken=@ByteArray(%[2]s)
+`, bridgeURL, encryptedToken)
+}
+
+// newDeviceToken returns a random UUID.
+func newDeviceToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// encryptDeviceToken encrypts token the way the Kobo stores its Instapaper
+// access token: AES-128-ECB with PKCS#7 padding, keyed by the first 16 hex
+// digits of the salted serial number's SHA-256.
+func encryptDeviceToken(token, serial string) (string, error) {
+	sum := sha256.Sum256([]byte(koboTokenSalt + serial))
+	key := []byte(hex.EncodeToString(sum[:])[:16])
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(token)%aes.BlockSize
+	plain := append([]byte(token), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	for i := 0; i < len(plain); i += aes.BlockSize {
+		block.Encrypt(encrypted[i:i+aes.BlockSize], plain[i:i+aes.BlockSize])
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// statsSaveInterval bounds how often the statistics file is rewritten; the
+// counts of the last interval are lost if readeckobo stops in between.
+const statsSaveInterval = time.Minute
+
+// deviceStats are the reading statistics of one device.
+type deviceStats struct {
+	ItemsSynced        uint64 `json:"items_synced"`
+	ArticlesDownloaded uint64 `json:"articles_downloaded"`
+	ActionsSent        uint64 `json:"actions_sent"`
+	ImageBytesServed   uint64 `json:"image_bytes_served"`
+}
+
+func (s *deviceStats) add(other deviceStats) {
+	s.ItemsSynced += other.ItemsSynced
+	s.ArticlesDownloaded += other.ArticlesDownloaded
+	s.ActionsSent += other.ActionsSent
+	s.ImageBytesServed += other.ImageBytesServed
+}
+
+// statsStore counts what each device synced, downloaded and sent, mirrored
+// to a JSON file when one is configured. Images converted for articles are
+// not tied to a device and count under the empty token.
+type statsStore struct {
+	mu      sync.Mutex
+	path    string
+	devices map[string]*deviceStats
+	saved   time.Time
+}
+
+func newStatsStore(path string) *statsStore {
+	return &statsStore{path: path, devices: make(map[string]*deviceStats)}
+}
+
+// load reads the statistics file written by a previous run.
+func (s *statsStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read statistics: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.Unmarshal(data, &s.devices); err != nil {
+		return fmt.Errorf("failed to parse statistics %s: %w", s.path, err)
+	}
+	if s.devices == nil {
+		s.devices = make(map[string]*deviceStats)
+	}
+	return nil
+}
+
+// save writes the statistics file; s.mu must be held.
+func (s *statsStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.devices)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+	s.saved = time.Now()
+	return nil
+}
+
+// add counts delta for deviceToken, saving the file at most every
+// statsSaveInterval.
+func (s *statsStore) add(deviceToken string, delta deviceStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.devices[deviceToken]
+	if !ok {
+		stats = &deviceStats{}
+		s.devices[deviceToken] = stats
+	}
+	stats.add(delta)
+	if time.Since(s.saved) < statsSaveInterval {
+		return nil
+	}
+	return s.save()
+}
+
+// get returns the statistics of deviceToken.
+func (s *statsStore) get(deviceToken string) deviceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stats, ok := s.devices[deviceToken]; ok {
+		return *stats
+	}
+	return deviceStats{}
+}
+
+// total sums the statistics of every device.
+func (s *statsStore) total() deviceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total deviceStats
+	for _, stats := range s.devices {
+		total.add(*stats)
+	}
+	return total
+}
+
+// LoadStats restores the statistics counted before readeckobo last stopped.
+func (a *App) LoadStats() error {
+	return a.stats.load()
+}
+
+// countStats adds delta to the statistics of deviceToken.
+func (a *App) countStats(deviceToken string, delta deviceStats) {
+	if err := a.stats.add(deviceToken, delta); err != nil {
+		a.Logger.Warnf("Error saving statistics: %v", err)
+	}
+}
+
+// deviceStatsEntry is the statistics of one device in /admin/api/stats.
+type deviceStatsEntry struct {
+	Device string `json:"device"`
+	deviceStats
+}
+
+// adminStatsResponse is the response of /admin/api/stats.
+type adminStatsResponse struct {
+	Devices []deviceStatsEntry `json:"devices"`
+	Total   deviceStats        `json:"total"`
+}
+
+// HandleAdminStats reports the statistics of each configured device and
+// their total, which includes the images converted for articles.
+func (a *App) HandleAdminStats(w http.ResponseWriter, r *http.Request) {
+	devices := []deviceStatsEntry{}
+	for _, user := range a.users() {
+		devices = append(devices, deviceStatsEntry{Device: maskToken(user.Token), deviceStats: a.stats.get(user.Token)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(adminStatsResponse{Devices: devices, Total: a.stats.total()}); err != nil {
+		a.Logger.Errorf("Error encoding response for /admin/api/stats: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// formatBytes shows a byte count in the largest unit it reaches.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestStatsStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	stats := newStatsStore(path)
+	if err := stats.add("device", deviceStats{ItemsSynced: 3, ActionsSent: 1}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := stats.add("", deviceStats{ImageBytesServed: 2048}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	stats.mu.Lock()
+	if err := stats.save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	stats.mu.Unlock()
+
+	reloaded := newStatsStore(path)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := reloaded.get("device"); got != (deviceStats{ItemsSynced: 3, ActionsSent: 1}) {
+		t.Errorf("expected the device's statistics to be restored, got %+v", got)
+	}
+	if got := reloaded.total(); got != (deviceStats{ItemsSynced: 3, ActionsSent: 1, ImageBytesServed: 2048}) {
+		t.Errorf("expected the total to include converted images, got %+v", got)
+	}
+}
+
+func TestHandleAdminStats(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+	)
+
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+	app.HandleKoboGet(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+	body, _ = json.Marshal(models.KoboSendRequest{
+		AccessToken: mockDeviceToken,
+		Actions: []any{
+			map[string]any{"action": "archive", "item_id": "1"},
+			map[string]any{"action": "bogus", "item_id": "1"},
+		},
+	})
+	app.HandleKoboSend(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+
+	rr := httptest.NewRecorder()
+	app.HandleAdminStats(rr, httptest.NewRequest(http.MethodGet, "/admin/api/stats", nil))
+	var resp struct {
+		Devices []deviceStatsEntry `json:"devices"`
+		Total   deviceStats        `json:"total"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := deviceStats{ItemsSynced: 1, ActionsSent: 1}
+	if len(resp.Devices) != 1 || resp.Devices[0].deviceStats != want || resp.Devices[0].Device == mockDeviceToken {
+		t.Errorf("expected masked device statistics %+v, got %+v", want, resp.Devices)
+	}
+	if resp.Total != want {
+		t.Errorf("expected total %+v, got %+v", want, resp.Total)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncCache keeps /api/kobo/get responses for a short TTL, keyed by device
+// token and a hash of the request, so that a device repeating a request
+// moments later is not synced against Readeck again. Each UserContext has
+// its own.
+type syncCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]cachedSync
+}
+
+type cachedSync struct {
+	body    []byte
+	expires time.Time
+}
+
+func newSyncCache(ttl time.Duration) *syncCache {
+	return &syncCache{ttl: ttl, items: make(map[string]cachedSync)}
+}
+
+// syncCacheKey identifies the request body of deviceToken.
+func syncCacheKey(deviceToken string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return deviceToken + "\x00" + hex.EncodeToString(sum[:])
+}
+
+func (c *syncCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.expires) {
+		return nil, false
+	}
+	return item.body, true
+}
+
+func (c *syncCache) put(key string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, item := range c.items {
+		if now.After(item.expires) {
+			delete(c.items, k)
+		}
+	}
+	c.items[key] = cachedSync{body: body, expires: now.Add(c.ttl)}
+}
+
+// invalidateDevice drops the responses of deviceToken, whose bookmarks have
+// just changed.
+func (c *syncCache) invalidateDevice(deviceToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.items {
+		if strings.HasPrefix(k, deviceToken+"\x00") {
+			delete(c.items, k)
+		}
+	}
+}
+
+func (c *syncCache) Name() string {
+	return "Sync responses"
+}
+
+func (c *syncCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+func (c *syncCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]cachedSync)
+}
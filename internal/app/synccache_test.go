@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestSyncCache(t *testing.T) {
+	cache := newSyncCache(time.Minute)
+	keyA := syncCacheKey("device-a", []byte(`{"since":1}`))
+	keyB := syncCacheKey("device-b", []byte(`{"since":1}`))
+	if keyA == keyB {
+		t.Fatal("expected keys of different devices to differ")
+	}
+
+	cache.put(keyA, []byte("a"))
+	cache.put(keyB, []byte("b"))
+	if body, ok := cache.get(keyA); !ok || string(body) != "a" {
+		t.Errorf("expected cached body 'a', got %q, %v", body, ok)
+	}
+
+	cache.invalidateDevice("device-a")
+	if _, ok := cache.get(keyA); ok {
+		t.Error("expected device-a's response to be invalidated")
+	}
+	if _, ok := cache.get(keyB); !ok {
+		t.Error("expected device-b's response to be kept")
+	}
+
+	expired := newSyncCache(time.Nanosecond)
+	expired.put(keyA, []byte("a"))
+	time.Sleep(time.Millisecond)
+	if _, ok := expired.get(keyA); ok {
+		t.Error("expected the response to expire")
+	}
+}
+
+func TestHandleKoboGetCached(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, SyncCacheTTL: time.Minute},
+		}),
+		WithLogger(testLogger),
+	)
+
+	get := func() int {
+		body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body)
+		}
+		var resp models.KoboGetResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return len(resp.List)
+	}
+
+	if n := get(); n != 1 {
+		t.Fatalf("expected 1 item, got %d", n)
+	}
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", URL: "https://example.com/2"}, "")
+	if n := get(); n != 1 {
+		t.Errorf("expected the cached response with 1 item, got %d", n)
+	}
+
+	body, _ := json.Marshal(models.KoboSendRequest{
+		AccessToken: mockDeviceToken,
+		Actions:     []any{map[string]any{"action": "favorite", "item_id": "1"}},
+	})
+	app.HandleKoboSend(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/kobo/send", bytes.NewReader(body)))
+	if n := get(); n != 2 {
+		t.Errorf("expected a fresh response with 2 items after a send, got %d", n)
+	}
+}
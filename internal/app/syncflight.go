@@ -0,0 +1,68 @@
+package app
+
+import "sync"
+
+// How a /api/kobo/get request was served.
+const (
+	syncFetched = "fetched"
+	syncShared  = "shared"
+	syncCached  = "cached"
+)
+
+// syncOutcome names how a request was served that either ran a sync or
+// joined one already running.
+func syncOutcome(ran bool) string {
+	if ran {
+		return syncFetched
+	}
+	return syncShared
+}
+
+// syncError is a failed sync, with the message reported to every device
+// request that shared it.
+type syncError struct {
+	message string
+	err     error
+}
+
+func (e *syncError) Error() string {
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *syncError) Unwrap() error {
+	return e.err
+}
+
+// outcomeCounter counts events by outcome, for metrics.
+type outcomeCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newOutcomeCounter() *outcomeCounter {
+	return &outcomeCounter{counts: make(map[string]uint64)}
+}
+
+func (c *outcomeCounter) count(outcome string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[outcome]++
+}
+
+func (c *outcomeCounter) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]uint64, len(c.counts))
+	for outcome, n := range c.counts {
+		counts[outcome] = n
+	}
+	return counts
+}
+
+// SyncOutcomes counts /api/kobo/get requests by whether they fetched from
+// Readeck, shared a sync already running for the same request, or were
+// served from the sync cache, for metrics.
+func (a *App) SyncOutcomes() map[string]uint64 {
+	return a.syncOutcomes.snapshot()
+}
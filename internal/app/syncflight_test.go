@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestHandleKoboGetSharesRunningSync(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1"}, "")
+
+	var requests atomic.Int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	transport := mockServer.Client().Transport
+	client := &http.Client{Transport: &MockRoundTripper{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+		if requests.Add(1) == 1 {
+			entered <- struct{}{}
+			<-release
+		}
+		return transport.RoundTrip(req)
+	}}}
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(client),
+	)
+
+	body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = get()
+	}()
+	<-entered
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1] = get()
+	}()
+	// Give the second request time to join the running sync.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	shared := requests.Load()
+	for i, rr := range results {
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", i, rr.Code)
+		}
+	}
+	if results[0].Body.String() != results[1].Body.String() {
+		t.Errorf("expected both requests to get the same response")
+	}
+
+	before := requests.Load()
+	if rr := get(); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if alone := requests.Load() - before; shared != alone {
+		t.Errorf("expected the shared sync to make %d Readeck requests, got %d", alone, shared)
+	}
+
+	if outcomes := app.SyncOutcomes(); outcomes[syncShared] != 1 || outcomes[syncFetched] != 2 {
+		t.Errorf("expected 1 shared and 2 fetched syncs, got %v", outcomes)
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"html"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// Reasons a bookmark is left out of a sync, for metrics.
+const (
+	skipMissingID = "missing_id"
+	skipPanic     = "panic"
+)
+
+// syncItem builds the sync item of bookmark, which changed at synced. A
+// bookmark whose item cannot be built is logged, counted and left out, so one
+// bad bookmark does not fail the sync of every other.
+func (a *App) syncItem(bookmark *readeck.Bookmark, synced time.Time) (entry models.KoboArticleItem, ok bool) {
+	if bookmark.ID == "" {
+		a.Logger.Warnf("Leaving bookmark %q without an ID out of the sync", bookmark.Title)
+		a.skippedItems.count(skipMissingID)
+		return models.KoboArticleItem{}, false
+	}
+	if bookmark.Created.IsZero() || bookmark.Updated.IsZero() {
+		dated := *bookmark
+		dated.Created, dated.Updated = bookmarkTimes(bookmark, synced)
+		bookmark = &dated
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			a.Logger.Errorf("Error building the sync item of bookmark %s, leaving it out: %v\n%s", bookmark.ID, err, debug.Stack())
+			a.skippedItems.count(skipPanic)
+			entry, ok = models.KoboArticleItem{}, false
+		}
+	}()
+
+	entry = a.buildKoboItem(bookmark)
+	sanitizeKoboItem(&entry)
+	return entry, true
+}
+
+// bookmarkTimes fills in the dates older Readeck versions leave out of a
+// bookmark: each falls back to the other, and to synced when both are missing.
+func bookmarkTimes(bookmark *readeck.Bookmark, synced time.Time) (created, updated time.Time) {
+	created, updated = bookmark.Created, bookmark.Updated
+	if created.IsZero() {
+		created = updated
+	}
+	if created.IsZero() {
+		created = synced
+	}
+	if updated.IsZero() {
+		updated = created
+	}
+	return created, updated
+}
+
+// sanitizeKoboItem cleans the texts of entry for the Kobo's list view, and
+// clears the times and word count left negative by bookmarks Readeck has no
+// date or count for.
+func sanitizeKoboItem(entry *models.KoboArticleItem) {
+	for _, s := range []*string{&entry.GivenTitle, &entry.ResolvedTitle, &entry.Excerpt} {
+		*s = sanitizeText(*s)
+	}
+	for _, s := range []*string{&entry.GivenURL, &entry.ResolvedURL} {
+		*s = strings.ToValidUTF8(*s, "\uFFFD")
+	}
+	for id, author := range entry.Authors {
+		author.Name = sanitizeText(author.Name)
+		entry.Authors[id] = author
+	}
+	for _, t := range []*int64{&entry.TimeAdded, &entry.TimeUpdated, &entry.TimePublished} {
+		*t = max(*t, 0)
+	}
+	entry.WordCount = max(entry.WordCount, 0)
+	entry.TimeToRead = max(entry.TimeToRead, 0)
+}
+
+// sanitizeText makes s displayable in the Kobo's list view: invalid UTF-8,
+// which includes unpaired surrogates, becomes U+FFFD, HTML entities are
+// decoded, byte order marks are dropped, and control characters and runs of
+// white space become single spaces.
+func sanitizeText(s string) string {
+	s = html.UnescapeString(strings.ToValidUTF8(s, "\uFFFD"))
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\uFEFF':
+			return -1
+		case unicode.IsControl(r):
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// SkippedItems counts the bookmarks left out of syncs by reason, for metrics.
+func (a *App) SkippedItems() map[string]uint64 {
+	return a.skippedItems.snapshot()
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestSyncItem(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	synced := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		bookmark readeck.Bookmark
+		// noConfig makes building the item panic.
+		noConfig     bool
+		expectedOK   bool
+		expectedSkip string
+		check        func(t *testing.T, entry models.KoboArticleItem)
+	}{
+		{
+			name:       "valid bookmark",
+			bookmark:   readeck.Bookmark{ID: "1", Title: "Title", Created: created, Updated: created},
+			expectedOK: true,
+			check: func(t *testing.T, entry models.KoboArticleItem) {
+				if entry.TimeAdded != created.Unix() {
+					t.Errorf("expected time_added %d, got %d", created.Unix(), entry.TimeAdded)
+				}
+			},
+		},
+		{
+			name:         "missing ID",
+			bookmark:     readeck.Bookmark{Title: "No ID"},
+			expectedSkip: skipMissingID,
+		},
+		{
+			name:       "invalid UTF-8",
+			bookmark:   readeck.Bookmark{ID: "2", Title: "Caf\xe9", Description: "\xff\xfe", Authors: []string{"Ren\xe9"}},
+			expectedOK: true,
+			check: func(t *testing.T, entry models.KoboArticleItem) {
+				if entry.GivenTitle != "Caf�" || !utf8.ValidString(entry.ResolvedTitle) || !utf8.ValidString(entry.Excerpt) {
+					t.Errorf("expected valid UTF-8 texts, got %q, %q, %q", entry.GivenTitle, entry.ResolvedTitle, entry.Excerpt)
+				}
+				for _, author := range entry.Authors {
+					if !utf8.ValidString(author.Name) {
+						t.Errorf("expected a valid UTF-8 author, got %q", author.Name)
+					}
+				}
+			},
+		},
+		{
+			name:       "missing dates use the sync time",
+			bookmark:   readeck.Bookmark{ID: "3", Title: "Undated"},
+			expectedOK: true,
+			check: func(t *testing.T, entry models.KoboArticleItem) {
+				if entry.TimeAdded != synced.Unix() || entry.TimeUpdated != synced.Unix() {
+					t.Errorf("expected the sync time, got added %d and updated %d", entry.TimeAdded, entry.TimeUpdated)
+				}
+			},
+		},
+		{
+			name:       "dates before 1970",
+			bookmark:   readeck.Bookmark{ID: "5", Title: "Old", Created: time.Unix(-86400, 0), Updated: time.Unix(-3600, 0), WordCount: -1},
+			expectedOK: true,
+			check: func(t *testing.T, entry models.KoboArticleItem) {
+				if entry.TimeAdded != 0 || entry.TimeUpdated != 0 || entry.WordCount != 0 {
+					t.Errorf("expected no times nor words, got added %d, updated %d and %d words", entry.TimeAdded, entry.TimeUpdated, entry.WordCount)
+				}
+			},
+		},
+		{
+			name:         "panic while building",
+			bookmark:     readeck.Bookmark{ID: "4", Title: "Boom"},
+			noConfig:     true,
+			expectedSkip: skipPanic,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := []Option{WithLogger(testLogger)}
+			if !tc.noConfig {
+				options = append(options, WithConfig(&config.Config{}))
+			}
+			app := NewApp(options...)
+
+			entry, ok := app.syncItem(&tc.bookmark, synced)
+			if ok != tc.expectedOK {
+				t.Fatalf("expected ok %v, got %v", tc.expectedOK, ok)
+			}
+			if tc.expectedSkip != "" {
+				if got := app.SkippedItems()[tc.expectedSkip]; got != 1 {
+					t.Errorf("expected one %s skip, got %v", tc.expectedSkip, app.SkippedItems())
+				}
+				return
+			}
+			if entry.ItemID != tc.bookmark.ID {
+				t.Errorf("expected item %s, got %s", tc.bookmark.ID, entry.ItemID)
+			}
+			tc.check(t, entry)
+		})
+	}
+}
+
+func TestSanitizeText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "plain title", input: "How to Read More Books", expected: "How to Read More Books"},
+		{name: "escaped ampersand", input: "Tips &amp; Tricks for Go", expected: "Tips & Tricks for Go"},
+		{name: "numeric entities", input: "It&#39;s &#x201C;fine&#x201D;", expected: "It's \u201cfine\u201d"},
+		{name: "named entities", input: "Caf&eacute; &mdash; Paris&nbsp;Edition", expected: "Caf\u00e9 \u2014 Paris Edition"},
+		{name: "entity without semicolon", input: "R&D &lt;3", expected: "R&D <3"},
+		{name: "escaped markup stays text", input: "Using &lt;b&gt; tags", expected: "Using <b> tags"},
+		{name: "newlines and tabs", input: "A title\n\twith\r\nbreaks", expected: "A title with breaks"},
+		{name: "control characters", input: "Null\x00byte and \x1b[1mescape\u0085", expected: "Null byte and [1mescape"},
+		{name: "byte order mark", input: "\uFEFFTitle", expected: "Title"},
+		{name: "unpaired surrogate", input: "Emoji \xed\xa0\xbd broken", expected: "Emoji \uFFFD broken"},
+		{name: "latin-1 bytes", input: "Ni\xf1o", expected: "Ni\uFFFDo"},
+		{name: "surrounding white space", input: "  \u00a0Padded\u3000 ", expected: "Padded"},
+		{name: "emoji and right-to-left text", input: "\U0001F4DA \u05e9\u05dc\u05d5\u05dd", expected: "\U0001F4DA \u05e9\u05dc\u05d5\u05dd"},
+		{name: "empty", input: "", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sanitizeText(tc.input); got != tc.expected {
+				t.Errorf("sanitizeText(%q) = %q, want %q", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBookmarkTimes(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	synced := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		bookmark        readeck.Bookmark
+		synced          time.Time
+		expectedCreated time.Time
+		expectedUpdated time.Time
+	}{
+		{name: "both dates", bookmark: readeck.Bookmark{Created: created, Updated: updated}, synced: synced, expectedCreated: created, expectedUpdated: updated},
+		{name: "no creation date", bookmark: readeck.Bookmark{Updated: updated}, synced: synced, expectedCreated: updated, expectedUpdated: updated},
+		{name: "no update date", bookmark: readeck.Bookmark{Created: created}, synced: synced, expectedCreated: created, expectedUpdated: created},
+		{name: "no dates", synced: synced, expectedCreated: synced, expectedUpdated: synced},
+		{name: "no dates nor sync time"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created, updated := bookmarkTimes(&tc.bookmark, tc.synced)
+			if !created.Equal(tc.expectedCreated) || !updated.Equal(tc.expectedUpdated) {
+				t.Errorf("expected %v and %v, got %v and %v", tc.expectedCreated, tc.expectedUpdated, created, updated)
+			}
+		})
+	}
+}
+
+func TestHandleKoboGetPathologicalBookmarks(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", Title: "Good", Created: time.Now(), Updated: time.Now()}, "")
+	// Readeck sends the zero time for bookmarks without a date.
+	mockServer.AddBookmark(readeck.Bookmark{ID: "2", Title: "Caf\u00e9 \ufffd"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+		WithReadeckHTTPClient(mockServer.Client()),
+	)
+
+	body, _ := json.Marshal(models.KoboGetRequest{Count: "10", AccessToken: mockDeviceToken})
+	rr := httptest.NewRecorder()
+	app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp models.KoboGetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.List) != 2 || resp.List["1"].ItemID != "1" {
+		t.Fatalf("expected both bookmarks, got %v", resp.List)
+	}
+	if undated := resp.List["2"]; undated.TimeAdded <= 0 || undated.TimeUpdated != undated.TimeAdded {
+		t.Errorf("expected the undated bookmark at the sync time, got added %d and updated %d", undated.TimeAdded, undated.TimeUpdated)
+	}
+	if skipped := app.SkippedItems(); len(skipped) != 0 {
+		t.Errorf("expected no skipped bookmarks, got %v", skipped)
+	}
+}
@@ -0,0 +1,646 @@
+package app
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Formula text sizes in pixels, and the scale of scripts, fraction parts and
+// big operators relative to the text around them.
+const (
+	inlineFormulaSize  = 28
+	displayFormulaSize = 34
+	minFormulaSize     = 10
+	scriptScale        = 0.7
+	fractionScale      = 0.85
+	bigOperatorScale   = 1.3
+)
+
+// mathStyle is the font a part of a formula is drawn in. Letters in
+// mathDefault are italic, as variables, and everything else is upright.
+type mathStyle int
+
+const (
+	mathDefault mathStyle = iota
+	mathUpright
+	mathItalic
+	mathBold
+)
+
+// mathFonts are parsed once, like placeholderFont.
+var mathFonts = sync.OnceValues(func() (map[mathStyle]*opentype.Font, error) {
+	fonts := make(map[mathStyle]*opentype.Font)
+	for style, ttf := range map[mathStyle][]byte{mathUpright: goregular.TTF, mathItalic: goitalic.TTF, mathBold: gobold.TTF} {
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			return nil, err
+		}
+		fonts[style] = f
+	}
+	return fonts, nil
+})
+
+// texSymbols maps TeX commands to the characters they stand for.
+var texSymbols = map[string]string{
+	`\alpha`: "α", `\beta`: "β", `\gamma`: "γ", `\delta`: "δ", `\epsilon`: "ϵ", `\varepsilon`: "ε",
+	`\zeta`: "ζ", `\eta`: "η", `\theta`: "θ", `\vartheta`: "ϑ", `\iota`: "ι", `\kappa`: "κ",
+	`\lambda`: "λ", `\mu`: "μ", `\nu`: "ν", `\xi`: "ξ", `\pi`: "π", `\varpi`: "ϖ", `\rho`: "ρ",
+	`\varrho`: "ϱ", `\sigma`: "σ", `\varsigma`: "ς", `\tau`: "τ", `\upsilon`: "υ", `\phi`: "ϕ",
+	`\varphi`: "φ", `\chi`: "χ", `\psi`: "ψ", `\omega`: "ω",
+	`\Gamma`: "Γ", `\Delta`: "Δ", `\Theta`: "Θ", `\Lambda`: "Λ", `\Xi`: "Ξ", `\Pi`: "Π",
+	`\Sigma`: "Σ", `\Upsilon`: "Υ", `\Phi`: "Φ", `\Psi`: "Ψ", `\Omega`: "Ω",
+	`\times`: "×", `\cdot`: "·", `\div`: "÷", `\pm`: "±", `\mp`: "∓", `\ast`: "∗", `\circ`: "∘",
+	`\le`: "≤", `\leq`: "≤", `\ge`: "≥", `\geq`: "≥", `\ne`: "≠", `\neq`: "≠", `\approx`: "≈",
+	`\equiv`: "≡", `\sim`: "∼", `\simeq`: "≃", `\propto`: "∝", `\ll`: "≪", `\gg`: "≫",
+	`\in`: "∈", `\notin`: "∉", `\ni`: "∋", `\subset`: "⊂", `\subseteq`: "⊆", `\supset`: "⊃",
+	`\supseteq`: "⊇", `\cup`: "∪", `\cap`: "∩", `\setminus`: "∖", `\emptyset`: "∅", `\varnothing`: "∅",
+	`\forall`: "∀", `\exists`: "∃", `\neg`: "¬", `\lnot`: "¬", `\land`: "∧", `\wedge`: "∧",
+	`\lor`: "∨", `\vee`: "∨", `\oplus`: "⊕", `\otimes`: "⊗",
+	`\to`: "→", `\rightarrow`: "→", `\leftarrow`: "←", `\gets`: "←", `\leftrightarrow`: "↔",
+	`\Rightarrow`: "⇒", `\Leftarrow`: "⇐", `\Leftrightarrow`: "⇔", `\implies`: "⇒", `\iff`: "⇔",
+	`\mapsto`: "↦", `\uparrow`: "↑", `\downarrow`: "↓",
+	`\infty`: "∞", `\partial`: "∂", `\nabla`: "∇", `\hbar`: "ℏ", `\ell`: "ℓ", `\Re`: "ℜ", `\Im`: "ℑ",
+	`\aleph`: "ℵ", `\prime`: "′", `\degree`: "°", `\angle`: "∠", `\perp`: "⊥", `\parallel`: "∥",
+	`\ldots`: "…", `\dots`: "…", `\cdots`: "⋯", `\vdots`: "⋮", `\ddots`: "⋱",
+	`\langle`: "⟨", `\rangle`: "⟩", `\lfloor`: "⌊", `\rfloor`: "⌋", `\lceil`: "⌈", `\rceil`: "⌉",
+	`\lbrace`: "{", `\rbrace`: "}", `\{`: "{", `\}`: "}", `\mid`: "|", `\vert`: "|", `\|`: "‖", `\Vert`: "‖",
+	`\backslash`: `\`, `\%`: "%", `\$`: "$", `\&`: "&", `\#`: "#", `\_`: "_", `\^`: "^", `\~`: "~",
+}
+
+// texBigOperators are drawn larger than the text around them.
+var texBigOperators = map[string]string{
+	`\sum`: "∑", `\prod`: "∏", `\coprod`: "∐", `\int`: "∫", `\iint`: "∬", `\oint`: "∮",
+	`\bigcup`: "⋃", `\bigcap`: "⋂",
+}
+
+// texFunctions are the operator names TeX sets upright.
+var texFunctions = map[string]bool{
+	`\sin`: true, `\cos`: true, `\tan`: true, `\cot`: true, `\sec`: true, `\csc`: true,
+	`\arcsin`: true, `\arccos`: true, `\arctan`: true, `\sinh`: true, `\cosh`: true, `\tanh`: true,
+	`\log`: true, `\ln`: true, `\lg`: true, `\exp`: true, `\lim`: true, `\sup`: true, `\inf`: true,
+	`\max`: true, `\min`: true, `\arg`: true, `\det`: true, `\dim`: true, `\ker`: true, `\deg`: true,
+	`\gcd`: true, `\Pr`: true, `\mod`: true,
+}
+
+// texIgnored are commands that only size or position what follows, which
+// formulas are drawn without.
+var texIgnored = map[string]bool{
+	`\left`: true, `\right`: true, `\middle`: true, `\big`: true, `\Big`: true, `\bigg`: true,
+	`\Bigg`: true, `\bigl`: true, `\bigr`: true, `\Bigl`: true, `\Bigr`: true, `\displaystyle`: true,
+	`\textstyle`: true, `\scriptstyle`: true, `\limits`: true, `\nolimits`: true, `\!`: true,
+	`\nonumber`: true, `\notag`: true,
+}
+
+// texStyles are the commands that set their argument in a font.
+var texStyles = map[string]mathStyle{
+	`\mathrm`: mathUpright, `\operatorname`: mathUpright, `\mathsf`: mathUpright, `\mathbb`: mathBold,
+	`\mathcal`: mathItalic, `\mathit`: mathItalic, `\mathbf`: mathBold, `\boldsymbol`: mathBold,
+	`\bm`: mathBold,
+}
+
+// texTextStyles are the commands whose argument is text rather than math.
+var texTextStyles = map[string]mathStyle{
+	`\text`: mathUpright, `\textrm`: mathUpright, `\mbox`: mathUpright, `\textit`: mathItalic,
+	`\textbf`: mathBold, `\emph`: mathItalic,
+}
+
+// texAccents are drawn above their argument.
+var texAccents = map[string]string{
+	`\hat`: "ˆ", `\widehat`: "ˆ", `\tilde`: "˜", `\widetilde`: "˜", `\dot`: "˙", `\ddot`: "¨",
+	`\vec`: "→", `\check`: "ˇ", `\breve`: "˘", `\acute`: "´", `\grave`: "`",
+}
+
+// mathRelations are given space on both sides.
+const mathRelations = "+−=<>±∓×÷·≤≥≠≈≡∼≃∝≪≫∈∉∋⊂⊆⊃⊇∪∩∖∧∨⊕⊗→←↔⇒⇐⇔↦"
+
+// mathBox is a laid out part of a formula, drawn with its left end at x and
+// its baseline at y.
+type mathBox struct {
+	width, ascent, descent int
+	draw                   func(dst *image.RGBA, x, y int)
+}
+
+// drawAt draws b, which may be empty.
+func (b mathBox) drawAt(dst *image.RGBA, x, y int) {
+	if b.draw != nil {
+		b.draw(dst, x, y)
+	}
+}
+
+type mathFace struct {
+	style mathStyle
+	size  int
+}
+
+// texLayout lays out the tokens of a TeX formula into boxes. It understands
+// the common subset of TeX found in articles; unknown commands are shown by
+// name.
+type texLayout struct {
+	fonts  map[mathStyle]*opentype.Font
+	faces  map[mathFace]font.Face
+	tokens []string
+	pos    int
+	err    error
+}
+
+// renderFormula draws the TeX formula tex in black on white, at the size of
+// a display formula or of one within a line of text.
+func renderFormula(tex string, display bool) (*image.RGBA, error) {
+	fonts, err := mathFonts()
+	if err != nil {
+		return nil, err
+	}
+	l := &texLayout{fonts: fonts, faces: make(map[mathFace]font.Face), tokens: tokenizeTeX(tex)}
+	defer l.close()
+
+	size := inlineFormulaSize
+	if display {
+		size = displayFormulaSize
+	}
+	var boxes []mathBox
+	for l.pos < len(l.tokens) {
+		boxes = append(boxes, l.row(size, mathDefault))
+		// Skip an unbalanced closing brace.
+		l.pos++
+	}
+	if l.err != nil {
+		return nil, l.err
+	}
+	box := hbox(boxes)
+
+	pad := size / 4
+	img := image.NewRGBA(image.Rect(0, 0, box.width+2*pad, box.ascent+box.descent+2*pad))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	box.drawAt(img, pad, pad+box.ascent)
+	return img, nil
+}
+
+// tokenizeTeX splits tex into commands, spaces and single characters.
+func tokenizeTeX(tex string) []string {
+	var tokens []string
+	runes := []rune(tex)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes) && isASCIILetter(runes[i+1]):
+			j := i + 1
+			for j < len(runes) && isASCIILetter(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j - 1
+		case r == '\\' && i+1 < len(runes):
+			tokens = append(tokens, string(runes[i:i+2]))
+			i++
+		case unicode.IsSpace(r):
+			if len(tokens) == 0 || tokens[len(tokens)-1] != " " {
+				tokens = append(tokens, " ")
+			}
+		default:
+			tokens = append(tokens, string(r))
+		}
+	}
+	return tokens
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+func (l *texLayout) close() {
+	for _, face := range l.faces {
+		_ = face.Close()
+	}
+}
+
+func (l *texLayout) face(style mathStyle, size int) font.Face {
+	if style == mathDefault {
+		style = mathUpright
+	}
+	key := mathFace{style, size}
+	if face, ok := l.faces[key]; ok {
+		return face
+	}
+	face, err := opentype.NewFace(l.fonts[style], &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		if l.err == nil {
+			l.err = err
+		}
+		return nil
+	}
+	l.faces[key] = face
+	return face
+}
+
+// row lays out the atoms up to the next closing brace, which is left for
+// the caller.
+func (l *texLayout) row(size int, style mathStyle) mathBox {
+	var boxes []mathBox
+	for l.pos < len(l.tokens) && l.tokens[l.pos] != "}" {
+		box, ok := l.atom(size, style)
+		if ok {
+			boxes = append(boxes, l.scripts(box, size, style))
+		}
+	}
+	return hbox(boxes)
+}
+
+// argument lays out the argument of a command: a group, or a single atom.
+func (l *texLayout) argument(size int, style mathStyle) mathBox {
+	for l.pos < len(l.tokens) && l.tokens[l.pos] == " " {
+		l.pos++
+	}
+	if l.pos >= len(l.tokens) || l.tokens[l.pos] == "}" {
+		return mathBox{}
+	}
+	if l.tokens[l.pos] == "{" {
+		l.pos++
+		box := l.row(size, style)
+		l.pos++
+		return box
+	}
+	box, _ := l.atom(size, style)
+	return box
+}
+
+// textArgument reads the argument of a text command as plain text.
+func (l *texLayout) textArgument() string {
+	for l.pos < len(l.tokens) && l.tokens[l.pos] == " " {
+		l.pos++
+	}
+	if l.pos >= len(l.tokens) {
+		return ""
+	}
+	if l.tokens[l.pos] != "{" {
+		l.pos++
+		return l.tokens[l.pos-1]
+	}
+	var b strings.Builder
+	depth := 0
+	for l.pos++; l.pos < len(l.tokens); l.pos++ {
+		tok := l.tokens[l.pos]
+		switch {
+		case tok == "{":
+			depth++
+		case tok == "}" && depth == 0:
+			l.pos++
+			return b.String()
+		case tok == "}":
+			depth--
+		case texSymbols[tok] != "":
+			b.WriteString(texSymbols[tok])
+		default:
+			b.WriteString(tok)
+		}
+	}
+	return b.String()
+}
+
+// atom lays out the next token and the arguments it takes. It reports
+// false for tokens that draw nothing.
+func (l *texLayout) atom(size int, style mathStyle) (mathBox, bool) {
+	tok := l.tokens[l.pos]
+	switch tok {
+	case "^", "_":
+		// A script without a base, which scripts attaches to nothing.
+		return mathBox{}, true
+	case "{":
+		return l.argument(size, style), true
+	}
+	l.pos++
+
+	switch {
+	case tok == " " || texIgnored[tok]:
+		return mathBox{}, false
+	case tok == `\begin` || tok == `\end`:
+		l.textArgument()
+		return mathBox{}, false
+	case tok == "&" || tok == `\\`:
+		return space(size), true
+	case tok == "~" || tok == `\ `:
+		return space(size / 3), true
+	case tok == `\,`:
+		return space(size / 6), true
+	case tok == `\:` || tok == `\>`:
+		return space(size * 4 / 18), true
+	case tok == `\;`:
+		return space(size * 5 / 18), true
+	case tok == `\quad`:
+		return space(size), true
+	case tok == `\qquad`:
+		return space(2 * size), true
+	case tok == `\frac` || tok == `\dfrac` || tok == `\tfrac` || tok == `\cfrac`:
+		sub := scaled(size, fractionScale)
+		num := l.argument(sub, style)
+		den := l.argument(sub, style)
+		return fraction(num, den, size), true
+	case tok == `\binom`:
+		sub := scaled(size, fractionScale)
+		top := l.argument(sub, style)
+		bottom := l.argument(sub, style)
+		return hbox([]mathBox{l.text("(", mathUpright, size), stack(top, bottom, size), l.text(")", mathUpright, size)}), true
+	case tok == `\sqrt`:
+		var index *mathBox
+		if l.pos < len(l.tokens) && l.tokens[l.pos] == "[" {
+			start := l.pos + 1
+			end := start
+			for end < len(l.tokens) && l.tokens[end] != "]" {
+				end++
+			}
+			box := l.sublayout(l.tokens[start:end], scaled(size, scriptScale*scriptScale), style)
+			index = &box
+			l.pos = min(end+1, len(l.tokens))
+		}
+		return radical(l.argument(size, style), index, size), true
+	case tok == `\overline` || tok == `\bar` || tok == `\underline`:
+		return rule(l.argument(size, style), size, tok == `\underline`), true
+	case texAccents[tok] != "":
+		accentSize := size
+		if tok == `\vec` {
+			accentSize = scaled(size, scriptScale)
+		}
+		return l.accent(l.argument(size, style), texAccents[tok], accentSize, size), true
+	case texTextStyles[tok] != mathDefault:
+		return l.text(l.textArgument(), texTextStyles[tok], size), true
+	case texStyles[tok] != mathDefault:
+		return l.argument(size, texStyles[tok]), true
+	case texFunctions[tok]:
+		return l.text(tok[1:], mathUpright, size), true
+	case texBigOperators[tok] != "":
+		return l.text(texBigOperators[tok], mathUpright, scaled(size, bigOperatorScale)), true
+	case texSymbols[tok] != "":
+		return l.symbol(texSymbols[tok], mathUpright, size), true
+	case strings.HasPrefix(tok, `\`):
+		return l.text(tok[1:], mathUpright, size), true
+	case tok == "-":
+		return l.symbol("−", mathUpright, size), true
+	case tok == "'":
+		return l.text("′", mathUpright, size), true
+	}
+
+	if style == mathDefault && isASCIILetter([]rune(tok)[0]) {
+		return l.text(tok, mathItalic, size), true
+	}
+	return l.symbol(tok, style, size), true
+}
+
+// sublayout lays out tokens from outside the current token stream, such as
+// the index of a root.
+func (l *texLayout) sublayout(tokens []string, size int, style mathStyle) mathBox {
+	saved, pos := l.tokens, l.pos
+	l.tokens, l.pos = tokens, 0
+	var boxes []mathBox
+	for l.pos < len(l.tokens) {
+		boxes = append(boxes, l.row(size, style))
+		l.pos++
+	}
+	l.tokens, l.pos = saved, pos
+	return hbox(boxes)
+}
+
+// scripts attaches the superscript and subscript following base to it.
+func (l *texLayout) scripts(base mathBox, size int, style mathStyle) mathBox {
+	var sup, sub *mathBox
+	for l.pos < len(l.tokens) {
+		tok := l.tokens[l.pos]
+		if tok != "^" && tok != "_" {
+			break
+		}
+		l.pos++
+		box := l.argument(scaled(size, scriptScale), style)
+		if tok == "^" {
+			sup = &box
+		} else {
+			sub = &box
+		}
+	}
+	if sup == nil && sub == nil {
+		return base
+	}
+
+	b := base
+	var supShift, subShift, scriptWidth int
+	if sup != nil {
+		supShift = max(size*2/5, base.ascent-(sup.ascent+sup.descent)/2)
+		b.ascent = max(b.ascent, supShift+sup.ascent)
+		scriptWidth = sup.width
+	}
+	if sub != nil {
+		subShift = max(size/5, base.descent+sub.ascent/3)
+		if sup != nil {
+			// Keep the scripts apart when both are present.
+			subShift = max(subShift, sub.ascent+sup.descent-supShift+size/10)
+		}
+		b.descent = max(b.descent, subShift+sub.descent)
+		scriptWidth = max(scriptWidth, sub.width)
+	}
+	b.width = base.width + scriptWidth + 1
+	b.draw = func(dst *image.RGBA, x, y int) {
+		base.drawAt(dst, x, y)
+		if sup != nil {
+			sup.drawAt(dst, x+base.width+1, y-supShift)
+		}
+		if sub != nil {
+			sub.drawAt(dst, x+base.width+1, y+subShift)
+		}
+	}
+	return b
+}
+
+// text lays out s in a single font.
+func (l *texLayout) text(s string, style mathStyle, size int) mathBox {
+	face := l.face(style, size)
+	if face == nil || s == "" {
+		return mathBox{}
+	}
+	bounds, advance := font.BoundString(face, s)
+	b := mathBox{
+		width:   advance.Ceil(),
+		ascent:  max(0, -bounds.Min.Y.Floor()),
+		descent: max(0, bounds.Max.Y.Ceil()),
+	}
+	if style == mathItalic {
+		// Italic letters lean past their advance.
+		b.width += size / 10
+	}
+	b.draw = func(dst *image.RGBA, x, y int) {
+		d := &font.Drawer{Dst: dst, Src: image.Black, Face: face, Dot: fixed.P(x, y)}
+		d.DrawString(s)
+	}
+	return b
+}
+
+// symbol lays out s as text, spaced as a relation or a binary operator when
+// it is one.
+func (l *texLayout) symbol(s string, style mathStyle, size int) mathBox {
+	b := l.text(s, style, size)
+	if strings.Contains(mathRelations, s) {
+		return hbox([]mathBox{space(size / 5), b, space(size / 5)})
+	}
+	return b
+}
+
+// fraction stacks num over den with a bar at the height of the minus sign.
+func fraction(num, den mathBox, size int) mathBox {
+	thickness := max(1, size/16)
+	gap := max(2, size/8)
+	axis := size * 7 / 25
+	width := max(num.width, den.width) + 2*gap
+	barTop := axis + thickness/2
+	return mathBox{
+		width:   width,
+		ascent:  barTop + gap + num.descent + num.ascent,
+		descent: max(0, thickness-barTop+gap+den.ascent+den.descent),
+		draw: func(dst *image.RGBA, x, y int) {
+			num.drawAt(dst, x+(width-num.width)/2, y-barTop-gap-num.descent)
+			fillRect(dst, image.Rect(x+gap/2, y-barTop, x+width-gap/2, y-barTop+thickness))
+			den.drawAt(dst, x+(width-den.width)/2, y-barTop+thickness+gap+den.ascent)
+		},
+	}
+}
+
+// stack places top over bottom, centered, as in a binomial coefficient.
+func stack(top, bottom mathBox, size int) mathBox {
+	gap := max(2, size/8)
+	axis := size * 7 / 25
+	width := max(top.width, bottom.width)
+	return mathBox{
+		width:   width,
+		ascent:  axis + gap/2 + top.descent + top.ascent,
+		descent: max(0, gap/2-axis+bottom.ascent+bottom.descent),
+		draw: func(dst *image.RGBA, x, y int) {
+			top.drawAt(dst, x+(width-top.width)/2, y-axis-gap/2-top.descent)
+			bottom.drawAt(dst, x+(width-bottom.width)/2, y-axis+gap/2+bottom.ascent)
+		},
+	}
+}
+
+// radical draws a root sign over content, with index above its left end.
+func radical(content mathBox, index *mathBox, size int) mathBox {
+	thickness := max(1, size/16)
+	gap := max(2, size/10)
+	sign := size / 2
+	offset := 0
+	if index != nil {
+		offset = max(0, index.width-sign/3)
+	}
+	top := content.ascent + gap + thickness
+	b := mathBox{
+		width:   offset + sign + content.width + gap,
+		ascent:  top,
+		descent: max(content.descent, size/8),
+	}
+	if index != nil {
+		b.ascent = max(b.ascent, size*2/5+index.ascent+index.descent)
+	}
+	descent := b.descent
+	b.draw = func(dst *image.RGBA, x, y int) {
+		x += offset
+		if index != nil {
+			index.drawAt(dst, x-index.width+sign/3, y-size*2/5-index.descent)
+		}
+		drawLine(dst, image.Pt(x, y-size/4), image.Pt(x+sign/3, y+descent-thickness), thickness)
+		drawLine(dst, image.Pt(x+sign/3, y+descent-thickness), image.Pt(x+sign, y-top), thickness)
+		fillRect(dst, image.Rect(x+sign, y-top, x+sign+content.width+gap, y-top+thickness))
+		content.drawAt(dst, x+sign, y)
+	}
+	return b
+}
+
+// rule draws a line over content, or under it.
+func rule(content mathBox, size int, under bool) mathBox {
+	thickness := max(1, size/16)
+	gap := max(2, size/10)
+	b := content
+	if under {
+		b.descent += gap + thickness
+	} else {
+		b.ascent += gap + thickness
+	}
+	b.draw = func(dst *image.RGBA, x, y int) {
+		content.drawAt(dst, x, y)
+		lineY := y - content.ascent - gap - thickness
+		if under {
+			lineY = y + content.descent + gap
+		}
+		fillRect(dst, image.Rect(x, lineY, x+content.width, lineY+thickness))
+	}
+	return b
+}
+
+// accent draws the character mark centered above content.
+func (l *texLayout) accent(content mathBox, mark string, markSize, size int) mathBox {
+	face := l.face(mathUpright, markSize)
+	if face == nil {
+		return content
+	}
+	bounds, advance := font.BoundString(face, mark)
+	gap := max(1, size/16)
+	// The mark's baseline is placed so that its lowest point clears content.
+	baseline := content.ascent + gap + bounds.Max.Y.Ceil()
+	b := content
+	b.ascent = max(content.ascent, baseline-bounds.Min.Y.Floor())
+	b.width = max(content.width, advance.Ceil())
+	b.draw = func(dst *image.RGBA, x, y int) {
+		content.drawAt(dst, x+(b.width-content.width)/2, y)
+		d := &font.Drawer{Dst: dst, Src: image.Black, Face: face, Dot: fixed.P(x+(b.width-advance.Ceil())/2, y-baseline)}
+		d.DrawString(mark)
+	}
+	return b
+}
+
+// hbox places boxes side by side on a shared baseline.
+func hbox(boxes []mathBox) mathBox {
+	var b mathBox
+	for _, box := range boxes {
+		b.width += box.width
+		b.ascent = max(b.ascent, box.ascent)
+		b.descent = max(b.descent, box.descent)
+	}
+	b.draw = func(dst *image.RGBA, x, y int) {
+		for _, box := range boxes {
+			box.drawAt(dst, x, y)
+			x += box.width
+		}
+	}
+	return b
+}
+
+func space(width int) mathBox {
+	return mathBox{width: width}
+}
+
+func scaled(size int, scale float64) int {
+	return max(minFormulaSize, int(float64(size)*scale))
+}
+
+func fillRect(dst *image.RGBA, r image.Rectangle) {
+	draw.Draw(dst, r, image.Black, image.Point{}, draw.Src)
+}
+
+// drawLine draws a line from a to b with a square pen of the given width.
+func drawLine(dst *image.RGBA, a, b image.Point, width int) {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	steps := max(abs(dx), abs(dy), 1)
+	for i := 0; i <= steps; i++ {
+		x := a.X + dx*i/steps
+		y := a.Y + dy*i/steps
+		fillRect(dst, image.Rect(x, y, x+width, y+width))
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Text directions of articles, as in Readeck's text_direction.
+const (
+	textLTR = "ltr"
+	textRTL = "rtl"
+)
+
+// rtlScripts are the scripts written from right to left.
+var rtlScripts = []*unicode.RangeTable{unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko}
+
+// scriptLanguages are scripts written in a single language, which names the
+// language of a text when Readeck did not detect it. Arabic and Latin are
+// shared by many languages and name none.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Hangul, "ko"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// detectLanguage guesses the language and direction of text from the
+// scripts of its letters: the direction of most letters, and the language of
+// a script used by more than half of them. Both are empty without letters.
+func detectLanguage(text string) (lang, dir string) {
+	var letters, rtl int
+	counts := make([]int, len(scriptLanguages))
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.In(r, rtlScripts...) {
+			rtl++
+		}
+		for i, s := range scriptLanguages {
+			if unicode.Is(s.script, r) {
+				counts[i]++
+			}
+		}
+	}
+	if letters == 0 {
+		return "", ""
+	}
+	dir = textLTR
+	if rtl*2 > letters {
+		dir = textRTL
+	}
+	for i, n := range counts {
+		if n*2 > letters {
+			lang = scriptLanguages[i].lang
+		}
+	}
+	return lang, dir
+}
+
+// articleLanguage returns the language and direction of an article, taking
+// Readeck's when it knows them and guessing the rest from text.
+func articleLanguage(lang, dir, text string) (string, string) {
+	dir = strings.ToLower(dir)
+	if dir != textLTR && dir != textRTL {
+		dir = ""
+	}
+	if lang != "" && dir != "" {
+		return lang, dir
+	}
+	detectedLang, detectedDir := detectLanguage(text)
+	if lang == "" {
+		lang = detectedLang
+	}
+	if dir == "" {
+		dir = detectedDir
+	}
+	return lang, dir
+}
+
+// setArticleLanguage wraps the body of an article in a div with its lang
+// and dir, which the Kobo's reader honors wherever it places the article.
+// Left-to-right articles of an unknown language are left as they are.
+func setArticleLanguage(doc *html.Node, lang, dir string) {
+	if lang == "" && dir != textRTL {
+		return
+	}
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return
+	}
+	wrapper := &html.Node{Type: html.ElementNode, DataAtom: atom.Div, Data: atom.Div.String()}
+	if lang != "" {
+		setAttr(wrapper, "lang", lang)
+	}
+	if dir != "" {
+		setAttr(wrapper, "dir", dir)
+	}
+	for c := body.FirstChild; c != nil; {
+		next := c.NextSibling
+		body.RemoveChild(c)
+		wrapper.AppendChild(c)
+		c = next
+	}
+	body.AppendChild(wrapper)
+}
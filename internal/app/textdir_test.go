@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestArticleLanguage(t *testing.T) {
+	tests := []struct {
+		name         string
+		lang         string
+		dir          string
+		text         string
+		expectedLang string
+		expectedDir  string
+	}{
+		{name: "readeck values", lang: "ar", dir: "RTL", text: "Hello", expectedLang: "ar", expectedDir: "rtl"},
+		{name: "english", text: "Hello world", expectedLang: "", expectedDir: "ltr"},
+		{name: "hebrew", text: "שלום עולם", expectedLang: "he", expectedDir: "rtl"},
+		{name: "arabic", text: "مرحبا بالعالم and more", expectedLang: "", expectedDir: "rtl"},
+		{name: "greek", text: "Καλημέρα κόσμε", expectedLang: "el", expectedDir: "ltr"},
+		{name: "language kept, direction detected", lang: "fa", dir: "unknown", text: "سلام دنیا", expectedLang: "fa", expectedDir: "rtl"},
+		{name: "no letters", text: "123 !", expectedLang: "", expectedDir: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang, dir := articleLanguage(tt.lang, tt.dir, tt.text)
+			if lang != tt.expectedLang || dir != tt.expectedDir {
+				t.Errorf("expected %q %q, got %q %q", tt.expectedLang, tt.expectedDir, lang, dir)
+			}
+		})
+	}
+}
+
+func TestSetArticleLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		dir      string
+		expected string
+	}{
+		{name: "unknown left to right", dir: "ltr", expected: `<p>Text</p>`},
+		{name: "right to left", lang: "he", dir: "rtl", expected: `<div lang="he" dir="rtl"><p>Text</p></div>`},
+		{name: "language only", lang: "fr", expected: `<div lang="fr"><p>Text</p></div>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(`<p>Text</p>`))
+			if err != nil {
+				t.Fatalf("failed to parse HTML: %v", err)
+			}
+			setArticleLanguage(doc, tt.lang, tt.dir)
+
+			var buf bytes.Buffer
+			for c := findElement(doc, atom.Body).FirstChild; c != nil; c = c.NextSibling {
+				if err := html.Render(&buf, c); err != nil {
+					t.Fatalf("failed to render HTML: %v", err)
+				}
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+)
+
+// tokenApplication is the application name of tokens created by readeckobo.
+const tokenApplication = "readeckobo"
+
+// tokenState tracks the Readeck token of one user.
+type tokenState struct {
+	token   string // refreshed token, overriding the configured one
+	expired bool
+	// accepted is set once Readeck answered a request with the token.
+	accepted  bool
+	lastError string
+	changedAt time.Time
+}
+
+// tokenStore keeps per-user token state across requests.
+type tokenStore struct {
+	mu     sync.Mutex
+	states map[string]*tokenState
+	// refreshes runs one login per user at a time, so that the requests
+	// rejected together share the token it creates.
+	refreshes singleflight.Group
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{states: make(map[string]*tokenState)}
+}
+
+// readeckToken returns the token to use for user.
+func (s *tokenStore) readeckToken(user *config.User) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[user.Token]; ok && state.token != "" {
+		return state.token
+	}
+	return user.ReadeckAccessToken
+}
+
+func (s *tokenStore) markExpired(user *config.User, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state(user)
+	state.expired = true
+	state.lastError = err.Error()
+	state.changedAt = time.Now()
+}
+
+func (s *tokenStore) setToken(user *config.User, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state(user)
+	state.token = token
+	state.expired = false
+	state.accepted = true
+	state.lastError = ""
+	state.changedAt = time.Now()
+}
+
+// markAccepted notes that Readeck accepted the token of user.
+func (s *tokenStore) markAccepted(user *config.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state(user)
+	if state.accepted && !state.expired {
+		return
+	}
+	state.accepted = true
+	state.expired = false
+	state.changedAt = time.Now()
+}
+
+// state must be called with s.mu held.
+func (s *tokenStore) state(user *config.User) *tokenState {
+	state, ok := s.states[user.Token]
+	if !ok {
+		state = &tokenState{}
+		s.states[user.Token] = state
+	}
+	return state
+}
+
+// refreshReadeckToken is called when Readeck rejects the token of a user. It
+// marks the token expired and, when credentials are configured, logs in
+// again and saves the new token to the configuration file. Concurrent
+// refreshes of a user share one login, and a rejected token that was already
+// replaced is answered with its replacement, so that each expiry creates one
+// Readeck token.
+func (a *App) refreshReadeckToken(ctx context.Context, user *config.User, rejected string) (string, error) {
+	token, err, _ := a.tokens.refreshes.Do(user.Token, func() (any, error) {
+		if current := a.tokens.readeckToken(user); current != rejected {
+			return current, nil
+		}
+		return a.loginReadeck(ctx, user)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.(string), nil
+}
+
+// loginReadeck exchanges the credentials of user for a new Readeck token.
+func (a *App) loginReadeck(ctx context.Context, user *config.User) (string, error) {
+	if user.ReadeckUsername == "" {
+		err := fmt.Errorf("readeck token expired and no credentials are configured")
+		a.tokens.markExpired(user, err)
+		return "", err
+	}
+
+	client, err := readeck.NewClient(a.Config.Readeck.Host, "", a.Logger, a.ReadeckHTTPClient)
+	if err != nil {
+		a.tokens.markExpired(user, err)
+		return "", err
+	}
+
+	login, err := client.Login(ctx, user.ReadeckUsername, user.ReadeckPassword, tokenApplication)
+	if err != nil {
+		a.tokens.markExpired(user, err)
+		return "", err
+	}
+	token := login.Token
+
+	a.Logger.Infof("Obtained a new Readeck token for user %s.", user.ReadeckUsername)
+	a.tokens.setToken(user, token)
+	if a.configPath != "" {
+		if err := config.SaveReadeckAccessToken(a.configPath, user.Token, token); err != nil {
+			a.Logger.Warnf("Error saving the new Readeck token of user %s in %s: %v", user.ReadeckUsername, a.configPath, err)
+		}
+	}
+	return token, nil
+}
+
+// userHealth is the token state of one user as reported by /admin/api/users.
+type userHealth struct {
+	User         string    `json:"user"`
+	ReadeckToken string    `json:"readeck_token"`
+	LastError    string    `json:"last_error,omitempty"`
+	ChangedAt    time.Time `json:"changed_at,omitzero"`
+}
+
+// usersHealth reports the token state of every configured user.
+func (a *App) usersHealth() []userHealth {
+	configured := a.users()
+
+	a.tokens.mu.Lock()
+	defer a.tokens.mu.Unlock()
+
+	users := make([]userHealth, 0, len(configured))
+	for _, user := range configured {
+		// A token is unknown until Readeck answers a request made with it.
+		health := userHealth{User: maskToken(user.Token), ReadeckToken: "unknown"}
+		if state, ok := a.tokens.states[user.Token]; ok {
+			switch {
+			case state.expired:
+				health.ReadeckToken = "expired"
+			case state.accepted:
+				health.ReadeckToken = "valid"
+			}
+			health.LastError = state.lastError
+			health.ChangedAt = state.changedAt
+		}
+		users = append(users, health)
+	}
+	return users
+}
+
+// healthResponse is the response of /healthz. It may be served on the
+// device-facing port without authentication, so it carries no detail of the
+// users; /admin/api/users has those.
+type healthResponse struct {
+	Status string `json:"status"`
+	// ExpiredTokens counts the users whose Readeck token was rejected.
+	ExpiredTokens int `json:"expired_tokens"`
+}
+
+// adminUsersResponse is the response of /admin/api/users.
+type adminUsersResponse struct {
+	Users []userHealth `json:"users"`
+}
+
+// HandleHealthz reports whether the bridge is up and how many users have a
+// rejected Readeck token.
+func (a *App) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	health := healthResponse{Status: "ok"}
+	for _, user := range a.usersHealth() {
+		if user.ReadeckToken == "expired" {
+			health.Status = "degraded"
+			health.ExpiredTokens++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		a.Logger.Errorf("Error encoding response for /healthz: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
+
+// maskToken shortens a device token so it can be shown without exposing it.
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return token[:4] + "****"
+}
+
+// HandleAdminUsers lists the configured users and the state of their Readeck tokens.
+func (a *App) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(adminUsersResponse{Users: a.usersHealth()}); err != nil {
+		a.Logger.Errorf("Error encoding response for /admin/api/users: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+	}
+}
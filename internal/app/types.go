@@ -0,0 +1,51 @@
+package app
+
+import (
+	"slices"
+
+	"readeckobo/internal/readeck"
+)
+
+// Bookmark kinds that can be excluded from sync.
+const (
+	kindArticle = "article"
+	kindPhoto   = "photo"
+	kindVideo   = "video"
+	kindPDF     = "pdf"
+)
+
+// bookmarkKind classifies a bookmark as an article, photo, video or PDF.
+// Readeck types PDFs as articles, so they are told apart by document type.
+func bookmarkKind(bookmark *readeck.Bookmark) string {
+	switch {
+	case bookmark.DocumentType == kindPDF:
+		return kindPDF
+	case bookmark.Type == kindPhoto, bookmark.Type == kindVideo:
+		return bookmark.Type
+	default:
+		return kindArticle
+	}
+}
+
+// excludedKind reports whether the bookmark's kind is left out of sync.
+func (a *App) excludedKind(bookmark *readeck.Bookmark) bool {
+	return slices.Contains(a.Config.Readeck.ExcludeTypes, bookmarkKind(bookmark))
+}
+
+// listTypes returns the Readeck types to list bookmarks of, so that Readeck
+// leaves the excluded kinds out of its pages and totals, or nil to list them
+// all. PDFs are articles to Readeck, so excluding only one of the two is
+// left to excludedKind.
+func (a *App) listTypes() []string {
+	excluded := a.Config.Readeck.ExcludeTypes
+	if len(excluded) == 0 || slices.Contains(excluded, kindArticle) != slices.Contains(excluded, kindPDF) {
+		return nil
+	}
+	var types []string
+	for _, kind := range []string{kindArticle, kindPhoto, kindVideo} {
+		if !slices.Contains(excluded, kind) {
+			types = append(types, kind)
+		}
+	}
+	return types
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/readeck"
+)
+
+func TestBookmarkKind(t *testing.T) {
+	tests := []struct {
+		name          string
+		bookmark      readeck.Bookmark
+		wantKind      string
+		wantIsArticle string
+		wantHasImage  string
+		wantHasVideo  string
+	}{
+		{"article", readeck.Bookmark{Type: "article"}, kindArticle, "1", "0", "0"},
+		{"untyped", readeck.Bookmark{}, kindArticle, "1", "0", "0"},
+		{"photo", readeck.Bookmark{Type: "photo"}, kindPhoto, "0", "2", "0"},
+		{"video", readeck.Bookmark{Type: "video", URL: "https://www.youtube.com/watch?v=abc"}, kindVideo, "0", "0", "2"},
+		{"pdf", readeck.Bookmark{Type: "article", DocumentType: "pdf"}, kindPDF, "0", "0", "0"},
+	}
+
+	app := NewApp(WithConfig(&config.Config{Readeck: config.ConfigReadeck{ExcludeTypes: []string{kindVideo, kindPDF}}}), WithLogger(testLogger))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bookmarkKind(&tt.bookmark); got != tt.wantKind {
+				t.Errorf("bookmarkKind() = %q, want %q", got, tt.wantKind)
+			}
+			item := buildKoboArticleItem(&tt.bookmark)
+			if item.IsArticle != tt.wantIsArticle || item.HasImage != tt.wantHasImage || item.HasVideo != tt.wantHasVideo {
+				t.Errorf("expected is_article %q, has_image %q and has_video %q, got %q, %q and %q",
+					tt.wantIsArticle, tt.wantHasImage, tt.wantHasVideo, item.IsArticle, item.HasImage, item.HasVideo)
+			}
+			wantExcluded := tt.wantKind == kindVideo || tt.wantKind == kindPDF
+			if got := app.excludedKind(&tt.bookmark); got != wantExcluded {
+				t.Errorf("excludedKind() = %v, want %v", got, wantExcluded)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/config"
+)
+
+// softHyphen marks where a word may break at a line end.
+const softHyphen = '\u00ad'
+
+// minHyphenatedWord is the shortest word given hyphenation hints, and
+// minHyphenFragment the fewest letters left on either side of a hint.
+const (
+	minHyphenatedWord = 8
+	minHyphenFragment = 3
+)
+
+// literalElements hold text that must be kept as written, such as code.
+var literalElements = map[atom.Atom]bool{
+	atom.Pre:  true,
+	atom.Code: true,
+	atom.Kbd:  true,
+	atom.Samp: true,
+	atom.Var:  true,
+}
+
+// dropCapElements are the elements that wrap a drop cap.
+var dropCapElements = map[atom.Atom]bool{
+	atom.Span:   true,
+	atom.B:      true,
+	atom.Strong: true,
+	atom.Big:    true,
+	atom.Font:   true,
+	atom.Em:     true,
+	atom.I:      true,
+}
+
+// applyTypography rewrites an article with the user's typography options.
+func applyTypography(doc *html.Node, typography config.Typography) {
+	if typography.MinImageWidth > 0 {
+		removeNarrowImages(doc, typography.MinImageWidth)
+	}
+	if typography.RemoveDropCaps {
+		removeDropCap(doc)
+	}
+	if !typography.SmartQuotes && !typography.NormalizeDashes && !typography.Hyphenate {
+		return
+	}
+	// The previous character carries across text nodes, so that a quote
+	// after an inline element still opens or closes correctly.
+	prev := ' '
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				text := c.Data
+				if typography.NormalizeDashes {
+					text = normalizeDashes(text)
+				}
+				if typography.SmartQuotes {
+					text = smartQuotes(text, prev)
+				}
+				if typography.Hyphenate {
+					text = hyphenate(text)
+				}
+				c.Data = text
+				if r := []rune(text); len(r) > 0 {
+					prev = r[len(r)-1]
+				}
+			case c.Type == html.ElementNode && (literalElements[c.DataAtom] || removedElements[c.DataAtom]):
+				prev = ' '
+			case c.Type == html.ElementNode:
+				walk(c)
+			}
+		}
+	}
+	walk(doc)
+}
+
+// removeNarrowImages drops the images whose width attribute is below
+// minWidth; images without one are kept.
+func removeNarrowImages(doc *html.Node, minWidth int) {
+	var narrow []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom != atom.Img {
+			return
+		}
+		width, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(getAttr(n, "width")), "px"))
+		if err == nil && width < minWidth {
+			narrow = append(narrow, n)
+		}
+	})
+	for _, n := range narrow {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+// removeDropCap unwraps the element holding the first letter of the first
+// paragraph when it is styled as a drop cap: its class names one, or the
+// rest of the word follows it directly.
+func removeDropCap(doc *html.Node) {
+	var first *html.Node
+	walkElements(doc, func(n *html.Node) {
+		if first == nil && n.DataAtom == atom.P && strings.TrimSpace(textContent(n)) != "" {
+			first = n
+		}
+	})
+	if first == nil {
+		return
+	}
+	dropCap := first.FirstChild
+	for dropCap != nil && dropCap.Type == html.TextNode && strings.TrimSpace(dropCap.Data) == "" {
+		dropCap = dropCap.NextSibling
+	}
+	if dropCap == nil || dropCap.Type != html.ElementNode || !dropCapElements[dropCap.DataAtom] {
+		return
+	}
+	letters := strings.TrimSpace(textContent(dropCap))
+	if letters == "" || len([]rune(letters)) > 2 {
+		return
+	}
+	class := strings.ToLower(getAttr(dropCap, "class"))
+	hinted := strings.Contains(class, "drop") || strings.Contains(class, "initial") || strings.Contains(class, "first-letter")
+	joined := dropCap.NextSibling != nil && dropCap.NextSibling.Type == html.TextNode && strings.IndexFunc(dropCap.NextSibling.Data, unicode.IsLetter) == 0
+	if !hinted && !joined {
+		return
+	}
+	first.InsertBefore(&html.Node{Type: html.TextNode, Data: letters}, dropCap)
+	first.RemoveChild(dropCap)
+}
+
+// normalizeDashes turns double hyphens and hyphens or en dashes between
+// spaces into em dashes.
+func normalizeDashes(text string) string {
+	return strings.NewReplacer("---", "—", "--", "—", " - ", " — ", " – ", " — ").Replace(text)
+}
+
+// smartQuotes curls the straight quotes of text, which follows the
+// character prev. A quote opens after a space or an opening bracket or
+// dash, and an apostrophe within a word closes.
+func smartQuotes(text string, prev rune) string {
+	if !strings.ContainsAny(text, `"'`) {
+		return text
+	}
+	var b strings.Builder
+	for _, r := range text {
+		opens := unicode.IsSpace(prev) || strings.ContainsRune("([{‘“—–-", prev)
+		switch {
+		case r == '"' && opens:
+			b.WriteRune('“')
+		case r == '"':
+			b.WriteRune('”')
+		case r == '\'' && opens:
+			b.WriteRune('‘')
+		case r == '\'':
+			b.WriteRune('’')
+		default:
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// hyphenate adds soft hyphens to the long words of text between a vowel and
+// the consonant starting the next syllable, or between two consonants that
+// follow a vowel, a rough rule for languages written in the Latin script.
+func hyphenate(text string) string {
+	var b strings.Builder
+	var word []rune
+	flush := func() {
+		b.WriteString(hyphenateWord(word))
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
+
+func hyphenateWord(word []rune) string {
+	if len(word) < minHyphenatedWord {
+		return string(word)
+	}
+	var b strings.Builder
+	last := 0
+	for i := minHyphenFragment; i <= len(word)-minHyphenFragment; i++ {
+		// A hint goes before word[i]: V-CV, VC-CV, or V-CCV when the two
+		// consonants are a digraph such as "ph", which is never split.
+		vcv := isVowel(word[i-1]) && !isVowel(word[i]) && isVowel(word[i+1])
+		vccv := isVowel(word[i-2]) && !isVowel(word[i-1]) && !isVowel(word[i]) && isVowel(word[i+1]) && !isDigraph(word[i-1], word[i])
+		vdigraph := i+2 < len(word) && isVowel(word[i-1]) && isDigraph(word[i], word[i+1]) && isVowel(word[i+2])
+		if (vcv || vccv || vdigraph) && i-last >= 2 {
+			b.WriteString(string(word[last:i]))
+			b.WriteRune(softHyphen)
+			last = i
+		}
+	}
+	b.WriteString(string(word[last:]))
+	return b.String()
+}
+
+// isDigraph reports whether two consonants spell one sound.
+func isDigraph(a, b rune) bool {
+	switch strings.ToLower(string([]rune{a, b})) {
+	case "ch", "ck", "gh", "ph", "sh", "th", "wh":
+		return true
+	}
+	return false
+}
+
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aeiouyàáâäèéêëìíîïòóôöùúûüAEIOUYÀÁÂÄÈÉÊËÌÍÎÏÒÓÔÖÙÚÛÜ", r)
+}
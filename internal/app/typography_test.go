@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/config"
+)
+
+func TestApplyTypography(t *testing.T) {
+	tests := []struct {
+		name       string
+		typography config.Typography
+		input      string
+		expected   string
+	}{
+		{
+			name:       "off",
+			typography: config.Typography{},
+			input:      `<p>"Don't" -- she said</p>`,
+			expected:   `<p>&#34;Don&#39;t&#34; -- she said</p>`,
+		},
+		{
+			name:       "smart quotes across elements",
+			typography: config.Typography{SmartQuotes: true},
+			input:      `<p>"It's <em>her</em>" ('90s) <code>"raw"</code></p>`,
+			expected:   `<p>“It’s <em>her</em>” (‘90s) <code>&#34;raw&#34;</code></p>`,
+		},
+		{
+			name:       "dashes",
+			typography: config.Typography{NormalizeDashes: true},
+			input:      `<p>Wait -- no - yes – maybe well-known</p>`,
+			expected:   `<p>Wait — no — yes — maybe well-known</p>`,
+		},
+		{
+			name:       "hyphenation",
+			typography: config.Typography{Hyphenate: true},
+			input:      `<p>A typography, weather example</p>`,
+			expected:   "<p>A typog\u00adra\u00adphy, weather example</p>",
+		},
+		{
+			name:       "narrow images",
+			typography: config.Typography{MinImageWidth: 100},
+			input:      `<p><img src="a.gif" width="1"/><img src="b.jpg" width="640px"/><img src="c.jpg"/></p>`,
+			expected:   `<p><img src="b.jpg" width="640px"/><img src="c.jpg"/></p>`,
+		},
+		{
+			name:       "drop cap by class",
+			typography: config.Typography{RemoveDropCaps: true},
+			input:      `<p> <span class="dropcap">O</span>nce upon a time</p><p><span class="dropcap">X</span></p>`,
+			expected:   `<p> Once upon a time</p><p><span class="dropcap">X</span></p>`,
+		},
+		{
+			name:       "drop cap joined to its word",
+			typography: config.Typography{RemoveDropCaps: true},
+			input:      `<p><big>T</big>he start</p>`,
+			expected:   `<p>The start</p>`,
+		},
+		{
+			name:       "emphasis is not a drop cap",
+			typography: config.Typography{RemoveDropCaps: true},
+			input:      `<p><em>I</em> think</p>`,
+			expected:   `<p><em>I</em> think</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("failed to parse HTML: %v", err)
+			}
+			applyTypography(doc, tt.typography)
+
+			var buf bytes.Buffer
+			for c := findElement(doc, atom.Body).FirstChild; c != nil; c = c.NextSibling {
+				if err := html.Render(&buf, c); err != nil {
+					t.Fatalf("failed to render HTML: %v", err)
+				}
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/urlnorm"
+)
+
+// urlIndex maps the URLs of each device's synced items to their bookmark IDs,
+// so that /api/kobo/download finds a bookmark without searching Readeck. It
+// is mirrored to a JSON file when one is configured.
+type urlIndex struct {
+	mu   sync.Mutex
+	path string
+	// entries maps device tokens to normalized URLs to bookmark IDs.
+	entries map[string]map[string]string
+}
+
+func newURLIndex(path string) *urlIndex {
+	return &urlIndex{path: path, entries: make(map[string]map[string]string)}
+}
+
+// load reads the index file written by a previous run.
+func (x *urlIndex) load() error {
+	if x.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(x.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read URL index: %w", err)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := json.Unmarshal(data, &x.entries); err != nil {
+		return fmt.Errorf("failed to parse URL index %s: %w", x.path, err)
+	}
+	if x.entries == nil {
+		x.entries = make(map[string]map[string]string)
+	}
+	return nil
+}
+
+// save writes the index file; x.mu must be held.
+func (x *urlIndex) save() error {
+	if x.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(x.entries)
+	if err != nil {
+		return err
+	}
+	tmp := x.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write URL index: %w", err)
+	}
+	if err := os.Rename(tmp, x.path); err != nil {
+		return fmt.Errorf("failed to write URL index: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the bookmark ID indexed for rawURL, or "".
+func (x *urlIndex) lookup(deviceToken, rawURL string) string {
+	key, err := urlnorm.Key(rawURL)
+	if err != nil {
+		return ""
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.entries[deviceToken][key]
+}
+
+// add indexes the bookmark ID of rawURL.
+func (x *urlIndex) add(deviceToken, rawURL, bookmarkID string) error {
+	return x.update(deviceToken, map[string]models.KoboArticleItem{
+		bookmarkID: {ItemID: bookmarkID, GivenURL: rawURL, Status: "0"},
+	})
+}
+
+// update indexes the items sent to a device and drops the deleted ones.
+func (x *urlIndex) update(deviceToken string, items map[string]models.KoboArticleItem) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	urls := x.entries[deviceToken]
+	if urls == nil {
+		urls = make(map[string]string)
+	}
+	changed := false
+	for id, item := range items {
+		if item.Status == "2" {
+			changed = removeBookmarkID(urls, id) || changed
+			continue
+		}
+		key, err := urlnorm.Key(item.GivenURL)
+		if item.GivenURL == "" || err != nil || urls[key] == id {
+			continue
+		}
+		urls[key] = id
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	x.entries[deviceToken] = urls
+	return x.save()
+}
+
+// remove drops bookmarkID, which Readeck no longer knows, from the index.
+func (x *urlIndex) remove(deviceToken, bookmarkID string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !removeBookmarkID(x.entries[deviceToken], bookmarkID) {
+		return nil
+	}
+	return x.save()
+}
+
+func removeBookmarkID(urls map[string]string, bookmarkID string) bool {
+	removed := false
+	for key, id := range urls {
+		if id == bookmarkID {
+			delete(urls, key)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// LoadURLIndex restores the URL index saved when readeckobo last stopped.
+func (a *App) LoadURLIndex() error {
+	return a.urls.load()
+}
+
+// indexedBookmark returns the bookmark indexed for rawURL in the device of
+// uc, or nil when the URL is not indexed or its bookmark is gone, in which
+// case the caller falls back to searching Readeck.
+func (a *App) indexedBookmark(ctx context.Context, client *readeck.Client, uc *UserContext, rawURL string) *readeck.Bookmark {
+	deviceToken := uc.User.Token
+	id := a.urls.lookup(deviceToken, rawURL)
+	if id == "" {
+		return nil
+	}
+	bookmark, err := a.bookmarkDetails(ctx, client, uc, id)
+	if err != nil {
+		if readeck.IsNotFound(err) {
+			if err := a.urls.remove(deviceToken, id); err != nil {
+				a.Logger.Warnf("Error updating URL index for bookmark %s: %v", id, err)
+			}
+		} else {
+			a.Logger.Warnf("Error fetching indexed bookmark %s for %s: %v", id, rawURL, err)
+		}
+		return nil
+	}
+	if bookmark.IsDeleted {
+		uc.bookmarks.remove(id)
+		if err := a.urls.remove(deviceToken, id); err != nil {
+			a.Logger.Warnf("Error updating URL index for bookmark %s: %v", id, err)
+		}
+		return nil
+	}
+	return bookmark
+}
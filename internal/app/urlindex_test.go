@@ -0,0 +1,118 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestURLIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "url-index.json")
+	index := newURLIndex(path)
+
+	err := index.update("device", map[string]models.KoboArticleItem{
+		"b1": {ItemID: "b1", GivenURL: "https://www.example.com/post", Status: "0"},
+		"b2": {ItemID: "b2", GivenURL: "https://example.com/other", Status: "1"},
+	})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	reloaded := newURLIndex(path)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	tests := []struct {
+		name   string
+		device string
+		url    string
+		want   string
+	}{
+		{"normalized match", "device", "https://example.com/post", "b1"},
+		{"archived item", "device", "https://example.com/other", "b2"},
+		{"other device", "other", "https://example.com/post", ""},
+		{"unknown URL", "device", "https://example.com/missing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reloaded.lookup(tt.device, tt.url); got != tt.want {
+				t.Errorf("lookup(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	if err := reloaded.update("device", map[string]models.KoboArticleItem{"b1": {ItemID: "b1", Status: "2"}}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := reloaded.remove("device", "b2"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	final := newURLIndex(path)
+	if err := final.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := final.lookup("device", "https://example.com/post"); got != "" {
+		t.Errorf("expected deleted bookmark to leave the index, got %q", got)
+	}
+	if got := final.lookup("device", "https://example.com/other"); got != "" {
+		t.Errorf("expected removed bookmark to leave the index, got %q", got)
+	}
+}
+
+func TestHandleKoboDownloadUsesURLIndex(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "b1", URL: "https://example.com/post", Title: "Post"}, "<p>Indexed article</p>")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL},
+		}),
+		WithLogger(testLogger),
+	)
+
+	body, _ := json.Marshal(models.KoboGetRequest{Count: "10", AccessToken: mockDeviceToken})
+	rr := httptest.NewRecorder()
+	app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("sync failed with status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Searching is broken, so only the index can find the bookmark.
+	mockServer.Fail(http.MethodGet, "/api/bookmarks", http.StatusInternalServerError)
+	download := func() *httptest.ResponseRecorder {
+		form := url.Values{"access_token": {mockDeviceToken}, "url": {"https://www.example.com/post"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/kobo/download", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		app.HandleKoboDownload(rr, req)
+		return rr
+	}
+
+	rr = download()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "Indexed article") {
+		t.Errorf("expected the indexed article, got %s", rr.Body.String())
+	}
+
+	mockServer.DeleteBookmark("b1")
+	if rr := download(); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 once the bookmark is gone, got %d", rr.Code)
+	}
+	if id := app.urls.lookup(mockDeviceToken, "https://example.com/post"); id != "" {
+		t.Errorf("expected the deleted bookmark to leave the index, got %q", id)
+	}
+}
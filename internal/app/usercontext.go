@@ -0,0 +1,292 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+)
+
+// syncHistorySize is how many syncs of each device are remembered for the
+// user portal.
+const syncHistorySize = 20
+
+// maxAuthPeek is the largest request body AuthMiddleware reads a token from;
+// handlers resolve the user of larger requests themselves.
+const maxAuthPeek = 64 << 10
+
+// UserContext is the state readeckobo keeps for one device: its Readeck
+// client, its cached sync responses and bookmarks, its running syncs and its
+// last syncs.
+// Each device has its own, so that the requests of one device never see the
+// responses of another and invalidating them does not wait on other devices.
+type UserContext struct {
+	// User is the configuration the context was created for; a changed
+	// configuration gets a new context.
+	User config.User
+
+	mu     sync.Mutex
+	client *readeck.Client
+	// history holds the last syncs, oldest first.
+	history []syncRecord
+	// opened holds when the device opened each item it has not left yet.
+	opened map[string]time.Time
+	// synced holds the state of each item as the device last saw it.
+	synced map[string]syncedState
+	// videos holds the videos found in the items the device downloaded.
+	videos map[string]map[string]models.KoboVideo
+
+	// syncResponses caches /api/kobo/get responses; nil when
+	// readeck.sync_cache_ttl is 0.
+	syncResponses *syncCache
+	// bookmarks caches bookmark metadata; nil when
+	// readeck.bookmark_cache_size is 0.
+	bookmarks *bookmarkCache
+	// syncFlights shares running syncs between identical requests.
+	syncFlights singleflight.Group
+}
+
+// readeckClient returns the Readeck client of the device, calling build the
+// first time.
+func (uc *UserContext) readeckClient(build func(*config.User) (*readeck.Client, error)) (*readeck.Client, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if uc.client != nil {
+		return uc.client, nil
+	}
+	client, err := build(&uc.User)
+	if err != nil {
+		return nil, err
+	}
+	uc.client = client
+	return client, nil
+}
+
+// syncRecord is one sync served to a device.
+type syncRecord struct {
+	Time time.Time
+	// Kind is "full", "incremental", "search" or "cached".
+	Kind  string
+	Items int
+}
+
+// recordSync notes a sync of kind that sent items to the device.
+func (uc *UserContext) recordSync(kind string, items int) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.history = append(uc.history, syncRecord{Time: time.Now(), Kind: kind, Items: items})
+	if len(uc.history) > syncHistorySize {
+		uc.history = slices.Delete(uc.history, 0, len(uc.history)-syncHistorySize)
+	}
+}
+
+// LastSync is when the device last synced, or zero.
+func (uc *UserContext) LastSync() time.Time {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if len(uc.history) == 0 {
+		return time.Time{}
+	}
+	return uc.history[len(uc.history)-1].Time
+}
+
+// History returns the last syncs of the device, newest first.
+func (uc *UserContext) History() []syncRecord {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	history := slices.Clone(uc.history)
+	slices.Reverse(history)
+	return history
+}
+
+// invalidate forgets the cached sync responses of the device after a change
+// to its bookmarks.
+func (uc *UserContext) invalidate() {
+	if uc.syncResponses != nil {
+		uc.syncResponses.Invalidate()
+	}
+}
+
+// userContexts holds the UserContext of each device token.
+type userContexts struct {
+	mu                sync.Mutex
+	contexts          map[string]*UserContext
+	syncCacheTTL      time.Duration
+	bookmarkCacheSize int
+}
+
+func newUserContexts(syncCacheTTL time.Duration, bookmarkCacheSize int) *userContexts {
+	return &userContexts{contexts: make(map[string]*UserContext), syncCacheTTL: syncCacheTTL, bookmarkCacheSize: bookmarkCacheSize}
+}
+
+// get returns the context of user, creating it on first use or when the
+// user's configuration changed; the sync history, item states and videos are
+// kept across a change.
+func (c *userContexts) get(user *config.User) *UserContext {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old, ok := c.contexts[user.Token]
+	if ok && reflect.DeepEqual(old.User, *user) {
+		return old
+	}
+	uc := &UserContext{User: *user}
+	if c.syncCacheTTL > 0 {
+		uc.syncResponses = newSyncCache(c.syncCacheTTL)
+	}
+	if c.bookmarkCacheSize > 0 {
+		uc.bookmarks = newBookmarkCache(c.bookmarkCacheSize)
+	}
+	if ok {
+		old.mu.Lock()
+		uc.history = old.history
+		uc.opened = old.opened
+		uc.synced = old.synced
+		uc.videos = old.videos
+		old.mu.Unlock()
+	}
+	c.contexts[user.Token] = uc
+	return uc
+}
+
+// lookup returns the context of deviceToken without creating one.
+func (c *userContexts) lookup(deviceToken string) (*UserContext, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	uc, ok := c.contexts[deviceToken]
+	return uc, ok
+}
+
+// all returns every context created so far.
+func (c *userContexts) all() []*UserContext {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contexts := make([]*UserContext, 0, len(c.contexts))
+	for _, uc := range c.contexts {
+		contexts = append(contexts, uc)
+	}
+	return contexts
+}
+
+// syncCaches shows the sync responses of every device as one cache on the
+// admin dashboard.
+type syncCaches struct {
+	contexts *userContexts
+}
+
+func (c syncCaches) Name() string {
+	return "Sync responses"
+}
+
+func (c syncCaches) Len() int {
+	n := 0
+	for _, uc := range c.contexts.all() {
+		if uc.syncResponses != nil {
+			n += uc.syncResponses.Len()
+		}
+	}
+	return n
+}
+
+func (c syncCaches) Invalidate() {
+	for _, uc := range c.contexts.all() {
+		uc.invalidate()
+	}
+}
+
+type userContextKey struct{}
+
+// AuthMiddleware resolves the device token of a request, from its query,
+// Authorization header or the access_token of a small JSON or form body, to
+// the device's UserContext, which handlers then take from the request's
+// context. Requests it cannot resolve are passed on unchanged, for the
+// handler to reject.
+func (a *App) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestDeviceToken(r)
+		if token == "" {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token == "" && r.Body != nil && r.ContentLength >= 0 && r.ContentLength <= maxAuthPeek {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxAuthPeek+1))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if err == nil && len(body) <= maxAuthPeek {
+				token = bodyAccessToken(r.Header.Get("Content-Type"), body)
+			}
+		}
+		if token != "" {
+			if uc, err := a.authenticate(r.Context(), token); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey{}, uc))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readCloser reads from a peeked body while closing the original one.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyAccessToken returns the access_token of a JSON or form body, or "".
+func bodyAccessToken(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return ""
+		}
+		return values.Get("access_token")
+	}
+	var req struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.AccessToken
+}
+
+// authenticate returns the UserContext of deviceToken: the one AuthMiddleware
+// resolved for the request of ctx, or else the one of the configured user
+// with that token.
+func (a *App) authenticate(ctx context.Context, deviceToken string) (*UserContext, error) {
+	if uc, ok := ctx.Value(userContextKey{}).(*UserContext); ok && uc.User.Token == deviceToken {
+		return uc, nil
+	}
+	user, err := a.getUser(ctx, deviceToken)
+	if err != nil {
+		return nil, err
+	}
+	return a.contexts.get(user), nil
+}
+
+// lastSync is when deviceToken last synced, or zero.
+func (a *App) lastSync(deviceToken string) time.Time {
+	if uc, ok := a.contexts.lookup(deviceToken); ok {
+		return uc.LastSync()
+	}
+	return time.Time{}
+}
+
+// invalidateSyncResponses forgets the cached sync responses of deviceToken
+// after a change to its bookmarks.
+func (a *App) invalidateSyncResponses(deviceToken string) {
+	if uc, ok := a.contexts.lookup(deviceToken); ok {
+		uc.invalidate()
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestUserContextsIsolateSyncCaches(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1"}, "")
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users: []config.User{
+				{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken},
+				{Token: "other-device", ReadeckAccessToken: mockPlaintextReadeckToken},
+			},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, SyncCacheTTL: time.Minute},
+		}),
+		WithLogger(testLogger),
+	)
+
+	for _, token := range []string{mockDeviceToken, "other-device"} {
+		body, _ := json.Marshal(models.KoboGetRequest{AccessToken: token})
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for %s, got %d", token, rr.Code)
+		}
+	}
+
+	own, _ := app.contexts.lookup(mockDeviceToken)
+	other, _ := app.contexts.lookup("other-device")
+	if own == nil || other == nil || own == other {
+		t.Fatal("expected a separate context for each device")
+	}
+	if own.syncResponses.Len() != 1 || other.syncResponses.Len() != 1 {
+		t.Fatalf("expected one cached response per device, got %d and %d", own.syncResponses.Len(), other.syncResponses.Len())
+	}
+	if own.LastSync().IsZero() || app.lastSync("other-device").IsZero() {
+		t.Error("expected the last sync of each device to be recorded")
+	}
+
+	app.invalidateSyncResponses(mockDeviceToken)
+	if own.syncResponses.Len() != 0 || other.syncResponses.Len() != 1 {
+		t.Errorf("expected only the first device's responses to be invalidated, got %d and %d", own.syncResponses.Len(), other.syncResponses.Len())
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: "http://readeck.example.com"},
+		}),
+		WithLogger(testLogger),
+	)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		target      string
+		want        bool
+	}{
+		{name: "json body", contentType: "application/json", body: `{"access_token":"` + mockDeviceToken + `"}`, target: "/api/kobo/get", want: true},
+		{name: "form body", contentType: "application/x-www-form-urlencoded", body: "access_token=" + mockDeviceToken, target: "/api/kobo/download", want: true},
+		{name: "query", target: "/api/save?token=" + mockDeviceToken, want: true},
+		{name: "unknown token", contentType: "application/json", body: `{"access_token":"bogus"}`, target: "/api/kobo/get"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resolved *UserContext
+			var body string
+			handler := app.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resolved, _ = r.Context().Value(userContextKey{}).(*UserContext)
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			}))
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if (resolved != nil) != tt.want {
+				t.Fatalf("expected resolved %v, got %+v", tt.want, resolved)
+			}
+			if resolved != nil && resolved.User.Token != mockDeviceToken {
+				t.Errorf("expected the context of %s, got %s", mockDeviceToken, resolved.User.Token)
+			}
+			if body != tt.body {
+				t.Errorf("expected the handler to read the whole body %q, got %q", tt.body, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"readeckobo/internal/models"
+	"readeckobo/internal/storeapi"
+	"readeckobo/internal/tracing"
+)
+
+// Pocket video types.
+const (
+	videoTypeYouTube = "1"
+	videoTypeVimeo   = "3"
+	videoTypeHTML5   = "4"
+)
+
+// maxQRCodeLength bounds the links /api/qr encodes, in bytes.
+const maxQRCodeLength = 1024
+
+// vimeoOEmbedURL is Vimeo's oEmbed endpoint, which names the thumbnail of a
+// video.
+var vimeoOEmbedURL = "https://vimeo.com/api/oembed.json"
+
+// embeddedVideo describes a video found in an article.
+type embeddedVideo struct {
+	Type      string
+	Vid       string
+	Src       string
+	WatchURL  string
+	Thumbnail string
+}
+
+// videoImages supplies the images of video placeholders; either may be nil.
+type videoImages struct {
+	// thumbnail finds the thumbnail of a video whose embed names none.
+	thumbnail func(video embeddedVideo) string
+	// qrCode returns the URL of an image of link as a QR code.
+	qrCode func(link string) string
+}
+
+// replaceEmbeds swaps video embeds, which the Kobo cannot play, for their
+// thumbnail, a visible link and a QR code to open it on a phone. The images
+// are picked up by the regular image handling, so the Kobo fetches the
+// thumbnail through /api/convert-image.
+func replaceEmbeds(doc *html.Node, baseURL *url.URL, images videoImages) map[string]models.KoboVideo {
+	var embeds []*html.Node
+	seen := make(map[*html.Node]bool)
+	walkElements(doc, func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Iframe, atom.Embed, atom.Object, atom.Video:
+			// An embed nested in an object is the same video.
+			if !hasAncestor(n, seen) {
+				embeds = append(embeds, n)
+				seen[n] = true
+			}
+		}
+	})
+
+	videos := make(map[string]models.KoboVideo)
+	for _, n := range embeds {
+		video, ok := detectVideo(n, baseURL)
+		if !ok {
+			continue
+		}
+		if video.Thumbnail == "" && images.thumbnail != nil {
+			video.Thumbnail = images.thumbnail(video)
+		}
+		var qrCode string
+		if images.qrCode != nil {
+			qrCode = images.qrCode(video.WatchURL)
+		}
+
+		videoID := strconv.Itoa(len(videos) + 1)
+		videos[videoID] = models.KoboVideo{
+			VideoID: videoID,
+			ItemID:  videoID,
+			Src:     video.Src,
+			Width:   "0",
+			Height:  "0",
+			Type:    video.Type,
+			Vid:     video.Vid,
+		}
+
+		n.Parent.InsertBefore(videoPlaceholder(video, qrCode), n)
+		n.Parent.RemoveChild(n)
+	}
+
+	return videos
+}
+
+// recordVideos notes the videos found in item id when the device downloaded
+// it, so that later syncs report the item as having videos.
+func (uc *UserContext) recordVideos(id string, videos map[string]models.KoboVideo) {
+	uc.mu.Lock()
+	_, had := uc.videos[id]
+	if len(videos) == 0 {
+		delete(uc.videos, id)
+	} else {
+		if uc.videos == nil {
+			uc.videos = make(map[string]map[string]models.KoboVideo)
+		}
+		uc.videos[id] = videos
+	}
+	uc.mu.Unlock()
+
+	if had != (len(videos) > 0) {
+		uc.invalidate()
+	}
+}
+
+// markVideos sets has_video and the videos of the items of list whose
+// downloads had videos, and forgets the items deleted from the device.
+func (uc *UserContext) markVideos(list map[string]models.KoboArticleItem) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	for id, item := range list {
+		videos, ok := uc.videos[id]
+		switch {
+		case !ok:
+		case item.Status == "2":
+			delete(uc.videos, id)
+		case item.HasVideo == "0":
+			item.HasVideo = "1"
+			item.Videos = videos
+			list[id] = item
+		}
+	}
+}
+
+// detectVideo recognizes YouTube and Vimeo embeds and HTML5 video elements.
+func detectVideo(n *html.Node, baseURL *url.URL) (embeddedVideo, bool) {
+	src := getAttr(n, "src")
+	if src == "" {
+		src = getAttr(n, "data")
+	}
+	if src == "" && n.DataAtom == atom.Video {
+		walkElements(n, func(c *html.Node) {
+			if src == "" && c.DataAtom == atom.Source {
+				src = getAttr(c, "src")
+			}
+		})
+	}
+	if src == "" {
+		return embeddedVideo{}, false
+	}
+	if strings.HasPrefix(src, "//") {
+		src = "https:" + src
+	}
+
+	u, err := url.Parse(strings.TrimSpace(src))
+	if err != nil {
+		return embeddedVideo{}, false
+	}
+	if baseURL != nil {
+		u = baseURL.ResolveReference(u)
+	}
+
+	if vid := youTubeID(u); vid != "" {
+		return embeddedVideo{
+			Type:      videoTypeYouTube,
+			Vid:       vid,
+			Src:       u.String(),
+			WatchURL:  "https://www.youtube.com/watch?v=" + vid,
+			Thumbnail: "https://img.youtube.com/vi/" + vid + "/hqdefault.jpg",
+		}, true
+	}
+	if vid := vimeoID(u); vid != "" {
+		return embeddedVideo{
+			Type:     videoTypeVimeo,
+			Vid:      vid,
+			Src:      u.String(),
+			WatchURL: "https://vimeo.com/" + vid,
+		}, true
+	}
+	if n.DataAtom == atom.Video {
+		video := embeddedVideo{
+			Type:     videoTypeHTML5,
+			Src:      u.String(),
+			WatchURL: u.String(),
+		}
+		if poster := getAttr(n, "poster"); poster != "" {
+			if p, err := url.Parse(poster); err == nil && baseURL != nil {
+				poster = baseURL.ResolveReference(p).String()
+			}
+			video.Thumbnail = poster
+		}
+		return video, true
+	}
+
+	return embeddedVideo{}, false
+}
+
+// videoTypeFor returns the Pocket video type for a video page URL.
+func videoTypeFor(videoURL string) string {
+	u, err := url.Parse(videoURL)
+	if err != nil {
+		return videoTypeHTML5
+	}
+	if youTubeID(u) != "" {
+		return videoTypeYouTube
+	}
+	if vimeoID(u) != "" {
+		return videoTypeVimeo
+	}
+	return videoTypeHTML5
+}
+
+func youTubeID(u *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch host {
+	case "youtu.be":
+		return segments[0]
+	case "youtube.com", "youtube-nocookie.com":
+		if len(segments) >= 2 && (segments[0] == "embed" || segments[0] == "v" || segments[0] == "shorts") {
+			return segments[1]
+		}
+		if segments[0] == "watch" {
+			return u.Query().Get("v")
+		}
+	}
+	return ""
+}
+
+func vimeoID(u *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch host {
+	case "player.vimeo.com":
+		if len(segments) >= 2 && segments[0] == "video" {
+			return segments[1]
+		}
+	case "vimeo.com":
+		if _, err := strconv.Atoi(segments[0]); err == nil {
+			return segments[0]
+		}
+	}
+	return ""
+}
+
+// videoPlaceholder builds the thumbnail, link and QR code that stand in for a
+// video.
+func videoPlaceholder(video embeddedVideo, qrCode string) *html.Node {
+	container := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+
+	if video.Thumbnail != "" {
+		img := &html.Node{Type: html.ElementNode, Data: "img", DataAtom: atom.Img}
+		setAttr(img, "src", video.Thumbnail)
+		setAttr(img, "alt", "Video thumbnail")
+		container.AppendChild(img)
+	}
+
+	link := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A}
+	setAttr(link, "href", video.WatchURL)
+	link.AppendChild(&html.Node{Type: html.TextNode, Data: "Watch video: " + video.WatchURL})
+
+	p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+	p.AppendChild(link)
+	container.AppendChild(p)
+
+	if qrCode != "" {
+		img := &html.Node{Type: html.ElementNode, Data: "img", DataAtom: atom.Img}
+		setAttr(img, "src", qrCode)
+		setAttr(img, "alt", "QR code of the video link")
+		setAttr(img, "class", qrCodeClass)
+		container.AppendChild(img)
+	}
+
+	return container
+}
+
+// qrCodeClass marks the QR code images of video placeholders.
+const qrCodeClass = "qr-code"
+
+// isQRCodeImage reports whether img is the QR code of a video.
+func isQRCodeImage(img *html.Node) bool {
+	return slices.Contains(strings.Fields(getAttr(img, "class")), qrCodeClass)
+}
+
+// videoImages returns the images of the video placeholders of an article
+// downloaded by r.
+func (a *App) videoImages(r *http.Request) videoImages {
+	return videoImages{
+		thumbnail: func(video embeddedVideo) string {
+			if video.Type != videoTypeVimeo {
+				return ""
+			}
+			thumbnail, err := a.vimeoThumbnail(r.Context(), video.WatchURL)
+			if err != nil {
+				a.Logger.Warnf("Error fetching the thumbnail of %s: %v, URL: %s, Params: %v", video.WatchURL, err, r.URL.Path, r.URL.Query())
+			}
+			return thumbnail
+		},
+		qrCode: func(link string) string {
+			if len(link) > maxQRCodeLength {
+				return ""
+			}
+			return a.bridgeURL(r) + storeapi.InstapaperPath + "/api/qr?" + url.Values{"data": {link}}.Encode()
+		},
+	}
+}
+
+// vimeoThumbnail asks Vimeo's oEmbed endpoint for the thumbnail of the video
+// at watchURL, since Vimeo embeds, unlike YouTube's, have no predictable
+// thumbnail URL.
+func (a *App) vimeoThumbnail(ctx context.Context, watchURL string) (string, error) {
+	client := a.ImageHTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	ctx, span := tracing.Start(ctx, "video.thumbnail")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, vimeoOEmbedURL+"?"+url.Values{"url": {watchURL}}.Encode(), nil)
+	if err != nil {
+		tracing.End(span, err)
+		return "", err
+	}
+	resp, err := client.Do(req)
+	tracing.End(span, err)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var oembed struct {
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&oembed); err != nil {
+		return "", fmt.Errorf("failed to decode oEmbed response: %w", err)
+	}
+	return oembed.ThumbnailURL, nil
+}
+
+// HandleQRCode draws the link in the data parameter as a QR code, for the
+// video placeholders of downloaded articles.
+func (a *App) HandleQRCode(w http.ResponseWriter, r *http.Request) {
+	data := r.URL.Query().Get("data")
+	if data == "" {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Missing 'data' parameter")
+		return
+	}
+	if len(data) > maxQRCodeLength {
+		writeKoboError(w, http.StatusBadRequest, pocketErrInvalidRequest, "Data too long")
+		return
+	}
+
+	code, err := qrcode.New(data, qrcode.Medium)
+	if err != nil {
+		writeKoboError(w, http.StatusInternalServerError, pocketErrServer, "Failed to encode QR code")
+		a.Logger.Errorf("Error encoding QR code in /api/qr: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+		return
+	}
+	src := code.Image(256)
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	a.writeDrawnImage(w, r, img, "/api/qr")
+}
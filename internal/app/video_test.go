@@ -0,0 +1,175 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+)
+
+func TestReplaceEmbeds(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/post")
+
+	testCases := []struct {
+		name          string
+		input         string
+		expected      string
+		expectedVideo *models.KoboVideo
+	}{
+		{
+			name:     "youtube iframe",
+			input:    `<iframe src="//www.youtube-nocookie.com/embed/abc123?rel=0"></iframe>`,
+			expected: `<div><img src="https://img.youtube.com/vi/abc123/hqdefault.jpg" alt="Video thumbnail"/><p><a href="https://www.youtube.com/watch?v=abc123">Watch video: https://www.youtube.com/watch?v=abc123</a></p></div>`,
+			expectedVideo: &models.KoboVideo{
+				VideoID: "1", ItemID: "1", Src: "https://www.youtube-nocookie.com/embed/abc123?rel=0",
+				Width: "0", Height: "0", Type: videoTypeYouTube, Vid: "abc123",
+			},
+		},
+		{
+			name:     "vimeo iframe",
+			input:    `<iframe src="https://player.vimeo.com/video/42"></iframe>`,
+			expected: `<div><p><a href="https://vimeo.com/42">Watch video: https://vimeo.com/42</a></p></div>`,
+			expectedVideo: &models.KoboVideo{
+				VideoID: "1", ItemID: "1", Src: "https://player.vimeo.com/video/42",
+				Width: "0", Height: "0", Type: videoTypeVimeo, Vid: "42",
+			},
+		},
+		{
+			name:     "html5 video with poster",
+			input:    `<video poster="/poster.jpg"><source src="/clip.mp4"></video>`,
+			expected: `<div><img src="https://example.com/poster.jpg" alt="Video thumbnail"/><p><a href="https://example.com/clip.mp4">Watch video: https://example.com/clip.mp4</a></p></div>`,
+			expectedVideo: &models.KoboVideo{
+				VideoID: "1", ItemID: "1", Src: "https://example.com/clip.mp4",
+				Width: "0", Height: "0", Type: videoTypeHTML5,
+			},
+		},
+		{
+			name:     "unrelated iframe is left alone",
+			input:    `<iframe src="https://ads.example.com/banner"></iframe>`,
+			expected: `<iframe src="https://ads.example.com/banner"></iframe>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var videos map[string]models.KoboVideo
+			got := renderArticle(t, tc.input, func(doc *html.Node) { videos = replaceEmbeds(doc, baseURL, videoImages{}) })
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+
+			if tc.expectedVideo == nil {
+				if len(videos) != 0 {
+					t.Errorf("expected no videos, got %+v", videos)
+				}
+				return
+			}
+			if videos["1"] != *tc.expectedVideo {
+				t.Errorf("expected video %+v, got %+v", *tc.expectedVideo, videos["1"])
+			}
+		})
+	}
+}
+
+func TestReplaceEmbedsWithImages(t *testing.T) {
+	images := videoImages{
+		thumbnail: func(video embeddedVideo) string { return "https://i.vimeocdn.com/" + video.Vid + ".jpg" },
+		qrCode:    func(link string) string { return "https://bridge/api/qr?" + url.Values{"data": {link}}.Encode() },
+	}
+	input := `<iframe src="https://player.vimeo.com/video/42"></iframe>`
+	expected := `<div><img src="https://i.vimeocdn.com/42.jpg" alt="Video thumbnail"/>` +
+		`<p><a href="https://vimeo.com/42">Watch video: https://vimeo.com/42</a></p>` +
+		`<img src="https://bridge/api/qr?data=https%3A%2F%2Fvimeo.com%2F42" alt="QR code of the video link" class="qr-code"/></div>`
+
+	got := renderArticle(t, input, func(doc *html.Node) { replaceEmbeds(doc, nil, images) })
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestVimeoThumbnail(t *testing.T) {
+	oembed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("url"); got != "https://vimeo.com/42" {
+			t.Errorf("expected the oEmbed of https://vimeo.com/42, got %q", got)
+		}
+		_, _ = w.Write([]byte(`{"type":"video","thumbnail_url":"https://i.vimeocdn.com/video/42.jpg"}`))
+	}))
+	defer oembed.Close()
+	defer func(old string) { vimeoOEmbedURL = old }(vimeoOEmbedURL)
+	vimeoOEmbedURL = oembed.URL
+
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger))
+	thumbnail, err := app.vimeoThumbnail(t.Context(), "https://vimeo.com/42")
+	if err != nil || thumbnail != "https://i.vimeocdn.com/video/42.jpg" {
+		t.Errorf("expected the oEmbed thumbnail, got %q, %v", thumbnail, err)
+	}
+}
+
+func TestHandleQRCode(t *testing.T) {
+	app := NewApp(WithConfig(&config.Config{}), WithLogger(testLogger))
+
+	rr := httptest.NewRecorder()
+	app.HandleQRCode(rr, httptest.NewRequest(http.MethodGet, "/api/qr?data="+url.QueryEscape("https://vimeo.com/42"), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if _, err := png.Decode(rr.Body); err != nil {
+		t.Errorf("expected a PNG QR code: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandleQRCode(rr, httptest.NewRequest(http.MethodGet, "/api/qr", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without data, got %d", rr.Code)
+	}
+}
+
+func TestSyncReportsDownloadedVideos(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "One"},
+		`<p>Watch</p><iframe src="https://www.youtube.com/embed/abc123"></iframe>`)
+
+	app := NewApp(
+		WithConfig(&config.Config{
+			Users:   []config.User{{Token: mockDeviceToken, ReadeckAccessToken: mockPlaintextReadeckToken}},
+			Readeck: config.ConfigReadeck{Host: mockServer.URL, SyncCacheTTL: time.Minute},
+		}),
+		WithLogger(testLogger),
+	)
+	get := func() models.KoboArticleItem {
+		t.Helper()
+		body, _ := json.Marshal(models.KoboGetRequest{AccessToken: mockDeviceToken})
+		rr := httptest.NewRecorder()
+		app.HandleKoboGet(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/get", bytes.NewReader(body)))
+		var resp models.KoboGetResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.List["1"]
+	}
+
+	if item := get(); item.HasVideo != "0" {
+		t.Errorf("expected has_video 0 before the download, got %q", item.HasVideo)
+	}
+	body, _ := json.Marshal(models.KoboDownloadRequest{AccessToken: mockDeviceToken, URL: "https://example.com/1"})
+	rr := httptest.NewRecorder()
+	app.HandleKoboDownload(rr, httptest.NewRequest(http.MethodPost, "/api/kobo/download", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 from the download, got %d", rr.Code)
+	}
+	if item := get(); item.HasVideo != "1" || item.Videos["1"].Vid != "abc123" {
+		t.Errorf("expected has_video 1 and the video after the download, got %q and %+v", item.HasVideo, item.Videos)
+	}
+}
@@ -0,0 +1,316 @@
+// Package capture records Kobo requests, their responses and the Readeck
+// calls made to answer them, with secrets scrubbed, so that traffic from a
+// real device can be replayed through the handlers as a regression test.
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"readeckobo/internal/logger"
+)
+
+// Token replaces device tokens and other secrets in captures. Replays
+// authenticate a device with it.
+const Token = "captured-device-token"
+
+// maxBodyBytes bounds each body kept in a capture.
+const maxBodyBytes = 16 << 20
+
+// maxRecentBodyBytes bounds each body of the captures kept in memory.
+const maxRecentBodyBytes = 64 << 10
+
+// droppedHeaders are never written to a capture.
+var droppedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Forwarded-For", "X-Real-Ip", "Forwarded"}
+
+// Message is one side of a recorded HTTP exchange.
+type Message struct {
+	Method string      `json:"method,omitempty"`
+	URL    string      `json:"url,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Exchange is a request and its response.
+type Exchange struct {
+	Request  Message `json:"request"`
+	Response Message `json:"response"`
+}
+
+// Capture is one Kobo request along with the Readeck calls made to answer it.
+type Capture struct {
+	Time  time.Time `json:"time"`
+	Route string    `json:"route"`
+	// ReadeckHost is the scheme and host of the Readeck server, which a
+	// replay must use for resource URLs to come out the same.
+	ReadeckHost string     `json:"readeck_host,omitempty"`
+	Kobo        Exchange   `json:"kobo"`
+	Readeck     []Exchange `json:"readeck,omitempty"`
+
+	mu sync.Mutex
+}
+
+type contextKey struct{}
+
+// Recorder writes a capture file for each request passing through its
+// middleware, and keeps the last ones in memory for the admin dashboard.
+type Recorder struct {
+	dir    string
+	logger *logger.Logger
+	seq    atomic.Uint64
+	// Secrets returns the tokens and passwords to scrub from captures.
+	Secrets func() []string
+
+	mu sync.Mutex
+	// recent is a ring of the last captures, with next the oldest slot.
+	recent []*Capture
+	next   int
+}
+
+// NewRecorder creates dir if needed and returns a recorder writing to it.
+// With an empty dir, captures are only kept in memory, see KeepRecent.
+func NewRecorder(dir string, logger *logger.Logger) (*Recorder, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create capture directory: %w", err)
+		}
+	}
+	return &Recorder{dir: dir, logger: logger}, nil
+}
+
+// KeepRecent keeps the last n captures in memory, with their bodies
+// truncated; 0 keeps none.
+func (rec *Recorder) KeepRecent(n int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.recent = make([]*Capture, n)
+	rec.next = 0
+}
+
+// Recent returns the captures kept in memory, newest first.
+func (rec *Recorder) Recent() []*Capture {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var captures []*Capture
+	for i := range rec.recent {
+		c := rec.recent[(rec.next-1-i+2*len(rec.recent))%len(rec.recent)]
+		if c == nil {
+			break
+		}
+		captures = append(captures, c)
+	}
+	return captures
+}
+
+// Middleware records the requests to next under route.
+func (rec *Recorder) Middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		c := &Capture{
+			Time:  time.Now().UTC(),
+			Route: route,
+			Kobo: Exchange{Request: Message{
+				Method: r.Method,
+				URL:    requestURL(r),
+				Header: r.Header.Clone(),
+				Body:   limitBody(body),
+			}},
+		}
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), contextKey{}, c)))
+
+		c.Kobo.Response = Message{Status: cw.status, Header: w.Header().Clone(), Body: limitBody(cw.body.Bytes())}
+		rec.scrub(c)
+		rec.keep(c)
+		if rec.dir == "" {
+			return
+		}
+		if err := rec.write(c); err != nil {
+			rec.logger.Warnf("Error writing capture of %s: %v", route, err)
+		}
+	})
+}
+
+// Transport records the Readeck calls made while answering a captured
+// request. Other requests pass through to base untouched.
+func (rec *Recorder) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		c, ok := req.Context().Value(contextKey{}).(*Capture)
+		if !ok {
+			return base.RoundTrip(req)
+		}
+
+		var reqBody []byte
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				reqBody, _ = io.ReadAll(body)
+				_ = body.Close()
+			}
+		}
+		resp, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+		c.mu.Lock()
+		c.ReadeckHost = req.URL.Scheme + "://" + req.URL.Host
+		c.Readeck = append(c.Readeck, Exchange{
+			Request:  Message{Method: req.Method, URL: req.URL.RequestURI(), Header: req.Header.Clone(), Body: limitBody(reqBody)},
+			Response: Message{Status: resp.StatusCode, Header: resp.Header.Clone(), Body: limitBody(respBody)},
+		})
+		c.mu.Unlock()
+		return resp, nil
+	})
+}
+
+// scrub drops the secrets of c.
+func (rec *Recorder) scrub(c *Capture) {
+	var secrets []string
+	if rec.Secrets != nil {
+		secrets = rec.Secrets()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scrubExchange(&c.Kobo, secrets)
+	for i := range c.Readeck {
+		scrubExchange(&c.Readeck[i], secrets)
+	}
+}
+
+// keep adds a copy of c with truncated bodies to the recent captures.
+func (rec *Recorder) keep(c *Capture) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.recent) == 0 {
+		return
+	}
+	c.mu.Lock()
+	kept := &Capture{Time: c.Time, Route: c.Route, ReadeckHost: c.ReadeckHost, Kobo: truncateExchange(c.Kobo)}
+	for _, e := range c.Readeck {
+		kept.Readeck = append(kept.Readeck, truncateExchange(e))
+	}
+	c.mu.Unlock()
+	rec.recent[rec.next] = kept
+	rec.next = (rec.next + 1) % len(rec.recent)
+}
+
+func truncateExchange(e Exchange) Exchange {
+	for _, m := range []*Message{&e.Request, &e.Response} {
+		if len(m.Body) > maxRecentBodyBytes {
+			m.Body = strings.ToValidUTF8(m.Body[:maxRecentBodyBytes], "")
+		}
+	}
+	return e
+}
+
+// write saves c as a new file in the capture directory.
+func (rec *Recorder) write(c *Capture) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode capture: %w", err)
+	}
+	name := fmt.Sprintf("%s-%04d-%s.json", c.Time.Format("20060102T150405"), rec.seq.Add(1)%10000, strings.ReplaceAll(c.Route, ".", "-"))
+	if err := os.WriteFile(filepath.Join(rec.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	return nil
+}
+
+// scrubExchange drops sensitive headers and replaces secrets with Token.
+func scrubExchange(e *Exchange, secrets []string) {
+	for _, m := range []*Message{&e.Request, &e.Response} {
+		for _, name := range droppedHeaders {
+			m.Header.Del(name)
+		}
+		m.URL = scrub(m.URL, secrets)
+		m.Body = scrub(m.Body, secrets)
+		for name, values := range m.Header {
+			for i := range values {
+				values[i] = scrub(values[i], secrets)
+			}
+			m.Header[name] = values
+		}
+	}
+}
+
+func scrub(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Token)
+		}
+	}
+	return s
+}
+
+// requestURL is the URL the client asked for, including the host, which the
+// handlers use to build links back to readeckobo.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+func limitBody(body []byte) string {
+	if len(body) > maxBodyBytes {
+		return string(body[:maxBodyBytes])
+	}
+	return string(body)
+}
+
+// captureWriter keeps a copy of the response written through it.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if w.body.Len() < maxBodyBytes {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController flush the underlying writer.
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,112 @@
+package capture
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/logger"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"title":"from readeck"}`))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, logger.New(logger.DEBUG))
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	rec.Secrets = func() []string { return []string{"secret-device-token"} }
+
+	// handler echoes the token and fetches from the backend, like the Kobo
+	// handlers do with Readeck.
+	newHandler := func(client *http.Client, backendURL string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, backendURL+"/api/bookmarks?limit=1", nil)
+			req.Header.Set("Authorization", "Bearer readeck-token")
+			resp, err := client.Do(req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+			fromBackend, _ := io.ReadAll(resp.Body)
+			token := strings.TrimPrefix(string(body), "token=")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"token":"` + token + `","link":"/api/resource?device=abc123&sig=def456","backend":` + string(fromBackend) + `}`))
+		})
+	}
+
+	client := &http.Client{Transport: rec.Transport(nil)}
+	req := httptest.NewRequest(http.MethodPost, "http://kobo.example.com/api/kobo/get", strings.NewReader("token=secret-device-token"))
+	req.Header.Set("Cookie", "session=1")
+	rec.Middleware("kobo.get", newHandler(client, backend.URL)).ServeHTTP(httptest.NewRecorder(), req)
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*-kobo-get.json"))
+	if len(paths) != 1 {
+		t.Fatalf("expected one capture file, got %v", paths)
+	}
+	data, _ := os.ReadFile(paths[0])
+	for _, leaked := range []string{"secret-device-token", "readeck-token", "session=1"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("expected %q to be scrubbed from the capture", leaked)
+		}
+	}
+
+	c, err := Load(paths[0])
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(c.Readeck) != 1 || c.Readeck[0].Request.URL != "/api/bookmarks?limit=1" || c.ReadeckHost != backend.URL {
+		t.Fatalf("expected the backend call to be recorded, got %+v", c.Readeck)
+	}
+
+	// The replay reaches no backend, and signatures may differ.
+	replayClient := &http.Client{Transport: c.Transport()}
+	c.Kobo.Response.Body = strings.Replace(c.Kobo.Response.Body, "sig=def456", "sig=other", 1)
+	if err := c.Replay(newHandler(replayClient, "http://readeck.invalid")); err != nil {
+		t.Errorf("expected the replay to match, got %v", err)
+	}
+
+	c.Kobo.Response.Body = strings.Replace(c.Kobo.Response.Body, "from readeck", "changed", 1)
+	if err := c.Replay(newHandler(&http.Client{Transport: c.Transport()}, "http://readeck.invalid")); err == nil {
+		t.Error("expected a changed response to be reported")
+	}
+}
+
+func TestRecent(t *testing.T) {
+	rec, err := NewRecorder("", logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	rec.KeepRecent(2)
+	rec.Secrets = func() []string { return []string{"secret-device-token"} }
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", maxRecentBodyBytes+10)))
+	})
+	for _, route := range []string{"kobo.get", "kobo.download", "kobo.send"} {
+		req := httptest.NewRequest(http.MethodPost, "http://kobo.example.com/api/kobo?access_token=secret-device-token", nil)
+		rec.Middleware(route, handler).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recent := rec.Recent()
+	if len(recent) != 2 || recent[0].Route != "kobo.send" || recent[1].Route != "kobo.download" {
+		t.Fatalf("expected the last two captures newest first, got %d", len(recent))
+	}
+	if strings.Contains(recent[0].Kobo.Request.URL, "secret-device-token") {
+		t.Errorf("expected the token to be scrubbed, got %q", recent[0].Kobo.Request.URL)
+	}
+	if len(recent[0].Kobo.Response.Body) != maxRecentBodyBytes {
+		t.Errorf("expected the body to be cut at %d bytes, got %d", maxRecentBodyBytes, len(recent[0].Kobo.Response.Body))
+	}
+}
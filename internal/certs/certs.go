@@ -0,0 +1,202 @@
+// Package certs keeps a local certificate authority and the certificates it
+// issues for the Kobo hosts readeckobo answers for, so a device whose DNS
+// points those hosts at readeckobo can reach it over HTTPS once the
+// authority is installed on it.
+package certs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files of the authority in the certificates directory. Each host has
+// <host>.pem and <host>-key.pem next to them.
+const (
+	caCertFile = "ca.pem"
+	caKeyFile  = "ca-key.pem"
+)
+
+const (
+	caValidity = 10 * 365 * 24 * time.Hour
+	// hostValidity is the longest that clients accept.
+	hostValidity = 397 * 24 * time.Hour
+	// renewBefore is how long before expiry a host certificate is replaced.
+	renewBefore = 30 * 24 * time.Hour
+	keyBits     = 2048
+)
+
+// Authority is the local certificate authority and its host certificates.
+type Authority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+	// hosts are in the order of the configuration; the first one answers
+	// clients that name no host.
+	hosts []string
+	certs map[string]*tls.Certificate
+}
+
+// Load loads the authority and the certificates of hosts from dir, creating
+// the ones missing and renewing those about to expire.
+func Load(dir string, hosts []string) (*Authority, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create certificates directory: %w", err)
+	}
+	a := &Authority{certs: make(map[string]*tls.Certificate)}
+	if err := a.loadCA(dir); err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		cert, err := a.loadHost(dir, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate for %s: %w", host, err)
+		}
+		a.hosts = append(a.hosts, host)
+		a.certs[host] = cert
+	}
+	return a, nil
+}
+
+// CertPEM returns the authority's certificate, for devices to install.
+func (a *Authority) CertPEM() []byte {
+	return a.certPEM
+}
+
+// Hosts returns the hosts with a certificate.
+func (a *Authority) Hosts() []string {
+	return a.hosts
+}
+
+// GetCertificate returns the certificate of the host the client asks for,
+// for tls.Config.
+func (a *Authority) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert, ok := a.certs[strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))]; ok {
+		return cert, nil
+	}
+	if hello.ServerName == "" && len(a.hosts) > 0 {
+		return a.certs[a.hosts[0]], nil
+	}
+	return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+}
+
+func (a *Authority) loadCA(dir string) error {
+	certPath, keyPath := filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile)
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		pair, err = a.createCA(certPath, keyPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load certificate authority: %w", err)
+	}
+	a.cert = pair.Leaf
+	a.certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Certificate[0]})
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("certificate authority key cannot sign")
+	}
+	a.key = signer
+	return nil
+}
+
+func (a *Authority) createCA(certPath, keyPath string) (tls.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "readeckobo local CA", Organization: []string{"readeckobo"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return writePair(certPath, keyPath, der, key)
+}
+
+// loadHost returns the certificate of host, issuing a new one when there is
+// none, it is about to expire or another authority issued it.
+func (a *Authority) loadHost(dir, host string) (*tls.Certificate, error) {
+	certPath, keyPath := filepath.Join(dir, host+".pem"), filepath.Join(dir, host+"-key.pem")
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil && time.Until(pair.Leaf.NotAfter) > renewBefore && pair.Leaf.CheckSignatureFrom(a.cert) == nil && pair.Leaf.VerifyHostname(host) == nil {
+		return &pair, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(hostValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		return nil, err
+	}
+	pair, err = writePair(certPath, keyPath, der, key)
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// writePair writes a certificate and its key as PEM files and returns them
+// as a tls.Certificate.
+func writePair(certPath, keyPath string, der []byte, key crypto.Signer) (tls.Certificate, error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,111 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	ca, err := Load(dir, []string{"storeapi.kobo.com", "GetPocket.com"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca.CertPEM()) {
+		t.Fatal("CertPEM() is not a PEM certificate")
+	}
+	for _, host := range []string{"storeapi.kobo.com", "getpocket.com"} {
+		cert, err := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+		if err != nil {
+			t.Fatalf("GetCertificate(%s) error = %v", host, err)
+		}
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: pool}); err != nil {
+			t.Errorf("certificate of %s does not verify: %v", host, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, caKeyFile)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("CA key file = %v, %v; want mode 0600", info, err)
+	}
+
+	// A second load keeps the authority and the certificates.
+	again, err := Load(dir, []string{"storeapi.kobo.com"})
+	if err != nil {
+		t.Fatalf("second Load() error = %v", err)
+	}
+	if !bytes.Equal(again.CertPEM(), ca.CertPEM()) {
+		t.Error("second Load() created a new authority")
+	}
+	first, _ := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: "storeapi.kobo.com"})
+	second, _ := again.GetCertificate(&tls.ClientHelloInfo{ServerName: "storeapi.kobo.com"})
+	if !bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Error("second Load() issued a new host certificate")
+	}
+}
+
+func TestLoadReissuesForeignCertificate(t *testing.T) {
+	dir, otherDir := t.TempDir(), t.TempDir()
+	if _, err := Load(otherDir, []string{"storeapi.kobo.com"}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	// The host certificate of another authority is replaced.
+	for _, name := range []string{"storeapi.kobo.com.pem", "storeapi.kobo.com-key.pem"} {
+		data, err := os.ReadFile(filepath.Join(otherDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	ca, err := Load(dir, []string{"storeapi.kobo.com"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cert, _ := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: "storeapi.kobo.com"})
+	if err := cert.Leaf.CheckSignatureFrom(ca.cert); err != nil {
+		t.Errorf("host certificate was not reissued: %v", err)
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	ca, err := Load(t.TempDir(), []string{"storeapi.kobo.com", "getpocket.com"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		serverName string
+		wantHost   string
+	}{
+		{name: "named host", serverName: "getpocket.com", wantHost: "getpocket.com"},
+		{name: "named host in another case", serverName: "GETPOCKET.com.", wantHost: "getpocket.com"},
+		{name: "no name uses the first host", serverName: "", wantHost: "storeapi.kobo.com"},
+		{name: "unknown host", serverName: "example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cert, err := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: tc.serverName})
+			if tc.wantHost == "" {
+				if err == nil {
+					t.Error("expected an error for an unknown host")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCertificate() error = %v", err)
+			}
+			if err := cert.Leaf.VerifyHostname(tc.wantHost); err != nil {
+				t.Errorf("certificate is not for %s: %v", tc.wantHost, err)
+			}
+		})
+	}
+}
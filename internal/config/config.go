@@ -3,37 +3,616 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 type User struct {
 	Token              string `koanf:"token" validate:"required"`
-	ReadeckAccessToken string `koanf:"readeck_access_token" validate:"required"`
+	ReadeckAccessToken string `koanf:"readeck_access_token" validate:"required_without=ReadeckUsername"`
+	// ReadeckUsername and ReadeckPassword let readeckobo obtain a new token
+	// when the current one is rejected.
+	ReadeckUsername string `koanf:"readeck_username"`
+	ReadeckPassword string `koanf:"readeck_password" validate:"required_with=ReadeckUsername"`
+	// Collections limits the device to the bookmarks of these Readeck
+	// collections, matched by name.
+	Collections []string `koanf:"collections"`
+	// MaxItems, MaxArticleAgeDays and MinWordCount bound the unread items
+	// sent to the device to the newest, recent and long enough ones; 0
+	// disables a limit.
+	MaxItems          int `koanf:"max_items" validate:"min=0"`
+	MaxArticleAgeDays int `koanf:"max_article_age_days" validate:"min=0"`
+	MinWordCount      int `koanf:"min_word_count" validate:"min=0"`
+	// AddLabels are added to the bookmarks of URLs added from the device,
+	// and AddArchived files them in the archive instead of the unread list.
+	AddLabels   []string `koanf:"add_labels" validate:"dive,required"`
+	AddArchived bool     `koanf:"add_archived"`
+	// DeleteAction is what deleting an item on the device does in Readeck:
+	// "delete" (the default), "archive", or "label:<name>" to archive the
+	// bookmark and add the label, e.g. "label:trash".
+	DeleteAction string `koanf:"delete_action" validate:"omitempty,oneof=delete archive|startswith=label:"`
+	// ArchiveOnFinish archives a bookmark once the device has read at least
+	// this percentage of it, like Pocket's archive-on-read; 0 disables it.
+	ArchiveOnFinish int `koanf:"archive_on_finish" validate:"min=0,max=100"`
+	// SyncArchived sends archived bookmarks to the device's Archive tab; it
+	// is on unless set to false, which also removes bookmarks from the
+	// device once they are archived in Readeck.
+	SyncArchived *bool `koanf:"sync_archived"`
+	// Labels limits the unread items sent to the device to the bookmarks
+	// with at least one of these labels.
+	Labels []string `koanf:"labels" validate:"dive,required"`
+	// ImageQuality overrides the JPEG quality of the device profile for the
+	// images of downloaded articles; 0 keeps the profile's.
+	ImageQuality int `koanf:"image_quality" validate:"min=0,max=100"`
+	// MaxImages overrides download.max_images for the device; 0 keeps it.
+	MaxImages int `koanf:"max_images" validate:"min=0"`
+	// DeviceProfile names the device profile, by model, used for the device
+	// whatever its User-Agent.
+	DeviceProfile string `koanf:"device_profile"`
+	// Typography rewrites the text of the articles sent to the device.
+	Typography Typography `koanf:"typography"`
+}
+
+// SyncsArchived reports whether archived bookmarks are sent to the device.
+func (u *User) SyncsArchived() bool {
+	return u.SyncArchived == nil || *u.SyncArchived
+}
+
+// Typography are optional rewrites of article text and images for reading
+// on the device; all are off by default.
+type Typography struct {
+	// SmartQuotes turns straight quotes and apostrophes into curly ones.
+	SmartQuotes bool `koanf:"smart_quotes"`
+	// NormalizeDashes turns "--" and hyphens between spaces into em dashes.
+	NormalizeDashes bool `koanf:"normalize_dashes"`
+	// Hyphenate adds soft hyphens to long words, so that the reader can
+	// break them at line ends.
+	Hyphenate bool `koanf:"hyphenate"`
+	// MinImageWidth drops images whose width attribute is below this many
+	// pixels, such as icons and tracking pixels; 0 keeps all.
+	MinImageWidth int `koanf:"min_image_width" validate:"min=0"`
+	// RemoveDropCaps joins a drop cap at the start of the first paragraph
+	// back to its word.
+	RemoveDropCaps bool `koanf:"remove_drop_caps"`
+	// CodeBlocks rewrites code blocks, which the device's renderer does not
+	// wrap: "wrap" sets them as monospace text with wrapping hints, and
+	// "image" also draws the blocks with long lines as images.
+	CodeBlocks string `koanf:"code_blocks" validate:"omitempty,oneof=wrap image"`
+	// CodeLineLength is the longest line, in characters, of a code block
+	// left as text with code_blocks set to "image"; 0 means 60.
+	CodeLineLength int `koanf:"code_line_length" validate:"min=0"`
 }
 
 type ConfigReadeck struct {
-	Host string `koanf:"host" validate:"required,url"`
+	Host              string `koanf:"host" validate:"required,url"`
+	DetailConcurrency int    `koanf:"detail_concurrency" validate:"min=1,max=32"`
+	// SendConcurrency bounds the parallel bookmark changes made for one
+	// /api/kobo/send request.
+	SendConcurrency int `koanf:"send_concurrency" validate:"min=1,max=32"`
+	// ArticleCacheSize is how many article bodies are kept in memory; 0
+	// disables the cache.
+	ArticleCacheSize int `koanf:"article_cache_size" validate:"min=0"`
+	// BookmarkCacheSize is how many bookmarks' metadata is kept in memory
+	// for each device, sparing downloads and syncs a Readeck request; 0
+	// disables the cache.
+	BookmarkCacheSize int `koanf:"bookmark_cache_size" validate:"min=0"`
+	// SyncCacheTTL is how long a device's sync response is reused for an
+	// identical request; 0 disables the cache.
+	SyncCacheTTL time.Duration `koanf:"sync_cache_ttl" validate:"min=0"`
+	// CollectionTags adds a "collection:<name>" tag to synced items for each
+	// Readeck collection that includes them.
+	CollectionTags bool `koanf:"collection_tags"`
+	// ExcludeTypes leaves bookmarks of these kinds out of sync, as they
+	// render poorly on the Kobo.
+	ExcludeTypes []string              `koanf:"exclude_types" validate:"dive,oneof=article photo video pdf"`
+	Timeouts     ConfigReadeckTimeouts `koanf:"timeouts"`
+	// StrictDecoding fails on Readeck responses with fields readeckobo does
+	// not know, to diagnose an unsupported Readeck version.
+	StrictDecoding bool                   `koanf:"strict_decoding"`
+	TLS            ConfigReadeckTLS       `koanf:"tls"`
+	Proxy          ConfigProxy            `koanf:"proxy"`
+	Transport      ConfigReadeckTransport `koanf:"transport"`
+	RateLimit      ConfigReadeckRateLimit `koanf:"rate_limit"`
+}
+
+// ConfigReadeckRateLimit paces the requests made to Readeck, across all
+// devices and for each device; a rate of 0 is unlimited.
+type ConfigReadeckRateLimit struct {
+	RequestsPerSecond float64 `koanf:"requests_per_second" validate:"min=0"`
+	Burst             int     `koanf:"burst" validate:"min=0"`
+	// PerUserRequestsPerSecond and PerUserBurst apply to each device.
+	PerUserRequestsPerSecond float64 `koanf:"per_user_requests_per_second" validate:"min=0"`
+	PerUserBurst             int     `koanf:"per_user_burst" validate:"min=0"`
+}
+
+// ConfigProxy selects the outbound proxy for one kind of request.
+type ConfigProxy struct {
+	// URL is the proxy to use, or "direct" for none; empty honors the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	URL string `koanf:"url" validate:"omitempty,eq=direct|url"`
+	// NoProxy lists hosts reached without a proxy, in NO_PROXY syntax.
+	NoProxy string `koanf:"no_proxy"`
+}
+
+// ConfigReadeckTLS configures the TLS connection to Readeck, for servers
+// with a self-signed certificate or behind mutual TLS.
+type ConfigReadeckTLS struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string `koanf:"ca_file" validate:"omitempty,file"`
+	// InsecureSkipVerify accepts any certificate; prefer CAFile.
+	InsecureSkipVerify bool `koanf:"insecure_skip_verify"`
+	// CertFile and KeyFile are a PEM client certificate and its key.
+	CertFile string `koanf:"cert_file" validate:"required_with=KeyFile,omitempty,file"`
+	KeyFile  string `koanf:"key_file" validate:"required_with=CertFile,omitempty,file"`
+}
+
+// ConfigReadeckTransport tunes the connections kept open to Readeck.
+type ConfigReadeckTransport struct {
+	// MaxIdleConnsPerHost is how many idle connections are kept for reuse.
+	MaxIdleConnsPerHost int `koanf:"max_idle_conns_per_host" validate:"min=0"`
+	// IdleConnTimeout closes connections idle for longer.
+	IdleConnTimeout time.Duration `koanf:"idle_conn_timeout" validate:"min=0"`
+	// DisableHTTP2 speaks HTTP/1.1 only.
+	DisableHTTP2 bool `koanf:"disable_http2"`
+}
+
+// ConfigReadeckTimeouts bounds each kind of call to Readeck.
+type ConfigReadeckTimeouts struct {
+	// Sync covers the sync endpoints, which stream the whole library.
+	Sync time.Duration `koanf:"sync" validate:"min=0"`
+	// Article covers article HTML and proxied images.
+	Article time.Duration `koanf:"article" validate:"min=0"`
+	// Mutation covers creating and updating bookmarks.
+	Mutation time.Duration `koanf:"mutation" validate:"min=0"`
+	// Default covers every other call.
+	Default time.Duration `koanf:"default" validate:"min=0"`
+}
+
+type ConfigTracing struct {
+	Enabled     bool    `koanf:"enabled"`
+	Endpoint    string  `koanf:"endpoint" validate:"required_if=Enabled true,max=63"`
+	Insecure    bool    `koanf:"insecure"`
+	ServiceName string  `koanf:"service_name"`
+	SampleRatio float64 `koanf:"sample_ratio" validate:"min=0,max=1"`
+}
+
+type ConfigAccessLog struct {
+	Format string `koanf:"format" validate:"oneof=default combined json"`
+	// File receives the access log instead of stderr and is rotated once it
+	// reaches MaxSizeMB or its entries are older than MaxAgeDays.
+	File       string `koanf:"file"`
+	MaxSizeMB  int    `koanf:"max_size_mb" validate:"min=0"`
+	MaxAgeDays int    `koanf:"max_age_days" validate:"min=0"`
+	MaxBackups int    `koanf:"max_backups" validate:"min=0"`
+}
+
+type ConfigKoboStore struct {
+	Upstream string `koanf:"upstream" validate:"required,url"`
+	// Passthrough forwards store API requests that readeckobo does not
+	// handle itself to Upstream.
+	Passthrough bool `koanf:"passthrough"`
+	// BridgeURL is where the Kobo reaches readeckobo's Instapaper API,
+	// ending in /instapaper-proxy/instapaper. It defaults to that path at
+	// the scheme and host of the request, under server.path_prefix.
+	BridgeURL string `koanf:"bridge_url" validate:"omitempty,url"`
+	// RewriteURLs are the URL prefixes in the initialization response that
+	// are replaced by BridgeURL.
+	RewriteURLs []string      `koanf:"rewrite_urls" validate:"dive,url"`
+	CacheTTL    time.Duration `koanf:"cache_ttl" validate:"min=0"`
+	// Offline answers the initialization request with a generated response
+	// instead of the store's, for devices kept off Kobo's servers. Nothing
+	// is forwarded to Upstream then.
+	Offline bool `koanf:"offline"`
+	// OfflineResources are added to the resources of the generated response,
+	// with RewriteURLs applied as to the store's.
+	OfflineResources map[string]string `koanf:"offline_resources"`
+}
+
+type ConfigActionQueue struct {
+	// File keeps actions that are waiting for Readeck across restarts;
+	// without it they are only kept in memory.
+	File string `koanf:"file"`
+	// RetryInterval is the first delay before queued actions are replayed.
+	// It doubles after every failed attempt, up to MaxRetryInterval.
+	RetryInterval    time.Duration `koanf:"retry_interval" validate:"gt=0"`
+	MaxRetryInterval time.Duration `koanf:"max_retry_interval" validate:"gtefield=RetryInterval"`
+}
+
+// ConfigURLIndex keeps the bookmark IDs of synced URLs, which lets
+// /api/kobo/download skip searching Readeck.
+type ConfigURLIndex struct {
+	// File keeps the index across restarts; without it the index is only
+	// kept in memory and rebuilt by the next syncs.
+	File string `koanf:"file"`
+}
+
+// ConfigStats keeps the reading statistics of each device.
+type ConfigStats struct {
+	// File keeps the statistics across restarts; without it they count
+	// from the last start.
+	File string `koanf:"file"`
+}
+
+// ConfigDevices keeps the model, firmware and serial each device reports.
+type ConfigDevices struct {
+	// File keeps the devices across restarts; without it they are known
+	// from their first request after a start.
+	File string `koanf:"file"`
+}
+
+// ConfigPortal serves the user portal at /portal/, where people log in with
+// their Readeck account to pair devices, choose what they sync and see their
+// syncs.
+type ConfigPortal struct {
+	Enabled bool `koanf:"enabled"`
+	// File keeps the devices paired and the sync choices made in the portal
+	// across restarts; without it they are lost when readeckobo stops.
+	File string `koanf:"file"`
+	// SessionTTL is how long a login lasts.
+	SessionTTL time.Duration `koanf:"session_ttl" validate:"min=0"`
+}
+
+// ConfigFeeds polls RSS and Atom feeds, or a Miniflux server, and saves
+// their new articles to Readeck for a device.
+type ConfigFeeds struct {
+	// PollInterval is how often the sources are checked.
+	PollInterval time.Duration `koanf:"poll_interval" validate:"min=0"`
+	// File keeps the entries already seen across restarts; without it the
+	// entries published while readeckobo was stopped are not saved.
+	File string `koanf:"file"`
+	// MaxItems bounds the entries saved from a source per poll.
+	MaxItems int            `koanf:"max_items" validate:"min=0"`
+	Sources  []FeedSource   `koanf:"sources" validate:"dive"`
+	Miniflux ConfigMiniflux `koanf:"miniflux"`
+}
+
+// FeedSource is an RSS or Atom feed whose new entries are saved for the
+// device with Token.
+type FeedSource struct {
+	URL    string   `koanf:"url" validate:"required,url"`
+	Token  string   `koanf:"token" validate:"required"`
+	Labels []string `koanf:"labels"`
+}
+
+// ConfigMiniflux saves the unread entries of a Miniflux server for the
+// device with Token.
+type ConfigMiniflux struct {
+	URL    string `koanf:"url" validate:"omitempty,url"`
+	APIKey string `koanf:"api_key" validate:"required_with=URL"`
+	Token  string `koanf:"token" validate:"required_with=URL"`
+	// CategoryID limits the entries to a Miniflux category; 0 takes all.
+	CategoryID int64    `koanf:"category_id" validate:"min=0"`
+	Labels     []string `koanf:"labels"`
+	// MarkRead marks saved entries as read in Miniflux.
+	MarkRead bool `koanf:"mark_read"`
+}
+
+// ConfigDigest bundles the recent unread articles of each device into one
+// EPUB every day.
+type ConfigDigest struct {
+	Enabled bool `koanf:"enabled"`
+	// Days is how far back the unread articles of a digest go.
+	Days int `koanf:"days" validate:"min=0"`
+	// Time is the local time of day digests are built, as HH:MM.
+	Time string `koanf:"time" validate:"omitempty,datetime=15:04"`
+	// MaxArticles bounds the chapters of a digest.
+	MaxArticles int `koanf:"max_articles" validate:"min=0"`
+}
+
+// ConfigDiscover sets what the Pocket discover and recommendation endpoints
+// list on the device.
+type ConfigDiscover struct {
+	// Source is "newest" for the newest unread bookmarks, "label" for the
+	// unread bookmarks with Label, or "collections" for the unread
+	// bookmarks of Collections.
+	Source string `koanf:"source" validate:"oneof=newest label collections"`
+	Label  string `koanf:"label" validate:"required_if=Source label"`
+	// Collections are Readeck collections, matched by name.
+	Collections []string `koanf:"collections" validate:"required_if=Source collections,dive,required"`
+	// MaxItems bounds the items listed.
+	MaxItems int `koanf:"max_items" validate:"min=1"`
+}
+
+// ConfigReadingProgress estimates the read_progress of bookmarks from how
+// long the device kept them open, for firmwares that report no reading
+// position.
+type ConfigReadingProgress struct {
+	Estimate bool `koanf:"estimate"`
+	// WordsPerMinute is the reading speed the estimate assumes.
+	WordsPerMinute int `koanf:"words_per_minute" validate:"min=1"`
+	// MaxSession bounds the time counted for one opening of an article, so
+	// that a device left on a page does not mark it read; 0 counts it all.
+	MaxSession time.Duration `koanf:"max_session" validate:"min=0"`
+}
+
+// ConfigConflicts sets how /api/kobo/send resolves a change from the device
+// to an item that also changed in Readeck since the device last synced.
+type ConfigConflicts struct {
+	// Policy is "device-wins" to apply the device's change, "server-wins" to
+	// keep Readeck's, or "merge" to keep whichever change is later. Unset,
+	// changes are applied without looking for conflicts.
+	Policy string `koanf:"policy" validate:"omitempty,oneof=device-wins server-wins merge"`
+}
+
+type ConfigSave struct {
+	// Label is added to bookmarks saved through /api/save; empty adds none.
+	Label string `koanf:"label"`
+}
+
+// ConfigExtraction sets how the bookmarks added from devices are followed
+// until Readeck has extracted their page.
+type ConfigExtraction struct {
+	// CheckInterval is how often pending extractions are checked.
+	CheckInterval time.Duration `koanf:"check_interval" validate:"min=0"`
+	// Timeout is how long an extraction may take before it counts as failed.
+	Timeout time.Duration `koanf:"timeout" validate:"min=0"`
+	// MaxRetries is how many times a failed extraction is retried by adding
+	// the URL again.
+	MaxRetries int `koanf:"max_retries" validate:"min=0"`
+}
+
+// ConfigDownload sets how /api/kobo/download handles URLs Readeck does not
+// know.
+type ConfigDownload struct {
+	// SaveMissing saves an unknown URL to Readeck and waits for its article,
+	// so that an article saved on the device moments earlier can be read.
+	SaveMissing bool `koanf:"save_missing"`
+	// ExtractionTimeout bounds the wait for Readeck to extract the article,
+	// which is checked every PollInterval.
+	ExtractionTimeout time.Duration `koanf:"extraction_timeout" validate:"min=0"`
+	PollInterval      time.Duration `koanf:"poll_interval" validate:"min=0"`
+	// ReadabilityFallback extracts the article from the bookmarked page
+	// itself when Readeck has none, fetching it only from public addresses.
+	ReadabilityFallback bool `koanf:"readability_fallback"`
+	// PDFToText is the path of poppler's pdftotext, which converts the text
+	// of PDF bookmarks to articles; PDFs are not converted when it is unset.
+	PDFToText string `koanf:"pdftotext"`
+	// MaxImages keeps the first images of downloaded articles, for slow
+	// connections; 0 keeps them all.
+	MaxImages int `koanf:"max_images" validate:"min=0"`
+}
+
+type ConfigImages struct {
+	// MaxBytes and MaxPixels bound the source images /api/convert-image
+	// accepts, so that decompression bombs cannot exhaust memory.
+	MaxBytes  int64 `koanf:"max_bytes" validate:"min=1"`
+	MaxPixels int   `koanf:"max_pixels" validate:"min=1"`
+	// SVGWidth and SVGHeight bound the size SVG images are rasterized to.
+	SVGWidth  int `koanf:"svg_width" validate:"min=1"`
+	SVGHeight int `koanf:"svg_height" validate:"min=1"`
+	// PlaceholderWidth and PlaceholderHeight size the image shown in place
+	// of one that could not be converted.
+	PlaceholderWidth  int `koanf:"placeholder_width" validate:"min=1"`
+	PlaceholderHeight int `koanf:"placeholder_height" validate:"min=1"`
+	// Frame picks the frame of animated images: the first one, or the most
+	// representative one of an animated GIF.
+	Frame string `koanf:"frame" validate:"oneof=first representative"`
+	// PassthroughMaxBytes is the largest baseline JPEG that fits the device
+	// and is sent on without re-encoding; 0 always re-encodes.
+	PassthroughMaxBytes int64 `koanf:"passthrough_max_bytes" validate:"min=0"`
+	// Proxy is used to fetch images from their origin websites.
+	Proxy ConfigProxy `koanf:"proxy"`
+	// UserAgent is sent when fetching images, as some websites block Go's.
+	UserAgent string `koanf:"user_agent"`
+	// Referer sends the URL of the article an image belongs to, for
+	// websites that refuse hotlinked images.
+	Referer bool `koanf:"referer"`
+	// Headers are added to every image fetch.
+	Headers map[string]string `koanf:"headers"`
+	// Domains overrides the fetch settings for images on some websites.
+	Domains []ConfigImageDomain `koanf:"domains" validate:"dive"`
+}
+
+// ConfigImageDomain overrides how images are fetched from a domain and its
+// subdomains.
+type ConfigImageDomain struct {
+	Domain string `koanf:"domain" validate:"required,hostname"`
+	// UserAgent replaces images.user_agent when set.
+	UserAgent string `koanf:"user_agent"`
+	// Referer replaces images.referer when set.
+	Referer *bool `koanf:"referer"`
+	// Headers are added to images.headers, replacing those with the same name.
+	Headers map[string]string `koanf:"headers"`
+}
+
+// ConfigCapture records Kobo traffic for turning device bug reports into
+// regression tests.
+type ConfigCapture struct {
+	// Dir receives one file per Kobo request; empty disables capturing.
+	Dir string `koanf:"dir"`
+	// Recent is the number of last Kobo requests shown on /admin/requests;
+	// 0 disables the inspector.
+	Recent int `koanf:"recent" validate:"min=0"`
+}
+
+// ConfigHost serves one group of routes for requests to Host: "pocket" for
+// the Pocket API (text.getpocket.com), "store" for the Kobo store proxy
+// (storeapi.kobo.com), "instapaper" for the Kobo API (www.instapaper.com) or
+// "opds" for the digest feed.
+type ConfigHost struct {
+	Host   string `koanf:"host" validate:"required,hostname"`
+	Routes string `koanf:"routes" validate:"oneof=pocket store instapaper opds"`
+}
+
+// ConfigServerHTTP tunes the connections of the device-facing server.
+type ConfigServerHTTP struct {
+	// DisableHTTP2 serves HTTPS listeners over HTTP/1.1 only; otherwise
+	// HTTP/2 is offered to clients that support it.
+	DisableHTTP2 bool `koanf:"disable_http2"`
+	// H2C also serves HTTP/2 without TLS, for a reverse proxy speaking h2c.
+	H2C bool `koanf:"h2c"`
+	// MaxConcurrentStreams bounds the requests of one HTTP/2 connection;
+	// 0 keeps Go's default of 250.
+	MaxConcurrentStreams int `koanf:"max_concurrent_streams" validate:"min=0"`
+	// DisableKeepAlives closes each connection after one response.
+	DisableKeepAlives bool `koanf:"disable_keep_alives"`
+	// IdleTimeout is how long an idle connection is kept open for the next
+	// request, and ReadHeaderTimeout how long a client has to send request
+	// headers; 0 disables either.
+	IdleTimeout       time.Duration `koanf:"idle_timeout" validate:"min=0"`
+	ReadHeaderTimeout time.Duration `koanf:"read_header_timeout" validate:"min=0"`
+}
+
+// ConfigListener is an address the device-facing server listens on.
+type ConfigListener struct {
+	// Address is a TCP address, "unix:/path/to.sock" or "systemd", as for
+	// server.listen.
+	Address string `koanf:"address" validate:"required"`
+	// CertFile and KeyFile serve HTTPS on the listener with this PEM
+	// certificate and key.
+	CertFile string `koanf:"cert_file" validate:"required_with=KeyFile"`
+	KeyFile  string `koanf:"key_file" validate:"required_with=CertFile"`
+	// AutoCert serves HTTPS with the certificates generated in certs.dir.
+	AutoCert bool `koanf:"auto_cert" validate:"excluded_with=CertFile"`
+}
+
+// ConfigCerts generates a local certificate authority and certificates for
+// the Kobo hosts, for devices redirected to readeckobo by DNS.
+type ConfigCerts struct {
+	// Dir keeps the authority and the certificates; empty disables them.
+	Dir   string   `koanf:"dir"`
+	Hosts []string `koanf:"hosts" validate:"dive,hostname"`
+}
+
+// ConfigConsumerKeys checks the consumer_key of Pocket API requests, which
+// tells the API variants of Kobo firmware generations apart.
+type ConfigConsumerKeys struct {
+	// Mode is "off", "log" to log the requests with an unknown key, or
+	// "enforce" to also reject them.
+	Mode string `koanf:"mode" validate:"omitempty,oneof=off log enforce"`
+	// Keys are the known consumer keys, by the name of the firmware or
+	// client that sends them.
+	Keys map[string]string `koanf:"keys" validate:"required_if=Mode enforce,dive,required"`
+}
+
+// ConfigDNS runs a DNS server answering queries for the Kobo services with
+// readeckobo's address, for devices redirected without dnsmasq or Pi-hole.
+type ConfigDNS struct {
+	// Listen is the UDP address of the server, e.g. ":53"; empty disables it.
+	Listen string `koanf:"listen"`
+	// Address is the IP address of readeckobo answered for Hosts.
+	Address string `koanf:"address" validate:"required_with=Listen,omitempty,ip"`
+	// Hosts are the names redirected, with their subdomains.
+	Hosts []string `koanf:"hosts" validate:"dive,hostname"`
+	// Upstream resolves every other name.
+	Upstream string        `koanf:"upstream" validate:"required_with=Listen,omitempty,hostname_port"`
+	TTL      time.Duration `koanf:"ttl" validate:"min=0"`
+	// AllowedNetworks are the CIDR ranges whose queries are answered,
+	// private and loopback ranges by default.
+	AllowedNetworks []string `koanf:"allowed_networks" validate:"dive,cidr"`
+}
+
+// ConfigMDNS advertises readeckobo on the LAN with mDNS, as a _readeckobo._tcp
+// and an _http._tcp service, so setup tools can find its address.
+type ConfigMDNS struct {
+	Enabled bool `koanf:"enabled"`
+	// Instance is the service name shown to browsers.
+	Instance string `koanf:"instance" validate:"required_if=Enabled true,max=63"`
+	// Hostname is advertised as <hostname>.local; empty uses the system's.
+	Hostname string `koanf:"hostname" validate:"omitempty,hostname"`
+	// Port advertised; 0 uses server.port.
+	Port int `koanf:"port" validate:"min=0,max=65535"`
+}
+
+// DeviceProfile describes what a Kobo model displays best, so images can be
+// sized and encoded for it.
+type DeviceProfile struct {
+	Model string `koanf:"model" validate:"required"`
+	// UserAgent matches devices whose User-Agent contains it.
+	UserAgent string `koanf:"user_agent"`
+	// Tokens are device tokens that use this profile whatever their User-Agent.
+	Tokens []string `koanf:"tokens"`
+	// Devices are the Kobo models, as identified from their requests and
+	// shown on the dashboard, e.g. "Libra 2", that use this profile.
+	Devices     []string `koanf:"devices"`
+	MaxWidth    int      `koanf:"max_width" validate:"min=0"`
+	MaxHeight   int      `koanf:"max_height" validate:"min=0"`
+	Formats     []string `koanf:"formats" validate:"dive,oneof=jpeg png"`
+	JPEGQuality int      `koanf:"jpeg_quality" validate:"min=0,max=100"`
 }
 
 type Config struct {
-	Readeck  ConfigReadeck `koanf:"readeck"`
-	Server   struct {
+	Readeck ConfigReadeck `koanf:"readeck"`
+	Server  struct {
 		Port int `koanf:"port" validate:"min=1,max=65535"`
+		// Listen overrides Port with "unix:/path/to.sock", "systemd" for
+		// socket activation, or a TCP address.
+		Listen string `koanf:"listen"`
+		// TrustedProxies lists the IPs or CIDR ranges of reverse proxies whose
+		// X-Forwarded-* headers are honored; "unix" trusts Unix socket clients.
+		TrustedProxies []string `koanf:"trusted_proxies" validate:"dive,cidr|ip|eq=unix"`
+		// PathPrefix serves the device-facing routes under a subpath, such as
+		// "/readeckobo", and adds it to the URLs readeckobo generates.
+		PathPrefix string `koanf:"path_prefix" validate:"omitempty,startswith=/"`
+		// Hosts routes the requests for these hostnames to one group of
+		// routes, for devices whose DNS points Kobo services at readeckobo.
+		Hosts []ConfigHost `koanf:"hosts" validate:"dive"`
+		// Listeners replaces Port and Listen with several addresses served
+		// alike, e.g. plain HTTP on localhost for a reverse proxy and HTTPS
+		// on the LAN for devices.
+		Listeners []ConfigListener `koanf:"listeners" validate:"dive"`
+		// HTTP tunes HTTP/2 and keep-alive connections for every listener.
+		HTTP ConfigServerHTTP `koanf:"http"`
 	} `koanf:"server"`
-	Users    []User        `koanf:"users" validate:"required,min=1,dive"`
-	LogLevel string        `koanf:"log_level" validate:"oneof=error warn info debug"`
+	Admin struct {
+		// Address is the host the admin listener binds, loopback by default.
+		Address string `koanf:"address"`
+		// Port of the admin listener; 0 disables it.
+		Port int `koanf:"port" validate:"min=0,max=65535"`
+		// Password protects the admin API, metrics and profiling, and enables
+		// the dashboard; it is required off loopback.
+		Password string `koanf:"password"`
+	} `koanf:"admin"`
+	Users           []User                `koanf:"users" validate:"required,min=1,dive"`
+	Tracing         ConfigTracing         `koanf:"tracing"`
+	AccessLog       ConfigAccessLog       `koanf:"access_log"`
+	KoboStore       ConfigKoboStore       `koanf:"kobo_store"`
+	ActionQueue     ConfigActionQueue     `koanf:"action_queue"`
+	URLIndex        ConfigURLIndex        `koanf:"url_index"`
+	Stats           ConfigStats           `koanf:"stats"`
+	Devices         ConfigDevices         `koanf:"devices"`
+	Portal          ConfigPortal          `koanf:"portal"`
+	Feeds           ConfigFeeds           `koanf:"feeds"`
+	Digest          ConfigDigest          `koanf:"digest"`
+	Discover        ConfigDiscover        `koanf:"discover"`
+	ReadingProgress ConfigReadingProgress `koanf:"reading_progress"`
+	Conflicts       ConfigConflicts       `koanf:"conflicts"`
+	Save            ConfigSave            `koanf:"save"`
+	Download        ConfigDownload        `koanf:"download"`
+	Extraction      ConfigExtraction      `koanf:"extraction"`
+	Images          ConfigImages          `koanf:"images"`
+	DeviceProfiles  []DeviceProfile       `koanf:"device_profiles" validate:"dive"`
+	Capture         ConfigCapture         `koanf:"capture"`
+	DNS             ConfigDNS             `koanf:"dns"`
+	MDNS            ConfigMDNS            `koanf:"mdns"`
+	Certs           ConfigCerts           `koanf:"certs"`
+	ConsumerKeys    ConfigConsumerKeys    `koanf:"consumer_keys"`
+	LogLevel        string                `koanf:"log_level" validate:"oneof=error warn info debug"`
+	// DryRun logs the bookmark changes requested by /api/kobo/send instead of
+	// making them in Readeck.
+	DryRun bool `koanf:"dry_run"`
+	// UnsafeDump logs request dumps without masking tokens and passwords.
+	UnsafeDump bool `koanf:"unsafe_dump"`
 }
 
 func (c *Config) Validate() error {
 	validate := validator.New()
 	err := validate.Struct(c)
 	if err == nil {
-		return nil
+		if err := c.validateAdmin(); err != nil {
+			return err
+		}
+		return c.validateDeviceProfiles()
 	}
 
 	var validationErrors validator.ValidationErrors
@@ -44,9 +623,43 @@ func (c *Config) Validate() error {
 	return err
 }
 
+// validateAdmin refuses an admin listener reachable off loopback without a
+// password, as it serves the users' token state and profiling.
+func (c *Config) validateAdmin() error {
+	if c.Admin.Port == 0 || c.Admin.Password != "" || isLoopbackHost(c.Admin.Address) {
+		return nil
+	}
+	return fmt.Errorf("configuration validation failed: admin.password is required when admin.address %q is not loopback", c.Admin.Address)
+}
+
+// isLoopbackHost reports whether host only accepts local connections.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateDeviceProfiles checks that the device profiles users name exist.
+func (c *Config) validateDeviceProfiles() error {
+	for _, user := range c.Users {
+		if user.DeviceProfile == "" {
+			continue
+		}
+		if !slices.ContainsFunc(c.DeviceProfiles, func(p DeviceProfile) bool { return p.Model == user.DeviceProfile }) {
+			return fmt.Errorf("configuration validation failed: unknown device_profile %q", user.DeviceProfile)
+		}
+	}
+	return nil
+}
+
 func Load(path string) (*Config, error) {
 	k := koanf.New(".")
-	parser := yaml.Parser()
+	parser, err := parserFor(path)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := setDefaultValues(k); err != nil {
 		return nil, err
@@ -68,9 +681,179 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// LoadReadeck loads only the Readeck section of the configuration, so it can
+// be used before any user has a Readeck token.
+func LoadReadeck(path string) (*ConfigReadeck, error) {
+	k := koanf.New(".")
+	if err := setDefaultValues(k); err != nil {
+		return nil, err
+	}
+	parser, err := parserFor(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.Load(file.Provider(path), parser); err != nil {
+		return nil, err
+	}
+
+	cfg := &ConfigReadeck{}
+	if err := k.Unmarshal("readeck", cfg); err != nil {
+		return nil, err
+	}
+	if err := validator.New().Struct(cfg); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %v", err)
+	}
+
+	return cfg, nil
+}
+
 func setDefaultValues(k *koanf.Koanf) error {
 	return k.Load(confmap.Provider(map[string]any{
-		"server.port": 8080,
-		"log_level":   "info",
+		"server.port":                               8080,
+		"admin.address":                             "127.0.0.1",
+		"server.http.idle_timeout":                  "2m",
+		"server.http.read_header_timeout":           "10s",
+		"readeck.detail_concurrency":                4,
+		"readeck.article_cache_size":                200,
+		"readeck.bookmark_cache_size":               500,
+		"readeck.send_concurrency":                  4,
+		"readeck.sync_cache_ttl":                    "10s",
+		"tracing.endpoint":                          "localhost:4318",
+		"tracing.service_name":                      "readeckobo",
+		"tracing.sample_ratio":                      1.0,
+		"access_log.format":                         "default",
+		"access_log.max_size_mb":                    100,
+		"kobo_store.upstream":                       "https://storeapi.kobo.com",
+		"kobo_store.passthrough":                    true,
+		"kobo_store.rewrite_urls":                   []string{"https://www.instapaper.com"},
+		"dns.hosts":                                 []string{"getpocket.com", "instapaper.com", "storeapi.kobo.com"},
+		"dns.upstream":                              "1.1.1.1:53",
+		"dns.ttl":                                   "1m",
+		"dns.allowed_networks":                      []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "::1/128", "fc00::/7", "fe80::/10"},
+		"mdns.instance":                             "readeckobo",
+		"certs.hosts":                               []string{"storeapi.kobo.com", "getpocket.com", "text.getpocket.com", "instapaper.com", "www.instapaper.com"},
+		"kobo_store.cache_ttl":                      "1h",
+		"readeck.timeouts.sync":                     "2m",
+		"readeck.timeouts.article":                  "30s",
+		"readeck.timeouts.mutation":                 "5s",
+		"readeck.timeouts.default":                  "10s",
+		"readeck.transport.max_idle_conns_per_host": 16,
+		"readeck.transport.idle_conn_timeout":       "90s",
+		"action_queue.retry_interval":               "30s",
+		"action_queue.max_retry_interval":           "30m",
+		"save.label":                                "kobo",
+		"portal.session_ttl":                        "24h",
+		"feeds.poll_interval":                       "30m",
+		"feeds.max_items":                           10,
+		"digest.days":                               1,
+		"digest.time":                               "06:00",
+		"digest.max_articles":                       50,
+		"discover.source":                           "newest",
+		"discover.label":                            "discover",
+		"discover.max_items":                        20,
+		"reading_progress.words_per_minute":         230,
+		"reading_progress.max_session":              "1h",
+		"download.extraction_timeout":               "20s",
+		"download.poll_interval":                    "1s",
+		"extraction.check_interval":                 "15s",
+		"extraction.timeout":                        "10m",
+		"extraction.max_retries":                    1,
+		"images.max_bytes":                          20 << 20,
+		"images.max_pixels":                         50_000_000,
+		"images.svg_width":                          1200,
+		"images.svg_height":                         1600,
+		"images.placeholder_width":                  800,
+		"images.placeholder_height":                 600,
+		"images.frame":                              "first",
+		"images.passthrough_max_bytes":              1 << 20,
+		"images.user_agent":                         "Mozilla/5.0 (compatible; readeckobo; +https://github.com/eleith/readeckobo)",
+		"images.referer":                            true,
+		"log_level":                                 "info",
 	}, "."), nil)
 }
+
+// SaveReadeckAccessToken stores the Readeck token of the user identified by
+// deviceToken in the configuration file at path, adding the user if it does
+// not exist. Comments and formatting of the rest of a YAML or TOML file are
+// preserved.
+func SaveReadeckAccessToken(path, deviceToken, readeckToken string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		out, err = saveJSONToken(data, deviceToken, readeckToken)
+	case ".toml":
+		out, err = saveTOMLToken(data, deviceToken, readeckToken)
+	default:
+		out, err = saveYAMLToken(data, deviceToken, readeckToken)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return os.WriteFile(path, out, 0600)
+}
+
+// saveYAMLToken sets the Readeck token of the user deviceToken in a YAML
+// configuration, keeping its comments.
+func saveYAMLToken(data []byte, deviceToken, readeckToken string) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yamlv3.DocumentNode
+		doc.Content = []*yamlv3.Node{{Kind: yamlv3.MappingNode}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return nil, errors.New("top level is not a mapping")
+	}
+
+	users := mappingValue(root, "users")
+	if users == nil || users.Kind != yamlv3.SequenceNode {
+		users = &yamlv3.Node{Kind: yamlv3.SequenceNode}
+		setMappingValue(root, "users", users)
+	}
+
+	var user *yamlv3.Node
+	for _, node := range users.Content {
+		if token := mappingValue(node, "token"); token != nil && token.Value == deviceToken {
+			user = node
+			break
+		}
+	}
+	if user == nil {
+		user = &yamlv3.Node{Kind: yamlv3.MappingNode}
+		setMappingValue(user, "token", &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: deviceToken})
+		users.Content = append(users.Content, user)
+	}
+	setMappingValue(user, "readeck_access_token", &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: readeckToken})
+
+	return yamlv3.Marshal(&doc)
+}
+
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yamlv3.Node, key string, value *yamlv3.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: key}, value)
+}
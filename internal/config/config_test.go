@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -89,6 +91,99 @@ func TestLoad(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid admin.port too high",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"admin": map[string]any{
+					"port": 70000,
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid admin.address off loopback without a password",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"admin": map[string]any{
+					"address": "0.0.0.0",
+					"port":    9090,
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid admin.address off loopback with a password",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"admin": map[string]any{
+					"address":  "0.0.0.0",
+					"port":     9090,
+					"password": "secret",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid admin.port on the default loopback address",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"admin": map[string]any{
+					"port": 9090,
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid access_log.format",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"access_log": map[string]any{
+					"format": "xml",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid readeck.host format",
 			config: map[string]any{
@@ -104,6 +199,256 @@ func TestLoad(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid readeck.tls client cert without key",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+					"tls": map[string]any{
+						"cert_file": "config_test.go",
+					},
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid images.proxy url",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"images": map[string]any{
+					"proxy": map[string]any{
+						"url": "not a proxy",
+					},
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid readeck.tls missing ca_file",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+					"tls": map[string]any{
+						"ca_file": "/nonexistent/ca.pem",
+					},
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid users delete_action label",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+						"delete_action":        "label:trash",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid server hosts routes",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"server": map[string]any{
+					"hosts": []map[string]any{{"host": "storeapi.kobo.com", "routes": "everything"}},
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "dns listen without address",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"dns": map[string]any{
+					"listen": ":53",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "enforced consumer keys without keys",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"consumer_keys": map[string]any{
+					"mode": "enforce",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid mdns hostname",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"mdns": map[string]any{
+					"enabled":  true,
+					"hostname": "not a host",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid users image_quality",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+						"image_quality":        101,
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown users device_profile",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+						"device_profile":       "libra2",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid users delete_action",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+						"delete_action":        "shred",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid users typography code_blocks",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+						"typography":           map[string]any{"code_blocks": "highlight"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid feeds miniflux without api_key",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+				"feeds": map[string]any{
+					"miniflux": map[string]any{
+						"url":   "https://miniflux.example.com",
+						"token": "test-token",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid feeds source without token",
+			config: map[string]any{
+				"readeck": map[string]any{
+					"host": "https://readeck.example.com",
+				},
+				"users": []map[string]any{
+					{
+						"token":                "test-token",
+						"readeck_access_token": "test-readeck-token",
+					},
+				},
+				"feeds": map[string]any{
+					"sources": []map[string]any{
+						{"url": "https://example.com/feed.xml"},
+					},
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -137,3 +482,165 @@ func TestLoad(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveReadeckAccessToken(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	original := `# readeckobo configuration
+readeck:
+  host: "https://readeck.example.com"
+users:
+  - token: "device-1"
+    readeck_access_token: "old-token"
+`
+	if err := os.WriteFile(configPath, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if err := SaveReadeckAccessToken(configPath, "device-1", "new-token"); err != nil {
+		t.Fatalf("SaveReadeckAccessToken() error = %v", err)
+	}
+	if err := SaveReadeckAccessToken(configPath, "device-2", "second-token"); err != nil {
+		t.Fatalf("SaveReadeckAccessToken() error = %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(cfg.Users))
+	}
+	if cfg.Users[0].ReadeckAccessToken != "new-token" {
+		t.Errorf("expected updated token 'new-token', got '%s'", cfg.Users[0].ReadeckAccessToken)
+	}
+	if cfg.Users[1].Token != "device-2" || cfg.Users[1].ReadeckAccessToken != "second-token" {
+		t.Errorf("expected new user 'device-2' with 'second-token', got %+v", cfg.Users[1])
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	if !strings.Contains(string(data), "# readeckobo configuration") {
+		t.Errorf("expected comments to be preserved, got:\n%s", data)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	tests := []struct {
+		file    string
+		content string
+		wantErr bool
+	}{
+		{
+			file: "config.toml",
+			content: `log_level = "debug"
+
+[readeck]
+host = "https://readeck.example.com"
+sync_cache_ttl = "1m"
+
+[[users]]
+token = "test-token"
+readeck_access_token = "test-readeck-token"
+max_items = 20
+`,
+		},
+		{
+			file: "config.json",
+			content: `{
+  "log_level": "debug",
+  "readeck": {"host": "https://readeck.example.com", "sync_cache_ttl": "1m"},
+  "users": [{"token": "test-token", "readeck_access_token": "test-readeck-token", "max_items": 20}]
+}`,
+		},
+		{file: "config.ini", content: "log_level=debug", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if cfg.LogLevel != "debug" || cfg.Readeck.SyncCacheTTL != time.Minute || cfg.Server.Port != 8080 {
+				t.Errorf("unexpected settings: log_level %q, sync_cache_ttl %v, port %d", cfg.LogLevel, cfg.Readeck.SyncCacheTTL, cfg.Server.Port)
+			}
+			if len(cfg.Users) != 1 || cfg.Users[0].Token != "test-token" || cfg.Users[0].MaxItems != 20 {
+				t.Errorf("unexpected users: %+v", cfg.Users)
+			}
+		})
+	}
+}
+
+func TestSaveReadeckAccessTokenFormats(t *testing.T) {
+	tests := []struct {
+		file     string
+		original string
+		comment  string
+	}{
+		{
+			file: "config.toml",
+			original: `# readeckobo configuration
+[readeck]
+host = "https://readeck.example.com"
+
+[[users]]
+token = "device-1" # the Libra
+readeck_access_token = "old-token"
+max_items = 5
+
+[images]
+max_bytes = 1000
+`,
+			comment: "# the Libra",
+		},
+		{
+			file:     "config.json",
+			original: `{"readeck": {"host": "https://readeck.example.com"}, "users": [{"token": "device-1", "readeck_access_token": "old-token", "max_items": 5}], "images": {"max_bytes": 1000}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(configPath, []byte(tt.original), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+			if err := SaveReadeckAccessToken(configPath, "device-1", "new-token"); err != nil {
+				t.Fatalf("SaveReadeckAccessToken() error = %v", err)
+			}
+			if err := SaveReadeckAccessToken(configPath, "device-2", "second-token"); err != nil {
+				t.Fatalf("SaveReadeckAccessToken() error = %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if len(cfg.Users) != 2 || cfg.Users[0].ReadeckAccessToken != "new-token" || cfg.Users[0].MaxItems != 5 {
+				t.Fatalf("expected device-1 with 'new-token', got %+v", cfg.Users)
+			}
+			if cfg.Users[1].Token != "device-2" || cfg.Users[1].ReadeckAccessToken != "second-token" {
+				t.Errorf("expected new user 'device-2' with 'second-token', got %+v", cfg.Users[1])
+			}
+			if cfg.Images.MaxBytes != 1000 {
+				t.Errorf("expected images.max_bytes to be kept, got %d", cfg.Images.MaxBytes)
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Failed to read config file: %v", err)
+			}
+			if !strings.Contains(string(data), tt.comment) {
+				t.Errorf("expected comments to be preserved, got:\n%s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	jsonparser "github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml/v2"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/v2"
+)
+
+// Paths are the configuration files looked for, in order, when none is
+// named.
+var Paths = []string{"./config.yaml", "./config.yml", "./config.toml", "./config.json"}
+
+// parserFor returns the parser for the configuration file path, picked by
+// its extension.
+func parserFor(path string) (koanf.Parser, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Parser(), nil
+	case ".toml":
+		return toml.Parser(), nil
+	case ".json":
+		return jsonparser.Parser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported configuration format %q: use .yaml, .toml or .json", filepath.Ext(path))
+	}
+}
+
+// saveJSONToken sets the Readeck token of the user deviceToken in a JSON
+// configuration, adding the user if needed. Keys are written sorted.
+func saveJSONToken(data []byte, deviceToken, readeckToken string) ([]byte, error) {
+	var root map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+	if root == nil {
+		root = make(map[string]any)
+	}
+
+	users, _ := root["users"].([]any)
+	var user map[string]any
+	for _, u := range users {
+		if m, ok := u.(map[string]any); ok && m["token"] == deviceToken {
+			user = m
+			break
+		}
+	}
+	if user == nil {
+		user = map[string]any{"token": deviceToken}
+		users = append(users, user)
+		root["users"] = users
+	}
+	user["readeck_access_token"] = readeckToken
+
+	out, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// saveTOMLToken sets the Readeck token of the user deviceToken in a TOML
+// configuration whose users are [[users]] tables, adding the user if
+// needed. Other lines, comments included, are kept as they are.
+func saveTOMLToken(data []byte, deviceToken, readeckToken string) ([]byte, error) {
+	root, err := toml.Parser().Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	tokenLine := "readeck_access_token = " + strconv.Quote(readeckToken) + "\n"
+
+	// Find the [[users]] table of the device, from its header to the next.
+	start, end, found := -1, len(lines), false
+	hasUserTables := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if found {
+				end = i
+				break
+			}
+			isUsers := strings.ReplaceAll(strings.SplitN(trimmed, "#", 2)[0], " ", "") == "[[users]]"
+			hasUserTables = hasUserTables || isUsers
+			start = -1
+			if isUsers {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && !found {
+			if key, value, ok := tomlKeyValue(line); ok && key == "token" && value == deviceToken {
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		if _, ok := root["users"]; ok && !hasUserTables {
+			return nil, errors.New("users must be [[users]] tables to add one")
+		}
+		out := strings.Join(lines, "")
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		return []byte(out + "\n[[users]]\ntoken = " + strconv.Quote(deviceToken) + "\n" + tokenLine), nil
+	}
+
+	replaced := false
+	for i := start + 1; i < end; i++ {
+		if key, _, ok := tomlKeyValue(lines[i]); ok && key == "readeck_access_token" {
+			lines[i] = tokenLine
+			replaced = true
+		}
+	}
+	if !replaced {
+		lines = append(lines[:start+1], append([]string{tokenLine}, lines[start+1:]...)...)
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// tomlKeyValue parses a "key = value" line of a TOML table.
+func tomlKeyValue(line string) (string, any, bool) {
+	m, err := toml.Parser().Unmarshal([]byte(line))
+	if err != nil || len(m) != 1 {
+		return "", nil, false
+	}
+	for k, v := range m {
+		return k, v, true
+	}
+	return "", nil, false
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTOMLParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "tables and values",
+			input: "log_level = \"info\" # comment\n\n[server]\nport = 8_080\n\n[readeck.timeouts]\nsync = '30s'\nratio = 0.5\nstrict = true\n",
+			want: map[string]any{
+				"log_level": "info",
+				"server":    map[string]any{"port": int64(8080)},
+				"readeck":   map[string]any{"timeouts": map[string]any{"sync": "30s", "ratio": 0.5, "strict": true}},
+			},
+		},
+		{
+			name:  "arrays of tables",
+			input: "[[users]]\ntoken = \"a\"\ncollections = [\n  \"To Kobo\", # first\n  \"Later\",\n]\n\n[users.typography]\nhyphenate = true\n\n[[users]]\ntoken = \"b\"\n",
+			want: map[string]any{
+				"users": []any{
+					map[string]any{"token": "a", "collections": []any{"To Kobo", "Later"}, "typography": map[string]any{"hyphenate": true}},
+					map[string]any{"token": "b"},
+				},
+			},
+		},
+		{
+			name:  "strings, dotted keys and inline tables",
+			input: "a.\"b.c\" = \"tab\\there \\u00e9\"\nd = { e = 0x1f, f = [] }\ng = \"\"\"\nline one\nline \\\n  two\"\"\"\nh = '''C:\\path'''\ndate = 2026-10-15T08:00:00Z\n",
+			want: map[string]any{
+				"a":    map[string]any{"b.c": "tab\there é"},
+				"d":    map[string]any{"e": int64(31), "f": []any{}},
+				"g":    "line one\nline two",
+				"h":    `C:\path`,
+				"date": time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "duplicate key", input: "a = 1\na = 2\n", wantErr: true},
+		{name: "missing value", input: "a =\n", wantErr: true},
+		{name: "unterminated string", input: "a = \"b\n", wantErr: true},
+		{name: "trailing text", input: "a = 1 b\n", wantErr: true},
+		{name: "table over value", input: "a = 1\n[a]\n", wantErr: true},
+		{name: "redefined table", input: "[a]\nb = 1\n[a]\nc = 2\n", wantErr: true},
+	}
+	parser, err := parserFor("config.toml")
+	if err != nil {
+		t.Fatalf("parserFor() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.Unmarshal([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
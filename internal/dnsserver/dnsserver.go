@@ -0,0 +1,201 @@
+// Package dnsserver answers DNS queries for the Kobo services with the
+// address of readeckobo, and forwards every other query upstream, so a Kobo
+// can be redirected without running a separate DNS server.
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+// upstreamTimeout bounds the wait for the upstream server's answer.
+const upstreamTimeout = 5 * time.Second
+
+// maxMessageSize is the largest UDP message read, as EDNS0 allows.
+const maxMessageSize = 4096
+
+// maxForwards bounds the queries waiting on the upstream server at once.
+const maxForwards = 64
+
+// errBusy is returned for a query to forward while maxForwards are waiting.
+var errBusy = errors.New("too many queries forwarded upstream")
+
+// Server is a DNS server for redirecting a Kobo.
+type Server struct {
+	address  netip.Addr
+	hosts    []string
+	upstream string
+	ttl      uint32
+	// allowed are the networks answered; queries from others are dropped so
+	// the server is no open resolver.
+	allowed  []netip.Prefix
+	forwards chan struct{}
+	logger   *logger.Logger
+}
+
+// New creates a server for cfg.
+func New(cfg config.ConfigDNS, logger *logger.Logger) (*Server, error) {
+	address, err := netip.ParseAddr(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dns.address: %w", err)
+	}
+	allowed := make([]netip.Prefix, len(cfg.AllowedNetworks))
+	for i, network := range cfg.AllowedNetworks {
+		if allowed[i], err = netip.ParsePrefix(network); err != nil {
+			return nil, fmt.Errorf("failed to parse dns.allowed_networks: %w", err)
+		}
+	}
+	hosts := make([]string, len(cfg.Hosts))
+	for i, host := range cfg.Hosts {
+		hosts[i] = strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+	return &Server{
+		address:  address.Unmap(),
+		hosts:    hosts,
+		upstream: cfg.Upstream,
+		ttl:      uint32(cfg.TTL / time.Second),
+		allowed:  allowed,
+		forwards: make(chan struct{}, maxForwards),
+		logger:   logger,
+	}, nil
+}
+
+// Serve answers the queries received on conn until it is closed.
+func (s *Server) Serve(conn net.PacketConn) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !s.isAllowed(addr) {
+			s.logger.Debugf("Dropping DNS query from %s outside dns.allowed_networks", addr)
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			response, err := s.answer(query)
+			if err != nil {
+				s.logger.Warnf("Error answering DNS query from %s: %v", addr, err)
+				return
+			}
+			if _, err := conn.WriteTo(response, addr); err != nil {
+				s.logger.Warnf("Error sending DNS response to %s: %v", addr, err)
+			}
+		}()
+	}
+}
+
+// isAllowed reports whether addr is in one of the allowed networks.
+func (s *Server) isAllowed(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	for _, prefix := range s.allowed {
+		if prefix.Contains(addrPort.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// answer returns the response to query: the server's address for the
+// redirected hosts, and the upstream server's response otherwise.
+func (s *Server) answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse question: %w", err)
+	}
+	if !s.redirected(question.Name.String()) {
+		return s.forward(query)
+	}
+	s.logger.Debugf("Answering DNS query for %s %s with %s", question.Name, question.Type, s.address)
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+	})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: s.ttl}
+	// Other query types get an empty answer, so the Kobo falls back to the
+	// address it can use.
+	switch {
+	case question.Type == dnsmessage.TypeA && s.address.Is4():
+		err = builder.AResource(resource, dnsmessage.AResource{A: s.address.As4()})
+	case question.Type == dnsmessage.TypeAAAA && s.address.Is6():
+		err = builder.AAAAResource(resource, dnsmessage.AAAAResource{AAAA: s.address.As16()})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// redirected reports whether name is one of the hosts or their subdomains.
+func (s *Server) redirected(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, host := range s.hosts {
+		if name == host || strings.HasSuffix(name, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward sends query to the upstream server and returns its response.
+func (s *Server) forward(query []byte) ([]byte, error) {
+	select {
+	case s.forwards <- struct{}{}:
+		defer func() { <-s.forwards }()
+	default:
+		return nil, errBusy
+	}
+	conn, err := net.DialTimeout("udp", s.upstream, upstreamTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach upstream %s: %w", s.upstream, err)
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetDeadline(time.Now().Add(upstreamTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf("failed to forward query to %s: %w", s.upstream, err)
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", s.upstream, err)
+	}
+	return buf[:n], nil
+}
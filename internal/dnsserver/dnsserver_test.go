@@ -0,0 +1,241 @@
+package dnsserver
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+func newQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+	return query
+}
+
+// startUpstream runs a DNS server answering every A query with 203.0.113.9.
+func startUpstream(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, maxMessageSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+				Answers: []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+					Body:   &dnsmessage.AResource{A: [4]byte{203, 0, 113, 9}},
+				}},
+			}
+			packed, _ := response.Pack()
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestServe(t *testing.T) {
+	server, err := New(config.ConfigDNS{
+		Address:         "192.168.1.10",
+		Hosts:           []string{"getpocket.com", "storeapi.kobo.com."},
+		Upstream:        startUpstream(t),
+		TTL:             time.Minute,
+		AllowedNetworks: []string{"127.0.0.0/8"},
+	}, logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(conn) }()
+	defer func() {
+		_ = conn.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	}()
+
+	testCases := []struct {
+		name    string
+		qname   string
+		qtype   dnsmessage.Type
+		answers []dnsmessage.AResource
+	}{
+		{
+			name:    "redirected host",
+			qname:   "getpocket.com.",
+			qtype:   dnsmessage.TypeA,
+			answers: []dnsmessage.AResource{{A: [4]byte{192, 168, 1, 10}}},
+		},
+		{
+			name:    "redirected subdomain in another case",
+			qname:   "API.getpocket.com.",
+			qtype:   dnsmessage.TypeA,
+			answers: []dnsmessage.AResource{{A: [4]byte{192, 168, 1, 10}}},
+		},
+		{
+			name:    "host with a trailing dot in the config",
+			qname:   "storeapi.kobo.com.",
+			qtype:   dnsmessage.TypeA,
+			answers: []dnsmessage.AResource{{A: [4]byte{192, 168, 1, 10}}},
+		},
+		{
+			name:  "AAAA query for an IPv4 address is empty",
+			qname: "getpocket.com.",
+			qtype: dnsmessage.TypeAAAA,
+		},
+		{
+			name:    "other host is forwarded",
+			qname:   "kobo.com.",
+			qtype:   dnsmessage.TypeA,
+			answers: []dnsmessage.AResource{{A: [4]byte{203, 0, 113, 9}}},
+		},
+		{
+			name:    "suffix that is not a subdomain is forwarded",
+			qname:   "notgetpocket.com.",
+			qtype:   dnsmessage.TypeA,
+			answers: []dnsmessage.AResource{{A: [4]byte{203, 0, 113, 9}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := net.Dial("udp", conn.LocalAddr().String())
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			defer func() { _ = client.Close() }()
+			_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err := client.Write(newQuery(t, tc.qname, tc.qtype)); err != nil {
+				t.Fatalf("Failed to send query: %v", err)
+			}
+			buf := make([]byte, maxMessageSize)
+			n, err := client.Read(buf)
+			if err != nil {
+				t.Fatalf("Failed to read response: %v", err)
+			}
+			var response dnsmessage.Message
+			if err := response.Unpack(buf[:n]); err != nil {
+				t.Fatalf("Failed to unpack response: %v", err)
+			}
+
+			if response.ID != 42 || !response.Response {
+				t.Errorf("header = %+v, want a response to query 42", response.Header)
+			}
+			if len(response.Answers) != len(tc.answers) {
+				t.Fatalf("got %d answers, want %d", len(response.Answers), len(tc.answers))
+			}
+			for i, answer := range response.Answers {
+				a, ok := answer.Body.(*dnsmessage.AResource)
+				if !ok || *a != tc.answers[i] {
+					t.Errorf("answer %d = %v, want %v", i, answer.Body, tc.answers[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServeDropsOtherNetworks(t *testing.T) {
+	server, err := New(config.ConfigDNS{
+		Address:         "192.168.1.10",
+		Hosts:           []string{"getpocket.com"},
+		Upstream:        startUpstream(t),
+		AllowedNetworks: []string{"192.168.1.0/24"},
+	}, logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() { _ = server.Serve(conn) }()
+	defer func() { _ = conn.Close() }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := client.Write(newQuery(t, "kobo.com.", dnsmessage.TypeA)); err != nil {
+		t.Fatalf("Failed to send query: %v", err)
+	}
+	if n, err := client.Read(make([]byte, maxMessageSize)); err == nil {
+		t.Errorf("expected no answer from outside the allowed networks, got %d bytes", n)
+	}
+}
+
+func TestForwardBusy(t *testing.T) {
+	server, err := New(config.ConfigDNS{Address: "192.168.1.10", Upstream: startUpstream(t)}, logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for range maxForwards {
+		server.forwards <- struct{}{}
+	}
+	if _, err := server.answer(newQuery(t, "kobo.com.", dnsmessage.TypeA)); !errors.Is(err, errBusy) {
+		t.Errorf("expected errBusy with every forward in flight, got %v", err)
+	}
+	<-server.forwards
+	if _, err := server.answer(newQuery(t, "kobo.com.", dnsmessage.TypeA)); err != nil {
+		t.Errorf("expected the query forwarded once a slot frees, got %v", err)
+	}
+}
+
+func TestServeAAAA(t *testing.T) {
+	server, err := New(config.ConfigDNS{Address: "fd00::10", Hosts: []string{"instapaper.com"}}, logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	packed, err := server.answer(newQuery(t, "www.instapaper.com.", dnsmessage.TypeAAAA))
+	if err != nil {
+		t.Fatalf("answer() error = %v", err)
+	}
+	var response dnsmessage.Message
+	if err := response.Unpack(packed); err != nil {
+		t.Fatalf("Failed to unpack response: %v", err)
+	}
+	if len(response.Answers) != 1 {
+		t.Fatalf("got %d answers, want 1", len(response.Answers))
+	}
+	want := dnsmessage.AAAAResource{AAAA: [16]byte{0: 0xfd, 15: 0x10}}
+	if a, ok := response.Answers[0].Body.(*dnsmessage.AAAAResource); !ok || *a != want {
+		t.Errorf("answer = %v, want %v", response.Answers[0].Body, want)
+	}
+}
@@ -0,0 +1,160 @@
+// Package epub writes EPUB 3 books with a table of contents, readable by
+// Kobo devices and other e-readers.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Book is an EPUB made of XHTML chapters.
+type Book struct {
+	// ID is the unique identifier of the book, such as a URN.
+	ID       string
+	Title    string
+	Author   string
+	Language string
+	Modified time.Time
+	Chapters []Chapter
+}
+
+// Chapter is a section of a book, listed in its table of contents.
+type Chapter struct {
+	Title string
+	// Body is the XHTML content of the chapter's body element; it must be
+	// well-formed XML.
+	Body string
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{"xml": escape, "inc": func(i int) int { return i + 1 }}).Parse(`
+{{define "content.opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .ID}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    {{- if .Author}}
+    <dc:creator>{{xml .Author}}</dc:creator>
+    {{- end}}
+    <dc:language>{{xml .Language}}</dc:language>
+    <meta property="dcterms:modified">{{.Modified.UTC.Format "2006-01-02T15:04:05Z"}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    {{- range $i, $c := .Chapters}}
+    <item id="chapter-{{$i}}" href="chapter-{{$i}}.xhtml" media-type="application/xhtml+xml"/>
+    {{- end}}
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="nav"/>
+    {{- range $i, $c := .Chapters}}
+    <itemref idref="chapter-{{$i}}"/>
+    {{- end}}
+  </spine>
+</package>
+{{end}}
+{{define "nav.xhtml"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{xml .Language}}">
+<head><title>{{xml .Title}}</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{xml .Title}}</h1>
+    <ol>
+      {{- range $i, $c := .Chapters}}
+      <li><a href="chapter-{{$i}}.xhtml">{{xml $c.Title}}</a></li>
+      {{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+{{end}}
+{{define "toc.ncx"}}<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="{{xml .ID}}"/></head>
+  <docTitle><text>{{xml .Title}}</text></docTitle>
+  <navMap>
+    {{- range $i, $c := .Chapters}}
+    <navPoint id="nav-{{$i}}" playOrder="{{inc $i}}"><navLabel><text>{{xml $c.Title}}</text></navLabel><content src="chapter-{{$i}}.xhtml"/></navPoint>
+    {{- end}}
+  </navMap>
+</ncx>
+{{end}}
+{{define "chapter"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="{{xml .Language}}">
+<head><title>{{xml .Chapter.Title}}</title></head>
+<body>
+<h1>{{xml .Chapter.Title}}</h1>
+{{.Chapter.Body}}
+</body>
+</html>
+{{end}}`))
+
+// escape escapes s for XML text and attribute values.
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Write writes book to w as an EPUB file.
+func (book *Book) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype comes first and uncompressed, so that readers can
+	// recognize the file from its first bytes.
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("failed to write EPUB: %w", err)
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return fmt.Errorf("failed to write EPUB: %w", err)
+	}
+
+	write := func(name string, render func(io.Writer) error) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: book.Modified})
+		if err == nil {
+			err = render(f)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write EPUB %s: %w", name, err)
+		}
+		return nil
+	}
+	if err := write("META-INF/container.xml", func(w io.Writer) error {
+		_, err := io.WriteString(w, containerXML)
+		return err
+	}); err != nil {
+		return err
+	}
+	for _, name := range []string{"content.opf", "nav.xhtml", "toc.ncx"} {
+		if err := write("OEBPS/"+name, func(w io.Writer) error { return templates.ExecuteTemplate(w, name, book) }); err != nil {
+			return err
+		}
+	}
+	for i, chapter := range book.Chapters {
+		data := map[string]any{"Language": book.Language, "Chapter": chapter}
+		if err := write(fmt.Sprintf("OEBPS/chapter-%d.xhtml", i), func(w io.Writer) error { return templates.ExecuteTemplate(w, "chapter", data) }); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write EPUB: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	book := &Book{
+		ID:       "urn:readeckobo:digest:2024-05-01",
+		Title:    "Digest <May 1>",
+		Language: "en",
+		Modified: time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC),
+		Chapters: []Chapter{
+			{Title: "Cats & dogs", Body: "<p>First<br/>article</p>"},
+			{Title: "Second", Body: "<p>Second article</p>"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := book.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to open EPUB: %v", err)
+	}
+	if first := zr.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("expected an uncompressed mimetype first, got %s (method %d)", first.Name, first.Method)
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(data)
+		if f.Name == "mimetype" {
+			continue
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := decoder.Token(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("%s is not well-formed: %v", f.Name, err)
+				}
+				break
+			}
+		}
+	}
+
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/chapter-0.xhtml", "OEBPS/chapter-1.xhtml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the EPUB", name)
+		}
+	}
+	if nav := files["OEBPS/nav.xhtml"]; !strings.Contains(nav, `<a href="chapter-0.xhtml">Cats &amp; dogs</a>`) {
+		t.Errorf("expected the table of contents to list the chapters, got %s", nav)
+	}
+	if chapter := files["OEBPS/chapter-0.xhtml"]; !strings.Contains(chapter, "<p>First<br/>article</p>") {
+		t.Errorf("expected the chapter body, got %s", chapter)
+	}
+}
@@ -0,0 +1,170 @@
+// Package feeds reads the entries of RSS and Atom feeds and of a Miniflux
+// server, for saving new articles to Readeck.
+package feeds
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxFeedBody bounds the feed documents read.
+const maxFeedBody = 10 << 20
+
+// Entry is an article listed by a feed.
+type Entry struct {
+	// ID identifies the entry within its feed: its GUID or Atom ID, or its
+	// URL when the feed gives none.
+	ID        string
+	URL       string
+	Title     string
+	Published time.Time
+}
+
+// document holds the elements of RSS 2.0, RSS 1.0 and Atom feeds that
+// entries are read from; element names are matched without namespaces.
+type document struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// Items are the items of an RSS 1.0 feed, which are siblings of the channel.
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"`
+}
+
+type atomEntry struct {
+	ID    string `xml:"id"`
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// Parse reads the entries of an RSS or Atom feed. Relative links are
+// resolved against base, which may be nil. Entries without a link are left
+// out.
+func Parse(r io.Reader, base *url.URL) ([]Entry, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	var doc document
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	var entries []Entry
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			entries = appendEntry(entries, base, item.GUID, item.Link, item.Title, parseTime(item.PubDate, item.Date))
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			entries = appendEntry(entries, base, entry.ID, atomLink(entry), entry.Title, parseTime(entry.Published, entry.Updated))
+		}
+	default:
+		return nil, fmt.Errorf("unknown feed format <%s>", doc.XMLName.Local)
+	}
+	return entries, nil
+}
+
+func appendEntry(entries []Entry, base *url.URL, id, link, title string, published time.Time) []Entry {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return entries
+	}
+	if base != nil {
+		if u, err := base.Parse(link); err == nil {
+			link = u.String()
+		}
+	}
+	if id = strings.TrimSpace(id); id == "" {
+		id = link
+	}
+	return append(entries, Entry{ID: id, URL: link, Title: strings.TrimSpace(title), Published: published})
+}
+
+// atomLink returns the alternate link of an Atom entry, which is the one
+// without a rel attribute when there is no explicit alternate.
+func atomLink(entry atomEntry) string {
+	for _, link := range entry.Links {
+		if link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	for _, link := range entry.Links {
+		if link.Rel == "" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// timeLayouts are the date formats found in feeds, RFC 3339 for Atom and
+// Dublin Core and RFC 1123 variants for RSS.
+var timeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+// parseTime reads the first of values that is a known date format, in UTC.
+func parseTime(values ...string) time.Time {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.UTC()
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Fetch downloads and parses the feed at feedURL.
+func Fetch(ctx context.Context, client *http.Client, feedURL string) ([]Entry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch feed: %s", resp.Status)
+	}
+
+	body := io.LimitReader(resp.Body, maxFeedBody)
+	entries, err := Parse(body, resp.Request.URL)
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("failed to parse feed: empty document")
+	}
+	return entries, err
+}
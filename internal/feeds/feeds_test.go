@@ -0,0 +1,120 @@
+package feeds
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/feed.xml")
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		feed string
+		want []Entry
+	}{
+		{
+			name: "RSS 2.0",
+			feed: `<?xml version="1.0"?><rss version="2.0"><channel><title>Blog</title>
+				<item><title>First</title><link>https://example.com/1</link><guid>tag:1</guid><pubDate>Wed, 01 May 2024 12:00:00 +0000</pubDate></item>
+				<item><title>Relative</title><link>/2</link></item>
+				<item><title>No link</title></item>
+			</channel></rss>`,
+			want: []Entry{
+				{ID: "tag:1", URL: "https://example.com/1", Title: "First", Published: published},
+				{ID: "https://example.com/2", URL: "https://example.com/2", Title: "Relative"},
+			},
+		},
+		{
+			name: "RSS 1.0",
+			feed: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+				<channel><title>Blog</title></channel>
+				<item><title>First</title><link>https://example.com/1</link><dc:date>2024-05-01T12:00:00Z</dc:date></item>
+			</rdf:RDF>`,
+			want: []Entry{{ID: "https://example.com/1", URL: "https://example.com/1", Title: "First", Published: published}},
+		},
+		{
+			name: "Atom",
+			feed: `<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+				<entry><id>urn:1</id><title>First</title><link rel="self" href="https://example.com/1.atom"/><link rel="alternate" href="https://example.com/1"/><updated>2024-05-01T12:00:00Z</updated></entry>
+				<entry><id>urn:2</id><title>Second</title><link href="https://example.com/2"/></entry>
+			</feed>`,
+			want: []Entry{
+				{ID: "urn:1", URL: "https://example.com/1", Title: "First", Published: published},
+				{ID: "urn:2", URL: "https://example.com/2", Title: "Second"},
+			},
+		},
+		{
+			name: "ISO-8859-1",
+			feed: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><item><title>Caf\xe9</title><link>https://example.com/1</link></item></channel></rss>",
+			want: []Entry{{ID: "https://example.com/1", URL: "https://example.com/1", Title: "Café"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.feed), base)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := Parse(strings.NewReader("<html><body></body></html>"), base); err == nil {
+		t.Error("expected an error for an HTML page")
+	}
+}
+
+func TestMiniflux(t *testing.T) {
+	var marked map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error_message":"Access Unauthorized"}`))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if got := r.URL.Query().Get("category_id"); got != "3" {
+				t.Errorf("expected category_id 3, got %q", got)
+			}
+			_, _ = w.Write([]byte(`{"total":2,"entries":[{"id":7,"url":"https://example.com/7","title":"Seven"},{"id":8,"url":""}]}`))
+		case http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&marked)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	miniflux := &Miniflux{BaseURL: server.URL + "/", APIToken: "api-key"}
+	entries, err := miniflux.UnreadEntries(context.Background(), 3, 10)
+	if err != nil {
+		t.Fatalf("UnreadEntries failed: %v", err)
+	}
+	if want := []Entry{{ID: "7", URL: "https://example.com/7", Title: "Seven"}}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("expected %+v, got %+v", want, entries)
+	}
+
+	if err := miniflux.MarkRead(context.Background(), []string{"7"}); err != nil {
+		t.Fatalf("MarkRead failed: %v", err)
+	}
+	if marked["status"] != "read" || !reflect.DeepEqual(marked["entry_ids"], []any{float64(7)}) {
+		t.Errorf("unexpected mark read request: %v", marked)
+	}
+
+	miniflux.APIToken = "wrong"
+	if _, err := miniflux.UnreadEntries(context.Background(), 3, 10); err == nil || !strings.Contains(err.Error(), "Access Unauthorized") {
+		t.Errorf("expected Miniflux's error message, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Miniflux reads unread entries from the API of a Miniflux server.
+type Miniflux struct {
+	BaseURL string
+	// APIToken is a Miniflux API key, sent as X-Auth-Token.
+	APIToken   string
+	HTTPClient *http.Client
+}
+
+type minifluxEntry struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// UnreadEntries returns up to limit unread entries, newest first, of the
+// category categoryID, or of every category when it is 0. Entry IDs are
+// Miniflux entry IDs.
+func (m *Miniflux) UnreadEntries(ctx context.Context, categoryID int64, limit int) ([]Entry, error) {
+	query := url.Values{}
+	query.Set("status", "unread")
+	query.Set("order", "published_at")
+	query.Set("direction", "desc")
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if categoryID > 0 {
+		query.Set("category_id", strconv.FormatInt(categoryID, 10))
+	}
+
+	var page struct {
+		Entries []minifluxEntry `json:"entries"`
+	}
+	if err := m.do(ctx, http.MethodGet, "/v1/entries?"+query.Encode(), nil, &page); err != nil {
+		return nil, fmt.Errorf("failed to list Miniflux entries: %w", err)
+	}
+	entries := make([]Entry, 0, len(page.Entries))
+	for _, entry := range page.Entries {
+		if entry.URL == "" {
+			continue
+		}
+		entries = append(entries, Entry{
+			ID:        strconv.FormatInt(entry.ID, 10),
+			URL:       entry.URL,
+			Title:     entry.Title,
+			Published: entry.PublishedAt,
+		})
+	}
+	return entries, nil
+}
+
+// MarkRead marks the entries with ids as read in Miniflux.
+func (m *Miniflux) MarkRead(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	entryIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Miniflux entry ID %q", id)
+		}
+		entryIDs = append(entryIDs, n)
+	}
+	body := map[string]any{"entry_ids": entryIDs, "status": "read"}
+	if err := m.do(ctx, http.MethodPut, "/v1/entries", body, nil); err != nil {
+		return fmt.Errorf("failed to mark Miniflux entries as read: %w", err)
+	}
+	return nil
+}
+
+func (m *Miniflux) do(ctx context.Context, method, path string, body, v any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(m.BaseURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", m.APIToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := m.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			ErrorMessage string `json:"error_message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr) == nil && apiErr.ErrorMessage != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.ErrorMessage)
+		}
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Level int
@@ -31,19 +33,56 @@ func ParseLevel(lvl string) (Level, error) {
 
 // Logger is a simple leveled logger.
 type Logger struct {
-	level Level
+	level      Level
+	unsafeDump bool
+
+	mu     sync.Mutex
+	recent []Entry
+}
+
+// Entry is a logged error kept for the admin dashboard.
+type Entry struct {
+	Time    time.Time
+	Message string
 }
 
+// maxRecentErrors is the number of errors kept by RecentErrors.
+const maxRecentErrors = 20
+
 // New creates a new Logger.
 func New(level Level) *Logger {
 	return &Logger{level: level}
 }
 
+// RecentErrors returns the latest errors, newest first.
+func (l *Logger) RecentErrors() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]Entry, len(l.recent))
+	for i, entry := range l.recent {
+		entries[len(l.recent)-1-i] = entry
+	}
+	return entries
+}
+
+// SetUnsafeDump disables redaction of secrets in request dumps. It is meant
+// for debugging only.
+func (l *Logger) SetUnsafeDump(enabled bool) {
+	l.unsafeDump = enabled
+}
+
 // Errorf prints a formatted error message.
 func (l *Logger) Errorf(format string, v ...interface{}) {
 	if l.level >= ERROR {
 		log.Printf(format, v...)
 	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recent = append(l.recent, Entry{Time: time.Now(), Message: fmt.Sprintf(format, v...)})
+	if len(l.recent) > maxRecentErrors {
+		l.recent = l.recent[len(l.recent)-maxRecentErrors:]
+	}
 }
 
 // Warnf prints a formatted warning message.
@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const redacted = "****"
+
+var (
+	// secretJSONPattern matches string values of JSON fields holding secrets.
+	secretJSONPattern = regexp.MustCompile(`("(?:access_token|readeck_access_token|token|password)"\s*:\s*")(?:[^"\\]|\\.)*"`)
+	// secretFormPattern matches form-encoded fields holding secrets.
+	secretFormPattern = regexp.MustCompile(`(?m)((?:^|[?&])(?:access_token|token|password)=)[^&\s]*`)
+	// authHeaderPattern matches the credentials of Authorization headers in raw dumps.
+	authHeaderPattern = regexp.MustCompile(`(?im)^(authorization:[ \t]*(?:bearer[ \t]+|basic[ \t]+)?)[^\r\n]+`)
+	// cookieHeaderPattern matches Cookie headers in raw dumps.
+	cookieHeaderPattern = regexp.MustCompile(`(?im)^((?:set-)?cookie:[ \t]*)[^\r\n]+`)
+)
+
+// secretHeaders are masked by RedactHeader.
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Redact masks device and Readeck tokens, passwords and credentials in a
+// request body or raw HTTP dump before it is logged.
+func (l *Logger) Redact(dump []byte) string {
+	if l.unsafeDump {
+		return string(dump)
+	}
+	s := secretJSONPattern.ReplaceAllString(string(dump), `${1}`+redacted+`"`)
+	s = secretFormPattern.ReplaceAllString(s, `${1}`+redacted)
+	s = authHeaderPattern.ReplaceAllString(s, `${1}`+redacted)
+	return cookieHeaderPattern.ReplaceAllString(s, `${1}`+redacted)
+}
+
+// RedactHeader returns a copy of h with credentials masked.
+func (l *Logger) RedactHeader(h http.Header) http.Header {
+	if l.unsafeDump {
+		return h
+	}
+	h = h.Clone()
+	for _, name := range secretHeaders {
+		values := h.Values(name)
+		for i, v := range values {
+			if scheme, _, ok := strings.Cut(v, " "); ok && name == "Authorization" {
+				values[i] = scheme + " " + redacted
+			} else {
+				values[i] = redacted
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "json access token",
+			input:    `{"access_token": "device-secret", "since": 0}`,
+			expected: `{"access_token": "****", "since": 0}`,
+		},
+		{
+			name:     "json password with escaped quote",
+			input:    `{"username":"me","password":"p\"ss"}`,
+			expected: `{"username":"me","password":"****"}`,
+		},
+		{
+			name:     "form access token",
+			input:    "consumer_key=abc&access_token=device-secret&url=x",
+			expected: "consumer_key=abc&access_token=****&url=x",
+		},
+		{
+			name:     "bearer header in dump",
+			input:    "GET /api/bookmarks HTTP/1.1\r\nHost: readeck\r\nAuthorization: Bearer readeck-secret\r\n\r\n",
+			expected: "GET /api/bookmarks HTTP/1.1\r\nHost: readeck\r\nAuthorization: Bearer ****\r\n\r\n",
+		},
+	}
+
+	l := New(DEBUG)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := l.Redact([]byte(tc.input)); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("unsafe dump", func(t *testing.T) {
+		unsafe := New(DEBUG)
+		unsafe.SetUnsafeDump(true)
+		input := `{"access_token":"device-secret"}`
+		if got := unsafe.Redact([]byte(input)); got != input {
+			t.Errorf("expected %q, got %q", input, got)
+		}
+	})
+}
+
+func TestRedactHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer readeck-secret")
+	h.Set("Cookie", "session=abc")
+	h.Set("User-Agent", "Kobo")
+
+	got := New(DEBUG).RedactHeader(h)
+	if got.Get("Authorization") != "Bearer ****" || got.Get("Cookie") != "****" || got.Get("User-Agent") != "Kobo" {
+		t.Errorf("unexpected headers %v", got)
+	}
+	if h.Get("Authorization") != "Bearer readeck-secret" {
+		t.Errorf("original header was modified: %v", h)
+	}
+}
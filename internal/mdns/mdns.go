@@ -0,0 +1,280 @@
+// Package mdns advertises readeckobo on the local network with multicast DNS
+// service discovery (RFC 6762 and RFC 6763), so setup tools and scripts can
+// find its address without being told.
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+// Service types advertised, and the type listing them for DNS-SD browsers.
+const (
+	serviceType  = "_readeckobo._tcp.local."
+	httpType     = "_http._tcp.local."
+	servicesType = "_services._dns-sd._udp.local."
+)
+
+// ttl is the lifetime in seconds of the advertised records.
+const ttl = 120
+
+// maxMessageSize is the largest mDNS message read.
+const maxMessageSize = 9000
+
+// cacheFlush marks a record as the only one of its name and type.
+const cacheFlush = 1 << 15
+
+// Group is the IPv4 mDNS multicast address.
+var Group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Responder answers mDNS queries for the readeckobo services.
+type Responder struct {
+	instance string
+	host     dnsmessage.Name
+	port     uint16
+	txt      []string
+	// group is where responses and announcements are sent.
+	group net.Addr
+	// addrs returns the addresses of the host.
+	addrs  func() []netip.Addr
+	logger *logger.Logger
+}
+
+// New creates a responder advertising the server of cfg.
+func New(cfg *config.Config, logger *logger.Logger) (*Responder, error) {
+	if strings.Contains(cfg.MDNS.Instance, ".") {
+		return nil, fmt.Errorf("mdns.instance %q must not contain dots", cfg.MDNS.Instance)
+	}
+	hostname := cfg.MDNS.Hostname
+	if hostname == "" {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %w", err)
+		}
+	}
+	hostname, _, _ = strings.Cut(hostname, ".")
+	host, err := dnsmessage.NewName(hostname + ".local.")
+	if err != nil {
+		return nil, fmt.Errorf("failed to use hostname %q: %w", hostname, err)
+	}
+	port := cfg.MDNS.Port
+	if port == 0 {
+		port = cfg.Server.Port
+	}
+	return &Responder{
+		instance: cfg.MDNS.Instance,
+		host:     host,
+		port:     uint16(port),
+		txt:      []string{"path=" + strings.TrimSuffix(cfg.Server.PathPrefix, "/") + "/"},
+		group:    Group,
+		addrs:    interfaceAddrs,
+		logger:   logger,
+	}, nil
+}
+
+// Listen joins the mDNS multicast group on every interface.
+func Listen() (*net.UDPConn, error) {
+	return net.ListenMulticastUDP("udp4", nil, Group)
+}
+
+// Serve announces the services, then answers the queries received on conn
+// until it is closed.
+func (r *Responder) Serve(conn net.PacketConn) error {
+	go r.announce(conn)
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || query.Response {
+			continue
+		}
+		// Queries not sent from the mDNS port come from plain DNS resolvers,
+		// which expect a unicast response echoing the query.
+		legacy := false
+		if udp, ok := addr.(*net.UDPAddr); ok && udp.Port != Group.Port {
+			legacy = true
+		}
+		response := r.response(query.Questions, !legacy)
+		if response == nil {
+			continue
+		}
+		to := r.group
+		if legacy {
+			response.ID = query.ID
+			response.Questions = query.Questions
+			to = addr
+		}
+		if err := r.send(conn, response, to); err != nil {
+			r.logger.Warnf("Error sending mDNS response to %s: %v", to, err)
+		}
+	}
+}
+
+// announce sends the service records unsolicited, twice a second apart as
+// RFC 6762 asks.
+func (r *Responder) announce(conn net.PacketConn) {
+	questions := []dnsmessage.Question{
+		{Name: dnsmessage.MustNewName(serviceType), Type: dnsmessage.TypePTR},
+		{Name: dnsmessage.MustNewName(httpType), Type: dnsmessage.TypePTR},
+	}
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		if err := r.send(conn, r.response(questions, true), r.group); err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				r.logger.Warnf("Error announcing mDNS services: %v", err)
+			}
+			return
+		}
+	}
+	r.logger.Infof("Advertised %s on port %d as %s", r.instance, r.port, r.host)
+}
+
+func (r *Responder) send(conn net.PacketConn, msg *dnsmessage.Message, to net.Addr) error {
+	packed, err := msg.Pack()
+	if err != nil {
+		return fmt.Errorf("failed to pack response: %w", err)
+	}
+	_, err = conn.WriteTo(packed, to)
+	return err
+}
+
+// response answers questions, adding the records a browser needs next, or
+// returns nil when none is about the services. Multicast responses mark the
+// unique records for cache flushing.
+func (r *Responder) response(questions []dnsmessage.Question, multicast bool) *dnsmessage.Message {
+	records := r.records()
+	var answers []dnsmessage.Resource
+	for _, q := range questions {
+		for _, rr := range records {
+			if strings.EqualFold(rr.Header.Name.String(), q.Name.String()) && (q.Type == dnsmessage.TypeALL || q.Type == rr.Header.Type) {
+				answers = append(answers, rr)
+			}
+		}
+	}
+	if len(answers) == 0 {
+		return nil
+	}
+
+	// Instance pointers lead to the SRV and TXT records of the instance, and
+	// SRV records to the host's addresses.
+	included := make(map[string]bool)
+	for _, rr := range answers {
+		included[rr.Header.Name.String()+rr.Header.Type.String()] = true
+	}
+	var additionals []dnsmessage.Resource
+	targets := answers
+	for len(targets) > 0 {
+		var next []dnsmessage.Resource
+		for _, target := range targets {
+			var name string
+			switch body := target.Body.(type) {
+			case *dnsmessage.PTRResource:
+				name = body.PTR.String()
+			case *dnsmessage.SRVResource:
+				name = body.Target.String()
+			default:
+				continue
+			}
+			for _, rr := range records {
+				key := rr.Header.Name.String() + rr.Header.Type.String()
+				if strings.EqualFold(rr.Header.Name.String(), name) && rr.Header.Type != dnsmessage.TypePTR && !included[key] {
+					included[key] = true
+					next = append(next, rr)
+				}
+			}
+		}
+		additionals = append(additionals, next...)
+		targets = next
+	}
+
+	if multicast {
+		for _, section := range [][]dnsmessage.Resource{answers, additionals} {
+			for i := range section {
+				if section[i].Header.Type != dnsmessage.TypePTR {
+					section[i].Header.Class |= cacheFlush
+				}
+			}
+		}
+	}
+	return &dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+}
+
+// records returns every record of the services and the host.
+func (r *Responder) records() []dnsmessage.Resource {
+	header := func(name string, rtype dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: rtype, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+	hostHeader := dnsmessage.ResourceHeader{Name: r.host, Class: dnsmessage.ClassINET, TTL: ttl}
+
+	var records []dnsmessage.Resource
+	for _, service := range []string{serviceType, httpType} {
+		instance := r.instance + "." + service
+		records = append(records,
+			dnsmessage.Resource{Header: header(servicesType, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(service)}},
+			dnsmessage.Resource{Header: header(service, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(instance)}},
+			dnsmessage.Resource{Header: header(instance, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Port: r.port, Target: r.host}},
+			dnsmessage.Resource{Header: header(instance, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: r.txt}},
+		)
+	}
+	for _, addr := range r.addrs() {
+		rr := dnsmessage.Resource{Header: hostHeader}
+		if addr.Is4() {
+			rr.Header.Type = dnsmessage.TypeA
+			rr.Body = &dnsmessage.AResource{A: addr.As4()}
+		} else {
+			rr.Header.Type = dnsmessage.TypeAAAA
+			rr.Body = &dnsmessage.AAAAResource{AAAA: addr.As16()}
+		}
+		records = append(records, rr)
+	}
+	return records
+}
+
+// interfaceAddrs returns the addresses of the host's interfaces, leaving out
+// loopback and IPv6 link-local addresses.
+func interfaceAddrs() []netip.Addr {
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var addrs []netip.Addr
+	for _, ifaceAddr := range ifaceAddrs {
+		ipNet, ok := ifaceAddr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		if addr.IsLoopback() || (addr.Is6() && addr.IsLinkLocalUnicast()) {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
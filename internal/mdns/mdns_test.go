@@ -0,0 +1,193 @@
+package mdns
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+func newTestResponder(t *testing.T) *Responder {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Server.Port = 8080
+	cfg.Server.PathPrefix = "/readeckobo"
+	cfg.MDNS = config.ConfigMDNS{Enabled: true, Instance: "readeckobo", Hostname: "bridge.lan"}
+	responder, err := New(cfg, logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	responder.addrs = func() []netip.Addr {
+		return []netip.Addr{netip.MustParseAddr("192.168.1.10")}
+	}
+	return responder
+}
+
+// summary lists the names and types of records, e.g. "bridge.local. TypeA".
+func summary(records []dnsmessage.Resource) []string {
+	var s []string
+	for _, rr := range records {
+		s = append(s, rr.Header.Name.String()+" "+rr.Header.Type.String())
+	}
+	return s
+}
+
+func TestResponse(t *testing.T) {
+	responder := newTestResponder(t)
+
+	testCases := []struct {
+		name            string
+		question        dnsmessage.Question
+		wantAnswers     []string
+		wantAdditionals []string
+	}{
+		{
+			name:        "service browse",
+			question:    dnsmessage.Question{Name: dnsmessage.MustNewName("_readeckobo._tcp.local."), Type: dnsmessage.TypePTR},
+			wantAnswers: []string{"_readeckobo._tcp.local. TypePTR"},
+			wantAdditionals: []string{
+				"readeckobo._readeckobo._tcp.local. TypeSRV",
+				"readeckobo._readeckobo._tcp.local. TypeTXT",
+				"bridge.local. TypeA",
+			},
+		},
+		{
+			name:        "http browse in another case",
+			question:    dnsmessage.Question{Name: dnsmessage.MustNewName("_HTTP._tcp.local."), Type: dnsmessage.TypePTR},
+			wantAnswers: []string{"_http._tcp.local. TypePTR"},
+			wantAdditionals: []string{
+				"readeckobo._http._tcp.local. TypeSRV",
+				"readeckobo._http._tcp.local. TypeTXT",
+				"bridge.local. TypeA",
+			},
+		},
+		{
+			name:        "service types",
+			question:    dnsmessage.Question{Name: dnsmessage.MustNewName("_services._dns-sd._udp.local."), Type: dnsmessage.TypePTR},
+			wantAnswers: []string{"_services._dns-sd._udp.local. TypePTR", "_services._dns-sd._udp.local. TypePTR"},
+		},
+		{
+			name:        "host address",
+			question:    dnsmessage.Question{Name: dnsmessage.MustNewName("bridge.local."), Type: dnsmessage.TypeALL},
+			wantAnswers: []string{"bridge.local. TypeA"},
+		},
+		{
+			name:     "unknown name",
+			question: dnsmessage.Question{Name: dnsmessage.MustNewName("_ipp._tcp.local."), Type: dnsmessage.TypePTR},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := responder.response([]dnsmessage.Question{tc.question}, true)
+			if tc.wantAnswers == nil {
+				if response != nil {
+					t.Fatalf("response = %v, want none", response)
+				}
+				return
+			}
+			if response == nil {
+				t.Fatal("response = nil, want answers")
+			}
+			if got := summary(response.Answers); !slices.Equal(got, tc.wantAnswers) {
+				t.Errorf("answers = %v, want %v", got, tc.wantAnswers)
+			}
+			if got := summary(response.Additionals); !slices.Equal(got, tc.wantAdditionals) {
+				t.Errorf("additionals = %v, want %v", got, tc.wantAdditionals)
+			}
+		})
+	}
+}
+
+func TestResponseRecords(t *testing.T) {
+	responder := newTestResponder(t)
+	response := responder.response([]dnsmessage.Question{{Name: dnsmessage.MustNewName("_readeckobo._tcp.local."), Type: dnsmessage.TypePTR}}, true)
+
+	for _, rr := range append(response.Answers, response.Additionals...) {
+		flushed := rr.Header.Class&cacheFlush != 0
+		if flushed == (rr.Header.Type == dnsmessage.TypePTR) {
+			t.Errorf("%s cache flush = %v", rr.Header.Type, flushed)
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.SRVResource:
+			if body.Port != 8080 || body.Target.String() != "bridge.local." {
+				t.Errorf("SRV = %d %s, want 8080 bridge.local.", body.Port, body.Target)
+			}
+		case *dnsmessage.TXTResource:
+			if !slices.Equal(body.TXT, []string{"path=/readeckobo/"}) {
+				t.Errorf("TXT = %v, want path=/readeckobo/", body.TXT)
+			}
+		case *dnsmessage.AResource:
+			if body.A != [4]byte{192, 168, 1, 10} {
+				t.Errorf("A = %v, want 192.168.1.10", body.A)
+			}
+		}
+	}
+}
+
+func TestServeLegacyUnicast(t *testing.T) {
+	responder := newTestResponder(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	// Announcements go to a blackhole instead of the multicast group.
+	blackhole, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer func() { _ = blackhole.Close() }()
+	responder.group = blackhole.LocalAddr()
+
+	done := make(chan error, 1)
+	go func() { done <- responder.Serve(conn) }()
+	defer func() {
+		_ = conn.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 7},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("bridge.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+	if _, err := client.Write(packed); err != nil {
+		t.Fatalf("Failed to send query: %v", err)
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	var response dnsmessage.Message
+	if err := response.Unpack(buf[:n]); err != nil {
+		t.Fatalf("Failed to unpack response: %v", err)
+	}
+	if response.ID != 7 || len(response.Questions) != 1 {
+		t.Errorf("header = %+v with %d questions, want ID 7 echoing the question", response.Header, len(response.Questions))
+	}
+	if got := summary(response.Answers); !slices.Equal(got, []string{"bridge.local. TypeA"}) {
+		t.Errorf("answers = %v, want the host address", got)
+	}
+	if response.Answers[0].Header.Class != dnsmessage.ClassINET {
+		t.Errorf("class = %v, want IN without cache flush", response.Answers[0].Header.Class)
+	}
+}
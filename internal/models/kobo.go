@@ -11,6 +11,8 @@ type KoboGetRequest struct {
 	State       string `json:"state"`
 	Total       string `json:"total"`
 	Since       any    `json:"since"`
+	// Search is the term of an on-device search, matched by Readeck.
+	Search string `json:"search,omitempty"`
 }
 
 // KoboGetResponse represents the outgoing response for /api/kobo/get
@@ -20,6 +22,13 @@ type KoboGetResponse struct {
 	Total  int                         `json:"total"`
 }
 
+// KoboErrorResponse represents the body of a failed Kobo request
+type KoboErrorResponse struct {
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	ErrorCode int    `json:"error_code"`
+}
+
 // KoboDownloadRequest represents the incoming request for /api/kobo/download
 type KoboDownloadRequest struct {
 	AccessToken string `json:"access_token"`
@@ -30,6 +39,13 @@ type KoboDownloadRequest struct {
 	URL         string `json:"url"`
 }
 
+// KoboDownloadResponse represents the outgoing response for /api/kobo/download
+type KoboDownloadResponse struct {
+	Images  map[string]KoboImage `json:"images"`
+	Videos  map[string]KoboVideo `json:"videos"`
+	Article string               `json:"article"`
+}
+
 // KoboSendRequest represents the incoming request for /api/kobo/send
 type KoboSendRequest struct {
 	AccessToken string `json:"access_token"`
@@ -37,6 +53,13 @@ type KoboSendRequest struct {
 	Actions     []any  `json:"actions"`
 }
 
+// KoboSendResponse represents the outgoing response for /api/kobo/send
+type KoboSendResponse struct {
+	Status        bool   `json:"status"`
+	ActionResults []bool `json:"action_results"`
+	DryRun        bool   `json:"dry_run,omitempty"`
+}
+
 // KoboArticleItem represents an article in the Get response list.
 type KoboArticleItem struct {
 	Authors       map[string]KoboAuthor `json:"authors,omitempty"`
@@ -58,17 +81,30 @@ type KoboArticleItem struct {
 	TimeAdded     int64                 `json:"time_added,omitempty"`
 	TimeRead      int64                 `json:"time_read,omitempty"`
 	TimeUpdated   int64                 `json:"time_updated,omitempty"`
-	Videos        []any                 `json:"videos,omitempty"`
+	TimePublished int64                 `json:"time_published,omitempty"`
+	Lang          string                `json:"lang,omitempty"`
+	TextDirection string                `json:"text_direction,omitempty"`
+	Domain        *KoboDomainMetadata   `json:"domain_metadata,omitempty"`
+	Videos        map[string]KoboVideo  `json:"videos,omitempty"`
 	WordCount     int                   `json:"word_count,omitempty"`
+	TimeToRead    int                   `json:"time_to_read,omitempty"`
 	Optional      map[string]any        `json:"_optional,omitempty"`
+	Annotations   []KoboAnnotation      `json:"annotations,omitempty"`
 }
 
 // KoboAuthor represents an author of an article.
 type KoboAuthor struct {
 	AuthorID string `json:"author_id"`
+	ItemID   string `json:"item_id,omitempty"`
 	Name     string `json:"name"`
 }
 
+// KoboDomainMetadata represents the site an article was published on.
+type KoboDomainMetadata struct {
+	Name string `json:"name"`
+	Logo string `json:"logo,omitempty"`
+}
+
 // KoboImage represents an image associated with an article.
 type KoboImage struct {
 	ImageID string `json:"image_id,omitempty"`
@@ -76,8 +112,29 @@ type KoboImage struct {
 	Src     string `json:"src"`
 }
 
+// KoboVideo represents a video associated with an article.
+type KoboVideo struct {
+	VideoID string `json:"video_id"`
+	ItemID  string `json:"item_id"`
+	Src     string `json:"src"`
+	Width   string `json:"width"`
+	Height  string `json:"height"`
+	Type    string `json:"type"`
+	Vid     string `json:"vid"`
+}
+
 // KoboTag represents a tag associated with an article.
 type KoboTag struct {
 	ItemID string `json:"item_id"`
 	Tag    string `json:"tag"`
 }
+
+// KoboAnnotation represents a highlight associated with an article.
+type KoboAnnotation struct {
+	AnnotationID string `json:"annotation_id"`
+	ItemID       string `json:"item_id"`
+	Quote        string `json:"quote"`
+	Patch        string `json:"patch"`
+	Version      string `json:"version"`
+	CreatedAt    string `json:"created_at"`
+}
@@ -0,0 +1,93 @@
+package models
+
+// PocketAddRequest is the incoming request for /v3/add
+type PocketAddRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Tags        string `json:"tags"`
+}
+
+// PocketAddResponse represents the outgoing response for /v3/add
+type PocketAddResponse struct {
+	Item   PocketItem `json:"item"`
+	Status int        `json:"status"`
+}
+
+// PocketItem represents the item saved by /v3/add
+type PocketItem struct {
+	ItemID    string `json:"item_id,omitempty"`
+	NormalURL string `json:"normal_url"`
+	Title     string `json:"title,omitempty"`
+}
+
+// PocketOAuthRequest is the incoming request for /v3/oauth/request
+type PocketOAuthRequest struct {
+	ConsumerKey string `json:"consumer_key"`
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
+}
+
+// PocketOAuthRequestResponse represents the outgoing response for /v3/oauth/request
+type PocketOAuthRequestResponse struct {
+	Code  string `json:"code"`
+	State string `json:"state,omitempty"`
+}
+
+// PocketOAuthAuthorizeRequest is the incoming request for /v3/oauth/authorize
+type PocketOAuthAuthorizeRequest struct {
+	ConsumerKey string `json:"consumer_key"`
+	Code        string `json:"code"`
+}
+
+// PocketOAuthAuthorizeResponse represents the outgoing response for /v3/oauth/authorize
+type PocketOAuthAuthorizeResponse struct {
+	AccessToken string `json:"access_token"`
+	Username    string `json:"username"`
+}
+
+// PocketDiscoverRequest is the incoming request for /v3/discover and
+// /v3/recommendations
+type PocketDiscoverRequest struct {
+	AccessToken string `json:"access_token"`
+	ConsumerKey string `json:"consumer_key"`
+	Count       string `json:"count,omitempty"`
+}
+
+// SaveRequest is the JSON body accepted by /api/save
+type SaveRequest struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// SaveResponse represents the outgoing response for /api/save
+type SaveResponse struct {
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url"`
+}
+
+// PocketExportItem is a bookmark in the CSV or JSON files of
+// /api/pocket/export and /api/pocket/import, laid out like a Pocket export.
+type PocketExportItem struct {
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	TimeAdded int64  `json:"time_added"`
+	// Tags are separated by "|", as in Pocket's CSV export.
+	Tags string `json:"tags"`
+	// Status is "unread" or "archive".
+	Status string `json:"status"`
+}
+
+// PocketImportResponse represents the outgoing response for /api/pocket/import
+type PocketImportResponse struct {
+	Imported int                   `json:"imported"`
+	Skipped  int                   `json:"skipped"`
+	Failed   []PocketImportFailure `json:"failed"`
+}
+
+// PocketImportFailure is an imported URL Readeck did not save.
+type PocketImportFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,217 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// initialisms are kept in upper case in the Go names of JSON properties.
+var initialisms = map[string]bool{"id": true, "url": true, "uri": true, "ok": true, "html": true, "api": true}
+
+// GenerateClient writes the Go source of package pkg with a type for each
+// schema of doc and a method of Client for each operation. The package
+// provides Client and its do and doRaw methods itself.
+func GenerateClient(doc *Document, pkg, generator string) ([]byte, error) {
+	g := &clientGenerator{imports: map[string]bool{"context": true}}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		g.writeType(name, doc.Components.Schemas[name])
+	}
+	for _, op := range doc.operations {
+		g.writeMethod(op)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by %s; DO NOT EDIT.\n\npackage %s\n\nimport (\n", generator, pkg)
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	slices.Sort(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	out.WriteString(")\n")
+	out.Write(g.body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated client: %w", err)
+	}
+	return src, nil
+}
+
+type clientGenerator struct {
+	body    bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *clientGenerator) writeType(name string, s *Schema) {
+	fmt.Fprintf(&g.body, "\n// %s is the %s schema of the API.\ntype %s struct {\n", name, name, name)
+	for _, prop := range s.order {
+		field := s.Properties[prop]
+		typ := g.goType(field)
+		opt := ""
+		if !slices.Contains(s.Required, prop) {
+			opt = ",omitempty"
+			if typ == "time.Time" || field.Ref != "" && !field.Nullable {
+				opt = ",omitzero"
+			}
+		}
+		fmt.Fprintf(&g.body, "\t%s %s `json:\"%s%s\"`\n", goName(prop), typ, prop, opt)
+	}
+	g.body.WriteString("}\n")
+}
+
+func (g *clientGenerator) writeMethod(op *Operation) {
+	var args []string
+	path := fmt.Sprintf("%q", op.path)
+	var query []Parameter
+	for _, param := range op.Parameters {
+		arg := argName(param.Name)
+		args = append(args, arg+" string")
+		if param.In == "path" {
+			g.imports["net/url"] = true
+			path = strings.Replace(path, "{"+param.Name+"}", `" + url.PathEscape(`+arg+`) + "`, 1)
+			path = strings.TrimSuffix(strings.TrimPrefix(path, `"" + `), ` + ""`)
+		} else {
+			query = append(query, param)
+		}
+	}
+	body := "nil"
+	if op.RequestBody != nil {
+		args = append(args, "body "+g.refType(op.RequestBody.Content["application/json"].Schema))
+		body = "body"
+	}
+
+	name := exported(op.OperationID)
+	fmt.Fprintf(&g.body, "\n// %s calls %s %s.\n", name, op.method, op.path)
+	if op.Summary != "" {
+		fmt.Fprintf(&g.body, "// %s.\n", op.Summary)
+	}
+
+	result := "[]byte"
+	var response *Schema
+	if content, ok := op.Responses["200"].Content["application/json"]; ok {
+		response = content.Schema
+		result = g.refType(response)
+	}
+	fmt.Fprintf(&g.body, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(append([]string{"ctx context.Context"}, args...), ", "), result)
+
+	queryArg := "nil"
+	if len(query) > 0 {
+		g.imports["net/url"] = true
+		queryArg = "query"
+		g.body.WriteString("\tquery := url.Values{}\n")
+		for _, param := range query {
+			arg := argName(param.Name)
+			fmt.Fprintf(&g.body, "\tif %s != \"\" {\n\t\tquery.Set(%q, %s)\n\t}\n", arg, param.Name, arg)
+		}
+	}
+	if response == nil {
+		fmt.Fprintf(&g.body, "\treturn c.doRaw(ctx, %q, %s, %s, %s)\n}\n", op.method, path, queryArg, body)
+		return
+	}
+	ret := "out"
+	if strings.HasPrefix(result, "*") {
+		ret = "&out"
+	}
+	fmt.Fprintf(&g.body, "\tvar out %s\n", strings.TrimPrefix(result, "*"))
+	fmt.Fprintf(&g.body, "\tif err := c.do(ctx, %q, %s, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn %s, nil\n}\n", op.method, path, queryArg, body, ret)
+}
+
+// goType returns the Go type of s.
+func (g *clientGenerator) goType(s *Schema) string {
+	var typ string
+	switch {
+	case s.Ref != "":
+		typ = s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	case s.Type == "string" && s.Format == "date-time":
+		g.imports["time"] = true
+		typ = "time.Time"
+	case s.Type == "string" && (s.Format == "byte" || s.Format == "binary"):
+		return "[]byte"
+	case s.Type == "string":
+		typ = "string"
+	case s.Type == "integer" && s.Format == "int64":
+		typ = "int64"
+	case s.Type == "integer" && s.Format == "uint64":
+		typ = "uint64"
+	case s.Type == "integer":
+		typ = "int"
+	case s.Type == "number":
+		typ = "float64"
+	case s.Type == "boolean":
+		typ = "bool"
+	case s.Type == "array":
+		return "[]" + g.goType(s.Items)
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map[string]" + g.goType(s.AdditionalProperties)
+	default:
+		return "any"
+	}
+	if s.Nullable {
+		return "*" + typ
+	}
+	return typ
+}
+
+// refType returns the Go type of a body or response of schema s: a pointer
+// to a named type, or a slice or map as is.
+func (g *clientGenerator) refType(s *Schema) string {
+	typ := g.goType(s)
+	if s.Ref == "" {
+		return typ
+	}
+	return "*" + strings.TrimPrefix(typ, "*")
+}
+
+// goName turns a JSON property name such as "item_id" or "contentType" into
+// a Go name such as "ItemID" or "ContentType".
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(exported(word))
+	}
+	return b.String()
+}
+
+// unexported returns a Go name with its leading word in lower case, for an
+// argument.
+func unexported(name string) string {
+	r := []rune(name)
+	for i := range r {
+		if i > 0 && unicode.IsLower(r[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// argName returns the name of the argument of param, clear of the names the
+// generated methods use.
+func argName(param string) string {
+	name := unexported(goName(param))
+	switch name {
+	case "ctx", "body", "query", "out", "url", "c", "type", "func", "range":
+		return name + "Param"
+	}
+	return name
+}
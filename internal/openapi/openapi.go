@@ -0,0 +1,332 @@
+// Package openapi describes readeckobo's HTTP API as an OpenAPI 3.0 document
+// whose schemas are reflected from the Go types the handlers encode, and
+// generates a typed Go client from that document.
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	// operations are kept in the order they were added, for the client.
+	operations []*Operation
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of one path by lowercase method.
+type PathItem map[string]*Operation
+
+// Operation is one method of a path.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+
+	method string
+	path   string
+}
+
+// Parameter is a path or query parameter; all are strings.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body of one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the schemas of named types and the security schemes.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is how an operation is authenticated.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the subset of JSON Schema the reflected types need.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+
+	// order lists the properties in the order of the Go fields.
+	order []string
+}
+
+// Route describes one endpoint for Builder.Add.
+type Route struct {
+	Method string
+	// Path may hold {name} parameters, which are required path parameters.
+	Path string
+	// ID names the operation and the client method.
+	ID      string
+	Summary string
+	Tag     string
+	// Security names a scheme added with Builder.AddSecurityScheme.
+	Security string
+	Query    []Parameter
+	// Request is a value of the JSON body type, or nil.
+	Request any
+	// Response is a value of the JSON response type, or nil for a response
+	// of ContentType.
+	Response    any
+	ContentType string
+}
+
+// Builder collects routes into a Document.
+type Builder struct {
+	doc   *Document
+	names map[reflect.Type]string
+}
+
+// NewBuilder starts a document describing the API title at version.
+func NewBuilder(title, version, description string) *Builder {
+	return &Builder{
+		doc: &Document{
+			OpenAPI: "3.0.3",
+			Info:    Info{Title: title, Version: version, Description: description},
+			Paths:   make(map[string]*PathItem),
+			Components: Components{
+				Schemas:         make(map[string]*Schema),
+				SecuritySchemes: make(map[string]SecurityScheme),
+			},
+		},
+		names: make(map[reflect.Type]string),
+	}
+}
+
+// AddSecurityScheme registers scheme as name.
+func (b *Builder) AddSecurityScheme(name string, scheme SecurityScheme) {
+	b.doc.Components.SecuritySchemes[name] = scheme
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// Add describes route, reflecting the schemas of its body and response.
+func (b *Builder) Add(route Route) {
+	op := &Operation{
+		OperationID: route.ID,
+		Summary:     route.Summary,
+		Responses:   make(map[string]Response),
+		method:      route.Method,
+		path:        route.Path,
+	}
+	if route.Tag != "" {
+		op.Tags = []string{route.Tag}
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, param := range route.Query {
+		param.In = "query"
+		param.Schema = &Schema{Type: "string"}
+		op.Parameters = append(op.Parameters, param)
+	}
+	if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: b.schema(reflect.TypeOf(route.Request))}},
+		}
+	}
+	switch {
+	case route.Response != nil:
+		op.Responses["200"] = Response{
+			Description: "OK",
+			Content:     map[string]MediaType{"application/json": {Schema: b.schema(reflect.TypeOf(route.Response))}},
+		}
+	case route.ContentType != "":
+		op.Responses["200"] = Response{
+			Description: "OK",
+			Content:     map[string]MediaType{route.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}}},
+		}
+	default:
+		op.Responses["200"] = Response{Description: "OK"}
+	}
+	op.Responses["default"] = Response{Description: "Error"}
+	if route.Security != "" {
+		op.Security = []map[string][]string{{route.Security: {}}}
+	}
+
+	item, ok := b.doc.Paths[route.Path]
+	if !ok {
+		item = &PathItem{}
+		b.doc.Paths[route.Path] = item
+	}
+	(*item)[strings.ToLower(route.Method)] = op
+	b.doc.operations = append(b.doc.operations, op)
+}
+
+// Document returns the document built so far.
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// schema returns the schema of t, registering named structs as components
+// and referring to them.
+func (b *Builder) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		s := b.schema(t.Elem())
+		if s.Ref != "" {
+			return &Schema{Ref: s.Ref, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "uint64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+	// Interfaces take any JSON value.
+	return &Schema{}
+}
+
+// component registers the named struct t and returns its schema's name.
+func (b *Builder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := exported(t.Name())
+	if _, taken := b.doc.Components.Schemas[name]; taken {
+		name = exported(t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]) + name
+	}
+	b.names[t] = name
+	// The placeholder ends the recursion of self-referencing types.
+	b.doc.Components.Schemas[name] = &Schema{}
+	*b.doc.Components.Schemas[name] = *b.structSchema(t)
+	return name
+}
+
+// structSchema describes the JSON object encoding/json makes of t, with the
+// fields of embedded structs promoted.
+func (b *Builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	b.addFields(s, t)
+	return s
+}
+
+func (b *Builder) addFields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.addFields(s, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := s.Properties[name]; !ok {
+			s.order = append(s.order, name)
+		}
+		s.Properties[name] = b.schema(field.Type)
+		optional := slices.ContainsFunc(strings.Split(opts, ","), func(opt string) bool {
+			return opt == "omitempty" || opt == "omitzero"
+		})
+		if !optional {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// exported returns name with its first letter in upper case.
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
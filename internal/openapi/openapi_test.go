@@ -0,0 +1,93 @@
+package openapi
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testInner struct {
+	Count int64 `json:"count"`
+}
+
+type testEntry struct {
+	Name string `json:"name"`
+	testInner
+	Note    string            `json:"note,omitempty"`
+	Seen    time.Time         `json:"seen,omitzero"`
+	Next    *testEntry        `json:"next,omitempty"`
+	Tags    map[string]string `json:"tags"`
+	Any     any               `json:"any"`
+	Skipped string            `json:"-"`
+	private string
+}
+
+func TestBuilderReflectsSchemas(t *testing.T) {
+	b := NewBuilder("test", "1", "")
+	b.Add(Route{Method: "POST", Path: "/entries/{id}", ID: "addEntry", Request: testEntry{}, Response: []testEntry{}})
+	doc := b.Document()
+
+	op := (*doc.Paths["/entries/{id}"])["post"]
+	if op == nil || len(op.Parameters) != 1 || op.Parameters[0].In != "path" || !op.Parameters[0].Required {
+		t.Fatalf("expected a required path parameter, got %+v", op)
+	}
+	if ref := op.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/TestEntry" {
+		t.Errorf("expected the body to refer to TestEntry, got %q", ref)
+	}
+	if items := op.Responses["200"].Content["application/json"].Schema.Items; items == nil || items.Ref == "" {
+		t.Errorf("expected an array of TestEntry, got %+v", op.Responses["200"])
+	}
+
+	entry := doc.Components.Schemas["TestEntry"]
+	if entry == nil {
+		t.Fatal("expected a TestEntry schema")
+	}
+	if want := []string{"name", "count", "note", "seen", "next", "tags", "any"}; !slices.Equal(entry.order, want) {
+		t.Errorf("expected properties %v, got %v", want, entry.order)
+	}
+	if want := []string{"name", "count", "tags", "any"}; !slices.Equal(entry.Required, want) {
+		t.Errorf("expected required %v, got %v", want, entry.Required)
+	}
+	if s := entry.Properties["seen"]; s.Format != "date-time" {
+		t.Errorf("expected seen as a date-time, got %+v", s)
+	}
+	if s := entry.Properties["next"]; !s.Nullable || s.Ref != "#/components/schemas/TestEntry" {
+		t.Errorf("expected next as a nullable reference, got %+v", s)
+	}
+	if s := entry.Properties["tags"]; s.AdditionalProperties == nil || s.AdditionalProperties.Type != "string" {
+		t.Errorf("expected tags as a map of strings, got %+v", s)
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	b := NewBuilder("test", "1", "")
+	b.Add(Route{Method: "GET", Path: "/entries", ID: "listEntries", Summary: "Lists entries", Query: []Parameter{{Name: "url"}}, Response: []testEntry{}})
+	b.Add(Route{Method: "POST", Path: "/entries/{id}/retry", ID: "retryEntry", Request: testEntry{}, Response: testEntry{}})
+	b.Add(Route{Method: "GET", Path: "/feed", ID: "feed", ContentType: "application/atom+xml"})
+
+	src, err := GenerateClient(b.Document(), "example", "test")
+	if err != nil {
+		t.Fatalf("GenerateClient failed: %v", err)
+	}
+	for _, want := range []string{
+		"func (c *Client) ListEntries(ctx context.Context, urlParam string) ([]TestEntry, error)",
+		"func (c *Client) RetryEntry(ctx context.Context, id string, body *TestEntry) (*TestEntry, error)",
+		`"/entries/"+url.PathEscape(id)+"/retry"`,
+		"func (c *Client) Feed(ctx context.Context) ([]byte, error)",
+		"Next  *TestEntry",
+		"`json:\"seen,omitzero\"`",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("expected the client to contain %q, got:\n%s", want, src)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, want := range map[string]string{"item_id": "ItemID", "contentType": "ContentType", "_optional": "Optional", "given_url": "GivenURL"} {
+		if got := goName(name); got != want {
+			t.Errorf("goName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package proxy selects the outbound proxy for the Readeck client and the
+// image fetcher, which may need different proxies to reach their hosts.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Direct is the proxy URL that disables proxying, even when HTTP_PROXY is
+// set.
+const Direct = "direct"
+
+// Config selects the proxy for one kind of outbound request.
+type Config struct {
+	// URL is the proxy to use, or Direct for none. Empty honors the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	URL string
+	// NoProxy lists the hosts reached without a proxy, in NO_PROXY syntax.
+	// It replaces NO_PROXY from the environment when set.
+	NoProxy string
+}
+
+// Func returns the proxy function for c, for use as http.Transport.Proxy.
+// Requests to localhost are never proxied.
+func (c Config) Func() (func(*http.Request) (*url.URL, error), error) {
+	var pc *httpproxy.Config
+	switch c.URL {
+	case Direct:
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	case "":
+		pc = httpproxy.FromEnvironment()
+	default:
+		u, err := url.Parse(c.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", c.URL)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		pc = &httpproxy.Config{HTTPProxy: c.URL, HTTPSProxy: c.URL}
+	}
+	if c.NoProxy != "" {
+		pc.NoProxy = c.NoProxy
+	}
+
+	proxyFunc := pc.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+// Transport returns a copy of http.DefaultTransport using the proxy of c.
+func (c Config) Transport() (*http.Transport, error) {
+	proxyFunc, err := c.Func()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	return transport, nil
+}
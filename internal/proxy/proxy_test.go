@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFunc(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://env-proxy:3128")
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("NO_PROXY", "readeck.lan")
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{name: "environment", cfg: Config{}, url: "https://images.example.com/a.jpg", want: "http://env-proxy:3128"},
+		{name: "environment NO_PROXY", cfg: Config{}, url: "https://readeck.lan/api/bookmarks", want: ""},
+		{name: "no_proxy replaces NO_PROXY", cfg: Config{NoProxy: "example.com"}, url: "https://readeck.lan/api/bookmarks", want: "http://env-proxy:3128"},
+		{name: "direct", cfg: Config{URL: Direct}, url: "https://images.example.com/a.jpg", want: ""},
+		{name: "explicit proxy", cfg: Config{URL: "socks5://proxy.lan:1080"}, url: "http://images.example.com/a.jpg", want: "socks5://proxy.lan:1080"},
+		{name: "explicit proxy with no_proxy", cfg: Config{URL: "http://proxy.lan:3128", NoProxy: ".example.com"}, url: "https://images.example.com/a.jpg", want: ""},
+		{name: "localhost is never proxied", cfg: Config{URL: "http://proxy.lan:3128"}, url: "http://localhost:8000/api", want: ""},
+		{name: "unsupported scheme", cfg: Config{URL: "ftp://proxy.lan"}, wantErr: true},
+		{name: "missing host", cfg: Config{URL: "proxy.lan:3128"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyFunc, err := tt.cfg.Func()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Func() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			got, err := proxyFunc(req)
+			if err != nil {
+				t.Fatalf("proxy function failed: %v", err)
+			}
+			gotURL := ""
+			if got != nil {
+				gotURL = got.String()
+			}
+			if gotURL != tt.want {
+				t.Errorf("Expected proxy %q for %s, got %q", tt.want, tt.url, gotURL)
+			}
+		})
+	}
+}
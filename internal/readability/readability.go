@@ -0,0 +1,309 @@
+// Package readability extracts the main content of a web page, for the
+// bookmarks whose page Readeck could not extract. It scores the blocks of
+// the page by their text, as Mozilla's Readability does, and keeps the best
+// one.
+package readability
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoContent is returned for pages without a block of readable text.
+var ErrNoContent = errors.New("no readable content")
+
+// minContentLength is the shortest text, in characters, accepted as the
+// content of a page.
+const minContentLength = 140
+
+// minParagraphLength is the shortest text of a block that counts towards
+// the score of its ancestors.
+const minParagraphLength = 25
+
+// Article is the readable content of a page.
+type Article struct {
+	Title string
+	// Content is the HTML of the element holding the page's content.
+	Content string
+}
+
+var (
+	// unlikely matches the class and id of page furniture, which is removed
+	// unless maybe matches too.
+	unlikely = regexp.MustCompile(`(?i)banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote|cookie|newsletter|subscribe`)
+	maybe    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	// positive and negative weigh the score of an element by its class and id.
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removedElements never hold content.
+var removedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Form:     true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Button:   true,
+	atom.Input:    true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Link:     true,
+	atom.Meta:     true,
+}
+
+// blockElements are the elements that make a div more than a paragraph.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Div: true, atom.Dl: true,
+	atom.Figure: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+	atom.H6: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Table: true,
+	atom.Ul: true,
+}
+
+// Extract reads the page r and returns its title and content.
+func Extract(r io.Reader) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %w", err)
+	}
+	article := &Article{Title: pageTitle(doc)}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return nil, ErrNoContent
+	}
+	clean(body)
+
+	top := topCandidate(body)
+	if top == nil || len(strings.TrimSpace(textContent(top))) < minContentLength {
+		return nil, ErrNoContent
+	}
+	lazyImages(top)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, top); err != nil {
+		return nil, fmt.Errorf("failed to render content: %w", err)
+	}
+	article.Content = buf.String()
+	return article, nil
+}
+
+// pageTitle returns the page's og:title, or its title element.
+func pageTitle(doc *html.Node) string {
+	var ogTitle, title string
+	walkElements(doc, func(n *html.Node) {
+		switch {
+		case n.DataAtom == atom.Meta && getAttr(n, "property") == "og:title" && ogTitle == "":
+			ogTitle = strings.TrimSpace(getAttr(n, "content"))
+		case n.DataAtom == atom.Title && title == "":
+			title = strings.TrimSpace(textContent(n))
+		}
+	})
+	if ogTitle != "" {
+		return ogTitle
+	}
+	return title
+}
+
+// clean removes the elements of n that never hold content, and those whose
+// class or id names page furniture.
+func clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type != html.ElementNode:
+		case removedElements[c.DataAtom] || isUnlikely(c):
+			n.RemoveChild(c)
+		default:
+			clean(c)
+		}
+		c = next
+	}
+}
+
+func isUnlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.Body {
+		return false
+	}
+	match := getAttr(n, "class") + " " + getAttr(n, "id")
+	return unlikely.MatchString(match) && !maybe.MatchString(match)
+}
+
+// topCandidate scores the ancestors of every paragraph by its text and
+// returns the best scored element.
+func topCandidate(body *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+	score := func(n *html.Node, points float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			order = append(order, n)
+		}
+		scores[n] += points
+	}
+
+	walkElements(body, func(n *html.Node) {
+		if !isParagraph(n) {
+			return
+		}
+		text := strings.TrimSpace(textContent(n))
+		if len(text) < minParagraphLength {
+			return
+		}
+		points := 1 + float64(strings.Count(text, ",")) + min(float64(len(text)/100), 3)
+		score(n.Parent, points)
+		if n.Parent != nil {
+			score(n.Parent.Parent, points/2)
+		}
+	})
+
+	var top *html.Node
+	var best float64
+	for _, n := range order {
+		s := scores[n] * (1 - linkDensity(n))
+		if top == nil || s > best {
+			top, best = n, s
+		}
+	}
+	return top
+}
+
+// isParagraph reports whether n is a block of text: a paragraph, or a div
+// without other blocks in it.
+func isParagraph(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		return true
+	case atom.Div:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && blockElements[c.DataAtom] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	var s float64
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main, atom.Section:
+		s = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		s = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s = -5
+	}
+	for _, name := range []string{getAttr(n, "class"), getAttr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negative.MatchString(name) {
+			s -= 25
+		}
+		if positive.MatchString(name) {
+			s += 25
+		}
+	}
+	return s
+}
+
+// linkDensity is the share of the text of n that is in links.
+func linkDensity(n *html.Node) float64 {
+	total := len(strings.TrimSpace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	var links int
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			links += len(strings.TrimSpace(textContent(c)))
+		}
+	})
+	return float64(links) / float64(total)
+}
+
+// lazyImages gives the images that are loaded by scripts their source.
+func lazyImages(n *html.Node) {
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom != atom.Img || getAttr(c, "src") != "" && !strings.HasPrefix(getAttr(c, "src"), "data:") {
+			return
+		}
+		for _, key := range []string{"data-src", "data-original", "data-lazy-src"} {
+			if src := getAttr(c, key); src != "" {
+				setAttr(c, "src", src)
+				return
+			}
+		}
+	})
+}
+
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkElements(n, func(c *html.Node) {
+		if found == nil && c.DataAtom == a {
+			found = c
+		}
+	})
+	return found
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, attr := range n.Attr {
+		if attr.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
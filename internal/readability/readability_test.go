@@ -0,0 +1,73 @@
+package readability
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<title>Site | A long read</title>
+<meta property="og:title" content="A long read">
+<script>var tracking = "Script text";</script>
+</head>
+<body>
+<header><a href="/">Home</a> <a href="/about">About us and the whole team</a></header>
+<nav><ul><li><a href="/a">A menu entry with a fairly long title</a></li></ul></nav>
+<div class="layout">
+  <div class="sidebar"><p>Sidebar promotion with enough text to count, really.</p></div>
+  <article class="post">
+    <h1>A long read</h1>
+    <p>The first paragraph of the story, which goes on for a while, with commas, clauses, and more.</p>
+    <p>The second paragraph continues the story, adding detail after detail, so that it scores well.</p>
+    <p><img data-src="/lazy.jpg" src="data:image/gif;base64,R0lGOD"></p>
+    <p>A third paragraph closes the story with a last thought, and a little more text to be sure.</p>
+  </article>
+  <div id="comments"><p>A comment from a reader, who has opinions, many of them, all strong.</p></div>
+</div>
+<footer><p>Copyright and a list of links nobody reads at all.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	article, err := Extract(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if article.Title != "A long read" {
+		t.Errorf("expected the og:title, got %q", article.Title)
+	}
+	if !strings.HasPrefix(article.Content, `<article class="post">`) {
+		t.Errorf("expected the article element, got %s", article.Content)
+	}
+	for _, want := range []string{"The first paragraph", "A third paragraph", `src="/lazy.jpg"`} {
+		if !strings.Contains(article.Content, want) {
+			t.Errorf("expected the content to contain %q, got %s", want, article.Content)
+		}
+	}
+	for _, unwanted := range []string{"Sidebar", "A comment", "Copyright", "menu entry", "Script text"} {
+		if strings.Contains(article.Content, unwanted) {
+			t.Errorf("expected the content not to contain %q, got %s", unwanted, article.Content)
+		}
+	}
+}
+
+func TestExtractNoContent(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+	}{
+		{name: "empty", page: ""},
+		{name: "short", page: "<p>Just a line.</p>"},
+		{name: "only navigation", page: `<nav><p>` + strings.Repeat("A long navigation entry, ", 20) + `</p></nav>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Extract(strings.NewReader(tt.page)); !errors.Is(err, ErrNoContent) {
+				t.Errorf("expected ErrNoContent, got %v", err)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"mime"
 	"mime/multipart"
 	"net/http"
@@ -13,34 +15,68 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 	"readeckobo/internal/logger"
+	"readeckobo/internal/tracing"
 )
 
 const (
-	defaultHTTPTimeout = 10 * time.Second
+	defaultTimeout           = 10 * time.Second
+	defaultSyncTimeout       = 2 * time.Minute
+	defaultArticleTimeout    = 30 * time.Second
+	defaultMutationTimeout   = 5 * time.Second
+	defaultDetailConcurrency = 4
 )
 
+// Timeouts bound each kind of Readeck call through its context; a zero
+// value uses the default for that kind.
+type Timeouts struct {
+	// Sync covers the sync endpoints, which may stream thousands of bookmarks.
+	Sync time.Duration
+	// Article covers fetching an article's HTML.
+	Article time.Duration
+	// Mutation covers creating and updating bookmarks and logging in.
+	Mutation time.Duration
+	// Default covers every other call.
+	Default time.Duration
+}
+
 // Client represents a Readeck API client.
 type Client struct {
 	BaseURL    *url.URL
 	AccessToken string
 	HTTPClient *http.Client
 	Logger     *logger.Logger // New field
+	// TokenRefresher, when set, is called with the access token Readeck
+	// rejected. A returned token replaces AccessToken and the request is
+	// retried once; an error leaves the original 401 response in place.
+	TokenRefresher func(ctx context.Context, rejected string) (string, error)
+	// TokenAccepted, when set, is called after Readeck answers a request with
+	// anything but 401, which confirms the access token.
+	TokenAccepted func()
+	// DetailConcurrency bounds the parallel per-bookmark requests made when
+	// the server does not support the multipart sync endpoint.
+	DetailConcurrency int
+	Timeouts          Timeouts
+	// StrictDecoding rejects responses with fields unknown to the client, to
+	// diagnose a Readeck version that renamed them.
+	StrictDecoding bool
+	// Limiters pace every request to Readeck, such as one shared by all
+	// clients and one for the client's user.
+	Limiters []*RateLimiter
+
+	// tokenMu guards AccessToken, which a refresh replaces while other
+	// requests of a shared client are in flight.
+	tokenMu sync.RWMutex
 }
 
 // NewClient creates a new Readeck API client.
-// APIError represents an error returned by the Readeck API.
-type APIError struct {
-	StatusCode int
-	Message    string
-}
-
-func (e *APIError) Error() string {
-	return fmt.Sprintf("API error: %s (status: %d)", e.Message, e.StatusCode)
-}
-
 func NewClient(baseURL string, accessToken string, logger *logger.Logger, httpClient *http.Client) (*Client, error) {
 	parsedURL, err := url.ParseRequestURI(baseURL)
 	if err != nil {
@@ -48,8 +84,9 @@ func NewClient(baseURL string, accessToken string, logger *logger.Logger, httpCl
 	}
 
 	if httpClient == nil {
-		httpClient = &http.Client{
-			Timeout: defaultHTTPTimeout,
+		httpClient, err = NewHTTPClient(TLSConfig{}, TransportConfig{}, nil)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -61,8 +98,114 @@ func NewClient(baseURL string, accessToken string, logger *logger.Logger, httpCl
 	}, nil
 }
 
-// doRequest performs an HTTP request and decodes the response.
-func (c *Client) doRequest(ctx context.Context, method, path string, queryParams url.Values, body any, v any) (string, error) {
+// withTimeout bounds ctx by timeout, or by fallback when timeout is zero.
+func (c *Client) withTimeout(ctx context.Context, timeout, fallback time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = fallback
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Token returns the access token the client currently sends.
+func (c *Client) Token() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.AccessToken
+}
+
+// SetAccessToken replaces the access token sent by later requests.
+func (c *Client) SetAccessToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.AccessToken = token
+}
+
+func (c *Client) setAuthorization(req *http.Request) {
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Del("Authorization")
+	}
+}
+
+// execute sends req, retrying once with a refreshed token if Readeck answers
+// 401 and a TokenRefresher is configured. A token refreshed by another
+// request meanwhile is retried without refreshing it again.
+func (c *Client) execute(req *http.Request) (*http.Response, error) {
+	if err := c.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	sent := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	resp, err := c.HTTPClient.Do(req)
+	recordResponse(req, resp, err)
+	if err == nil && resp.StatusCode != http.StatusUnauthorized && c.TokenAccepted != nil {
+		c.TokenAccepted()
+	}
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.TokenRefresher == nil {
+		return resp, err
+	}
+
+	token := c.Token()
+	if token == sent {
+		var refreshErr error
+		token, refreshErr = c.TokenRefresher(req.Context(), sent)
+		if refreshErr != nil {
+			c.Logger.Warnf("Readeck rejected the access token and it could not be refreshed: %v", refreshErr)
+			return resp, nil
+		}
+		c.SetAccessToken(token)
+	}
+	_ = resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+	}
+	c.setAuthorization(retry)
+	if err := c.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err = c.HTTPClient.Do(retry)
+	recordResponse(retry, resp, err)
+	if err == nil && resp.StatusCode != http.StatusUnauthorized && c.TokenAccepted != nil {
+		c.TokenAccepted()
+	}
+	return resp, err
+}
+
+// wait holds a request back until every limiter of the client allows it.
+func (c *Client) wait(ctx context.Context) error {
+	for _, limiter := range c.Limiters {
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("failed to wait for the rate limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// recordResponse annotates the span of the calling client method with the
+// outcome of one HTTP exchange.
+func recordResponse(req *http.Request, resp *http.Response, err error) {
+	span := trace.SpanFromContext(req.Context())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.Int("http.response.status_code", resp.StatusCode),
+	)
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+}
+
+// doRequest performs an HTTP request and decodes the response. It returns the
+// response headers, which carry Readeck's pagination information.
+func (c *Client) doRequest(ctx context.Context, method, path string, queryParams url.Values, body any, v any) (http.Header, error) {
 	reqURL := c.BaseURL.JoinPath(path)
 	reqURL.RawQuery = queryParams.Encode()
 
@@ -70,38 +213,41 @@ func (c *Client) doRequest(ctx context.Context, method, path string, queryParams
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal request body: %w", err)
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
 		reqBody = bytes.NewBuffer(jsonBody)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, reqURL.String(), reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	c.setAuthorization(req)
 	    if body != nil {
 	        req.Header.Set("Content-Type", "application/json")
 	    }
 	
-	    resp, err := c.HTTPClient.Do(req)
+	    resp, err := c.execute(req)
 	    if err != nil {
-	        return "", fmt.Errorf("failed to execute request: %w", err)
+	        return nil, fmt.Errorf("failed to execute request: %w", err)
 	    }
 	    defer func() { _ = resp.Body.Close() }()
 	
 	    if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-	        return "", &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	        return nil, newAPIError(resp)
 	    }
 	if v != nil {
-		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
-			return "", fmt.Errorf("failed to decode response body: %w", err)
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if err := decodeResponse(data, v, c.StrictDecoding, method+" "+path); err != nil {
+			return nil, err
 		}
 	}
 
-	totalPages := resp.Header.Get("Total-Pages")
-	return totalPages, nil
+	return resp.Header, nil
 }
 
 // doRequestRaw performs an HTTP request and returns the raw http.Response.
@@ -123,7 +269,7 @@ func (c *Client) doRequestRaw(ctx context.Context, method, path string, queryPar
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	c.setAuthorization(req)
 	req.Header.Set("Accept", "multipart/mixed") // Always accept multipart/mixed for Readeck API
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json") // Ensure Content-Type is set for requests with a body
@@ -134,10 +280,10 @@ func (c *Client) doRequestRaw(ctx context.Context, method, path string, queryPar
 	if err != nil {
 		c.Logger.Errorf("Failed to dump outgoing request: %v", err)
 	} else {
-		c.Logger.Debugf("Outgoing Readeck API Request:\n%s", dump)
+		c.Logger.Debugf("Outgoing Readeck API Request:\n%s", c.Logger.Redact(dump))
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.execute(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
@@ -152,15 +298,14 @@ func (c *Client) doRequestRaw(ctx context.Context, method, path string, queryPar
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		defer func() { _ = resp.Body.Close() }()
-		respBodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%s: %s", resp.Status, string(respBodyBytes))}
+		return nil, newAPIError(resp)
 	}
 
 	return resp, nil
 }
 
 // parseMultipartBookmarkResponse parses a multipart/mixed response containing bookmark details.
-func parseMultipartBookmarkResponse(resp *http.Response, logger *logger.Logger) ([]Bookmark, error) {
+func parseMultipartBookmarkResponse(resp *http.Response, logger *logger.Logger, strict bool) ([]Bookmark, error) {
 	defer func() { _ = resp.Body.Close() }()
 
 	logger.Debugf("Parsing multipart response. Overall Content-Type: %s", resp.Header.Get("Content-Type"))
@@ -206,7 +351,7 @@ func parseMultipartBookmarkResponse(resp *http.Response, logger *logger.Logger)
 			logger.Debugf("Raw JSON part content: %s", string(partBytes))
 
 			var bookmark Bookmark
-			if err := json.Unmarshal(partBytes, &bookmark); err != nil {
+			if err := decodeResponse(partBytes, &bookmark, strict, "POST /api/bookmarks/sync"); err != nil {
 				logger.Warnf("Failed to decode bookmark JSON part: %v, content: %s", err, string(partBytes))
 				_ = p.Close()
 				continue
@@ -224,24 +369,78 @@ func parseMultipartBookmarkResponse(resp *http.Response, logger *logger.Logger)
 
 // GetBookmarksSync fetches bookmark synchronization events.
 func (c *Client) GetBookmarksSync(ctx context.Context, since *time.Time) ([]BookmarkSync, error) {
+	ctx, span := tracing.Start(ctx, "readeck.sync")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Sync, defaultSyncTimeout)
+	defer cancel()
+
 	queryParams := url.Values{}
 	if since != nil {
 		queryParams.Add("since", strconv.FormatInt(since.Unix(), 10))
 	}
 
+	// Large libraries get the feed in pages, announced with a Link header or
+	// Total-Pages.
 	var bookmarks []BookmarkSync
-	_, err := c.doRequest(ctx, http.MethodGet, "/api/bookmarks/sync", queryParams, nil, &bookmarks)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch bookmark syncs: %w", err)
+	for page := 1; ; page++ {
+		var items []BookmarkSync
+		header, err := c.doRequest(ctx, http.MethodGet, "/api/bookmarks/sync", queryParams, nil, &items)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch bookmark syncs page %d: %w", page, err)
+		}
+		bookmarks = append(bookmarks, items...)
+
+		next, ok := nextPageQuery(header, queryParams, page)
+		if !ok || page >= maxSyncPages {
+			return bookmarks, nil
+		}
+		queryParams = next
 	}
+}
 
-	return bookmarks, nil
+// maxSyncPages stops following a sync feed whose pages never end.
+const maxSyncPages = 1000
+
+// nextPageQuery returns the query of the page after page, from the rel="next"
+// Link or else the Total-Pages header of its response. Only the query of a
+// link is used, so a link can never send the token elsewhere.
+func nextPageQuery(header http.Header, query url.Values, page int) (url.Values, bool) {
+	for _, link := range header.Values("Link") {
+		for part := range strings.SplitSeq(link, ",") {
+			target, params, ok := strings.Cut(part, ";")
+			if !ok || !strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+				continue
+			}
+			u, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+			if err != nil {
+				continue
+			}
+			next := u.Query()
+			if next.Encode() == query.Encode() {
+				return nil, false
+			}
+			return next, true
+		}
+	}
+
+	totalPages, err := strconv.Atoi(header.Get("Total-Pages"))
+	if err != nil || page >= totalPages {
+		return nil, false
+	}
+	next := maps.Clone(query)
+	next.Set("page", strconv.Itoa(page+1))
+	return next, true
 }
 
 // GetBookmarks fetches bookmarks for a specific site.
 // This implementation does not handle pagination yet, it only fetches the first page.
 // Pagination will be added later if needed.
 func (c *Client) GetBookmarks(ctx context.Context, site string, page int, isArchived *bool) ([]Bookmark, int, error) {
+	ctx, span := tracing.Start(ctx, "readeck.search")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Default, defaultTimeout)
+	defer cancel()
+
 	queryParams := url.Values{}
 	if site != "" {
 		queryParams.Add("site", site)
@@ -254,12 +453,12 @@ func (c *Client) GetBookmarks(ctx context.Context, site string, page int, isArch
 	}
 
 	var bookmarks []Bookmark
-	totalPagesStr, err := c.doRequest(ctx, http.MethodGet, "/api/bookmarks", queryParams, nil, &bookmarks)
+	header, err := c.doRequest(ctx, http.MethodGet, "/api/bookmarks", queryParams, nil, &bookmarks)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to fetch bookmarks: %w", err)
 	}
 
-	totalPages, err := strconv.Atoi(totalPagesStr)
+	totalPages, err := strconv.Atoi(header.Get("Total-Pages"))
 	if err != nil {
 		totalPages = 1 // Default to 1 if header is missing or invalid
 	}
@@ -267,8 +466,79 @@ func (c *Client) GetBookmarks(ctx context.Context, site string, page int, isArch
 	return bookmarks, totalPages, nil
 }
 
+// ListBookmarksOptions filters and pages the bookmark list.
+type ListBookmarksOptions struct {
+	IsArchived *bool
+	// Collection limits the list to the bookmarks of a collection ID.
+	Collection string
+	// Search limits the list to the bookmarks matching Readeck's full-text
+	// search.
+	Search string
+	// Label limits the list to the bookmarks with a label.
+	Label string
+	// Types limits the list to the bookmarks of these types: article,
+	// photo or video.
+	Types  []string
+	Limit  int
+	Offset int
+	Sort   []string
+}
+
+// ListBookmarks fetches one window of bookmarks along with the total number of
+// bookmarks matching the filters.
+func (c *Client) ListBookmarks(ctx context.Context, opts ListBookmarksOptions) ([]Bookmark, int, error) {
+	ctx, span := tracing.Start(ctx, "readeck.list")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Default, defaultTimeout)
+	defer cancel()
+
+	queryParams := url.Values{}
+	if opts.IsArchived != nil {
+		queryParams.Add("is_archived", strconv.FormatBool(*opts.IsArchived))
+	}
+	if opts.Collection != "" {
+		queryParams.Add("collection", opts.Collection)
+	}
+	if opts.Search != "" {
+		queryParams.Add("search", opts.Search)
+	}
+	if opts.Label != "" {
+		queryParams.Add("labels", opts.Label)
+	}
+	for _, t := range opts.Types {
+		queryParams.Add("type", t)
+	}
+	if opts.Limit > 0 {
+		queryParams.Add("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		queryParams.Add("offset", strconv.Itoa(opts.Offset))
+	}
+	for _, sort := range opts.Sort {
+		queryParams.Add("sort", sort)
+	}
+
+	var bookmarks []Bookmark
+	header, err := c.doRequest(ctx, http.MethodGet, "/api/bookmarks", queryParams, nil, &bookmarks)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list bookmarks: %w", err)
+	}
+
+	totalCount, err := strconv.Atoi(header.Get("Total-Count"))
+	if err != nil {
+		totalCount = opts.Offset + len(bookmarks) // Best guess if header is missing or invalid
+	}
+
+	return bookmarks, totalCount, nil
+}
+
 // GetBookmarkDetails fetches details for a single bookmark.
 func (c *Client) GetBookmarkDetails(ctx context.Context, id string) (*Bookmark, error) {
+	ctx, span := tracing.Start(ctx, "readeck.details")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Default, defaultTimeout)
+	defer cancel()
+
 	var bookmark Bookmark
 	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/api/bookmarks/%s", id), nil, nil, &bookmark)
 	if err != nil {
@@ -280,6 +550,11 @@ func (c *Client) GetBookmarkDetails(ctx context.Context, id string) (*Bookmark,
 
 // GetBookmarkDetailsBatch fetches details for multiple bookmarks.
 func (c *Client) SyncBookmarksContent(ctx context.Context, ids []string) (map[string]*Bookmark, error) {
+	ctx, span := tracing.Start(ctx, "readeck.sync_content")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Sync, defaultSyncTimeout)
+	defer cancel()
+
 	if len(ids) == 0 {
 		return make(map[string]*Bookmark), nil
 	}
@@ -300,11 +575,16 @@ func (c *Client) SyncBookmarksContent(ctx context.Context, ids []string) (map[st
 	// We need to handle the multipart response manually.
 	resp, err := c.doRequestRaw(ctx, http.MethodPost, "/api/bookmarks/sync", nil, requestBody)
 	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed) {
+			c.Logger.Infof("Multipart sync is not supported by the Readeck server, fetching %d bookmarks individually.", len(ids))
+			return c.getBookmarkDetailsConcurrently(ctx, ids)
+		}
 		return nil, fmt.Errorf("failed to fetch bookmark details in batch: %w", err)
 	}
 
 	// Parse multipart/mixed response
-	bookmarks, err := parseMultipartBookmarkResponse(resp, c.Logger)
+	bookmarks, err := parseMultipartBookmarkResponse(resp, c.Logger, c.StrictDecoding)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse multipart response: %w", err)
 	}
@@ -317,40 +597,220 @@ func (c *Client) SyncBookmarksContent(ctx context.Context, ids []string) (map[st
 	return bookmarkMap, nil
 }
 
-// GetBookmarkArticle fetches the article content for a bookmark.
+// getBookmarkDetailsConcurrently fetches bookmarks one by one, with at most
+// DetailConcurrency requests in flight. Bookmarks that no longer exist are skipped.
+func (c *Client) getBookmarkDetailsConcurrently(ctx context.Context, ids []string) (map[string]*Bookmark, error) {
+	concurrency := c.DetailConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDetailConcurrency
+	}
+
+	bookmarks := make([]*Bookmark, len(ids))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+
+	for i, id := range ids {
+		g.Go(func() error {
+			bookmark, err := c.GetBookmarkDetails(gctx, id)
+			if err != nil {
+				if IsNotFound(err) {
+					c.Logger.Debugf("Bookmark %s not found while fetching details, skipping.", id)
+					return nil
+				}
+				return err
+			}
+			bookmarks[i] = bookmark
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to fetch bookmark details individually: %w", err)
+	}
+
+	bookmarkMap := make(map[string]*Bookmark)
+	for _, bookmark := range bookmarks {
+		if bookmark != nil {
+			bookmarkMap[bookmark.ID] = bookmark
+		}
+	}
+
+	return bookmarkMap, nil
+}
+
+// GetBookmarkArticle fetches the HTML content of a bookmark.
 func (c *Client) GetBookmarkArticle(ctx context.Context, id string) (string, error) {
+	article, _, _, err := c.GetBookmarkArticleIfModified(ctx, id, ArticleValidators{})
+	return article, err
+}
+
+// ArticleValidators are the cache validators Readeck returned with an article.
+type ArticleValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// GetBookmarkArticleIfModified fetches the HTML content of a bookmark unless
+// it is unchanged since validators were returned with it, in which case
+// modified is false and article is empty.
+func (c *Client) GetBookmarkArticleIfModified(ctx context.Context, id string, validators ArticleValidators) (article string, latest ArticleValidators, modified bool, err error) {
+	ctx, span := tracing.Start(ctx, "readeck.article")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Article, defaultArticleTimeout)
+	defer cancel()
+
 	reqURL := c.BaseURL.JoinPath(fmt.Sprintf("/api/bookmarks/%s/article", id))
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", latest, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setAuthorization(req)
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
 	}
-	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.execute(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute request: %w", err)
+		return "", latest, false, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	latest = ArticleValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode == http.StatusNotModified {
+		return "", latest, false, nil
+	}
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, resp.Status)
+		return "", latest, false, fmt.Errorf("API request failed: %w", newAPIError(resp))
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return "", latest, false, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	return string(bodyBytes), nil
+	return string(bodyBytes), latest, true, nil
+}
+
+// GetCollections fetches the user's bookmark collections.
+func (c *Client) GetCollections(ctx context.Context) ([]Collection, error) {
+	ctx, span := tracing.Start(ctx, "readeck.collections")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Default, defaultTimeout)
+	defer cancel()
+
+	var collections []Collection
+	if _, err := c.doRequest(ctx, http.MethodGet, "/api/bookmarks/collections", nil, nil, &collections); err != nil {
+		return nil, fmt.Errorf("failed to fetch collections: %w", err)
+	}
+
+	return collections, nil
+}
+
+// GetProfile fetches the profile of the token's user, which checks that the
+// token is accepted.
+func (c *Client) GetProfile(ctx context.Context) (*Profile, error) {
+	ctx, span := tracing.Start(ctx, "readeck.profile")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Default, defaultTimeout)
+	defer cancel()
+
+	// The profile holds settings readeckobo has no use for, so it is not
+	// subject to strict decoding.
+	var raw json.RawMessage
+	if _, err := c.doRequest(ctx, http.MethodGet, "/api/profile", nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	var profile Profile
+	if err := json.Unmarshal(raw, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// GetBookmarkAnnotations fetches the highlights of one bookmark.
+func (c *Client) GetBookmarkAnnotations(ctx context.Context, id string) ([]Annotation, error) {
+	ctx, span := tracing.Start(ctx, "readeck.annotations")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Default, defaultTimeout)
+	defer cancel()
+
+	var annotations []Annotation
+	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/api/bookmarks/%s/annotations", id), nil, nil, &annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch annotations: %w", err)
+	}
+
+	// The per-bookmark listing leaves out the bookmark fields.
+	for i := range annotations {
+		if annotations[i].BookmarkID == "" {
+			annotations[i].BookmarkID = id
+		}
+	}
+
+	return annotations, nil
+}
+
+// tokenRoles are the API permissions requested for tokens created by Login.
+var tokenRoles = []string{"scoped_bookmarks_r", "scoped_bookmarks_w"}
+
+// Login exchanges a username and password for a new API token registered
+// under the given application name. The client needs no access token for this.
+func (c *Client) Login(ctx context.Context, username, password, application string) (*AuthToken, error) {
+	ctx, span := tracing.Start(ctx, "readeck.login")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Mutation, defaultMutationTimeout)
+	defer cancel()
+
+	body := map[string]any{
+		"username":    username,
+		"password":    password,
+		"application": application,
+		"roles":       tokenRoles,
+	}
+
+	var result AuthToken
+	_, err := c.doRequest(ctx, http.MethodPost, "/api/auth", nil, body, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in: %w", err)
+	}
+	if result.Token == "" {
+		return nil, fmt.Errorf("failed to log in: no token in response")
+	}
+
+	return &result, nil
+}
+
+// RevokeToken deletes the API token with the given ID, as returned by Login.
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "readeck.revoke_token")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Mutation, defaultMutationTimeout)
+	defer cancel()
+
+	_, err := c.doRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/profile/tokens/%s", id), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
 }
 
 // UpdateBookmark updates a bookmark.
 func (c *Client) UpdateBookmark(ctx context.Context, id string, updates map[string]any) error {
+	ctx, span := tracing.Start(ctx, "readeck.update")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Mutation, defaultMutationTimeout)
+	defer cancel()
+
 	path := fmt.Sprintf("/api/bookmarks/%s", id)
 		_, err := c.doRequest(ctx, http.MethodPatch, path, nil, updates, nil)
 	if err != nil {
-		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		if IsNotFound(err) {
 			c.Logger.Infof("Bookmark with ID '%s' not found on Readeck server. Treating as a successful action for the Kobo client.", id)
 			return nil // Treat "Not Found" as a success for the Kobo client
 		}
@@ -359,12 +819,93 @@ func (c *Client) UpdateBookmark(ctx context.Context, id string, updates map[stri
 	return nil
 }
 
-// CreateBookmark creates a new bookmark.
-func (c *Client) CreateBookmark(ctx context.Context, bookmarkURL string) error {
-	body := map[string]string{"url": bookmarkURL}
-	_, err := c.doRequest(ctx, http.MethodPost, "/api/bookmarks", nil, body, nil)
+// ErrForeignResource is returned for resource URLs outside of Readeck, which
+// must never receive the access token.
+var ErrForeignResource = errors.New("resource is not hosted by Readeck")
+
+// OpenResource fetches a file Readeck serves for a bookmark, such as its
+// thumbnail or site icon, and returns the response for the caller to stream
+// and close. header is sent along, for conditional requests.
+func (c *Client) OpenResource(ctx context.Context, resourceURL string, header http.Header) (*http.Response, error) {
+	ctx, span := tracing.Start(ctx, "readeck.resource")
+	defer span.End()
+
+	u, err := c.BaseURL.Parse(resourceURL)
 	if err != nil {
-		return fmt.Errorf("failed to create bookmark: %w", err)
+		return nil, fmt.Errorf("failed to parse resource URL: %w", err)
 	}
-	return nil
+	if u.Scheme != c.BaseURL.Scheme || u.Host != c.BaseURL.Host {
+		return nil, ErrForeignResource
+	}
+
+	// The caller reads the body after this returns, so the timeout is
+	// released when it closes the body, and on every error below.
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Article, defaultArticleTimeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	c.setAuthorization(req)
+
+	resp, err := c.execute(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// CreateBookmarkOptions sets optional fields of a new bookmark.
+type CreateBookmarkOptions struct {
+	Title  string
+	Labels []string
+	// Archived files the bookmark in the archive rather than the read-later
+	// list. Readeck cannot create archived bookmarks, so this takes a second
+	// request, made only when Readeck reports the new bookmark's ID.
+	Archived bool
+}
+
+// CreateBookmark creates a new bookmark and returns its ID when Readeck
+// reports one.
+func (c *Client) CreateBookmark(ctx context.Context, bookmarkURL string, opts CreateBookmarkOptions) (string, error) {
+	ctx, span := tracing.Start(ctx, "readeck.create")
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx, c.Timeouts.Mutation, defaultMutationTimeout)
+	defer cancel()
+
+	body := map[string]any{"url": bookmarkURL}
+	if opts.Title != "" {
+		body["title"] = opts.Title
+	}
+	if len(opts.Labels) > 0 {
+		body["labels"] = opts.Labels
+	}
+	header, err := c.doRequest(ctx, http.MethodPost, "/api/bookmarks", nil, body, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create bookmark: %w", err)
+	}
+	id := header.Get("Bookmark-Id")
+	if opts.Archived && id != "" {
+		if _, err := c.doRequest(ctx, http.MethodPatch, fmt.Sprintf("/api/bookmarks/%s", id), nil, map[string]any{"is_archived": true}, nil); err != nil {
+			return id, fmt.Errorf("failed to archive new bookmark: %w", err)
+		}
+	}
+	return id, nil
 }
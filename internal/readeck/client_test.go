@@ -3,8 +3,13 @@ package readeck
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -149,6 +154,37 @@ func TestGetBookmarkArticle(t *testing.T) {
 	}
 }
 
+func TestGetBookmarkArticleIfModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("<p>Article</p>"))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	ctx := context.Background()
+
+	article, validators, modified, err := client.GetBookmarkArticleIfModified(ctx, "b1", ArticleValidators{})
+	if err != nil {
+		t.Fatalf("GetBookmarkArticleIfModified failed: %v", err)
+	}
+	if !modified || article != "<p>Article</p>" || validators.ETag != `"v1"` {
+		t.Errorf("unexpected first fetch: article=%q validators=%+v modified=%v", article, validators, modified)
+	}
+
+	article, _, modified, err = client.GetBookmarkArticleIfModified(ctx, "b1", validators)
+	if err != nil {
+		t.Fatalf("GetBookmarkArticleIfModified failed: %v", err)
+	}
+	if modified || article != "" {
+		t.Errorf("expected not modified, got article=%q modified=%v", article, modified)
+	}
+}
+
 func TestUpdateBookmark(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPatch {
@@ -195,6 +231,42 @@ func TestUpdateBookmarkNotFound(t *testing.T) {
 	}
 }
 
+func TestIsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/bookmarks/down":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/api/bookmarks/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "server error", id: "down", want: true},
+		{name: "client error", id: "bad", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.UpdateBookmark(ctx, tt.id, map[string]any{"is_archived": true})
+			if got := IsUnavailable(err); got != tt.want {
+				t.Errorf("IsUnavailable(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+
+	server.Close()
+	err := client.UpdateBookmark(ctx, "down", map[string]any{"is_archived": true})
+	if !IsUnavailable(err) {
+		t.Errorf("expected unreachable server to be unavailable, got %v", err)
+	}
+}
+
 func TestCreateBookmark(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -218,10 +290,52 @@ func TestCreateBookmark(t *testing.T) {
 			client, _ := NewClient(server.URL, "test-token", testLogger, nil)
 			ctx := context.Background()
 
-	err := client.CreateBookmark(ctx, "http://example.com/new")
+	_, err := client.CreateBookmark(ctx, "http://example.com/new", CreateBookmarkOptions{})
+	if err != nil {
+		t.Fatalf("CreateBookmark failed: %v", err)
+	}
+}
+
+func TestCreateBookmarkWithOptions(t *testing.T) {
+	var created map[string]any
+	var archived map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/bookmarks":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Fatalf("Failed to decode request body: %v", err)
+			}
+			w.Header().Set("Bookmark-Id", "new-1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/bookmarks/new-1":
+			if err := json.NewDecoder(r.Body).Decode(&archived); err != nil {
+				t.Fatalf("Failed to decode request body: %v", err)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	id, err := client.CreateBookmark(context.Background(), "http://example.com/new", CreateBookmarkOptions{
+		Title:    "New",
+		Labels:   []string{"from-kobo"},
+		Archived: true,
+	})
 	if err != nil {
 		t.Fatalf("CreateBookmark failed: %v", err)
 	}
+	if id != "new-1" {
+		t.Errorf("Expected ID 'new-1', got '%s'", id)
+	}
+	if created["title"] != "New" || !reflect.DeepEqual(created["labels"], []any{"from-kobo"}) {
+		t.Errorf("Expected title and labels in request body, got %v", created)
+	}
+	if archived["is_archived"] != true {
+		t.Errorf("Expected the new bookmark to be archived, got %v", archived)
+	}
 }
 
 func TestGetBookmarksWithIsArchived(t *testing.T) {
@@ -264,3 +378,302 @@ func TestGetBookmarksWithIsArchived(t *testing.T) {
 		t.Errorf("Expected totalPages to be 1, got %d", totalPages)
 	}
 }
+
+func TestGetBookmarkAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/bookmarks/b1/annotations" {
+			t.Errorf("Expected to request '/api/bookmarks/b1/annotations', got '%s'", r.URL.Path)
+		}
+
+		mockResponse := []Annotation{
+			{ID: "a1", Text: "highlighted text"},
+		}
+		if err := json.NewEncoder(w).Encode(mockResponse); err != nil {
+			t.Fatalf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	ctx := context.Background()
+
+	annotations, err := client.GetBookmarkAnnotations(ctx, "b1")
+	if err != nil {
+		t.Fatalf("GetBookmarkAnnotations failed: %v", err)
+	}
+	if len(annotations) != 1 || annotations[0].BookmarkID != "b1" {
+		t.Errorf("Expected 1 annotation for bookmark 'b1', got %+v", annotations)
+	}
+}
+
+func TestGetCollections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/bookmarks/collections" {
+			t.Errorf("Expected to request '/api/bookmarks/collections', got '%s'", r.URL.Path)
+		}
+		mockResponse := []Collection{{ID: "c1", Name: "To Kobo"}}
+		if err := json.NewEncoder(w).Encode(mockResponse); err != nil {
+			t.Fatalf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+
+	collections, err := client.GetCollections(context.Background())
+	if err != nil {
+		t.Fatalf("GetCollections failed: %v", err)
+	}
+	if len(collections) != 1 || collections[0].ID != "c1" || collections[0].Name != "To Kobo" {
+		t.Errorf("Expected collection 'c1' named 'To Kobo', got %+v", collections)
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/profile" {
+			t.Errorf("Expected to request '/api/profile', got '%s'", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"provider":{"name":"bearer token","application":"readeckobo","roles":["scoped_bookmarks_r"]},"user":{"username":"alice","email":"alice@example.com"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+
+	profile, err := client.GetProfile(context.Background())
+	if err != nil {
+		t.Fatalf("GetProfile failed: %v", err)
+	}
+	if profile.User.Username != "alice" || profile.Provider.Application != "readeckobo" {
+		t.Errorf("Expected alice's readeckobo token, got %+v", profile)
+	}
+}
+
+func TestListBookmarks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/bookmarks" {
+			t.Errorf("Expected to request '/api/bookmarks', got '%s'", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("is_archived") != "false" || query.Get("limit") != "10" || query.Get("offset") != "20" {
+			t.Errorf("Expected is_archived=false, limit=10 and offset=20, got '%s'", r.URL.RawQuery)
+		}
+		if query.Get("collection") != "c1" || query.Get("search") != "go generics" {
+			t.Errorf("Expected collection=c1 and search='go generics', got '%s'", r.URL.RawQuery)
+		}
+		if sort := query["sort"]; len(sort) != 2 || sort[0] != "-created" || sort[1] != "title" {
+			t.Errorf("Expected sort '-created,title', got %v", sort)
+		}
+
+		mockResponse := []Bookmark{
+			{ID: "b1", Title: "Test Bookmark"},
+		}
+		w.Header().Set("Total-Count", "21")
+		if err := json.NewEncoder(w).Encode(mockResponse); err != nil {
+			t.Fatalf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	ctx := context.Background()
+
+	isArchived := false
+	bookmarks, total, err := client.ListBookmarks(ctx, ListBookmarksOptions{
+		IsArchived: &isArchived,
+		Collection: "c1",
+		Search:     "go generics",
+		Limit:      10,
+		Offset:     20,
+		Sort:       []string{"-created", "title"},
+	})
+	if err != nil {
+		t.Fatalf("ListBookmarks failed: %v", err)
+	}
+	if len(bookmarks) != 1 || bookmarks[0].ID != "b1" {
+		t.Errorf("Expected 1 bookmark with ID 'b1', got %+v", bookmarks)
+	}
+	if total != 21 {
+		t.Errorf("Expected total to be 21, got %d", total)
+	}
+}
+
+func TestSyncBookmarksContentFallback(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/bookmarks/sync" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/bookmarks/")
+		if id == "gone" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(Bookmark{ID: id}); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	client.DetailConcurrency = 2
+	ctx := context.Background()
+
+	bookmarks, err := client.SyncBookmarksContent(ctx, []string{"b1", "b2", "gone", "b3", "b4"})
+	if err != nil {
+		t.Fatalf("SyncBookmarksContent failed: %v", err)
+	}
+	if len(bookmarks) != 4 {
+		t.Errorf("Expected 4 bookmarks, got %d", len(bookmarks))
+	}
+	if _, ok := bookmarks["gone"]; ok {
+		t.Error("Expected missing bookmark to be skipped")
+	}
+	if maxInFlight.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", maxInFlight.Load())
+	}
+}
+
+func TestLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/auth" {
+			t.Errorf("Expected POST '/api/auth', got %s '%s'", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected no Authorization header, got '%s'", r.Header.Get("Authorization"))
+		}
+
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request body: %v", err)
+		}
+		if body["username"] != "alice" || body["password"] != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"id": "t1", "token": "new-token"}); err != nil {
+			t.Fatalf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "", testLogger, nil)
+	ctx := context.Background()
+
+	token, err := client.Login(ctx, "alice", "secret", "readeckobo")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if token.Token != "new-token" || token.ID != "t1" {
+		t.Errorf("Expected token 'new-token' with ID 't1', got %+v", token)
+	}
+
+	if _, err := client.Login(ctx, "alice", "wrong", "readeckobo"); err == nil {
+		t.Error("Expected error for wrong password, got nil")
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var updates map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&updates); err != nil || updates["is_archived"] != true {
+			t.Errorf("Expected retried request to carry the original body, got %v (err: %v)", updates, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "stale-token", testLogger, nil)
+	ctx := context.Background()
+
+	// Without a refresher the 401 is surfaced as is.
+	err := client.UpdateBookmark(ctx, "b1", map[string]any{"is_archived": true})
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error, got %v", err)
+	}
+
+	refreshes := 0
+	client.TokenRefresher = func(ctx context.Context, rejected string) (string, error) {
+		if rejected != "stale-token" {
+			t.Errorf("Expected the rejected token 'stale-token', got '%s'", rejected)
+		}
+		refreshes++
+		return "fresh-token", nil
+	}
+	accepted := 0
+	client.TokenAccepted = func() { accepted++ }
+	if err := client.UpdateBookmark(ctx, "b1", map[string]any{"is_archived": true}); err != nil {
+		t.Fatalf("UpdateBookmark failed after refresh: %v", err)
+	}
+	if refreshes != 1 || client.AccessToken != "fresh-token" {
+		t.Errorf("Expected 1 refresh to 'fresh-token', got %d refreshes and token '%s'", refreshes, client.AccessToken)
+	}
+	if accepted != 1 {
+		t.Errorf("Expected the refreshed token accepted once, got %d", accepted)
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, server.Client())
+	client.Timeouts = Timeouts{Sync: time.Second, Mutation: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	if _, err := client.GetBookmarksSync(ctx, nil); err != nil {
+		t.Errorf("expected a slow sync within its timeout to succeed, got %v", err)
+	}
+	if err := client.UpdateBookmark(ctx, "1", map[string]any{"is_archived": true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a slow update to time out, got %v", err)
+	}
+}
+
+func TestNextPageQuery(t *testing.T) {
+	query := url.Values{"since": {"10"}}
+	tests := []struct {
+		name   string
+		header http.Header
+		page   int
+		want   string
+		wantOK bool
+	}{
+		{"no pagination", http.Header{}, 1, "", false},
+		{"total pages", http.Header{"Total-Pages": {"3"}}, 1, "page=2&since=10", true},
+		{"last page", http.Header{"Total-Pages": {"3"}}, 3, "", false},
+		{"next link", http.Header{"Link": {`<https://other.example.com/api/bookmarks/sync?page=2&since=10>; rel="next", <https://other.example.com/api/bookmarks/sync?page=9>; rel="last"`}}, 1, "page=2&since=10", true},
+		{"link to the same page", http.Header{"Link": {`</api/bookmarks/sync?since=10>; rel="next"`}, "Total-Pages": {"3"}}, 1, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok := nextPageQuery(tt.header, query, tt.page)
+			if ok != tt.wantOK || (ok && next.Encode() != tt.want) {
+				t.Errorf("expected %q, %v, got %q, %v", tt.want, tt.wantOK, next.Encode(), ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package readeck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBody bounds how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// APIError represents an error returned by the Readeck API.
+type APIError struct {
+	StatusCode int
+	// Message is Readeck's explanation when its response carried one, and
+	// the HTTP status otherwise.
+	Message string
+	// Errors and Fields hold the problems Readeck found with the request
+	// as a whole and with each of its fields.
+	Errors []string
+	Fields map[string][]string
+	// RetryAfter is how long Readeck asked to wait before trying again.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if problems := e.Problems(); len(problems) > 0 {
+		message += ": " + strings.Join(problems, "; ")
+	}
+	return fmt.Sprintf("API error: %s (status: %d)", message, e.StatusCode)
+}
+
+// Problems lists the problems Readeck found with the request, each field's
+// prefixed with the field name, in a stable order.
+func (e *APIError) Problems() []string {
+	problems := slices.Clone(e.Errors)
+	for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+		for _, problem := range e.Fields[field] {
+			problems = append(problems, field+": "+problem)
+		}
+	}
+	return problems
+}
+
+// errorBody is the JSON body of a Readeck error: a status and message, or
+// the result of validating a form.
+type errorBody struct {
+	Message string   `json:"message"`
+	Errors  []string `json:"errors"`
+	Fields  map[string]struct {
+		Errors []string `json:"errors"`
+	} `json:"fields"`
+}
+
+// newAPIError reads the error response resp, parsing Readeck's JSON error
+// body and Retry-After header when present.
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body errorBody
+	if json.Unmarshal(data, &body) != nil {
+		if text := strings.TrimSpace(string(data)); text != "" && !strings.HasPrefix(text, "<") {
+			apiErr.Message += ": " + text
+		}
+		return apiErr
+	}
+	if body.Message != "" {
+		apiErr.Message = body.Message
+	}
+	apiErr.Errors = body.Errors
+	for name, field := range body.Fields {
+		if len(field.Errors) == 0 {
+			continue
+		}
+		if apiErr.Fields == nil {
+			apiErr.Fields = make(map[string][]string)
+		}
+		apiErr.Fields[name] = field.Errors
+	}
+	return apiErr
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// IsUnauthorized reports whether err was caused by Readeck rejecting the access token.
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err means the access token lacks the
+// permission for the request.
+func IsForbidden(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden
+}
+
+// IsNotFound reports whether err means Readeck does not know the resource.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsValidation reports whether err means Readeck rejected the content of
+// the request, such as an invalid URL.
+func IsValidation(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusUnprocessableEntity)
+}
+
+// IsRateLimited reports whether err means Readeck is throttling the client.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// RetryAfter returns how long Readeck asked to wait after err, or 0.
+func RetryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// IsUnavailable reports whether err means Readeck could not be reached or
+// failed on its side, so that the request is worth retrying later.
+func IsUnavailable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.Canceled)
+}
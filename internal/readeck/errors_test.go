@@ -0,0 +1,101 @@
+package readeck
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		want       APIError
+		wantString string
+	}{
+		{
+			name:       "status and message",
+			status:     http.StatusNotFound,
+			body:       `{"status":404,"message":"Not Found"}`,
+			want:       APIError{StatusCode: http.StatusNotFound, Message: "Not Found"},
+			wantString: "API error: Not Found (status: 404)",
+		},
+		{
+			name:   "form validation",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"is_valid":false,"errors":["invalid form"],"fields":{"url":{"is_valid":false,"errors":["invalid URL"]},"title":{"is_valid":true,"errors":null}}}`,
+			want: APIError{
+				StatusCode: http.StatusUnprocessableEntity,
+				Message:    "422 Unprocessable Entity",
+				Errors:     []string{"invalid form"},
+				Fields:     map[string][]string{"url": {"invalid URL"}},
+			},
+			wantString: "API error: 422 Unprocessable Entity: invalid form; url: invalid URL (status: 422)",
+		},
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			header:     http.Header{"Retry-After": {"30"}},
+			want:       APIError{StatusCode: http.StatusTooManyRequests, Message: "429 Too Many Requests", RetryAfter: 30 * time.Second},
+			wantString: "API error: 429 Too Many Requests (status: 429)",
+		},
+		{
+			name:       "plain text body",
+			status:     http.StatusInternalServerError,
+			body:       "database is locked\n",
+			want:       APIError{StatusCode: http.StatusInternalServerError, Message: "500 Internal Server Error: database is locked"},
+			wantString: "API error: 500 Internal Server Error: database is locked (status: 500)",
+		},
+		{
+			name:       "HTML body",
+			status:     http.StatusBadGateway,
+			body:       "<html>Bad Gateway</html>",
+			want:       APIError{StatusCode: http.StatusBadGateway, Message: "502 Bad Gateway"},
+			wantString: "API error: 502 Bad Gateway (status: 502)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Status:     fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)),
+				Header:     tt.header,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			got := newAPIError(resp)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, *got)
+			}
+			if got.Error() != tt.wantString {
+				t.Errorf("expected %q, got %q", tt.wantString, got.Error())
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -9,9 +9,12 @@ import (
 type ClientInterface interface {
 	GetBookmarksSync(ctx context.Context, since *time.Time) ([]BookmarkSync, error)
 	GetBookmarks(ctx context.Context, site string, page int, isArchived *bool) ([]Bookmark, int, error)
+	ListBookmarks(ctx context.Context, opts ListBookmarksOptions) ([]Bookmark, int, error)
 	GetBookmarkDetails(ctx context.Context, id string) (*Bookmark, error)
 	SyncBookmarksContent(ctx context.Context, ids []string) (map[string]*Bookmark, error)
 	GetBookmarkArticle(ctx context.Context, id string) (string, error)
+	GetBookmarkAnnotations(ctx context.Context, id string) ([]Annotation, error)
+	GetCollections(ctx context.Context) ([]Collection, error)
 	UpdateBookmark(ctx context.Context, id string, updates map[string]any) error
-	CreateBookmark(ctx context.Context, bookmarkURL string) error
+	CreateBookmark(ctx context.Context, bookmarkURL string, opts CreateBookmarkOptions) (string, error)
 }
@@ -44,6 +44,7 @@ type Bookmark struct {
 	Lang         string      `json:"lang"`
 	Loaded       bool        `json:"loaded"`
 	ReadProgress int         `json:"read_progress"`
+	ReadingTime  int         `json:"reading_time"`
 	Resources    Resources   `json:"resources"`
 	Site         string      `json:"site"`
 	SiteName     string      `json:"site_name"`
@@ -56,3 +57,46 @@ type Bookmark struct {
 	WordCount    int         `json:"word_count"`
 	Published    time.Time   `json:"published"`
 }
+
+// Bookmark states reported by Readeck while it extracts a saved page.
+const (
+	StateLoaded  = 0
+	StateError   = 1
+	StateLoading = 2
+)
+
+// Collection is a saved bookmark search in Readeck.
+type Collection struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IsDeleted bool   `json:"is_deleted"`
+}
+
+// Profile is the user and the token a Readeck API call is made with.
+type Profile struct {
+	User struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	} `json:"user"`
+	Provider struct {
+		Name        string   `json:"name"`
+		Application string   `json:"application"`
+		Roles       []string `json:"roles"`
+	} `json:"provider"`
+}
+
+// AuthToken is an API token Readeck issued at login.
+type AuthToken struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+type Annotation struct {
+	ID            string    `json:"id"`
+	BookmarkID    string    `json:"bookmark_id"`
+	BookmarkURL   string    `json:"bookmark_url"`
+	BookmarkTitle string    `json:"bookmark_title"`
+	Text          string    `json:"text"`
+	Color         string    `json:"color"`
+	Created       time.Time `json:"created"`
+}
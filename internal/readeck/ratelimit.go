@@ -0,0 +1,54 @@
+package readeck
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests to Readeck to a steady rate, letting bursts
+// of up to burst requests through at once.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows perSecond requests per second, with bursts of at
+// least one request.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	b := float64(max(burst, 1))
+	return &RateLimiter{rate: perSecond, burst: b, tokens: b, last: time.Now()}
+}
+
+// Wait blocks until a request may be made, or returns the error of ctx if it
+// is done first.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
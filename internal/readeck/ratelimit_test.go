@@ -0,0 +1,56 @@
+package readeck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(100, 2)
+	start := time.Now()
+	for range 5 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	// The burst of 2 passes at once, the 3 others are spaced 10ms apart.
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("Expected 5 requests to take about 30ms, took %v", elapsed)
+	}
+
+	slow := NewRateLimiter(0.1, 1)
+	_ = slow.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := slow.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestClientLimiters(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+	client.Limiters = []*RateLimiter{NewRateLimiter(0.1, 1)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.GetBookmarksSync(ctx, nil); err != nil {
+		t.Fatalf("GetBookmarksSync failed: %v", err)
+	}
+	if _, err := client.GetBookmarksSync(ctx, nil); err == nil {
+		t.Error("Expected the second request to be held back past its deadline")
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request to reach Readeck, got %d", requests)
+	}
+}
@@ -0,0 +1,152 @@
+package readeck
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SchemaError reports a Readeck response without the expected shape, which
+// usually means the server runs a Readeck version this client does not
+// support.
+type SchemaError struct {
+	// Endpoint is the request that got the response, e.g. "GET /api/bookmarks".
+	Endpoint string
+	// Field is the offending field, e.g. "[2].id", or empty for the whole
+	// response.
+	Field   string
+	Problem string
+}
+
+func (e *SchemaError) Error() string {
+	subject := "response"
+	if e.Field != "" {
+		subject = fmt.Sprintf("field %s", e.Field)
+	}
+	return fmt.Sprintf("unexpected Readeck response to %s: %s %s; check that this Readeck version is supported", e.Endpoint, subject, e.Problem)
+}
+
+// decodeResponse decodes a JSON response into v and checks the fields the
+// client relies on. When strict is set, fields unknown to the client are
+// errors too, to spot renamed fields.
+func decodeResponse(data []byte, v any, strict bool, endpoint string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return decodeError(data, err, endpoint)
+	}
+	return validateResponse(v, endpoint)
+}
+
+// decodeError turns a JSON decoding error into a *SchemaError naming the
+// offending field.
+func decodeError(data []byte, err error, endpoint string) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		problem := fmt.Sprintf("is a JSON %s instead of %s", typeErr.Value, typeErr.Type)
+		if typeErr.Field == "" && typeErr.Value == "object" {
+			// Readeck answers some failures with an error object.
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+				problem += fmt.Sprintf(" (message: %q)", apiErr.Message)
+			}
+		}
+		return &SchemaError{Endpoint: endpoint, Field: fieldPath(typeErr.Field), Problem: problem}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return &SchemaError{Endpoint: endpoint, Problem: fmt.Sprintf("is not valid JSON: %v", err)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return &SchemaError{Endpoint: endpoint, Field: strings.TrimPrefix(err.Error(), "json: unknown field "), Problem: "is unknown to this client"}
+	default:
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+}
+
+// fieldPath rewrites a decoder field path such as "0.id" as "[0].id".
+func fieldPath(field string) string {
+	parts := strings.Split(field, ".")
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			parts[i] = "[" + part + "]"
+		}
+	}
+	return strings.ReplaceAll(strings.Join(parts, "."), ".[", "[")
+}
+
+// validateResponse checks the required fields of decoded Readeck models.
+func validateResponse(v any, endpoint string) error {
+	var field, problem string
+	switch v := v.(type) {
+	case *Bookmark:
+		field, problem = v.validate()
+	case *[]Bookmark:
+		field, problem = validateEach(*v)
+	case *[]BookmarkSync:
+		field, problem = validateEach(*v)
+	case *[]Annotation:
+		field, problem = validateEach(*v)
+	case *[]Collection:
+		field, problem = validateEach(*v)
+	}
+	if problem == "" {
+		return nil
+	}
+	return &SchemaError{Endpoint: endpoint, Field: field, Problem: problem}
+}
+
+type validatable interface {
+	validate() (field, problem string)
+}
+
+func validateEach[T validatable](items []T) (string, string) {
+	for i, item := range items {
+		if field, problem := item.validate(); problem != "" {
+			return fmt.Sprintf("[%d].%s", i, field), problem
+		}
+	}
+	return "", ""
+}
+
+const missing = "is missing"
+
+func (b Bookmark) validate() (string, string) {
+	if b.ID == "" {
+		return "id", missing
+	}
+	return "", ""
+}
+
+func (s BookmarkSync) validate() (string, string) {
+	switch {
+	case s.ID == "":
+		return "id", missing
+	case s.Type != "update" && s.Type != "delete":
+		return "type", fmt.Sprintf("is %q instead of update or delete", s.Type)
+	}
+	return "", ""
+}
+
+// The highlights of one bookmark come without bookmark_id, which
+// GetBookmarkAnnotations fills in.
+func (a Annotation) validate() (string, string) {
+	if a.ID == "" {
+		return "id", missing
+	}
+	return "", ""
+}
+
+func (c Collection) validate() (string, string) {
+	if c.ID == "" {
+		return "id", missing
+	}
+	return "", ""
+}
@@ -0,0 +1,100 @@
+package readeck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		strict    bool
+		wantField string
+		wantText  string
+	}{
+		{
+			name:     "error object instead of list",
+			body:     `{"status": 500, "message": "database is locked"}`,
+			wantText: `message: "database is locked"`,
+		},
+		{
+			name:      "wrong field type",
+			body:      `[{"id": 42, "type": "update"}]`,
+			wantField: "[0].id",
+			wantText:  "is a JSON number instead of string",
+		},
+		{
+			name:      "missing id",
+			body:      `[{"type": "update"}]`,
+			wantField: "[0].id",
+			wantText:  "is missing",
+		},
+		{
+			name:      "unknown sync type",
+			body:      `[{"id": "b1", "type": "update"}, {"id": "b2", "type": "moved"}]`,
+			wantField: "[1].type",
+			wantText:  `is "moved" instead of update or delete`,
+		},
+		{
+			name:      "unknown field in strict mode",
+			body:      `[{"id": "b1", "type": "update", "kind": "article"}]`,
+			strict:    true,
+			wantField: `"kind"`,
+			wantText:  "is unknown to this client",
+		},
+		{
+			name:     "invalid JSON",
+			body:     `[{"id": "b1"`,
+			wantText: "is not valid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+			client.StrictDecoding = tt.strict
+
+			_, err := client.GetBookmarksSync(context.Background(), nil)
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("Expected a SchemaError, got %v", err)
+			}
+			if schemaErr.Endpoint != "GET /api/bookmarks/sync" {
+				t.Errorf("Expected endpoint 'GET /api/bookmarks/sync', got %q", schemaErr.Endpoint)
+			}
+			if schemaErr.Field != tt.wantField {
+				t.Errorf("Expected field %q, got %q", tt.wantField, schemaErr.Field)
+			}
+			if !strings.Contains(err.Error(), tt.wantText) {
+				t.Errorf("Expected error to contain %q, got %q", tt.wantText, err.Error())
+			}
+		})
+	}
+}
+
+func TestSchemaUnknownFieldsAllowedByDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": "b1", "type": "update", "kind": "article"}]`))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "test-token", testLogger, nil)
+
+	syncs, err := client.GetBookmarksSync(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("GetBookmarksSync failed: %v", err)
+	}
+	if len(syncs) != 1 || syncs[0].ID != "b1" {
+		t.Errorf("Expected one sync entry 'b1', got %+v", syncs)
+	}
+}
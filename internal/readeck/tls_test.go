@@ -0,0 +1,69 @@
+package readeck
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewHTTPClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        TLSConfig
+		wantErr    string
+		wantReject bool
+	}{
+		{name: "system roots reject self-signed", cfg: TLSConfig{}, wantReject: true},
+		{name: "custom CA", cfg: TLSConfig{CAFile: caFile}},
+		{name: "insecure skip verify", cfg: TLSConfig{InsecureSkipVerify: true}},
+		{name: "missing CA file", cfg: TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, wantErr: "failed to read CA file"},
+		{name: "CA file without certificates", cfg: TLSConfig{CAFile: notPEM}, wantErr: "no PEM certificates"},
+		{name: "certificate without key", cfg: TLSConfig{CertFile: caFile}, wantErr: "must be set together"},
+		{name: "unreadable key pair", cfg: TLSConfig{CertFile: caFile, KeyFile: notPEM}, wantErr: "failed to load client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient, err := NewHTTPClient(tt.cfg, TransportConfig{}, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewHTTPClient failed: %v", err)
+			}
+
+			client, _ := NewClient(server.URL, "test-token", testLogger, httpClient)
+			_, err = client.GetBookmarksSync(context.Background(), nil)
+			if tt.wantReject && err == nil {
+				t.Error("Expected the self-signed certificate to be rejected")
+			}
+			if !tt.wantReject && err != nil {
+				t.Errorf("GetBookmarksSync failed: %v", err)
+			}
+		})
+	}
+}
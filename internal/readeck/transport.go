@@ -0,0 +1,59 @@
+package readeck
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportConfig tunes the connections kept open to Readeck, so that the
+// many requests of a sync reuse them instead of repeating TLS handshakes.
+type TransportConfig struct {
+	// MaxIdleConnsPerHost is how many idle connections are kept; Go keeps
+	// only 2 by default, fewer than a sync runs in parallel.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes connections idle for longer.
+	IdleConnTimeout time.Duration
+	// DisableHTTP2 speaks HTTP/1.1 only, for reverse proxies that mishandle
+	// HTTP/2.
+	DisableHTTP2 bool
+}
+
+// NewHTTPClient returns an HTTP client for Readeck that applies tlsCfg and
+// transportCfg and connects through proxy, or the proxy from the
+// environment when nil. Calls are bounded by Timeouts rather than a
+// client-wide timeout.
+func NewHTTPClient(tlsCfg TLSConfig, transportCfg TransportConfig, proxy func(*http.Request) (*url.URL, error)) (*http.Client, error) {
+	if tlsCfg == (TLSConfig{}) && transportCfg == (TransportConfig{}) && proxy == nil {
+		return &http.Client{}, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	if tlsCfg != (TLSConfig{}) {
+		tlsConfig, err := tlsCfg.build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	transportCfg.apply(transport)
+	return &http.Client{Transport: transport}, nil
+}
+
+func (cfg TransportConfig) apply(transport *http.Transport) {
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		transport.MaxIdleConns = max(transport.MaxIdleConns, cfg.MaxIdleConnsPerHost)
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.DisableHTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		transport.Protocols = protocols
+		transport.ForceAttemptHTTP2 = false
+	}
+}
@@ -0,0 +1,63 @@
+package readeck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientTransport(t *testing.T) {
+	httpClient, err := NewHTTPClient(TLSConfig{}, TransportConfig{MaxIdleConnsPerHost: 16, IdleConnTimeout: time.Minute, DisableHTTP2: true}, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %v", err)
+	}
+	transport, ok := httpClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected an *http.Transport, got %T", httpClient.Transport)
+	}
+	if transport.MaxIdleConnsPerHost != 16 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("Expected tuned idle connections, got %d per host for %v", transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if transport.Protocols == nil || transport.Protocols.HTTP2() || !transport.Protocols.HTTP1() {
+		t.Errorf("Expected HTTP/1.1 only, got %v", transport.Protocols)
+	}
+}
+
+func TestNewHTTPClientHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		cfg       TransportConfig
+		wantProto string
+	}{
+		{name: "HTTP/2", cfg: TransportConfig{MaxIdleConnsPerHost: 4}, wantProto: "HTTP/2.0"},
+		{name: "HTTP/2 disabled", cfg: TransportConfig{DisableHTTP2: true}, wantProto: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient, err := NewHTTPClient(TLSConfig{InsecureSkipVerify: true}, tt.cfg, nil)
+			if err != nil {
+				t.Fatalf("NewHTTPClient failed: %v", err)
+			}
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+			if got := resp.Header.Get("X-Proto"); got != tt.wantProto {
+				t.Errorf("Expected %s, got %s", tt.wantProto, got)
+			}
+		})
+	}
+}
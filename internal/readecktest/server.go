@@ -0,0 +1,459 @@
+// Package readecktest provides a fake Readeck server backed by an in-memory
+// bookmark store, so handlers can be tested end-to-end against the real
+// readeck.Client.
+package readecktest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"readeckobo/internal/readeck"
+)
+
+// defaultLimit is the page size Readeck uses when a list request sets none.
+const defaultLimit = 50
+
+// Update is a PATCH the server received for a bookmark.
+type Update struct {
+	ID   string
+	Data map[string]any
+}
+
+// Server is a fake Readeck API. It serves the bookmark list, sync, details,
+// article, annotation, create and update endpoints from its store, records
+// the changes it receives, and applies them to the store.
+type Server struct {
+	*httptest.Server
+
+	// Extract, when set, fills in each bookmark created through the API and
+	// returns its article, standing in for Readeck fetching the page.
+	Extract func(bookmark *readeck.Bookmark) string
+	// SyncPageSize, when set, splits the sync feed into pages of this many
+	// events, linked with Link and Total-Pages headers.
+	SyncPageSize int
+
+	mu          sync.Mutex
+	bookmarks   map[string]*readeck.Bookmark
+	order       []string
+	articles    map[string]string
+	annotations []readeck.Annotation
+	events      []readeck.BookmarkSync
+	updates     []Update
+	created     []string
+	failures    map[string]int
+}
+
+// NewServer starts a fake Readeck server with an empty store. Close it when
+// the test is done.
+func NewServer() *Server {
+	s := &Server{
+		bookmarks: make(map[string]*readeck.Bookmark),
+		articles:  make(map[string]string),
+		failures:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/bookmarks", s.handleList)
+	mux.HandleFunc("POST /api/bookmarks", s.handleCreate)
+	mux.HandleFunc("GET /api/bookmarks/sync", s.handleSyncEvents)
+	mux.HandleFunc("POST /api/bookmarks/sync", s.handleSyncContent)
+	mux.HandleFunc("GET /api/bookmarks/{id}", s.handleDetails)
+	mux.HandleFunc("PATCH /api/bookmarks/{id}", s.handleUpdate)
+	mux.HandleFunc("GET /api/bookmarks/{id}/article", s.handleArticle)
+	mux.HandleFunc("GET /api/bookmarks/{id}/annotations", s.handleAnnotations)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		status, fail := s.failures[r.Method+" "+r.URL.Path]
+		s.mu.Unlock()
+		if fail {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// AddBookmark stores a bookmark, with the HTML of its article if not empty,
+// and records an update event for it.
+func (s *Server) AddBookmark(bookmark readeck.Bookmark, article string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.bookmarks[bookmark.ID]; !ok {
+		s.order = append(s.order, bookmark.ID)
+	}
+	s.bookmarks[bookmark.ID] = &bookmark
+	if article != "" {
+		s.articles[bookmark.ID] = article
+	}
+	s.record(bookmark.ID, "update")
+}
+
+// DeleteBookmark removes a bookmark from the store and records a delete
+// event for it, whether or not it was stored.
+func (s *Server) DeleteBookmark(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+	s.record(id, "delete")
+}
+
+// AddAnnotation stores a highlight.
+func (s *Server) AddAnnotation(annotation readeck.Annotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.annotations = append(s.annotations, annotation)
+}
+
+// Fail makes requests matching method and path answer with status, e.g.
+// Fail("POST", "/api/bookmarks/sync", http.StatusNotFound).
+func (s *Server) Fail(method, path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method+" "+path] = status
+}
+
+// Bookmark returns a stored bookmark.
+func (s *Server) Bookmark(id string) (readeck.Bookmark, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmark, ok := s.bookmarks[id]
+	if !ok {
+		return readeck.Bookmark{}, false
+	}
+	return *bookmark, true
+}
+
+// Updates returns the PATCHes received so far, in order.
+func (s *Server) Updates() []Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.updates)
+}
+
+// Created returns the URLs of the bookmarks created so far, in order.
+func (s *Server) Created() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.created)
+}
+
+func (s *Server) record(id, eventType string) {
+	s.events = append(s.events, readeck.BookmarkSync{ID: id, Time: time.Now().UTC(), Type: eventType})
+}
+
+func (s *Server) remove(id string) {
+	delete(s.bookmarks, id)
+	delete(s.articles, id)
+	s.order = slices.DeleteFunc(s.order, func(o string) bool { return o == id })
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	var bookmarks []readeck.Bookmark
+	for _, id := range s.order {
+		bookmark := s.bookmarks[id]
+		if isArchived := query.Get("is_archived"); isArchived != "" && strconv.FormatBool(bookmark.IsArchived) != isArchived {
+			continue
+		}
+		if site := query.Get("site"); site != "" && !matchesSite(bookmark, site) {
+			continue
+		}
+		if search := query.Get("search"); search != "" && !matchesSearch(bookmark, search) {
+			continue
+		}
+		if label := query.Get("labels"); label != "" && !slices.Contains(bookmark.Labels, label) {
+			continue
+		}
+		if types := query["type"]; len(types) > 0 && !slices.Contains(types, bookmark.Type) {
+			continue
+		}
+		bookmarks = append(bookmarks, *bookmark)
+	}
+	s.mu.Unlock()
+
+	for _, field := range query["sort"] {
+		if !sortFields[strings.TrimPrefix(field, "-")] {
+			http.Error(w, "invalid sort field "+field, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	sortBookmarks(bookmarks, query["sort"])
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if page, _ := strconv.Atoi(query.Get("page")); page > 1 {
+		offset = (page - 1) * limit
+	}
+
+	total := len(bookmarks)
+	bookmarks = bookmarks[min(max(offset, 0), total):]
+	bookmarks = bookmarks[:min(limit, len(bookmarks))]
+
+	w.Header().Set("Total-Count", strconv.Itoa(total))
+	w.Header().Set("Total-Pages", strconv.Itoa(max(1, (total+limit-1)/limit)))
+	writeJSON(w, http.StatusOK, bookmarks)
+}
+
+// matchesSite reports whether a bookmark is from site or one of its
+// subdomains.
+func matchesSite(bookmark *readeck.Bookmark, site string) bool {
+	if bookmark.Site == site {
+		return true
+	}
+	u, err := url.Parse(bookmark.URL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == site || strings.HasSuffix(host, "."+site)
+}
+
+// matchesSearch reports whether every word of search appears in the title,
+// description or URL of a bookmark, ignoring case, as a stand-in for
+// Readeck's full-text search.
+func matchesSearch(bookmark *readeck.Bookmark, search string) bool {
+	text := strings.ToLower(bookmark.Title + " " + bookmark.Description + " " + bookmark.URL)
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortFields are the fields Readeck documents for sorting /api/bookmarks;
+// other fields are refused, so that tests catch a sort Readeck would not
+// apply.
+var sortFields = map[string]bool{
+	"created":   true,
+	"domain":    true,
+	"duration":  true,
+	"published": true,
+	"site":      true,
+	"title":     true,
+}
+
+// sortBookmarks orders bookmarks by Readeck sort fields such as "-created"
+// or "title"; fields the mock does not model are ignored.
+func sortBookmarks(bookmarks []readeck.Bookmark, fields []string) {
+	slices.SortStableFunc(bookmarks, func(a, b readeck.Bookmark) int {
+		for _, field := range fields {
+			desc := strings.HasPrefix(field, "-")
+			var c int
+			switch strings.TrimPrefix(field, "-") {
+			case "created":
+				c = a.Created.Compare(b.Created)
+			case "published":
+				c = a.Published.Compare(b.Published)
+			case "title":
+				c = cmp.Compare(a.Title, b.Title)
+			}
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL    string   `json:"url"`
+		Title  string   `json:"title"`
+		Labels []string `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+		http.Error(w, "invalid bookmark", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	s.created = append(s.created, body.URL)
+	id := fmt.Sprintf("created-%d", len(s.created))
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	bookmark := readeck.Bookmark{ID: id, URL: body.URL, Title: body.Title, Labels: body.Labels, Created: now, Updated: now}
+	var article string
+	if s.Extract != nil {
+		article = s.Extract(&bookmark)
+	}
+	s.AddBookmark(bookmark, article)
+
+	w.Header().Set("Bookmark-Id", id)
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": http.StatusAccepted, "message": "Link submitted"})
+}
+
+func (s *Server) handleSyncEvents(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64); err == nil {
+		since = time.Unix(v, 0)
+	}
+
+	s.mu.Lock()
+	events := make([]readeck.BookmarkSync, 0, len(s.events))
+	for _, event := range s.events {
+		if !event.Time.Before(since) {
+			events = append(events, event)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.SyncPageSize > 0 {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		totalPages := max((len(events)+s.SyncPageSize-1)/s.SyncPageSize, 1)
+		w.Header().Set("Total-Pages", strconv.Itoa(totalPages))
+		if page < totalPages {
+			next := r.URL.Query()
+			next.Set("page", strconv.Itoa(page+1))
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/bookmarks/sync?%s>; rel="next"`, s.URL, next.Encode()))
+		}
+		start := min((page-1)*s.SyncPageSize, len(events))
+		events = events[start:min(start+s.SyncPageSize, len(events))]
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) handleSyncContent(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid sync request", http.StatusBadRequest)
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range body.IDs {
+		bookmark, ok := s.bookmarks[id]
+		if !ok {
+			continue
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", "application/json")
+		header.Set("Type", "json")
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bookmark_%s.json"`, id))
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return
+		}
+		_ = json.NewEncoder(part).Encode(bookmark)
+	}
+	_ = mw.Close()
+}
+
+func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	annotations := []readeck.Annotation{}
+	for _, annotation := range s.annotations {
+		if annotation.BookmarkID == id {
+			annotations = append(annotations, annotation)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, annotations)
+}
+
+func (s *Server) handleDetails(w http.ResponseWriter, r *http.Request) {
+	bookmark, ok := s.Bookmark(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, bookmark)
+}
+
+func (s *Server) handleArticle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	article, ok := s.articles[r.PathValue("id")]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(article))
+}
+
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var data map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updates = append(s.updates, Update{ID: id, Data: data})
+	bookmark, ok := s.bookmarks[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if v, ok := data["is_deleted"].(bool); ok && v {
+		s.remove(id)
+		s.record(id, "delete")
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "is_deleted": true})
+		return
+	}
+	if v, ok := data["is_archived"].(bool); ok {
+		bookmark.IsArchived = v
+	}
+	if v, ok := data["is_marked"].(bool); ok {
+		bookmark.IsMarked = v
+	}
+	if v, ok := data["read_progress"].(float64); ok {
+		bookmark.ReadProgress = int(v)
+	}
+	bookmark.Updated = time.Now().UTC()
+	s.record(id, "update")
+
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "updated": bookmark.Updated})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
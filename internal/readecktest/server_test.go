@@ -0,0 +1,91 @@
+package readecktest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"readeckobo/internal/logger"
+	"readeckobo/internal/readeck"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	start := time.Now().Add(-time.Second)
+	server.AddBookmark(readeck.Bookmark{ID: "1", Title: "First", URL: "https://example.com/a", Created: start}, "<p>article</p>")
+	server.AddBookmark(readeck.Bookmark{ID: "2", Title: "Second", URL: "https://news.example.org/b", Created: start.Add(time.Minute)}, "")
+	server.DeleteBookmark("3")
+
+	client, err := readeck.NewClient(server.URL, "test-token", logger.New(logger.DEBUG), server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create readeck client: %v", err)
+	}
+	ctx := context.Background()
+
+	bookmarks, total, err := client.ListBookmarks(ctx, readeck.ListBookmarksOptions{Limit: 1, Sort: []string{"-created"}})
+	if err != nil || total != 2 || len(bookmarks) != 1 || bookmarks[0].ID != "2" {
+		t.Fatalf("expected the newest of 2 bookmarks, got %+v, %d, %v", bookmarks, total, err)
+	}
+	if bookmarks, _, err := client.GetBookmarks(ctx, "example.org", 1, nil); err != nil || len(bookmarks) != 1 || bookmarks[0].ID != "2" {
+		t.Errorf("expected bookmark 2 for site example.org, got %+v, %v", bookmarks, err)
+	}
+
+	events, err := client.GetBookmarksSync(ctx, &start)
+	if err != nil || len(events) != 3 || events[2].Type != "delete" {
+		t.Fatalf("expected 2 updates and a delete, got %+v, %v", events, err)
+	}
+	details, err := client.SyncBookmarksContent(ctx, []string{"1", "2", "3"})
+	if err != nil || len(details) != 2 || details["1"].Title != "First" {
+		t.Errorf("expected details for bookmarks 1 and 2, got %+v, %v", details, err)
+	}
+	if article, err := client.GetBookmarkArticle(ctx, "1"); err != nil || article != "<p>article</p>" {
+		t.Errorf("expected the article of bookmark 1, got %q, %v", article, err)
+	}
+
+	if err := client.UpdateBookmark(ctx, "1", map[string]any{"is_archived": true}); err != nil {
+		t.Fatalf("UpdateBookmark failed: %v", err)
+	}
+	if bookmark, _ := server.Bookmark("1"); !bookmark.IsArchived {
+		t.Error("expected bookmark 1 to be archived")
+	}
+	if updates := server.Updates(); len(updates) != 1 || updates[0].ID != "1" {
+		t.Errorf("expected one update of bookmark 1, got %+v", updates)
+	}
+
+	id, err := client.CreateBookmark(ctx, "https://example.com/new", readeck.CreateBookmarkOptions{})
+	if err != nil || id == "" {
+		t.Fatalf("expected a created bookmark ID, got %q, %v", id, err)
+	}
+	if created := server.Created(); len(created) != 1 || created[0] != "https://example.com/new" {
+		t.Errorf("expected the created URL to be recorded, got %v", created)
+	}
+
+	server.Fail(http.MethodGet, "/api/bookmarks/sync", http.StatusServiceUnavailable)
+	if _, err := client.GetBookmarksSync(ctx, nil); !readeck.IsUnavailable(err) {
+		t.Errorf("expected an unavailable error, got %v", err)
+	}
+}
+
+func TestServerSyncPages(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SyncPageSize = 2
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		server.AddBookmark(readeck.Bookmark{ID: id}, "")
+	}
+
+	client, err := readeck.NewClient(server.URL, "test-token", logger.New(logger.DEBUG), server.Client())
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	events, err := client.GetBookmarksSync(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("GetBookmarksSync failed: %v", err)
+	}
+	if len(events) != 5 {
+		t.Errorf("expected the events of all 3 pages, got %+v", events)
+	}
+}
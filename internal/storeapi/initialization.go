@@ -0,0 +1,335 @@
+// Package storeapi proxies the Kobo store API, rewriting the parts of its
+// responses that point the device at Instapaper so it talks to readeckobo.
+package storeapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+// initializationPath is the store API path serving the device configuration.
+const initializationPath = "/v1/initialization"
+
+// InitializationProxy forwards the Kobo's initialization request to the store
+// and points the Instapaper resource URLs of the response at this bridge.
+type InitializationProxy struct {
+	upstream  *url.URL
+	bridgeURL string
+	// pathPrefix is added to the bridge URL derived from requests.
+	pathPrefix string
+	rewrite    []string
+	cacheTTL   time.Duration
+	client     *http.Client
+	logger     *logger.Logger
+
+	// offline answers with generated resources instead of the store's.
+	offline          bool
+	offlineResources map[string]string
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+}
+
+// cachedResponse is a rewritten initialization response.
+type cachedResponse struct {
+	header    http.Header
+	body      []byte
+	fetchedAt time.Time
+}
+
+// NewInitializationProxy creates a proxy for cfg. A nil client uses
+// http.DefaultClient.
+func NewInitializationProxy(cfg config.ConfigKoboStore, client *http.Client, logger *logger.Logger) (*InitializationProxy, error) {
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kobo_store.upstream: %w", err)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &InitializationProxy{
+		upstream:  upstream,
+		bridgeURL: strings.TrimSuffix(cfg.BridgeURL, "/"),
+		rewrite:   cfg.RewriteURLs,
+		cacheTTL:  cfg.CacheTTL,
+		client:    client,
+		logger:    logger,
+		cache:     make(map[string]cachedResponse),
+
+		offline:          cfg.Offline,
+		offlineResources: cfg.OfflineResources,
+	}, nil
+}
+
+// SetPathPrefix sets the subpath readeckobo is served under, added to the
+// URLs pointed at the bridge unless kobo_store.bridge_url is set.
+func (p *InitializationProxy) SetPathPrefix(prefix string) {
+	p.pathPrefix = strings.TrimSuffix(prefix, "/")
+}
+
+func (p *InitializationProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.logger.Debugf("Incoming Kobo Request for %s:\nMethod: %s\nURL: %s\nHeaders: %v", initializationPath, r.Method, r.URL, p.logger.RedactHeader(r.Header))
+
+	if p.offline {
+		p.serveOffline(w, r)
+		return
+	}
+
+	// The response carries device specific tokens, so it is cached per device.
+	key := r.Header.Get("Authorization") + "\x00" + r.URL.RawQuery
+	if cached, ok := p.cached(key, false); ok {
+		writeCached(w, cached)
+		return
+	}
+
+	resp, err := p.fetch(r)
+	if err == nil && resp.status >= http.StatusInternalServerError {
+		err = fmt.Errorf("store returned status %d", resp.status)
+		if _, ok := p.cached(key, true); !ok {
+			err = nil
+		}
+	}
+	if err != nil {
+		// A stale configuration is better than none while the store is down.
+		if cached, ok := p.cached(key, true); ok {
+			p.logger.Warnf("Error fetching %s, serving cached response: %v, URL: %s, Params: %v", initializationPath, err, r.URL.Path, r.URL.Query())
+			writeCached(w, cached)
+			return
+		}
+		http.Error(w, "Failed to reach the Kobo store", http.StatusBadGateway)
+		p.logger.Errorf("Error fetching %s: %v, URL: %s, Params: %v", initializationPath, err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	if resp.status == http.StatusOK && p.cacheTTL > 0 {
+		p.store(key, cachedResponse{header: resp.header, body: resp.body, fetchedAt: time.Now()})
+	}
+
+	copyHeader(w.Header(), resp.header)
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// upstreamResponse is a buffered response from the store.
+type upstreamResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (p *InitializationProxy) fetch(r *http.Request) (*upstreamResponse, error) {
+	target := *p.upstream
+	target.Path = strings.TrimSuffix(target.Path, "/") + initializationPath
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	copyHeader(req.Header, r.Header)
+	removeHopHeaders(req.Header)
+	// Let the transport negotiate and decode compression so the body can be rewritten.
+	req.Header.Del("Accept-Encoding")
+	req.Host = target.Host
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	header := resp.Header.Clone()
+	removeHopHeaders(header)
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	if resp.StatusCode == http.StatusOK {
+		body = p.rewriteBody(body, p.bridge(r))
+	}
+	return &upstreamResponse{status: resp.StatusCode, header: header, body: body}, nil
+}
+
+// rewriteBody replaces the configured URLs in every string of the
+// initialization JSON with base. A body that is not JSON is returned as is.
+func (p *InitializationProxy) rewriteBody(body []byte, base string) []byte {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		p.logger.Warnf("Error decoding %s response, forwarding it unchanged: %v", initializationPath, err)
+		return body
+	}
+
+	var rewritten int
+	doc = rewriteURLs(doc, func(s string) string {
+		for _, prefix := range p.rewrite {
+			if strings.HasPrefix(s, prefix) {
+				rewritten++
+				return base + strings.TrimPrefix(s, prefix)
+			}
+		}
+		return s
+	})
+	p.logger.Debugf("Rewrote %d resource URLs in %s to %s", rewritten, initializationPath, base)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		p.logger.Warnf("Error encoding %s response, forwarding it unchanged: %v", initializationPath, err)
+		return body
+	}
+	return buf.Bytes()
+}
+
+func rewriteURLs(v any, rewrite func(string) string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = rewriteURLs(child, rewrite)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = rewriteURLs(child, rewrite)
+		}
+	case string:
+		return rewrite(v)
+	}
+	return v
+}
+
+// bridge returns the URL the Kobo should use to reach readeckobo's Instapaper API.
+func (p *InitializationProxy) bridge(r *http.Request) string {
+	return BaseURL(p.bridgeURL, p.pathPrefix, r) + InstapaperPath
+}
+
+// InstapaperPath is where the Kobo is pointed for the Instapaper API, beside
+// the store API under /instapaper-proxy/storeapi.
+const InstapaperPath = "/instapaper-proxy/instapaper"
+
+// BaseURL returns the URL the Kobo reaches readeckobo at, without
+// InstapaperPath: bridgeURL, the kobo_store.bridge_url including that path,
+// when set, and otherwise the scheme and host r was sent to under pathPrefix.
+// A reverse proxy's X-Forwarded-Proto gives the scheme when no trusted proxy
+// set it, as it only shapes the URLs handed back to the requester.
+func BaseURL(bridgeURL, pathPrefix string, r *http.Request) string {
+	if bridgeURL != "" {
+		return strings.TrimSuffix(strings.TrimSuffix(bridgeURL, "/"), InstapaperPath)
+	}
+	scheme := r.URL.Scheme
+	if proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); scheme == "" && (proto == "http" || proto == "https") {
+		scheme = proto
+	}
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host + strings.TrimSuffix(pathPrefix, "/")
+}
+
+func (p *InitializationProxy) cached(key string, allowStale bool) (cachedResponse, bool) {
+	if p.cacheTTL <= 0 {
+		return cachedResponse{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cached, ok := p.cache[key]
+	if !ok || (!allowStale && time.Since(cached.fetchedAt) > p.cacheTTL) {
+		return cachedResponse{}, false
+	}
+	return cached, true
+}
+
+// store caches response under key and drops the entries older than the
+// TTL, so devices that stopped syncing do not stay in memory. Only a
+// successful fetch stores, so stale entries are still there to fall back on
+// while the store is down.
+func (p *InitializationProxy) store(key string, response cachedResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, cached := range p.cache {
+		if response.fetchedAt.Sub(cached.fetchedAt) > p.cacheTTL {
+			delete(p.cache, k)
+		}
+	}
+	p.cache[key] = response
+}
+
+func writeCached(w http.ResponseWriter, cached cachedResponse) {
+	copyHeader(w.Header(), cached.header)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(cached.body)
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, values := range src {
+		for _, v := range values {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// hopHeaders apply to a single connection and are not forwarded, as in
+// httputil.ReverseProxy.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders deletes the hop-by-hop headers of h, including those
+// named in its Connection header.
+func removeHopHeaders(h http.Header) {
+	for _, field := range h["Connection"] {
+		for _, name := range strings.Split(field, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// Name identifies the cache on the admin dashboard.
+func (p *InitializationProxy) Name() string {
+	return "Kobo store initialization"
+}
+
+// Len returns the number of cached responses.
+func (p *InitializationProxy) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.cache)
+}
+
+// Invalidate drops every cached response.
+func (p *InitializationProxy) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cache = make(map[string]cachedResponse)
+}
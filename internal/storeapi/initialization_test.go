@@ -0,0 +1,246 @@
+package storeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+const mockInitialization = `{"Resources":{"instapaper_env_url":"https://www.instapaper.com/api/kobo","library_sync":"https://storeapi.kobo.com/v1/library/sync","image_host":"https://cdn.kobo.com/book-images/"}}`
+
+func TestInitializationProxy(t *testing.T) {
+	var upstreamCalls int
+	upstreamUp := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		if !upstreamUp {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != initializationPath {
+			t.Errorf("unexpected upstream path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer device" {
+			t.Errorf("expected Authorization to be forwarded, got %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Kobo-Apitoken", "e30=")
+		_, _ = w.Write([]byte(mockInitialization))
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		name        string
+		bridgeURL   string
+		pathPrefix  string
+		header      http.Header
+		cacheTTL    time.Duration
+		expectedURL string
+	}{
+		{name: "configured bridge url", bridgeURL: "https://kobo.example.com/instapaper-proxy/instapaper/", expectedURL: "https://kobo.example.com/instapaper-proxy/instapaper/api/kobo"},
+		{name: "bridge url from request", expectedURL: "http://example.com/instapaper-proxy/instapaper/api/kobo"},
+		{name: "cached", cacheTTL: time.Hour, expectedURL: "http://example.com/instapaper-proxy/instapaper/api/kobo"},
+		{name: "path prefix", pathPrefix: "/readeckobo/", expectedURL: "http://example.com/readeckobo/instapaper-proxy/instapaper/api/kobo"},
+		// nginx.conf.snippet passes the host and the scheme it was reached by.
+		{name: "behind nginx", header: http.Header{"X-Forwarded-Proto": {"https"}}, expectedURL: "https://example.com/instapaper-proxy/instapaper/api/kobo"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstreamCalls = 0
+			upstreamUp = true
+			proxy, err := NewInitializationProxy(config.ConfigKoboStore{
+				Upstream:    upstream.URL,
+				BridgeURL:   tc.bridgeURL,
+				RewriteURLs: []string{"https://www.instapaper.com"},
+				CacheTTL:    tc.cacheTTL,
+			}, upstream.Client(), logger.New(logger.ERROR))
+			if err != nil {
+				t.Fatalf("NewInitializationProxy() error = %v", err)
+			}
+			proxy.SetPathPrefix(tc.pathPrefix)
+
+			get := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/instapaper-proxy/storeapi/v1/initialization", nil)
+				for k, v := range tc.header {
+					req.Header[k] = v
+				}
+				req.Header.Set("Authorization", "Bearer device")
+				rr := httptest.NewRecorder()
+				proxy.ServeHTTP(rr, req)
+				return rr
+			}
+
+			rr := get()
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			if rr.Header().Get("X-Kobo-Apitoken") != "e30=" {
+				t.Errorf("expected upstream headers to be forwarded, got %v", rr.Header())
+			}
+			var resp struct {
+				Resources map[string]string `json:"Resources"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := resp.Resources["instapaper_env_url"]; got != tc.expectedURL {
+				t.Errorf("expected instapaper_env_url %q, got %q", tc.expectedURL, got)
+			}
+			if got := resp.Resources["library_sync"]; got != "https://storeapi.kobo.com/v1/library/sync" {
+				t.Errorf("expected library_sync to be unchanged, got %q", got)
+			}
+
+			// With a cache the store is not asked again, even once it is down.
+			upstreamUp = false
+			rr = get()
+			if tc.cacheTTL > 0 {
+				if rr.Code != http.StatusOK || upstreamCalls != 1 {
+					t.Errorf("expected cached response, got status %d after %d upstream calls", rr.Code, upstreamCalls)
+				}
+			} else if rr.Code != http.StatusServiceUnavailable {
+				t.Errorf("expected upstream status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInitializationProxyHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"Keep-Alive", "Proxy-Authorization", "Te", "Upgrade", "X-Hop"} {
+			if r.Header.Get(name) != "" {
+				t.Errorf("expected %s not to be forwarded, got %q", name, r.Header.Get(name))
+			}
+		}
+		if r.Header.Get("X-Kobo-Deviceid") != "kobo" {
+			t.Errorf("expected X-Kobo-Deviceid to be forwarded, got %q", r.Header.Get("X-Kobo-Deviceid"))
+		}
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "1")
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		_, _ = w.Write([]byte(mockInitialization))
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewInitializationProxy(config.ConfigKoboStore{Upstream: upstream.URL}, upstream.Client(), logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("NewInitializationProxy() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/initialization", nil)
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("X-Kobo-Deviceid", "kobo")
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	for _, name := range []string{"Connection", "X-Upstream-Hop", "Proxy-Authenticate"} {
+		if rr.Header().Get(name) != "" {
+			t.Errorf("expected %s not to be returned, got %q", name, rr.Header().Get(name))
+		}
+	}
+}
+
+func TestInitializationProxyEvictsExpired(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(mockInitialization))
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewInitializationProxy(config.ConfigKoboStore{Upstream: upstream.URL, CacheTTL: time.Hour}, upstream.Client(), logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("NewInitializationProxy() error = %v", err)
+	}
+	get := func(device string) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/initialization", nil)
+		req.Header.Set("Authorization", "Bearer "+device)
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	get("one")
+	get("two")
+	if proxy.Len() != 2 {
+		t.Fatalf("expected 2 cached responses, got %d", proxy.Len())
+	}
+	proxy.mu.Lock()
+	for key, cached := range proxy.cache {
+		cached.fetchedAt = cached.fetchedAt.Add(-2 * time.Hour)
+		proxy.cache[key] = cached
+	}
+	proxy.mu.Unlock()
+
+	get("three")
+	if proxy.Len() != 1 {
+		t.Errorf("expected the expired responses to be evicted, got %d cached", proxy.Len())
+	}
+}
+
+func TestInitializationProxyOffline(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected upstream request %s", r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	cfg := config.ConfigKoboStore{
+		Upstream:    upstream.URL,
+		Passthrough: true,
+		RewriteURLs: []string{"https://www.instapaper.com", "https://getpocket.com"},
+		Offline:     true,
+		OfflineResources: map[string]string{
+			"pocket_env_url": "https://getpocket.com/v3",
+			"image_host":     "https://cdn.kobo.com/book-images/",
+		},
+	}
+	proxy, err := NewInitializationProxy(cfg, upstream.Client(), logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("NewInitializationProxy() error = %v", err)
+	}
+	proxy.SetPathPrefix("/readeckobo")
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/initialization", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("X-Kobo-Apitoken") != "e30=" {
+		t.Errorf("expected an API token header, got %v", rr.Header())
+	}
+	var resp struct {
+		Resources map[string]string `json:"Resources"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := map[string]string{
+		"instapaper_enabled": "True",
+		"instapaper_env_url": "http://example.com/readeckobo/instapaper-proxy/instapaper/api/kobo",
+		"pocket_env_url":     "http://example.com/readeckobo/instapaper-proxy/instapaper/v3",
+		"image_host":         "https://cdn.kobo.com/book-images/",
+	}
+	for key, want := range expected {
+		if got := resp.Resources[key]; got != want {
+			t.Errorf("expected %s %q, got %q", key, want, got)
+		}
+	}
+
+	// Other store requests are not forwarded either.
+	store, err := NewProxy("/instapaper-proxy/storeapi", cfg, upstream.Client().Transport, logger.New(logger.ERROR))
+	if err != nil {
+		t.Fatalf("NewProxy() error = %v", err)
+	}
+	rr = httptest.NewRecorder()
+	store.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/instapaper-proxy/storeapi/v1/library/sync", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package storeapi
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+)
+
+// offlineResources are the resources of the generated initialization
+// response: what the Kobo needs to use its read-later service, at the URLs
+// the store gives, which kobo_store.rewrite_urls points at the bridge.
+var offlineResources = map[string]string{
+	"instapaper_enabled": "True",
+	"instapaper_env_url": "https://www.instapaper.com/api/kobo",
+}
+
+// serveOffline answers with a generated initialization response, for
+// devices that never reach the store.
+func (p *InitializationProxy) serveOffline(w http.ResponseWriter, r *http.Request) {
+	resources := maps.Clone(offlineResources)
+	maps.Copy(resources, p.offlineResources)
+	body, err := json.Marshal(map[string]any{"Resources": resources})
+	if err != nil {
+		http.Error(w, "Failed to build the initialization response", http.StatusInternalServerError)
+		p.logger.Errorf("Error encoding offline %s response: %v, URL: %s, Params: %v", initializationPath, err, r.URL.Path, r.URL.Query())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// The Kobo expects an API token, which the store sends as "{}".
+	w.Header().Set("X-Kobo-Apitoken", "e30=")
+	_, _ = w.Write(p.rewriteBody(body, p.bridge(r)))
+}
@@ -0,0 +1,85 @@
+package storeapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+// Proxy forwards every Kobo store API request to the upstream store, except
+// for the routes intercepted by readeckobo: only GET /v1/initialization,
+// whose Instapaper URLs are rewritten.
+type Proxy struct {
+	prefix      string
+	passthrough bool
+	forward     *httputil.ReverseProxy
+	intercepted *http.ServeMux
+	logger      *logger.Logger
+}
+
+// NewProxy creates a proxy for store API requests under prefix. A nil
+// transport uses http.DefaultTransport.
+func NewProxy(prefix string, cfg config.ConfigKoboStore, transport http.RoundTripper, logger *logger.Logger) (*Proxy, error) {
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kobo_store.upstream: %w", err)
+	}
+
+	p := &Proxy{
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		passthrough: cfg.Passthrough && !cfg.Offline,
+		intercepted: http.NewServeMux(),
+		logger:      logger,
+	}
+	p.forward = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// SetURL also points the Host header at the store.
+			pr.SetURL(upstream)
+		},
+		Transport: transport,
+		// Stream responses such as library syncs as they arrive.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			p.logger.Errorf("Error forwarding to the Kobo store: %v, URL: %s, Params: %v", err, r.URL.Path, r.URL.Query())
+			http.Error(w, "Failed to reach the Kobo store", http.StatusBadGateway)
+		},
+	}
+	return p, nil
+}
+
+// Intercept serves requests matching pattern, relative to the store root
+// such as "GET /v1/initialization", with handler instead of the store.
+func (p *Proxy) Intercept(pattern string, handler http.Handler) {
+	p.intercepted.Handle(pattern, handler)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, p.prefix)
+	if path == r.URL.Path && p.prefix != "" {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Path = path
+	r.URL.RawPath = ""
+
+	if handler, pattern := p.intercepted.Handler(r); pattern != "" {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if !p.passthrough {
+		http.NotFound(w, r)
+		return
+	}
+	p.logger.Debugf("Forwarding %s %s to the Kobo store", r.Method, path)
+	p.forward.ServeHTTP(w, r)
+}
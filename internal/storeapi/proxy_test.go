@@ -0,0 +1,95 @@
+package storeapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+)
+
+func TestProxy(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, _ = zw.Write([]byte(`{"books":[]}`))
+	_ = zw.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Host", r.Host)
+		if r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped.Bytes())
+			return
+		}
+		_, _ = w.Write([]byte(`{"books":[]}`))
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		name            string
+		method          string
+		path            string
+		acceptEncoding  string
+		passthrough     bool
+		expectedCode    int
+		expectedBody    []byte
+		expectedUpPath  string
+		expectedEncoder string
+	}{
+		{name: "intercepted", method: http.MethodGet, path: "/storeapi/v1/initialization", passthrough: true, expectedCode: http.StatusOK, expectedBody: []byte("local")},
+		{name: "other method is forwarded", method: http.MethodPost, path: "/storeapi/v1/initialization", passthrough: true, expectedCode: http.StatusOK, expectedUpPath: "/v1/initialization"},
+		{name: "forwarded", method: http.MethodGet, path: "/storeapi/v1/library/sync", passthrough: true, expectedCode: http.StatusOK, expectedUpPath: "/v1/library/sync"},
+		{name: "gzip is passed through", method: http.MethodGet, path: "/storeapi/v1/library/sync", acceptEncoding: "gzip", passthrough: true, expectedCode: http.StatusOK, expectedBody: gzipped.Bytes(), expectedUpPath: "/v1/library/sync", expectedEncoder: "gzip"},
+		{name: "passthrough disabled", method: http.MethodGet, path: "/storeapi/v1/library/sync", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, err := NewProxy("/storeapi", config.ConfigKoboStore{Upstream: upstream.URL, Passthrough: tc.passthrough}, upstream.Client().Transport, logger.New(logger.ERROR))
+			if err != nil {
+				t.Fatalf("NewProxy() error = %v", err)
+			}
+			proxy.Intercept("GET /v1/initialization", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("local"))
+			}))
+
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+
+			req, _ := http.NewRequest(tc.method, server.URL+tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			// Keep the client from negotiating gzip on its own.
+			client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tc.expectedCode {
+				t.Fatalf("expected status %d, got %d", tc.expectedCode, resp.StatusCode)
+			}
+			if tc.expectedBody != nil && !bytes.Equal(body, tc.expectedBody) {
+				t.Errorf("expected body %q, got %q", tc.expectedBody, body)
+			}
+			if got := resp.Header.Get("X-Upstream-Path"); got != tc.expectedUpPath {
+				t.Errorf("expected upstream path %q, got %q", tc.expectedUpPath, got)
+			}
+			if tc.expectedUpPath != "" && resp.Header.Get("X-Upstream-Host") != strings.TrimPrefix(upstream.URL, "http://") {
+				t.Errorf("expected Host %q, got %q", upstream.URL, resp.Header.Get("X-Upstream-Host"))
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != tc.expectedEncoder {
+				t.Errorf("expected Content-Encoding %q, got %q", tc.expectedEncoder, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestSetupShutdownFlushesSpans(t *testing.T) {
+	var exports atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			exports.Add(1)
+		}
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup(context.Background(), config.ConfigTracing{
+		Enabled:     true,
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		Insecure:    true,
+		ServiceName: "readeckobo-test",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	_, span := Start(context.Background(), "test")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if exports.Load() == 0 {
+		t.Error("expected the batched span exported at shutdown")
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.ConfigTracing{})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("expected a no-op shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package urlnorm reduces article URLs to a canonical form, so that the URL
+// a Kobo asks for matches the bookmark Readeck saved for it despite redirect
+// wrappers, AMP variants and tracking parameters.
+package urlnorm
+
+import (
+	"net/url"
+	"strings"
+)
+
+// maxUnwrap bounds the redirect wrappers removed from one URL.
+const maxUnwrap = 5
+
+// wrapper is a redirect service that carries the target URL in a query
+// parameter.
+type wrapper struct {
+	host string
+	// path is a prefix of the wrapper's path; empty matches any path.
+	path   string
+	params []string
+}
+
+var wrappers = []wrapper{
+	{host: "google.com", path: "/url", params: []string{"q", "url"}},
+	{host: "l.facebook.com", path: "/l.php", params: []string{"u"}},
+	{host: "lm.facebook.com", path: "/l.php", params: []string{"u"}},
+	{host: "l.instagram.com", params: []string{"u"}},
+	{host: "out.reddit.com", params: []string{"url"}},
+	{host: "t.umblr.com", path: "/redirect", params: []string{"z"}},
+	{host: "youtube.com", path: "/redirect", params: []string{"q"}},
+	{host: "slack-redir.net", path: "/link", params: []string{"url"}},
+	{host: "linkedin.com", path: "/redir/redirect", params: []string{"url"}},
+	{host: "duckduckgo.com", path: "/l/", params: []string{"uddg"}},
+}
+
+// trackingParams are query parameters that only identify a campaign or a
+// click. Parameters starting with "utm_" are tracking parameters too.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true,
+	"msclkid": true, "yclid": true, "igshid": true, "mc_cid": true, "mc_eid": true,
+	"_hsenc": true, "_hsmi": true, "mkt_tok": true,
+	// AMP variants of a page are selected with these.
+	"amp": true, "outputtype": true,
+}
+
+// Canonical returns rawURL without redirect wrappers, AMP variants,
+// tracking parameters and fragment, with http upgraded to https, the host
+// lowercased without "www.", "amp." or default port, and no trailing slash.
+func Canonical(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	for range maxUnwrap {
+		target := unwrap(u)
+		if target == nil {
+			break
+		}
+		u = target
+	}
+
+	u.Fragment, u.RawFragment = "", ""
+	if u.Host != "" {
+		u.Host = canonicalHost(u.Scheme, u.Host)
+	}
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	u.Path = canonicalPath(u.Path)
+	u.RawPath = ""
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			lower := strings.ToLower(name)
+			if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+				query.Del(name)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u, nil
+}
+
+// Key returns the canonical form of rawURL without its query, as sites and
+// Readeck disagree on which parameters belong to an article's URL.
+func Key(rawURL string) (string, error) {
+	u, err := Canonical(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery, u.ForceQuery = "", false
+	return u.String(), nil
+}
+
+// Equal reports whether url1 and url2 point at the same article.
+func Equal(url1, url2 string) (bool, error) {
+	k1, err := Key(url1)
+	if err != nil {
+		return false, err
+	}
+	k2, err := Key(url2)
+	if err != nil {
+		return false, err
+	}
+	return k1 == k2, nil
+}
+
+// unwrap returns the URL wrapped by u, or nil when u is not a known redirect
+// wrapper or AMP viewer.
+func unwrap(u *url.URL) *url.URL {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	// Google's AMP viewer and cache embed the target as /amp/s/<host>/<path>
+	// and /c/s/<host>/<path>, where "s/" marks https.
+	var embedded string
+	switch {
+	case host == "google.com" && strings.HasPrefix(u.Path, "/amp/"):
+		embedded = strings.TrimPrefix(u.Path, "/amp/")
+	case strings.HasSuffix(host, ".cdn.ampproject.org") && (strings.HasPrefix(u.Path, "/c/") || strings.HasPrefix(u.Path, "/v/")):
+		embedded = u.Path[len("/c/"):]
+	}
+	if embedded != "" {
+		scheme := "http://"
+		if rest, ok := strings.CutPrefix(embedded, "s/"); ok {
+			scheme, embedded = "https://", rest
+		}
+		return parseTarget(scheme + embedded)
+	}
+
+	if host == "href.li" {
+		return parseTarget(u.RawQuery)
+	}
+	for _, w := range wrappers {
+		if host != w.host || !strings.HasPrefix(u.Path, w.path) {
+			continue
+		}
+		query := u.Query()
+		for _, param := range w.params {
+			if target := parseTarget(query.Get(param)); target != nil {
+				return target
+			}
+		}
+	}
+	return nil
+}
+
+// parseTarget parses the URL a wrapper points at, which must be absolute.
+func parseTarget(raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	return u
+}
+
+func canonicalHost(scheme, host string) string {
+	host = strings.ToLower(host)
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndexByte(host, ':')]
+	}
+	host = strings.TrimSuffix(host, ".")
+	for _, prefix := range []string{"www.", "amp."} {
+		// Keep the prefix of bare domains such as amp.dev.
+		if rest, ok := strings.CutPrefix(host, prefix); ok && strings.Contains(rest, ".") {
+			host = rest
+		}
+	}
+	return host
+}
+
+// canonicalPath drops AMP path variants and trailing slashes.
+func canonicalPath(path string) string {
+	path = strings.TrimRight(path, "/")
+	if rest, ok := strings.CutPrefix(path, "/amp/"); ok {
+		path = "/" + rest
+	}
+	path = strings.TrimSuffix(path, "/amp")
+	if strings.HasSuffix(path, ".amp.html") {
+		path = strings.TrimSuffix(path, ".amp.html") + ".html"
+	} else {
+		path = strings.TrimSuffix(path, ".amp")
+	}
+	return strings.TrimRight(path, "/")
+}
@@ -0,0 +1,240 @@
+package urlnorm
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url1     string
+		url2     string
+		expected bool
+		hasError bool
+	}{
+		{
+			name:     "exact match",
+			url1:     "https://example.com/path/to/resource",
+			url2:     "https://example.com/path/to/resource",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "match with www. prefix on url1",
+			url1:     "https://www.example.com/path",
+			url2:     "https://example.com/path",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "match with www. prefix on url2",
+			url1:     "https://example.com/path",
+			url2:     "https://www.example.com/path",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "match with different query parameters",
+			url1:     "https://example.com/path?param1=value1",
+			url2:     "https://example.com/path?param2=value2",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "match with different fragments",
+			url1:     "https://example.com/path#section1",
+			url2:     "https://example.com/path#section2",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "match with different query params and fragments",
+			url1:     "https://www.example.com/path?p1=v1#s1",
+			url2:     "https://example.com/path?p2=v2#s2",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "mismatch in path",
+			url1:     "https://example.com/path1",
+			url2:     "https://example.com/path2",
+			expected: false,
+			hasError: false,
+		},
+		{
+			name:     "mismatch in host",
+			url1:     "https://example.com/path",
+			url2:     "https://anotherexample.com/path",
+			expected: false,
+			hasError: false,
+		},
+		{
+			name:     "http and https",
+			url1:     "http://example.com/path",
+			url2:     "https://example.com/path",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "invalid url1 (relative path)",
+			url1:     "invalid-url",
+			url2:     "https://example.com/path",
+			expected: false,
+			hasError: false,
+		},
+		{
+			name:     "invalid url2 (relative path)",
+			url1:     "https://example.com/path",
+			url2:     "invalid-url",
+			expected: false,
+			hasError: false,
+		},
+		{
+			name:     "empty urls",
+			url1:     "",
+			url2:     "",
+			expected: true, // Empty URLs are considered equal after parsing to base components
+			hasError: false,
+		},
+		{
+			name:     "url with trailing slash",
+			url1:     "https://example.com/path/",
+			url2:     "https://example.com/path",
+			expected: true,
+			hasError: false,
+		},
+		{
+			name:     "AMP subdomain",
+			url1:     "https://amp.example.com/news/story",
+			url2:     "https://www.example.com/news/story",
+			expected: true,
+		},
+		{
+			name:     "AMP path suffix",
+			url1:     "https://example.com/news/story/amp/",
+			url2:     "https://example.com/news/story",
+			expected: true,
+		},
+		{
+			name:     "AMP path prefix",
+			url1:     "https://example.com/amp/news/story",
+			url2:     "https://example.com/news/story",
+			expected: true,
+		},
+		{
+			name:     "AMP file variant",
+			url1:     "https://example.com/news/story.amp.html",
+			url2:     "https://example.com/news/story.html",
+			expected: true,
+		},
+		{
+			name:     "Google AMP viewer",
+			url1:     "https://www.google.com/amp/s/www.example.com/news/story/amp",
+			url2:     "https://example.com/news/story",
+			expected: true,
+		},
+		{
+			name:     "AMP cache",
+			url1:     "https://www-example-com.cdn.ampproject.org/c/s/www.example.com/news/story",
+			url2:     "https://example.com/news/story",
+			expected: true,
+		},
+		{
+			name:     "Google redirect",
+			url1:     "https://www.google.com/url?sa=t&url=https%3A%2F%2Fexample.com%2Fpost&usg=x",
+			url2:     "https://example.com/post",
+			expected: true,
+		},
+		{
+			name:     "Facebook redirect",
+			url1:     "https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2Fpost%3Ffbclid%3Dabc&h=x",
+			url2:     "https://example.com/post",
+			expected: true,
+		},
+		{
+			name:     "nested redirects",
+			url1:     "https://out.reddit.com/t3_x?url=https%3A%2F%2Fwww.google.com%2Furl%3Fq%3Dhttps%253A%252F%252Fexample.com%252Fpost",
+			url2:     "https://example.com/post",
+			expected: true,
+		},
+		{
+			name:     "href.li",
+			url1:     "https://href.li/?https://example.com/post",
+			url2:     "https://example.com/post",
+			expected: true,
+		},
+		{
+			name:     "wrapper without a target",
+			url1:     "https://www.google.com/url?q=not-a-url",
+			url2:     "https://google.com/url",
+			expected: true,
+		},
+		{
+			name:     "default port and uppercase host",
+			url1:     "https://EXAMPLE.com:443/post",
+			url2:     "http://example.com:80/post",
+			expected: true,
+		},
+		{
+			name:     "bare amp domain",
+			url1:     "https://amp.dev/about",
+			url2:     "https://dev/about",
+			expected: false,
+		},
+		{
+			name:     "other port",
+			url1:     "https://example.com:8443/post",
+			url2:     "https://example.com/post",
+			expected: false,
+		},
+		{
+			name:     "different subdomain",
+			url1:     "https://blog.example.com/post",
+			url2:     "https://example.com/post",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			match, err := Equal(tc.url1, tc.url2)
+
+			if tc.hasError {
+				if err == nil {
+					t.Errorf("Expected an error but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Did not expect an error but got: %v", err)
+				}
+				if match != tc.expected {
+					t.Errorf("Expected match to be %v, but got %v", tc.expected, match)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://example.com/post?utm_source=rss&utm_medium=feed&id=5#comments", "https://example.com/post?id=5"},
+		{"http://www.example.com/post/?UTM_Campaign=x&gclid=1&amp=1", "https://example.com/post"},
+		{"https://example.com/?outputType=amp", "https://example.com"},
+		{"https://example.com/a%2Fb", "https://example.com/a/b"},
+		{"ftp://example.com/file/", "ftp://example.com/file"},
+		{"https://t.umblr.com/redirect?z=https%3A%2F%2Fexample.com%2Fpost%3Futm_source%3Dtumblr&t=x", "https://example.com/post"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := Canonical(tt.raw)
+			if err != nil {
+				t.Fatalf("Canonical(%q) failed: %v", tt.raw, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Canonical(%q) = %q, want %q", tt.raw, got.String(), tt.want)
+			}
+		})
+	}
+}
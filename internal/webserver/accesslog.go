@@ -0,0 +1,172 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"readeckobo/internal/app"
+	"readeckobo/internal/config"
+)
+
+// Access log formats.
+const (
+	accessLogDefault  = "default"
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+)
+
+// AccessLog writes one line per request in the configured format.
+type AccessLog struct {
+	format string
+	out    *log.Logger
+	closer io.Closer
+}
+
+// accessLogEntry is a single request as written by the json format.
+type accessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	Device     string        `json:"device,omitempty"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Proto      string        `json:"proto"`
+	Status     int           `json:"status"`
+	Bytes      int           `json:"bytes"`
+	Duration   time.Duration `json:"-"`
+	DurationMS float64       `json:"duration_ms"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+}
+
+// NewAccessLog creates an access log writing to cfg.File, or to stderr when
+// no file is configured.
+func NewAccessLog(cfg config.ConfigAccessLog) (*AccessLog, error) {
+	format := cfg.Format
+	if format == "" {
+		format = accessLogDefault
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if cfg.File != "" {
+		rotator := &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxAge:     cfg.MaxAgeDays,
+			MaxBackups: cfg.MaxBackups,
+		}
+		// Open the file now so a bad path fails at startup, not on the first request.
+		if _, err := rotator.Write(nil); err != nil {
+			return nil, fmt.Errorf("failed to open access log %s: %w", cfg.File, err)
+		}
+		w, closer = rotator, rotator
+	}
+
+	flags := log.LstdFlags
+	if format != accessLogDefault {
+		// combined and json carry their own timestamp.
+		flags = 0
+	}
+	return &AccessLog{format: format, out: log.New(w, "", flags), closer: closer}, nil
+}
+
+// Close closes the access log file, if any.
+func (l *AccessLog) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Middleware logs every request served by next.
+func (l *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(w)
+		r, info := app.WithRequestInfo(r)
+		next.ServeHTTP(rw, r)
+		duration := time.Since(start)
+
+		l.write(accessLogEntry{
+			Time:       start,
+			RemoteAddr: remoteHost(r.RemoteAddr),
+			Device:     info.Device,
+			Method:     r.Method,
+			URI:        requestURI(r),
+			Proto:      r.Proto,
+			Status:     rw.statusCode,
+			Bytes:      rw.bytes,
+			Duration:   duration,
+			DurationMS: float64(duration.Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		})
+	})
+}
+
+// requestURI returns the request URI with tokens in the query string masked,
+// as /api/save accepts its token there.
+func requestURI(r *http.Request) string {
+	query := r.URL.Query()
+	masked := false
+	for _, key := range []string{"token", "access_token"} {
+		if query.Has(key) {
+			query.Set(key, "REDACTED")
+			masked = true
+		}
+	}
+	if !masked {
+		return r.RequestURI
+	}
+	return r.URL.EscapedPath() + "?" + query.Encode()
+}
+
+func (l *AccessLog) write(e accessLogEntry) {
+	switch l.format {
+	case accessLogCombined:
+		l.out.Printf(
+			"%s - %s [%s] \"%s %s %s\" %d %d \"%s\" \"%s\"",
+			e.RemoteAddr,
+			dashIfEmpty(e.Device),
+			e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method,
+			e.URI,
+			e.Proto,
+			e.Status,
+			e.Bytes,
+			dashIfEmpty(e.Referer),
+			dashIfEmpty(e.UserAgent),
+		)
+	case accessLogJSON:
+		line, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("Error encoding access log entry: %v", err)
+			return
+		}
+		l.out.Print(string(line))
+	default:
+		l.out.Printf(
+			"%-7s %s %d %s device=%s ua=%q",
+			e.Method,
+			e.URI,
+			e.Status,
+			e.Duration,
+			dashIfEmpty(e.Device),
+			e.UserAgent,
+		)
+	}
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
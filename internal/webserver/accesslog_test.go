@@ -0,0 +1,89 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestAccessLog(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		check  func(t *testing.T, line string)
+	}{
+		{
+			name:   "combined",
+			format: accessLogCombined,
+			check: func(t *testing.T, line string) {
+				if !strings.HasPrefix(line, "192.0.2.1 - - [") {
+					t.Errorf("unexpected prefix in %q", line)
+				}
+				if !strings.HasSuffix(line, `"GET /api/kobo/get HTTP/1.1" 418 5 "-" "Kobo Touch"`) {
+					t.Errorf("unexpected suffix in %q", line)
+				}
+			},
+		},
+		{
+			name:   "json",
+			format: accessLogJSON,
+			check: func(t *testing.T, line string) {
+				var entry accessLogEntry
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("Failed to decode %q: %v", line, err)
+				}
+				if entry.RemoteAddr != "192.0.2.1" || entry.Status != http.StatusTeapot || entry.Bytes != 5 || entry.UserAgent != "Kobo Touch" {
+					t.Errorf("unexpected entry %+v", entry)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			accessLog, err := NewAccessLog(config.ConfigAccessLog{Format: tc.format, File: path})
+			if err != nil {
+				t.Fatalf("NewAccessLog() error = %v", err)
+			}
+
+			handler := accessLog.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				_, _ = w.Write([]byte("hello"))
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/kobo/get", nil)
+			req.Header.Set("User-Agent", "Kobo Touch")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if err := accessLog.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read access log: %v", err)
+			}
+			tc.check(t, strings.TrimSpace(string(data)))
+		})
+	}
+}
+
+func TestRequestURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "/api/kobo/get?since=1", want: "/api/kobo/get?since=1"},
+		{uri: "/api/save?token=secret&url=http%3A%2F%2Fexample.com", want: "/api/save?token=REDACTED&url=http%3A%2F%2Fexample.com"},
+	}
+	for _, tt := range tests {
+		if got := requestURI(httptest.NewRequest(http.MethodPost, tt.uri, nil)); got != tt.want {
+			t.Errorf("requestURI(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
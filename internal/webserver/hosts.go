@@ -0,0 +1,61 @@
+package webserver
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"readeckobo/internal/config"
+)
+
+// hostRouteGroups map the path of a request to a host to the route serving
+// it, for each group of server.hosts. They report false for paths outside
+// the group.
+var hostRouteGroups = map[string]func(path string) (string, bool){
+	"pocket":     pathsUnder("/v3"),
+	"instapaper": pathsUnder("/api"),
+	"opds":       pathsUnder("/api/digest"),
+	// The store is reached at its root, as storeapi.kobo.com is.
+	"store": func(path string) (string, bool) { return storePrefix + path, true },
+}
+
+func pathsUnder(prefix string) func(string) (string, bool) {
+	return func(path string) (string, bool) {
+		return path, path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+}
+
+// HostRoutingMiddleware sends the requests for the hostnames of hosts to
+// the routes of their group on routes, and the others to next. Requests to
+// a configured host outside its group are answered 404.
+func HostRoutingMiddleware(hosts []config.ConfigHost, routes http.Handler) Middleware {
+	groups := make(map[string]func(string) (string, bool), len(hosts))
+	for _, host := range hosts {
+		groups[strings.ToLower(host.Host)] = hostRouteGroups[host.Routes]
+	}
+	return func(next http.Handler) http.Handler {
+		if len(groups) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			group, ok := groups[strings.ToLower(host)]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			path, ok := group(r.URL.Path)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			r = r.Clone(r.Context())
+			r.URL.Path = path
+			r.URL.RawPath = ""
+			routes.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"readeckobo/internal/config"
+)
+
+func TestHostRoutingMiddleware(t *testing.T) {
+	echo := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name + " " + r.URL.Path))
+		})
+	}
+	handler := HostRoutingMiddleware([]config.ConfigHost{
+		{Host: "text.getpocket.com", Routes: "pocket"},
+		{Host: "storeapi.kobo.com", Routes: "store"},
+		{Host: "Feeds.example.com", Routes: "opds"},
+	}, echo("routes"))(echo("default"))
+
+	testCases := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "pocket", url: "https://text.getpocket.com/v3/add", expectedCode: http.StatusOK, expectedBody: "routes /v3/add"},
+		{name: "outside the pocket routes", url: "https://text.getpocket.com/api/kobo/get", expectedCode: http.StatusNotFound},
+		{name: "store at its root", url: "https://storeapi.kobo.com:443/v1/initialization", expectedCode: http.StatusOK, expectedBody: "routes " + storePrefix + "/v1/initialization"},
+		{name: "host case", url: "https://feeds.example.com/api/digest/opds", expectedCode: http.StatusOK, expectedBody: "routes /api/digest/opds"},
+		{name: "unconfigured host", url: "https://kobo.example.com/api/kobo/get", expectedCode: http.StatusOK, expectedBody: "default /api/kobo/get"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("expected status %d, got %d", tc.expectedCode, rr.Code)
+			}
+			if tc.expectedCode == http.StatusOK && rr.Body.String() != tc.expectedBody {
+				t.Errorf("expected %q, got %q", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"readeckobo/internal/certs"
+	"readeckobo/internal/config"
+)
+
+const (
+	listenUnixPrefix = "unix:"
+	listenSystemd    = "systemd"
+	// sdListenFdsStart is the first file descriptor passed by systemd.
+	sdListenFdsStart = 3
+)
+
+// serverListeners opens the listeners of the device-facing server: those of
+// server.listeners, or the one of server.listen or server.port. Listeners
+// with auto_cert use the certificates of ca. HTTPS listeners offer HTTP/2
+// unless server.http.disable_http2 is set.
+func serverListeners(cfg *config.Config, ca *certs.Authority) ([]net.Listener, error) {
+	specs := cfg.Server.Listeners
+	if len(specs) == 0 {
+		addr := cfg.Server.Listen
+		if addr == "" {
+			addr = fmt.Sprintf(":%d", cfg.Server.Port)
+		}
+		specs = []config.ConfigListener{{Address: addr}}
+	}
+
+	nextProtos := []string{"h2", "http/1.1"}
+	if cfg.Server.HTTP.DisableHTTP2 {
+		nextProtos = []string{"http/1.1"}
+	}
+
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+	for _, spec := range specs {
+		listener, err := listen(spec.Address)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if spec.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+			if err != nil {
+				_ = listener.Close()
+				closeAll()
+				return nil, fmt.Errorf("failed to load certificate for %s: %w", spec.Address, err)
+			}
+			listener = tls.NewListener(listener, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+			})
+		}
+		if spec.AutoCert {
+			if ca == nil {
+				_ = listener.Close()
+				closeAll()
+				return nil, fmt.Errorf("listener %s sets auto_cert without certs.dir", spec.Address)
+			}
+			listener = tls.NewListener(listener, &tls.Config{
+				GetCertificate: ca.GetCertificate,
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     nextProtos,
+			})
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// newServer returns the device-facing server of handler, with the HTTP/2
+// and keep-alive settings of cfg.
+func newServer(cfg config.ConfigServerHTTP, handler http.Handler) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(!cfg.DisableHTTP2)
+	protocols.SetUnencryptedHTTP2(cfg.H2C)
+
+	server := &http.Server{
+		Handler:           handler,
+		Protocols:         protocols,
+		IdleTimeout:       cfg.IdleTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		HTTP2:             &http.HTTP2Config{MaxConcurrentStreams: cfg.MaxConcurrentStreams},
+	}
+	server.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+	return server
+}
+
+// listen opens the listener described by spec: "unix:/path/to.sock" for a
+// Unix domain socket, "systemd" for the first socket passed through socket
+// activation, or a TCP address such as ":8080".
+func listen(spec string) (net.Listener, error) {
+	switch {
+	case spec == listenSystemd:
+		return systemdListener()
+	case strings.HasPrefix(spec, listenUnixPrefix):
+		return unixListener(strings.TrimPrefix(spec, listenUnixPrefix))
+	default:
+		return net.Listen("tcp", spec)
+	}
+}
+
+func unixListener(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing socket path in %q", listenUnixPrefix)
+	}
+	// A socket left behind by a previous run would make the bind fail.
+	if info, err := os.Stat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Let a fronting proxy in the same group connect.
+	if err := os.Chmod(path, 0660); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set permissions on socket %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// systemdListener returns the first socket passed by systemd, following the
+// sd_listen_fds protocol.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd: LISTEN_PID is not set for this process")
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, errors.New("no sockets passed by systemd: LISTEN_FDS is not set")
+	}
+
+	// Child processes must not pick up the sockets.
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(uintptr(sdListenFdsStart), "systemd-socket")
+	defer func() { _ = file.Close() }()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by systemd: %w", err)
+	}
+	return listener, nil
+}
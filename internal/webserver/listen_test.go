@@ -0,0 +1,248 @@
+package webserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"readeckobo/internal/certs"
+	"readeckobo/internal/config"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readeckobo.sock")
+
+	// A stale socket from a previous run must not prevent binding.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket: %v", err)
+	}
+	if l, ok := stale.(*net.UnixListener); ok {
+		l.SetUnlinkOnClose(false)
+	}
+	_ = stale.Close()
+
+	listener, err := listen(listenUnixPrefix + path)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer func() { _ = server.Close() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/healthz")
+	if err != nil {
+		t.Fatalf("Request over unix socket failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+}
+
+func TestListenSystemdWithoutSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if _, err := listen(listenSystemd); err == nil {
+		t.Error("expected an error when sockets are meant for another process")
+	}
+}
+
+func TestServerListeners(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	cfg := &config.Config{}
+	cfg.Server.Listeners = []config.ConfigListener{
+		{Address: "127.0.0.1:0"},
+		{Address: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile},
+	}
+
+	listeners, err := serverListeners(cfg, nil)
+	if err != nil {
+		t.Fatalf("serverListeners() error = %v", err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, listener := range listeners {
+		server := &http.Server{Handler: handler}
+		go func() { _ = server.Serve(listener) }()
+		defer func() { _ = server.Close() }()
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	for i, want := range []struct {
+		scheme string
+		status int
+	}{{"http", http.StatusNoContent}, {"https", http.StatusAccepted}} {
+		resp, err := client.Get(want.scheme + "://" + listeners[i].Addr().String() + "/healthz")
+		if err != nil {
+			t.Fatalf("%s request failed: %v", want.scheme, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want.status {
+			t.Errorf("expected status %d over %s, got %d", want.status, want.scheme, resp.StatusCode)
+		}
+	}
+}
+
+func TestServerListenersMissingCertificate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Listeners = []config.ConfigListener{
+		{Address: "127.0.0.1:0"},
+		{Address: "127.0.0.1:0", CertFile: "missing.pem", KeyFile: "missing.key"},
+	}
+	if _, err := serverListeners(cfg, nil); err == nil {
+		t.Error("expected an error for a missing certificate")
+	}
+}
+
+func TestServerListenersAutoCert(t *testing.T) {
+	ca, err := certs.Load(t.TempDir(), []string{"storeapi.kobo.com"})
+	if err != nil {
+		t.Fatalf("certs.Load() error = %v", err)
+	}
+	cfg := &config.Config{}
+	cfg.Server.Listeners = []config.ConfigListener{{Address: "127.0.0.1:0", AutoCert: true}}
+
+	if _, err := serverListeners(cfg, nil); err == nil {
+		t.Error("expected an error for auto_cert without certs.dir")
+	}
+
+	listeners, err := serverListeners(cfg, ca)
+	if err != nil {
+		t.Fatalf("serverListeners() error = %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go func() { _ = server.Serve(listeners[0]) }()
+	defer func() { _ = server.Close() }()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "storeapi.kobo.com"}}}
+	resp, err := client.Get("https://" + listeners[0].Addr().String() + "/v1/initialization")
+	if err != nil {
+		t.Fatalf("Request with the authority trusted failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key, and returns their paths.
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewServerProtocols(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name      string
+		http      config.ConfigServerHTTP
+		tls       bool
+		wantProto int
+		wantClose bool
+	}{
+		{name: "https offers http/2", tls: true, wantProto: 2},
+		{name: "http/2 disabled", http: config.ConfigServerHTTP{DisableHTTP2: true}, tls: true, wantProto: 1},
+		{name: "h2c", http: config.ConfigServerHTTP{H2C: true}, wantProto: 2},
+		{name: "keep-alives disabled", http: config.ConfigServerHTTP{DisableKeepAlives: true}, wantProto: 1, wantClose: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Server.HTTP = tt.http
+			cfg.Server.Listeners = []config.ConfigListener{{Address: "127.0.0.1:0"}}
+			if tt.tls {
+				cfg.Server.Listeners[0].CertFile, cfg.Server.Listeners[0].KeyFile = certFile, keyFile
+			}
+			listeners, err := serverListeners(cfg, nil)
+			if err != nil {
+				t.Fatalf("serverListeners() error = %v", err)
+			}
+			server := newServer(cfg.Server.HTTP, handler)
+			go func() { _ = server.Serve(listeners[0]) }()
+			defer func() { _ = server.Close() }()
+
+			// An h2c client speaks HTTP/2 with prior knowledge only when
+			// HTTP/1 is off.
+			protocols := new(http.Protocols)
+			protocols.SetHTTP1(!tt.http.H2C)
+			protocols.SetHTTP2(true)
+			protocols.SetUnencryptedHTTP2(tt.http.H2C)
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				Protocols:       protocols,
+			}}
+			scheme := "http"
+			if tt.tls {
+				scheme = "https"
+			}
+			resp, err := client.Get(scheme + "://" + listeners[0].Addr().String() + "/healthz")
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.ProtoMajor != tt.wantProto || resp.Close != tt.wantClose {
+				t.Errorf("expected HTTP/%d with close %v, got %s with close %v", tt.wantProto, tt.wantClose, resp.Proto, resp.Close)
+			}
+		})
+	}
+}
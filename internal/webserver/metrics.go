@@ -0,0 +1,113 @@
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metricKey identifies one request counter.
+type metricKey struct {
+	route  string
+	status int
+}
+
+// Metrics counts handled requests per route and status in memory and writes
+// them in the Prometheus text format.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[metricKey]uint64
+	durations map[string]float64
+	counters  []counterFunc
+}
+
+// counterFunc is a labelled counter kept elsewhere and read when the metrics
+// are written.
+type counterFunc struct {
+	name, help, label string
+	values            func() map[string]uint64
+}
+
+// NewMetrics creates an empty set of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  make(map[metricKey]uint64),
+		durations: make(map[string]float64),
+	}
+}
+
+func (m *Metrics) observe(route string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[metricKey{route: route, status: status}]++
+	m.durations[route] += duration.Seconds()
+}
+
+// AddCounters writes the counters returned by values as name, one per value
+// of label, along with the request metrics.
+func (m *Metrics) AddCounters(name, help, label string, values func() map[string]uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = append(m.counters, counterFunc{name: name, help: help, label: label, values: values})
+}
+
+// Middleware records the status and duration of requests handled by next.
+func (m *Metrics) Middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+		m.observe(route, rw.statusCode, time.Since(start))
+	})
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	keys := make([]metricKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].status < keys[j].status
+	})
+	routes := make([]string, 0, len(m.durations))
+	for route := range m.durations {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = fmt.Fprintln(w, "# HELP readeckobo_requests_total Handled requests by route and status.")
+	_, _ = fmt.Fprintln(w, "# TYPE readeckobo_requests_total counter")
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(w, "readeckobo_requests_total{route=%q,status=%q} %d\n", key.route, strconv.Itoa(key.status), m.requests[key])
+	}
+	_, _ = fmt.Fprintln(w, "# HELP readeckobo_request_duration_seconds_total Time spent handling requests by route.")
+	_, _ = fmt.Fprintln(w, "# TYPE readeckobo_request_duration_seconds_total counter")
+	for _, route := range routes {
+		_, _ = fmt.Fprintf(w, "readeckobo_request_duration_seconds_total{route=%q} %g\n", route, m.durations[route])
+	}
+	counters := m.counters
+	m.mu.Unlock()
+
+	for _, c := range counters {
+		values := c.values()
+		labels := make([]string, 0, len(values))
+		for label := range values {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+		_, _ = fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+		for _, label := range labels {
+			_, _ = fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, label, values[label])
+		}
+	}
+}
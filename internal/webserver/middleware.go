@@ -1,19 +1,30 @@
 package webserver
 
 import (
-	"log"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
 	"net/http"
-	"time"
+	"net/url"
+	"runtime/debug"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"readeckobo/internal/logger"
+	"readeckobo/internal/tracing"
 )
 
 // responseWriter is a wrapper for http.ResponseWriter to capture the status code
+// and the number of bytes written
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{w, http.StatusOK}
+	return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -21,18 +32,109 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// LoggingMiddleware logs all incoming requests
-func LoggingMiddleware(next http.Handler) http.Handler {
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection, so streamed
+// responses are flushed through the wrapper.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// TracingMiddleware wraps next in a span named name.
+func TracingMiddleware(name string, next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		ctx, span := tracing.Start(r.Context(), name)
 		rw := newResponseWriter(w)
-		next.ServeHTTP(rw, r)
-		log.Printf(
-			"%-7s %s %d %s",
-			r.Method,
-			r.RequestURI,
-			rw.statusCode,
-			time.Since(start),
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", rw.statusCode),
 		)
+		var err error
+		if rw.statusCode >= http.StatusInternalServerError {
+			err = fmt.Errorf("handler returned status %d", rw.statusCode)
+		}
+		tracing.End(span, err)
+	})
+}
+
+// PathPrefixMiddleware serves requests under prefix with it removed from
+// their path, and answers 404 to the others.
+func PathPrefixMiddleware(prefix string) Middleware {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(next http.Handler) http.Handler {
+		if prefix == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.TrimPrefix(r.URL.Path, prefix)
+			if len(path) == len(r.URL.Path) || path != "" && path[0] != '/' {
+				http.NotFound(w, r)
+				return
+			}
+			if path == "" {
+				path = "/"
+			}
+			r = r.Clone(r.Context())
+			r.URL.Path = path
+			r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RecoveryMiddleware turns a panicking handler into a 500 instead of a dropped connection.
+func RecoveryMiddleware(logger *logger.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+					logger.Errorf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BasicAuthMiddleware requires password, with any user name, and rejects
+// state-changing requests sent from other sites.
+func BasicAuthMiddleware(realm, password string) Middleware {
+	expected := sha256.Sum256([]byte(password))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, given, ok := r.BasicAuth()
+			hash := sha256.Sum256([]byte(given))
+			if !ok || subtle.ConstantTimeCompare(hash[:], expected[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			SameOriginMiddleware(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// SameOriginMiddleware rejects state-changing requests sent from other sites.
+func SameOriginMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+				if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+					http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,119 @@
+package webserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustUnixPeers is the trusted proxy entry for clients connected over a
+// Unix domain socket, which have no IP address.
+const trustUnixPeers = "unix"
+
+// unixPeer stands for Unix socket clients in the list of trusted proxies.
+var unixPeer = netip.PrefixFrom(netip.IPv6Unspecified(), 128)
+
+// ParseTrustedProxies parses IP addresses and CIDR ranges of reverse proxies
+// whose forwarded headers are trusted.
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if proxy == trustUnixPeers {
+			prefixes = append(prefixes, unixPeer)
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ProxyHeadersMiddleware rewrites RemoteAddr, the scheme and the host from
+// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host when the request
+// comes from a trusted proxy. Requests from anyone else are left untouched so
+// clients cannot spoof their address.
+func ProxyHeadersMiddleware(trusted []netip.Prefix) Middleware {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddr(remoteHost(r.RemoteAddr))
+			if err != nil && isUnixPeer(r.RemoteAddr) {
+				peer, err = unixPeer.Addr(), nil
+			}
+			if err != nil || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r = r.Clone(r.Context())
+			if client := forwardedClient(r.Header.Values("X-Forwarded-For"), isTrusted); client.IsValid() {
+				r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+			}
+			if proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+				r.URL.Scheme = proto
+			}
+			if host := strings.TrimSpace(r.Header.Get("X-Forwarded-Host")); host != "" {
+				r.Host = host
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the first address from the right of the
+// X-Forwarded-For chain that is not a trusted proxy.
+func forwardedClient(values []string, isTrusted func(netip.Addr) bool) netip.Addr {
+	var hops []string
+	for _, value := range values {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !isTrusted(client) {
+			break
+		}
+	}
+	return client
+}
+
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// isUnixPeer reports whether remoteAddr belongs to a Unix socket client.
+func isUnixPeer(remoteAddr string) bool {
+	return remoteAddr == "" || remoteAddr == "@"
+}
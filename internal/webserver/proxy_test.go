@@ -0,0 +1,79 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyHeadersMiddleware(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.1", "172.16.0.0/12", "unix"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		remoteAddr     string
+		headers        map[string]string
+		expectedRemote string
+		expectedScheme string
+		expectedHost   string
+	}{
+		{
+			name:           "trusted proxy",
+			remoteAddr:     "10.0.0.1:5000",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.7", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "kobo.example.com"},
+			expectedRemote: "192.0.2.7:0",
+			expectedScheme: "https",
+			expectedHost:   "kobo.example.com",
+		},
+		{
+			name:           "skips chained trusted proxies and ignores spoofed hops",
+			remoteAddr:     "10.0.0.1:5000",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.9, 192.0.2.7, 172.18.0.2"},
+			expectedRemote: "192.0.2.7:0",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "unix socket peer",
+			remoteAddr:     "@",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.7"},
+			expectedRemote: "192.0.2.7:0",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "untrusted peer",
+			remoteAddr:     "192.0.2.50:5000",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https"},
+			expectedRemote: "192.0.2.50:5000",
+			expectedHost:   "example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *http.Request
+			handler := ProxyHeadersMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/kobo/get", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.RemoteAddr != tc.expectedRemote {
+				t.Errorf("expected RemoteAddr %q, got %q", tc.expectedRemote, got.RemoteAddr)
+			}
+			if got.URL.Scheme != tc.expectedScheme {
+				t.Errorf("expected scheme %q, got %q", tc.expectedScheme, got.URL.Scheme)
+			}
+			if got.Host != tc.expectedHost {
+				t.Errorf("expected host %q, got %q", tc.expectedHost, got.Host)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package webserver
+
+import (
+	"net/http"
+
+	"readeckobo/internal/logger"
+)
+
+// Middleware wraps a handler with cross-cutting behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Router registers routes on a ServeMux using method patterns such as
+// "POST /api/kobo/get". Routes registered on a group are wrapped in the
+// middleware of that group.
+type Router struct {
+	mux        *http.ServeMux
+	logger     *logger.Logger
+	middleware []Middleware
+}
+
+// NewRouter creates a router with no routes.
+func NewRouter(logger *logger.Logger) *Router {
+	return &Router{mux: http.NewServeMux(), logger: logger}
+}
+
+// Use appends middleware applied to routes registered afterwards.
+func (rt *Router) Use(mw ...Middleware) {
+	rt.middleware = append(rt.middleware, mw...)
+}
+
+// Group returns a router sharing rt's routes whose registrations are also
+// wrapped in mw.
+func (rt *Router) Group(mw ...Middleware) *Router {
+	middleware := make([]Middleware, 0, len(rt.middleware)+len(mw))
+	middleware = append(middleware, rt.middleware...)
+	return &Router{mux: rt.mux, logger: rt.logger, middleware: append(middleware, mw...)}
+}
+
+// Handle registers handler for pattern. The first middleware is the outermost.
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		handler = rt.middleware[i](handler)
+	}
+	rt.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers handler for pattern.
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	rt.Handle(pattern, handler)
+}
+
+// ServeHTTP dispatches the request. Unknown paths get a 404 and known paths
+// requested with the wrong method a 405 with an Allow header.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern == "" {
+		rt.logger.Warnf("Unmatched route: URL=%s, Method=%s, Params=%v", r.URL.Path, r.Method, r.URL.Query())
+	}
+	rt.mux.ServeHTTP(w, r)
+}
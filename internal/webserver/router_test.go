@@ -0,0 +1,134 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"readeckobo/internal/logger"
+)
+
+func TestRouter(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	router := NewRouter(logger.New(logger.ERROR))
+	router.Use(tag("outer"))
+	group := router.Group(tag("group"))
+	group.HandleFunc("POST /grouped", ok)
+	router.HandleFunc("GET /plain", ok)
+	router.Use(RecoveryMiddleware(logger.New(logger.ERROR)))
+	router.HandleFunc("GET /recovered", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		expectedCode  int
+		expectedOrder []string
+		expectedAllow string
+	}{
+		{name: "group middleware", method: http.MethodPost, path: "/grouped", expectedCode: http.StatusOK, expectedOrder: []string{"outer", "group"}},
+		{name: "router middleware only", method: http.MethodGet, path: "/plain", expectedCode: http.StatusOK, expectedOrder: []string{"outer"}},
+		{name: "wrong method", method: http.MethodGet, path: "/grouped", expectedCode: http.StatusMethodNotAllowed, expectedAllow: "POST"},
+		{name: "unknown path", method: http.MethodGet, path: "/missing", expectedCode: http.StatusNotFound},
+		{name: "recovered panic", method: http.MethodGet, path: "/recovered", expectedCode: http.StatusInternalServerError, expectedOrder: []string{"outer"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			order = nil
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if rr.Code != tc.expectedCode {
+				t.Errorf("expected status %d, got %d", tc.expectedCode, rr.Code)
+			}
+			if got := rr.Header().Get("Allow"); got != tc.expectedAllow {
+				t.Errorf("expected Allow %q, got %q", tc.expectedAllow, got)
+			}
+			if len(order) != len(tc.expectedOrder) {
+				t.Fatalf("expected middleware %v, got %v", tc.expectedOrder, order)
+			}
+			for i := range order {
+				if order[i] != tc.expectedOrder[i] {
+					t.Errorf("expected middleware %v, got %v", tc.expectedOrder, order)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	handler := BasicAuthMiddleware("admin", "secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name         string
+		method       string
+		password     string
+		origin       string
+		expectedCode int
+	}{
+		{name: "no credentials", method: http.MethodGet, expectedCode: http.StatusUnauthorized},
+		{name: "wrong password", method: http.MethodGet, password: "nope", expectedCode: http.StatusUnauthorized},
+		{name: "right password", method: http.MethodGet, password: "secret", expectedCode: http.StatusOK},
+		{name: "same-origin post", method: http.MethodPost, password: "secret", origin: "http://example.com", expectedCode: http.StatusOK},
+		{name: "cross-origin post", method: http.MethodPost, password: "secret", origin: "https://evil.example", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/admin/", nil)
+			if tc.password != "" {
+				req.SetBasicAuth("admin", tc.password)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectedCode {
+				t.Errorf("expected status %d, got %d", tc.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestPathPrefixMiddleware(t *testing.T) {
+	handler := PathPrefixMiddleware("/readeckobo/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+
+	testCases := []struct {
+		path         string
+		expectedCode int
+		expectedPath string
+	}{
+		{path: "/readeckobo/api/kobo/get", expectedCode: http.StatusOK, expectedPath: "/api/kobo/get"},
+		{path: "/readeckobo", expectedCode: http.StatusOK, expectedPath: "/"},
+		{path: "/api/kobo/get", expectedCode: http.StatusNotFound},
+		{path: "/readeckobo-other/api", expectedCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("expected status %d, got %d", tc.expectedCode, rr.Code)
+			}
+			if tc.expectedCode == http.StatusOK && rr.Body.String() != tc.expectedPath {
+				t.Errorf("expected path %q, got %q", tc.expectedPath, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package webserver
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"readeckobo/internal/capture"
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+	"readeckobo/internal/storeapi"
+)
+
+func TestStoreProxyStreamsThroughMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("second\n"))
+	}))
+	defer upstream.Close()
+
+	log := logger.New(logger.ERROR)
+	store, err := storeapi.NewProxy(storePrefix, config.ConfigKoboStore{Upstream: upstream.URL, Passthrough: true}, nil, log)
+	if err != nil {
+		t.Fatalf("NewProxy() error = %v", err)
+	}
+	accessLog, err := NewAccessLog(config.ConfigAccessLog{File: filepath.Join(t.TempDir(), "access.log")})
+	if err != nil {
+		t.Fatalf("NewAccessLog() error = %v", err)
+	}
+	defer func() { _ = accessLog.Close() }()
+	rec, err := capture.NewRecorder("", log)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	handler := accessLog.Middleware(NewMetrics().Middleware("store", rec.Middleware("store", TracingMiddleware("store", store.ServeHTTP))))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	// Let the store finish before the servers wait for it to close.
+	defer close(release)
+
+	// The first chunk arrives while the store is still responding.
+	lines := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(server.URL + storePrefix + "/v1/library/sync")
+		if err != nil {
+			lines <- err.Error()
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "first\n" {
+			t.Errorf("expected the first chunk, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the first chunk flushed before the store finished")
+	}
+}
@@ -1,37 +1,248 @@
 package webserver
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"time"
 
 	"readeckobo/internal/app"
+	"readeckobo/internal/config"
 	"readeckobo/internal/logger"
+	"readeckobo/internal/storeapi"
 )
 
-// ListenAndServe starts the HTTP server on the specified port.
-func ListenAndServe(port int, application *app.App, logger *logger.Logger) {
-	addr := fmt.Sprintf(":%d", port)
-	logger.Infof("Web server starting on port %s", addr)
+const (
+	// storePrefix is where the Kobo store API is proxied.
+	storePrefix = "/instapaper-proxy/storeapi"
+	// storeTimeout bounds the wait for the Kobo store to respond.
+	storeTimeout = 15 * time.Second
+	// shutdownTimeout bounds the wait for requests in flight at shutdown.
+	shutdownTimeout = 10 * time.Second
+)
 
-	mux := http.NewServeMux()
+// ListenAndServe starts the device-facing HTTP server and, when an admin port
+// is configured, the admin server on its own listener. Both are shut down
+// once ctx is done. A server that fails leaves the other running until then.
+func ListenAndServe(ctx context.Context, cfg *config.Config, application *app.App, logger *logger.Logger) {
+	metrics := NewMetrics()
+	metrics.AddCounters("readeckobo_extractions_total", "Bookmarks added from devices by extraction outcome.", "outcome", application.ExtractionOutcomes)
+	metrics.AddCounters("readeckobo_syncs_total", "Device syncs by whether they fetched from Readeck, shared a running sync or were cached.", "outcome", application.SyncOutcomes)
+	metrics.AddCounters("readeckobo_sync_items_skipped_total", "Bookmarks left out of syncs because their item could not be built.", "reason", application.SkippedItems)
+	metrics.AddCounters("readeckobo_consumer_keys_total", "Pocket API requests by the firmware their consumer key belongs to, or unknown.", "key", application.ConsumerKeys)
 
-	// Register handlers
-	mux.HandleFunc("/api/kobo/get", application.HandleKoboGet)
-	mux.HandleFunc("/api/kobo/download", application.HandleKoboDownload)
-	mux.HandleFunc("/api/kobo/send", application.HandleKoboSend)
-	mux.HandleFunc("/api/convert-image", application.HandleConvertImage)
-	mux.HandleFunc("/instapaper-proxy/storeapi/v1/initialization", application.HandleDumpAndForward)
+	accessLog, err := NewAccessLog(cfg.AccessLog)
+	if err != nil {
+		logger.Errorf("Web server failed to start: %v", err)
+		return
+	}
+	defer func() {
+		if err := accessLog.Close(); err != nil {
+			logger.Errorf("Error closing access log: %v", err)
+		}
+	}()
+
+	trustedProxies, err := ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.Errorf("Web server failed to start: %v", err)
+		return
+	}
+	proxyHeaders := ProxyHeadersMiddleware(trustedProxies)
+
+	initialization, err := storeapi.NewInitializationProxy(cfg.KoboStore, &http.Client{Timeout: storeTimeout}, logger)
+	if err != nil {
+		logger.Errorf("Web server failed to start: %v", err)
+		return
+	}
+	storeTransport := http.DefaultTransport.(*http.Transport).Clone()
+	storeTransport.ResponseHeaderTimeout = storeTimeout
+	store, err := storeapi.NewProxy(storePrefix, cfg.KoboStore, storeTransport, logger)
+	if err != nil {
+		logger.Errorf("Web server failed to start: %v", err)
+		return
+	}
+	initialization.SetPathPrefix(cfg.Server.PathPrefix)
+	store.Intercept("GET /v1/initialization", initialization)
+	application.RegisterCache(initialization)
 
-	// Catch-all for unimplemented routes
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		logger.Warnf("404 Not Found: URL=%s, Method=%s, Params=%v", r.URL.Path, r.Method, r.URL.Query())
-		http.Error(w, "404 Not Found", http.StatusNotFound)
-	})
+	var servers []*http.Server
+	if cfg.Admin.Port > 0 {
+		if admin := serveAdmin(cfg, application, metrics, accessLog, proxyHeaders, logger); admin != nil {
+			servers = append(servers, admin)
+		}
+	}
+	if server := serveDevice(cfg, application, metrics, store, accessLog, proxyHeaders, logger); server != nil {
+		servers = append(servers, server)
+	}
 
-	// Apply logging middleware
-	loggedMux := LoggingMiddleware(mux)
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("Error shutting down web server: %v", err)
+		}
+	}
+}
 
-	if err := http.ListenAndServe(addr, loggedMux); err != nil {
+// serveDevice starts the device-facing server on every configured listener.
+// It returns nil when the listeners cannot be opened.
+func serveDevice(cfg *config.Config, application *app.App, metrics *Metrics, store http.Handler, accessLog *AccessLog, proxyHeaders Middleware, logger *logger.Logger) *http.Server {
+	listeners, err := serverListeners(cfg, application.Certificates)
+	if err != nil {
 		logger.Errorf("Web server failed to start: %v", err)
+		return nil
+	}
+	for _, listener := range listeners {
+		logger.Infof("Web server starting on %s", listener.Addr())
+	}
+
+	loggedMux := proxyHeaders(accessLog.Middleware(deviceHandler(cfg, application, metrics, store, logger)))
+
+	// Every listener shares the handler chain; the server stops with the
+	// first one that fails.
+	server := newServer(cfg.Server.HTTP, loggedMux)
+	for _, listener := range listeners {
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("Web server failed: %v", err)
+				_ = server.Close()
+			}
+		}()
 	}
-}
\ No newline at end of file
+	return server
+}
+
+// deviceHandler routes the device-facing listener: the Kobo endpoints, also
+// under the Instapaper path, the store API proxy, the portal and the
+// spoofed Kobo hosts, all under server.path_prefix.
+func deviceHandler(cfg *config.Config, application *app.App, metrics *Metrics, store http.Handler, logger *logger.Logger) http.Handler {
+	router := NewRouter(logger)
+	router.Use(RecoveryMiddleware(logger))
+
+	// Kobo endpoints are measured and traced per route, and identify the
+	// device sending them and its user.
+	kobo := router.Group(application.DeviceMiddleware, application.AuthMiddleware)
+	handle := func(pattern, route string, handler http.HandlerFunc) {
+		var h http.Handler = TracingMiddleware(route, handler)
+		if application.Capture != nil && strings.HasPrefix(route, "kobo.") {
+			h = application.Capture.Middleware(route, h)
+		}
+		h = metrics.Middleware(route, h)
+		// The URLs readeckobo hands the Kobo, and the Kobo's own calls when
+		// no reverse proxy strips it, keep the Instapaper path.
+		method, path, _ := strings.Cut(pattern, " ")
+		for _, prefix := range []string{"", storeapi.InstapaperPath} {
+			kobo.Handle(method+" "+prefix+path, h)
+			// Other methods get a Pocket error rather than the mux's plain text.
+			router.Handle(prefix+path, app.MethodNotAllowed(method))
+		}
+	}
+	handle("POST /api/kobo/get", "kobo.get", application.HandleKoboGet)
+	handle("POST /api/kobo/download", "kobo.download", application.HandleKoboDownload)
+	handle("POST /api/kobo/send", "kobo.send", application.HandleKoboSend)
+	handle("GET /api/convert-image", "image.convert", application.HandleConvertImage)
+	handle("GET /api/math", "image.math", application.HandleMath)
+	handle("GET /api/code", "image.code", application.HandleCode)
+	handle("GET /api/qr", "image.qr", application.HandleQRCode)
+	handle("GET /api/resource", "resource", application.HandleResource)
+	handle("POST /api/save", "save", application.HandleSave)
+	handle("GET /api/pocket/export", "pocket.export", application.HandlePocketExport)
+	handle("POST /api/pocket/import", "pocket.import", application.HandlePocketImport)
+	handle("GET /api/digest", "digest", application.HandleDigest)
+	handle("GET /api/digest/opds", "digest.opds", application.HandleDigestOPDS)
+	handle("POST /v3/add", "pocket.add", application.HandlePocketAdd)
+	handle("POST /v3/discover", "pocket.discover", application.HandleKoboDiscover)
+	handle("POST /v3/recommendations", "pocket.discover", application.HandleKoboDiscover)
+	handle("POST /api/kobo/discover", "kobo.discover", application.HandleKoboDiscover)
+	handle("POST /v3/oauth/request", "pocket.oauth.request", application.HandlePocketOAuthRequest)
+	handle("POST /v3/oauth/authorize", "pocket.oauth.authorize", application.HandlePocketOAuthAuthorize)
+	router.Handle(storePrefix+"/", store)
+	router.HandleFunc("GET /openapi.json", application.HandleOpenAPI)
+
+	if cfg.Portal.Enabled {
+		portal := router.Group(SameOriginMiddleware)
+		portal.HandleFunc("GET /portal/{$}", application.HandlePortal)
+		portal.HandleFunc("POST /portal/login", application.HandlePortalLogin)
+		portal.HandleFunc("POST /portal/logout", application.HandlePortalLogout)
+		portal.HandleFunc("POST /portal/pair", application.HandlePortalPair)
+		portal.HandleFunc("POST /portal/preferences", application.HandlePortalPreferences)
+	}
+
+	// Without a separate admin listener the health check stays reachable here.
+	if cfg.Admin.Port == 0 {
+		router.HandleFunc("GET /healthz", application.HandleHealthz)
+	}
+
+	// Spoofed Kobo hosts are served at their root, without the path prefix.
+	hostRouting := HostRoutingMiddleware(cfg.Server.Hosts, router)
+	return hostRouting(PathPrefixMiddleware(cfg.Server.PathPrefix)(router))
+}
+
+// serveAdmin serves metrics, health, profiling and the admin API on a port
+// that is never exposed to the Kobo, on loopback unless admin.address says
+// otherwise, with the timeouts of the device-facing server. It returns nil
+// when the port cannot be opened.
+func serveAdmin(cfg *config.Config, application *app.App, metrics *Metrics, accessLog *AccessLog, proxyHeaders Middleware, logger *logger.Logger) *http.Server {
+	addr := net.JoinHostPort(cfg.Admin.Address, strconv.Itoa(cfg.Admin.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("Admin server failed to start: %v", err)
+		return nil
+	}
+	logger.Infof("Admin server starting on %s", addr)
+
+	handler := adminHandler(cfg, application, metrics, logger)
+	server := newServer(cfg.Server.HTTP, proxyHeaders(accessLog.Middleware(handler)))
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Admin server failed: %v", err)
+		}
+	}()
+	return server
+}
+
+// adminHandler routes the admin listener. With admin.password set, everything
+// but the health check and the OpenAPI document asks for it; without one,
+// configuration validation keeps the listener on loopback.
+func adminHandler(cfg *config.Config, application *app.App, metrics *Metrics, logger *logger.Logger) http.Handler {
+	router := NewRouter(logger)
+	router.Use(RecoveryMiddleware(logger))
+	router.HandleFunc("GET /healthz", application.HandleHealthz)
+	router.HandleFunc("GET /openapi.json", application.HandleOpenAPI)
+
+	admin := router.Group()
+	if cfg.Admin.Password != "" {
+		admin = router.Group(BasicAuthMiddleware("readeckobo admin", cfg.Admin.Password))
+		admin.HandleFunc("GET /admin/{$}", application.HandleDashboard)
+		admin.HandleFunc("POST /admin/test-readeck", application.HandleDashboardTestReadeck)
+		admin.HandleFunc("POST /admin/invalidate-caches", application.HandleDashboardInvalidateCaches)
+		admin.HandleFunc("GET /admin/requests", application.HandleDashboardRequests)
+		admin.HandleFunc("GET /setup", application.HandleSetup)
+		admin.HandleFunc("POST /setup", application.HandleSetupSubmit)
+		admin.HandleFunc("POST /setup/download", application.HandleSetupDownload)
+	}
+
+	admin.Handle("GET /metrics", metrics)
+	admin.HandleFunc("GET /admin/api/users", application.HandleAdminUsers)
+	admin.HandleFunc("GET /admin/api/extractions", application.HandleAdminExtractions)
+	admin.HandleFunc("GET /admin/api/stats", application.HandleAdminStats)
+	admin.HandleFunc("GET /admin/api/devices", application.HandleAdminDevices)
+	admin.HandleFunc("GET /admin/api/readiness", application.HandleAdminReadiness)
+	admin.HandleFunc("GET /admin/api/ca.pem", application.HandleAdminCA)
+	admin.HandleFunc("GET /admin/api/ca-install", application.HandleAdminCAInstall)
+	admin.HandleFunc("POST /admin/api/extractions/{id}/retry", application.HandleAdminRetryExtraction)
+
+	admin.HandleFunc("GET /debug/pprof/", pprof.Index)
+	admin.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	admin.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	admin.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	admin.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	admin.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+
+	return router
+}
@@ -0,0 +1,158 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"readeckobo/internal/app"
+	"readeckobo/internal/config"
+	"readeckobo/internal/logger"
+	"readeckobo/internal/models"
+	"readeckobo/internal/readeck"
+	"readeckobo/internal/readecktest"
+	"readeckobo/internal/storeapi"
+)
+
+func TestAdminHandlerRequiresPassword(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Readeck.Host = "http://readeck.invalid"
+	cfg.Admin.Password = "secret"
+	log := logger.New(logger.ERROR)
+	application := app.NewApp(app.WithConfig(cfg), app.WithLogger(log))
+	handler := adminHandler(cfg, application, NewMetrics(), log)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/healthz", http.StatusOK},
+		{http.MethodGet, "/metrics", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/api/users", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/api/stats", http.StatusUnauthorized},
+		{http.MethodPost, "/admin/api/extractions/1/retry", http.StatusUnauthorized},
+		{http.MethodGet, "/debug/pprof/", http.StatusUnauthorized},
+		{http.MethodGet, "/debug/pprof/cmdline", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/api/users", nil)
+	req.SetBasicAuth("admin", "secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 with the password, got %d", rr.Code)
+	}
+}
+
+func TestServeAdminShutsDown(t *testing.T) {
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	port := probe.Addr().(*net.TCPAddr).Port
+	_ = probe.Close()
+
+	cfg := &config.Config{}
+	cfg.Readeck.Host = "http://readeck.invalid"
+	cfg.Admin.Address = "127.0.0.1"
+	cfg.Admin.Port = port
+	cfg.Server.HTTP.ReadHeaderTimeout = 10 * time.Second
+	cfg.Server.HTTP.IdleTimeout = time.Minute
+	log := logger.New(logger.ERROR)
+	accessLog, err := NewAccessLog(config.ConfigAccessLog{File: filepath.Join(t.TempDir(), "access.log")})
+	if err != nil {
+		t.Fatalf("NewAccessLog() error = %v", err)
+	}
+	defer func() { _ = accessLog.Close() }()
+	application := app.NewApp(app.WithConfig(cfg), app.WithLogger(log))
+
+	server := serveAdmin(cfg, application, NewMetrics(), accessLog, ProxyHeadersMiddleware(nil), log)
+	if server == nil {
+		t.Fatal("expected the admin server to start")
+	}
+	if server.ReadHeaderTimeout != cfg.Server.HTTP.ReadHeaderTimeout || server.IdleTimeout != cfg.Server.HTTP.IdleTimeout {
+		t.Errorf("expected the device server's timeouts, got %s and %s", server.ReadHeaderTimeout, server.IdleTimeout)
+	}
+
+	healthz := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/healthz"
+	resp, err := http.Get(healthz)
+	if err != nil {
+		t.Fatalf("GET /healthz error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if err := server.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if resp, err := http.Get(healthz); err == nil {
+		_ = resp.Body.Close()
+		t.Error("expected the admin port to be closed after shutdown")
+	}
+}
+
+func TestDeviceHandlerServesGeneratedURLs(t *testing.T) {
+	mockServer := readecktest.NewServer()
+	defer mockServer.Close()
+	mockServer.AddBookmark(readeck.Bookmark{ID: "1", URL: "https://example.com/1", Title: "One"},
+		`<p>Watch</p><iframe src="https://www.youtube.com/embed/abc123"></iframe>`)
+
+	cfg := &config.Config{
+		Users:   []config.User{{Token: "device-token", ReadeckAccessToken: "readeck-token"}},
+		Readeck: config.ConfigReadeck{Host: mockServer.URL},
+	}
+	cfg.Server.PathPrefix = "/readeckobo"
+	log := logger.New(logger.ERROR)
+	application := app.NewApp(app.WithConfig(cfg), app.WithLogger(log))
+	store, err := storeapi.NewProxy(storePrefix, config.ConfigKoboStore{Upstream: "http://store.invalid"}, nil, log)
+	if err != nil {
+		t.Fatalf("NewProxy() error = %v", err)
+	}
+	handler := deviceHandler(cfg, application, NewMetrics(), store, log)
+
+	body, _ := json.Marshal(models.KoboDownloadRequest{AccessToken: "device-token", URL: "https://example.com/1"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/readeckobo/api/kobo/download", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 from the download, got %d", rr.Code)
+	}
+	var resp models.KoboDownloadResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	var qrURL *url.URL
+	for _, image := range resp.Images {
+		if u, err := url.Parse(image.Src); err == nil && strings.HasSuffix(u.Path, "/api/qr") {
+			qrURL = u
+		}
+	}
+	if qrURL == nil {
+		t.Fatalf("expected a QR code image in the article, got %+v", resp.Images)
+	}
+	if want := "http://example.com/readeckobo" + storeapi.InstapaperPath + "/api/qr"; qrURL.Scheme+"://"+qrURL.Host+qrURL.Path != want {
+		t.Errorf("expected the QR code at %s, got %s", want, qrURL)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, qrURL.RequestURI(), nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected the QR code at %s, got status %d and %q", qrURL.RequestURI(), rr.Code, rr.Header().Get("Content-Type"))
+	}
+}